@@ -126,9 +126,28 @@ func (s *Server) healthAPIEntries() []*Entry {
 			Method:  "GET",
 			Handler: func(w http.ResponseWriter, r *http.Request) { /* 200 by default */ },
 		},
+		{
+			Path:    "/readyz",
+			Method:  "GET",
+			Handler: s.readiness,
+		},
 	}
 }
 
+func (s *Server) readiness(w http.ResponseWriter, r *http.Request) {
+	readiness := s.cluster.Readiness()
+
+	buff, err := yaml.Marshal(readiness)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", readiness, err))
+	}
+
+	if !readiness.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(buff)
+}
+
 func (s *Server) aboutAPIEntries() []*Entry {
 	return []*Entry{
 		{
@@ -132,6 +132,13 @@ type cluster struct {
 	leaseMutex   sync.RWMutex
 	sessionMutex sync.RWMutex
 
+	memberEventHandlers      []MemberEventFunc
+	memberEventHandlersMutex sync.RWMutex
+
+	synced         bool
+	liveMembers    int
+	readinessMutex sync.RWMutex
+
 	done chan struct{}
 }
 
@@ -144,18 +151,18 @@ func New(opt *option.Options) (Cluster, error) {
 		return nil, fmt.Errorf("invalid cluster request timeout: %v", err)
 	}
 
-	members, err := newMembers(opt)
-	if err != nil {
-		return nil, fmt.Errorf("new members failed: %v", err)
-	}
-
 	c := &cluster{
 		opt:            opt,
 		requestTimeout: requestTimeout,
-		members:        members,
 		done:           make(chan struct{}),
 	}
 
+	members, err := newMembers(opt, c.handleMemberEvent)
+	if err != nil {
+		return nil, fmt.Errorf("new members failed: %v", err)
+	}
+	c.members = members
+
 	c.initLayout()
 
 	c.run()
@@ -716,6 +723,10 @@ func (c *cluster) heartbeat() {
 			if err != nil {
 				logger.Errorf("update members failed: %v", err)
 			}
+			err = c.updateReadiness()
+			if err != nil {
+				logger.Errorf("update readiness failed: %v", err)
+			}
 		case <-c.done:
 			return
 		}
@@ -841,9 +852,42 @@ func (c *cluster) PurgeMember(memberName string) error {
 		return err
 	}
 
+	event := &MemberEvent{
+		Type: MemberEventPurge,
+		Name: memberName,
+	}
+	if id != nil {
+		event.ID = *id
+	}
+	c.handleMemberEvent(event)
+
 	return nil
 }
 
+func (c *cluster) AddMemberEventHandler(handler MemberEventFunc) {
+	c.memberEventHandlersMutex.Lock()
+	defer c.memberEventHandlersMutex.Unlock()
+
+	c.memberEventHandlers = append(c.memberEventHandlers, handler)
+}
+
+func (c *cluster) handleMemberEvent(event *MemberEvent) {
+	c.memberEventHandlersMutex.RLock()
+	handlers := make([]MemberEventFunc, len(c.memberEventHandlers))
+	copy(handlers, c.memberEventHandlers)
+	c.memberEventHandlersMutex.RUnlock()
+
+	logger.Infof("member %s(%x) %s: %s", event.Name, event.ID, event.PeerURL, event.Type)
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+func (c *cluster) MemberSnapshots() []*MemberSnapshot {
+	return c.members.snapshot()
+}
+
 func (c *cluster) Close(wg *sync.WaitGroup) {
 	defer wg.Done()
 
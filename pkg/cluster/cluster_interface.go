@@ -62,6 +62,18 @@ type (
 		Close(wg *sync.WaitGroup)
 
 		PurgeMember(member string) error
+
+		// MemberSnapshots returns a copy of all known members,
+		// the modification of it has no effect on the cluster.
+		MemberSnapshots() []*MemberSnapshot
+
+		// AddMemberEventHandler adds the handler called when members join,
+		// leave or are purged. It is called without holding internal locks.
+		AddMemberEventHandler(handler MemberEventFunc)
+
+		// Readiness reports whether the member has synchronized the
+		// cluster status and sees enough live writers to serve traffic.
+		Readiness() *Readiness
 	}
 
 	// Watcher wraps etcd watcher.
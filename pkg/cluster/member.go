@@ -21,11 +21,14 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
 	yaml "gopkg.in/yaml.v2"
@@ -37,6 +40,18 @@ import (
 const (
 	membersFilename       = "members.yaml"
 	membersBackupFilename = "members.bak.yaml"
+
+	// MemberStatusCluster means the member is in the etcd cluster member list.
+	MemberStatusCluster = "cluster"
+	// MemberStatusKnown means the member is only known by the joining URLs or history.
+	MemberStatusKnown = "known"
+
+	// MemberEventJoin means the member joined the cluster member list.
+	MemberEventJoin = "join"
+	// MemberEventLeave means the member left the cluster member list.
+	MemberEventLeave = "leave"
+	// MemberEventPurge means the member was purged with all stuff under its lease.
+	MemberEventPurge = "purge"
 )
 
 type (
@@ -50,6 +65,16 @@ type (
 
 		selfIDChanged bool
 
+		// maxKnownMembers is the cap of KnownMembers, the members out of
+		// the cluster member list with the oldest lastSeen are evicted first.
+		maxKnownMembers int
+
+		// lastSeen is the last time of every PeerURL seen in the cluster member list.
+		lastSeen map[string]time.Time
+
+		// onEvent is called without holding the lock.
+		onEvent MemberEventFunc
+
 		ClusterMembers *membersSlice `yaml:"clusterMembers"`
 		KnownMembers   *membersSlice `yaml:"knownMembers"`
 	}
@@ -62,13 +87,42 @@ type (
 		Name    string `yaml:"name"`
 		PeerURL string `yaml:"peerURL"`
 	}
+
+	// MemberSnapshot is the copied information of one member.
+	MemberSnapshot struct {
+		ID      uint64 `yaml:"id"`
+		Name    string `yaml:"name"`
+		PeerURL string `yaml:"peerURL"`
+		Address string `yaml:"address"`
+		Port    string `yaml:"port"`
+		Status  string `yaml:"status"`
+
+		// RFC3339 format, empty means never seen in the cluster member list.
+		LastSeenTime string `yaml:"lastSeenTime,omitempty"`
+	}
+
+	// MemberEvent is the event of the cluster member list changing.
+	MemberEvent struct {
+		Type    string
+		ID      uint64
+		Name    string
+		PeerURL string
+	}
+
+	// MemberEventFunc handles member events.
+	MemberEventFunc func(event *MemberEvent)
 )
 
-func newMembers(opt *option.Options) (*members, error) {
+// newMembers creates members, onEvent could be nil.
+func newMembers(opt *option.Options, onEvent MemberEventFunc) (*members, error) {
 	m := &members{
 		opt:        opt,
+		onEvent:    onEvent,
 		file:       filepath.Join(opt.AbsMemberDir, membersFilename),
 		backupFile: filepath.Join(opt.AbsMemberDir, membersBackupFilename),
+		lastSeen:   make(map[string]time.Time),
+
+		maxKnownMembers: opt.ClusterMaxKnownMembers,
 
 		ClusterMembers: newMemberSlices(),
 		KnownMembers:   newMemberSlices(),
@@ -204,6 +258,13 @@ func (m *members) clusterMembersLen() int {
 }
 
 func (m *members) updateClusterMembers(pbMembers []*pb.Member) {
+	events := m._updateClusterMembers(pbMembers)
+
+	// NOTE: Call it after unlocking, so that the handler can use members.
+	m.emit(events)
+}
+
+func (m *members) _updateClusterMembers(pbMembers []*pb.Member) []*MemberEvent {
 	m.Lock()
 	defer m.Unlock()
 
@@ -213,8 +274,15 @@ func (m *members) updateClusterMembers(pbMembers []*pb.Member) {
 	// NOTE: The member list of result of MemberAdd carrys empty name
 	// of the adding member which is myself.
 	ms.update(membersSlice{m._selfWithoutID()})
+
+	events := diffMembers(*m.ClusterMembers, ms)
 	m.ClusterMembers.replace(ms)
 
+	now := time.Now()
+	for _, member := range *m.ClusterMembers {
+		m.lastSeen[member.PeerURL] = now
+	}
+
 	selfID := m._self().ID
 	if selfID != olderSelfID {
 		logger.Infof("self ID changed from %x to %x", olderSelfID, selfID)
@@ -223,8 +291,76 @@ func (m *members) updateClusterMembers(pbMembers []*pb.Member) {
 
 	// NOTE: KnownMembers store members as many as possible
 	m.KnownMembers.update(*m.ClusterMembers)
+	m._evictKnownMembers()
 
 	m.store()
+
+	return events
+}
+
+// _evictKnownMembers evicts the members out of the cluster member list
+// until KnownMembers fits in maxKnownMembers, the never seen and the
+// least recently seen members go first.
+func (m *members) _evictKnownMembers() {
+	if m.maxKnownMembers <= 0 || m.KnownMembers.Len() <= m.maxKnownMembers {
+		return
+	}
+
+	candidates := membersSlice{}
+	for _, member := range *m.KnownMembers {
+		if m.ClusterMembers.getByPeerURL(member.PeerURL) == nil {
+			candidates = append(candidates, member)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return m.lastSeen[candidates[i].PeerURL].Before(m.lastSeen[candidates[j].PeerURL])
+	})
+
+	for _, member := range candidates {
+		if m.KnownMembers.Len() <= m.maxKnownMembers {
+			break
+		}
+		logger.Infof("evict known member %s(%s)", member.Name, member.PeerURL)
+		m.KnownMembers.deleteByPeerURL(member.PeerURL)
+		delete(m.lastSeen, member.PeerURL)
+	}
+}
+
+func (m *members) emit(events []*MemberEvent) {
+	if m.onEvent == nil {
+		return
+	}
+
+	for _, event := range events {
+		m.onEvent(event)
+	}
+}
+
+// diffMembers returns the join and leave events from older to newer.
+func diffMembers(older, newer membersSlice) []*MemberEvent {
+	events := []*MemberEvent{}
+	for _, member := range newer {
+		if older.getByPeerURL(member.PeerURL) == nil {
+			events = append(events, &MemberEvent{
+				Type:    MemberEventJoin,
+				ID:      member.ID,
+				Name:    member.Name,
+				PeerURL: member.PeerURL,
+			})
+		}
+	}
+	for _, member := range older {
+		if newer.getByPeerURL(member.PeerURL) == nil {
+			events = append(events, &MemberEvent{
+				Type:    MemberEventLeave,
+				ID:      member.ID,
+				Name:    member.Name,
+				PeerURL: member.PeerURL,
+			})
+		}
+	}
+
+	return events
 }
 
 func (m *members) knownMembersLen() int {
@@ -247,6 +383,40 @@ func (m *members) initCluster() string {
 	return m.ClusterMembers.initCluster()
 }
 
+func (m *members) snapshot() []*MemberSnapshot {
+	m.RLock()
+	defer m.RUnlock()
+
+	snapshots := make([]*MemberSnapshot, 0, m.KnownMembers.Len())
+	for _, member := range *m.KnownMembers {
+		snapshot := &MemberSnapshot{
+			ID:      member.ID,
+			Name:    member.Name,
+			PeerURL: member.PeerURL,
+			Status:  MemberStatusKnown,
+		}
+
+		if u, err := url.Parse(member.PeerURL); err == nil {
+			snapshot.Address, snapshot.Port, err = net.SplitHostPort(u.Host)
+			if err != nil {
+				snapshot.Address = u.Host
+			}
+		}
+
+		if m.ClusterMembers.getByPeerURL(member.PeerURL) != nil {
+			snapshot.Status = MemberStatusCluster
+		}
+
+		if t, exists := m.lastSeen[member.PeerURL]; exists {
+			snapshot.LastSeenTime = t.Format(time.RFC3339)
+		}
+
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots
+}
+
 func pbMembersToMembersSlice(pbMembers []*pb.Member) membersSlice {
 	ms := make(membersSlice, 0)
 	for _, pbMember := range pbMembers {
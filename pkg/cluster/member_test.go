@@ -137,7 +137,7 @@ func TestUpdateClusterMembers(t *testing.T) {
 	opts, ms, pbMembers := mockMembers(9)
 
 	newTestMembers := func() *members {
-		m, err := newMembers(opts[0])
+		m, err := newMembers(opts[0], nil)
 		if err != nil {
 			panic(fmt.Errorf("new memebrs failed: %v", err))
 		}
@@ -181,3 +181,116 @@ func TestUpdateClusterMembers(t *testing.T) {
 		})
 	}
 }
+
+func TestMembersSnapshot(t *testing.T) {
+	opts, ms, pbMembers := mockMembers(3)
+
+	m, err := newMembers(opts[0], nil)
+	if err != nil {
+		t.Fatalf("new members failed: %v", err)
+	}
+	m.KnownMembers.update(ms)
+	m.updateClusterMembers(pbMembers[0:2])
+
+	snapshots := m.snapshot()
+	if len(snapshots) != 3 {
+		t.Fatalf("want 3 snapshots, got %d", len(snapshots))
+	}
+
+	for i, snapshot := range snapshots {
+		if snapshot.Name != ms[i].Name || snapshot.PeerURL != ms[i].PeerURL {
+			t.Errorf("snapshot %+v mismatch member %+v", snapshot, ms[i])
+		}
+		if snapshot.Address != "localhost" || snapshot.Port == "" {
+			t.Errorf("snapshot %+v got wrong address", snapshot)
+		}
+
+		if i < 2 {
+			if snapshot.Status != MemberStatusCluster || snapshot.LastSeenTime == "" {
+				t.Errorf("snapshot %+v should be seen in cluster", snapshot)
+			}
+		} else {
+			if snapshot.Status != MemberStatusKnown || snapshot.LastSeenTime != "" {
+				t.Errorf("snapshot %+v should be only known", snapshot)
+			}
+		}
+	}
+
+	snapshots[0].Name = "modified"
+	if m.KnownMembers.getByName("modified") != nil {
+		t.Errorf("modify snapshot should not change members")
+	}
+}
+
+func TestMembersEvent(t *testing.T) {
+	opts, ms, pbMembers := mockMembers(3)
+
+	var m *members
+	events := []*MemberEvent{}
+	m, err := newMembers(opts[0], func(event *MemberEvent) {
+		// NOTE: It would be deadlock if the handler is called with holding lock.
+		m.clusterMembersLen()
+		events = append(events, event)
+	})
+	if err != nil {
+		t.Fatalf("new members failed: %v", err)
+	}
+
+	m.updateClusterMembers(pbMembers)
+	if len(events) != 2 {
+		t.Fatalf("want 2 join events, got %d", len(events))
+	}
+	for i, event := range events {
+		if event.Type != MemberEventJoin || event.Name != ms[i+1].Name {
+			t.Errorf("unexpected event %+v", event)
+		}
+	}
+
+	events = events[:0]
+	m.updateClusterMembers(pbMembers)
+	if len(events) != 0 {
+		t.Errorf("want no event for the same members, got %d", len(events))
+	}
+
+	m.updateClusterMembers(pbMembers[0:2])
+	if len(events) != 1 {
+		t.Fatalf("want 1 leave event, got %d", len(events))
+	}
+	if events[0].Type != MemberEventLeave || events[0].Name != ms[2].Name {
+		t.Errorf("unexpected event %+v", events[0])
+	}
+}
+
+func TestMembersEvictKnownMembers(t *testing.T) {
+	opts, ms, pbMembers := mockMembers(6)
+	opts[0].ClusterMaxKnownMembers = 3
+
+	m, err := newMembers(opts[0], nil)
+	if err != nil {
+		t.Fatalf("new members failed: %v", err)
+	}
+	m.KnownMembers.update(ms)
+
+	now := time.Now()
+	m.lastSeen[ms[3].PeerURL] = now.Add(-time.Minute)
+	m.lastSeen[ms[4].PeerURL] = now.Add(-2 * time.Minute)
+
+	m.updateClusterMembers(pbMembers[0:2])
+
+	if m.knownMembersLen() != 3 {
+		t.Fatalf("want 3 known members, got %d: %s", m.knownMembersLen(), m.KnownMembers)
+	}
+	for _, i := range []int{0, 1, 3} {
+		if m.KnownMembers.getByPeerURL(ms[i].PeerURL) == nil {
+			t.Errorf("member %s should be kept", ms[i].Name)
+		}
+	}
+	for _, i := range []int{2, 4, 5} {
+		if m.KnownMembers.getByPeerURL(ms[i].PeerURL) != nil {
+			t.Errorf("member %s should be evicted", ms[i].Name)
+		}
+		if _, exists := m.lastSeen[ms[i].PeerURL]; exists {
+			t.Errorf("last seen time of member %s should be evicted", ms[i].Name)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"fmt"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+// liveMemberTimeout is the max age of the last heartbeat of a live member.
+const liveMemberTimeout = 3 * HeartbeatInterval
+
+// Readiness is the readiness of the member, it is ready only if it has
+// synchronized the cluster status at least once and the live writers reach
+// the quorum.
+type Readiness struct {
+	Ready       bool   `yaml:"ready"`
+	Synced      bool   `yaml:"synced"`
+	LiveMembers int    `yaml:"liveMembers"`
+	Quorum      int    `yaml:"quorum"`
+	Reason      string `yaml:"reason,omitempty"`
+}
+
+func newReadiness(synced bool, liveMembers, quorum int) *Readiness {
+	r := &Readiness{
+		Synced:      synced,
+		LiveMembers: liveMembers,
+		Quorum:      quorum,
+	}
+
+	switch {
+	case !synced:
+		r.Reason = "cluster status not synchronized yet"
+	case liveMembers < quorum:
+		r.Reason = fmt.Sprintf("live members %d less than quorum %d", liveMembers, quorum)
+	default:
+		r.Ready = true
+	}
+
+	return r
+}
+
+// countLiveWriters counts the writers whose last heartbeat is within
+// liveMemberTimeout, statuses are the values under the member status prefix.
+func countLiveWriters(statuses map[string]string, now time.Time) int {
+	count := 0
+	for key, value := range statuses {
+		status := &MemberStatus{}
+		err := yaml.Unmarshal([]byte(value), status)
+		if err != nil {
+			logger.Errorf("unmarshal %s to member status failed: %v", key, err)
+			continue
+		}
+
+		if status.Options.ClusterRole != "writer" {
+			continue
+		}
+
+		heartbeat, err := time.Parse(time.RFC3339, status.LastHeartbeatTime)
+		if err != nil {
+			continue
+		}
+		if now.Sub(heartbeat) <= liveMemberTimeout {
+			count++
+		}
+	}
+
+	return count
+}
+
+func (c *cluster) updateReadiness() error {
+	statuses, err := c.GetPrefix(c.Layout().StatusMemberPrefix())
+	if err != nil {
+		return err
+	}
+
+	liveMembers := countLiveWriters(statuses, time.Now())
+
+	c.readinessMutex.Lock()
+	defer c.readinessMutex.Unlock()
+
+	c.synced = true
+	c.liveMembers = liveMembers
+
+	return nil
+}
+
+func (c *cluster) quorum() int {
+	if c.opt.ClusterReadyQuorum > 0 {
+		return c.opt.ClusterReadyQuorum
+	}
+	return c.members.clusterMembersLen()/2 + 1
+}
+
+func (c *cluster) Readiness() *Readiness {
+	c.readinessMutex.RLock()
+	defer c.readinessMutex.RUnlock()
+
+	return newReadiness(c.synced, c.liveMembers, c.quorum())
+}
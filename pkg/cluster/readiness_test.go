@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestNewReadiness(t *testing.T) {
+	if r := newReadiness(false, 3, 2); r.Ready || r.Reason == "" {
+		t.Errorf("unsynced member should not be ready: %+v", r)
+	}
+	if r := newReadiness(true, 1, 2); r.Ready || r.Reason == "" {
+		t.Errorf("member below quorum should not be ready: %+v", r)
+	}
+	if r := newReadiness(true, 2, 2); !r.Ready || r.Reason != "" {
+		t.Errorf("member reaching quorum should be ready: %+v", r)
+	}
+}
+
+func TestCountLiveWriters(t *testing.T) {
+	now := time.Now()
+	status := func(role string, heartbeat time.Time) string {
+		return fmt.Sprintf("options:\n  cluster-role: %s\nlastHeartbeatTime: %q\n",
+			role, heartbeat.Format(time.RFC3339))
+	}
+
+	statuses := map[string]string{
+		"/status/members/w1": status("writer", now),
+		"/status/members/w2": status("writer", now.Add(-HeartbeatInterval)),
+		"/status/members/w3": status("writer", now.Add(-2*liveMemberTimeout)),
+		"/status/members/r1": status("reader", now),
+		"/status/members/x1": "{{invalid",
+	}
+
+	if count := countLiveWriters(statuses, now); count != 2 {
+		t.Errorf("expected 2 live writers, got %d", count)
+	}
+}
@@ -0,0 +1,263 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslogger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/kafkaconfig"
+	"github.com/megaease/easegress/pkg/util/timetool"
+)
+
+const (
+	// Kind is the kind of AccessLogger.
+	Kind = "AccessLogger"
+
+	// OutputStdout writes the access logs to the standard output.
+	OutputStdout = "stdout"
+	// OutputKafka sends the access logs to the kafka topic.
+	OutputKafka = "kafka"
+
+	redactedValue = "REDACTED"
+)
+
+var results = []string{}
+
+func init() {
+	httppipeline.Register(&AccessLogger{})
+}
+
+type (
+	// AccessLogger is the filter emitting a structured access log for the
+	// sampled requests after they're finished.
+	AccessLogger struct {
+		filterSpec *httppipeline.FilterSpec
+		spec       *Spec
+		format     *template.Template
+		allowlist  map[string]bool
+		writer     writer
+	}
+
+	// Spec is the spec of AccessLogger.
+	Spec struct {
+		// Format is a Go template of Entry, empty means an Entry in JSON.
+		Format string `yaml:"format,omitempty" jsonschema:"omitempty"`
+		// SampleRate is the ratio of the requests logged.
+		SampleRate float64 `yaml:"sampleRate" jsonschema:"required,minimum=0,maximum=1"`
+		// Upstream is logged as the upstream of the requests.
+		Upstream string `yaml:"upstream,omitempty" jsonschema:"omitempty"`
+		// HeaderAllowlist are the request headers logged with values,
+		// the values of the other headers are redacted.
+		HeaderAllowlist []string `yaml:"headerAllowlist,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+
+		// Output is where the access logs go, default is stdout.
+		Output string     `yaml:"output,omitempty" jsonschema:"omitempty,enum=,enum=stdout,enum=kafka"`
+		Kafka  *KafkaSpec `yaml:"kafka,omitempty" jsonschema:"omitempty"`
+	}
+
+	// KafkaSpec is the kafka output of access logs.
+	KafkaSpec struct {
+		Brokers []string `yaml:"brokers" jsonschema:"required,uniqueItems=true"`
+		Topic   string   `yaml:"topic" jsonschema:"required"`
+		// Timeout is the dial timeout in milliseconds, zero means the default.
+		Timeout int `yaml:"timeout,omitempty" jsonschema:"omitempty,minimum=0"`
+		// SASL authenticates the producer, nil means no authentication.
+		SASL *KafkaSASLSpec `yaml:"sasl,omitempty" jsonschema:"omitempty"`
+		// TLS encrypts the connections to the brokers, nil means plaintext.
+		TLS *KafkaTLSSpec `yaml:"tls,omitempty" jsonschema:"omitempty"`
+		// BufferMaxLines and BufferMaxBytes bound the lines buffered to be
+		// sent, the oldest ones are dropped beyond them, default is 1000
+		// lines and 1000000 bytes.
+		BufferMaxLines int `yaml:"bufferMaxLines,omitempty" jsonschema:"omitempty,minimum=0"`
+		BufferMaxBytes int `yaml:"bufferMaxBytes,omitempty" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// KafkaSASLSpec is the SASL authentication of the kafka producer.
+	KafkaSASLSpec = kafkaconfig.SASLSpec
+
+	// KafkaTLSSpec is the TLS of the kafka producer.
+	KafkaTLSSpec = kafkaconfig.TLSSpec
+
+	// Status is the status of AccessLogger.
+	Status struct {
+		// BufferDepth is the number of the lines waiting to be sent.
+		BufferDepth int `yaml:"bufferDepth"`
+		// Dropped is the number of the lines dropped, because the buffer
+		// is full or they failed to be sent.
+		Dropped uint64 `yaml:"dropped"`
+	}
+
+	// Entry is an access log entry.
+	Entry struct {
+		Time      string            `json:"time"`
+		Method    string            `json:"method"`
+		Path      string            `json:"path"`
+		Status    int               `json:"status"`
+		LatencyMs float64           `json:"latencyMs"`
+		Upstream  string            `json:"upstream,omitempty"`
+		RealIP    string            `json:"realIP"`
+		Headers   map[string]string `json:"headers,omitempty"`
+	}
+)
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	if spec.Output == OutputKafka && spec.Kafka == nil {
+		return fmt.Errorf("output kafka without kafka spec")
+	}
+
+	if spec.Format != "" {
+		if _, err := template.New("format").Parse(spec.Format); err != nil {
+			return fmt.Errorf("invalid format %s: %v", spec.Format, err)
+		}
+	}
+
+	return nil
+}
+
+// Kind returns the kind of AccessLogger.
+func (al *AccessLogger) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of AccessLogger.
+func (al *AccessLogger) DefaultSpec() interface{} {
+	return &Spec{SampleRate: 1}
+}
+
+// Description returns the description of AccessLogger.
+func (al *AccessLogger) Description() string {
+	return "AccessLogger emits structured access logs of the sampled requests."
+}
+
+// Results returns the results of AccessLogger.
+func (al *AccessLogger) Results() []string {
+	return results
+}
+
+// Init initializes AccessLogger.
+func (al *AccessLogger) Init(filterSpec *httppipeline.FilterSpec) {
+	al.filterSpec, al.spec = filterSpec, filterSpec.FilterSpec().(*Spec)
+	if al.spec.Format != "" {
+		al.format = template.Must(template.New("format").Parse(al.spec.Format))
+	}
+
+	al.allowlist = map[string]bool{}
+	for _, key := range al.spec.HeaderAllowlist {
+		al.allowlist[http.CanonicalHeaderKey(key)] = true
+	}
+
+	switch al.spec.Output {
+	case OutputKafka:
+		al.writer = newKafkaWriter(filterSpec.Name(), al.spec.Kafka)
+	default:
+		al.writer = newStdoutWriter()
+	}
+}
+
+// Inherit inherits previous generation of AccessLogger.
+func (al *AccessLogger) Inherit(filterSpec *httppipeline.FilterSpec, previousGeneration httppipeline.Filter) {
+	previousGeneration.Close()
+	al.Init(filterSpec)
+}
+
+// Handle records the sampled request, and logs it after it's finished.
+func (al *AccessLogger) Handle(ctx context.HTTPContext) string {
+	if al.spec.SampleRate < 1 && rand.Float64() >= al.spec.SampleRate {
+		return ctx.CallNextHandler("")
+	}
+
+	// NOTE: The request is recorded before the following filters,
+	// which could rewrite its path and headers.
+	r := ctx.Request()
+	entry := &Entry{
+		Time:     time.Now().Format(timetool.RFC3339Milli),
+		Method:   r.Method(),
+		Path:     r.Path(),
+		Upstream: al.spec.Upstream,
+		RealIP:   r.RealIP(),
+		Headers:  al.headers(r.Header().Std()),
+	}
+
+	ctx.OnFinish(func() {
+		entry.Status = ctx.Response().StatusCode()
+		entry.LatencyMs = float64(ctx.Duration()) / float64(time.Millisecond)
+
+		line, err := al.render(entry)
+		if err != nil {
+			logger.Errorf("%s: render access log failed: %v", al.filterSpec.Name(), err)
+			return
+		}
+		al.writer.write(line)
+	})
+
+	return ctx.CallNextHandler("")
+}
+
+// headers returns the request headers, the values of the ones not in the
+// allowlist are redacted.
+func (al *AccessLogger) headers(h http.Header) map[string]string {
+	headers := make(map[string]string, len(h))
+	for key, values := range h {
+		if al.allowlist[http.CanonicalHeaderKey(key)] {
+			headers[key] = strings.Join(values, ",")
+		} else {
+			headers[key] = redactedValue
+		}
+	}
+	return headers
+}
+
+func (al *AccessLogger) render(entry *Entry) ([]byte, error) {
+	if al.format == nil {
+		return json.Marshal(entry)
+	}
+
+	buff := &bytes.Buffer{}
+	err := al.format.Execute(buff, entry)
+	return buff.Bytes(), err
+}
+
+// Status returns status.
+func (al *AccessLogger) Status() interface{} {
+	if al.writer == nil {
+		return nil
+	}
+
+	if status := al.writer.status(); status != nil {
+		return status
+	}
+	return nil
+}
+
+// Close closes AccessLogger.
+func (al *AccessLogger) Close() {
+	if al.writer != nil {
+		al.writer.close()
+	}
+}
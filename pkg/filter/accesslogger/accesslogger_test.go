@@ -0,0 +1,255 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslogger
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/yamltool"
+)
+
+func newAccessLogger(t *testing.T, yamlSpec string) (*AccessLogger, *bytes.Buffer) {
+	rawSpec := make(map[string]interface{})
+	yamltool.Unmarshal([]byte(yamlSpec), &rawSpec)
+
+	spec, err := httppipeline.NewFilterSpec(rawSpec, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	al := &AccessLogger{}
+	al.Init(spec)
+
+	buff := &bytes.Buffer{}
+	al.writer = &stdoutWriter{out: buff}
+	return al, buff
+}
+
+// handle handles a request with the context, and finishes it.
+func handle(al *AccessLogger) {
+	ctx := &contexttest.MockedHTTPContext{}
+	h := httpheader.New(http.Header{
+		"Authorization": []string{"Bearer secret"},
+		"X-Request-Id":  []string{"abc"},
+	})
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader { return h }
+	ctx.MockedRequest.MockedMethod = func() string { return http.MethodGet }
+	ctx.MockedRequest.MockedPath = func() string { return "/orders/1" }
+	ctx.MockedRequest.MockedRealIP = func() string { return "10.0.0.1" }
+	ctx.MockedResponse.MockedStatusCode = func() int { return http.StatusCreated }
+	ctx.MockedDuration = func() time.Duration { return 15 * time.Millisecond }
+
+	finishFuncs := []func(){}
+	ctx.MockedOnFinish = func(fn func()) { finishFuncs = append(finishFuncs, fn) }
+	ctx.MockedCallNextHandler = func(lastResult string) string { return lastResult }
+
+	al.Handle(ctx)
+	for _, fn := range finishFuncs {
+		fn()
+	}
+}
+
+func TestAccessLoggerJSON(t *testing.T) {
+	al, buff := newAccessLogger(t, `
+kind: AccessLogger
+name: accessLogger
+sampleRate: 1
+upstream: http://127.0.0.1:8080
+headerAllowlist: [x-request-id]
+`)
+	handle(al)
+
+	entry := &Entry{}
+	err := json.Unmarshal(buff.Bytes(), entry)
+	if err != nil {
+		t.Fatalf("unmarshal %s failed: %v", buff.String(), err)
+	}
+
+	if entry.Method != http.MethodGet || entry.Path != "/orders/1" || entry.Status != http.StatusCreated ||
+		entry.LatencyMs != 15 || entry.Upstream != "http://127.0.0.1:8080" || entry.RealIP != "10.0.0.1" {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+	if entry.Headers["X-Request-Id"] != "abc" {
+		t.Errorf("allowed header should be logged, got %v", entry.Headers)
+	}
+	if entry.Headers["Authorization"] != redactedValue {
+		t.Errorf("header not in allowlist should be redacted, got %v", entry.Headers)
+	}
+}
+
+func TestAccessLoggerFormatAndSampling(t *testing.T) {
+	al, buff := newAccessLogger(t, `
+kind: AccessLogger
+name: accessLogger
+sampleRate: 1
+format: '{{.Method}} {{.Path}} {{.Status}} {{index .Headers "Authorization"}}'
+`)
+	handle(al)
+
+	if got := strings.TrimSpace(buff.String()); got != "GET /orders/1 201 "+redactedValue {
+		t.Errorf("unexpected log line: %s", got)
+	}
+
+	al, buff = newAccessLogger(t, `
+kind: AccessLogger
+name: accessLogger
+sampleRate: 0
+`)
+	for i := 0; i < 10; i++ {
+		handle(al)
+	}
+	if buff.Len() != 0 {
+		t.Errorf("no request should be sampled, got %s", buff.String())
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	if err := (Spec{Output: OutputKafka}).Validate(); err == nil {
+		t.Errorf("want error for kafka output without kafka spec")
+	}
+	if err := (Spec{Format: "{{.Method"}).Validate(); err == nil {
+		t.Errorf("want error for invalid format")
+	}
+	if err := (Spec{Output: OutputKafka, Kafka: &KafkaSpec{Brokers: []string{"127.0.0.1:9092"}, Topic: "log"}}).Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestAccessLoggerKafkaUnavailable(t *testing.T) {
+	rawSpec := make(map[string]interface{})
+	yamltool.Unmarshal([]byte(`
+kind: AccessLogger
+name: accessLogger
+sampleRate: 1
+output: kafka
+kafka:
+  brokers: [127.0.0.1:1]
+  topic: log-access
+  timeout: 100
+  bufferMaxLines: 10
+`), &rawSpec)
+	spec, err := httppipeline.NewFilterSpec(rawSpec, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	al := &AccessLogger{}
+	al.Init(spec)
+	defer al.Close()
+
+	// NOTE: The kafka is unreachable, the requests must not wait for it.
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		handle(al)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("requests should not be blocked by unreachable kafka, took %v", elapsed)
+	}
+
+	status := al.Status().(*Status)
+	if status.BufferDepth != 10 || status.Dropped != 90 {
+		t.Errorf("want 10 lines buffered and 90 dropped, got %+v", status)
+	}
+}
+
+func newCACertBase64(t *testing.T) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key failed: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kafka-ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate failed: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestKafkaProducerConfig(t *testing.T) {
+	spec := &KafkaSpec{Brokers: []string{"127.0.0.1:9092"}, Topic: "log", Timeout: 3000}
+	config, err := spec.producerConfig("access-logger")
+	if err != nil {
+		t.Fatalf("build producer config failed: %v", err)
+	}
+	if config.Net.SASL.Enable || config.Net.TLS.Enable {
+		t.Errorf("want plaintext without sasl and tls")
+	}
+	if config.ClientID != "access-logger" || config.Net.DialTimeout != 3*time.Second {
+		t.Errorf("want client id and dial timeout set, got %s %v", config.ClientID, config.Net.DialTimeout)
+	}
+
+	spec.SASL = &KafkaSASLSpec{Mechanism: sarama.SASLTypeSCRAMSHA512, Username: "easegress", Password: "secret"}
+	spec.TLS = &KafkaTLSSpec{CACertBase64: newCACertBase64(t)}
+	config, err = spec.producerConfig("access-logger")
+	if err != nil {
+		t.Fatalf("build producer config failed: %v", err)
+	}
+	sasl := config.Net.SASL
+	if !sasl.Enable || sasl.Mechanism != sarama.SASLTypeSCRAMSHA512 || sasl.User != "easegress" || sasl.Password != "secret" {
+		t.Errorf("want scram sasl, got %+v", sasl)
+	}
+	if sasl.SCRAMClientGeneratorFunc == nil || sasl.SCRAMClientGeneratorFunc() == nil {
+		t.Errorf("want scram client generator")
+	}
+	if !config.Net.TLS.Enable || config.Net.TLS.Config.RootCAs == nil {
+		t.Errorf("want tls with the ca cert, got %+v", config.Net.TLS)
+	}
+
+	spec.SASL = &KafkaSASLSpec{Mechanism: sarama.SASLTypePlaintext, Username: "easegress", Password: "secret"}
+	spec.TLS = &KafkaTLSSpec{}
+	config, err = spec.producerConfig("access-logger")
+	if err != nil {
+		t.Fatalf("build producer config failed: %v", err)
+	}
+	if config.Net.SASL.SCRAMClientGeneratorFunc != nil || config.Net.TLS.Config.RootCAs != nil {
+		t.Errorf("want plain sasl and tls with the system cas")
+	}
+
+	spec.TLS = &KafkaTLSSpec{CACertBase64: base64.StdEncoding.EncodeToString([]byte("not a cert"))}
+	if _, err = spec.producerConfig("access-logger"); err == nil {
+		t.Errorf("want error for invalid ca cert")
+	}
+	if err = spec.TLS.Validate(); err == nil {
+		t.Errorf("want error for invalid ca cert")
+	}
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslogger
+
+import (
+	"sync"
+)
+
+const (
+	// DefaultBufferMaxLines is the default max number of the lines buffered.
+	DefaultBufferMaxLines = 1000
+	// DefaultBufferMaxBytes is the default max bytes of the lines buffered.
+	DefaultBufferMaxBytes = 1000000
+)
+
+// buffer is the bounded buffer of the lines to export, the oldest lines are
+// dropped if it's full, so writing to it never blocks.
+type buffer struct {
+	mutex    sync.Mutex
+	lines    [][]byte
+	bytes    int
+	maxLines int
+	maxBytes int
+	dropped  uint64
+
+	// notify is signaled after a line is pushed.
+	notify chan struct{}
+}
+
+func newBuffer(maxLines, maxBytes int) *buffer {
+	if maxLines <= 0 {
+		maxLines = DefaultBufferMaxLines
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultBufferMaxBytes
+	}
+
+	return &buffer{
+		maxLines: maxLines,
+		maxBytes: maxBytes,
+		notify:   make(chan struct{}, 1),
+	}
+}
+
+// push pushes the line, the oldest lines are dropped to make room for it,
+// the line itself is dropped if it's larger than the buffer.
+func (b *buffer) push(line []byte) {
+	b.mutex.Lock()
+	if len(line) > b.maxBytes {
+		b.dropped++
+		b.mutex.Unlock()
+		return
+	}
+
+	for len(b.lines) >= b.maxLines || b.bytes+len(line) > b.maxBytes {
+		b.bytes -= len(b.lines[0])
+		b.lines[0] = nil
+		b.lines = b.lines[1:]
+		b.dropped++
+	}
+	b.lines = append(b.lines, line)
+	b.bytes += len(line)
+	b.mutex.Unlock()
+
+	select {
+	case b.notify <- struct{}{}:
+	default:
+	}
+}
+
+// pop pops the oldest line, false means the buffer is empty.
+func (b *buffer) pop() ([]byte, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if len(b.lines) == 0 {
+		return nil, false
+	}
+
+	line := b.lines[0]
+	b.lines[0] = nil
+	b.lines = b.lines[1:]
+	b.bytes -= len(line)
+	return line, true
+}
+
+// drop counts the lines dropped after they're popped.
+func (b *buffer) drop(n uint64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.dropped += n
+}
+
+// status returns the number of lines buffered and dropped.
+func (b *buffer) status() (depth int, dropped uint64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return len(b.lines), b.dropped
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslogger
+
+import (
+	"testing"
+)
+
+func TestBuffer(t *testing.T) {
+	b := newBuffer(3, 10)
+	for _, line := range []string{"a", "b", "c", "d"} {
+		b.push([]byte(line))
+	}
+	if depth, dropped := b.status(); depth != 3 || dropped != 1 {
+		t.Errorf("want the oldest line dropped by max lines, got depth %d dropped %d", depth, dropped)
+	}
+	if line, _ := b.pop(); string(line) != "b" {
+		t.Errorf("want the oldest line popped first, got %q", line)
+	}
+
+	b.push([]byte("efghijkl"))
+	if depth, dropped := b.status(); depth != 1 || dropped != 3 {
+		t.Errorf("want the oldest lines dropped by max bytes, got depth %d dropped %d", depth, dropped)
+	}
+
+	b.push([]byte("larger than the buffer"))
+	if depth, dropped := b.status(); depth != 1 || dropped != 4 {
+		t.Errorf("want the line larger than the buffer dropped, got depth %d dropped %d", depth, dropped)
+	}
+
+	select {
+	case <-b.notify:
+	default:
+		t.Errorf("want notified after push")
+	}
+
+	if line, ok := b.pop(); !ok || string(line) != "efghijkl" {
+		t.Errorf("want the last line, got %q", line)
+	}
+	if _, ok := b.pop(); ok {
+		t.Errorf("want empty buffer")
+	}
+
+	b = newBuffer(0, 0)
+	if b.maxLines != DefaultBufferMaxLines || b.maxBytes != DefaultBufferMaxBytes {
+		t.Errorf("want default bounds, got %d lines %d bytes", b.maxLines, b.maxBytes)
+	}
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslogger
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/kafkaconfig"
+)
+
+type (
+	writer interface {
+		write(line []byte)
+		status() *Status
+		close()
+	}
+
+	// stdoutWriter writes the lines to the standard output, the lines of
+	// concurrent requests are never interleaved.
+	stdoutWriter struct {
+		mutex sync.Mutex
+		out   io.Writer
+	}
+
+	// kafkaWriter sends the lines to the kafka topic in background, the
+	// lines are buffered until they're sent, so an unreachable kafka never
+	// blocks the requests, the oldest lines are dropped if the buffer is
+	// full. The producer is rebuilt until it succeeds.
+	kafkaWriter struct {
+		name   string
+		spec   *KafkaSpec
+		buffer *buffer
+
+		done      chan struct{}
+		closeOnce sync.Once
+	}
+)
+
+// producerRetryInterval is the interval of rebuilding the failed producer.
+var producerRetryInterval = 5 * time.Second
+
+func newStdoutWriter() *stdoutWriter {
+	return &stdoutWriter{out: os.Stdout}
+}
+
+func (w *stdoutWriter) write(line []byte) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.out.Write(append(line, '\n'))
+}
+
+func (w *stdoutWriter) status() *Status {
+	return nil
+}
+
+func (w *stdoutWriter) close() {}
+
+func newKafkaWriter(name string, spec *KafkaSpec) *kafkaWriter {
+	w := &kafkaWriter{
+		name:   name,
+		spec:   spec,
+		buffer: newBuffer(spec.BufferMaxLines, spec.BufferMaxBytes),
+		done:   make(chan struct{}),
+	}
+	go w.run()
+
+	return w
+}
+
+func (w *kafkaWriter) run() {
+	var producer sarama.AsyncProducer
+	defer func() {
+		if producer == nil {
+			return
+		}
+		if err := producer.Close(); err != nil {
+			logger.Errorf("%s: close kafka producer failed: %v", w.name, err)
+		}
+	}()
+
+	for {
+		if producer == nil {
+			producer = w.newProducer()
+			if producer == nil {
+				select {
+				case <-time.After(producerRetryInterval):
+					continue
+				case <-w.done:
+					return
+				}
+			}
+		}
+
+		line, ok := w.buffer.pop()
+		if !ok {
+			select {
+			case <-w.buffer.notify:
+				continue
+			case <-w.done:
+				return
+			}
+		}
+
+		select {
+		case producer.Input() <- &sarama.ProducerMessage{
+			Topic: w.spec.Topic,
+			Value: sarama.ByteEncoder(line),
+		}:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *kafkaWriter) newProducer() sarama.AsyncProducer {
+	config, err := w.spec.producerConfig(w.name)
+	if err != nil {
+		logger.Errorf("%s: build kafka producer config failed: %v", w.name, err)
+		return nil
+	}
+
+	producer, err := sarama.NewAsyncProducer(w.spec.Brokers, config)
+	if err != nil {
+		logger.Errorf("%s: start kafka producer failed(brokers: %v): %v",
+			w.name, w.spec.Brokers, err)
+		return nil
+	}
+
+	go func() {
+		for err := range producer.Errors() {
+			w.buffer.drop(1)
+			logger.Errorf("%s: produce access log failed: %v", w.name, err)
+		}
+	}()
+
+	return producer
+}
+
+func (w *kafkaWriter) write(line []byte) {
+	w.buffer.push(line)
+}
+
+func (w *kafkaWriter) status() *Status {
+	depth, dropped := w.buffer.status()
+	return &Status{BufferDepth: depth, Dropped: dropped}
+}
+
+func (w *kafkaWriter) close() {
+	w.closeOnce.Do(func() { close(w.done) })
+}
+
+// producerConfig returns the config of the producer, the connections are
+// plaintext without authentication unless SASL or TLS is specified.
+func (spec *KafkaSpec) producerConfig(clientID string) (*sarama.Config, error) {
+	return kafkaconfig.ProducerConfig(clientID, time.Duration(spec.Timeout)*time.Millisecond,
+		spec.SASL, spec.TLS)
+}
@@ -0,0 +1,211 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bodylimiter
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+)
+
+const (
+	// Kind is the kind of BodyLimiter.
+	Kind = "BodyLimiter"
+
+	resultRequestTooLarge  = "requestTooLarge"
+	resultResponseTooLarge = "responseTooLarge"
+)
+
+var (
+	results = []string{resultRequestTooLarge, resultResponseTooLarge}
+
+	errBodyTooLarge = fmt.Errorf("body too large")
+)
+
+func init() {
+	httppipeline.Register(&BodyLimiter{})
+}
+
+type (
+	// BodyLimiter is the filter to limit the body size of requests and responses.
+	BodyLimiter struct {
+		filterSpec *httppipeline.FilterSpec
+		spec       *Spec
+	}
+
+	// Spec is the spec of BodyLimiter, zero means no limit.
+	Spec struct {
+		MaxRequestBodyBytes  int64 `yaml:"maxRequestBodyBytes" jsonschema:"omitempty,minimum=0"`
+		MaxResponseBodyBytes int64 `yaml:"maxResponseBodyBytes" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// limitedReader fails once more than max bytes are read from it.
+	limitedReader struct {
+		reader    io.Reader
+		remaining int64
+		exceeded  bool
+	}
+)
+
+// Kind returns the kind of BodyLimiter.
+func (bl *BodyLimiter) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of BodyLimiter.
+func (bl *BodyLimiter) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Description returns the description of BodyLimiter.
+func (bl *BodyLimiter) Description() string {
+	return "BodyLimiter limits the body size of requests and responses."
+}
+
+// Results returns the results of BodyLimiter.
+func (bl *BodyLimiter) Results() []string {
+	return results
+}
+
+// Init initializes BodyLimiter.
+func (bl *BodyLimiter) Init(filterSpec *httppipeline.FilterSpec) {
+	bl.filterSpec, bl.spec = filterSpec, filterSpec.FilterSpec().(*Spec)
+}
+
+// Inherit inherits previous generation of BodyLimiter.
+func (bl *BodyLimiter) Inherit(filterSpec *httppipeline.FilterSpec, previousGeneration httppipeline.Filter) {
+	previousGeneration.Close()
+	bl.Init(filterSpec)
+}
+
+// Handle limits the body size of the request and the response.
+func (bl *BodyLimiter) Handle(ctx context.HTTPContext) string {
+	return bl.handle(ctx)
+}
+
+func (bl *BodyLimiter) handle(ctx context.HTTPContext) string {
+	var requestBody *limitedReader
+	if max := bl.spec.MaxRequestBodyBytes; max > 0 {
+		if ctx.Request().Std().ContentLength > max {
+			return bl.rejectRequest(ctx)
+		}
+
+		// NOTE: The streaming body without Content-Length is checked
+		// while the following filters are reading it.
+		requestBody = newLimitedReader(ctx.Request().Body(), max)
+		ctx.Request().SetBody(requestBody)
+	}
+
+	result := ctx.CallNextHandler("")
+
+	if requestBody != nil && requestBody.exceeded {
+		ctx.AddTag(fmt.Sprintf("bodyLimiter: request body exceeds %d bytes", bl.spec.MaxRequestBodyBytes))
+		discardBody(ctx.Response())
+		ctx.Response().SetStatusCode(http.StatusRequestEntityTooLarge)
+		return result
+	}
+
+	if max := bl.spec.MaxResponseBodyBytes; max > 0 {
+		w := ctx.Response()
+		contentLength, err := strconv.ParseInt(w.Header().Get("Content-Length"), 10, 64)
+		if err == nil && contentLength > max {
+			return bl.rejectResponse(ctx)
+		}
+
+		// NOTE: The status code has been decided before flushing the
+		// streaming body, so the exceeded body is truncated.
+		if w.Body() != nil {
+			w.SetBody(newLimitedReader(w.Body(), max))
+		}
+	}
+
+	return result
+}
+
+func (bl *BodyLimiter) rejectRequest(ctx context.HTTPContext) string {
+	ctx.AddTag(fmt.Sprintf("bodyLimiter: request body exceeds %d bytes", bl.spec.MaxRequestBodyBytes))
+	ctx.Response().SetStatusCode(http.StatusRequestEntityTooLarge)
+	return ctx.CallNextHandler(resultRequestTooLarge)
+}
+
+// rejectResponse responds 502 because the oversize body comes from the backend.
+func (bl *BodyLimiter) rejectResponse(ctx context.HTTPContext) string {
+	ctx.AddTag(fmt.Sprintf("bodyLimiter: response body exceeds %d bytes", bl.spec.MaxResponseBodyBytes))
+
+	discardBody(ctx.Response())
+	ctx.Response().SetStatusCode(http.StatusBadGateway)
+
+	return resultResponseTooLarge
+}
+
+func discardBody(w context.HTTPResponse) {
+	if body, ok := w.Body().(io.Closer); ok {
+		body.Close()
+	}
+	w.SetBody(nil)
+	w.Header().Del("Content-Length")
+}
+
+// Status returns status.
+func (bl *BodyLimiter) Status() interface{} {
+	return nil
+}
+
+// Close closes BodyLimiter.
+func (bl *BodyLimiter) Close() {}
+
+func newLimitedReader(reader io.Reader, max int64) *limitedReader {
+	return &limitedReader{
+		reader:    reader,
+		remaining: max,
+	}
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if lr.exceeded {
+		return 0, errBodyTooLarge
+	}
+
+	// NOTE: Read one more byte to know whether it exceeds.
+	if int64(len(p)) > lr.remaining+1 {
+		p = p[:lr.remaining+1]
+	}
+
+	n, err := lr.reader.Read(p)
+	if int64(n) > lr.remaining {
+		lr.exceeded = true
+		n = int(lr.remaining)
+		lr.remaining = 0
+		return n, errBodyTooLarge
+	}
+
+	lr.remaining -= int64(n)
+	return n, err
+}
+
+// Close closes the underlying reader if it is an io.Closer.
+func (lr *limitedReader) Close() error {
+	if closer, ok := lr.reader.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bodylimiter
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/yamltool"
+)
+
+func TestLimitedReader(t *testing.T) {
+	tests := []struct {
+		body     string
+		max      int64
+		exceeded bool
+	}{
+		{body: "", max: 4},
+		{body: "abc", max: 4},
+		{body: "abcd", max: 4},
+		{body: "abcde", max: 4, exceeded: true},
+		{body: strings.Repeat("a", 100000), max: 100000},
+		{body: strings.Repeat("a", 100001), max: 100000, exceeded: true},
+	}
+
+	for _, tt := range tests {
+		lr := newLimitedReader(strings.NewReader(tt.body), tt.max)
+		data, err := ioutil.ReadAll(lr)
+
+		if tt.exceeded {
+			if err != errBodyTooLarge || !lr.exceeded {
+				t.Errorf("body of %d bytes should exceed %d", len(tt.body), tt.max)
+			}
+			if int64(len(data)) != tt.max {
+				t.Errorf("want %d bytes read before exceeding, got %d", tt.max, len(data))
+			}
+			continue
+		}
+
+		if err != nil || lr.exceeded {
+			t.Errorf("body of %d bytes should not exceed %d: %v", len(tt.body), tt.max, err)
+		}
+		if string(data) != tt.body {
+			t.Errorf("body should be read completely")
+		}
+	}
+}
+
+func newBodyLimiter(t *testing.T, yamlSpec string) *BodyLimiter {
+	rawSpec := make(map[string]interface{})
+	yamltool.Unmarshal([]byte(yamlSpec), &rawSpec)
+
+	spec, err := httppipeline.NewFilterSpec(rawSpec, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bl := &BodyLimiter{}
+	bl.Init(spec)
+	return bl
+}
+
+type testContext struct {
+	*contexttest.MockedHTTPContext
+
+	statusCode   int
+	requestBody  io.Reader
+	responseBody io.Reader
+}
+
+func newTestContext(body string, contentLength int64, next func(ctx *testContext)) *testContext {
+	ctx := &testContext{
+		MockedHTTPContext: &contexttest.MockedHTTPContext{},
+		statusCode:        http.StatusOK,
+		requestBody:       strings.NewReader(body),
+	}
+
+	stdr, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1/upload", nil)
+	stdr.ContentLength = contentLength
+	ctx.MockedRequest.MockedStd = func() *http.Request { return stdr }
+	ctx.MockedRequest.MockedBody = func() io.Reader { return ctx.requestBody }
+	ctx.MockedRequest.MockedSetBody = func(body io.Reader) { ctx.requestBody = body }
+
+	header := httpheader.New(http.Header{})
+	ctx.MockedResponse.MockedHeader = func() *httpheader.HTTPHeader { return header }
+	ctx.MockedResponse.MockedStatusCode = func() int { return ctx.statusCode }
+	ctx.MockedResponse.MockedSetStatusCode = func(code int) { ctx.statusCode = code }
+	ctx.MockedResponse.MockedBody = func() io.Reader { return ctx.responseBody }
+	ctx.MockedResponse.MockedSetBody = func(body io.Reader) { ctx.responseBody = body }
+
+	ctx.MockedCallNextHandler = func(lastResult string) string {
+		if lastResult == "" {
+			next(ctx)
+		}
+		return lastResult
+	}
+
+	return ctx
+}
+
+func TestBodyLimiterRequest(t *testing.T) {
+	bl := newBodyLimiter(t, `
+kind: BodyLimiter
+name: bodyLimiter
+maxRequestBodyBytes: 4
+`)
+
+	proxy := func(ctx *testContext) {
+		_, err := ioutil.ReadAll(ctx.requestBody)
+		if err != nil {
+			ctx.statusCode = http.StatusServiceUnavailable
+		}
+	}
+
+	tests := []struct {
+		body          string
+		contentLength int64
+		wantResult    string
+		wantCode      int
+	}{
+		{body: "abcd", contentLength: 4, wantCode: http.StatusOK},
+		{body: "abcde", contentLength: 5, wantResult: resultRequestTooLarge, wantCode: http.StatusRequestEntityTooLarge},
+		{body: "abcd", contentLength: -1, wantCode: http.StatusOK},
+		{body: "abcde", contentLength: -1, wantCode: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		ctx := newTestContext(tt.body, tt.contentLength, proxy)
+		result := bl.Handle(ctx)
+		if result != tt.wantResult {
+			t.Errorf("body %q with content length %d: want result %q, got %q",
+				tt.body, tt.contentLength, tt.wantResult, result)
+		}
+		if ctx.statusCode != tt.wantCode {
+			t.Errorf("body %q with content length %d: want status code %d, got %d",
+				tt.body, tt.contentLength, tt.wantCode, ctx.statusCode)
+		}
+	}
+}
+
+func TestBodyLimiterResponse(t *testing.T) {
+	bl := newBodyLimiter(t, `
+kind: BodyLimiter
+name: bodyLimiter
+maxResponseBodyBytes: 4
+`)
+
+	respond := func(body string, contentLength string) func(ctx *testContext) {
+		return func(ctx *testContext) {
+			if contentLength != "" {
+				ctx.Response().Header().Set("Content-Length", contentLength)
+			}
+			ctx.responseBody = bytes.NewBufferString(body)
+		}
+	}
+
+	ctx := newTestContext("", 0, respond("abcd", "4"))
+	if result := bl.Handle(ctx); result != "" || ctx.statusCode != http.StatusOK {
+		t.Errorf("response at limit should pass, got result %q code %d", result, ctx.statusCode)
+	}
+	if data, err := ioutil.ReadAll(ctx.responseBody); err != nil || string(data) != "abcd" {
+		t.Errorf("response at limit should be read completely: %v", err)
+	}
+
+	ctx = newTestContext("", 0, respond("abcde", "5"))
+	if result := bl.Handle(ctx); result != resultResponseTooLarge || ctx.statusCode != http.StatusBadGateway {
+		t.Errorf("response over limit should be rejected, got result %q code %d", result, ctx.statusCode)
+	}
+	if ctx.responseBody != nil {
+		t.Errorf("rejected response body should be discarded")
+	}
+
+	ctx = newTestContext("", 0, respond("abcde", ""))
+	if result := bl.Handle(ctx); result != "" {
+		t.Errorf("streaming response should pass the filter, got result %q", result)
+	}
+	if data, err := ioutil.ReadAll(ctx.responseBody); err != errBodyTooLarge || string(data) != "abcd" {
+		t.Errorf("streaming response over limit should be truncated, got %q %v", data, err)
+	}
+}
@@ -57,6 +57,7 @@ type (
 		SlowCallDurationThreshold        string `yaml:"slowCallDurationThreshold" jsonschema:"omitempty,format=duration"`
 		MaxWaitDurationInHalfOpen        string `yaml:"maxWaitDurationInHalfOpenState" jsonschema:"omitempty,format=duration"`
 		WaitDurationInOpen               string `yaml:"waitDurationInOpenState" jsonschema:"omitempty,format=duration"`
+		MaxWaitDurationInOpen            string `yaml:"maxWaitDurationInOpenState" jsonschema:"omitempty,format=duration"`
 		FailureStatusCodes               []int  `yaml:"failureStatusCodes" jsonschema:"omitempty,uniqueItems=true,format=httpcode-array"`
 	}
 
@@ -83,6 +84,9 @@ type (
 	// Status is the status of CircuitBreaker.
 	Status struct {
 		Health string `yaml:"health"`
+
+		// States are the states of circuit breakers keyed by URL rule ID.
+		States map[string]string `yaml:"states"`
 	}
 )
 
@@ -157,6 +161,10 @@ func (url *URLRule) buildPolicy() *libcb.Policy {
 		policy.WaitDurationInOpen = time.Minute
 	}
 
+	if d := url.policy.MaxWaitDurationInOpen; d != "" {
+		policy.MaxWaitDurationInOpen, _ = time.ParseDuration(d)
+	}
+
 	return &policy
 }
 
@@ -334,7 +342,17 @@ func (cb *CircuitBreaker) Handle(ctx context.HTTPContext) string {
 
 // Status returns Status generated by Runtime.
 func (cb *CircuitBreaker) Status() interface{} {
-	return nil
+	s := &Status{
+		States: make(map[string]string),
+	}
+
+	for _, u := range cb.spec.URLs {
+		if u.cb != nil {
+			s.States[u.ID()] = u.cb.State().String()
+		}
+	}
+
+	return s
 }
 
 // Close closes CircuitBreaker.
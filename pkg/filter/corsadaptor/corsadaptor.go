@@ -18,6 +18,7 @@
 package corsadaptor
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/rs/cors"
@@ -55,9 +56,27 @@ type (
 		AllowedHeaders   []string `yaml:"allowedHeaders" jsonschema:"omitempty"`
 		AllowCredentials bool     `yaml:"allowCredentials" jsonschema:"omitempty"`
 		ExposedHeaders   []string `yaml:"exposedHeaders" jsonschema:"omitempty"`
+		// MaxAge is the seconds the preflight results can be cached.
+		MaxAge int `yaml:"maxAge" jsonschema:"omitempty,minimum=0"`
 	}
 )
 
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	if !s.AllowCredentials {
+		return nil
+	}
+
+	// NOTE: Browsers reject the credentialed responses allowing any origin.
+	for _, origin := range s.AllowedOrigins {
+		if origin == "*" {
+			return fmt.Errorf("wildcard allowed origin can't be used with allowCredentials")
+		}
+	}
+
+	return nil
+}
+
 // Kind returns the kind of CORSAdaptor.
 func (a *CORSAdaptor) Kind() string {
 	return Kind
@@ -98,6 +117,7 @@ func (a *CORSAdaptor) reload() {
 		AllowedHeaders:   a.spec.AllowedHeaders,
 		AllowCredentials: a.spec.AllowCredentials,
 		ExposedHeaders:   a.spec.ExposedHeaders,
+		MaxAge:           a.spec.MaxAge,
 	})
 }
 
@@ -116,6 +136,11 @@ func (a *CORSAdaptor) handle(ctx context.HTTPContext) string {
 		a.cors.HandlerFunc(w.Std(), r.Std())
 		return resultPreflighted
 	}
+
+	// NOTE: The actual cross-origin requests need the CORS headers too.
+	if r.Header().Get("Origin") != "" {
+		a.cors.HandlerFunc(w.Std(), r.Std())
+	}
 	return ""
 }
 
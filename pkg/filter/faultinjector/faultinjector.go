@@ -0,0 +1,247 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package faultinjector
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/hashtool"
+)
+
+const (
+	// Kind is the kind of FaultInjector.
+	Kind = "FaultInjector"
+
+	// DefaultHashHeader is the default header deciding whether a request
+	// is injected with faults.
+	DefaultHashHeader = "X-Request-Id"
+
+	// DistributionUniform distributes the jitter uniformly in
+	// [-jitter, jitter].
+	DistributionUniform = "uniform"
+	// DistributionNormal distributes the jitter normally with the
+	// jitter as the standard deviation.
+	DistributionNormal = "normal"
+
+	// maxDelay is the upper bound of all delays, so a misconfiguration
+	// can't hang the requests.
+	maxDelay = time.Minute
+
+	resultAborted = "aborted"
+)
+
+var results = []string{resultAborted}
+
+func init() {
+	httppipeline.Register(&FaultInjector{})
+}
+
+type (
+	// FaultInjector is the filter to inject faults into a percentage of
+	// requests, the others are passed through to the following filters.
+	FaultInjector struct {
+		filterSpec *httppipeline.FilterSpec
+		spec       *Spec
+		delay      time.Duration
+		jitter     time.Duration
+		maxDelay   time.Duration
+	}
+
+	// Spec is the spec of FaultInjector.
+	Spec struct {
+		Abort *Abort `yaml:"abort,omitempty" jsonschema:"omitempty"`
+		Delay *Delay `yaml:"delay,omitempty" jsonschema:"omitempty"`
+		// HashHeader decides whether a request is injected by the hash of its
+		// value, so the same value always gets the same faults. The requests
+		// without it are decided randomly. Default is X-Request-Id.
+		HashHeader string `yaml:"hashHeader,omitempty" jsonschema:"omitempty"`
+	}
+
+	// Abort responds the status code without calling the following filters.
+	Abort struct {
+		Percentage int `yaml:"percentage" jsonschema:"required,minimum=0,maximum=100"`
+		StatusCode int `yaml:"statusCode" jsonschema:"required,format=httpcode"`
+	}
+
+	// Delay delays the requests before calling the following filters,
+	// the delay is the duration plus a random jitter.
+	Delay struct {
+		Percentage int    `yaml:"percentage" jsonschema:"required,minimum=0,maximum=100"`
+		Duration   string `yaml:"duration" jsonschema:"required,format=duration"`
+		Jitter     string `yaml:"jitter,omitempty" jsonschema:"omitempty,format=duration"`
+		// Distribution is the distribution of the jitter, default is uniform.
+		Distribution string `yaml:"distribution,omitempty" jsonschema:"omitempty,enum=,enum=uniform,enum=normal"`
+		// MaxDuration is the upper bound of the delay, default and
+		// at most is 1m.
+		MaxDuration string `yaml:"maxDuration,omitempty" jsonschema:"omitempty,format=duration"`
+	}
+)
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	if spec.Abort == nil && spec.Delay == nil {
+		return fmt.Errorf("neither abort nor delay is specified")
+	}
+
+	if spec.Abort != nil && (spec.Abort.Percentage < 0 || spec.Abort.Percentage > 100) {
+		return fmt.Errorf("abort percentage %d is out of [0, 100]", spec.Abort.Percentage)
+	}
+
+	if spec.Delay != nil {
+		if spec.Delay.Percentage < 0 || spec.Delay.Percentage > 100 {
+			return fmt.Errorf("delay percentage %d is out of [0, 100]", spec.Delay.Percentage)
+		}
+		if d, _ := time.ParseDuration(spec.Delay.Duration); d <= 0 {
+			return fmt.Errorf("delay duration %s is not positive", spec.Delay.Duration)
+		}
+		if j, _ := time.ParseDuration(spec.Delay.Jitter); j < 0 {
+			return fmt.Errorf("delay jitter %s is negative", spec.Delay.Jitter)
+		}
+		if spec.Delay.MaxDuration != "" {
+			m, _ := time.ParseDuration(spec.Delay.MaxDuration)
+			if m <= 0 || m > maxDelay {
+				return fmt.Errorf("delay max duration %s is out of (0, %s]", spec.Delay.MaxDuration, maxDelay)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Kind returns the kind of FaultInjector.
+func (fi *FaultInjector) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of FaultInjector.
+func (fi *FaultInjector) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Description returns the description of FaultInjector.
+func (fi *FaultInjector) Description() string {
+	return "FaultInjector injects aborts and delays into requests."
+}
+
+// Results returns the results of FaultInjector.
+func (fi *FaultInjector) Results() []string {
+	return results
+}
+
+// Init initializes FaultInjector.
+func (fi *FaultInjector) Init(filterSpec *httppipeline.FilterSpec) {
+	fi.filterSpec, fi.spec = filterSpec, filterSpec.FilterSpec().(*Spec)
+	if d := fi.spec.Delay; d != nil {
+		fi.delay, _ = time.ParseDuration(d.Duration)
+		fi.jitter, _ = time.ParseDuration(d.Jitter)
+		fi.maxDelay = maxDelay
+		if m, err := time.ParseDuration(d.MaxDuration); err == nil && m > 0 && m < maxDelay {
+			fi.maxDelay = m
+		}
+	}
+}
+
+// Inherit inherits previous generation of FaultInjector.
+func (fi *FaultInjector) Inherit(filterSpec *httppipeline.FilterSpec, previousGeneration httppipeline.Filter) {
+	previousGeneration.Close()
+	fi.Init(filterSpec)
+}
+
+// Handle injects faults into the request.
+func (fi *FaultInjector) Handle(ctx context.HTTPContext) string {
+	result := fi.handle(ctx)
+	if result != "" {
+		return result
+	}
+	return ctx.CallNextHandler(result)
+}
+
+func (fi *FaultInjector) handle(ctx context.HTTPContext) string {
+	bucket := fi.bucket(ctx)
+
+	// NOTE: The delay is injected before the abort, so a request could get
+	// both, like a slow failure.
+	if d := fi.spec.Delay; d != nil && bucket < d.Percentage {
+		delay := fi.nextDelay()
+		ctx.AddTag(fmt.Sprintf("faultInjector: delayed %s", delay))
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+
+	if a := fi.spec.Abort; a != nil && bucket < a.Percentage {
+		ctx.AddTag(fmt.Sprintf("faultInjector: aborted with %d", a.StatusCode))
+		ctx.Response().SetStatusCode(a.StatusCode)
+		return resultAborted
+	}
+
+	return ""
+}
+
+// nextDelay returns the duration plus a random jitter, which is
+// in [0, maxDelay].
+func (fi *FaultInjector) nextDelay() time.Duration {
+	delay := fi.delay
+	if fi.jitter > 0 {
+		var jitter float64
+		switch fi.spec.Delay.Distribution {
+		case DistributionNormal:
+			jitter = rand.NormFloat64() * float64(fi.jitter)
+		default:
+			jitter = (rand.Float64()*2 - 1) * float64(fi.jitter)
+		}
+		delay += time.Duration(jitter)
+	}
+
+	if delay < 0 {
+		return 0
+	}
+	if delay > fi.maxDelay {
+		return fi.maxDelay
+	}
+	return delay
+}
+
+// bucket returns the bucket of the request in [0, 100).
+func (fi *FaultInjector) bucket(ctx context.HTTPContext) int {
+	key := fi.spec.HashHeader
+	if key == "" {
+		key = DefaultHashHeader
+	}
+
+	value := ctx.Request().Header().Get(key)
+	if value == "" {
+		return rand.Intn(100)
+	}
+	return int(hashtool.Hash32(value) % 100)
+}
+
+// Status returns status.
+func (fi *FaultInjector) Status() interface{} {
+	return nil
+}
+
+// Close closes FaultInjector.
+func (fi *FaultInjector) Close() {}
@@ -0,0 +1,187 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package faultinjector
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/yamltool"
+)
+
+func newFaultInjector(t *testing.T, yamlSpec string) *FaultInjector {
+	rawSpec := make(map[string]interface{})
+	yamltool.Unmarshal([]byte(yamlSpec), &rawSpec)
+
+	spec, err := httppipeline.NewFilterSpec(rawSpec, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fi := &FaultInjector{}
+	fi.Init(spec)
+	return fi
+}
+
+func newTestContext(requestID string) (*contexttest.MockedHTTPContext, *int, *bool) {
+	ctx := &contexttest.MockedHTTPContext{}
+	h := httpheader.New(http.Header{DefaultHashHeader: []string{requestID}})
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader { return h }
+
+	statusCode, nextCalled := 0, false
+	ctx.MockedResponse.MockedSetStatusCode = func(code int) {
+		statusCode = code
+	}
+	ctx.MockedCallNextHandler = func(lastResult string) string {
+		nextCalled = true
+		return lastResult
+	}
+	return ctx, &statusCode, &nextCalled
+}
+
+func TestFaultInjectorAbort(t *testing.T) {
+	fi := newFaultInjector(t, `
+kind: FaultInjector
+name: fault-injector
+abort:
+  percentage: 30
+  statusCode: 503
+`)
+
+	aborted := 0
+	for i := 0; i < 1000; i++ {
+		requestID := fmt.Sprintf("request-%d", i)
+		ctx, statusCode, nextCalled := newTestContext(requestID)
+		result := fi.Handle(ctx)
+
+		if result == resultAborted {
+			aborted++
+			if *statusCode != http.StatusServiceUnavailable || *nextCalled {
+				t.Fatalf("aborted request should get 503 without calling next, got %d", *statusCode)
+			}
+		} else if !*nextCalled {
+			t.Fatalf("request not aborted should be passed through")
+		}
+
+		// NOTE: The same request ID always gets the same result.
+		ctx, _, _ = newTestContext(requestID)
+		if fi.Handle(ctx) != result {
+			t.Fatalf("result of %s should be deterministic", requestID)
+		}
+	}
+
+	if aborted < 250 || aborted > 350 {
+		t.Errorf("want about 30%% requests aborted, got %d of 1000", aborted)
+	}
+}
+
+func TestFaultInjectorDelay(t *testing.T) {
+	fi := newFaultInjector(t, `
+kind: FaultInjector
+name: fault-injector
+delay:
+  percentage: 100
+  duration: 20ms
+`)
+
+	ctx, _, nextCalled := newTestContext("request-1")
+	start := time.Now()
+	if result := fi.Handle(ctx); result != "" || !*nextCalled {
+		t.Errorf("delayed request should be passed through, got result %q", result)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("request should be delayed 20ms, got %v", elapsed)
+	}
+}
+
+func TestFaultInjectorDelayJitter(t *testing.T) {
+	fi := newFaultInjector(t, `
+kind: FaultInjector
+name: fault-injector
+delay:
+  percentage: 100
+  duration: 100ms
+  jitter: 20ms
+`)
+	for i := 0; i < 1000; i++ {
+		if d := fi.nextDelay(); d < 80*time.Millisecond || d > 120*time.Millisecond {
+			t.Fatalf("uniform delay should be in [80ms, 120ms], got %v", d)
+		}
+	}
+
+	fi = newFaultInjector(t, `
+kind: FaultInjector
+name: fault-injector
+delay:
+  percentage: 100
+  duration: 100ms
+  jitter: 50ms
+  distribution: normal
+  maxDuration: 150ms
+`)
+	sum := time.Duration(0)
+	for i := 0; i < 1000; i++ {
+		d := fi.nextDelay()
+		if d < 0 || d > 150*time.Millisecond {
+			t.Fatalf("normal delay should be in [0, 150ms], got %v", d)
+		}
+		sum += d
+	}
+	if mean := sum / 1000; mean < 80*time.Millisecond || mean > 110*time.Millisecond {
+		t.Errorf("mean of normal delay should be close to 100ms, got %v", mean)
+	}
+
+	fi = newFaultInjector(t, `
+kind: FaultInjector
+name: fault-injector
+delay:
+  percentage: 100
+  duration: 1h
+`)
+	if d := fi.nextDelay(); d != maxDelay {
+		t.Errorf("delay should be bounded by %v, got %v", maxDelay, d)
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	tests := []struct {
+		spec  Spec
+		valid bool
+	}{
+		{Spec{}, false},
+		{Spec{Abort: &Abort{Percentage: 100, StatusCode: 500}}, true},
+		{Spec{Abort: &Abort{Percentage: 101, StatusCode: 500}}, false},
+		{Spec{Delay: &Delay{Percentage: -1, Duration: "1s"}}, false},
+		{Spec{Delay: &Delay{Percentage: 0, Duration: "0s"}}, false},
+		{Spec{Delay: &Delay{Percentage: 50, Duration: "1s"}}, true},
+		{Spec{Delay: &Delay{Percentage: 50, Duration: "1s", Jitter: "-1s"}}, false},
+		{Spec{Delay: &Delay{Percentage: 50, Duration: "1s", Jitter: "100ms", MaxDuration: "2s"}}, true},
+		{Spec{Delay: &Delay{Percentage: 50, Duration: "1s", MaxDuration: "2m"}}, false},
+	}
+
+	for i, tc := range tests {
+		if err := tc.spec.Validate(); (err == nil) != tc.valid {
+			t.Errorf("case %d: want valid %v, got err %v", i, tc.valid, err)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package headerpropagator
+
+import (
+	"net/url"
+	"strings"
+)
+
+const (
+	// BaggageHeader is the W3C baggage header.
+	BaggageHeader = "Baggage"
+
+	// DefaultBaggageMaxKeys is the default max number of baggage entries.
+	DefaultBaggageMaxKeys = 16
+	// DefaultBaggageMaxBytes is the default max bytes of the baggage header.
+	DefaultBaggageMaxBytes = 1024
+
+	baggageTagPrefix = "baggage."
+)
+
+type (
+	// BaggageSpec is the spec of the baggage propagated, only the entries
+	// with the keys are propagated, and they're bounded by MaxKeys and
+	// MaxBytes, the ones beyond the bounds are dropped.
+	BaggageSpec struct {
+		Keys []string `yaml:"keys" jsonschema:"required,minItems=1,uniqueItems=true"`
+		// MaxKeys is the max number of entries, default is 16.
+		MaxKeys int `yaml:"maxKeys,omitempty" jsonschema:"omitempty,minimum=0"`
+		// MaxBytes is the max bytes of the entries, default is 1024.
+		MaxBytes int `yaml:"maxBytes,omitempty" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// baggageEntry is an entry of the baggage, member is the list member
+	// of the header with the properties.
+	baggageEntry struct {
+		key    string
+		value  string
+		member string
+	}
+)
+
+func (spec *BaggageSpec) maxKeys() int {
+	if spec.MaxKeys <= 0 {
+		return DefaultBaggageMaxKeys
+	}
+	return spec.MaxKeys
+}
+
+func (spec *BaggageSpec) maxBytes() int {
+	if spec.MaxBytes <= 0 {
+		return DefaultBaggageMaxBytes
+	}
+	return spec.MaxBytes
+}
+
+// parseBaggage parses the W3C baggage header, the malformed entries are
+// skipped.
+func parseBaggage(header string) []*baggageEntry {
+	entries := []*baggageEntry{}
+	for _, member := range strings.Split(header, ",") {
+		member = strings.TrimSpace(member)
+		kv := member
+		if i := strings.IndexByte(kv, ';'); i >= 0 {
+			kv = kv[:i]
+		}
+		i := strings.IndexByte(kv, '=')
+		if i <= 0 {
+			continue
+		}
+
+		key := strings.TrimSpace(kv[:i])
+		value, err := url.PathUnescape(strings.TrimSpace(kv[i+1:]))
+		if key == "" || err != nil {
+			continue
+		}
+		entries = append(entries, &baggageEntry{key: key, value: value, member: member})
+	}
+	return entries
+}
+
+// selectBaggage returns the entries of the keys in the spec within the
+// bounds, the entries of existing keys are skipped, and usedBytes are the
+// bytes taken by them.
+func (spec *BaggageSpec) selectBaggage(entries []*baggageEntry, existing map[string]bool, usedBytes int) []*baggageEntry {
+	allowed := map[string]bool{}
+	for _, key := range spec.Keys {
+		allowed[key] = true
+	}
+
+	selected := []*baggageEntry{}
+	keys, bytes := len(existing), usedBytes
+	for _, e := range entries {
+		if !allowed[e.key] || existing[e.key] {
+			continue
+		}
+
+		// NOTE: The comma joining the entries counts too.
+		size := len(e.member)
+		if bytes > 0 {
+			size++
+		}
+		if keys+1 > spec.maxKeys() || bytes+size > spec.maxBytes() {
+			break
+		}
+
+		keys, bytes = keys+1, bytes+size
+		selected = append(selected, e)
+	}
+	return selected
+}
+
+func joinBaggage(entries []*baggageEntry) string {
+	members := make([]string, 0, len(entries))
+	for _, e := range entries {
+		members = append(members, e.member)
+	}
+	return strings.Join(members, ",")
+}
@@ -0,0 +1,333 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package headerpropagator
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+const (
+	// Kind is the kind of HeaderPropagator.
+	Kind = "HeaderPropagator"
+
+	// ModeRecord records the headers of incoming requests.
+	ModeRecord = "record"
+	// ModeApply applies the recorded headers to outgoing requests.
+	ModeApply = "apply"
+
+	// DefaultCorrelationHeader is the default correlation header,
+	// which is the trace ID propagated by the applications.
+	DefaultCorrelationHeader = "X-B3-TraceId"
+
+	defaultTTL = time.Minute
+
+	resultDeadlineExceeded = "deadlineExceeded"
+)
+
+var (
+	results = []string{resultDeadlineExceeded}
+
+	stores      = map[string]*store{}
+	storesMutex sync.Mutex
+)
+
+func init() {
+	httppipeline.Register(&HeaderPropagator{})
+}
+
+type (
+	// HeaderPropagator is the filter to propagate headers across the
+	// application, from the requests it receives to the requests it sends.
+	// The application must propagate the correlation header, the headers of
+	// the incoming request are recorded by it, then they are applied to the
+	// outgoing requests carrying the same correlation header.
+	HeaderPropagator struct {
+		filterSpec *httppipeline.FilterSpec
+		spec       *Spec
+		store      *store
+	}
+
+	// Spec is the spec of HeaderPropagator.
+	Spec struct {
+		Mode string `yaml:"mode" jsonschema:"required,enum=record,enum=apply"`
+		// Store is the name of the records shared by the filters in both modes.
+		Store   string   `yaml:"store" jsonschema:"required"`
+		Headers []string `yaml:"headers" jsonschema:"omitempty,uniqueItems=true"`
+		// CorrelationHeader is X-B3-TraceId by default, the trace ID of
+		// traceparent is used if it's traceparent.
+		CorrelationHeader string `yaml:"correlationHeader" jsonschema:"omitempty"`
+		// TTL is how long the records are kept, default is 1m.
+		TTL string `yaml:"ttl" jsonschema:"omitempty,format=duration"`
+
+		// DeadlineHeader carries the remaining time budget of the request,
+		// e.g. 800ms. The deadline of the incoming request is recorded, and
+		// the time left is set to the outgoing requests.
+		DeadlineHeader string `yaml:"deadlineHeader,omitempty" jsonschema:"omitempty"`
+		// DeadlineFloor is the minimum time budget of an outgoing request,
+		// it gets 504 without being sent if less time is left.
+		DeadlineFloor string `yaml:"deadlineFloor,omitempty" jsonschema:"omitempty,format=duration"`
+
+		// Baggage is the W3C baggage propagated, the entries of the incoming
+		// request are recorded and tagged to the span, then they're merged
+		// into the baggage of the outgoing requests.
+		Baggage *BaggageSpec `yaml:"baggage,omitempty" jsonschema:"omitempty"`
+	}
+
+	store struct {
+		mutex     sync.Mutex
+		records   map[string]*record
+		lastSweep time.Time
+	}
+
+	record struct {
+		headers  map[string]string
+		baggage  []*baggageEntry
+		deadline time.Time
+		expireAt time.Time
+	}
+)
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	if len(spec.Headers) == 0 && spec.DeadlineHeader == "" && spec.Baggage == nil {
+		return fmt.Errorf("none of headers, deadlineHeader and baggage is specified")
+	}
+
+	return nil
+}
+
+// Kind returns the kind of HeaderPropagator.
+func (hp *HeaderPropagator) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of HeaderPropagator.
+func (hp *HeaderPropagator) DefaultSpec() interface{} {
+	return &Spec{
+		CorrelationHeader: DefaultCorrelationHeader,
+	}
+}
+
+// Description returns the description of HeaderPropagator.
+func (hp *HeaderPropagator) Description() string {
+	return "HeaderPropagator propagates headers from incoming requests to outgoing requests."
+}
+
+// Results returns the results of HeaderPropagator.
+func (hp *HeaderPropagator) Results() []string {
+	return results
+}
+
+// Init initializes HeaderPropagator.
+func (hp *HeaderPropagator) Init(filterSpec *httppipeline.FilterSpec) {
+	hp.filterSpec, hp.spec = filterSpec, filterSpec.FilterSpec().(*Spec)
+	hp.store = getStore(hp.spec.Store)
+}
+
+// Inherit inherits previous generation of HeaderPropagator.
+func (hp *HeaderPropagator) Inherit(filterSpec *httppipeline.FilterSpec, previousGeneration httppipeline.Filter) {
+	previousGeneration.Close()
+	hp.Init(filterSpec)
+}
+
+// Handle records or applies the headers.
+func (hp *HeaderPropagator) Handle(ctx context.HTTPContext) string {
+	result := hp.handle(ctx)
+	if result == resultDeadlineExceeded {
+		ctx.AddTag("headerPropagator: deadline exceeded")
+		ctx.Response().SetStatusCode(http.StatusGatewayTimeout)
+		return result
+	}
+	return ctx.CallNextHandler(result)
+}
+
+func (hp *HeaderPropagator) handle(ctx context.HTTPContext) string {
+	header := ctx.Request().Header()
+
+	id := correlationID(hp.spec.CorrelationHeader, header.Get(hp.spec.CorrelationHeader))
+	if id == "" {
+		return ""
+	}
+
+	switch hp.spec.Mode {
+	case ModeRecord:
+		headers := map[string]string{}
+		for _, key := range hp.spec.Headers {
+			if value := header.Get(key); value != "" {
+				headers[key] = value
+			}
+		}
+		var deadline time.Time
+		if hp.spec.DeadlineHeader != "" {
+			// NOTE: The budget is relative, so the deadline is in local time,
+			// clocks of the hops need not be synchronized.
+			budget, err := time.ParseDuration(header.Get(hp.spec.DeadlineHeader))
+			if err == nil && budget > 0 {
+				deadline = time.Now().Add(budget)
+			}
+		}
+		var baggage []*baggageEntry
+		if hp.spec.Baggage != nil {
+			baggage = hp.spec.Baggage.selectBaggage(parseBaggage(header.Get(BaggageHeader)), nil, 0)
+			for _, e := range baggage {
+				ctx.Span().SetTag(baggageTagPrefix+e.key, e.value)
+			}
+		}
+		if len(headers) != 0 || !deadline.IsZero() || len(baggage) != 0 {
+			hp.store.put(id, &record{headers: headers, baggage: baggage, deadline: deadline}, hp.ttl())
+		}
+	case ModeApply:
+		r := hp.store.get(id)
+		if r == nil {
+			return ""
+		}
+
+		// NOTE: The headers set by the application take precedence.
+		for key, value := range r.headers {
+			if header.Get(key) == "" {
+				header.Set(key, value)
+			}
+		}
+
+		if hp.spec.Baggage != nil && len(r.baggage) != 0 {
+			hp.applyBaggage(header, r.baggage)
+		}
+
+		if hp.spec.DeadlineHeader != "" && !r.deadline.IsZero() && header.Get(hp.spec.DeadlineHeader) == "" {
+			remaining := time.Until(r.deadline)
+			if remaining <= 0 || remaining < hp.deadlineFloor() {
+				return resultDeadlineExceeded
+			}
+			header.Set(hp.spec.DeadlineHeader, fmt.Sprintf("%dms", remaining.Milliseconds()))
+		}
+	}
+
+	return ""
+}
+
+// applyBaggage merges the recorded baggage into the baggage of the outgoing
+// request, the entries set by the application take precedence.
+func (hp *HeaderPropagator) applyBaggage(header *httpheader.HTTPHeader, recorded []*baggageEntry) {
+	current := header.Get(BaggageHeader)
+	existing := map[string]bool{}
+	for _, e := range parseBaggage(current) {
+		existing[e.key] = true
+	}
+
+	current = strings.TrimSpace(current)
+	added := hp.spec.Baggage.selectBaggage(recorded, existing, len(current))
+	if len(added) == 0 {
+		return
+	}
+
+	if current == "" {
+		header.Set(BaggageHeader, joinBaggage(added))
+		return
+	}
+	header.Set(BaggageHeader, current+","+joinBaggage(added))
+}
+
+func (hp *HeaderPropagator) deadlineFloor() time.Duration {
+	floor, _ := time.ParseDuration(hp.spec.DeadlineFloor)
+	return floor
+}
+
+func (hp *HeaderPropagator) ttl() time.Duration {
+	ttl, err := time.ParseDuration(hp.spec.TTL)
+	if err != nil || ttl <= 0 {
+		return defaultTTL
+	}
+	return ttl
+}
+
+// Status returns status.
+func (hp *HeaderPropagator) Status() interface{} {
+	return nil
+}
+
+// Close closes HeaderPropagator.
+func (hp *HeaderPropagator) Close() {}
+
+// correlationID returns the ID correlating the incoming and outgoing requests.
+func correlationID(key, value string) string {
+	if key == "" {
+		key = DefaultCorrelationHeader
+	}
+
+	// NOTE: The parent ID of traceparent changes at every hop,
+	// only the trace ID is the same: version-traceid-parentid-flags.
+	if http.CanonicalHeaderKey(key) == "Traceparent" {
+		fields := strings.Split(value, "-")
+		if len(fields) != 4 {
+			return ""
+		}
+		return fields[1]
+	}
+
+	return value
+}
+
+func getStore(name string) *store {
+	storesMutex.Lock()
+	defer storesMutex.Unlock()
+
+	s, exists := stores[name]
+	if !exists {
+		s = &store{records: map[string]*record{}}
+		stores[name] = s
+	}
+	return s
+}
+
+func (s *store) put(id string, r *record, ttl time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	r.expireAt = now.Add(ttl)
+	s.records[id] = r
+
+	if now.Sub(s.lastSweep) < ttl {
+		return
+	}
+	s.lastSweep = now
+	for id, r := range s.records {
+		if now.After(r.expireAt) {
+			delete(s.records, id)
+		}
+	}
+}
+
+func (s *store) get(id string) *record {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	r, exists := s.records[id]
+	if !exists || time.Now().After(r.expireAt) {
+		return nil
+	}
+	return r
+}
@@ -0,0 +1,241 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package headerpropagator
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+
+	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/yamltool"
+)
+
+func newHeaderPropagator(t *testing.T, yamlSpec string) *HeaderPropagator {
+	rawSpec := make(map[string]interface{})
+	yamltool.Unmarshal([]byte(yamlSpec), &rawSpec)
+
+	spec, err := httppipeline.NewFilterSpec(rawSpec, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	hp := &HeaderPropagator{}
+	hp.Init(spec)
+	return hp
+}
+
+func newTestContext(header http.Header) *contexttest.MockedHTTPContext {
+	ctx := &contexttest.MockedHTTPContext{}
+	h := httpheader.New(header)
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader { return h }
+	return ctx
+}
+
+func TestHeaderPropagator(t *testing.T) {
+	recorder := newHeaderPropagator(t, `
+kind: HeaderPropagator
+name: recorder
+mode: record
+store: order
+headers: [X-Canary, X-Location]
+`)
+	applier := newHeaderPropagator(t, `
+kind: HeaderPropagator
+name: applier
+mode: apply
+store: order
+headers: [X-Canary, X-Location]
+`)
+
+	incoming := http.Header{}
+	incoming.Set(DefaultCorrelationHeader, "trace-1")
+	incoming.Set("X-Canary", "v2")
+	incoming.Set("X-Location", "beijing")
+	incoming.Set("X-Other", "other")
+	recorder.Handle(newTestContext(incoming))
+
+	outgoing := http.Header{}
+	outgoing.Set(DefaultCorrelationHeader, "trace-1")
+	outgoing.Set("X-Location", "shanghai")
+	applier.Handle(newTestContext(outgoing))
+
+	if v := outgoing.Get("X-Canary"); v != "v2" {
+		t.Errorf("want X-Canary propagated, got %q", v)
+	}
+	if v := outgoing.Get("X-Location"); v != "shanghai" {
+		t.Errorf("the header set by the application should be kept, got %q", v)
+	}
+	if v := outgoing.Get("X-Other"); v != "" {
+		t.Errorf("unlisted header should not be propagated, got %q", v)
+	}
+
+	unrelated := http.Header{}
+	unrelated.Set(DefaultCorrelationHeader, "trace-2")
+	applier.Handle(newTestContext(unrelated))
+	if v := unrelated.Get("X-Canary"); v != "" {
+		t.Errorf("request of another trace should not be changed, got %q", v)
+	}
+}
+
+func TestHeaderPropagatorDeadline(t *testing.T) {
+	recorder := newHeaderPropagator(t, `
+kind: HeaderPropagator
+name: recorder
+mode: record
+store: order-deadline
+deadlineHeader: X-Mesh-Deadline
+`)
+	applier := newHeaderPropagator(t, `
+kind: HeaderPropagator
+name: applier
+mode: apply
+store: order-deadline
+deadlineHeader: X-Mesh-Deadline
+deadlineFloor: 50ms
+`)
+
+	incoming := http.Header{}
+	incoming.Set(DefaultCorrelationHeader, "trace-1")
+	incoming.Set("X-Mesh-Deadline", "1s")
+	recorder.Handle(newTestContext(incoming))
+
+	incoming = http.Header{}
+	incoming.Set(DefaultCorrelationHeader, "trace-2")
+	incoming.Set("X-Mesh-Deadline", "60ms")
+	recorder.Handle(newTestContext(incoming))
+
+	outgoing := http.Header{}
+	outgoing.Set(DefaultCorrelationHeader, "trace-1")
+	if result := applier.Handle(newTestContext(outgoing)); result != "" {
+		t.Errorf("request in the budget should be sent, got result %q", result)
+	}
+	v := outgoing.Get("X-Mesh-Deadline")
+	if budget, err := time.ParseDuration(v); err != nil || budget <= 0 || budget > time.Second ||
+		!strings.HasSuffix(v, "ms") {
+		t.Errorf("want the remaining budget in milliseconds, got %q", v)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	outgoing = http.Header{}
+	outgoing.Set(DefaultCorrelationHeader, "trace-2")
+	nextCalled := false
+	ctx := newTestContext(outgoing)
+	ctx.MockedCallNextHandler = func(lastResult string) string {
+		nextCalled = true
+		return lastResult
+	}
+	if result := applier.Handle(ctx); result != resultDeadlineExceeded || nextCalled {
+		t.Errorf("request below the deadline floor should be short-circuited, got result %q", result)
+	}
+
+	outgoing = http.Header{}
+	outgoing.Set(DefaultCorrelationHeader, "trace-3")
+	if result := applier.Handle(newTestContext(outgoing)); result != "" || outgoing.Get("X-Mesh-Deadline") != "" {
+		t.Errorf("request without recorded deadline should not be changed")
+	}
+}
+
+func TestHeaderPropagatorBaggage(t *testing.T) {
+	recorder := newHeaderPropagator(t, `
+kind: HeaderPropagator
+name: recorder
+mode: record
+store: order-baggage
+baggage:
+  keys: [tenant, tier, region]
+  maxKeys: 2
+`)
+	applier := newHeaderPropagator(t, `
+kind: HeaderPropagator
+name: applier
+mode: apply
+store: order-baggage
+baggage:
+  keys: [tenant, tier, region]
+  maxKeys: 2
+`)
+
+	tracer := mocktracer.New()
+	incoming := http.Header{}
+	incoming.Set(DefaultCorrelationHeader, "trace-1")
+	incoming.Set(BaggageHeader, "secret=s, tenant=megaease;ttl=1, tier=gold%20plus, region=asia")
+	ctx := newTestContext(incoming)
+	span := tracing.NewSpan(&tracing.Tracing{Tracer: tracer}, "ingress")
+	ctx.MockedSpan = func() tracing.Span { return span }
+	recorder.Handle(ctx)
+	span.Finish()
+
+	tags := tracer.FinishedSpans()[0].Tags()
+	if tags["baggage.tenant"] != "megaease" || tags["baggage.tier"] != "gold plus" {
+		t.Errorf("want baggage tagged to the span, got %v", tags)
+	}
+	if _, exists := tags["baggage.region"]; exists {
+		t.Errorf("baggage beyond max keys should be dropped, got %v", tags)
+	}
+
+	outgoing := http.Header{}
+	outgoing.Set(DefaultCorrelationHeader, "trace-1")
+	applier.Handle(newTestContext(outgoing))
+	if v := outgoing.Get(BaggageHeader); v != "tenant=megaease;ttl=1,tier=gold%20plus" {
+		t.Errorf("want allowed baggage propagated, got %q", v)
+	}
+
+	outgoing = http.Header{}
+	outgoing.Set(DefaultCorrelationHeader, "trace-1")
+	outgoing.Set(BaggageHeader, "tenant=other")
+	applier.Handle(newTestContext(outgoing))
+	if v := outgoing.Get(BaggageHeader); v != "tenant=other,tier=gold%20plus" {
+		t.Errorf("the baggage set by the application should be kept, got %q", v)
+	}
+}
+
+func TestBaggageMaxBytes(t *testing.T) {
+	spec := &BaggageSpec{Keys: []string{"a", "b"}, MaxBytes: 8}
+	selected := spec.selectBaggage(parseBaggage("a=123,b=456"), nil, 0)
+	if v := joinBaggage(selected); v != "a=123" {
+		t.Errorf("want baggage bounded by max bytes, got %q", v)
+	}
+
+	if entries := parseBaggage("=1,novalue,c=%zz, d = 4 "); len(entries) != 1 || entries[0].key != "d" || entries[0].value != "4" {
+		t.Errorf("want malformed baggage skipped, got %v", entries)
+	}
+}
+
+func TestCorrelationID(t *testing.T) {
+	tests := []struct {
+		key, value, want string
+	}{
+		{"", "abc", "abc"},
+		{"X-Request-Id", "req-1", "req-1"},
+		{"traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"traceparent", "invalid", ""},
+	}
+
+	for _, tc := range tests {
+		if got := correlationID(tc.key, tc.value); got != tc.want {
+			t.Errorf("correlationID(%q, %q): want %q, got %q", tc.key, tc.value, tc.want, got)
+		}
+	}
+}
@@ -18,22 +18,28 @@
 package mock
 
 import (
+	"bytes"
+	"net/url"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/urlrule"
 )
 
 const (
 	// Kind is the kind of Mock.
 	Kind = "Mock"
 
-	resultMocked = "mocked"
+	// ResultMocked is the result of a mocked request.
+	ResultMocked = "mocked"
 )
 
-var results = []string{resultMocked}
+var results = []string{ResultMocked}
 
 func init() {
 	httppipeline.Register(&Mock{})
@@ -62,7 +68,23 @@ type (
 		Body       string            `yaml:"body" jsonschema:"omitempty"`
 		Delay      string            `yaml:"delay" jsonschema:"omitempty,format=duration"`
 
-		delay time.Duration
+		// BodyTemplate renders Body as a text/template with the templateData.
+		BodyTemplate bool `yaml:"bodyTemplate" jsonschema:"omitempty"`
+		// MatchHeaders are the request headers which must all match to activate
+		// the rule, the unmatched requests fall through to the following rules.
+		MatchHeaders map[string]*urlrule.StringMatch `yaml:"matchHeaders" jsonschema:"omitempty"`
+
+		delay        time.Duration
+		bodyTemplate *template.Template
+	}
+
+	// templateData is the request data used to render the body template,
+	// e.g. {{index .PathSegments 1}}, {{.Query.Get "q"}}, {{.Header.Get "X-Id"}}.
+	templateData struct {
+		Path         string
+		PathSegments []string
+		Query        url.Values
+		Header       *httpheader.HTTPHeader
 	}
 )
 
@@ -100,6 +122,19 @@ func (m *Mock) Inherit(filterSpec *httppipeline.FilterSpec, previousGeneration h
 
 func (m *Mock) reload() {
 	for _, r := range m.spec.Rules {
+		for _, sm := range r.MatchHeaders {
+			sm.Init()
+		}
+
+		if r.BodyTemplate {
+			var err error
+			r.bodyTemplate, err = template.New("body").Parse(r.Body)
+			if err != nil {
+				logger.Errorf("parse body template %s failed, use it literally: %v", r.Body, err)
+				r.bodyTemplate = nil
+			}
+		}
+
 		if r.Delay == "" {
 			continue
 		}
@@ -107,6 +142,45 @@ func (m *Mock) reload() {
 	}
 }
 
+// Conditional reports whether the rule is only activated by matching headers.
+func (r *Rule) Conditional() bool {
+	return len(r.MatchHeaders) > 0
+}
+
+func (r *Rule) matchHeaders(ctx context.HTTPContext) bool {
+	h := ctx.Request().Header()
+	for key, sm := range r.MatchHeaders {
+		if !sm.Match(h.Get(key)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Rule) renderBody(ctx context.HTTPContext) string {
+	if r.bodyTemplate == nil {
+		return r.Body
+	}
+
+	req := ctx.Request()
+	query, _ := url.ParseQuery(req.Query())
+	data := &templateData{
+		Path:         req.Path(),
+		PathSegments: strings.Split(strings.TrimPrefix(req.Path(), "/"), "/"),
+		Query:        query,
+		Header:       req.Header(),
+	}
+
+	buff := bytes.NewBuffer(nil)
+	err := r.bodyTemplate.Execute(buff, data)
+	if err != nil {
+		logger.Errorf("execute body template %s failed, use it literally: %v", r.Body, err)
+		return r.Body
+	}
+
+	return buff.String()
+}
+
 // Handle mocks HTTPContext.
 func (m *Mock) Handle(ctx context.HTTPContext) (result string) {
 	result = m.handle(ctx)
@@ -122,8 +196,8 @@ func (m *Mock) handle(ctx context.HTTPContext) (result string) {
 		for key, value := range rule.Headers {
 			w.Header().Set(key, value)
 		}
-		w.SetBody(strings.NewReader(rule.Body))
-		result = resultMocked
+		w.SetBody(strings.NewReader(rule.renderBody(ctx)))
+		result = ResultMocked
 
 		if rule.delay <= 0 {
 			return
@@ -138,6 +212,10 @@ func (m *Mock) handle(ctx context.HTTPContext) (result string) {
 	}
 
 	for _, rule := range m.spec.Rules {
+		if !rule.matchHeaders(ctx) {
+			continue
+		}
+
 		if rule.Path == "" && rule.PathPrefix == "" {
 			mock(rule)
 			return
@@ -132,3 +132,125 @@ rules:
 		t.Error("status code is not 204")
 	}
 }
+
+func TestMockBodyTemplate(t *testing.T) {
+	const yamlSpec = `
+kind: Mock
+name: mock
+rules:
+- pathPrefix: /users/
+  code: 200
+  bodyTemplate: true
+  body: '{"id":"{{index .PathSegments 1}}","q":"{{.Query.Get "q"}}","h":"{{.Header.Get "X-Id"}}"}'
+- pathPrefix: /broken/
+  code: 200
+  bodyTemplate: true
+  body: '{{.Path'
+- code: 200
+  body: '{{.Path}}'
+`
+	rawSpec := make(map[string]interface{})
+	yamltool.Unmarshal([]byte(yamlSpec), &rawSpec)
+
+	spec, e := httppipeline.NewFilterSpec(rawSpec, nil)
+	if e != nil {
+		t.Fatalf("unexpected error: %v", e)
+	}
+
+	m := &Mock{}
+	m.Init(spec)
+	defer m.Close()
+
+	var resp *httptest.ResponseRecorder
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedRequest.MockedQuery = func() string {
+		return "q=easegress"
+	}
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(http.Header{"X-Id": []string{"abc"}})
+	}
+	ctx.MockedResponse.MockedSetStatusCode = func(code int) {
+		resp.WriteHeader(code)
+	}
+	ctx.MockedResponse.MockedSetBody = func(body io.Reader) {
+		data, _ := io.ReadAll(body)
+		resp.Write(data)
+	}
+	ctx.MockedResponse.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(resp.Header())
+	}
+	ctx.MockedCallNextHandler = func(lastResult string) string {
+		return lastResult
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/users/42", want: `{"id":"42","q":"easegress","h":"abc"}`},
+		{path: "/broken/1", want: "{{.Path"},
+		{path: "/other", want: "{{.Path}}"},
+	}
+
+	for _, tt := range tests {
+		resp = httptest.NewRecorder()
+		ctx.MockedRequest.MockedPath = func() string {
+			return tt.path
+		}
+		m.Handle(ctx)
+		if got := resp.Body.String(); got != tt.want {
+			t.Errorf("path %s: want body %s, got %s", tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestMockMatchHeaders(t *testing.T) {
+	const yamlSpec = `
+kind: Mock
+name: mock
+rules:
+- pathPrefix: /
+  code: 200
+  body: 'mocked'
+  matchHeaders:
+    X-Mock:
+      exact: 'true'
+`
+	rawSpec := make(map[string]interface{})
+	yamltool.Unmarshal([]byte(yamlSpec), &rawSpec)
+
+	spec, e := httppipeline.NewFilterSpec(rawSpec, nil)
+	if e != nil {
+		t.Fatalf("unexpected error: %v", e)
+	}
+
+	m := &Mock{}
+	m.Init(spec)
+	defer m.Close()
+
+	header := http.Header{}
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedRequest.MockedPath = func() string {
+		return "/users"
+	}
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(header)
+	}
+	ctx.MockedResponse.MockedSetStatusCode = func(code int) {}
+	ctx.MockedResponse.MockedSetBody = func(body io.Reader) {}
+	ctx.MockedResponse.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(http.Header{})
+	}
+	ctx.MockedCallNextHandler = func(lastResult string) string {
+		return lastResult
+	}
+
+	if result := m.Handle(ctx); result != "" {
+		t.Errorf("request without the header should fall through, got result %s", result)
+	}
+
+	header.Set("X-Mock", "true")
+	if result := m.Handle(ctx); result != ResultMocked {
+		t.Errorf("request with the header should be mocked, got result %q", result)
+	}
+}
@@ -19,27 +19,39 @@ package proxy
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"os"
 	"strconv"
 	"strings"
 
 	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
 
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/util/httpheader"
 )
 
-// TODO: Expose more options: compression level, mime types.
+// TODO: Expose more options: compression level.
 
-var bodyFlushSize = 8 * int64(os.Getpagesize())
+var (
+	bodyFlushSize = 8 * int64(os.Getpagesize())
+
+	// compressedContentTypes are the media type prefixes of the content
+	// already compressed, compressing them again wastes CPU for nothing.
+	compressedContentTypes = []string{
+		"image/", "video/", "audio/",
+		"application/zip", "application/gzip", "application/x-gzip",
+		"application/x-bzip2", "application/x-7z-compressed", "application/x-rar-compressed",
+	}
+)
 
 type (
-	gzipBody struct {
+	compressedBody struct {
 		body     io.Reader
 		buff     *bytes.Buffer
-		gw       *gzip.Writer
+		w        io.WriteCloser
 		complete bool
 	}
 
@@ -51,9 +63,25 @@ type (
 	// CompressionSpec describes the compression.
 	CompressionSpec struct {
 		MinLength uint32 `yaml:"minLength"`
+		// ContentTypes are the media types to compress, a type ending with
+		// /* matches all its subtypes. Empty means all but the already
+		// compressed ones.
+		ContentTypes []string `yaml:"contentTypes,omitempty" jsonschema:"omitempty,uniqueItems=true"`
 	}
 )
 
+// Validate validates CompressionSpec.
+func (s CompressionSpec) Validate() error {
+	for _, t := range s.ContentTypes {
+		parts := strings.Split(t, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid content type %s", t)
+		}
+	}
+
+	return nil
+}
+
 func newCompression(spec *CompressionSpec) *compression {
 	return &compression{
 		spec: spec,
@@ -61,11 +89,21 @@ func newCompression(spec *CompressionSpec) *compression {
 }
 
 func (c *compression) compress(ctx context.HTTPContext) {
-	if !c.acceptGzip(ctx) {
+	encoding := ""
+	switch {
+	case c.acceptGzip(ctx):
+		encoding = "gzip"
+	case c.acceptDeflate(ctx):
+		encoding = "deflate"
+	default:
+		return
+	}
+
+	if c.alreadyCompressed(ctx) {
 		return
 	}
 
-	if c.alreadyGziped(ctx) {
+	if !c.compressibleContentType(ctx) {
 		return
 	}
 
@@ -78,44 +116,112 @@ func (c *compression) compress(ctx context.HTTPContext) {
 		return
 	}
 
+	// NOTE: The length of the compressed body is unknown until it's
+	// fully compressed, so the response is sent chunked.
 	ctx.Response().Header().Del(httpheader.KeyContentLength)
 
-	w.Header().Set(httpheader.KeyContentEncoding, "gzip")
+	w.Header().Set(httpheader.KeyContentEncoding, encoding)
 	w.Header().Add(httpheader.KeyVary, httpheader.KeyContentEncoding)
 
-	ctx.AddTag("gzip")
+	ctx.AddTag(encoding)
 
-	w.SetBody(newGzipBody(w.Body()))
+	if encoding == "gzip" {
+		w.SetBody(newGzipBody(w.Body()))
+	} else {
+		w.SetBody(newDeflateBody(w.Body()))
+	}
 }
 
-func (c *compression) alreadyGziped(ctx context.HTTPContext) bool {
+func (c *compression) alreadyCompressed(ctx context.HTTPContext) bool {
 	for _, ce := range ctx.Response().Header().GetAll(httpheader.KeyContentEncoding) {
-		if strings.Contains(ce, "gzip") {
-			return true
+		for _, encoding := range []string{"gzip", "deflate", "br", "compress"} {
+			if strings.Contains(ce, encoding) {
+				return true
+			}
 		}
 	}
 
 	return false
 }
 
-func (c *compression) acceptGzip(ctx context.HTTPContext) bool {
-	acceptEncodings := ctx.Request().Header().GetAll(httpheader.KeyAcceptEncoding)
+func (c *compression) compressibleContentType(ctx context.HTTPContext) bool {
+	contentType := ctx.Response().Header().Get(httpheader.KeyContentType)
+	mediaType := strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
 
-	// NOTE: Easegress does not support parsing qvalue for performance.
-	// Reference: https://tools.ietf.org/html/rfc2616#section-14.3
-	if len(acceptEncodings) > 0 {
-		for _, ae := range acceptEncodings {
-			if strings.Contains(ae, "*/*") ||
-				strings.Contains(ae, "gzip") {
+	if len(c.spec.ContentTypes) != 0 {
+		for _, t := range c.spec.ContentTypes {
+			t = strings.ToLower(t)
+			if t == mediaType || (strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, t[:len(t)-1])) {
 				return true
 			}
 		}
 		return false
 	}
 
+	if mediaType == "image/svg+xml" {
+		return true
+	}
+	for _, t := range compressedContentTypes {
+		if strings.HasPrefix(mediaType, t) {
+			return false
+		}
+	}
+
 	return true
 }
 
+func (c *compression) acceptDeflate(ctx context.HTTPContext) bool {
+	q, ok := acceptEncodingQValue(ctx.Request().Header().GetAll(httpheader.KeyAcceptEncoding), "deflate")
+	return ok && q > 0
+}
+
+func (c *compression) acceptGzip(ctx context.HTTPContext) bool {
+	acceptEncodings := ctx.Request().Header().GetAll(httpheader.KeyAcceptEncoding)
+	if len(acceptEncodings) == 0 {
+		return true
+	}
+
+	q, ok := acceptEncodingQValue(acceptEncodings, "gzip")
+	return ok && q > 0
+}
+
+// acceptEncodingQValue returns the qvalue of the encoding in the
+// Accept-Encoding headers, the wildcard is used if the encoding is not
+// listed, and q=0 means the encoding is not acceptable.
+// Reference: https://www.rfc-editor.org/rfc/rfc7231#section-5.3.4
+func acceptEncodingQValue(acceptEncodings []string, encoding string) (float64, bool) {
+	wildcardQ, wildcard := 0.0, false
+	for _, ae := range acceptEncodings {
+		for _, item := range strings.Split(ae, ",") {
+			params := strings.Split(item, ";")
+			coding := strings.ToLower(strings.TrimSpace(params[0]))
+
+			q := 1.0
+			for _, param := range params[1:] {
+				param = strings.TrimSpace(param)
+				if len(param) < 2 || (param[0] != 'q' && param[0] != 'Q') || param[1] != '=' {
+					continue
+				}
+				v, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					v = 0
+				}
+				q = v
+			}
+
+			switch coding {
+			case encoding:
+				return q, true
+			// NOTE: */* is not valid here, but it's kept for the old clients.
+			case "*", "*/*":
+				wildcardQ, wildcard = q, true
+			}
+		}
+	}
+
+	return wildcardQ, wildcard
+}
+
 func (c *compression) parseContentLength(ctx context.HTTPContext) int {
 	contentLength := ctx.Response().Header().Get(httpheader.KeyContentLength)
 	if contentLength == "" {
@@ -130,17 +236,29 @@ func (c *compression) parseContentLength(ctx context.HTTPContext) int {
 	return int(cl)
 }
 
-func newGzipBody(body io.Reader) *gzipBody {
+func newGzipBody(body io.Reader) *compressedBody {
+	buff := bytes.NewBuffer(nil)
+	return &compressedBody{
+		body: body,
+		buff: buff,
+		w:    gzip.NewWriter(buff),
+	}
+}
+
+func newDeflateBody(body io.Reader) *compressedBody {
 	buff := bytes.NewBuffer(nil)
-	return &gzipBody{
+	// NOTE: The deflate content coding is the zlib format, not the raw
+	// deflate one.
+	// Reference: https://www.rfc-editor.org/rfc/rfc7230#section-4.2.2
+	return &compressedBody{
 		body: body,
 		buff: buff,
-		gw:   gzip.NewWriter(buff),
+		w:    zlib.NewWriter(buff),
 	}
 }
 
-// body -> gw -> p
-func (gb *gzipBody) Read(p []byte) (int, error) {
+// body -> w -> p
+func (gb *compressedBody) Read(p []byte) (int, error) {
 	if gb.complete {
 		return 0, io.EOF
 	}
@@ -157,19 +275,19 @@ func (gb *gzipBody) Read(p []byte) (int, error) {
 	return n, err
 }
 
-func (gb *gzipBody) pull() {
-	_, err := io.CopyN(gb.gw, gb.body, bodyFlushSize)
+func (gb *compressedBody) pull() {
+	_, err := io.CopyN(gb.w, gb.body, bodyFlushSize)
 	switch err {
 	case nil:
 		// Nothing to do.
 	case io.EOF:
-		err := gb.gw.Close()
+		err := gb.w.Close()
 		if err != nil {
-			logger.Errorf("BUG: close gzip failed: %v", err)
+			logger.Errorf("BUG: close compression writer failed: %v", err)
 		}
 		gb.complete = true
 	default:
 		gb.complete = true
-		logger.Errorf("BUG: copy body to gzip failed: %v", err)
+		logger.Errorf("BUG: copy body to compression writer failed: %v", err)
 	}
 }
@@ -18,12 +18,14 @@
 package proxy
 
 import (
+	"bytes"
 	"io"
 	"net/http"
 	"os"
 	"strings"
 	"testing"
 
+	"github.com/klauspost/compress/zlib"
 	"github.com/megaease/easegress/pkg/context/contexttest"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/util/httpheader"
@@ -63,9 +65,43 @@ func TestAcceptGzip(t *testing.T) {
 	if !c.acceptGzip(ctx) {
 		t.Error("accept gzip should be true")
 	}
+
+	header.Set(httpheader.KeyAcceptEncoding, "gzip;q=0, *")
+	if c.acceptGzip(ctx) {
+		t.Error("accept gzip should be false")
+	}
 }
 
-func TestAlreadyGziped(t *testing.T) {
+func TestAcceptDeflate(t *testing.T) {
+	c := newCompression(&CompressionSpec{MinLength: 100})
+
+	header := http.Header{}
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(header)
+	}
+
+	if c.acceptDeflate(ctx) {
+		t.Error("accept deflate should be false")
+	}
+
+	for ae, accept := range map[string]bool{
+		"deflate":                true,
+		"gzip, deflate;q=0.5":    true,
+		"deflate;q=0":            false,
+		"deflate; q=0.000, gzip": false,
+		"*;q=0.1":                true,
+		"*, deflate;q=0":         false,
+		"br":                     false,
+	} {
+		header.Set(httpheader.KeyAcceptEncoding, ae)
+		if c.acceptDeflate(ctx) != accept {
+			t.Errorf("accept deflate should be %v for %q", accept, ae)
+		}
+	}
+}
+
+func TestAlreadyCompressed(t *testing.T) {
 	c := newCompression(&CompressionSpec{MinLength: 100})
 
 	header := http.Header{}
@@ -74,18 +110,67 @@ func TestAlreadyGziped(t *testing.T) {
 		return httpheader.New(header)
 	}
 
-	if c.alreadyGziped(ctx) {
-		t.Error("already gziped should be false")
+	if c.alreadyCompressed(ctx) {
+		t.Error("already compressed should be false")
 	}
 
 	header.Add(httpheader.KeyContentEncoding, "text")
-	if c.alreadyGziped(ctx) {
-		t.Error("already gziped should be false")
+	if c.alreadyCompressed(ctx) {
+		t.Error("already compressed should be false")
 	}
 
 	header.Add(httpheader.KeyContentEncoding, "gzip")
-	if !c.alreadyGziped(ctx) {
-		t.Error("already gziped should be true")
+	if !c.alreadyCompressed(ctx) {
+		t.Error("already compressed should be true")
+	}
+
+	header.Set(httpheader.KeyContentEncoding, "br")
+	if !c.alreadyCompressed(ctx) {
+		t.Error("already compressed should be true")
+	}
+}
+
+func TestCompressibleContentType(t *testing.T) {
+	c := newCompression(&CompressionSpec{MinLength: 100})
+
+	header := http.Header{}
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedResponse.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(header)
+	}
+
+	cases := map[string]bool{
+		"":                         true,
+		"text/html; charset=utf-8": true,
+		"application/json":         true,
+		"image/svg+xml":            true,
+		"image/png":                false,
+		"video/mp4":                false,
+		"application/zip":          false,
+	}
+	for contentType, want := range cases {
+		header.Set(httpheader.KeyContentType, contentType)
+		if got := c.compressibleContentType(ctx); got != want {
+			t.Errorf("content type %q: want compressible %v, got %v", contentType, want, got)
+		}
+	}
+
+	c = newCompression(&CompressionSpec{
+		MinLength:    100,
+		ContentTypes: []string{"text/*", "application/json"},
+	})
+	cases = map[string]bool{
+		"text/html; charset=utf-8": true,
+		"text/plain":               true,
+		"application/json":         true,
+		"application/xml":          false,
+		"":                         false,
+	}
+	for contentType, want := range cases {
+		header.Set(httpheader.KeyContentType, contentType)
+		if got := c.compressibleContentType(ctx); got != want {
+			t.Errorf("content type %q: want compressible %v, got %v", contentType, want, got)
+		}
 	}
 }
 
@@ -146,5 +231,55 @@ func TestCompress(t *testing.T) {
 	if header.Get(httpheader.KeyContentEncoding) != "gzip" {
 		t.Error("body should be gziped")
 	}
+	if header.Get(httpheader.KeyContentLength) != "" {
+		t.Error("content length should be removed")
+	}
+}
+
+func TestCompressDeflate(t *testing.T) {
+	c := newCompression(&CompressionSpec{MinLength: 100})
+
+	reqHeader := http.Header{}
+	respHeader := http.Header{}
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(reqHeader)
+	}
+	ctx.MockedResponse.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(respHeader)
+	}
 
+	rawBody := strings.Repeat("this is the raw body. ", 100)
+	ctx.MockedResponse.MockedBody = func() io.Reader {
+		return strings.NewReader(rawBody)
+	}
+	var body []byte
+	ctx.MockedResponse.MockedSetBody = func(r io.Reader) {
+		body, _ = io.ReadAll(r)
+	}
+
+	reqHeader.Set(httpheader.KeyAcceptEncoding, "deflate")
+	respHeader.Set(httpheader.KeyContentType, "image/png")
+	c.compress(ctx)
+	if respHeader.Get(httpheader.KeyContentEncoding) != "" {
+		t.Error("image should not be compressed")
+	}
+
+	respHeader.Set(httpheader.KeyContentType, "text/plain")
+	c.compress(ctx)
+	if respHeader.Get(httpheader.KeyContentEncoding) != "deflate" {
+		t.Fatal("body should be deflated")
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("new zlib reader failed: %v", err)
+	}
+	decompressed, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("inflate body failed: %v", err)
+	}
+	if string(decompressed) != rawBody {
+		t.Error("inflated body should equal to the raw body")
+	}
 }
@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ConnectionPool is the connection settings of the servers, the zero values
+// keep the default settings.
+type ConnectionPool struct {
+	// MaxIdleConns is the maximum number of idle connections to all servers, default is 10240.
+	MaxIdleConns int `yaml:"maxIdleConns" jsonschema:"omitempty,minimum=0"`
+	// MaxIdleConnsPerHost is the maximum number of idle connections to one server, default is 512.
+	MaxIdleConnsPerHost int `yaml:"maxIdleConnsPerHost" jsonschema:"omitempty,minimum=0"`
+	// MaxConnsPerHost is the maximum number of connections to one server,
+	// including the ones in use, default is no limit.
+	MaxConnsPerHost int `yaml:"maxConnsPerHost" jsonschema:"omitempty,minimum=0"`
+	// IdleConnTimeout is how long an idle connection is kept, default is 90s.
+	IdleConnTimeout string `yaml:"idleConnTimeout" jsonschema:"omitempty,format=duration"`
+}
+
+// Validate validates ConnectionPool.
+func (cp ConnectionPool) Validate() error {
+	if cp.IdleConnTimeout == "" {
+		return nil
+	}
+
+	// NOTE: The format has been checked by the jsonschema.
+	d, _ := time.ParseDuration(cp.IdleConnTimeout)
+	if d < 0 {
+		return fmt.Errorf("idleConnTimeout must not be negative: %s", cp.IdleConnTimeout)
+	}
+
+	return nil
+}
+
+func (cp *ConnectionPool) apply(transport *http.Transport) {
+	if cp.MaxIdleConns > 0 {
+		transport.MaxIdleConns = cp.MaxIdleConns
+	}
+	if cp.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = cp.MaxIdleConnsPerHost
+	}
+	if cp.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = cp.MaxConnsPerHost
+	}
+	// NOTE: The IdleConnTimeout has been checked by the format.
+	if d, err := time.ParseDuration(cp.IdleConnTimeout); err == nil && d > 0 {
+		transport.IdleConnTimeout = d
+	}
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/v"
+)
+
+func TestNewClientWithConnectionPool(t *testing.T) {
+	client, err := newClient(nil, &ConnectionPool{
+		MaxIdleConnsPerHost: 16,
+		MaxConnsPerHost:     64,
+		IdleConnTimeout:     "30s",
+	})
+	if err != nil {
+		t.Fatalf("create client failed: %v", err)
+	}
+	defer client.CloseIdleConnections()
+
+	transport := client.Transport.(*http.Transport)
+	if transport == globalClient.Transport {
+		t.Fatalf("client should have its own transport")
+	}
+	if transport.MaxIdleConnsPerHost != 16 || transport.MaxConnsPerHost != 64 ||
+		transport.IdleConnTimeout != 30*time.Second {
+		t.Errorf("connection pool should be applied, got %d %d %v", transport.MaxIdleConnsPerHost,
+			transport.MaxConnsPerHost, transport.IdleConnTimeout)
+	}
+
+	global := globalClient.Transport.(*http.Transport)
+	if transport.MaxIdleConns != global.MaxIdleConns {
+		t.Errorf("unspecified settings should keep the default, got %d", transport.MaxIdleConns)
+	}
+}
+
+func TestConnectionPoolValidate(t *testing.T) {
+	if vr := v.Validate(&ConnectionPool{MaxConnsPerHost: 10, IdleConnTimeout: "1m"}); !vr.Valid() {
+		t.Errorf("connection pool should be valid: %v", vr)
+	}
+	if vr := v.Validate(&ConnectionPool{MaxIdleConnsPerHost: -1}); vr.Valid() {
+		t.Errorf("negative maxIdleConnsPerHost should be invalid")
+	}
+	if vr := v.Validate(&ConnectionPool{IdleConnTimeout: "-1s"}); vr.Valid() {
+		t.Errorf("negative idleConnTimeout should be invalid")
+	}
+}
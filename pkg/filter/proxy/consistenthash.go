@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/util/hashtool"
+)
+
+const (
+	// HashSourceHeader hashes the value of the header HashKey.
+	HashSourceHeader = "header"
+	// HashSourceCookie hashes the value of the cookie HashKey.
+	HashSourceCookie = "cookie"
+	// HashSourceIP hashes the real IP of the client.
+	HashSourceIP = "ip"
+
+	// DefaultLoadFactor is the default load factor of consistent hash.
+	DefaultLoadFactor = 1.25
+
+	// virtualNodes is the number of points of every server on the ring.
+	virtualNodes = 100
+)
+
+type (
+	hashRing struct {
+		hashes  []uint32
+		servers []*Server
+	}
+)
+
+func newHashRing(servers []*Server) *hashRing {
+	ring := &hashRing{
+		hashes:  make([]uint32, 0, len(servers)*virtualNodes),
+		servers: make([]*Server, 0, len(servers)*virtualNodes),
+	}
+
+	type point struct {
+		hash   uint32
+		server *Server
+	}
+	points := make([]point, 0, len(servers)*virtualNodes)
+	for _, server := range servers {
+		for i := 0; i < virtualNodes; i++ {
+			hash := hashtool.Hash32(server.URL + "#" + strconv.Itoa(i))
+			points = append(points, point{hash: hash, server: server})
+		}
+	}
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].hash < points[j].hash
+	})
+
+	for _, p := range points {
+		ring.hashes = append(ring.hashes, p.hash)
+		ring.servers = append(ring.servers, p.server)
+	}
+
+	return ring
+}
+
+func (lb *LoadBalance) loadFactor() float64 {
+	if lb.LoadFactor == 0 {
+		return DefaultLoadFactor
+	}
+	return lb.LoadFactor
+}
+
+func (lb *LoadBalance) hashKey(ctx context.HTTPContext) string {
+	r := ctx.Request()
+	switch lb.HashSource {
+	case HashSourceHeader:
+		return r.Header().Get(lb.HashKey)
+	case HashSourceCookie:
+		cookie, err := r.Cookie(lb.HashKey)
+		if err != nil {
+			return ""
+		}
+		return cookie.Value
+	default:
+		return r.RealIP()
+	}
+}
+
+// consistentHash picks the server following the hash of the key on the
+// ring, but skips the servers whose in-flight requests have reached the
+// capacity, which is the load factor times the average load, so that the
+// overflow of a hot key spills to the next servers on the ring. If all
+// servers are at capacity, it falls back to the server the key hashes to.
+func (ss *staticServers) consistentHash(ctx context.HTTPContext) *Server {
+	ring := ss.ring
+	hash := hashtool.Hash32(ss.lb.hashKey(ctx))
+	start := sort.Search(len(ring.hashes), func(i int) bool {
+		return ring.hashes[i] >= hash
+	})
+
+	var total int64
+	for _, server := range ss.servers {
+		total += atomic.LoadInt64(&server.inflight)
+	}
+	capacity := int64(math.Ceil(ss.lb.loadFactor() * float64(total+1) / float64(len(ss.servers))))
+
+	checked := make(map[*Server]struct{}, len(ss.servers))
+	for i := 0; i < len(ring.servers) && len(checked) < len(ss.servers); i++ {
+		server := ring.servers[(start+i)%len(ring.servers)]
+		if _, exists := checked[server]; exists {
+			continue
+		}
+		if atomic.LoadInt64(&server.inflight) < capacity {
+			return server
+		}
+		checked[server] = struct{}{}
+	}
+
+	return ring.servers[start%len(ring.servers)]
+}
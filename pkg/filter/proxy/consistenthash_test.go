@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+func newConsistentHashServers(lb *LoadBalance) *staticServers {
+	servers := []*Server{
+		{URL: "http://127.0.0.1:9091"},
+		{URL: "http://127.0.0.1:9092"},
+		{URL: "http://127.0.0.1:9093"},
+	}
+	return newStaticServers(servers, nil, lb)
+}
+
+func TestConsistentHash(t *testing.T) {
+	lb := &LoadBalance{Policy: PolicyConsistentHash, HashSource: HashSourceCookie, HashKey: "user"}
+	ss := newConsistentHashServers(lb)
+
+	user := "alice"
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedRequest.MockedCookie = func(name string) (*http.Cookie, error) {
+		if name != "user" {
+			return nil, http.ErrNoCookie
+		}
+		return &http.Cookie{Name: name, Value: user}, nil
+	}
+
+	first := ss.next(ctx)
+	for i := 0; i < 10; i++ {
+		if got := ss.next(ctx); got != first {
+			t.Fatalf("same key should go to the same server, want %s, got %s", first.URL, got.URL)
+		}
+	}
+
+	picked := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		user = "user-" + string(rune('a'+i%26)) + string(rune('a'+i/26))
+		picked[ss.next(ctx).URL] = true
+	}
+	if len(picked) != len(ss.servers) {
+		t.Errorf("keys should spread over all servers, got %v", picked)
+	}
+
+	// Adding a server only moves part of the keys.
+	more := newStaticServers(append([]*Server{{URL: "http://127.0.0.1:9094"}}, ss.servers...), nil, lb)
+	moved := 0
+	for i := 0; i < 100; i++ {
+		user = "user-" + string(rune('a'+i%26)) + string(rune('a'+i/26))
+		if ss.next(ctx).URL != more.next(ctx).URL {
+			moved++
+		}
+	}
+	if moved > 50 {
+		t.Errorf("too many keys moved after adding a server: %d", moved)
+	}
+}
+
+func TestConsistentHashBoundedLoad(t *testing.T) {
+	lb := &LoadBalance{Policy: PolicyConsistentHash, HashSource: HashSourceHeader, HashKey: "X-User", LoadFactor: 1.5}
+	ss := newConsistentHashServers(lb)
+
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(http.Header{"X-User": []string{"alice"}})
+	}
+
+	hot := ss.next(ctx)
+
+	// Average load after the next request is (3+1)/3, capacity is 2.
+	hot.inflight = 3
+	spilled := ss.next(ctx)
+	if spilled == hot {
+		t.Fatalf("overloaded server should be skipped")
+	}
+
+	// Servers below the capacity take the requests as usual.
+	for _, server := range ss.servers {
+		server.inflight = 1
+	}
+	if got := ss.next(ctx); got != hot {
+		t.Errorf("want %s, got %s", hot.URL, got.URL)
+	}
+
+	// Fall back to the hashed server if all servers are at capacity, it
+	// only happens with concurrent requests, so the load factor bypasses
+	// the validation to simulate it.
+	for _, server := range ss.servers {
+		server.inflight = 100
+	}
+	ss.lb.LoadFactor = 0.5
+	if got := ss.next(ctx); got != hot {
+		t.Errorf("want fallback to %s, got %s", hot.URL, got.URL)
+	}
+}
+
+func TestLoadBalanceValidate(t *testing.T) {
+	cases := []struct {
+		lb    LoadBalance
+		valid bool
+	}{
+		{LoadBalance{Policy: PolicyConsistentHash}, true},
+		{LoadBalance{Policy: PolicyConsistentHash, HashSource: HashSourceIP}, true},
+		{LoadBalance{Policy: PolicyConsistentHash, HashSource: HashSourceHeader}, false},
+		{LoadBalance{Policy: PolicyConsistentHash, HashSource: HashSourceCookie, HashKey: "user"}, true},
+		{LoadBalance{Policy: PolicyConsistentHash, LoadFactor: 0.5}, false},
+		{LoadBalance{Policy: PolicyConsistentHash, LoadFactor: 2}, true},
+	}
+	for i, c := range cases {
+		if err := c.lb.Validate(); (err == nil) != c.valid {
+			t.Errorf("case %d: want valid %v, got %v", i, c.valid, err)
+		}
+	}
+}
@@ -20,6 +20,7 @@ package proxy
 import (
 	"bytes"
 	"io"
+	"sync"
 )
 
 type (
@@ -34,6 +35,11 @@ type (
 	masterReader struct {
 		r        io.Reader
 		buffChan chan []byte
+
+		// closed is true once the slave gets EOF, which is after the
+		// master reads EOF or is closed.
+		mutex  sync.Mutex
+		closed bool
 	}
 
 	slaveReader struct {
@@ -61,18 +67,35 @@ func (mr *masterReader) Read(p []byte) (n int, err error) {
 	tee := io.TeeReader(mr.r, buff)
 	n, err = tee.Read(p)
 
+	mr.mutex.Lock()
+	defer mr.mutex.Unlock()
+
+	if mr.closed {
+		return n, err
+	}
+
 	if n != 0 {
 		mr.buffChan <- buff.Bytes()
 	}
 
 	if err == io.EOF {
+		mr.closed = true
 		close(mr.buffChan)
 	}
 
 	return n, err
 }
 
+// Close closes the underlying reader, and ends the slave with EOF, so the
+// slave never waits for the bytes the master will not read.
 func (mr *masterReader) Close() error {
+	mr.mutex.Lock()
+	if !mr.closed {
+		mr.closed = true
+		close(mr.buffChan)
+	}
+	mr.mutex.Unlock()
+
 	if closer, ok := mr.r.(io.ReadCloser); ok {
 		return closer.Close()
 	}
@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+)
+
+// MTLS is the client certificate for mutual TLS and the root certificate to
+// verify the servers, they are all PEM encoded data in base64 encoded format.
+type MTLS struct {
+	CertBase64     string `yaml:"certBase64" jsonschema:"required,format=base64"`
+	KeyBase64      string `yaml:"keyBase64" jsonschema:"required,format=base64"`
+	RootCertBase64 string `yaml:"rootCertBase64" jsonschema:"required,format=base64"`
+	// ServerName is the name to verify the server certificates,
+	// empty means the host of the server URL.
+	ServerName string `yaml:"serverName,omitempty" jsonschema:"omitempty"`
+}
+
+// Validate validates MTLS.
+func (m MTLS) Validate() error {
+	_, err := m.tlsConfig()
+	return err
+}
+
+func (m *MTLS) tlsConfig() (*tls.Config, error) {
+	certPem, _ := base64.StdEncoding.DecodeString(m.CertBase64)
+	keyPem, _ := base64.StdEncoding.DecodeString(m.KeyBase64)
+	cert, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		return nil, fmt.Errorf("generate x509 key pair failed: %v", err)
+	}
+
+	rootCertPem, _ := base64.StdEncoding.DecodeString(m.RootCertBase64)
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(rootCertPem) {
+		return nil, fmt.Errorf("none valid certs in rootCertBase64")
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ServerName:   m.ServerName,
+	}, nil
+}
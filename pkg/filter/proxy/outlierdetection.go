@@ -0,0 +1,293 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+type (
+	// OutlierDetection is the spec of passive outlier detection for servers of a pool.
+	OutlierDetection struct {
+		// Interval is the time window to calculate the success rate of every server.
+		Interval string `yaml:"interval" jsonschema:"required,format=duration"`
+		// MinHosts is the minimum number of servers with enough requests
+		// in the window to do success rate ejection.
+		MinHosts int `yaml:"minHosts" jsonschema:"omitempty,minimum=1"`
+		// MinRequests is the minimum number of requests of a server in the window
+		// to take it into account.
+		MinRequests int `yaml:"minRequests" jsonschema:"omitempty,minimum=1"`
+		// SuccessRateStdevFactor ejects the server whose success rate is below
+		// mean - (stdev * SuccessRateStdevFactor).
+		SuccessRateStdevFactor float64 `yaml:"successRateStdevFactor" jsonschema:"omitempty,minimum=0"`
+		// EjectionDuration is the duration a server stays ejected.
+		EjectionDuration string `yaml:"ejectionDuration" jsonschema:"required,format=duration"`
+		// MaxEjectionPercent is the maximum percent of ejected servers.
+		MaxEjectionPercent int `yaml:"maxEjectionPercent" jsonschema:"omitempty,minimum=0,maximum=100"`
+		// MinHealthyHosts is the minimum number of servers never to be ejected.
+		MinHealthyHosts int `yaml:"minHealthyHosts" jsonschema:"omitempty,minimum=1"`
+		// Consecutive5xx ejects the server immediately after the number of
+		// consecutive 5xx responses or connection errors, 0 means disabled.
+		Consecutive5xx int `yaml:"consecutive5xx" jsonschema:"omitempty,minimum=1"`
+	}
+
+	outlierDetector struct {
+		spec             *OutlierDetection
+		ejectionDuration time.Duration
+
+		mutex       sync.Mutex
+		stats       map[string]*outlierStat
+		ejected     map[string]time.Time
+		consecutive map[string]int
+	}
+
+	outlierStat struct {
+		total   int
+		success int
+	}
+)
+
+const (
+	defaultOutlierMinHosts               = 5
+	defaultOutlierMinRequests            = 100
+	defaultOutlierSuccessRateStdevFactor = 1.9
+	defaultOutlierMaxEjectionPercent     = 10
+	defaultOutlierMinHealthyHosts        = 1
+)
+
+var nowFunc = time.Now
+
+// Validate validates OutlierDetection.
+func (od OutlierDetection) Validate() error {
+	interval, err := time.ParseDuration(od.Interval)
+	if err != nil || interval <= 0 {
+		return fmt.Errorf("invalid interval: %s", od.Interval)
+	}
+
+	ejectionDuration, err := time.ParseDuration(od.EjectionDuration)
+	if err != nil || ejectionDuration <= 0 {
+		return fmt.Errorf("invalid ejectionDuration: %s", od.EjectionDuration)
+	}
+
+	return nil
+}
+
+func newOutlierDetector(spec *OutlierDetection) *outlierDetector {
+	s := *spec
+	if s.MinHosts == 0 {
+		s.MinHosts = defaultOutlierMinHosts
+	}
+	if s.MinRequests == 0 {
+		s.MinRequests = defaultOutlierMinRequests
+	}
+	if s.SuccessRateStdevFactor == 0 {
+		s.SuccessRateStdevFactor = defaultOutlierSuccessRateStdevFactor
+	}
+	if s.MaxEjectionPercent == 0 {
+		s.MaxEjectionPercent = defaultOutlierMaxEjectionPercent
+	}
+	if s.MinHealthyHosts == 0 {
+		s.MinHealthyHosts = defaultOutlierMinHealthyHosts
+	}
+
+	// NOTE: The durations are validated by json schema.
+	ejectionDuration, _ := time.ParseDuration(s.EjectionDuration)
+
+	return &outlierDetector{
+		spec:             &s,
+		ejectionDuration: ejectionDuration,
+		stats:            make(map[string]*outlierStat),
+		ejected:          make(map[string]time.Time),
+		consecutive:      make(map[string]int),
+	}
+}
+
+func (od *outlierDetector) interval() time.Duration {
+	interval, _ := time.ParseDuration(od.spec.Interval)
+	return interval
+}
+
+// record records the result of one request to the server, serversCount is
+// the number of all servers of the pool.
+// It returns true if the server is ejected for consecutive failures.
+func (od *outlierDetector) record(url string, success bool, serversCount int) bool {
+	od.mutex.Lock()
+	defer od.mutex.Unlock()
+
+	stat, exists := od.stats[url]
+	if !exists {
+		stat = &outlierStat{}
+		od.stats[url] = stat
+	}
+	stat.total++
+	if success {
+		stat.success++
+		delete(od.consecutive, url)
+		return false
+	}
+
+	if od.spec.Consecutive5xx == 0 {
+		return false
+	}
+
+	od.consecutive[url]++
+	if od.consecutive[url] < od.spec.Consecutive5xx {
+		return false
+	}
+
+	now := nowFunc()
+	ejectedCount := 0
+	for ejectedURL, until := range od.ejected {
+		if ejectedURL == url && now.Before(until) {
+			return false
+		}
+		if now.Before(until) {
+			ejectedCount++
+		}
+	}
+
+	// NOTE: Small pools could eject none by the percent, but a server keeps
+	// failing should be ejected as long as enough healthy servers are left.
+	maxEjected := od.maxEjected(serversCount)
+	if maxEjected == 0 && serversCount > od.spec.MinHealthyHosts {
+		maxEjected = 1
+	}
+	if ejectedCount >= maxEjected {
+		logger.Warnf("server %s got %d consecutive failures, but ejected servers reached the limit",
+			url, od.consecutive[url])
+		return false
+	}
+
+	logger.Warnf("eject server %s for %s: %d consecutive failures",
+		url, od.ejectionDuration, od.consecutive[url])
+	od.ejected[url] = now.Add(od.ejectionDuration)
+	delete(od.consecutive, url)
+	return true
+}
+
+// maxEjected returns the maximum number of ejected servers.
+func (od *outlierDetector) maxEjected(serversCount int) int {
+	maxEjected := serversCount * od.spec.MaxEjectionPercent / 100
+	if maxHealthyEjected := serversCount - od.spec.MinHealthyHosts; maxHealthyEjected < maxEjected {
+		maxEjected = maxHealthyEjected
+	}
+	return maxEjected
+}
+
+// isEjected reports whether the server is ejected now.
+func (od *outlierDetector) isEjected(url string) bool {
+	od.mutex.Lock()
+	defer od.mutex.Unlock()
+
+	until, exists := od.ejected[url]
+	return exists && nowFunc().Before(until)
+}
+
+// evaluate releases the expired ejections, ejects servers whose success rate
+// is an outlier in the finished window, and starts a new window.
+// It returns true if the ejected servers changed.
+func (od *outlierDetector) evaluate(urls []string) bool {
+	od.mutex.Lock()
+	defer od.mutex.Unlock()
+
+	now := nowFunc()
+	changed := false
+
+	for url, until := range od.ejected {
+		if !now.Before(until) {
+			delete(od.ejected, url)
+			changed = true
+		}
+	}
+
+	defer func() {
+		od.stats = make(map[string]*outlierStat)
+	}()
+
+	type candidate struct {
+		url  string
+		rate float64
+	}
+
+	ejectedCount := 0
+	candidates := []*candidate{}
+	for _, url := range urls {
+		if _, exists := od.ejected[url]; exists {
+			ejectedCount++
+			continue
+		}
+		stat := od.stats[url]
+		if stat == nil || stat.total < od.spec.MinRequests {
+			continue
+		}
+		candidates = append(candidates, &candidate{
+			url:  url,
+			rate: float64(stat.success) / float64(stat.total),
+		})
+	}
+
+	if len(candidates) < od.spec.MinHosts {
+		return changed
+	}
+
+	sum := 0.0
+	for _, c := range candidates {
+		sum += c.rate
+	}
+	mean := sum / float64(len(candidates))
+
+	variance := 0.0
+	for _, c := range candidates {
+		variance += (c.rate - mean) * (c.rate - mean)
+	}
+	stdev := math.Sqrt(variance / float64(len(candidates)))
+
+	threshold := mean - stdev*od.spec.SuccessRateStdevFactor
+
+	// NOTE: Eject the worst ones first in case of reaching the limits.
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].rate < candidates[j].rate
+	})
+
+	maxEjected := od.maxEjected(len(urls))
+
+	for _, c := range candidates {
+		if c.rate >= threshold {
+			break
+		}
+		if ejectedCount >= maxEjected {
+			logger.Warnf("server %s success rate %.2f is below %.2f, "+
+				"but ejected servers reached the limit %d", c.url, c.rate, threshold, maxEjected)
+			break
+		}
+
+		logger.Warnf("eject server %s for %s: success rate %.2f is below %.2f",
+			c.url, od.ejectionDuration, c.rate, threshold)
+		od.ejected[c.url] = now.Add(od.ejectionDuration)
+		ejectedCount++
+		changed = true
+	}
+
+	return changed
+}
@@ -0,0 +1,184 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func prepareOutlierDetector(spec *OutlierDetection, successRates []int) (*outlierDetector, []string) {
+	od := newOutlierDetector(spec)
+
+	urls := []string{}
+	for i, rate := range successRates {
+		url := fmt.Sprintf("http://127.0.0.1:%d", 9090+i)
+		urls = append(urls, url)
+		for j := 0; j < 100; j++ {
+			od.record(url, j < rate, len(successRates))
+		}
+	}
+
+	return od, urls
+}
+
+func TestOutlierDetectionValidate(t *testing.T) {
+	od := OutlierDetection{Interval: "10s", EjectionDuration: "30s"}
+	if err := od.Validate(); err != nil {
+		t.Errorf("outlier detection should be valid, err: %v", err)
+	}
+
+	od.Interval = "0s"
+	if od.Validate() == nil {
+		t.Errorf("zero interval should be invalid")
+	}
+}
+
+func TestOutlierDetectionSuccessRate(t *testing.T) {
+	now := time.Now()
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	spec := &OutlierDetection{
+		Interval:           "10s",
+		EjectionDuration:   "30s",
+		MinHosts:           3,
+		MinRequests:        10,
+		MaxEjectionPercent: 50,
+	}
+
+	od, urls := prepareOutlierDetector(spec, []int{100, 99, 100, 98, 20})
+	if !od.evaluate(urls) {
+		t.Fatalf("the outlier should be ejected")
+	}
+	for i, url := range urls {
+		if ejected := od.isEjected(url); ejected != (i == 4) {
+			t.Errorf("server %s ejected: %v", url, ejected)
+		}
+	}
+
+	// NOTE: The new window without enough requests keeps the ejection.
+	if od.evaluate(urls) {
+		t.Errorf("ejected servers should not change in the ejection duration")
+	}
+
+	now = now.Add(31 * time.Second)
+	if !od.evaluate(urls) {
+		t.Errorf("the ejection should be released")
+	}
+	if od.isEjected(urls[4]) {
+		t.Errorf("server %s should not be ejected", urls[4])
+	}
+
+	// NOTE: Not enough hosts to do success rate ejection.
+	od, urls = prepareOutlierDetector(spec, []int{100, 20})
+	if od.evaluate(urls) {
+		t.Errorf("no server should be ejected without enough hosts")
+	}
+}
+
+func TestOutlierDetectionMinHealthy(t *testing.T) {
+	now := time.Now()
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	spec := &OutlierDetection{
+		Interval:               "10s",
+		EjectionDuration:       "30s",
+		MinHosts:               3,
+		MinRequests:            10,
+		SuccessRateStdevFactor: 0.5,
+		MaxEjectionPercent:     100,
+		MinHealthyHosts:        3,
+	}
+
+	od, urls := prepareOutlierDetector(spec, []int{100, 100, 40, 30, 20})
+	od.evaluate(urls)
+
+	ejected := 0
+	for _, url := range urls {
+		if od.isEjected(url) {
+			ejected++
+		}
+	}
+	if ejected != 2 {
+		t.Errorf("want 2 ejected servers to keep 3 healthy, got %d", ejected)
+	}
+	if !od.isEjected(urls[4]) || !od.isEjected(urls[3]) {
+		t.Errorf("the worst servers should be ejected first")
+	}
+
+	s := &servers{
+		static:   newStaticServers(nil, nil, nil),
+		detector: od,
+	}
+	for _, url := range urls {
+		s.static.servers = append(s.static.servers, &Server{URL: url})
+	}
+	if healthy := s.healthySnapshot(); healthy.len() != 3 {
+		t.Errorf("want 3 healthy servers, got %d", healthy.len())
+	}
+}
+
+func TestOutlierDetectionConsecutive5xx(t *testing.T) {
+	now := time.Now()
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	spec := &OutlierDetection{
+		Interval:           "10s",
+		EjectionDuration:   "30s",
+		MaxEjectionPercent: 50,
+		Consecutive5xx:     3,
+	}
+
+	od := newOutlierDetector(spec)
+	urls := []string{"http://127.0.0.1:9090", "http://127.0.0.1:9091", "http://127.0.0.1:9092"}
+
+	od.record(urls[0], false, len(urls))
+	od.record(urls[0], false, len(urls))
+	od.record(urls[0], true, len(urls))
+	if od.record(urls[0], false, len(urls)) {
+		t.Errorf("success should reset consecutive failures")
+	}
+
+	od.record(urls[1], false, len(urls))
+	od.record(urls[1], false, len(urls))
+	if !od.record(urls[1], false, len(urls)) {
+		t.Fatalf("server %s should be ejected", urls[1])
+	}
+	if !od.isEjected(urls[1]) {
+		t.Errorf("server %s should be ejected", urls[1])
+	}
+
+	// NOTE: 50% of 3 servers allows only 1 ejected server.
+	for i := 0; i < 3; i++ {
+		if od.record(urls[2], false, len(urls)) {
+			t.Errorf("ejected servers should not exceed the limit")
+		}
+	}
+
+	now = now.Add(31 * time.Second)
+	if od.isEjected(urls[1]) {
+		t.Errorf("server %s should be readmitted", urls[1])
+	}
+	if !od.record(urls[2], false, len(urls)) {
+		t.Errorf("server %s should be ejected after the readmission", urls[2])
+	}
+}
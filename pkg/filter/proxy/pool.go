@@ -23,6 +23,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"sync"
+	"sync/atomic"
 
 	"github.com/opentracing/opentracing-go"
 
@@ -50,10 +52,16 @@ type (
 		servers     *servers
 		httpStat    *httpstat.HTTPStat
 		memoryCache *memorycache.MemoryCache
+		client      *http.Client
+
+		// selections counts the requests routed to the pool.
+		selections uint64
 	}
 
 	// PoolSpec describes a pool of servers.
 	PoolSpec struct {
+		// Name labels the pool in the status, it's optional.
+		Name            string            `yaml:"name,omitempty" jsonschema:"omitempty"`
 		SpanName        string            `yaml:"spanName" jsonschema:"omitempty"`
 		Filter          *httpfilter.Spec  `yaml:"filter" jsonschema:"omitempty"`
 		ServersTags     []string          `yaml:"serversTags" jsonschema:"omitempty,uniqueItems=true"`
@@ -62,11 +70,17 @@ type (
 		ServiceName     string            `yaml:"serviceName" jsonschema:"omitempty"`
 		LoadBalance     *LoadBalance      `yaml:"loadBalance" jsonschema:"required"`
 		MemoryCache     *memorycache.Spec `yaml:"memoryCache,omitempty" jsonschema:"omitempty"`
+
+		OutlierDetection *OutlierDetection `yaml:"outlierDetection,omitempty" jsonschema:"omitempty"`
+		// RequestHeader adapts the headers of the requests routed to the pool.
+		RequestHeader *httpheader.AdaptSpec `yaml:"requestHeader,omitempty" jsonschema:"omitempty"`
 	}
 
 	// PoolStatus is the status of Pool.
 	PoolStatus struct {
-		Stat *httpstat.Status `yaml:"stat"`
+		Name       string           `yaml:"name,omitempty"`
+		Stat       *httpstat.Status `yaml:"stat"`
+		Selections uint64           `yaml:"selections"`
 	}
 )
 
@@ -98,7 +112,7 @@ func (s PoolSpec) Validate() error {
 }
 
 func newPool(super *supervisor.Supervisor, spec *PoolSpec, tagPrefix string,
-	writeResponse bool, failureCodes []int) *pool {
+	writeResponse bool, failureCodes []int, client *http.Client) *pool {
 
 	var filter *httpfilter.HTTPFilter
 	if spec.Filter != nil {
@@ -120,11 +134,16 @@ func newPool(super *supervisor.Supervisor, spec *PoolSpec, tagPrefix string,
 		servers:     newServers(super, spec),
 		httpStat:    httpstat.New(),
 		memoryCache: memoryCache,
+		client:      client,
 	}
 }
 
 func (p *pool) status() *PoolStatus {
-	s := &PoolStatus{Stat: p.httpStat.Status()}
+	s := &PoolStatus{
+		Name:       p.spec.Name,
+		Stat:       p.httpStat.Status(),
+		Selections: atomic.LoadUint64(&p.selections),
+	}
 	return s
 }
 
@@ -152,6 +171,7 @@ func (p *pool) handle(ctx context.HTTPContext, reqBody io.Reader) string {
 
 	req, err := p.prepareRequest(ctx, server, reqBody)
 	if err != nil {
+		p.servers.release(server)
 		msg := stringtool.Cat("prepare request failed: ", err.Error())
 		logger.Errorf("BUG: %s", msg)
 		addTag("bug", msg)
@@ -161,6 +181,8 @@ func (p *pool) handle(ctx context.HTTPContext, reqBody io.Reader) string {
 
 	resp, span, err := p.doRequest(ctx, req)
 	if err != nil {
+		p.servers.release(server)
+
 		// NOTE: May add option to cancel the tracing if failed here.
 		// ctx.Span().Cancel()
 
@@ -172,11 +194,18 @@ func (p *pool) handle(ctx context.HTTPContext, reqBody io.Reader) string {
 			return resultClientError
 		}
 
+		p.servers.recordResult(server, false)
 		setStatusCode(http.StatusServiceUnavailable)
 		return resultServerError
 	}
 
 	addTag("code", strconv.Itoa(resp.StatusCode))
+	p.servers.recordResult(server, resp.StatusCode < http.StatusInternalServerError)
+
+	// NOTE: The request is in flight until its response body is read, so
+	// the server is released when the body is closed.
+	body := newReleasingBody(resp.Body, func() { p.servers.release(server) })
+	resp.Body = body
 
 	ctx.Lock()
 	defer ctx.Unlock()
@@ -185,6 +214,10 @@ func (p *pool) handle(ctx context.HTTPContext, reqBody io.Reader) string {
 	respBody := p.statRequestResponse(ctx, req, resp, span)
 
 	if p.writeResponse {
+		// NOTE: The body may be wrapped by the filters behind into a
+		// reader never closed, it's released when the response is sent.
+		ctx.OnFinish(body.release)
+
 		ctx.Response().SetStatusCode(resp.StatusCode)
 		ctx.Response().Header().AddFromStd(resp.Header)
 		ctx.Response().SetBody(respBody)
@@ -204,6 +237,108 @@ func (p *pool) handle(ctx context.HTTPContext, reqBody io.Reader) string {
 	return ""
 }
 
+// releasingBody is the response body releasing the server when it's
+// closed, the release runs only once.
+type releasingBody struct {
+	io.ReadCloser
+	once sync.Once
+	fn   func()
+}
+
+func newReleasingBody(body io.ReadCloser, fn func()) *releasingBody {
+	return &releasingBody{ReadCloser: body, fn: fn}
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
+
+func (b *releasingBody) release() {
+	b.once.Do(b.fn)
+}
+
+// mirror sends a duplicated request to the pool and discards the response.
+// The request is prepared synchronously but sent asynchronously without
+// touching the HTTPContext. The body is the slave of the primary request
+// body, whose reading blocks once the buffer of the slave is full, so the
+// body is always drained, even if the mirror is not sent, to never block
+// the primary request.
+func (p *pool) mirror(ctx context.HTTPContext, reqBody io.Reader) {
+	server, err := p.servers.next(ctx)
+	if err != nil {
+		go io.Copy(ioutil.Discard, reqBody)
+		return
+	}
+
+	r := ctx.Request()
+	url := server.URL + r.Path()
+	if r.Query() != "" {
+		url += "?" + r.Query()
+	}
+
+	// NOTE: The transport always closes the body, even if it fails.
+	body := &mirrorBody{r: reqBody}
+	stdr, err := http.NewRequest(r.Method(), url, body)
+	if err != nil {
+		p.servers.release(server)
+		body.Close()
+		logger.Errorf("BUG: new mirror request failed: %v", err)
+		return
+	}
+	stdr.Header = r.Header().Std().Clone()
+	stdr.Host = r.Host()
+
+	go func() {
+		defer p.servers.release(server)
+
+		resp, err := fnSendRequest(stdr, p.client)
+		if err != nil {
+			p.servers.recordResult(server, false)
+			return
+		}
+
+		p.servers.recordResult(server, resp.StatusCode < http.StatusInternalServerError)
+
+		defer resp.Body.Close()
+		io.Copy(ioutil.Discard, resp.Body)
+	}()
+}
+
+// mirrorBody is the body of the mirror request, it drains the rest of the
+// slave reader when closed.
+type mirrorBody struct {
+	mutex  sync.Mutex
+	r      io.Reader
+	closed bool
+}
+
+func (b *mirrorBody) Read(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closed {
+		return 0, io.EOF
+	}
+	return b.r.Read(p)
+}
+
+func (b *mirrorBody) Close() error {
+	b.mutex.Lock()
+	if b.closed {
+		b.mutex.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.mutex.Unlock()
+
+	// NOTE: The transport may close the body in its own goroutine while
+	// reading it, the closed flag makes sure it's not read concurrently.
+	go io.Copy(ioutil.Discard, b.r)
+	return nil
+}
+
 func (p *pool) prepareRequest(ctx context.HTTPContext, server *Server, reqBody io.Reader) (req *request, err error) {
 	return p.newRequest(ctx, server, reqBody)
 }
@@ -219,7 +354,7 @@ func (p *pool) doRequest(ctx context.HTTPContext, req *request) (*http.Response,
 	span := ctx.Span().NewChildWithStart(spanName, req.startTime())
 	span.Tracer().Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(req.std.Header))
 
-	resp, err := fnSendRequest(req.std)
+	resp, err := fnSendRequest(req.std, p.client)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -22,10 +22,11 @@ import (
 	"fmt"
 	"net"
 	"net/http"
-	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/httppipeline"
 	"github.com/megaease/easegress/pkg/util/fallback"
 )
@@ -82,8 +83,32 @@ var globalClient = &http.Client{
 	},
 }
 
-var fnSendRequest = func(r *http.Request) (*http.Response, error) {
-	return globalClient.Do(r)
+// newClient creates a client with its own connections, as they are bound to
+// the client certificate or limited by the connection pool.
+func newClient(m *MTLS, cp *ConnectionPool) (*http.Client, error) {
+	transport := globalClient.Transport.(*http.Transport).Clone()
+
+	if m != nil {
+		tlsConfig, err := m.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	if cp != nil {
+		cp.apply(transport)
+	}
+
+	return &http.Client{
+		Timeout:       globalClient.Timeout,
+		Transport:     transport,
+		CheckRedirect: globalClient.CheckRedirect,
+	}, nil
+}
+
+var fnSendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
+	return client.Do(r)
 }
 
 type (
@@ -99,6 +124,11 @@ type (
 		mirrorPool     *pool
 
 		compression *compression
+		client      *http.Client
+
+		// unmatched counts the requests routed to the main pool because
+		// they match none of the candidate pools.
+		unmatched uint64
 	}
 
 	// Spec describes the Proxy.
@@ -109,6 +139,13 @@ type (
 		MirrorPool     *PoolSpec        `yaml:"mirrorPool,omitempty" jsonschema:"omitempty"`
 		FailureCodes   []int            `yaml:"failureCodes" jsonschema:"omitempty,uniqueItems=true,format=httpcode-array"`
 		Compression    *CompressionSpec `yaml:"compression,omitempty" jsonschema:"omitempty"`
+		MTLS           *MTLS            `yaml:"mtls,omitempty" jsonschema:"omitempty"`
+		// ConnectionPool overrides the connection settings of the servers,
+		// the proxy uses its own connections if it's specified.
+		ConnectionPool *ConnectionPool `yaml:"connectionPool,omitempty" jsonschema:"omitempty"`
+		// CanaryBypassHeader forces the requests carrying it to the main pool,
+		// it beats all candidate pools and is removed before proxying.
+		CanaryBypassHeader string `yaml:"canaryBypassHeader,omitempty" jsonschema:"omitempty"`
 	}
 
 	// FallbackSpec describes the fallback policy.
@@ -122,6 +159,9 @@ type (
 		MainPool       *PoolStatus   `yaml:"mainPool"`
 		CandidatePools []*PoolStatus `yaml:"candidatePools,omitempty"`
 		MirrorPool     *PoolStatus   `yaml:"mirrorPool,omitempty"`
+		// Unmatched is the number of requests matching none of the
+		// candidate pools, the bypassed requests are excluded.
+		Unmatched uint64 `yaml:"unmatched,omitempty"`
 	}
 )
 
@@ -151,6 +191,9 @@ func (s Spec) Validate() error {
 		if s.MirrorPool.MemoryCache != nil {
 			return fmt.Errorf("memoryCache must be empty in mirrorPool")
 		}
+		if s.MirrorPool.RequestHeader != nil {
+			return fmt.Errorf("requestHeader must be empty in mirrorPool")
+		}
 	}
 
 	if len(s.FailureCodes) == 0 {
@@ -197,8 +240,19 @@ func (b *Proxy) Inherit(filterSpec *httppipeline.FilterSpec, previousGeneration
 func (b *Proxy) reload() {
 	super := b.filterSpec.Super()
 
+	b.client = globalClient
+	if b.spec.MTLS != nil || b.spec.ConnectionPool != nil {
+		// NOTE: The MTLS has been checked in Validate.
+		client, err := newClient(b.spec.MTLS, b.spec.ConnectionPool)
+		if err != nil {
+			logger.Errorf("BUG: create client failed: %v", err)
+		} else {
+			b.client = client
+		}
+	}
+
 	b.mainPool = newPool(super, b.spec.MainPool, "proxy#main",
-		true /*writeResponse*/, b.spec.FailureCodes)
+		true /*writeResponse*/, b.spec.FailureCodes, b.client)
 
 	if b.spec.Fallback != nil {
 		b.fallback = fallback.New(&b.spec.Fallback.Spec)
@@ -209,13 +263,13 @@ func (b *Proxy) reload() {
 		for k := range b.spec.CandidatePools {
 			candidatePools = append(candidatePools,
 				newPool(super, b.spec.CandidatePools[k], fmt.Sprintf("proxy#candidate#%d", k),
-					true, b.spec.FailureCodes))
+					true, b.spec.FailureCodes, b.client))
 		}
 		b.candidatePools = candidatePools
 	}
 	if b.spec.MirrorPool != nil {
 		b.mirrorPool = newPool(super, b.spec.MirrorPool, "proxy#mirror",
-			false /*writeResponse*/, b.spec.FailureCodes)
+			false /*writeResponse*/, b.spec.FailureCodes, b.client)
 	}
 
 	if b.spec.Compression != nil {
@@ -226,7 +280,8 @@ func (b *Proxy) reload() {
 // Status returns Proxy status.
 func (b *Proxy) Status() interface{} {
 	s := &Status{
-		MainPool: b.mainPool.status(),
+		MainPool:  b.mainPool.status(),
+		Unmatched: atomic.LoadUint64(&b.unmatched),
 	}
 	if b.candidatePools != nil {
 		for k := range b.candidatePools {
@@ -252,6 +307,10 @@ func (b *Proxy) Close() {
 	if b.mirrorPool != nil {
 		b.mirrorPool.close()
 	}
+
+	if b.client != nil && b.client != globalClient {
+		b.client.CloseIdleConnections()
+	}
 }
 
 func (b *Proxy) fallbackForCodes(ctx context.HTTPContext) bool {
@@ -273,22 +332,22 @@ func (b *Proxy) Handle(ctx context.HTTPContext) (result string) {
 }
 
 func (b *Proxy) handle(ctx context.HTTPContext) (result string) {
+	bypassCanary := false
+	if header := b.spec.CanaryBypassHeader; header != "" {
+		if len(ctx.Request().Header().GetAll(header)) != 0 {
+			bypassCanary = true
+			ctx.Request().Header().Del(header)
+		}
+	}
+
 	if b.mirrorPool != nil && b.mirrorPool.filter.Filter(ctx) {
 		master, slave := newMasterSlaveReader(ctx.Request().Body())
 		ctx.Request().SetBody(master)
-
-		wg := &sync.WaitGroup{}
-		wg.Add(1)
-		defer wg.Wait()
-
-		go func() {
-			defer wg.Done()
-			b.mirrorPool.handle(ctx, slave)
-		}()
+		b.mirrorPool.mirror(ctx, slave)
 	}
 
 	var p *pool
-	if len(b.candidatePools) > 0 {
+	if len(b.candidatePools) > 0 && !bypassCanary {
 		for k, v := range b.candidatePools {
 			if v.filter.Filter(ctx) {
 				p = b.candidatePools[k]
@@ -299,6 +358,13 @@ func (b *Proxy) handle(ctx context.HTTPContext) (result string) {
 
 	if p == nil {
 		p = b.mainPool
+		if len(b.candidatePools) > 0 && !bypassCanary {
+			atomic.AddUint64(&b.unmatched, 1)
+		}
+	}
+	atomic.AddUint64(&p.selections, 1)
+	if p.spec.RequestHeader != nil {
+		ctx.Request().Header().Adapt(p.spec.RequestHeader, ctx.Template())
 	}
 
 	if p.memoryCache != nil && p.memoryCache.Load(ctx) {
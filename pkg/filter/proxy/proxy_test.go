@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/megaease/easegress/pkg/context/contexttest"
@@ -30,6 +31,7 @@ import (
 	"github.com/megaease/easegress/pkg/util/httpfilter"
 	"github.com/megaease/easegress/pkg/util/httpheader"
 	"github.com/megaease/easegress/pkg/util/memorycache"
+	"github.com/megaease/easegress/pkg/util/texttemplate"
 	"github.com/megaease/easegress/pkg/util/yamltool"
 )
 
@@ -122,7 +124,7 @@ failureCodes: [503, 504]
 		t.Error("fallback for 500 should be false")
 	}
 
-	fnSendRequest = func(r *http.Request) (*http.Response, error) {
+	fnSendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
 		return &http.Response{
 			Body: io.NopCloser(strings.NewReader("this is the body")),
 		}, nil
@@ -133,7 +135,7 @@ failureCodes: [503, 504]
 	}
 	ctx.Finish()
 
-	fnSendRequest = func(r *http.Request) (*http.Response, error) {
+	fnSendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
 		return nil, fmt.Errorf("mocked error")
 	}
 	result = proxy.Handle(ctx)
@@ -146,6 +148,371 @@ failureCodes: [503, 504]
 	time.Sleep(10 * time.Millisecond)
 }
 
+func TestProxyMirror(t *testing.T) {
+	const yamlSpec = `
+name: proxy
+kind: Proxy
+mainPool:
+  servers:
+  - url: http://127.0.0.1:9095
+mirrorPool:
+  filter:
+    headers:
+      "X-Mirror":
+        exact: mirror
+  servers:
+  - url: http://127.0.0.3:9095
+`
+	rawSpec := make(map[string]interface{})
+	yamltool.Unmarshal([]byte(yamlSpec), &rawSpec)
+
+	spec, e := httppipeline.NewFilterSpec(rawSpec, nil)
+	if e != nil {
+		t.Fatalf("unexpected error: %v", e)
+	}
+
+	proxy := &Proxy{}
+	proxy.Init(spec)
+	defer proxy.Close()
+
+	mirrorDone := make(chan struct{})
+	mirrored := make(chan struct{}, 2)
+	oldSendRequest := fnSendRequest
+	defer func() {
+		fnSendRequest = oldSendRequest
+	}()
+	fnSendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
+		if r.URL.Host == "127.0.0.3:9095" {
+			mirrored <- struct{}{}
+			// the mirror is slow and fails finally
+			<-mirrorDone
+			return nil, fmt.Errorf("mocked mirror error")
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader("primary body")),
+		}, nil
+	}
+
+	var statusCode int
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+		header := http.Header{}
+		header.Set("X-Mirror", "mirror")
+		return httpheader.New(header)
+	}
+	ctx.MockedResponse.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(http.Header{})
+	}
+	ctx.MockedResponse.MockedSetStatusCode = func(code int) {
+		statusCode = code
+	}
+	ctx.MockedResponse.MockedStatusCode = func() int {
+		return statusCode
+	}
+
+	done := make(chan string)
+	go func() {
+		done <- proxy.Handle(ctx)
+	}()
+
+	select {
+	case result := <-done:
+		if result != "" || statusCode != http.StatusOK {
+			t.Errorf("primary response should not be changed, got result %q code %d", result, statusCode)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("primary request should not be blocked by the mirror")
+	}
+
+	select {
+	case <-mirrored:
+	case <-time.After(time.Second):
+		t.Errorf("request should be mirrored")
+	}
+	close(mirrorDone)
+}
+
+func TestPoolMirrorDrainsBody(t *testing.T) {
+	oldSendRequest := fnSendRequest
+	defer func() {
+		fnSendRequest = oldSendRequest
+	}()
+	// the mirror fails without reading the body
+	fnSendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
+		r.Body.Close()
+		return nil, fmt.Errorf("mocked mirror error")
+	}
+
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(http.Header{})
+	}
+
+	pools := map[string]*pool{
+		"no server": {
+			servers: &servers{static: newStaticServers(nil, nil, nil)},
+		},
+		"failed mirror": {
+			servers: &servers{static: newStaticServers([]*Server{
+				{URL: "http://127.0.0.3:9095"},
+			}, nil, nil)},
+		},
+	}
+
+	for name, p := range pools {
+		// NOTE: One byte per read makes more chunks than the buffer of the slave.
+		body := strings.Repeat("x", 64)
+		master, slave := newMasterSlaveReader(iotest.OneByteReader(strings.NewReader(body)))
+		p.mirror(ctx, slave)
+
+		done := make(chan string)
+		go func() {
+			buff, _ := io.ReadAll(master)
+			done <- string(buff)
+		}()
+
+		select {
+		case got := <-done:
+			if got != body {
+				t.Errorf("%s: want primary body %q, got %q", name, body, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: primary body should not be blocked by the mirror", name)
+		}
+	}
+}
+
+func TestProxyCanaryBypass(t *testing.T) {
+	const yamlSpec = `
+name: proxy
+kind: Proxy
+canaryBypassHeader: X-Canary-Bypass
+mainPool:
+  servers:
+  - url: http://127.0.0.1:9095
+candidatePools:
+- filter:
+    headers:
+      "X-Canary":
+        exact: lv1
+  servers:
+  - url: http://127.0.0.2:9095
+`
+	rawSpec := make(map[string]interface{})
+	yamltool.Unmarshal([]byte(yamlSpec), &rawSpec)
+
+	spec, e := httppipeline.NewFilterSpec(rawSpec, nil)
+	if e != nil {
+		t.Fatalf("unexpected error: %v", e)
+	}
+
+	proxy := &Proxy{}
+	proxy.Init(spec)
+	defer proxy.Close()
+
+	var sent *http.Request
+	oldSendRequest := fnSendRequest
+	defer func() {
+		fnSendRequest = oldSendRequest
+	}()
+	fnSendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
+		sent = r
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader("body")),
+		}, nil
+	}
+
+	newCtx := func(bypass bool) *contexttest.MockedHTTPContext {
+		header := http.Header{}
+		header.Set("X-Canary", "lv1")
+		if bypass {
+			header.Set("X-Canary-Bypass", "")
+		}
+		reqHeader := httpheader.New(header)
+
+		ctx := &contexttest.MockedHTTPContext{}
+		ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+			return reqHeader
+		}
+		ctx.MockedResponse.MockedHeader = func() *httpheader.HTTPHeader {
+			return httpheader.New(http.Header{})
+		}
+		return ctx
+	}
+
+	if result := proxy.Handle(newCtx(false)); result != "" {
+		t.Fatalf("proxy.Handle should succeed, got %q", result)
+	}
+	if sent.URL.Host != "127.0.0.2:9095" {
+		t.Errorf("request matching canary rule should go to candidate pool, got %s", sent.URL.Host)
+	}
+
+	if result := proxy.Handle(newCtx(true)); result != "" {
+		t.Fatalf("proxy.Handle should succeed, got %q", result)
+	}
+	if sent.URL.Host != "127.0.0.1:9095" {
+		t.Errorf("request with bypass header should go to main pool, got %s", sent.URL.Host)
+	}
+	if _, exists := sent.Header["X-Canary-Bypass"]; exists {
+		t.Errorf("bypass header should not be sent to backend")
+	}
+}
+
+func TestProxyPoolSelections(t *testing.T) {
+	const yamlSpec = `
+name: proxy
+kind: Proxy
+canaryBypassHeader: X-Canary-Bypass
+mainPool:
+  servers:
+  - url: http://127.0.0.1:9095
+candidatePools:
+- name: canary-rule-0
+  filter:
+    headers:
+      "X-Canary":
+        exact: lv1
+  servers:
+  - url: http://127.0.0.2:9095
+`
+	rawSpec := make(map[string]interface{})
+	yamltool.Unmarshal([]byte(yamlSpec), &rawSpec)
+
+	spec, e := httppipeline.NewFilterSpec(rawSpec, nil)
+	if e != nil {
+		t.Fatalf("unexpected error: %v", e)
+	}
+
+	proxy := &Proxy{}
+	proxy.Init(spec)
+	defer proxy.Close()
+
+	oldSendRequest := fnSendRequest
+	defer func() {
+		fnSendRequest = oldSendRequest
+	}()
+	fnSendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader("body")),
+		}, nil
+	}
+
+	handle := func(headers map[string]string) {
+		header := http.Header{}
+		for k, v := range headers {
+			header.Set(k, v)
+		}
+		reqHeader := httpheader.New(header)
+
+		ctx := &contexttest.MockedHTTPContext{}
+		ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+			return reqHeader
+		}
+		ctx.MockedResponse.MockedHeader = func() *httpheader.HTTPHeader {
+			return httpheader.New(http.Header{})
+		}
+		if result := proxy.Handle(ctx); result != "" {
+			t.Fatalf("proxy.Handle should succeed, got %q", result)
+		}
+	}
+
+	handle(map[string]string{"X-Canary": "lv1"})
+	handle(map[string]string{"X-Canary": "lv1"})
+	handle(map[string]string{"X-Canary": "lv2"})
+	handle(map[string]string{"X-Canary": "lv1", "X-Canary-Bypass": "true"})
+
+	status := proxy.Status().(*Status)
+	if status.CandidatePools[0].Name != "canary-rule-0" || status.CandidatePools[0].Selections != 2 {
+		t.Errorf("want 2 selections of canary-rule-0, got %+v", status.CandidatePools[0])
+	}
+	if status.MainPool.Selections != 2 {
+		t.Errorf("want 2 selections of main pool, got %d", status.MainPool.Selections)
+	}
+	if status.Unmatched != 1 {
+		t.Errorf("want 1 unmatched request, got %d", status.Unmatched)
+	}
+}
+
+func TestProxyPoolRequestHeader(t *testing.T) {
+	const yamlSpec = `
+name: proxy
+kind: Proxy
+mainPool:
+  servers:
+  - url: http://127.0.0.1:9095
+candidatePools:
+- filter:
+    headers:
+      "X-Canary":
+        exact: lv1
+  requestHeader:
+    set:
+      X-Env: canary
+  servers:
+  - url: http://127.0.0.2:9095
+`
+	rawSpec := make(map[string]interface{})
+	yamltool.Unmarshal([]byte(yamlSpec), &rawSpec)
+
+	spec, e := httppipeline.NewFilterSpec(rawSpec, nil)
+	if e != nil {
+		t.Fatalf("unexpected error: %v", e)
+	}
+
+	proxy := &Proxy{}
+	proxy.Init(spec)
+	defer proxy.Close()
+
+	var sent *http.Request
+	oldSendRequest := fnSendRequest
+	defer func() {
+		fnSendRequest = oldSendRequest
+	}()
+	fnSendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
+		sent = r
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader("body")),
+		}, nil
+	}
+
+	handle := func(canary string) {
+		header := http.Header{}
+		header.Set("X-Canary", canary)
+		reqHeader := httpheader.New(header)
+
+		ctx := &contexttest.MockedHTTPContext{}
+		ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+			return reqHeader
+		}
+		ctx.MockedResponse.MockedHeader = func() *httpheader.HTTPHeader {
+			return httpheader.New(http.Header{})
+		}
+		ctx.MockedTemplate = func() texttemplate.TemplateEngine {
+			return texttemplate.NewDummyTemplate()
+		}
+		if result := proxy.Handle(ctx); result != "" {
+			t.Fatalf("proxy.Handle should succeed, got %q", result)
+		}
+	}
+
+	handle("lv1")
+	if sent.URL.Host != "127.0.0.2:9095" || sent.Header.Get("X-Env") != "canary" {
+		t.Errorf("canary request should carry X-Env: canary, got host %s header %v", sent.URL.Host, sent.Header)
+	}
+
+	handle("lv2")
+	if sent.URL.Host != "127.0.0.1:9095" {
+		t.Errorf("request should go to main pool, got %s", sent.URL.Host)
+	}
+	if _, exists := sent.Header["X-Env"]; exists {
+		t.Errorf("main request should not carry X-Env, got %v", sent.Header)
+	}
+}
+
 func TestSpecValidate(t *testing.T) {
 	spec := Spec{}
 
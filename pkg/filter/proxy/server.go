@@ -43,6 +43,10 @@ const (
 	PolicyIPHash = "ipHash"
 	// PolicyHeaderHash is the policy of header hash.
 	PolicyHeaderHash = "headerHash"
+	// PolicyConsistentHash is the policy of consistent hash with bounded load.
+	PolicyConsistentHash = "consistentHash"
+	// PolicyLeastRequest is the policy of the fewest in-flight requests.
+	PolicyLeastRequest = "leastRequest"
 
 	retryTimeout = 3 * time.Second
 )
@@ -57,6 +61,11 @@ type (
 		serviceWatcher  serviceregistry.ServiceWatcher
 		static          *staticServers
 		done            chan struct{}
+
+		// healthy is the cache of static servers excluding the ejected ones,
+		// nil means it needs to be rebuilt.
+		healthy  *staticServers
+		detector *outlierDetector
 	}
 
 	staticServers struct {
@@ -64,10 +73,15 @@ type (
 		weightsSum int
 		servers    []*Server
 		lb         LoadBalance
+		ring       *hashRing
 	}
 
 	// Server is proxy server.
 	Server struct {
+		// inflight is the number of requests in flight, it's the first
+		// field to keep it 64-bit aligned for atomic operations.
+		inflight int64
+
 		URL    string   `yaml:"url" jsonschema:"required,format=url"`
 		Tags   []string `yaml:"tags" jsonschema:"omitempty,uniqueItems=true"`
 		Weight int      `yaml:"weight" jsonschema:"omitempty,minimum=0,maximum=100"`
@@ -75,8 +89,16 @@ type (
 
 	// LoadBalance is load balance for multiple servers.
 	LoadBalance struct {
-		Policy        string `yaml:"policy" jsonschema:"required,enum=roundRobin,enum=random,enum=weightedRandom,enum=ipHash,enum=headerHash"`
+		Policy        string `yaml:"policy" jsonschema:"required,enum=roundRobin,enum=random,enum=weightedRandom,enum=ipHash,enum=headerHash,enum=consistentHash,enum=leastRequest"`
 		HeaderHashKey string `yaml:"headerHashKey" jsonschema:"omitempty"`
+
+		// HashSource is where the key of consistent hash comes from, it's
+		// the header or cookie named HashKey, or the client IP by default.
+		HashSource string `yaml:"hashSource,omitempty" jsonschema:"omitempty,enum=,enum=header,enum=cookie,enum=ip"`
+		HashKey    string `yaml:"hashKey,omitempty" jsonschema:"omitempty"`
+		// LoadFactor bounds the in-flight requests of every server to
+		// LoadFactor times the average, default is DefaultLoadFactor.
+		LoadFactor float64 `yaml:"loadFactor,omitempty" jsonschema:"omitempty"`
 	}
 )
 
@@ -90,6 +112,15 @@ func (lb LoadBalance) Validate() error {
 		return fmt.Errorf("headerHash needs to specify headerHashKey")
 	}
 
+	if lb.Policy == PolicyConsistentHash {
+		if (lb.HashSource == HashSourceHeader || lb.HashSource == HashSourceCookie) && lb.HashKey == "" {
+			return fmt.Errorf("consistentHash with %s hash source needs to specify hashKey", lb.HashSource)
+		}
+		if lb.LoadFactor != 0 && lb.LoadFactor < 1 {
+			return fmt.Errorf("loadFactor %v must not be less than 1", lb.LoadFactor)
+		}
+	}
+
 	return nil
 }
 
@@ -102,6 +133,11 @@ func newServers(super *supervisor.Supervisor, poolSpec *PoolSpec) *servers {
 
 	s.useStaticServers()
 
+	if poolSpec.OutlierDetection != nil {
+		s.detector = newOutlierDetector(poolSpec.OutlierDetection)
+		go s.detectOutliers()
+	}
+
 	if poolSpec.ServiceRegistry == "" || poolSpec.ServiceName == "" {
 		return s
 	}
@@ -173,12 +209,14 @@ func (s *servers) useService(serviceInstanceSpecs map[string]*serviceregistry.Se
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	s.static = dynamicServers
+	s.healthy = nil
 }
 
 func (s *servers) useStaticServers() {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	s.static = newStaticServers(s.poolSpec.Servers, s.poolSpec.ServersTags, s.poolSpec.LoadBalance)
+	s.healthy = nil
 }
 
 func (s *servers) snapshot() *staticServers {
@@ -188,6 +226,63 @@ func (s *servers) snapshot() *staticServers {
 	return s.static
 }
 
+func (s *servers) healthySnapshot() *staticServers {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.healthy == nil {
+		servers := make([]*Server, 0, len(s.static.servers))
+		for _, server := range s.static.servers {
+			if !s.detector.isEjected(server.URL) {
+				servers = append(servers, server)
+			}
+		}
+		if len(servers) == 0 {
+			servers = s.static.servers
+		}
+		s.healthy = newStaticServers(servers, nil, &s.static.lb)
+	}
+
+	return s.healthy
+}
+
+func (s *servers) detectOutliers() {
+	ticker := time.NewTicker(s.detector.interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			static := s.snapshot()
+			urls := make([]string, 0, len(static.servers))
+			for _, server := range static.servers {
+				urls = append(urls, server.URL)
+			}
+
+			if s.detector.evaluate(urls) {
+				s.mutex.Lock()
+				s.healthy = nil
+				s.mutex.Unlock()
+			}
+		}
+	}
+}
+
+// recordResult records the result of the request for outlier detection.
+func (s *servers) recordResult(server *Server, success bool) {
+	if s.detector == nil {
+		return
+	}
+
+	if s.detector.record(server.URL, success, s.len()) {
+		s.mutex.Lock()
+		s.healthy = nil
+		s.mutex.Unlock()
+	}
+}
+
 func (s *servers) len() int {
 	static := s.snapshot()
 
@@ -196,12 +291,22 @@ func (s *servers) len() int {
 
 func (s *servers) next(ctx context.HTTPContext) (*Server, error) {
 	static := s.snapshot()
+	if s.detector != nil {
+		static = s.healthySnapshot()
+	}
 
 	if static.len() == 0 {
 		return nil, fmt.Errorf("no server available")
 	}
 
-	return static.next(ctx), nil
+	server := static.next(ctx)
+	atomic.AddInt64(&server.inflight, 1)
+	return server, nil
+}
+
+// release marks a request to the server returned by next as finished.
+func (s *servers) release(server *Server) {
+	atomic.AddInt64(&server.inflight, -1)
 }
 
 func (s *servers) close() {
@@ -249,6 +354,10 @@ func (ss *staticServers) prepare() {
 	for _, server := range ss.servers {
 		ss.weightsSum += server.Weight
 	}
+
+	if ss.lb.Policy == PolicyConsistentHash {
+		ss.ring = newHashRing(ss.servers)
+	}
 }
 
 func (ss *staticServers) len() int {
@@ -267,6 +376,10 @@ func (ss *staticServers) next(ctx context.HTTPContext) *Server {
 		return ss.ipHash(ctx)
 	case PolicyHeaderHash:
 		return ss.headerHash(ctx)
+	case PolicyConsistentHash:
+		return ss.consistentHash(ctx)
+	case PolicyLeastRequest:
+		return ss.leastRequest(ctx)
 	}
 
 	logger.Errorf("BUG: unknown load balance policy: %s", ss.lb.Policy)
@@ -300,6 +413,30 @@ func (ss *staticServers) weightedRandom(ctx context.HTTPContext) *Server {
 	return ss.random(ctx)
 }
 
+// leastRequest picks the server with the fewest in-flight requests, the
+// ties are broken randomly.
+func (ss *staticServers) leastRequest(ctx context.HTTPContext) *Server {
+	var (
+		chosen *Server
+		least  int64
+		ties   int
+	)
+	for _, server := range ss.servers {
+		inflight := atomic.LoadInt64(&server.inflight)
+		switch {
+		case chosen == nil || inflight < least:
+			chosen, least, ties = server, inflight, 1
+		case inflight == least:
+			ties++
+			if rand.Intn(ties) == 0 {
+				chosen = server
+			}
+		}
+	}
+
+	return chosen
+}
+
 func (ss *staticServers) ipHash(ctx context.HTTPContext) *Server {
 	sum32 := int(hashtool.Hash32(ctx.Request().RealIP()))
 	return ss.servers[sum32%len(ss.servers)]
@@ -19,9 +19,11 @@ package proxy
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/megaease/easegress/pkg/context/contexttest"
@@ -407,3 +409,69 @@ func TestDynamicService(t *testing.T) {
 		t.Fatalf("want: %+v\ngot :%+v\n", wantStatic, s.static)
 	}
 }
+
+func TestLeastRequest(t *testing.T) {
+	fast := &Server{URL: "http://127.0.0.1:9091"}
+	slow := &Server{URL: "http://127.0.0.1:9092"}
+	s := newServers(nil, &PoolSpec{
+		Servers:     []*Server{fast, slow},
+		LoadBalance: &LoadBalance{Policy: PolicyLeastRequest},
+	})
+	defer s.close()
+
+	ctx := &contexttest.MockedHTTPContext{}
+
+	// The slow server holds every request it gets, while the fast one
+	// finishes them at once, so the requests skew toward the fast one.
+	picked := map[*Server]int{}
+	for i := 0; i < 100; i++ {
+		server, err := s.next(ctx)
+		if err != nil {
+			t.Fatalf("next failed: %v", err)
+		}
+		picked[server]++
+		if server == fast {
+			s.release(server)
+		}
+	}
+	if picked[slow] != 1 || picked[fast] != 99 {
+		t.Errorf("want 99 requests to the fast server and 1 to the slow, got %d and %d",
+			picked[fast], picked[slow])
+	}
+
+	// Ties are broken randomly.
+	slow.inflight = 0
+	picked = map[*Server]int{}
+	for i := 0; i < 100; i++ {
+		server, _ := s.next(ctx)
+		picked[server]++
+		s.release(server)
+	}
+	if picked[fast] == 0 || picked[slow] == 0 {
+		t.Errorf("ties should be broken randomly, got %d and %d", picked[fast], picked[slow])
+	}
+}
+
+func TestReleasingBody(t *testing.T) {
+	server := &Server{URL: "http://127.0.0.1:9091"}
+	s := newServers(nil, &PoolSpec{
+		Servers:     []*Server{server},
+		LoadBalance: &LoadBalance{Policy: PolicyLeastRequest},
+	})
+	defer s.close()
+
+	s.next(&contexttest.MockedHTTPContext{})
+	body := newReleasingBody(ioutil.NopCloser(strings.NewReader("body")), func() { s.release(server) })
+
+	// The request is in flight until its body is closed.
+	ioutil.ReadAll(body)
+	if server.inflight != 1 {
+		t.Errorf("want 1 request in flight before the body is closed, got %d", server.inflight)
+	}
+
+	body.Close()
+	body.release()
+	if server.inflight != 0 {
+		t.Errorf("want no request in flight after the body is closed, got %d", server.inflight)
+	}
+}
@@ -21,6 +21,8 @@ import (
 	"fmt"
 	"net/http"
 	"reflect"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/megaease/easegress/pkg/context"
@@ -36,7 +38,13 @@ const (
 	resultRateLimited = "rateLimited"
 )
 
-var results = []string{resultRateLimited}
+var (
+	results = []string{resultRateLimited}
+
+	// sharedRateLimiters is keyed by the shared key and the policy name.
+	sharedRateLimiters      = map[string]*sharedRateLimiter{}
+	sharedRateLimitersMutex sync.Mutex
+)
 
 func init() {
 	httppipeline.Register(&RateLimiter{})
@@ -49,6 +57,8 @@ type (
 		TimeoutDuration    string `yaml:"timeoutDuration" jsonschema:"omitempty,format=duration"`
 		LimitRefreshPeriod string `yaml:"limitRefreshPeriod" jsonschema:"omitempty,format=duration"`
 		LimitForPeriod     int    `yaml:"limitForPeriod" jsonschema:"omitempty,minimum=1"`
+		// Algorithm is tokenBucket by default.
+		Algorithm string `yaml:"algorithm" jsonschema:"omitempty,enum=,enum=tokenBucket,enum=fixedWindow,enum=slidingLog"`
 	}
 
 	// URLRule defines the rate limiter rule for a URL pattern
@@ -56,6 +66,21 @@ type (
 		urlrule.URLRule `yaml:",inline"`
 		policy          *Policy
 		rl              *librl.RateLimiter
+		retryAfter      string
+	}
+
+	sharedRateLimiter struct {
+		policy   librl.Policy
+		adaptive *Adaptive
+		rl       *librl.RateLimiter
+	}
+
+	// Adaptive defines the adaptive rate limiting based on backend latency,
+	// the limit for period of the policies is the upper bound.
+	Adaptive struct {
+		TargetLatency string `yaml:"targetLatency" jsonschema:"required,format=duration"`
+		Step          int    `yaml:"step" jsonschema:"omitempty,minimum=1"`
+		AdjustPeriod  string `yaml:"adjustPeriod" jsonschema:"omitempty,format=duration"`
 	}
 
 	// Spec is the configuration of a rate limiter
@@ -63,6 +88,11 @@ type (
 		Policies         []*Policy  `yaml:"policies" jsonschema:"required"`
 		DefaultPolicyRef string     `yaml:"defaultPolicyRef" jsonschema:"omitempty"`
 		URLs             []*URLRule `yaml:"urls" jsonschema:"required"`
+		Adaptive         *Adaptive  `yaml:"adaptive,omitempty" jsonschema:"omitempty"`
+
+		// SharedKey shares the rate limiters among the filters with the same
+		// key, the URL rules referring to the same policy use one limiter.
+		SharedKey string `yaml:"sharedKey,omitempty" jsonschema:"omitempty"`
 	}
 
 	// RateLimiter defines the rate limiter
@@ -93,9 +123,34 @@ URLLoop:
 	return nil
 }
 
-func (url *URLRule) createRateLimiter() {
+func (a *Adaptive) policy() *librl.AdaptivePolicy {
+	policy := &librl.AdaptivePolicy{
+		Step: a.Step,
+	}
+
+	policy.TargetLatency, _ = time.ParseDuration(a.TargetLatency)
+
+	if policy.Step == 0 {
+		policy.Step = 5
+	}
+
+	if d := a.AdjustPeriod; d != "" {
+		policy.AdjustPeriod, _ = time.ParseDuration(d)
+	} else {
+		policy.AdjustPeriod = time.Second
+	}
+
+	return policy
+}
+
+func (url *URLRule) createRateLimiter(adaptive *Adaptive, sharedKey string) {
 	policy := librl.Policy{
 		LimitForPeriod: url.policy.LimitForPeriod,
+		Algorithm:      url.policy.Algorithm,
+	}
+
+	if policy.Algorithm == "" {
+		policy.Algorithm = librl.AlgorithmTokenBucket
 	}
 
 	if policy.LimitForPeriod == 0 {
@@ -114,7 +169,45 @@ func (url *URLRule) createRateLimiter() {
 		policy.LimitRefreshPeriod = 10 * time.Millisecond
 	}
 
+	// NOTE: The client should retry after at least one refresh period.
+	retryAfter := int((policy.LimitRefreshPeriod + time.Second - 1) / time.Second)
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	url.retryAfter = strconv.Itoa(retryAfter)
+
+	if sharedKey != "" {
+		url.rl = getSharedRateLimiter(sharedKey+"/"+url.policy.Name, &policy, adaptive)
+		return
+	}
+
 	url.rl = librl.New(&policy)
+	if adaptive != nil {
+		url.rl.SetAdaptivePolicy(adaptive.policy())
+	}
+}
+
+// getSharedRateLimiter returns the rate limiter of the key, it creates a
+// new one if the key is absent or the policy changed.
+func getSharedRateLimiter(key string, policy *librl.Policy, adaptive *Adaptive) *librl.RateLimiter {
+	sharedRateLimitersMutex.Lock()
+	defer sharedRateLimitersMutex.Unlock()
+
+	shared := sharedRateLimiters[key]
+	if shared != nil && reflect.DeepEqual(shared.policy, *policy) && reflect.DeepEqual(shared.adaptive, adaptive) {
+		return shared.rl
+	}
+
+	rl := librl.New(policy)
+	if adaptive != nil {
+		rl.SetAdaptivePolicy(adaptive.policy())
+	}
+	sharedRateLimiters[key] = &sharedRateLimiter{
+		policy:   *policy,
+		adaptive: adaptive,
+		rl:       rl,
+	}
+	return rl
 }
 
 // Kind returns the kind of RateLimiter.
@@ -165,7 +258,7 @@ func (rl *RateLimiter) bindPolicyToURL(u *URLRule) {
 func (rl *RateLimiter) createRateLimiterForURL(u *URLRule) {
 	u.Init()
 	rl.bindPolicyToURL(u)
-	u.createRateLimiter()
+	u.createRateLimiter(rl.spec.Adaptive, rl.spec.SharedKey)
 	rl.setStateListenerForURL(u)
 }
 
@@ -192,6 +285,10 @@ func isSamePolicy(spec1, spec2 *Spec, policyName string) bool {
 		}
 	}
 
+	if !reflect.DeepEqual(spec1.Adaptive, spec2.Adaptive) {
+		return false
+	}
+
 	return reflect.DeepEqual(p1, p2)
 }
 
@@ -212,10 +309,13 @@ OuterLoop:
 			if !isSamePolicy(rl.spec, previousGeneration.spec, url.PolicyRef) {
 				continue
 			}
+			if rl.spec.SharedKey != previousGeneration.spec.SharedKey {
+				continue
+			}
 
 			url.Init()
 			rl.bindPolicyToURL(url)
-			url.rl = prev.rl
+			url.rl, url.retryAfter = prev.rl, prev.retryAfter
 			prev.rl = nil
 			rl.setStateListenerForURL(url)
 			continue OuterLoop
@@ -238,11 +338,20 @@ func (rl *RateLimiter) Inherit(filterSpec *httppipeline.FilterSpec, previousGene
 
 // Handle handles HTTP request
 func (rl *RateLimiter) Handle(ctx context.HTTPContext) string {
-	result := rl.handle(ctx)
-	return ctx.CallNextHandler(result)
+	result, u := rl.handle(ctx)
+	if result != "" || u == nil || rl.spec.Adaptive == nil {
+		return ctx.CallNextHandler(result)
+	}
+
+	// NOTE: The latency of the following handlers is the backend latency
+	// observed by the adaptive rate limiting.
+	startTime := time.Now()
+	result = ctx.CallNextHandler(result)
+	u.rl.Observe(time.Since(startTime))
+	return result
 }
 
-func (rl *RateLimiter) handle(ctx context.HTTPContext) string {
+func (rl *RateLimiter) handle(ctx context.HTTPContext) (string, *URLRule) {
 	for _, u := range rl.spec.URLs {
 		if !u.Match(ctx.Request()) {
 			continue
@@ -253,24 +362,25 @@ func (rl *RateLimiter) handle(ctx context.HTTPContext) string {
 			ctx.AddTag("rateLimiter: too many requests")
 			ctx.Response().SetStatusCode(http.StatusTooManyRequests)
 			ctx.Response().Std().Header().Set("X-EG-Rate-Limiter", "too-many-requests")
-			return resultRateLimited
+			ctx.Response().Std().Header().Set("Retry-After", u.retryAfter)
+			return resultRateLimited, u
 		}
 
 		if d <= 0 {
-			break
+			return "", u
 		}
 
 		timer := time.NewTimer(d)
 		select {
 		case <-ctx.Done():
 			timer.Stop()
-			return ""
+			return "", nil
 		case <-timer.C:
 			ctx.AddTag(fmt.Sprintf("rateLimiter: waiting duration: %s", d.String()))
-			return ""
+			return "", u
 		}
 	}
-	return ""
+	return "", nil
 }
 
 // Status returns Status generated by Runtime.
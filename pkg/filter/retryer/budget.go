@@ -0,0 +1,100 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package retryer
+
+import (
+	"sync"
+	"time"
+)
+
+// for unit testing cases to mock 'time.Now' only
+var nowFunc = time.Now
+
+type (
+	// Budget limits the retries to a ratio of the requests in a window,
+	// to prevent the retries from amplifying the load during an incident.
+	Budget struct {
+		MaxRetryRatio float64 `yaml:"maxRetryRatio" jsonschema:"required,minimum=0,maximum=1"`
+		Window        string  `yaml:"window" jsonschema:"omitempty,format=duration"`
+	}
+
+	retryBudget struct {
+		mutex       sync.Mutex
+		ratio       float64
+		window      time.Duration
+		windowStart time.Time
+		requests    int
+		retries     int
+		exhausted   uint64
+	}
+)
+
+func newRetryBudget(b *Budget) *retryBudget {
+	window := 10 * time.Second
+	if b.Window != "" {
+		window, _ = time.ParseDuration(b.Window)
+	}
+
+	return &retryBudget{
+		ratio:       b.MaxRetryRatio,
+		window:      window,
+		windowStart: nowFunc(),
+	}
+}
+
+// roll starts a new window if the current one has elapsed, it must be called
+// with the mutex held.
+func (rb *retryBudget) roll() {
+	now := nowFunc()
+	if now.Sub(rb.windowStart) < rb.window {
+		return
+	}
+
+	rb.windowStart = now
+	rb.requests = 0
+	rb.retries = 0
+}
+
+func (rb *retryBudget) recordRequest() {
+	rb.mutex.Lock()
+	defer rb.mutex.Unlock()
+
+	rb.roll()
+	rb.requests++
+}
+
+// acquireRetry returns true if the retry is in the budget.
+func (rb *retryBudget) acquireRetry() bool {
+	rb.mutex.Lock()
+	defer rb.mutex.Unlock()
+
+	rb.roll()
+	if float64(rb.retries+1) > rb.ratio*float64(rb.requests) {
+		rb.exhausted++
+		return false
+	}
+
+	rb.retries++
+	return true
+}
+
+func (rb *retryBudget) exhaustedCount() uint64 {
+	rb.mutex.Lock()
+	defer rb.mutex.Unlock()
+	return rb.exhausted
+}
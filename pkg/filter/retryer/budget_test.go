@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package retryer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryBudget(t *testing.T) {
+	now := time.Now()
+	nowFunc = func() time.Time {
+		return now
+	}
+	defer func() {
+		nowFunc = time.Now
+	}()
+
+	rb := newRetryBudget(&Budget{MaxRetryRatio: 0.2, Window: "1s"})
+	for i := 0; i < 10; i++ {
+		rb.recordRequest()
+	}
+
+	for i := 0; i < 2; i++ {
+		if !rb.acquireRetry() {
+			t.Errorf("retry %d should be in the budget", i)
+		}
+	}
+	if rb.acquireRetry() {
+		t.Errorf("retry should be rejected after the budget is exhausted")
+	}
+	if n := rb.exhaustedCount(); n != 1 {
+		t.Errorf("want exhausted count 1, got %d", n)
+	}
+
+	now = now.Add(time.Second)
+	rb.recordRequest()
+	if rb.acquireRetry() {
+		t.Errorf("retry should be rejected in a new window without enough requests")
+	}
+	for i := 0; i < 4; i++ {
+		rb.recordRequest()
+	}
+	if !rb.acquireRetry() {
+		t.Errorf("retry should be in the budget of the new window")
+	}
+	if n := rb.exhaustedCount(); n != 2 {
+		t.Errorf("want exhausted count 2, got %d", n)
+	}
+}
@@ -22,6 +22,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math/rand"
+	"net/http"
+	"reflect"
 	"strings"
 	"time"
 
@@ -34,6 +36,10 @@ import (
 const (
 	// Kind is the kind of Retryer.
 	Kind = "Retryer"
+
+	// DefaultIdempotencyKeyHeader is the default header marking
+	// the requests of non-idempotent methods as safe to retry.
+	DefaultIdempotencyKeyHeader = "Idempotency-Key"
 )
 
 var results = []string{}
@@ -69,12 +75,32 @@ type (
 		Policies         []*Policy  `yaml:"policies" jsonschema:"required"`
 		DefaultPolicyRef string     `yaml:"defaultPolicyRef" jsonschema:"omitempty"`
 		URLs             []*URLRule `yaml:"urls" jsonschema:"required"`
+		Budget           *Budget    `yaml:"budget,omitempty" jsonschema:"omitempty"`
+
+		// RetryOnStatusCodes limits the retries to the failures with these
+		// status codes, empty means all failures of the policy are retried.
+		RetryOnStatusCodes []int `yaml:"retryOnStatusCodes,omitempty" jsonschema:"omitempty,uniqueItems=true,format=httpcode-array"`
+		// RetryNonIdempotent retries the requests of non-idempotent methods
+		// such as POST, which are only retried when they carry the
+		// idempotency key header by default.
+		RetryNonIdempotent bool `yaml:"retryNonIdempotent,omitempty" jsonschema:"omitempty"`
+		// IdempotencyKeyHeader is the header marking the requests of
+		// non-idempotent methods as safe to retry, default is Idempotency-Key.
+		IdempotencyKeyHeader string `yaml:"idempotencyKeyHeader,omitempty" jsonschema:"omitempty"`
 	}
 
 	// Retryer is the struct of retryer
 	Retryer struct {
 		filterSpec *httppipeline.FilterSpec
 		spec       *Spec
+		budget     *retryBudget
+	}
+
+	// Status is the status of Retryer.
+	Status struct {
+		// BudgetExhausted is the number of retries skipped
+		// because the retry budget was exhausted.
+		BudgetExhausted uint64 `yaml:"budgetExhausted"`
 	}
 )
 
@@ -104,6 +130,41 @@ URLLoop:
 	return nil
 }
 
+// retryable returns whether the request of the method could be retried,
+// the requests of non-idempotent methods are only retried with the
+// idempotency key.
+func (spec *Spec) retryable(method, idempotencyKey string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return spec.RetryNonIdempotent || idempotencyKey != ""
+}
+
+// retryOn returns whether the failure with the status code could be retried.
+func (spec *Spec) retryOn(statusCode int) bool {
+	if len(spec.RetryOnStatusCodes) == 0 {
+		return true
+	}
+
+	for _, c := range spec.RetryOnStatusCodes {
+		if statusCode == c {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (spec *Spec) idempotencyKeyHeader() string {
+	if spec.IdempotencyKeyHeader != "" {
+		return spec.IdempotencyKeyHeader
+	}
+	return DefaultIdempotencyKeyHeader
+}
+
 // Kind returns the kind of Retryer.
 func (r *Retryer) Kind() string {
 	return Kind
@@ -165,18 +226,35 @@ func (r *Retryer) Init(filterSpec *httppipeline.FilterSpec) {
 	for _, url := range r.spec.URLs {
 		r.initURL(url)
 	}
+	if r.spec.Budget != nil {
+		r.budget = newRetryBudget(r.spec.Budget)
+	}
 }
 
 // Inherit inherits previous generation of Retryer.
 func (r *Retryer) Inherit(filterSpec *httppipeline.FilterSpec, previousGeneration httppipeline.Filter) {
 	r.Init(filterSpec)
+
+	prev := previousGeneration.(*Retryer)
+	if r.budget != nil && reflect.DeepEqual(r.spec.Budget, prev.spec.Budget) {
+		r.budget = prev.budget
+	}
 }
 
 func (r *Retryer) handle(ctx context.HTTPContext, u *URLRule) string {
 	attempt := 0
 	base := float64(u.policy.waitDuration)
 
-	data, _ := ioutil.ReadAll(ctx.Request().Body())
+	if r.budget != nil {
+		r.budget.recordRequest()
+	}
+
+	req := ctx.Request()
+	if !r.spec.retryable(req.Method(), req.Header().Get(r.spec.idempotencyKeyHeader())) {
+		return ctx.CallNextHandler("")
+	}
+
+	data, _ := ioutil.ReadAll(req.Body())
 	for {
 		attempt++
 		ctx.Request().SetBody(bytes.NewReader(data))
@@ -208,12 +286,23 @@ func (r *Retryer) handle(ctx context.HTTPContext, u *URLRule) string {
 			result,
 		)
 
+		if !r.spec.retryOn(statusCode) {
+			ctx.AddTag(fmt.Sprintf("retryer: status code %d is not retried", statusCode))
+			return result
+		}
+
 		if attempt == u.policy.MaxAttempts {
 			ctx.AddTag(fmt.Sprintf("retryer: failed after %d attempts", attempt))
 			ctx.Response().Std().Header().Set("X-EG-Retryer", fmt.Sprintf("Failed-after-%d-attempts", attempt))
 			return result
 		}
 
+		if r.budget != nil && !r.budget.acquireRetry() {
+			ctx.AddTag(fmt.Sprintf("retryer: retry budget exhausted after %d attempts", attempt))
+			ctx.Response().Std().Header().Set("X-EG-Retryer", "Retry-budget-exhausted")
+			return result
+		}
+
 		delta := base * u.policy.RandomizationFactor
 		d := base - delta + float64(rand.Intn(int(delta*2+1)))
 		timer := time.NewTimer(time.Duration(d))
@@ -243,7 +332,13 @@ func (r *Retryer) Handle(ctx context.HTTPContext) string {
 
 // Status returns Status generated by Runtime.
 func (r *Retryer) Status() interface{} {
-	return nil
+	if r.budget == nil {
+		return nil
+	}
+
+	return &Status{
+		BudgetExhausted: r.budget.exhaustedCount(),
+	}
 }
 
 // Close closes Retryer.
@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package retryer
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/yamltool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newTestRetryer(t *testing.T, yamlSpec string) *Retryer {
+	rawSpec := make(map[string]interface{})
+	yamltool.Unmarshal([]byte(yamlSpec), &rawSpec)
+
+	spec, err := httppipeline.NewFilterSpec(rawSpec, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	r := &Retryer{}
+	r.Init(spec)
+	return r
+}
+
+func TestRetryerRetryOnAndIdempotency(t *testing.T) {
+	r := newTestRetryer(t, `
+kind: Retryer
+name: retryer
+policies:
+- name: default
+  maxAttempts: 3
+  waitDuration: 1ms
+  failureStatusCodes: [500, 502, 503, 504]
+defaultPolicyRef: default
+urls:
+- url:
+    prefix: /
+retryOnStatusCodes: [502, 503, 504]
+`)
+
+	attempts := func(method string, statusCode int, header http.Header) int {
+		n := 0
+		ctx := &contexttest.MockedHTTPContext{}
+		ctx.MockedRequest.MockedMethod = func() string {
+			return method
+		}
+		ctx.MockedRequest.MockedPath = func() string {
+			return "/orders"
+		}
+		ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+			return httpheader.New(header)
+		}
+		ctx.MockedRequest.MockedBody = func() io.Reader {
+			return strings.NewReader("")
+		}
+		ctx.MockedResponse.MockedStd = func() http.ResponseWriter {
+			return httptest.NewRecorder()
+		}
+		ctx.MockedResponse.MockedStatusCode = func() int {
+			return statusCode
+		}
+		ctx.MockedCallNextHandler = func(lastResult string) string {
+			n++
+			return lastResult
+		}
+		r.Handle(ctx)
+		return n
+	}
+
+	methods := []struct {
+		method     string
+		idempotent bool
+	}{
+		{http.MethodGet, true},
+		{http.MethodHead, true},
+		{http.MethodPut, true},
+		{http.MethodDelete, true},
+		{http.MethodPost, false},
+		{http.MethodPatch, false},
+	}
+	statusCodes := []struct {
+		code  int
+		retry bool
+	}{
+		{http.StatusInternalServerError, false},
+		{http.StatusBadGateway, true},
+		{http.StatusServiceUnavailable, true},
+		{http.StatusGatewayTimeout, true},
+	}
+
+	for _, m := range methods {
+		for _, c := range statusCodes {
+			want := 1
+			if m.idempotent && c.retry {
+				want = 3
+			}
+			if got := attempts(m.method, c.code, http.Header{}); got != want {
+				t.Errorf("%s with %d: want %d attempts, got %d", m.method, c.code, want, got)
+			}
+
+			want = 1
+			if c.retry {
+				want = 3
+			}
+			header := http.Header{DefaultIdempotencyKeyHeader: []string{"order-1"}}
+			if got := attempts(m.method, c.code, header); got != want {
+				t.Errorf("%s with %d and idempotency key: want %d attempts, got %d", m.method, c.code, want, got)
+			}
+		}
+	}
+
+	if got := attempts(http.MethodGet, http.StatusOK, http.Header{}); got != 1 {
+		t.Errorf("successful request should not be retried, got %d attempts", got)
+	}
+
+	r.spec.RetryNonIdempotent = true
+	if got := attempts(http.MethodPost, http.StatusServiceUnavailable, http.Header{}); got != 3 {
+		t.Errorf("POST should be retried with retryNonIdempotent, got %d attempts", got)
+	}
+}
@@ -56,6 +56,10 @@ type (
 		DefaultTimeoutDuration string `yaml:"defaultTimeoutDuration" jsonschema:"omitempty,format=duration"`
 		defaultTimeout         time.Duration
 		URLs                   []*URLRule `yaml:"urls" jsonschema:"required"`
+		// DeadlineHeader carries the remaining time budget of the request,
+		// e.g. 800ms, the request is limited by it if it's shorter than
+		// the timeout.
+		DeadlineHeader string `yaml:"deadlineHeader,omitempty" jsonschema:"omitempty"`
 	}
 
 	// TimeLimiter is the time limiter struct
@@ -65,6 +69,25 @@ type (
 	}
 )
 
+// Validate validates the timeout durations of Spec.
+func (spec Spec) Validate() error {
+	if d := spec.DefaultTimeoutDuration; d != "" {
+		if timeout, _ := time.ParseDuration(d); timeout <= 0 {
+			return fmt.Errorf("default timeout duration %s is not positive", d)
+		}
+	}
+
+	for _, u := range spec.URLs {
+		if d := u.TimeoutDuration; d != "" {
+			if timeout, _ := time.ParseDuration(d); timeout <= 0 {
+				return fmt.Errorf("timeout duration %s of url %+v is not positive", d, u.URL)
+			}
+		}
+	}
+
+	return nil
+}
+
 // Kind returns the kind of TimeLimiter.
 func (tl *TimeLimiter) Kind() string {
 	return Kind
@@ -110,16 +133,37 @@ func (tl *TimeLimiter) Inherit(filterSpec *httppipeline.FilterSpec, previousGene
 	tl.Init(filterSpec)
 }
 
-func (tl *TimeLimiter) handle(ctx context.HTTPContext, u *URLRule) string {
-	timer := time.AfterFunc(u.timeout, func() {
+// budget returns the remaining time budget in the deadline header,
+// zero means there is no budget.
+func (tl *TimeLimiter) budget(ctx context.HTTPContext) time.Duration {
+	if tl.spec.DeadlineHeader == "" {
+		return 0
+	}
+
+	budget, err := time.ParseDuration(ctx.Request().Header().Get(tl.spec.DeadlineHeader))
+	if err != nil || budget <= 0 {
+		return 0
+	}
+	return budget
+}
+
+func (tl *TimeLimiter) handle(ctx context.HTTPContext, timeout time.Duration, id string) string {
+	// NOTE: The request runs out of the budget of its caller before the
+	// timeout, so it's a gateway timeout instead of a request timeout.
+	statusCode := http.StatusRequestTimeout
+	if budget := tl.budget(ctx); budget > 0 && (timeout <= 0 || budget < timeout) {
+		timeout, statusCode = budget, http.StatusGatewayTimeout
+	}
+
+	timer := time.AfterFunc(timeout, func() {
 		ctx.Cancel(errTimeout)
 	})
 
 	result := ctx.CallNextHandler("")
 	if !timer.Stop() {
 		ctx.AddTag("timeLimiter: timed out")
-		logger.Infof("time limiter %s timed out on URL(%s)", tl.filterSpec.Name(), u.ID())
-		ctx.Response().SetStatusCode(http.StatusRequestTimeout)
+		logger.Infof("time limiter %s timed out on URL(%s)", tl.filterSpec.Name(), id)
+		ctx.Response().SetStatusCode(statusCode)
 		ctx.Response().Std().Header().Set("X-EG-Time-Limiter", "timed-out")
 		result = resultTimeout
 	}
@@ -131,9 +175,19 @@ func (tl *TimeLimiter) handle(ctx context.HTTPContext, u *URLRule) string {
 func (tl *TimeLimiter) Handle(ctx context.HTTPContext) string {
 	for _, u := range tl.spec.URLs {
 		if u.Match(ctx.Request()) {
-			return tl.handle(ctx, u)
+			return tl.handle(ctx, u.timeout, u.ID())
 		}
 	}
+
+	// NOTE: The requests matching no rule are only limited by the default
+	// timeout when it is configured explicitly, or by their time budget.
+	if tl.spec.DefaultTimeoutDuration != "" {
+		return tl.handle(ctx, tl.spec.defaultTimeout, ctx.Request().Path())
+	}
+	if tl.budget(ctx) > 0 {
+		return tl.handle(ctx, 0, ctx.Request().Path())
+	}
+
 	return ctx.CallNextHandler("")
 }
 
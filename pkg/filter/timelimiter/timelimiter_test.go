@@ -27,6 +27,7 @@ import (
 	"github.com/megaease/easegress/pkg/context/contexttest"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/httpheader"
 	"github.com/megaease/easegress/pkg/util/yamltool"
 )
 
@@ -123,3 +124,66 @@ urls:
 		t.Error("request path doesn't match, timeout should not happen")
 	}
 }
+
+func TestTimeLimiterDeadlineHeader(t *testing.T) {
+	const yamlSpec = `
+kind: TimeLimiter
+name: timelimiter
+urls:
+  - timeoutDuration: 1s
+    methods: [GET]
+    url:
+      exact: /timelimit
+deadlineHeader: X-Mesh-Deadline
+`
+	rawSpec := make(map[string]interface{})
+	yamltool.Unmarshal([]byte(yamlSpec), &rawSpec)
+
+	spec, e := httppipeline.NewFilterSpec(rawSpec, nil)
+	if e != nil {
+		t.Fatalf("unexpected error: %v", e)
+	}
+
+	tl := &TimeLimiter{}
+	tl.Init(spec)
+
+	header := http.Header{}
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedRequest.MockedMethod = func() string {
+		return http.MethodGet
+	}
+	ctx.MockedRequest.MockedPath = func() string {
+		return "/timelimit"
+	}
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(header)
+	}
+	ctx.MockedResponse.MockedStd = func() http.ResponseWriter {
+		return &httptest.ResponseRecorder{}
+	}
+	statusCode := 0
+	ctx.MockedResponse.MockedSetStatusCode = func(code int) {
+		statusCode = code
+	}
+	ctx.MockedCallNextHandler = func(lastResult string) string {
+		time.Sleep(20 * time.Millisecond)
+		return ""
+	}
+
+	if result := tl.Handle(ctx); result == resultTimeout {
+		t.Error("timeout should not happen without the deadline header")
+	}
+
+	header.Set("X-Mesh-Deadline", "10ms")
+	if result := tl.Handle(ctx); result != resultTimeout || statusCode != http.StatusGatewayTimeout {
+		t.Errorf("request should time out by its budget with 504, got result %q and status %d", result, statusCode)
+	}
+
+	ctx.MockedRequest.MockedPath = func() string {
+		return "/notimelimit"
+	}
+	statusCode = 0
+	if result := tl.Handle(ctx); result != resultTimeout || statusCode != http.StatusGatewayTimeout {
+		t.Errorf("request matching no rule should be limited by its budget, got result %q and status %d", result, statusCode)
+	}
+}
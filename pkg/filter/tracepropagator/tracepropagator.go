@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracepropagator
+
+import (
+	"fmt"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/tracing/propagation"
+)
+
+const (
+	// Kind is the kind of TracePropagator.
+	Kind = "TracePropagator"
+)
+
+var results = []string{}
+
+func init() {
+	httppipeline.Register(&TracePropagator{})
+}
+
+type (
+	// TracePropagator is the filter to translate the trace context of the
+	// requests, it's extracted in any accepted format, and injected in the
+	// emitted format only, so the services using different formats could
+	// join the same trace.
+	TracePropagator struct {
+		filterSpec *httppipeline.FilterSpec
+		spec       *Spec
+		accept     []string
+	}
+
+	// Spec is the spec of TracePropagator.
+	Spec struct {
+		// Emit is the format of the trace context of the requests passed
+		// to the following filters.
+		Emit string `yaml:"emit" jsonschema:"required,enum=b3,enum=tracecontext,enum=jaeger"`
+		// Accept are the formats extracted in order, the first one existing
+		// in the request wins. Empty means the emitted format only.
+		Accept []string `yaml:"accept,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+	}
+)
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	for _, format := range spec.Accept {
+		if !propagation.Valid(format) {
+			return fmt.Errorf("unsupported accepted format %s", format)
+		}
+	}
+
+	return nil
+}
+
+// Kind returns the kind of TracePropagator.
+func (tp *TracePropagator) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of TracePropagator.
+func (tp *TracePropagator) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Description returns the description of TracePropagator.
+func (tp *TracePropagator) Description() string {
+	return "TracePropagator translates the trace context of requests into one format."
+}
+
+// Results returns the results of TracePropagator.
+func (tp *TracePropagator) Results() []string {
+	return results
+}
+
+// Init initializes TracePropagator.
+func (tp *TracePropagator) Init(filterSpec *httppipeline.FilterSpec) {
+	tp.filterSpec, tp.spec = filterSpec, filterSpec.FilterSpec().(*Spec)
+	tp.accept = tp.spec.Accept
+	if len(tp.accept) == 0 {
+		tp.accept = []string{tp.spec.Emit}
+	}
+}
+
+// Inherit inherits previous generation of TracePropagator.
+func (tp *TracePropagator) Inherit(filterSpec *httppipeline.FilterSpec, previousGeneration httppipeline.Filter) {
+	previousGeneration.Close()
+	tp.Init(filterSpec)
+}
+
+// Handle translates the trace context of the request.
+func (tp *TracePropagator) Handle(ctx context.HTTPContext) string {
+	tp.handle(ctx)
+	return ctx.CallNextHandler("")
+}
+
+func (tp *TracePropagator) handle(ctx context.HTTPContext) {
+	h := ctx.Request().Header().Std()
+
+	sc, format := propagation.ExtractAny(tp.accept, h)
+	if sc == nil {
+		return
+	}
+
+	// NOTE: The trace contexts in the other formats are removed,
+	// so the following services never see conflicting ones.
+	for _, f := range propagation.Formats {
+		propagation.Clear(f, h)
+	}
+	propagation.Inject(tp.spec.Emit, sc, h)
+
+	if format != tp.spec.Emit {
+		ctx.AddTag(fmt.Sprintf("tracePropagator: %s to %s", format, tp.spec.Emit))
+	}
+}
+
+// Status returns status.
+func (tp *TracePropagator) Status() interface{} {
+	return nil
+}
+
+// Close closes TracePropagator.
+func (tp *TracePropagator) Close() {}
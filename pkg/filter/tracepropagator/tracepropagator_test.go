@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracepropagator
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/yamltool"
+)
+
+func newTracePropagator(t *testing.T, yamlSpec string) *TracePropagator {
+	rawSpec := make(map[string]interface{})
+	yamltool.Unmarshal([]byte(yamlSpec), &rawSpec)
+
+	spec, err := httppipeline.NewFilterSpec(rawSpec, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tp := &TracePropagator{}
+	tp.Init(spec)
+	return tp
+}
+
+func newTestContext(h http.Header) *contexttest.MockedHTTPContext {
+	ctx := &contexttest.MockedHTTPContext{}
+	header := httpheader.New(h)
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader { return header }
+	ctx.MockedCallNextHandler = func(lastResult string) string { return lastResult }
+	return ctx
+}
+
+func TestTracePropagator(t *testing.T) {
+	tp := newTracePropagator(t, `
+kind: TracePropagator
+name: tracePropagator
+emit: tracecontext
+accept: [tracecontext, b3, jaeger]
+`)
+
+	h := http.Header{
+		"X-B3-Traceid": []string{"4bf92f3577b34da6a3ce929d0e0e4736"},
+		"X-B3-Spanid":  []string{"00f067aa0ba902b7"},
+		"X-B3-Sampled": []string{"1"},
+	}
+	tp.Handle(newTestContext(h))
+	if got := h.Get("traceparent"); got != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Errorf("b3 should be translated to traceparent, got %q", got)
+	}
+	if h.Get("X-B3-TraceId") != "" {
+		t.Errorf("b3 headers should be removed, got %v", h)
+	}
+
+	// NOTE: The accepted formats are extracted in order.
+	h = http.Header{
+		"Traceparent":   []string{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"},
+		"Uber-Trace-Id": []string{"1:2:0:1"},
+	}
+	tp.Handle(newTestContext(h))
+	if got := h.Get("traceparent"); got != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00" {
+		t.Errorf("traceparent should win, got %q", got)
+	}
+	if h.Get("Uber-Trace-Id") != "" {
+		t.Errorf("jaeger header should be removed, got %v", h)
+	}
+
+	h = http.Header{"X-Request-Id": []string{"abc"}}
+	tp.Handle(newTestContext(h))
+	if len(h) != 1 {
+		t.Errorf("request without trace context should be untouched, got %v", h)
+	}
+}
+
+func TestTracePropagatorEmitOnly(t *testing.T) {
+	tp := newTracePropagator(t, `
+kind: TracePropagator
+name: tracePropagator
+emit: b3
+`)
+
+	h := http.Header{"Uber-Trace-Id": []string{"4bf92f3577b34da6a3ce929d0e0e4736:00f067aa0ba902b7:0:1"}}
+	tp.Handle(newTestContext(h))
+	if h.Get("X-B3-TraceId") != "" || h.Get("Uber-Trace-Id") == "" {
+		t.Errorf("formats not accepted should be untouched, got %v", h)
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	if err := (Spec{Emit: "b3", Accept: []string{"b3", "unknown"}}).Validate(); err == nil {
+		t.Errorf("want error for unsupported accepted format")
+	}
+}
@@ -0,0 +1,241 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package validator
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const defaultJWKSRefreshInterval = 10 * time.Minute
+
+type (
+	// jwksCache caches the JSON Web Key Set and refreshes it periodically.
+	jwksCache struct {
+		url      string
+		interval time.Duration
+		client   *http.Client
+
+		mutex sync.RWMutex
+		keys  map[string]interface{}
+
+		done chan struct{}
+	}
+
+	jwks struct {
+		Keys []*jwk `json:"keys"`
+	}
+
+	jwk struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		Use string `json:"use"`
+
+		// RSA
+		N string `json:"n"`
+		E string `json:"e"`
+
+		// EC
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+)
+
+func newJWKSCache(url string, interval time.Duration) *jwksCache {
+	c := &jwksCache{
+		url:      url,
+		interval: interval,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		keys:     map[string]interface{}{},
+		done:     make(chan struct{}),
+	}
+
+	go c.run()
+
+	return c
+}
+
+func (c *jwksCache) run() {
+	c.refresh()
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.refresh()
+		}
+	}
+}
+
+// refresh keeps the cached keys if fetching the key set failed, so the
+// tokens are still validated during the outage of the key server.
+func (c *jwksCache) refresh() {
+	keys, err := c.fetch()
+	if err != nil {
+		logger.Errorf("refresh JWKS from %s failed: %v", c.url, err)
+		return
+	}
+
+	c.mutex.Lock()
+	c.keys = keys
+	c.mutex.Unlock()
+}
+
+func (c *jwksCache) fetch() (map[string]interface{}, error) {
+	resp, err := c.client.Get(c.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseJWKS(data)
+}
+
+func (c *jwksCache) key(kid string) (interface{}, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	// NOTE: A token without kid is accepted when there is only one key.
+	if kid == "" && len(c.keys) == 1 {
+		for _, key := range c.keys {
+			return key, nil
+		}
+	}
+
+	key, exists := c.keys[kid]
+	if !exists {
+		return nil, fmt.Errorf("key %s not found", kid)
+	}
+
+	return key, nil
+}
+
+func (c *jwksCache) close() {
+	close(c.done)
+}
+
+// parseJWKS parses the RSA and EC signing keys of the key set, the other
+// keys are ignored.
+func parseJWKS(data []byte) (map[string]interface{}, error) {
+	set := &jwks{}
+	if err := json.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("unmarshal JWKS failed: %v", err)
+	}
+
+	keys := map[string]interface{}{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		var key interface{}
+		var err error
+		switch k.Kty {
+		case "RSA":
+			key, err = k.rsaPublicKey()
+		case "EC":
+			key, err = k.ecdsaPublicKey()
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse key %s failed: %v", k.Kid, err)
+		}
+
+		keys[k.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func (k *jwk) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := decodeBigInt(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid n: %v", err)
+	}
+	e, err := decodeBigInt(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid e: %v", err)
+	}
+	if !e.IsInt64() || e.Int64() <= 1 || e.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("invalid e: %s", k.E)
+	}
+
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+func (k *jwk) ecdsaPublicKey() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+	}
+
+	x, err := decodeBigInt(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("invalid x: %v", err)
+	}
+	y, err := decodeBigInt(k.Y)
+	if err != nil {
+		return nil, fmt.Errorf("invalid y: %v", err)
+	}
+	if !curve.IsOnCurve(x, y) {
+		return nil, fmt.Errorf("point is not on curve %s", k.Crv)
+	}
+
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
@@ -18,9 +18,12 @@
 package validator
 
 import (
+	"crypto/ecdsa"
+	"crypto/rsa"
 	"encoding/hex"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt"
 
@@ -29,28 +32,93 @@ import (
 
 // JWTValidatorSpec defines the configuration of JWT validator
 type JWTValidatorSpec struct {
-	Algorithm string `yaml:"algorithm" jsonschema:"enum=HS256,enum=HS384,enum=HS512"`
-	// Secret is in hex encoding
-	Secret string `yaml:"secret" jsonschema:"required,pattern=^[A-Fa-f0-9]+$"`
+	Algorithm string `yaml:"algorithm" jsonschema:"enum=HS256,enum=HS384,enum=HS512,enum=RS256,enum=RS384,enum=RS512,enum=ES256,enum=ES384,enum=ES512"`
+	// Secret is in hex encoding, it is required by the HMAC algorithms.
+	Secret string `yaml:"secret" jsonschema:"omitempty,pattern=^[A-Fa-f0-9]+$"`
+	// PublicKey is the static public key in PEM format for the RSA and
+	// ECDSA algorithms.
+	PublicKey string `yaml:"publicKey,omitempty" jsonschema:"omitempty"`
+	// JWKSURL is the URL of the JSON Web Key Set for the RSA and ECDSA
+	// algorithms, the key is chosen by the kid of the token.
+	JWKSURL string `yaml:"jwksURL,omitempty" jsonschema:"omitempty,format=uri"`
+	// JWKSRefreshInterval is the interval to refresh the cached key set,
+	// default is 10m.
+	JWKSRefreshInterval string `yaml:"jwksRefreshInterval,omitempty" jsonschema:"omitempty,format=duration"`
 	// CookieName specifies the name of a cookie, if not empty, and the cookie with
 	// this name both exists and has a non-empty value, its value is used as token
 	// string, the Authorization header is used to get the token string otherwise.
 	CookieName string `yaml:"cookieName" jsonschema:"omitempty"`
+
+	// Issuer is the required iss claim, empty means any.
+	Issuer string `yaml:"issuer,omitempty" jsonschema:"omitempty"`
+	// Audience are the accepted aud claims, the token must have one of
+	// them, empty means any.
+	Audience []string `yaml:"audience,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+	// RequiredClaims are the claims the token must have.
+	RequiredClaims []string `yaml:"requiredClaims,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+	// Leeway is the tolerated clock skew on the exp, nbf and iat claims.
+	Leeway string `yaml:"leeway,omitempty" jsonschema:"omitempty,format=duration"`
+}
+
+// Validate validates JWTValidatorSpec.
+func (spec JWTValidatorSpec) Validate() error {
+	if strings.HasPrefix(spec.Algorithm, "HS") {
+		if spec.Secret == "" {
+			return fmt.Errorf("secret is required by algorithm %s", spec.Algorithm)
+		}
+		return nil
+	}
+
+	if (spec.PublicKey == "") == (spec.JWKSURL == "") {
+		return fmt.Errorf("exactly one of publicKey and jwksURL is required by algorithm %s", spec.Algorithm)
+	}
+
+	if spec.PublicKey != "" {
+		if _, err := parsePublicKey(spec.Algorithm, []byte(spec.PublicKey)); err != nil {
+			return fmt.Errorf("invalid publicKey: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func parsePublicKey(algorithm string, pem []byte) (interface{}, error) {
+	if strings.HasPrefix(algorithm, "ES") {
+		return jwt.ParseECPublicKeyFromPEM(pem)
+	}
+	return jwt.ParseRSAPublicKeyFromPEM(pem)
 }
 
 // NewJWTValidator creates a new JWT validator
 func NewJWTValidator(spec *JWTValidatorSpec) *JWTValidator {
-	secret, _ := hex.DecodeString(spec.Secret)
-	return &JWTValidator{
-		spec:        spec,
-		secretBytes: secret,
+	v := &JWTValidator{spec: spec}
+
+	switch {
+	case strings.HasPrefix(spec.Algorithm, "HS"):
+		v.secretBytes, _ = hex.DecodeString(spec.Secret)
+	case spec.PublicKey != "":
+		// NOTE: The public key has been checked in Validate.
+		v.publicKey, _ = parsePublicKey(spec.Algorithm, []byte(spec.PublicKey))
+	case spec.JWKSURL != "":
+		interval, err := time.ParseDuration(spec.JWKSRefreshInterval)
+		if err != nil || interval <= 0 {
+			interval = defaultJWKSRefreshInterval
+		}
+		v.jwks = newJWKSCache(spec.JWKSURL, interval)
 	}
+
+	v.leeway, _ = time.ParseDuration(spec.Leeway)
+
+	return v
 }
 
 // JWTValidator defines the JWT validator
 type JWTValidator struct {
 	spec        *JWTValidatorSpec
 	secretBytes []byte
+	publicKey   interface{}
+	jwks        *jwksCache
+	leeway      time.Duration
 }
 
 // Validate validates the JWT token of a http request
@@ -72,13 +140,97 @@ func (v *JWTValidator) Validate(req context.HTTPRequest) error {
 		token = authHdr[len(prefix):]
 	}
 
-	// jwt.Parse does everything including parsing and verification
-	_, e := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		if alg := token.Method.Alg(); alg != v.spec.Algorithm {
-			return nil, fmt.Errorf("unexpected signing method: %v", alg)
-		}
+	// NOTE: The parser skips the claims validation, which has no leeway,
+	// the claims are validated by validateClaims instead.
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	t, e := parser.Parse(token, v.key)
+	if e != nil {
+		return e
+	}
+
+	claims, ok := t.Claims.(jwt.MapClaims)
+	if !ok {
+		return fmt.Errorf("unexpected claims type %T", t.Claims)
+	}
+
+	return v.validateClaims(claims, time.Now())
+}
+
+func (v *JWTValidator) key(token *jwt.Token) (interface{}, error) {
+	if alg := token.Method.Alg(); alg != v.spec.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method: %v", alg)
+	}
+
+	switch {
+	case v.secretBytes != nil:
 		return v.secretBytes, nil
-	})
+	case v.publicKey != nil:
+		return v.publicKey, nil
+	case v.jwks != nil:
+		kid, _ := token.Header["kid"].(string)
+		key, err := v.jwks.key(kid)
+		if err != nil {
+			return nil, err
+		}
+		switch key.(type) {
+		case *rsa.PublicKey:
+			if strings.HasPrefix(v.spec.Algorithm, "RS") {
+				return key, nil
+			}
+		case *ecdsa.PublicKey:
+			if strings.HasPrefix(v.spec.Algorithm, "ES") {
+				return key, nil
+			}
+		}
+		return nil, fmt.Errorf("key %s does not fit algorithm %s", kid, v.spec.Algorithm)
+	}
+
+	return nil, fmt.Errorf("no key for algorithm %s", v.spec.Algorithm)
+}
+
+func (v *JWTValidator) validateClaims(claims jwt.MapClaims, now time.Time) error {
+	// NOTE: The expiration is checked against an earlier time and the
+	// others against a later time, so the clock skew within the leeway
+	// is tolerated in both directions.
+	if !claims.VerifyExpiresAt(now.Add(-v.leeway).Unix(), false) {
+		return fmt.Errorf("token is expired")
+	}
+	if !claims.VerifyNotBefore(now.Add(v.leeway).Unix(), false) {
+		return fmt.Errorf("token is not valid yet")
+	}
+	if !claims.VerifyIssuedAt(now.Add(v.leeway).Unix(), false) {
+		return fmt.Errorf("token used before issued")
+	}
 
-	return e
+	if v.spec.Issuer != "" && !claims.VerifyIssuer(v.spec.Issuer, true) {
+		return fmt.Errorf("unexpected issuer: %v", claims["iss"])
+	}
+
+	if len(v.spec.Audience) != 0 {
+		matched := false
+		for _, aud := range v.spec.Audience {
+			if claims.VerifyAudience(aud, true) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("unexpected audience: %v", claims["aud"])
+		}
+	}
+
+	for _, claim := range v.spec.RequiredClaims {
+		if _, exists := claims[claim]; !exists {
+			return fmt.Errorf("claim %s is required", claim)
+		}
+	}
+
+	return nil
+}
+
+// Close closes the JWT validator.
+func (v *JWTValidator) Close() {
+	if v.jwks != nil {
+		v.jwks.close()
+	}
 }
@@ -132,7 +132,7 @@ func (v *Validator) handle(ctx context.HTTPContext) string {
 	if v.jwt != nil {
 		err := v.jwt.Validate(req)
 		if err != nil {
-			ctx.Response().SetStatusCode(http.StatusForbidden)
+			ctx.Response().SetStatusCode(http.StatusUnauthorized)
 			ctx.AddTag(stringtool.Cat("JWT validator: ", err.Error()))
 			return resultInvalid
 		}
@@ -163,4 +163,8 @@ func (v *Validator) handle(ctx context.HTTPContext) string {
 func (v *Validator) Status() interface{} { return nil }
 
 // Close closes Validator.
-func (v *Validator) Close() {}
+func (v *Validator) Close() {
+	if v.jwt != nil {
+		v.jwt.Close()
+	}
+}
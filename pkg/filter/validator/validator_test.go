@@ -18,12 +18,20 @@
 package validator
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
 	"fmt"
 	"io"
+	"math/big"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
 
 	"github.com/megaease/easegress/pkg/context/contexttest"
 	"github.com/megaease/easegress/pkg/logger"
@@ -289,3 +297,122 @@ signature:
 		t.Errorf("OAuth/2 Authorization should fail")
 	}
 }
+
+func TestJWTWithJWKS(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key failed: %v", err)
+	}
+
+	encode := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	keySet := fmt.Sprintf(`{"keys": [{"kid": "k1", "kty": "RSA", "use": "sig", "n": "%s", "e": "%s"}]}`,
+		encode(privateKey.N.Bytes()), encode(big.NewInt(int64(privateKey.E)).Bytes()))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, keySet)
+	}))
+	defer server.Close()
+
+	spec := &JWTValidatorSpec{Algorithm: "RS256", JWKSURL: server.URL, Audience: []string{"order"}}
+	if err := spec.Validate(); err != nil {
+		t.Fatalf("spec should be valid: %v", err)
+	}
+	v := NewJWTValidator(spec)
+	defer v.Close()
+
+	for i := 0; i < 100; i++ {
+		if _, err := v.jwks.key("k1"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	sign := func(kid string, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = kid
+		s, err := token.SignedString(privateKey)
+		if err != nil {
+			t.Fatalf("sign token failed: %v", err)
+		}
+		return s
+	}
+
+	header := http.Header{}
+	req := &contexttest.MockedHTTPRequest{}
+	req.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(header)
+	}
+
+	header.Set("Authorization", "Bearer "+sign("k1", jwt.MapClaims{"aud": "order"}))
+	if err := v.Validate(req); err != nil {
+		t.Errorf("the jwt token should be valid: %v", err)
+	}
+
+	header.Set("Authorization", "Bearer "+sign("k2", jwt.MapClaims{"aud": "order"}))
+	if err := v.Validate(req); err == nil {
+		t.Errorf("the jwt token signed by an unknown key should be invalid")
+	}
+
+	header.Set("Authorization", "Bearer "+sign("k1", jwt.MapClaims{"aud": "payment"}))
+	if err := v.Validate(req); err == nil {
+		t.Errorf("the jwt token for another audience should be invalid")
+	}
+}
+
+func TestJWTClaimsLeeway(t *testing.T) {
+	v := NewJWTValidator(&JWTValidatorSpec{
+		Algorithm:      "HS256",
+		Secret:         "313233343536",
+		Issuer:         "megaease",
+		RequiredClaims: []string{"sub"},
+		Leeway:         "30s",
+	})
+	now := time.Now()
+
+	claims := jwt.MapClaims{
+		"iss": "megaease",
+		"sub": "alice",
+		"exp": float64(now.Add(-20 * time.Second).Unix()),
+		"nbf": float64(now.Add(20 * time.Second).Unix()),
+	}
+	if err := v.validateClaims(claims, now); err != nil {
+		t.Errorf("the claims within leeway should be valid: %v", err)
+	}
+
+	claims["exp"] = float64(now.Add(-time.Minute).Unix())
+	if err := v.validateClaims(claims, now); err == nil {
+		t.Errorf("the claims expired beyond leeway should be invalid")
+	}
+
+	claims["exp"] = float64(now.Add(time.Minute).Unix())
+	claims["nbf"] = float64(now.Add(time.Minute).Unix())
+	if err := v.validateClaims(claims, now); err == nil {
+		t.Errorf("the claims not valid beyond leeway should be invalid")
+	}
+
+	delete(claims, "nbf")
+	delete(claims, "sub")
+	if err := v.validateClaims(claims, now); err == nil {
+		t.Errorf("the claims without required claim should be invalid")
+	}
+
+	claims["sub"] = "alice"
+	claims["iss"] = "unknown"
+	if err := v.validateClaims(claims, now); err == nil {
+		t.Errorf("the claims with unexpected issuer should be invalid")
+	}
+}
+
+func TestJWTValidatorSpecValidate(t *testing.T) {
+	specs := map[*JWTValidatorSpec]bool{
+		{Algorithm: "HS256", Secret: "313233343536"}:          true,
+		{Algorithm: "HS256"}:                                  false,
+		{Algorithm: "RS256", JWKSURL: "https://megaease.com"}: true,
+		{Algorithm: "RS256"}:                                  false,
+		{Algorithm: "ES256", PublicKey: "not a pem"}:          false,
+	}
+	for spec, valid := range specs {
+		if err := spec.Validate(); (err == nil) != valid {
+			t.Errorf("spec %+v: want valid %v, got error %v", spec, valid, err)
+		}
+	}
+}
@@ -32,50 +32,168 @@ type (
 		ListAllServiceInstances() ([]*api.CatalogService, error)
 	}
 
-	consulAPIClient struct {
+	// consulAgentClient works with the Consul agent, the instances are
+	// registered to the node of the agent, which runs their health checks,
+	// and the reads are served from the cache of the agent.
+	consulAgentClient struct {
 		client *api.Client
 	}
+
+	// consulCatalogClient works with the catalog and health APIs of the
+	// Consul servers without an agent, the instances are registered to
+	// the configured node and no health checks run for them.
+	consulCatalogClient struct {
+		client *api.Client
+		node   string
+	}
 )
 
-func newConsulAPIClient(client *api.Client) *consulAPIClient {
-	return &consulAPIClient{
+func newConsulAgentClient(client *api.Client) *consulAgentClient {
+	return &consulAgentClient{
 		client: client,
 	}
 }
 
-func (c *consulAPIClient) ServiceRegister(registration *api.AgentServiceRegistration) error {
+func (c *consulAgentClient) ServiceRegister(registration *api.AgentServiceRegistration) error {
 	return c.client.Agent().ServiceRegister(registration)
 }
 
-func (c *consulAPIClient) ServiceDeregister(instanceID string) error {
+func (c *consulAgentClient) ServiceDeregister(instanceID string) error {
 	return c.client.Agent().ServiceDeregister(instanceID)
 }
 
-func (c *consulAPIClient) ListServiceInstances(serviceName string) ([]*api.CatalogService, error) {
+func (c *consulAgentClient) ListServiceInstances(serviceName string) ([]*api.CatalogService, error) {
+	entries, _, err := c.client.Health().Service(serviceName, "", false, &api.QueryOptions{UseCache: true})
+	if err != nil {
+		return nil, fmt.Errorf("pull health service %s failed: %v", serviceName, err)
+	}
+
+	services := make([]*api.CatalogService, 0, len(entries))
+	for _, entry := range entries {
+		services = append(services, serviceEntryToCatalogService(entry))
+	}
+
+	return services, nil
+}
+
+func (c *consulAgentClient) ListAllServiceInstances() ([]*api.CatalogService, error) {
+	return listAllServiceInstances(c.client, c.ListServiceInstances)
+}
+
+func newConsulCatalogClient(client *api.Client, node string) *consulCatalogClient {
+	return &consulCatalogClient{
+		client: client,
+		node:   node,
+	}
+}
+
+// ServiceRegister registers the instance to the node, the address of the
+// node is only set by the first registration creating it.
+func (c *consulCatalogClient) ServiceRegister(registration *api.AgentServiceRegistration) error {
+	_, err := c.client.Catalog().Register(&api.CatalogRegistration{
+		Node:           c.node,
+		Address:        registration.Address,
+		SkipNodeUpdate: true,
+		Service: &api.AgentService{
+			Kind:    registration.Kind,
+			ID:      registration.ID,
+			Service: registration.Name,
+			Tags:    registration.Tags,
+			Port:    registration.Port,
+			Address: registration.Address,
+			Meta:    registration.Meta,
+		},
+	}, &api.WriteOptions{})
+	return err
+}
+
+func (c *consulCatalogClient) ServiceDeregister(instanceID string) error {
+	_, err := c.client.Catalog().Deregister(&api.CatalogDeregistration{
+		Node:      c.node,
+		ServiceID: instanceID,
+	}, &api.WriteOptions{})
+	return err
+}
+
+func (c *consulCatalogClient) ListServiceInstances(serviceName string) ([]*api.CatalogService, error) {
 	resp, _, err := c.client.Catalog().Service(serviceName, "", &api.QueryOptions{})
 	if err != nil {
 		return nil, err
 	}
+
+	err = c.attachChecks(serviceName, resp)
+	if err != nil {
+		return nil, err
+	}
+
 	return resp, nil
 }
 
-func (c *consulAPIClient) ListAllServiceInstances() ([]*api.CatalogService, error) {
-	resp, _, err := c.client.Catalog().Services(&api.QueryOptions{})
+func (c *consulCatalogClient) ListAllServiceInstances() ([]*api.CatalogService, error) {
+	return listAllServiceInstances(c.client, c.ListServiceInstances)
+}
+
+// attachChecks fills health checks of the service into its catalog services,
+// since the catalog API doesn't return them.
+func (c *consulCatalogClient) attachChecks(serviceName string, services []*api.CatalogService) error {
+	checks, _, err := c.client.Health().Checks(serviceName, &api.QueryOptions{})
+	if err != nil {
+		return fmt.Errorf("pull health checks of service %s failed: %v", serviceName, err)
+	}
+
+	for _, service := range services {
+		for _, check := range checks {
+			if check.Node == service.Node && check.ServiceID == service.ServiceID {
+				service.Checks = append(service.Checks, check)
+			}
+		}
+	}
+
+	return nil
+}
+
+// listAllServiceInstances lists the instances of all services in the
+// catalog by list, which lists the instances of one service.
+func listAllServiceInstances(client *api.Client,
+	list func(serviceName string) ([]*api.CatalogService, error)) ([]*api.CatalogService, error) {
+	resp, _, err := client.Catalog().Services(&api.QueryOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("pull catalog services failed: %v", err)
 	}
 
 	catalogServices := []*api.CatalogService{}
 	for serviceName := range resp {
-		services, _, err := c.client.Catalog().Service(serviceName, "", &api.QueryOptions{})
+		services, err := list(serviceName)
 		if err != nil {
 			return nil, fmt.Errorf("pull catalog service %s failed: %v", serviceName, err)
 		}
 
-		for _, service := range services {
-			catalogServices = append(catalogServices, service)
-		}
+		catalogServices = append(catalogServices, services...)
 	}
 
 	return catalogServices, nil
 }
+
+// serviceEntryToCatalogService converts the health entry of an instance to
+// the catalog service with its checks, so the health of the instances is
+// mapped in the same way in both modes.
+func serviceEntryToCatalogService(entry *api.ServiceEntry) *api.CatalogService {
+	service := &api.CatalogService{
+		Checks: entry.Checks,
+	}
+	if entry.Node != nil {
+		service.Node = entry.Node.Node
+		service.Address = entry.Node.Address
+		service.Datacenter = entry.Node.Datacenter
+	}
+	if entry.Service != nil {
+		service.ServiceID = entry.Service.ID
+		service.ServiceName = entry.Service.Service
+		service.ServiceAddress = entry.Service.Address
+		service.ServicePort = entry.Service.Port
+		service.ServiceTags = entry.Service.Tags
+		service.ServiceMeta = entry.Service.Meta
+	}
+
+	return service
+}
@@ -40,6 +40,13 @@ const (
 	// NOTE: Namespace is only available for Consul Enterprise,
 	// instead we use this field to work around.
 	MetaKeyRegistryName = "RegistryName"
+
+	// ModeAgent works with a Consul agent, usually the local one, which
+	// runs the health checks of the registered instances.
+	ModeAgent = "agent"
+	// ModeCatalog works with the catalog of the Consul servers without
+	// an agent, the registered instances have no health checks.
+	ModeCatalog = "catalog"
 )
 
 func init() {
@@ -68,22 +75,53 @@ type (
 
 	// Spec describes the ConsulServiceRegistry.
 	Spec struct {
-		Address      string   `yaml:"address" jsonschema:"required"`
-		Scheme       string   `yaml:"scheme" jsonschema:"required,enum=http,enum=https"`
-		Datacenter   string   `yaml:"datacenter" jsonschema:"omitempty"`
-		Token        string   `yaml:"token" jsonschema:"omitempty"`
-		Namespace    string   `yaml:"namespace" jsonschema:"omitempty"`
-		SyncInterval string   `yaml:"syncInterval" jsonschema:"required,format=duration"`
-		ServiceTags  []string `yaml:"serviceTags" jsonschema:"omitempty"`
+		Address       string   `yaml:"address" jsonschema:"required"`
+		Scheme        string   `yaml:"scheme" jsonschema:"required,enum=http,enum=https"`
+		Datacenter    string   `yaml:"datacenter" jsonschema:"omitempty"`
+		Token         string   `yaml:"token" jsonschema:"omitempty"`
+		Namespace     string   `yaml:"namespace" jsonschema:"omitempty"`
+		SyncInterval  string   `yaml:"syncInterval" jsonschema:"required,format=duration"`
+		ServiceTags   []string `yaml:"serviceTags" jsonschema:"omitempty"`
+		WarningStatus string   `yaml:"warningStatus" jsonschema:"omitempty,enum=,enum=UP,enum=DRAINING"`
+
+		// Mode is ModeAgent or ModeCatalog, default is ModeAgent.
+		Mode string `yaml:"mode" jsonschema:"omitempty,enum=,enum=agent,enum=catalog"`
+		// Node is the Consul node the instances are registered to in
+		// ModeCatalog, it's created with the address of the first one.
+		Node string `yaml:"node" jsonschema:"omitempty"`
 	}
 
 	// Status is the status of ConsulServiceRegistry.
 	Status struct {
 		Health              string         `yaml:"health"`
+		Mode                string         `yaml:"mode"`
 		ServiceInstancesNum map[string]int `yaml:"instancesNum"`
 	}
 )
 
+// Validate validates Spec.
+func (spec *Spec) Validate() error {
+	switch spec.mode() {
+	case ModeAgent:
+		if spec.Node != "" {
+			return fmt.Errorf("node is only used in %s mode, the agent registers to its own node", ModeCatalog)
+		}
+	case ModeCatalog:
+		if spec.Node == "" {
+			return fmt.Errorf("node is required in %s mode", ModeCatalog)
+		}
+	}
+
+	return nil
+}
+
+func (spec *Spec) mode() string {
+	if spec.Mode == "" {
+		return ModeAgent
+	}
+	return spec.Mode
+}
+
 // Category returns the category of ConsulServiceRegistry.
 func (c *ConsulServiceRegistry) Category() supervisor.ObjectCategory {
 	return Category
@@ -97,9 +135,11 @@ func (c *ConsulServiceRegistry) Kind() string {
 // DefaultSpec returns the default spec of ConsulServiceRegistry.
 func (c *ConsulServiceRegistry) DefaultSpec() interface{} {
 	return &Spec{
-		Address:      "127.0.0.1:8500",
-		Scheme:       "http",
-		SyncInterval: "10s",
+		Address:       "127.0.0.1:8500",
+		Scheme:        "http",
+		SyncInterval:  "10s",
+		WarningStatus: serviceregistry.StatusDraining,
+		Mode:          ModeAgent,
 	}
 }
 
@@ -157,17 +197,17 @@ func (c *ConsulServiceRegistry) buildClient() (consulClient, error) {
 
 	config := api.DefaultConfig()
 	config.Address = c.spec.Address
-	if config.Scheme != "" {
+	if c.spec.Scheme != "" {
 		config.Scheme = c.spec.Scheme
 	}
-	if config.Datacenter != "" {
+	if c.spec.Datacenter != "" {
 		config.Datacenter = c.spec.Datacenter
 	}
-	if config.Token != "" {
+	if c.spec.Token != "" {
 		config.Token = c.spec.Token
 	}
 
-	if config.Namespace != "" {
+	if c.spec.Namespace != "" {
 		config.Namespace = c.spec.Namespace
 	}
 
@@ -176,7 +216,11 @@ func (c *ConsulServiceRegistry) buildClient() (consulClient, error) {
 		return nil, err
 	}
 
-	c.client = newConsulAPIClient(client)
+	if c.spec.mode() == ModeCatalog {
+		c.client = newConsulCatalogClient(client, c.spec.Node)
+	} else {
+		c.client = newConsulAgentClient(client)
+	}
 
 	return c.client, nil
 }
@@ -252,7 +296,7 @@ func (c *ConsulServiceRegistry) update() {
 
 // Status returns status of ConsulServiceRegister.
 func (c *ConsulServiceRegistry) Status() *supervisor.Status {
-	s := &Status{}
+	s := &Status{Mode: c.spec.mode()}
 
 	_, err := c.getClient()
 	if err != nil {
@@ -432,5 +476,23 @@ func (c *ConsulServiceRegistry) catalogServiceToServiceInstance(catalogService *
 		Port:         uint16(catalogService.ServicePort),
 		Tags:         catalogService.ServiceTags,
 		Address:      catalogService.Address,
+		Status:       c.healthToStatus(catalogService.Checks.AggregatedStatus()),
+	}
+}
+
+// healthToStatus maps the aggregated Consul health of an instance to
+// the instance status. Instances without any check are passing in Consul.
+func (c *ConsulServiceRegistry) healthToStatus(health string) string {
+	switch health {
+	case api.HealthPassing:
+		return serviceregistry.StatusUp
+	case api.HealthWarning:
+		if c.spec.WarningStatus == serviceregistry.StatusUp {
+			return serviceregistry.StatusUp
+		}
+		return serviceregistry.StatusDraining
+	default:
+		// critical and maintenance
+		return serviceregistry.StatusOutOfService
 	}
 }
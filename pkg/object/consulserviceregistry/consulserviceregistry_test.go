@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package consulserviceregistry
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/megaease/easegress/pkg/object/serviceregistry"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func TestHealthToStatus(t *testing.T) {
+	newChecks := func(health string) api.HealthChecks {
+		return api.HealthChecks{
+			{Node: "node-1", ServiceID: "order-1", Status: api.HealthPassing},
+			{Node: "node-1", ServiceID: "order-1", Status: health},
+		}
+	}
+
+	tests := []struct {
+		health        string
+		warningStatus string
+		want          string
+	}{
+		{api.HealthPassing, serviceregistry.StatusDraining, serviceregistry.StatusUp},
+		{api.HealthWarning, serviceregistry.StatusDraining, serviceregistry.StatusDraining},
+		{api.HealthWarning, "", serviceregistry.StatusDraining},
+		{api.HealthWarning, serviceregistry.StatusUp, serviceregistry.StatusUp},
+		{api.HealthCritical, serviceregistry.StatusUp, serviceregistry.StatusOutOfService},
+		{api.HealthMaint, serviceregistry.StatusDraining, serviceregistry.StatusOutOfService},
+	}
+
+	for _, tc := range tests {
+		c := &ConsulServiceRegistry{spec: &Spec{WarningStatus: tc.warningStatus}}
+		status := c.healthToStatus(newChecks(tc.health).AggregatedStatus())
+		if status != tc.want {
+			t.Errorf("health %s with warningStatus %q: want status %s, got %s",
+				tc.health, tc.warningStatus, tc.want, status)
+		}
+	}
+
+	c := &ConsulServiceRegistry{spec: &Spec{}}
+	if status := c.healthToStatus(api.HealthChecks(nil).AggregatedStatus()); status != serviceregistry.StatusUp {
+		t.Errorf("instance without checks should be UP, got %s", status)
+	}
+}
+
+func TestHealthMappingConsistentAcrossModes(t *testing.T) {
+	checks := api.HealthChecks{
+		{Node: "node-1", ServiceID: "order-1", Status: api.HealthPassing},
+		{Node: "node-1", ServiceID: "order-1", Status: api.HealthWarning},
+	}
+	catalog := &api.CatalogService{
+		Node:        "node-1",
+		Address:     "192.168.0.110",
+		ServiceID:   "order-1",
+		ServiceName: "order",
+		ServicePort: 8080,
+		ServiceMeta: map[string]string{MetaKeyRegistryName: "eureka-registry"},
+		Checks:      checks,
+	}
+	entry := &api.ServiceEntry{
+		Node: &api.Node{Node: "node-1", Address: "192.168.0.110"},
+		Service: &api.AgentService{
+			ID:      "order-1",
+			Service: "order",
+			Port:    8080,
+			Meta:    map[string]string{MetaKeyRegistryName: "eureka-registry"},
+		},
+		Checks: checks,
+	}
+
+	superSpec, err := supervisor.NewSpec(`
+kind: ConsulServiceRegistry
+name: consul-service-registry
+address: 127.0.0.1:8500
+scheme: http
+syncInterval: 10s
+warningStatus: DRAINING
+`)
+	if err != nil {
+		t.Fatalf("new spec failed: %v", err)
+	}
+	c := &ConsulServiceRegistry{superSpec: superSpec, spec: superSpec.ObjectSpec().(*Spec)}
+	want := c.catalogServiceToServiceInstance(catalog)
+	got := c.catalogServiceToServiceInstance(serviceEntryToCatalogService(entry))
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want the same instance in both modes %+v, got %+v", want, got)
+	}
+	if got.Status != serviceregistry.StatusDraining {
+		t.Errorf("want status %s, got %s", serviceregistry.StatusDraining, got.Status)
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	tests := []struct {
+		mode  string
+		node  string
+		valid bool
+	}{
+		{"", "", true},
+		{ModeAgent, "", true},
+		{ModeAgent, "easegress", false},
+		{ModeCatalog, "easegress", true},
+		{ModeCatalog, "", false},
+	}
+
+	for _, tc := range tests {
+		spec := &Spec{Mode: tc.mode, Node: tc.node}
+		err := spec.Validate()
+		if tc.valid && err != nil {
+			t.Errorf("mode %q with node %q: want valid, got %v", tc.mode, tc.node, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("mode %q with node %q: want invalid", tc.mode, tc.node)
+		}
+	}
+}
@@ -35,6 +35,7 @@ import (
 	"github.com/megaease/easegress/pkg/object/trafficcontroller"
 	"github.com/megaease/easegress/pkg/supervisor"
 	"github.com/megaease/easegress/pkg/util/httpstat"
+	"github.com/megaease/easegress/pkg/util/kafkaconfig"
 )
 
 const (
@@ -78,6 +79,10 @@ type (
 	KafkaSpec struct {
 		Brokers []string `yaml:"brokers" jsonschema:"required,uniqueItems=true"`
 		Topic   string   `yaml:"topic" jsonschema:"required"`
+		// SASL authenticates the producer, nil means no authentication.
+		SASL *kafkaconfig.SASLSpec `yaml:"sasl,omitempty" jsonschema:"omitempty"`
+		// TLS encrypts the connections to the brokers, nil means plaintext.
+		TLS *kafkaconfig.TLSSpec `yaml:"tls,omitempty" jsonschema:"omitempty"`
 	}
 
 	// Status is the status of EaseMonitorMetrics.
@@ -198,10 +203,11 @@ func (emm *EaseMonitorMetrics) getClient() (sarama.AsyncProducer, error) {
 	emm.clientMutex.Lock()
 	defer emm.clientMutex.Unlock()
 
-	// NOTE: Default config is good enough for now.
-	config := sarama.NewConfig()
-	config.ClientID = emm.superSpec.Name()
-	config.Version = sarama.V0_10_2_0
+	kafka := emm.spec.Kafka
+	config, err := kafkaconfig.ProducerConfig(emm.superSpec.Name(), 0, kafka.SASL, kafka.TLS)
+	if err != nil {
+		return nil, err
+	}
 
 	producer, err := sarama.NewAsyncProducer(emm.spec.Kafka.Brokers, config)
 	if err != nil {
@@ -40,6 +40,15 @@ const (
 	MetaKeyRegistryName = "RegistryName"
 )
 
+// internalMetaKeys are the metadata keys used by Eureka itself or its clients,
+// they are not taken as labels.
+var internalMetaKeys = map[string]bool{
+	MetaKeyRegistryName: true,
+	"@class":            true,
+	"management.port":   true,
+	"jmx.port":          true,
+}
+
 func init() {
 	supervisor.Register(&EurekaServiceRegistry{})
 }
@@ -397,22 +406,44 @@ func (e *EurekaServiceRegistry) instanceInfoToServiceInstances(info *eurekaapi.I
 		ServiceName:  info.App,
 		InstanceID:   info.InstanceID,
 		Address:      address,
+		Labels:       metadataToLabels(info.Metadata),
 	}
 
 	if info.Port != nil && info.Port.Enabled {
 		plain := baseServiceInstanceSpec
+		plain.Port = uint16(info.Port.Port)
 		instances = append(instances, &plain)
 	}
 
 	if info.SecurePort != nil && info.SecurePort.Enabled {
 		secure := baseServiceInstanceSpec
 		secure.Scheme = "https"
+		secure.Port = uint16(info.SecurePort.Port)
 		instances = append(instances, &secure)
 	}
 
 	return instances
 }
 
+// metadataToLabels copies the instance metadata to labels except the internal keys.
+func metadataToLabels(metadata *eurekaapi.MetaData) map[string]string {
+	if metadata == nil || len(metadata.Map) == 0 {
+		return nil
+	}
+
+	labels := make(map[string]string)
+	for k, v := range metadata.Map {
+		if !internalMetaKeys[k] {
+			labels[k] = v
+		}
+	}
+
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
+}
+
 func (e *EurekaServiceRegistry) serviceInstanceToInstanceInfo(serviceInstance *serviceregistry.ServiceInstanceSpec) *eurekaapi.InstanceInfo {
 	info := &eurekaapi.InstanceInfo{
 		Metadata: &eurekaapi.MetaData{
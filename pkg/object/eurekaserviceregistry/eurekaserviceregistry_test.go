@@ -0,0 +1,50 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eurekaserviceregistry
+
+import (
+	"reflect"
+	"testing"
+
+	eurekaapi "github.com/ArthurHlt/go-eureka-client/eureka"
+)
+
+func TestMetadataToLabels(t *testing.T) {
+	if labels := metadataToLabels(nil); labels != nil {
+		t.Errorf("want nil labels for nil metadata, got %v", labels)
+	}
+
+	metadata := &eurekaapi.MetaData{
+		Map: map[string]string{
+			MetaKeyRegistryName: "eureka-registry",
+			"@class":            "java.util.Collections$EmptyMap",
+			"management.port":   "8081",
+			"version":           "2",
+			"zone":              "zone-a",
+		},
+	}
+	want := map[string]string{"version": "2", "zone": "zone-a"}
+	if labels := metadataToLabels(metadata); !reflect.DeepEqual(labels, want) {
+		t.Errorf("want labels %v, got %v", want, labels)
+	}
+
+	metadata = &eurekaapi.MetaData{Map: map[string]string{"@class": "java.util.Collections$EmptyMap"}}
+	if labels := metadataToLabels(metadata); labels != nil {
+		t.Errorf("want nil labels for internal keys only, got %v", labels)
+	}
+}
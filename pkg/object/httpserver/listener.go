@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"net"
+	"sync"
+)
+
+type (
+	// sharedListener accepts the connections of a socket and dispatches
+	// them to the servers attached to it, so a new server takes over the
+	// socket without reopening it and no connection is refused in between.
+	sharedListener struct {
+		net.Listener
+
+		conns     chan net.Conn
+		done      chan struct{}
+		err       error
+		closeOnce sync.Once
+	}
+
+	// attachedListener is the listener of one server on a shared listener,
+	// closing it detaches the server without closing the socket.
+	attachedListener struct {
+		shared    *sharedListener
+		closed    chan struct{}
+		closeOnce sync.Once
+	}
+)
+
+func newSharedListener(l net.Listener) *sharedListener {
+	sl := &sharedListener{
+		Listener: l,
+		conns:    make(chan net.Conn),
+		done:     make(chan struct{}),
+	}
+
+	go sl.run()
+
+	return sl
+}
+
+func (sl *sharedListener) run() {
+	for {
+		conn, err := sl.Listener.Accept()
+		if err != nil {
+			sl.err = err
+			sl.closeOnce.Do(func() { close(sl.done) })
+			return
+		}
+
+		select {
+		case sl.conns <- conn:
+		case <-sl.done:
+			conn.Close()
+			return
+		}
+	}
+}
+
+// attach returns a listener for a new server.
+func (sl *sharedListener) attach() net.Listener {
+	return &attachedListener{
+		shared: sl,
+		closed: make(chan struct{}),
+	}
+}
+
+// failed returns whether the socket fails to accept.
+func (sl *sharedListener) failed() bool {
+	select {
+	case <-sl.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close closes the socket, the attached listeners fail to accept then.
+func (sl *sharedListener) Close() error {
+	err := sl.Listener.Close()
+	<-sl.done
+	return err
+}
+
+func (al *attachedListener) Accept() (net.Conn, error) {
+	select {
+	case <-al.closed:
+		return nil, net.ErrClosed
+	default:
+	}
+
+	select {
+	case conn := <-al.shared.conns:
+		return conn, nil
+	case <-al.closed:
+		return nil, net.ErrClosed
+	case <-al.shared.done:
+		return nil, al.shared.err
+	}
+}
+
+func (al *attachedListener) Close() error {
+	al.closeOnce.Do(func() { close(al.closed) })
+	return nil
+}
+
+func (al *attachedListener) Addr() net.Addr {
+	return al.shared.Addr()
+}
@@ -349,13 +349,19 @@ func (m *mux) reloadRules(superSpec *supervisor.Spec, muxMapper protocol.MuxMapp
 	m.rules.Store(rules)
 }
 
+// droppedTraces returns the number of traces dropped by the bound of
+// always sampling of the current tracing.
+func (m *mux) droppedTraces() uint64 {
+	return m.rules.Load().(*muxRules).tracer.DroppedSamples()
+}
+
 func (m *mux) ServeHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 	rules := m.rules.Load().(*muxRules)
 
 	ctx := context.New(stdw, stdr, rules.tracer, rules.superSpec.Name())
 	defer ctx.Finish()
 	ctx.OnFinish(func() {
-		ctx.Span().Finish()
+		ctx.Span().FinishWithStatus(ctx.Response().StatusCode())
 		m.httpStat.Stat(ctx.StatMetric())
 		m.topN.Stat(ctx)
 	})
@@ -371,6 +377,10 @@ func (m *mux) ServeHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 		return
 	}
 
+	// NOTE: The paths with the same URL could serve different methods,
+	// so it responds 405 only if no path matches the method.
+	var methodNotAllowedPath *muxPath
+
 	for _, host := range rules.rules {
 		if !host.match(ctx) {
 			continue
@@ -387,10 +397,10 @@ func (m *mux) ServeHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 			}
 
 			if !path.matchMethod(ctx) {
-				ci = &cacheItem{ipFilterChan: path.ipFilterChain, methodNotAllowed: true}
-				rules.putCacheItem(ctx, ci)
-				m.handleRequestWithCache(rules, ctx, ci)
-				return
+				if methodNotAllowedPath == nil {
+					methodNotAllowedPath = path
+				}
+				continue
 			}
 
 			if !path.pass(ctx) {
@@ -414,7 +424,11 @@ func (m *mux) ServeHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 		}
 	}
 
-	ci = &cacheItem{ipFilterChan: rules.ipFilterChan, notFound: true}
+	if methodNotAllowedPath != nil {
+		ci = &cacheItem{ipFilterChan: methodNotAllowedPath.ipFilterChain, methodNotAllowed: true}
+	} else {
+		ci = &cacheItem{ipFilterChan: rules.ipFilterChan, notFound: true}
+	}
 	rules.putCacheItem(ctx, ci)
 	m.handleRequestWithCache(rules, ctx, ci)
 }
@@ -18,6 +18,7 @@
 package httpserver
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	"reflect"
@@ -37,6 +38,10 @@ import (
 
 const (
 	defaultKeepAliveTimeout = 60 * time.Second
+	// defaultDrainTimeout is the same as the keep-alive timeout, so that the
+	// idle keep-alive connections of the old server expire by themselves
+	// instead of being closed after reloading.
+	defaultDrainTimeout = defaultKeepAliveTimeout
 
 	checkFailedTimeout = 10 * time.Second
 
@@ -75,6 +80,16 @@ type (
 		mux       *mux
 		startNum  uint64
 		eventChan chan interface{}
+		closed    chan struct{}
+
+		// listener is the socket shared by the servers of the same port,
+		// the old server is detached from it when the server restarts.
+		listener     *sharedListener
+		listenerPort uint16
+
+		// tlsConfig is picked for every TLS handshake, so the certificates
+		// are rotated without restarting the server.
+		tlsConfig atomic.Value // *tls.Config
 
 		// status
 		state atomic.Value // stateType
@@ -94,6 +109,10 @@ type (
 
 		*httpstat.Status
 		TopN *topn.Status `yaml:"topN"`
+
+		// DroppedTraces is the number of failed or slow requests not
+		// sampled because of tracing.alwaysSample.maxPerSecond.
+		DroppedTraces uint64 `yaml:"droppedTraces,omitempty"`
 	}
 )
 
@@ -101,6 +120,7 @@ func newRuntime(superSpec *supervisor.Spec, muxMapper protocol.MuxMapper) *runti
 	r := &runtime{
 		superSpec: superSpec,
 		eventChan: make(chan interface{}, 10),
+		closed:    make(chan struct{}),
 		httpStat:  httpstat.New(),
 		topN:      topn.New(topNum),
 	}
@@ -132,6 +152,8 @@ func (r *runtime) Status() *Status {
 		Error:  r.getError().Error(),
 		Status: r.httpStat.Status(),
 		TopN:   r.topN.Status(),
+
+		DroppedTraces: r.mux.droppedTraces(),
 	}
 }
 
@@ -168,6 +190,15 @@ func (r *runtime) reload(nextSuperSpec *supervisor.Spec, muxMapper protocol.MuxM
 		r.limitListener.SetMaxConnection(nextSpec.MaxConnections)
 	}
 
+	if nextSpec != nil && nextSpec.HTTPS {
+		tlsConfig, err := nextSpec.tlsConfig()
+		if err != nil {
+			logger.Errorf("BUG: build tls config failed: %v", err)
+		} else {
+			r.tlsConfig.Store(tlsConfig)
+		}
+	}
+
 	// NOTE: Due to the mechanism of supervisor,
 	// nextSpec must not be nil, just defensive programming here.
 	switch {
@@ -183,9 +214,14 @@ func (r *runtime) reload(nextSuperSpec *supervisor.Spec, muxMapper protocol.MuxM
 		r.closeServer()
 	case r.spec != nil && nextSpec != nil:
 		if r.needRestartServer(nextSpec) {
+			http3 := r.spec.HTTP3 || nextSpec.HTTP3
 			r.spec = nextSpec
-			r.closeServer()
-			r.startServer()
+			if http3 {
+				r.closeServer()
+				r.startServer()
+			} else {
+				r.restartServer()
+			}
 		} else {
 			r.spec = nextSpec
 		}
@@ -228,6 +264,17 @@ func (r *runtime) needRestartServer(nextSpec *Spec) bool {
 	x.Tracing, y.Tracing = nil, nil
 	x.IPFilter, y.IPFilter = nil, nil
 	x.Rules, y.Rules = nil, nil
+	x.DrainTimeout, y.DrainTimeout = "", ""
+
+	// NOTE: The certificates are picked for every TLS handshake except
+	// HTTP3, so rotating them need not restart the HTTP server.
+	if !x.HTTP3 {
+		x.CertBase64, y.CertBase64 = "", ""
+		x.KeyBase64, y.KeyBase64 = "", ""
+		x.Certs, y.Certs = nil, nil
+		x.Keys, y.Keys = nil, nil
+		x.CACertBase64, y.CACertBase64 = "", ""
+	}
 
 	// The update of rules need not to shutdown server.
 	return !reflect.DeepEqual(x, y)
@@ -253,8 +300,15 @@ func (r *runtime) startServer() {
 	srv.SetKeepAlivesEnabled(r.spec.KeepAlive)
 
 	if r.spec.HTTPS {
-		tlsConfig, _ := r.spec.tlsConfig()
-		srv.TLSConfig = tlsConfig
+		if r.spec.HTTP3 {
+			tlsConfig, _ := r.spec.tlsConfig()
+			srv.TLSConfig = tlsConfig
+		} else {
+			srv.TLSConfig = &tls.Config{
+				GetConfigForClient: r.getTLSConfig,
+				GetCertificate:     r.getCertificate,
+			}
+		}
 	}
 
 	r.server = srv
@@ -268,20 +322,104 @@ func (r *runtime) startServer() {
 		}
 		go r.runHTTP3Server(r.startNum)
 	} else {
-		listener, err := gnet.Listen("tcp", fmt.Sprintf(":%d", r.spec.Port))
-		if err != nil {
-			r.setState(stateFailed)
-			r.setError(err)
+		if r.listener != nil && r.listener.failed() {
+			r.listener.Close()
+			r.listener = nil
+		}
 
-			return
+		if r.listener == nil {
+			listener, err := gnet.Listen("tcp", fmt.Sprintf(":%d", r.spec.Port))
+			if err != nil {
+				r.setState(stateFailed)
+				r.setError(err)
+
+				return
+			}
+			r.listener = newSharedListener(listener)
+			r.listenerPort = r.spec.Port
 		}
 
-		limitListener := limitlistener.NewLimitListener(listener, r.spec.MaxConnections)
+		limitListener := limitlistener.NewLimitListener(r.listener.attach(), r.spec.MaxConnections)
 		r.limitListener = limitListener
 		go r.runHTTP1And2Server(limitListener, r.spec.HTTPS, r.startNum)
 	}
 }
 
+// restartServer brings up the server of the new spec before closing the
+// old one. The new server takes over the socket if the port is unchanged,
+// otherwise it listens on the new port before the old socket is closed.
+// The old server stops accepting at once, but keeps serving its
+// connections, including the idle keep-alive ones, for the drain window
+// before it's shut down.
+func (r *runtime) restartServer() {
+	oldServer, oldListener, oldLimitListener := r.server, r.listener, r.limitListener
+	if r.listenerPort != r.spec.Port {
+		r.listener = nil
+	}
+
+	r.startServer()
+
+	if oldLimitListener != nil {
+		oldLimitListener.Close()
+	}
+	if oldListener != nil && oldListener != r.listener {
+		oldListener.Close()
+	}
+	if oldServer != nil {
+		go r.drainServer(oldServer, r.superSpec.Name(), r.drainTimeout())
+	}
+}
+
+func (r *runtime) drainTimeout() time.Duration {
+	if r.spec.DrainTimeout == "" {
+		return defaultDrainTimeout
+	}
+
+	t, err := time.ParseDuration(r.spec.DrainTimeout)
+	if err != nil {
+		logger.Errorf("BUG: parse duration %s failed: %v", r.spec.DrainTimeout, err)
+		return defaultDrainTimeout
+	}
+	return t
+}
+
+// drainServer shuts down the server after the drain window, or at once if
+// the runtime is closed.
+func (r *runtime) drainServer(server *http.Server, name string, drainTimeout time.Duration) {
+	timer := time.NewTimer(drainTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-r.closed:
+	}
+
+	ctx, cancelFunc := serverShutdownContext()
+	defer cancelFunc()
+	err := server.Shutdown(ctx)
+	if err != nil {
+		logger.Warnf("shutdown drained http1/2 server %s failed: %v", name, err)
+	}
+}
+
+func (r *runtime) getTLSConfig(*tls.ClientHelloInfo) (*tls.Config, error) {
+	tlsConfig, ok := r.tlsConfig.Load().(*tls.Config)
+	if !ok {
+		return nil, fmt.Errorf("tls config is not ready")
+	}
+	return tlsConfig, nil
+}
+
+// getCertificate is a fallback never called in practice, because
+// getTLSConfig always returns the config with the certificates.
+func (r *runtime) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	tlsConfig, err := r.getTLSConfig(hello)
+	if err != nil {
+		return nil, err
+	}
+	return &tlsConfig.Certificates[0], nil
+}
+
 func (r *runtime) runHTTP3Server(startNum uint64) {
 	err := r.server3.ListenAndServe()
 	if err != http.ErrServerClosed {
@@ -328,6 +466,11 @@ func (r *runtime) closeServer() {
 				r.superSpec.Name(), err)
 		}
 	}
+
+	if r.listener != nil {
+		r.listener.Close()
+		r.listener = nil
+	}
 }
 
 func (r *runtime) checkFailed() {
@@ -363,6 +506,7 @@ func (r *runtime) handleEventReload(e *eventReload) {
 
 func (r *runtime) handleEventClose(e *eventClose) {
 	r.closeServer()
+	close(r.closed)
 	r.mux.close()
 	close(e.done)
 }
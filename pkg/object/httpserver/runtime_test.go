@@ -0,0 +1,217 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocol"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+type (
+	testHandler func(ctx context.HTTPContext)
+
+	testMuxMapper struct {
+		handler protocol.HTTPHandler
+	}
+)
+
+func (h testHandler) Handle(ctx context.HTTPContext) {
+	h(ctx)
+}
+
+func (m *testMuxMapper) GetHandler(name string) (protocol.HTTPHandler, bool) {
+	return m.handler, true
+}
+
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func newTestServerSpec(t *testing.T, port int, keepAliveTimeout string) *supervisor.Spec {
+	yamlConfig := fmt.Sprintf(`
+kind: HTTPServer
+name: test-server
+port: %d
+keepAlive: true
+keepAliveTimeout: %s
+https: false
+rules:
+  - paths:
+    - pathPrefix: /
+      backend: test-pipeline`, port, keepAliveTimeout)
+
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	if err != nil {
+		t.Fatalf("new spec failed: %v", err)
+	}
+	return superSpec
+}
+
+// get sends a request with the client, and reports whether the connection
+// is reused.
+func get(t *testing.T, client *http.Client, url string) (string, bool) {
+	reused := false
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			reused = info.Reused
+		},
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Errorf("request %s failed: %v", url, err)
+		return "", false
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	return string(body), reused
+}
+
+func TestRuntimeGracefulRestart(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	mapper := &testMuxMapper{
+		handler: testHandler(func(ctx context.HTTPContext) {
+			if ctx.Request().Path() == "/slow" {
+				close(entered)
+				<-release
+			}
+			ctx.Response().SetBody(strings.NewReader("ok"))
+		}),
+	}
+
+	port := freePort(t)
+	url := fmt.Sprintf("http://127.0.0.1:%d", port)
+
+	r := newRuntime(newTestServerSpec(t, port, "60s"), mapper)
+	defer r.Close()
+	r.reload(newTestServerSpec(t, port, "60s"), mapper)
+
+	keepAliveClient := &http.Client{Transport: &http.Transport{}}
+	if body, _ := get(t, keepAliveClient, url+"/"); body != "ok" {
+		t.Fatalf("want ok, got %q", body)
+	}
+
+	slowDone := make(chan string)
+	go func() {
+		body, _ := get(t, &http.Client{Transport: &http.Transport{}}, url+"/slow")
+		slowDone <- body
+	}()
+	<-entered
+
+	// The change of keep-alive timeout restarts the server on the same port.
+	r.reload(newTestServerSpec(t, port, "30s"), mapper)
+
+	if body, _ := get(t, &http.Client{Transport: &http.Transport{}}, url+"/"); body != "ok" {
+		t.Errorf("new connection should be served by the new server, got %q", body)
+	}
+
+	body, reused := get(t, keepAliveClient, url+"/")
+	if body != "ok" || !reused {
+		t.Errorf("keep-alive connection should survive the restart, body %q, reused %v", body, reused)
+	}
+
+	close(release)
+	select {
+	case body := <-slowDone:
+		if body != "ok" {
+			t.Errorf("in-flight request should be finished, got %q", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("in-flight request is not finished")
+	}
+}
+
+func TestRuntimeGracefulRestartWithNewPort(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	mapper := &testMuxMapper{
+		handler: testHandler(func(ctx context.HTTPContext) {
+			if ctx.Request().Path() == "/slow" {
+				close(entered)
+				<-release
+			}
+			ctx.Response().SetBody(strings.NewReader("ok"))
+		}),
+	}
+
+	oldPort, newPort := freePort(t), freePort(t)
+	oldURL := fmt.Sprintf("http://127.0.0.1:%d", oldPort)
+	newURL := fmt.Sprintf("http://127.0.0.1:%d", newPort)
+
+	r := newRuntime(newTestServerSpec(t, oldPort, "60s"), mapper)
+	defer r.Close()
+	r.reload(newTestServerSpec(t, oldPort, "60s"), mapper)
+
+	slowDone := make(chan string)
+	go func() {
+		body, _ := get(t, &http.Client{Transport: &http.Transport{}}, oldURL+"/slow")
+		slowDone <- body
+	}()
+	<-entered
+
+	nextSpec := newTestServerSpec(t, newPort, "60s")
+	nextSpec.ObjectSpec().(*Spec).DrainTimeout = "100ms"
+	r.reload(nextSpec, mapper)
+
+	if body, _ := get(t, &http.Client{Transport: &http.Transport{}}, newURL+"/"); body != "ok" {
+		t.Errorf("new port should be served, got %q", body)
+	}
+
+	_, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", oldPort), time.Second)
+	if err == nil {
+		t.Errorf("old port should be closed")
+	}
+
+	// The in-flight request outlives the drain window, the shutdown waits
+	// for it.
+	time.Sleep(200 * time.Millisecond)
+	close(release)
+	select {
+	case body := <-slowDone:
+		if body != "ok" {
+			t.Errorf("in-flight request should be finished, got %q", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("in-flight request is not finished")
+	}
+}
@@ -19,6 +19,7 @@ package httpserver
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"fmt"
 	"regexp"
@@ -40,6 +41,11 @@ type (
 		XForwardedFor    bool          `yaml:"xForwardedFor" jsonschema:"omitempty"`
 		Tracing          *tracing.Spec `yaml:"tracing" jsonschema:"omitempty"`
 
+		// DrainTimeout is how long the old server keeps serving its
+		// connections after the server restarts for a changed spec,
+		// default is the default keep-alive timeout.
+		DrainTimeout string `yaml:"drainTimeout,omitempty" jsonschema:"omitempty,format=duration"`
+
 		// Support multiple certs, preserve the certbase64 and keybase64
 		// for backward compatibility
 		CertBase64 string `yaml:"certBase64" jsonschema:"omitempty,format=base64"`
@@ -50,6 +56,10 @@ type (
 		// Keys saved as map, key is domain name, value is secret
 		Keys map[string]string `yaml:"keys" jsonschema:"omitempty"`
 
+		// CACertBase64 is the CA to verify the client certificates, the
+		// clients presenting no valid certificate are rejected if it is set.
+		CACertBase64 string `yaml:"caCertBase64,omitempty" jsonschema:"omitempty,format=base64"`
+
 		IPFilter *ipfilter.Spec `yaml:"ipFilter,omitempty" jsonschema:"omitempty"`
 		Rules    []*Rule        `yaml:"rules" jsonschema:"omitempty"`
 	}
@@ -100,6 +110,10 @@ func (spec *Spec) Validate() error {
 		return fmt.Errorf("https is disabled when http3 enabled")
 	}
 
+	if spec.CACertBase64 != "" && !spec.HTTPS {
+		return fmt.Errorf("https is disabled when caCertBase64 is set")
+	}
+
 	if spec.HTTPS {
 		if spec.CertBase64 == "" && spec.KeyBase64 == "" && len(spec.Certs) == 0 && len(spec.Keys) == 0 {
 			return fmt.Errorf("certBase64/keyBase64, certs/keys are both empty when https enabled")
@@ -142,7 +156,22 @@ func (spec *Spec) tlsConfig() (*tls.Config, error) {
 		return nil, fmt.Errorf("none valid certs and secret")
 	}
 
-	return &tls.Config{Certificates: certificates}, nil
+	tlsConfig := &tls.Config{
+		Certificates: certificates,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+
+	if spec.CACertBase64 != "" {
+		caCertPem, _ := base64.StdEncoding.DecodeString(spec.CACertBase64)
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCertPem) {
+			return nil, fmt.Errorf("none valid certs in caCertBase64")
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
 }
 
 func (h *Header) initHeaderRoute() {
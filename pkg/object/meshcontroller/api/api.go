@@ -23,6 +23,9 @@ import (
 	"io"
 	"net/http"
 
+	yamljsontool "github.com/ghodss/yaml"
+	yaml "gopkg.in/yaml.v2"
+
 	"github.com/megaease/easegress/pkg/api"
 	"github.com/megaease/easegress/pkg/object/meshcontroller/service"
 	"github.com/megaease/easegress/pkg/supervisor"
@@ -39,6 +42,20 @@ const (
 	// MeshTenantPath is the mesh tenant path.
 	MeshTenantPath = "/mesh/tenants/{tenantName}"
 
+	// MeshTenantDefaultResiliencePath is the mesh tenant default resilience path.
+	MeshTenantDefaultResiliencePath = "/mesh/tenants/{tenantName}/defaultresilience"
+
+	// MeshTenantExportedServicesPath is the mesh tenant path of the services
+	// exported to other tenants.
+	MeshTenantExportedServicesPath = "/mesh/tenants/{tenantName}/exportedservices"
+
+	// MeshTenantConsistencyPath is the mesh path to check the consistency
+	// between tenants and services.
+	MeshTenantConsistencyPath = "/mesh/diagnostics/tenants"
+
+	// MeshStatusPath is the mesh status path.
+	MeshStatusPath = "/mesh/status"
+
 	// MeshIngressPrefix is the mesh ingress prefix.
 	MeshIngressPrefix = "/mesh/ingresses"
 
@@ -51,6 +68,13 @@ const (
 	// MeshServicePath is the mesh service path.
 	MeshServicePath = "/mesh/services/{serviceName}"
 
+	// MeshServiceAliasesPath is the mesh service aliases path.
+	MeshServiceAliasesPath = "/mesh/services/{serviceName}/aliases"
+
+	// MeshServiceAllowedCallersPath is the mesh service path of the callers
+	// allowed from other tenants.
+	MeshServiceAllowedCallersPath = "/mesh/services/{serviceName}/allowedcallers"
+
 	// MeshServiceCanaryPath is the mesh service canary path.
 	MeshServiceCanaryPath = "/mesh/services/{serviceName}/canary"
 
@@ -60,24 +84,128 @@ const (
 	// MeshServiceResiliencePath is the mesh service resilience path.
 	MeshServiceResiliencePath = "/mesh/services/{serviceName}/resilience"
 
+	// MeshServiceResilienceSpecPath is the mesh service resilience path in
+	// the yaml spec, which carries the options the pb spec doesn't.
+	MeshServiceResilienceSpecPath = "/mesh/services/{serviceName}/resilience/spec"
+
+	// MeshServiceEffectiveResiliencePath is the mesh service effective resilience path,
+	// which merges the default resilience of its tenant.
+	MeshServiceEffectiveResiliencePath = "/mesh/services/{serviceName}/resilience/effective"
+
 	// MeshServiceLoadBalancePath is the mesh service load balance path.
 	MeshServiceLoadBalancePath = "/mesh/services/{serviceName}/loadbalance"
 
+	// MeshServiceConsistentHashPath is the mesh service consistent hash load balance path.
+	MeshServiceConsistentHashPath = "/mesh/services/{serviceName}/loadbalance/consistenthash"
+
 	// MeshServiceOutputServerPath is the mesh service output server path.
 	MeshServiceOutputServerPath = "/mesh/services/{serviceName}/outputserver"
 
+	// MeshServiceOutputServerSecurityPath is the mesh service output server security path.
+	MeshServiceOutputServerSecurityPath = "/mesh/services/{serviceName}/outputserver/security"
+
+	// MeshServiceAccessLogPath is the mesh service access log path.
+	MeshServiceAccessLogPath = "/mesh/services/{serviceName}/accesslog"
+
 	// MeshServiceTracingsPath is the mesh service tracings path.
 	MeshServiceTracingsPath = "/mesh/services/{serviceName}/tracings"
 
+	// MeshServiceTracePropagationPath is the mesh service trace context propagation path.
+	MeshServiceTracePropagationPath = "/mesh/services/{serviceName}/tracings/propagation"
+
+	// MeshServiceTraceBaggagePath is the mesh service tracing baggage path.
+	MeshServiceTraceBaggagePath = "/mesh/services/{serviceName}/tracings/baggage"
+
+	// MeshServiceTraceAlwaysSamplePath is the mesh service tracing always sample path.
+	MeshServiceTraceAlwaysSamplePath = "/mesh/services/{serviceName}/tracings/alwayssample"
+
 	// MeshServiceMetricsPath is the mesh service metrics path.
 	MeshServiceMetricsPath = "/mesh/services/{serviceName}/metrics"
 
+	// MeshServiceMetricsOutputPath is the mesh service metrics output path.
+	MeshServiceMetricsOutputPath = "/mesh/services/{serviceName}/metrics/output"
+
+	// MeshServiceDryRunPath is the mesh service dry run path.
+	MeshServiceDryRunPath = "/mesh/services/{serviceName}/dryrun"
+
+	// MeshServiceLintPath is the mesh service path to lint the spec.
+	MeshServiceLintPath = "/mesh/services/{serviceName}/lint"
+
+	// MeshServiceRestorePath is the mesh service path to restore the soft-deleted service.
+	MeshServiceRestorePath = "/mesh/services/{serviceName}/restore"
+
+	// MeshServicePipelinesPath is the mesh service generated pipelines path.
+	MeshServicePipelinesPath = "/mesh/services/{serviceName}/pipelines"
+
+	// MeshServiceEgressRoutesPath is the mesh service egress routes path.
+	MeshServiceEgressRoutesPath = "/mesh/services/{serviceName}/egressroutes"
+
+	// MeshServiceHeaderManipulationPath is the mesh service header manipulation path.
+	MeshServiceHeaderManipulationPath = "/mesh/services/{serviceName}/headermanipulation"
+
+	// MeshServiceCanaryPropagationPath is the mesh service canary propagation path.
+	MeshServiceCanaryPropagationPath = "/mesh/services/{serviceName}/canarypropagation"
+
+	// MeshServiceDeadlinePropagationPath is the mesh service deadline propagation path.
+	MeshServiceDeadlinePropagationPath = "/mesh/services/{serviceName}/deadlinepropagation"
+
+	// MeshServiceConnectionPoolPath is the mesh service connection pool path.
+	MeshServiceConnectionPoolPath = "/mesh/services/{serviceName}/connectionpool"
+
+	// MeshServiceFallbackPath is the mesh service fallback path.
+	MeshServiceFallbackPath = "/mesh/services/{serviceName}/fallback"
+
+	// MeshServiceFaultInjectionPath is the mesh service fault injection path.
+	MeshServiceFaultInjectionPath = "/mesh/services/{serviceName}/faultinjection"
+
+	// MeshServiceLimitsPath is the mesh service body size limits path.
+	MeshServiceLimitsPath = "/mesh/services/{serviceName}/limits"
+
+	// MeshServiceMirrorPath is the mesh service traffic mirror path.
+	MeshServiceMirrorPath = "/mesh/services/{serviceName}/mirror"
+
+	// MeshServiceHealthCheckPath is the mesh service health check path.
+	MeshServiceHealthCheckPath = "/mesh/services/{serviceName}/healthcheck"
+
+	// MeshServiceCompressionPath is the mesh service response compression path.
+	MeshServiceCompressionPath = "/mesh/services/{serviceName}/compression"
+
+	// MeshServiceAuthenticationPath is the mesh service authentication path.
+	MeshServiceAuthenticationPath = "/mesh/services/{serviceName}/authentication"
+
+	// MeshServiceSidecarMTLSPath is the mesh service sidecar mTLS path.
+	MeshServiceSidecarMTLSPath = "/mesh/services/{serviceName}/sidecar/mtls"
+
+	// MeshServiceCanaryRulesPath is the mesh service canary rules path.
+	MeshServiceCanaryRulesPath = "/mesh/services/{serviceName}/canary/rules"
+
+	// MeshServiceCanaryBypassPath is the mesh service canary bypass path.
+	MeshServiceCanaryBypassPath = "/mesh/services/{serviceName}/canary/bypass"
+
+	// MeshServiceDegradationProfilesPath is the mesh service degradation profiles path.
+	MeshServiceDegradationProfilesPath = "/mesh/services/{serviceName}/degradationprofiles"
+
+	// MeshServiceActiveDegradationProfilePath is the mesh service active degradation profile path.
+	MeshServiceActiveDegradationProfilePath = "/mesh/services/{serviceName}/degradationprofiles/active"
+
+	// MeshSecretsPath is the mesh secrets path.
+	MeshSecretsPath = "/mesh/secrets"
+
+	// MeshSecretPath is the mesh secret path.
+	MeshSecretPath = "/mesh/secrets/{secretName}"
+
 	// MeshServiceInstancePrefix is the mesh service prefix.
 	MeshServiceInstancePrefix = "/mesh/serviceinstances"
 
 	// MeshServiceInstancePath is the mesh service path.
 	MeshServiceInstancePath = "/mesh/serviceinstances/{serviceName}/{instanceID}"
 
+	// MeshServiceInstanceStatusPrefix is the mesh service instance status prefix.
+	MeshServiceInstanceStatusPrefix = "/mesh/serviceinstancestatuses"
+
+	// MeshServiceInstanceStatusPath is the mesh service instance status path.
+	MeshServiceInstanceStatusPath = "/mesh/serviceinstancestatuses/{serviceName}/{instanceID}"
+
 	// MeshCustomResourceKindPrefix is the mesh custom resource kind prefix.
 	MeshCustomResourceKindPrefix = "/mesh/customresourcekinds"
 
@@ -95,12 +223,16 @@ const (
 
 	// MeshWatchCustomResource is the path to watch custom resources of a specified kind
 	MeshWatchCustomResource = "/mesh/watchcustomresources/{kind}"
+
+	// MeshWatchCustomResourceEvents is the path to watch change events of custom resources of a specified kind
+	MeshWatchCustomResourceEvents = "/mesh/watchcustomresourceevents/{kind}"
 )
 
 type (
 	// API is the struct with the service
 	API struct {
-		service *service.Service
+		service        *service.Service
+		meshStatusFunc MeshStatusFunc
 	}
 )
 
@@ -131,6 +263,13 @@ func (a *API) registerAPIs() {
 			{Path: MeshTenantPath, Method: "GET", Handler: a.getTenant},
 			{Path: MeshTenantPath, Method: "PUT", Handler: a.updateTenant},
 			{Path: MeshTenantPath, Method: "DELETE", Handler: a.deleteTenant},
+			{Path: MeshTenantDefaultResiliencePath, Method: "GET", Handler: a.getTenantDefaultResilience},
+			{Path: MeshTenantDefaultResiliencePath, Method: "PUT", Handler: a.updateTenantDefaultResilience},
+			{Path: MeshTenantDefaultResiliencePath, Method: "DELETE", Handler: a.deleteTenantDefaultResilience},
+			{Path: MeshTenantExportedServicesPath, Method: "GET", Handler: a.getTenantExportedServices},
+			{Path: MeshTenantExportedServicesPath, Method: "PUT", Handler: a.updateTenantExportedServices},
+			{Path: MeshTenantConsistencyPath, Method: "GET", Handler: a.checkTenantConsistency},
+			{Path: MeshStatusPath, Method: "GET", Handler: a.getMeshStatus},
 			{Path: MeshIngressPrefix, Method: "GET", Handler: a.listIngresses},
 			{Path: MeshIngressPrefix, Method: "POST", Handler: a.createIngress},
 			{Path: MeshIngressPath, Method: "GET", Handler: a.getIngress},
@@ -141,12 +280,27 @@ func (a *API) registerAPIs() {
 			{Path: MeshServicePath, Method: "GET", Handler: a.getService},
 			{Path: MeshServicePath, Method: "PUT", Handler: a.updateService},
 			{Path: MeshServicePath, Method: "DELETE", Handler: a.deleteService},
+			{Path: MeshServiceDryRunPath, Method: "POST", Handler: a.dryRunService},
+			{Path: MeshServiceLintPath, Method: "POST", Handler: a.lintService},
+			{Path: MeshServicePipelinesPath, Method: "GET", Handler: a.inspectServicePipelines},
+			{Path: MeshServiceRestorePath, Method: "POST", Handler: a.restoreService},
+			{Path: MeshServiceAliasesPath, Method: "GET", Handler: a.getSpecPartOfService(aliasesMeta)},
+			{Path: MeshServiceAliasesPath, Method: "PUT", Handler: a.updateSpecPartOfService(aliasesMeta)},
+			{Path: MeshServiceAllowedCallersPath, Method: "GET", Handler: a.getSpecPartOfService(allowedCallersMeta)},
+			{Path: MeshServiceAllowedCallersPath, Method: "PUT", Handler: a.updateSpecPartOfService(allowedCallersMeta)},
+
+			{Path: MeshSecretsPath, Method: "GET", Handler: a.listSecrets},
+			{Path: MeshSecretPath, Method: "PUT", Handler: a.updateSecret},
+			{Path: MeshSecretPath, Method: "DELETE", Handler: a.deleteSecret},
 
 			// TODO: API to get instances of one service.
 
 			{Path: MeshServiceInstancePrefix, Method: "GET", Handler: a.listServiceInstanceSpecs},
+			{Path: MeshServiceInstancePrefix, Method: "POST", Handler: a.bulkRegisterServiceInstances},
 			{Path: MeshServiceInstancePath, Method: "GET", Handler: a.getServiceInstanceSpec},
 			{Path: MeshServiceInstancePath, Method: "DELETE", Handler: a.offlineServiceInstance},
+			{Path: MeshServiceInstanceStatusPrefix, Method: "GET", Handler: a.listServiceInstanceStatuses},
+			{Path: MeshServiceInstanceStatusPath, Method: "GET", Handler: a.getServiceInstanceStatus},
 
 			{Path: MeshServiceCanaryPath, Method: "POST", Handler: a.createPartOfService(canaryMeta)},
 			{Path: MeshServiceCanaryPath, Method: "GET", Handler: a.getPartOfService(canaryMeta)},
@@ -162,27 +316,120 @@ func (a *API) registerAPIs() {
 			{Path: MeshServiceResiliencePath, Method: "GET", Handler: a.getPartOfService(resilienceMeta)},
 			{Path: MeshServiceResiliencePath, Method: "PUT", Handler: a.updatePartOfService(resilienceMeta)},
 			{Path: MeshServiceResiliencePath, Method: "DELETE", Handler: a.deletePartOfService(resilienceMeta)},
+			{Path: MeshServiceResilienceSpecPath, Method: "GET", Handler: a.getSpecPartOfService(resilienceSpecMeta)},
+			{Path: MeshServiceResilienceSpecPath, Method: "PUT", Handler: a.updateSpecPartOfService(resilienceSpecMeta)},
+			{Path: MeshServiceEffectiveResiliencePath, Method: "GET", Handler: a.getEffectiveResilience},
 
 			{Path: MeshServiceLoadBalancePath, Method: "POST", Handler: a.createPartOfService(loadBalanceMeta)},
 			{Path: MeshServiceLoadBalancePath, Method: "GET", Handler: a.getPartOfService(loadBalanceMeta)},
 			{Path: MeshServiceLoadBalancePath, Method: "PUT", Handler: a.updatePartOfService(loadBalanceMeta)},
 			{Path: MeshServiceLoadBalancePath, Method: "DELETE", Handler: a.deletePartOfService(loadBalanceMeta)},
+			{Path: MeshServiceConsistentHashPath, Method: "GET", Handler: a.getSpecPartOfService(consistentHashMeta)},
+			{Path: MeshServiceConsistentHashPath, Method: "PUT", Handler: a.updateSpecPartOfService(consistentHashMeta)},
 
 			{Path: MeshServiceOutputServerPath, Method: "POST", Handler: a.createPartOfService(outputServerMeta)},
 			{Path: MeshServiceOutputServerPath, Method: "GET", Handler: a.getPartOfService(outputServerMeta)},
 			{Path: MeshServiceOutputServerPath, Method: "PUT", Handler: a.updatePartOfService(outputServerMeta)},
 			{Path: MeshServiceOutputServerPath, Method: "DELETE", Handler: a.deletePartOfService(outputServerMeta)},
 
+			{Path: MeshServiceOutputServerSecurityPath, Method: "GET", Handler: a.getSpecPartOfService(outputServerSecurityMeta)},
+			{Path: MeshServiceOutputServerSecurityPath, Method: "PUT", Handler: a.updateSpecPartOfService(outputServerSecurityMeta)},
+			{Path: MeshServiceOutputServerSecurityPath, Method: "DELETE", Handler: a.deletePartOfService(outputServerSecurityMeta)},
+
+			{Path: MeshServiceAccessLogPath, Method: "GET", Handler: a.getSpecPartOfService(accessLogMeta)},
+			{Path: MeshServiceAccessLogPath, Method: "PUT", Handler: a.updateSpecPartOfService(accessLogMeta)},
+			{Path: MeshServiceAccessLogPath, Method: "DELETE", Handler: a.deletePartOfService(accessLogMeta)},
+
 			{Path: MeshServiceTracingsPath, Method: "POST", Handler: a.createPartOfService(tracingsMeta)},
 			{Path: MeshServiceTracingsPath, Method: "GET", Handler: a.getPartOfService(tracingsMeta)},
 			{Path: MeshServiceTracingsPath, Method: "PUT", Handler: a.updatePartOfService(tracingsMeta)},
 			{Path: MeshServiceTracingsPath, Method: "DELETE", Handler: a.deletePartOfService(tracingsMeta)},
 
+			{Path: MeshServiceTracePropagationPath, Method: "GET", Handler: a.getSpecPartOfService(tracePropagationMeta)},
+			{Path: MeshServiceTracePropagationPath, Method: "PUT", Handler: a.updateSpecPartOfService(tracePropagationMeta)},
+			{Path: MeshServiceTracePropagationPath, Method: "DELETE", Handler: a.deletePartOfService(tracePropagationMeta)},
+
+			{Path: MeshServiceTraceBaggagePath, Method: "GET", Handler: a.getSpecPartOfService(traceBaggageMeta)},
+			{Path: MeshServiceTraceBaggagePath, Method: "PUT", Handler: a.updateSpecPartOfService(traceBaggageMeta)},
+			{Path: MeshServiceTraceBaggagePath, Method: "DELETE", Handler: a.deletePartOfService(traceBaggageMeta)},
+
+			{Path: MeshServiceTraceAlwaysSamplePath, Method: "GET", Handler: a.getSpecPartOfService(traceAlwaysSampleMeta)},
+			{Path: MeshServiceTraceAlwaysSamplePath, Method: "PUT", Handler: a.updateSpecPartOfService(traceAlwaysSampleMeta)},
+			{Path: MeshServiceTraceAlwaysSamplePath, Method: "DELETE", Handler: a.deletePartOfService(traceAlwaysSampleMeta)},
+
 			{Path: MeshServiceMetricsPath, Method: "POST", Handler: a.createPartOfService(metricsMeta)},
 			{Path: MeshServiceMetricsPath, Method: "GET", Handler: a.getPartOfService(metricsMeta)},
 			{Path: MeshServiceMetricsPath, Method: "PUT", Handler: a.updatePartOfService(metricsMeta)},
 			{Path: MeshServiceMetricsPath, Method: "DELETE", Handler: a.deletePartOfService(metricsMeta)},
 
+			{Path: MeshServiceMetricsOutputPath, Method: "GET", Handler: a.getSpecPartOfService(metricsOutputMeta)},
+			{Path: MeshServiceMetricsOutputPath, Method: "PUT", Handler: a.updateSpecPartOfService(metricsOutputMeta)},
+			{Path: MeshServiceMetricsOutputPath, Method: "DELETE", Handler: a.deletePartOfService(metricsOutputMeta)},
+
+			{Path: MeshServiceEgressRoutesPath, Method: "GET", Handler: a.getSpecPartOfService(egressRoutesMeta)},
+			{Path: MeshServiceEgressRoutesPath, Method: "PUT", Handler: a.updateSpecPartOfService(egressRoutesMeta)},
+
+			{Path: MeshServiceHeaderManipulationPath, Method: "GET", Handler: a.getSpecPartOfService(headerManipulationMeta)},
+			{Path: MeshServiceHeaderManipulationPath, Method: "PUT", Handler: a.updateSpecPartOfService(headerManipulationMeta)},
+			{Path: MeshServiceHeaderManipulationPath, Method: "DELETE", Handler: a.deletePartOfService(headerManipulationMeta)},
+
+			{Path: MeshServiceCanaryPropagationPath, Method: "GET", Handler: a.getSpecPartOfService(canaryPropagationMeta)},
+			{Path: MeshServiceCanaryPropagationPath, Method: "PUT", Handler: a.updateSpecPartOfService(canaryPropagationMeta)},
+			{Path: MeshServiceCanaryPropagationPath, Method: "DELETE", Handler: a.deletePartOfService(canaryPropagationMeta)},
+
+			{Path: MeshServiceDeadlinePropagationPath, Method: "GET", Handler: a.getSpecPartOfService(deadlinePropagationMeta)},
+			{Path: MeshServiceDeadlinePropagationPath, Method: "PUT", Handler: a.updateSpecPartOfService(deadlinePropagationMeta)},
+			{Path: MeshServiceDeadlinePropagationPath, Method: "DELETE", Handler: a.deletePartOfService(deadlinePropagationMeta)},
+
+			{Path: MeshServiceConnectionPoolPath, Method: "GET", Handler: a.getSpecPartOfService(connectionPoolMeta)},
+			{Path: MeshServiceConnectionPoolPath, Method: "PUT", Handler: a.updateSpecPartOfService(connectionPoolMeta)},
+			{Path: MeshServiceConnectionPoolPath, Method: "DELETE", Handler: a.deletePartOfService(connectionPoolMeta)},
+
+			{Path: MeshServiceFallbackPath, Method: "GET", Handler: a.getSpecPartOfService(fallbackMeta)},
+			{Path: MeshServiceFallbackPath, Method: "PUT", Handler: a.updateSpecPartOfService(fallbackMeta)},
+			{Path: MeshServiceFallbackPath, Method: "DELETE", Handler: a.deletePartOfService(fallbackMeta)},
+
+			{Path: MeshServiceFaultInjectionPath, Method: "GET", Handler: a.getSpecPartOfService(faultInjectionMeta)},
+			{Path: MeshServiceFaultInjectionPath, Method: "PUT", Handler: a.updateSpecPartOfService(faultInjectionMeta)},
+			{Path: MeshServiceFaultInjectionPath, Method: "DELETE", Handler: a.deletePartOfService(faultInjectionMeta)},
+
+			{Path: MeshServiceLimitsPath, Method: "GET", Handler: a.getSpecPartOfService(limitsMeta)},
+			{Path: MeshServiceLimitsPath, Method: "PUT", Handler: a.updateSpecPartOfService(limitsMeta)},
+			{Path: MeshServiceLimitsPath, Method: "DELETE", Handler: a.deletePartOfService(limitsMeta)},
+
+			{Path: MeshServiceMirrorPath, Method: "GET", Handler: a.getSpecPartOfService(mirrorMeta)},
+			{Path: MeshServiceMirrorPath, Method: "PUT", Handler: a.updateSpecPartOfService(mirrorMeta)},
+			{Path: MeshServiceMirrorPath, Method: "DELETE", Handler: a.deletePartOfService(mirrorMeta)},
+
+			{Path: MeshServiceHealthCheckPath, Method: "GET", Handler: a.getSpecPartOfService(healthCheckMeta)},
+			{Path: MeshServiceHealthCheckPath, Method: "PUT", Handler: a.updateSpecPartOfService(healthCheckMeta)},
+			{Path: MeshServiceHealthCheckPath, Method: "DELETE", Handler: a.deletePartOfService(healthCheckMeta)},
+
+			{Path: MeshServiceCompressionPath, Method: "GET", Handler: a.getSpecPartOfService(compressionMeta)},
+			{Path: MeshServiceCompressionPath, Method: "PUT", Handler: a.updateSpecPartOfService(compressionMeta)},
+			{Path: MeshServiceCompressionPath, Method: "DELETE", Handler: a.deletePartOfService(compressionMeta)},
+
+			{Path: MeshServiceAuthenticationPath, Method: "GET", Handler: a.getSpecPartOfService(authenticationMeta)},
+			{Path: MeshServiceAuthenticationPath, Method: "PUT", Handler: a.updateSpecPartOfService(authenticationMeta)},
+			{Path: MeshServiceAuthenticationPath, Method: "DELETE", Handler: a.deletePartOfService(authenticationMeta)},
+
+			{Path: MeshServiceSidecarMTLSPath, Method: "GET", Handler: a.getSpecPartOfService(sidecarMTLSMeta)},
+			{Path: MeshServiceSidecarMTLSPath, Method: "PUT", Handler: a.updateSpecPartOfService(sidecarMTLSMeta)},
+			{Path: MeshServiceSidecarMTLSPath, Method: "DELETE", Handler: a.deletePartOfService(sidecarMTLSMeta)},
+
+			{Path: MeshServiceCanaryRulesPath, Method: "GET", Handler: a.getSpecPartOfService(canaryRulesMeta)},
+			{Path: MeshServiceCanaryRulesPath, Method: "PUT", Handler: a.updateSpecPartOfService(canaryRulesMeta)},
+
+			{Path: MeshServiceCanaryBypassPath, Method: "GET", Handler: a.getSpecPartOfService(canaryBypassMeta)},
+			{Path: MeshServiceCanaryBypassPath, Method: "PUT", Handler: a.updateSpecPartOfService(canaryBypassMeta)},
+			{Path: MeshServiceCanaryBypassPath, Method: "DELETE", Handler: a.deletePartOfService(canaryBypassMeta)},
+
+			{Path: MeshServiceDegradationProfilesPath, Method: "GET", Handler: a.getSpecPartOfService(degradationProfilesMeta)},
+			{Path: MeshServiceDegradationProfilesPath, Method: "PUT", Handler: a.updateSpecPartOfService(degradationProfilesMeta)},
+			{Path: MeshServiceActiveDegradationProfilePath, Method: "GET", Handler: a.getActiveDegradationProfile},
+			{Path: MeshServiceActiveDegradationProfilePath, Method: "PUT", Handler: a.activateDegradationProfile},
+			{Path: MeshServiceActiveDegradationProfilePath, Method: "DELETE", Handler: a.deactivateDegradationProfile},
+
 			{Path: MeshCustomResourceKindPrefix, Method: "GET", Handler: a.listCustomResourceKinds},
 			{Path: MeshCustomResourceKindPrefix, Method: "POST", Handler: a.createCustomResourceKind},
 			{Path: MeshCustomResourceKind, Method: "GET", Handler: a.getCustomResourceKind},
@@ -197,6 +444,7 @@ func (a *API) registerAPIs() {
 			{Path: MeshCustomResource, Method: "DELETE", Handler: a.deleteCustomResource},
 
 			{Path: MeshWatchCustomResource, Method: "GET", Handler: a.watchCustomResources},
+			{Path: MeshWatchCustomResourceEvents, Method: "GET", Handler: a.watchCustomResourceEvents},
 		},
 	}
 
@@ -256,3 +504,40 @@ func (a *API) readAPISpec(r *http.Request, pbSpec interface{}, spec interface{})
 
 	return nil
 }
+
+// readSpecBody reads the spec not in the pb spec of the service, which is
+// in the json form of its yaml.
+func (a *API) readSpecBody(r *http.Request, spec interface{}) error {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("read body failed: %v", err)
+	}
+
+	err = yaml.Unmarshal(body, spec)
+	if err != nil {
+		return fmt.Errorf("unmarshal %s to spec failed: %v", string(body), err)
+	}
+
+	vr := v.Validate(spec)
+	if !vr.Valid() {
+		return fmt.Errorf("validate failed:\n%s", vr)
+	}
+
+	return nil
+}
+
+// writeYAMLSpecInJSON writes the spec in the json form of its yaml.
+func (a *API) writeYAMLSpecInJSON(w http.ResponseWriter, spec interface{}) {
+	yamlBuff, err := yaml.Marshal(spec)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", spec, err))
+	}
+
+	buff, err := yamljsontool.YAMLToJSON(yamlBuff)
+	if err != nil {
+		panic(fmt.Errorf("transform %s to json failed: %v", yamlBuff, err))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(buff)
+}
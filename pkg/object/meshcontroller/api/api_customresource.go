@@ -26,9 +26,8 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/megaease/easegress/pkg/api"
 	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/service"
 	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
-	"github.com/megaease/easemesh-api/v1alpha1"
-	"github.com/xeipuuv/gojsonschema"
 )
 
 func (a *API) readURLParam(r *http.Request, name string) (string, error) {
@@ -45,23 +44,9 @@ func (a *API) listCustomResourceKinds(w http.ResponseWriter, r *http.Request) {
 		return kinds[i].Name < kinds[j].Name
 	})
 
-	var pbKinds []*v1alpha1.CustomResourceKind
-	for _, v := range kinds {
-		kind := &v1alpha1.CustomResourceKind{}
-		err := a.convertSpecToPB(v, kind)
-		if err != nil {
-			logger.Errorf("convert spec %#v to pb spec failed: %v", v, err)
-			continue
-		}
-		pbKinds = append(pbKinds, kind)
-	}
-
-	err := json.NewEncoder(w).Encode(pbKinds)
-	if err != nil {
-		panic(fmt.Errorf("marshal %#v to json failed: %v", kinds, err))
-	}
-
-	w.Header().Set("Content-Type", "application/json")
+	// NOTE: The pb spec doesn't carry ApplyDefaults, so the kinds are
+	// written in the json form of their yaml.
+	a.writeYAMLSpecInJSON(w, kinds)
 }
 
 func (a *API) getCustomResourceKind(w http.ResponseWriter, r *http.Request) {
@@ -77,39 +62,20 @@ func (a *API) getCustomResourceKind(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	pbKind := &v1alpha1.CustomResourceKind{}
-	err = a.convertSpecToPB(kind, pbKind)
-	if err != nil {
-		panic(fmt.Errorf("convert spec %#v to pb failed: %v", kind, err))
-	}
-
-	err = json.NewEncoder(w).Encode(pbKind)
-	if err != nil {
-		panic(fmt.Errorf("marshal %#v to json failed: %v", pbKind, err))
-	}
-
-	w.Header().Set("Content-Type", "application/json")
+	a.writeYAMLSpecInJSON(w, kind)
 }
 
 func (a *API) saveCustomResourceKind(w http.ResponseWriter, r *http.Request, update bool) error {
-	pbKind := &v1alpha1.CustomResourceKind{}
+	// NOTE: The pb spec doesn't carry ApplyDefaults, so the kind is read
+	// in the json form of its yaml.
 	kind := &spec.CustomResourceKind{}
-
-	err := a.readAPISpec(r, pbKind, kind)
+	err := a.readSpecBody(r, kind)
 	if err != nil {
 		api.HandleAPIError(w, r, http.StatusBadRequest, err)
 		return err
 	}
 
 	name := kind.Name
-	if kind.JSONSchema != "" {
-		sl := gojsonschema.NewStringLoader(kind.JSONSchema)
-		if _, err = gojsonschema.NewSchema(sl); err != nil {
-			err = fmt.Errorf("invalid JSONSchema: %s", err.Error())
-			api.HandleAPIError(w, r, http.StatusBadRequest, err)
-			return err
-		}
-	}
 
 	a.service.Lock()
 	defer a.service.Unlock()
@@ -262,24 +228,15 @@ func (a *API) saveCustomResource(w http.ResponseWriter, r *http.Request, update
 
 	k := a.service.GetCustomResourceKind(kind)
 	if k == nil {
-		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("kind %s not found", kind))
+		err = fmt.Errorf("kind %s not found", kind)
+		api.HandleAPIError(w, r, http.StatusNotFound, err)
 		return err
 	}
 
-	if k.JSONSchema != "" {
-		schema := gojsonschema.NewStringLoader(k.JSONSchema)
-		doc := gojsonschema.NewGoLoader(resource)
-		res, err := gojsonschema.Validate(schema, doc)
-		if err != nil {
-			err = fmt.Errorf("validation failed: %v", err)
-			api.HandleAPIError(w, r, http.StatusBadRequest, err)
-			return err
-		}
-		if !res.Valid() {
-			err = fmt.Errorf("invalid custom resource: %v", res.Errors())
-			api.HandleAPIError(w, r, http.StatusBadRequest, err)
-			return err
-		}
+	err = k.ValidateResource(*resource)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return err
 	}
 
 	a.service.Lock()
@@ -358,3 +315,25 @@ func (a *API) watchCustomResources(w http.ResponseWriter, r *http.Request) {
 
 	logger.Infof("end watch custom resources of kind '%s'", kind)
 }
+
+func (a *API) watchCustomResourceEvents(w http.ResponseWriter, r *http.Request) {
+	kind, err := a.readURLParam(r, "kind")
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	logger.Infof("begin watch custom resource events of kind '%s'", kind)
+
+	w.Header().Set("Content-type", "application/octet-stream")
+	a.service.WatchCustomResourceEvents(r.Context(), kind, func(events []*service.CustomResourceEvent) {
+		err = json.NewEncoder(w).Encode(events)
+		if err != nil {
+			logger.Errorf("marshal custom resource events failed: %v", err)
+		}
+		w.Write([]byte("\r\n"))
+		w.(http.Flusher).Flush()
+	})
+
+	logger.Infof("end watch custom resource events of kind '%s'", kind)
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/megaease/easegress/pkg/api"
+)
+
+type activeDegradationProfile struct {
+	Name string `yaml:"name" jsonschema:"required"`
+}
+
+func (a *API) getActiveDegradationProfile(w http.ResponseWriter, r *http.Request) {
+	serviceName, err := a.readServiceName(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	serviceSpec := a.service.GetServiceSpec(serviceName)
+	if serviceSpec == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", serviceName))
+		return
+	}
+
+	if serviceSpec.ActiveDegradationProfile == "" {
+		api.HandleAPIError(w, r, http.StatusNotFound,
+			fmt.Errorf("%s has no active degradation profile", serviceName))
+		return
+	}
+
+	a.writeYAMLSpecInJSON(w, &activeDegradationProfile{Name: serviceSpec.ActiveDegradationProfile})
+}
+
+func (a *API) activateDegradationProfile(w http.ResponseWriter, r *http.Request) {
+	serviceName, err := a.readServiceName(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	active := &activeDegradationProfile{}
+	err = a.readSpecBody(r, active)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	a.service.Lock()
+	defer a.service.Unlock()
+
+	serviceSpec := a.service.GetServiceSpec(serviceName)
+	if serviceSpec == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", serviceName))
+		return
+	}
+
+	if serviceSpec.DegradationProfile(active.Name) == nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest,
+			fmt.Errorf("%s has no degradation profile %s", serviceName, active.Name))
+		return
+	}
+
+	serviceSpec.ActiveDegradationProfile = active.Name
+	a.service.PutServiceSpec(serviceSpec)
+}
+
+func (a *API) deactivateDegradationProfile(w http.ResponseWriter, r *http.Request) {
+	serviceName, err := a.readServiceName(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	a.service.Lock()
+	defer a.service.Unlock()
+
+	serviceSpec := a.service.GetServiceSpec(serviceName)
+	if serviceSpec == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", serviceName))
+		return
+	}
+
+	if serviceSpec.ActiveDegradationProfile == "" {
+		api.HandleAPIError(w, r, http.StatusNotFound,
+			fmt.Errorf("%s has no active degradation profile", serviceName))
+		return
+	}
+
+	serviceSpec.ActiveDegradationProfile = ""
+	a.service.PutServiceSpec(serviceSpec)
+}
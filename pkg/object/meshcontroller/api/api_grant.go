@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/megaease/easegress/pkg/api"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
+)
+
+// NOTE: The services exported by the tenant are not in its pb spec,
+// they're read and written in the same way as the allowed callers of the service.
+
+func (a *API) getTenantExportedServices(w http.ResponseWriter, r *http.Request) {
+	tenantName, err := a.readTenantName(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	tenantSpec := a.service.GetTenantSpec(tenantName)
+	if tenantSpec == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", tenantName))
+		return
+	}
+
+	exports := tenantSpec.ExportedServices
+	if exports == nil {
+		exports = []*spec.ServiceExport{}
+	}
+
+	a.writeYAMLSpecInJSON(w, exports)
+}
+
+func (a *API) updateTenantExportedServices(w http.ResponseWriter, r *http.Request) {
+	tenantName, err := a.readTenantName(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	exports := []*spec.ServiceExport{}
+	err = a.readSpecBody(r, &exports)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	a.service.Lock()
+	defer a.service.Unlock()
+
+	tenantSpec := a.service.GetTenantSpec(tenantName)
+	if tenantSpec == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", tenantName))
+		return
+	}
+
+	tenantSpec.ExportedServices = exports
+	err = tenantSpec.Validate()
+	if err == nil {
+		err = tenantSpec.CheckExportedServices()
+	}
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	a.service.PutTenantSpec(tenantSpec)
+}
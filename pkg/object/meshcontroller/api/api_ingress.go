@@ -18,17 +18,14 @@
 package api
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"path"
 	"sort"
 
 	"github.com/go-chi/chi/v5"
-	v1alpha1 "github.com/megaease/easemesh-api/v1alpha1"
 
 	"github.com/megaease/easegress/pkg/api"
-	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
 )
 
@@ -51,30 +48,28 @@ func (a *API) listIngresses(w http.ResponseWriter, r *http.Request) {
 	specs := a.service.ListIngressSpecs()
 
 	sort.Sort(ingressesByOrder(specs))
-	var apiSpecs []*v1alpha1.Ingress
-	for _, v := range specs {
-		ingress := &v1alpha1.Ingress{}
-		err := a.convertSpecToPB(v, ingress)
-		if err != nil {
-			logger.Errorf("convert spec %#v to pb spec failed: %v", v, err)
-			continue
+	a.writeYAMLSpecInJSON(w, specs)
+}
+
+// validateIngressRules validates the rules of the ingress together with
+// the ones of the other ingresses, they're served by the same HTTP server.
+func (a *API) validateIngressRules(ingressSpec *spec.Ingress) error {
+	rules := append([]*spec.IngressRule{}, ingressSpec.Rules...)
+	for _, other := range a.service.ListIngressSpecs() {
+		if other.Name != ingressSpec.Name {
+			rules = append(rules, other.Rules...)
 		}
-		apiSpecs = append(apiSpecs, ingress)
-	}
-	buff, err := json.Marshal(apiSpecs)
-	if err != nil {
-		panic(fmt.Errorf("marshal %#v to json failed: %v", specs, err))
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(buff)
+	return spec.ValidateIngressRules(rules)
 }
 
 func (a *API) createIngress(w http.ResponseWriter, r *http.Request) {
-	pbIngressSpec := &v1alpha1.Ingress{}
 	ingressSpec := &spec.Ingress{}
 
-	err := a.readAPISpec(r, pbIngressSpec, ingressSpec)
+	// NOTE: The pb spec of the ingress carries only the hosts and paths,
+	// so it's read and written in the json form of its yaml spec.
+	err := a.readSpecBody(r, ingressSpec)
 	if err != nil {
 		api.HandleAPIError(w, r, http.StatusBadRequest, err)
 		return
@@ -89,6 +84,12 @@ func (a *API) createIngress(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = a.validateIngressRules(ingressSpec)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
 	a.service.PutIngressSpec(ingressSpec)
 
 	w.Header().Set("Location", path.Join(r.URL.Path, ingressSpec.Name))
@@ -107,23 +108,11 @@ func (a *API) getIngress(w http.ResponseWriter, r *http.Request) {
 		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", ingressName))
 		return
 	}
-	pbIngressSpec := &v1alpha1.Ingress{}
-	err = a.convertSpecToPB(ingressSpec, pbIngressSpec)
-	if err != nil {
-		panic(fmt.Errorf("convert spec %#v to pb failed: %v", ingressSpec, err))
-	}
 
-	buff, err := json.Marshal(pbIngressSpec)
-	if err != nil {
-		panic(fmt.Errorf("marshal %#v to json failed: %v", pbIngressSpec, err))
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(buff)
+	a.writeYAMLSpecInJSON(w, ingressSpec)
 }
 
 func (a *API) updateIngress(w http.ResponseWriter, r *http.Request) {
-	pbIngressSpec := &v1alpha1.Ingress{}
 	ingressSpec := &spec.Ingress{}
 
 	ingressName, err := a.readIngressName(r)
@@ -131,7 +120,7 @@ func (a *API) updateIngress(w http.ResponseWriter, r *http.Request) {
 		api.HandleAPIError(w, r, http.StatusBadRequest, err)
 		return
 	}
-	err = a.readAPISpec(r, pbIngressSpec, ingressSpec)
+	err = a.readSpecBody(r, ingressSpec)
 	if err != nil {
 		api.HandleAPIError(w, r, http.StatusBadRequest, err)
 		return
@@ -151,6 +140,12 @@ func (a *API) updateIngress(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = a.validateIngressRules(ingressSpec)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
 	a.service.PutIngressSpec(ingressSpec)
 }
 
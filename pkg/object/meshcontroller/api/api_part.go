@@ -25,6 +25,7 @@ import (
 	v1alpha1 "github.com/megaease/easemesh-api/v1alpha1"
 
 	"github.com/megaease/easegress/pkg/api"
+	"github.com/megaease/easegress/pkg/filter/proxy"
 	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
 )
 
@@ -32,6 +33,9 @@ type (
 	newPartFunc func() interface{}
 	partOfFunc  func(serviceSpec *spec.Service) (interface{}, bool)
 	setPartFunc func(serviceSpec *spec.Service, part interface{})
+	// checkPartFunc checks the part before it's set to the service spec,
+	// it returns the status code for the failure.
+	checkPartFunc func(a *API, serviceSpec *spec.Service, part interface{}) (int, error)
 
 	partMeta struct {
 		partName string
@@ -41,6 +45,8 @@ type (
 		// for protobuf API
 		pbSt      interface{}
 		newPartPB newPartFunc
+		// for spec API, optional
+		checkPart checkPartFunc
 	}
 )
 
@@ -79,7 +85,10 @@ var (
 				serviceSpec.Canary = nil
 				return
 			}
-			serviceSpec.Canary = part.(*spec.Canary)
+			// NOTE: The pb spec doesn't carry the canary bypass and sources, keep them.
+			canary := part.(*spec.Canary)
+			canary.KeepNonPBFields(serviceSpec.Canary)
+			serviceSpec.Canary = canary
 		},
 		pbSt: v1alpha1.Canary{},
 		newPartPB: func() interface{} {
@@ -98,8 +107,13 @@ var (
 		setPart: func(serviceSpec *spec.Service, part interface{}) {
 			if part == nil {
 				serviceSpec.Resilience = nil
+				return
 			}
-			serviceSpec.Resilience = part.(*spec.Resilience)
+			// NOTE: The pb spec doesn't carry the options added to the
+			// resilience filters, keep them, they're updated by the spec API.
+			resilience := part.(*spec.Resilience)
+			resilience.KeepNonPBFields(serviceSpec.Resilience)
+			serviceSpec.Resilience = resilience
 		},
 		pbSt: v1alpha1.Resilience{},
 		newPartPB: func() interface{} {
@@ -120,7 +134,10 @@ var (
 				serviceSpec.LoadBalance = nil
 				return
 			}
-			serviceSpec.LoadBalance = part.(*spec.LoadBalance)
+			// NOTE: The pb spec doesn't carry the consistent hash options, keep them.
+			lb := part.(*spec.LoadBalance)
+			spec.KeepLoadBalanceNonPBFields(lb, serviceSpec.LoadBalance)
+			serviceSpec.LoadBalance = lb
 		},
 		pbSt: v1alpha1.LoadBalance{},
 		newPartPB: func() interface{} {
@@ -147,7 +164,12 @@ var (
 				serviceSpec.Observability.OutputServer = nil
 				return
 			}
-			serviceSpec.Observability.OutputServer = part.(*spec.ObservabilityOutputServer)
+			outputServer := part.(*spec.ObservabilityOutputServer)
+			// NOTE: The pb spec doesn't carry the security, keep it.
+			if old := serviceSpec.Observability.OutputServer; old != nil {
+				outputServer.ObservabilityOutputServerSecurity = old.ObservabilityOutputServerSecurity
+			}
+			serviceSpec.Observability.OutputServer = outputServer
 		},
 		pbSt: v1alpha1.ObservabilityOutputServer{},
 		newPartPB: func() interface{} {
@@ -174,7 +196,16 @@ var (
 				serviceSpec.Observability.Tracings = nil
 				return
 			}
-			serviceSpec.Observability.Tracings = part.(*spec.ObservabilityTracings)
+			tracings := part.(*spec.ObservabilityTracings)
+			// NOTE: The pb spec doesn't carry the propagation, baggage and
+			// always sample, keep them.
+			if old := serviceSpec.Observability.Tracings; old != nil {
+				tracings.Propagation = old.Propagation
+				tracings.Baggage = old.Baggage
+				tracings.AlwaysSampleOnError = old.AlwaysSampleOnError
+				tracings.AlwaysSampleAboveLatencyMs = old.AlwaysSampleAboveLatencyMs
+			}
+			serviceSpec.Observability.Tracings = tracings
 		},
 		pbSt: v1alpha1.ObservabilityTracings{},
 		newPartPB: func() interface{} {
@@ -201,7 +232,13 @@ var (
 				serviceSpec.Observability.Metrics = nil
 				return
 			}
-			serviceSpec.Observability.Metrics = part.(*spec.ObservabilityMetrics)
+			metrics := part.(*spec.ObservabilityMetrics)
+			// NOTE: The pb spec doesn't carry the output, keep it.
+			if old := serviceSpec.Observability.Metrics; old != nil {
+				metrics.Output = old.Output
+				metrics.StatsD = old.StatsD
+			}
+			serviceSpec.Observability.Metrics = metrics
 		},
 		pbSt: v1alpha1.ObservabilityMetrics{},
 		newPartPB: func() interface{} {
@@ -210,6 +247,591 @@ var (
 	}
 )
 
+// sidecarMTLS is the mTLS toggle of the sidecar, the pb spec of the
+// sidecar doesn't carry it.
+type sidecarMTLS struct {
+	Enabled bool `yaml:"enabled" jsonschema:"required"`
+}
+
+// traceAlwaysSample is the always sample of tracings, the pb spec of the
+// tracings doesn't carry it.
+type traceAlwaysSample struct {
+	OnError        bool `yaml:"onError" jsonschema:"omitempty"`
+	AboveLatencyMs int  `yaml:"aboveLatencyMs" jsonschema:"omitempty,minimum=0"`
+}
+
+// metricsOutput is the output of metrics, the pb spec of the metrics
+// doesn't carry it.
+type metricsOutput struct {
+	Output string                           `yaml:"output" jsonschema:"omitempty,enum=,enum=kafka,enum=statsd"`
+	StatsD *spec.ObservabilityMetricsStatsD `yaml:"statsd" jsonschema:"omitempty"`
+}
+
+// Validate validates metricsOutput.
+func (o metricsOutput) Validate() error {
+	return spec.ObservabilityMetrics{Output: o.Output, StatsD: o.StatsD}.Validate()
+}
+
+// NOTE: The parts below are not in the pb spec of the service, so they
+// are read and written in the json form of their yaml spec.
+var (
+	degradationProfilesMeta = &partMeta{
+		partName: "degradationProfiles",
+		newPart: func() interface{} {
+			return &[]*spec.DegradationProfile{}
+		},
+		partOf: func(serviceSpec *spec.Service) (interface{}, bool) {
+			if serviceSpec.DegradationProfiles == nil {
+				return []*spec.DegradationProfile{}, true
+			}
+			return serviceSpec.DegradationProfiles, true
+		},
+		setPart: func(serviceSpec *spec.Service, part interface{}) {
+			serviceSpec.DegradationProfiles = *part.(*[]*spec.DegradationProfile)
+		},
+	}
+
+	egressRoutesMeta = &partMeta{
+		partName: "egressRoutes",
+		newPart: func() interface{} {
+			return &[]*spec.EgressRoute{}
+		},
+		partOf: func(serviceSpec *spec.Service) (interface{}, bool) {
+			if serviceSpec.EgressRoutes == nil {
+				return []*spec.EgressRoute{}, true
+			}
+			return serviceSpec.EgressRoutes, true
+		},
+		setPart: func(serviceSpec *spec.Service, part interface{}) {
+			serviceSpec.EgressRoutes = *part.(*[]*spec.EgressRoute)
+		},
+	}
+
+	aliasesMeta = &partMeta{
+		partName: "aliases",
+		newPart: func() interface{} {
+			return &[]string{}
+		},
+		partOf: func(serviceSpec *spec.Service) (interface{}, bool) {
+			if serviceSpec.Aliases == nil {
+				return []string{}, true
+			}
+			return serviceSpec.Aliases, true
+		},
+		setPart: func(serviceSpec *spec.Service, part interface{}) {
+			serviceSpec.Aliases = *part.(*[]string)
+		},
+		checkPart: func(a *API, serviceSpec *spec.Service, part interface{}) (int, error) {
+			s := *serviceSpec
+			s.Aliases = *part.(*[]string)
+			return http.StatusConflict, spec.CheckServiceAliases(&s, a.service.ListServiceSpecs())
+		},
+	}
+
+	allowedCallersMeta = &partMeta{
+		partName: "allowedCallers",
+		newPart: func() interface{} {
+			return &[]string{}
+		},
+		partOf: func(serviceSpec *spec.Service) (interface{}, bool) {
+			if serviceSpec.AllowedCallers == nil {
+				return []string{}, true
+			}
+			return serviceSpec.AllowedCallers, true
+		},
+		setPart: func(serviceSpec *spec.Service, part interface{}) {
+			serviceSpec.AllowedCallers = *part.(*[]string)
+		},
+	}
+
+	// NOTE: The canary rules carry the source services and set headers
+	// which the pb spec of canary doesn't carry.
+	canaryRulesMeta = &partMeta{
+		partName: "canaryRules",
+		newPart: func() interface{} {
+			return &[]*spec.CanaryRule{}
+		},
+		partOf: func(serviceSpec *spec.Service) (interface{}, bool) {
+			if serviceSpec.Canary == nil || serviceSpec.Canary.CanaryRules == nil {
+				return []*spec.CanaryRule{}, true
+			}
+			return serviceSpec.Canary.CanaryRules, true
+		},
+		setPart: func(serviceSpec *spec.Service, part interface{}) {
+			if serviceSpec.Canary == nil {
+				serviceSpec.Canary = &spec.Canary{}
+			}
+			serviceSpec.Canary.CanaryRules = *part.(*[]*spec.CanaryRule)
+		},
+	}
+
+	canaryBypassMeta = &partMeta{
+		partName: "canaryBypass",
+		newPart: func() interface{} {
+			return &spec.CanaryBypass{}
+		},
+		partOf: func(serviceSpec *spec.Service) (interface{}, bool) {
+			if serviceSpec.Canary == nil {
+				return nil, false
+			}
+			// NOTE: The default bypass header works without the spec.
+			return &spec.CanaryBypass{Header: serviceSpec.Canary.BypassHeaderName()}, true
+		},
+		setPart: func(serviceSpec *spec.Service, part interface{}) {
+			if part == nil {
+				serviceSpec.Canary.Bypass = nil
+				return
+			}
+			serviceSpec.Canary.Bypass = part.(*spec.CanaryBypass)
+		},
+		checkPart: func(a *API, serviceSpec *spec.Service, part interface{}) (int, error) {
+			if serviceSpec.Canary == nil {
+				return http.StatusNotFound, fmt.Errorf("%s has no canary", serviceSpec.Name)
+			}
+			return http.StatusOK, nil
+		},
+	}
+
+	canaryPropagationMeta = &partMeta{
+		partName: "canaryPropagation",
+		newPart: func() interface{} {
+			return &spec.CanaryPropagation{}
+		},
+		partOf: func(serviceSpec *spec.Service) (interface{}, bool) {
+			return serviceSpec.CanaryPropagation, serviceSpec.CanaryPropagation != nil
+		},
+		setPart: func(serviceSpec *spec.Service, part interface{}) {
+			if part == nil {
+				serviceSpec.CanaryPropagation = nil
+				return
+			}
+			serviceSpec.CanaryPropagation = part.(*spec.CanaryPropagation)
+		},
+	}
+
+	// NOTE: The consistent hash is the load balance with the options
+	// the pb spec doesn't carry.
+	consistentHashMeta = &partMeta{
+		partName: "consistentHash",
+		newPart: func() interface{} {
+			return &spec.LoadBalance{}
+		},
+		partOf: func(serviceSpec *spec.Service) (interface{}, bool) {
+			lb := serviceSpec.LoadBalance
+			return lb, lb != nil && lb.Policy == proxy.PolicyConsistentHash
+		},
+		setPart: func(serviceSpec *spec.Service, part interface{}) {
+			serviceSpec.LoadBalance = part.(*spec.LoadBalance)
+		},
+		checkPart: func(a *API, serviceSpec *spec.Service, part interface{}) (int, error) {
+			if part.(*spec.LoadBalance).Policy != proxy.PolicyConsistentHash {
+				return http.StatusBadRequest, fmt.Errorf("policy must be %s", proxy.PolicyConsistentHash)
+			}
+			return http.StatusOK, nil
+		},
+	}
+
+	connectionPoolMeta = &partMeta{
+		partName: "connectionPool",
+		newPart: func() interface{} {
+			return &spec.ConnectionPool{}
+		},
+		partOf: func(serviceSpec *spec.Service) (interface{}, bool) {
+			return serviceSpec.ConnectionPool, serviceSpec.ConnectionPool != nil
+		},
+		setPart: func(serviceSpec *spec.Service, part interface{}) {
+			if part == nil {
+				serviceSpec.ConnectionPool = nil
+				return
+			}
+			serviceSpec.ConnectionPool = part.(*spec.ConnectionPool)
+		},
+	}
+
+	deadlinePropagationMeta = &partMeta{
+		partName: "deadlinePropagation",
+		newPart: func() interface{} {
+			return &spec.DeadlinePropagation{}
+		},
+		partOf: func(serviceSpec *spec.Service) (interface{}, bool) {
+			return serviceSpec.DeadlinePropagation, serviceSpec.DeadlinePropagation != nil
+		},
+		setPart: func(serviceSpec *spec.Service, part interface{}) {
+			if part == nil {
+				serviceSpec.DeadlinePropagation = nil
+				return
+			}
+			serviceSpec.DeadlinePropagation = part.(*spec.DeadlinePropagation)
+		},
+	}
+
+	fallbackMeta = &partMeta{
+		partName: "fallback",
+		newPart: func() interface{} {
+			return &spec.Fallback{}
+		},
+		partOf: func(serviceSpec *spec.Service) (interface{}, bool) {
+			return serviceSpec.Fallback, serviceSpec.Fallback != nil
+		},
+		setPart: func(serviceSpec *spec.Service, part interface{}) {
+			if part == nil {
+				serviceSpec.Fallback = nil
+				return
+			}
+			serviceSpec.Fallback = part.(*spec.Fallback)
+		},
+		// NOTE: The fallback service is checked only here, the requests get
+		// 503 if it's deleted later.
+		checkPart: func(a *API, serviceSpec *spec.Service, part interface{}) (int, error) {
+			fallback := part.(*spec.Fallback)
+			if fallback.Service == "" {
+				return http.StatusOK, nil
+			}
+
+			fallbackSpec := a.service.GetServiceSpec(fallback.Service)
+			if fallbackSpec == nil || fallbackSpec.SoftDeleted() {
+				return http.StatusBadRequest, fmt.Errorf("fallback service %s not found", fallback.Service)
+			}
+			if fallbackSpec.MTLSEnabled() {
+				return http.StatusBadRequest,
+					fmt.Errorf("fallback service %s requires mTLS, which is not supported", fallback.Service)
+			}
+			return http.StatusOK, nil
+		},
+	}
+
+	faultInjectionMeta = &partMeta{
+		partName: "faultInjection",
+		newPart: func() interface{} {
+			return &spec.FaultInjection{}
+		},
+		partOf: func(serviceSpec *spec.Service) (interface{}, bool) {
+			return serviceSpec.FaultInjection, serviceSpec.FaultInjection != nil
+		},
+		setPart: func(serviceSpec *spec.Service, part interface{}) {
+			if part == nil {
+				serviceSpec.FaultInjection = nil
+				return
+			}
+			serviceSpec.FaultInjection = part.(*spec.FaultInjection)
+		},
+	}
+
+	headerManipulationMeta = &partMeta{
+		partName: "headerManipulation",
+		newPart: func() interface{} {
+			return &spec.HeaderManipulation{}
+		},
+		partOf: func(serviceSpec *spec.Service) (interface{}, bool) {
+			return serviceSpec.HeaderManipulation, serviceSpec.HeaderManipulation != nil
+		},
+		setPart: func(serviceSpec *spec.Service, part interface{}) {
+			if part == nil {
+				serviceSpec.HeaderManipulation = nil
+				return
+			}
+			serviceSpec.HeaderManipulation = part.(*spec.HeaderManipulation)
+		},
+	}
+
+	outputServerSecurityMeta = &partMeta{
+		partName: "outputServerSecurity",
+		newPart: func() interface{} {
+			return &spec.ObservabilityOutputServerSecurity{}
+		},
+		partOf: func(serviceSpec *spec.Service) (interface{}, bool) {
+			o := serviceSpec.Observability
+			if o == nil || o.OutputServer == nil {
+				return nil, false
+			}
+			return &o.OutputServer.ObservabilityOutputServerSecurity, true
+		},
+		setPart: func(serviceSpec *spec.Service, part interface{}) {
+			if part == nil {
+				serviceSpec.Observability.OutputServer.ObservabilityOutputServerSecurity = spec.ObservabilityOutputServerSecurity{}
+				return
+			}
+			serviceSpec.Observability.OutputServer.ObservabilityOutputServerSecurity = *part.(*spec.ObservabilityOutputServerSecurity)
+		},
+		checkPart: func(a *API, serviceSpec *spec.Service, part interface{}) (int, error) {
+			o := serviceSpec.Observability
+			if o == nil || o.OutputServer == nil {
+				return http.StatusBadRequest, fmt.Errorf("%s has no output server", serviceSpec.Name)
+			}
+			return http.StatusOK, nil
+		},
+	}
+
+	accessLogMeta = &partMeta{
+		partName: "accessLog",
+		newPart: func() interface{} {
+			return &spec.ObservabilityAccessLog{}
+		},
+		partOf: func(serviceSpec *spec.Service) (interface{}, bool) {
+			if serviceSpec.Observability == nil {
+				return nil, false
+			}
+			return serviceSpec.Observability.AccessLog, serviceSpec.Observability.AccessLog != nil
+		},
+		setPart: func(serviceSpec *spec.Service, part interface{}) {
+			if serviceSpec.Observability == nil {
+				serviceSpec.Observability = &spec.Observability{}
+			}
+			if part == nil {
+				serviceSpec.Observability.AccessLog = nil
+				return
+			}
+			serviceSpec.Observability.AccessLog = part.(*spec.ObservabilityAccessLog)
+		},
+		checkPart: func(a *API, serviceSpec *spec.Service, part interface{}) (int, error) {
+			o := spec.Observability{AccessLog: part.(*spec.ObservabilityAccessLog)}
+			if serviceSpec.Observability != nil {
+				o.OutputServer = serviceSpec.Observability.OutputServer
+			}
+			return http.StatusBadRequest, o.Validate()
+		},
+	}
+
+	tracePropagationMeta = &partMeta{
+		partName: "tracePropagation",
+		newPart: func() interface{} {
+			return &spec.ObservabilityTracingsPropagation{}
+		},
+		partOf: func(serviceSpec *spec.Service) (interface{}, bool) {
+			o := serviceSpec.Observability
+			if o == nil || o.Tracings == nil {
+				return nil, false
+			}
+			return o.Tracings.Propagation, o.Tracings.Propagation != nil
+		},
+		setPart: func(serviceSpec *spec.Service, part interface{}) {
+			if part == nil {
+				serviceSpec.Observability.Tracings.Propagation = nil
+				return
+			}
+			serviceSpec.Observability.Tracings.Propagation = part.(*spec.ObservabilityTracingsPropagation)
+		},
+		checkPart: checkTracings,
+	}
+
+	traceBaggageMeta = &partMeta{
+		partName: "traceBaggage",
+		newPart: func() interface{} {
+			return &spec.ObservabilityTracingsBaggage{}
+		},
+		partOf: func(serviceSpec *spec.Service) (interface{}, bool) {
+			o := serviceSpec.Observability
+			if o == nil || o.Tracings == nil {
+				return nil, false
+			}
+			return o.Tracings.Baggage, o.Tracings.Baggage != nil
+		},
+		setPart: func(serviceSpec *spec.Service, part interface{}) {
+			if part == nil {
+				serviceSpec.Observability.Tracings.Baggage = nil
+				return
+			}
+			serviceSpec.Observability.Tracings.Baggage = part.(*spec.ObservabilityTracingsBaggage)
+		},
+		checkPart: checkTracings,
+	}
+
+	limitsMeta = &partMeta{
+		partName: "limits",
+		newPart: func() interface{} {
+			return &spec.Limits{}
+		},
+		partOf: func(serviceSpec *spec.Service) (interface{}, bool) {
+			return serviceSpec.Limits, serviceSpec.Limits != nil
+		},
+		setPart: func(serviceSpec *spec.Service, part interface{}) {
+			if part == nil {
+				serviceSpec.Limits = nil
+				return
+			}
+			serviceSpec.Limits = part.(*spec.Limits)
+		},
+	}
+
+	mirrorMeta = &partMeta{
+		partName: "mirror",
+		newPart: func() interface{} {
+			return &spec.Mirror{}
+		},
+		partOf: func(serviceSpec *spec.Service) (interface{}, bool) {
+			return serviceSpec.Mirror, serviceSpec.Mirror != nil
+		},
+		setPart: func(serviceSpec *spec.Service, part interface{}) {
+			if part == nil {
+				serviceSpec.Mirror = nil
+				return
+			}
+			serviceSpec.Mirror = part.(*spec.Mirror)
+		},
+	}
+
+	healthCheckMeta = &partMeta{
+		partName: "healthCheck",
+		newPart: func() interface{} {
+			return &spec.HealthCheck{}
+		},
+		partOf: func(serviceSpec *spec.Service) (interface{}, bool) {
+			return serviceSpec.HealthCheck, serviceSpec.HealthCheck != nil
+		},
+		setPart: func(serviceSpec *spec.Service, part interface{}) {
+			if part == nil {
+				serviceSpec.HealthCheck = nil
+				return
+			}
+			serviceSpec.HealthCheck = part.(*spec.HealthCheck)
+		},
+	}
+
+	compressionMeta = &partMeta{
+		partName: "compression",
+		newPart: func() interface{} {
+			return &spec.Compression{}
+		},
+		partOf: func(serviceSpec *spec.Service) (interface{}, bool) {
+			return serviceSpec.Compression, serviceSpec.Compression != nil
+		},
+		setPart: func(serviceSpec *spec.Service, part interface{}) {
+			if part == nil {
+				serviceSpec.Compression = nil
+				return
+			}
+			serviceSpec.Compression = part.(*spec.Compression)
+		},
+	}
+
+	authenticationMeta = &partMeta{
+		partName: "authentication",
+		newPart: func() interface{} {
+			return &spec.Authentication{}
+		},
+		partOf: func(serviceSpec *spec.Service) (interface{}, bool) {
+			return serviceSpec.Authentication, serviceSpec.Authentication != nil
+		},
+		setPart: func(serviceSpec *spec.Service, part interface{}) {
+			if part == nil {
+				serviceSpec.Authentication = nil
+				return
+			}
+			serviceSpec.Authentication = part.(*spec.Authentication)
+		},
+	}
+
+	traceAlwaysSampleMeta = &partMeta{
+		partName: "traceAlwaysSample",
+		newPart: func() interface{} {
+			return &traceAlwaysSample{}
+		},
+		partOf: func(serviceSpec *spec.Service) (interface{}, bool) {
+			o := serviceSpec.Observability
+			if o == nil || o.Tracings == nil {
+				return nil, false
+			}
+			return &traceAlwaysSample{
+				OnError:        o.Tracings.AlwaysSampleOnError,
+				AboveLatencyMs: o.Tracings.AlwaysSampleAboveLatencyMs,
+			}, true
+		},
+		setPart: func(serviceSpec *spec.Service, part interface{}) {
+			tracings := serviceSpec.Observability.Tracings
+			if part == nil {
+				tracings.AlwaysSampleOnError, tracings.AlwaysSampleAboveLatencyMs = false, 0
+				return
+			}
+			as := part.(*traceAlwaysSample)
+			tracings.AlwaysSampleOnError, tracings.AlwaysSampleAboveLatencyMs = as.OnError, as.AboveLatencyMs
+		},
+		checkPart: checkTracings,
+	}
+
+	metricsOutputMeta = &partMeta{
+		partName: "metricsOutput",
+		newPart: func() interface{} {
+			return &metricsOutput{}
+		},
+		partOf: func(serviceSpec *spec.Service) (interface{}, bool) {
+			o := serviceSpec.Observability
+			if o == nil || o.Metrics == nil {
+				return nil, false
+			}
+			return &metricsOutput{Output: o.Metrics.Output, StatsD: o.Metrics.StatsD}, true
+		},
+		setPart: func(serviceSpec *spec.Service, part interface{}) {
+			metrics := serviceSpec.Observability.Metrics
+			if part == nil {
+				metrics.Output, metrics.StatsD = "", nil
+				return
+			}
+			output := part.(*metricsOutput)
+			metrics.Output, metrics.StatsD = output.Output, output.StatsD
+		},
+		checkPart: func(a *API, serviceSpec *spec.Service, part interface{}) (int, error) {
+			o := serviceSpec.Observability
+			if o == nil || o.Metrics == nil {
+				return http.StatusBadRequest, fmt.Errorf("%s has no metrics", serviceSpec.Name)
+			}
+			return http.StatusOK, nil
+		},
+	}
+
+	sidecarMTLSMeta = &partMeta{
+		partName: "sidecarMTLS",
+		newPart: func() interface{} {
+			return &sidecarMTLS{}
+		},
+		partOf: func(serviceSpec *spec.Service) (interface{}, bool) {
+			if serviceSpec.Sidecar == nil {
+				return nil, false
+			}
+			return &sidecarMTLS{Enabled: serviceSpec.Sidecar.MTLS}, true
+		},
+		setPart: func(serviceSpec *spec.Service, part interface{}) {
+			if part == nil {
+				serviceSpec.Sidecar.MTLS = false
+				return
+			}
+			serviceSpec.Sidecar.MTLS = part.(*sidecarMTLS).Enabled
+		},
+		checkPart: func(a *API, serviceSpec *spec.Service, part interface{}) (int, error) {
+			if serviceSpec.Sidecar == nil {
+				return http.StatusBadRequest, fmt.Errorf("%s has no sidecar", serviceSpec.Name)
+			}
+			return http.StatusOK, nil
+		},
+	}
+
+	// NOTE: It's the whole resilience in the yaml spec, which carries
+	// the options the pb spec doesn't.
+	resilienceSpecMeta = &partMeta{
+		partName: "resilience",
+		newPart: func() interface{} {
+			return &spec.Resilience{}
+		},
+		partOf: func(serviceSpec *spec.Service) (interface{}, bool) {
+			return serviceSpec.Resilience, serviceSpec.Resilience != nil
+		},
+		setPart: func(serviceSpec *spec.Service, part interface{}) {
+			if part == nil {
+				serviceSpec.Resilience = nil
+				return
+			}
+			serviceSpec.Resilience = part.(*spec.Resilience)
+		},
+	}
+)
+
+func checkTracings(a *API, serviceSpec *spec.Service, part interface{}) (int, error) {
+	o := serviceSpec.Observability
+	if o == nil || o.Tracings == nil {
+		return http.StatusBadRequest, fmt.Errorf("%s has no tracings", serviceSpec.Name)
+	}
+	return http.StatusOK, nil
+}
+
 func (a *API) getPartOfService(meta *partMeta) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		serviceName, err := a.readServiceName(r)
@@ -284,6 +906,11 @@ func (a *API) createPartOfService(meta *partMeta) http.HandlerFunc {
 		}
 
 		meta.setPart(serviceSpec, part)
+		err = a.validateServiceSpec(serviceSpec)
+		if err != nil {
+			api.HandleAPIError(w, r, http.StatusBadRequest, err)
+			return
+		}
 
 		a.service.PutServiceSpec(serviceSpec)
 
@@ -327,6 +954,11 @@ func (a *API) updatePartOfService(meta *partMeta) http.HandlerFunc {
 		}
 
 		meta.setPart(serviceSpec, part)
+		err = a.validateServiceSpec(serviceSpec)
+		if err != nil {
+			api.HandleAPIError(w, r, http.StatusBadRequest, err)
+			return
+		}
 		a.service.PutServiceSpec(serviceSpec)
 	})
 }
@@ -360,3 +992,81 @@ func (a *API) deletePartOfService(meta *partMeta) http.HandlerFunc {
 		a.service.PutServiceSpec(serviceSpec)
 	})
 }
+
+func (a *API) getSpecPartOfService(meta *partMeta) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serviceName, err := a.readServiceName(r)
+		if err != nil {
+			api.HandleAPIError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		// NOTE: No need to lock.
+		serviceSpec := a.service.GetServiceSpec(serviceName)
+		if serviceSpec == nil {
+			api.HandleAPIError(w, r, http.StatusNotFound,
+				fmt.Errorf("service %s not found", serviceName))
+			return
+		}
+
+		part, existed := meta.partOf(serviceSpec)
+		if !existed {
+			api.HandleAPIError(w, r, http.StatusNotFound,
+				fmt.Errorf("%s of service %s not found", meta.partName, serviceName))
+			return
+		}
+
+		a.writeYAMLSpecInJSON(w, part)
+	})
+}
+
+// updateSpecPartOfService sets the part whether it existed or not,
+// so the spec API has no POST.
+func (a *API) updateSpecPartOfService(meta *partMeta) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serviceName, err := a.readServiceName(r)
+		if err != nil {
+			api.HandleAPIError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		part := meta.newPart()
+		err = a.readSpecBody(r, part)
+		if err != nil {
+			api.HandleAPIError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		a.service.Lock()
+		defer a.service.Unlock()
+
+		serviceSpec := a.service.GetServiceSpec(serviceName)
+		if serviceSpec == nil || serviceSpec.SoftDeleted() {
+			api.HandleAPIError(w, r, http.StatusNotFound,
+				fmt.Errorf("service %s not found", serviceName))
+			return
+		}
+
+		if meta.checkPart != nil {
+			statusCode, err := meta.checkPart(a, serviceSpec, part)
+			if err != nil {
+				api.HandleAPIError(w, r, statusCode, err)
+				return
+			}
+		}
+
+		meta.setPart(serviceSpec, part)
+		err = serviceSpec.Validate()
+		if err != nil {
+			api.HandleAPIError(w, r, http.StatusBadRequest, err)
+			return
+		}
+		err = a.validateServiceSpec(serviceSpec)
+		if err != nil {
+			api.HandleAPIError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		a.service.PutServiceSpec(serviceSpec)
+	})
+}
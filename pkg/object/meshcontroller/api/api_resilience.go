@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/megaease/easegress/pkg/api"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
+)
+
+// NOTE: The default resilience is not in the pb spec of the tenant,
+// it's read and written in the same way as the degradation profiles.
+
+func (a *API) getTenantDefaultResilience(w http.ResponseWriter, r *http.Request) {
+	tenantName, err := a.readTenantName(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	tenantSpec := a.service.GetTenantSpec(tenantName)
+	if tenantSpec == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", tenantName))
+		return
+	}
+	if tenantSpec.DefaultResilience == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("default resilience of %s not found", tenantName))
+		return
+	}
+
+	a.writeYAMLSpecInJSON(w, tenantSpec.DefaultResilience)
+}
+
+func (a *API) updateTenantDefaultResilience(w http.ResponseWriter, r *http.Request) {
+	tenantName, err := a.readTenantName(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	resilience := &spec.Resilience{}
+	err = a.readSpecBody(r, resilience)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	a.service.Lock()
+	defer a.service.Unlock()
+
+	tenantSpec := a.service.GetTenantSpec(tenantName)
+	if tenantSpec == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", tenantName))
+		return
+	}
+
+	tenantSpec.DefaultResilience = resilience
+	a.service.PutTenantSpec(tenantSpec)
+}
+
+func (a *API) deleteTenantDefaultResilience(w http.ResponseWriter, r *http.Request) {
+	tenantName, err := a.readTenantName(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	a.service.Lock()
+	defer a.service.Unlock()
+
+	tenantSpec := a.service.GetTenantSpec(tenantName)
+	if tenantSpec == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", tenantName))
+		return
+	}
+
+	tenantSpec.DefaultResilience = nil
+	a.service.PutTenantSpec(tenantSpec)
+}
+
+// getEffectiveResilience returns the resilience the pipelines of the service
+// use, which inherits the default resilience of its tenant.
+func (a *API) getEffectiveResilience(w http.ResponseWriter, r *http.Request) {
+	serviceName, err := a.readServiceName(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	serviceSpec := a.service.GetServiceSpec(serviceName)
+	if serviceSpec == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", serviceName))
+		return
+	}
+
+	tenantSpec := a.service.GetTenantSpec(serviceSpec.RegisterTenant)
+	resilience := serviceSpec.WithTenantDefaults(tenantSpec).Resilience
+	if resilience == nil {
+		resilience = &spec.Resilience{}
+	}
+
+	a.writeYAMLSpecInJSON(w, resilience)
+}
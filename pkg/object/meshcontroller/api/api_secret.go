@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/pkg/api"
+)
+
+type secretValue struct {
+	Value string `yaml:"value" jsonschema:"required"`
+}
+
+func (a *API) readSecretName(r *http.Request) (string, error) {
+	secretName := chi.URLParam(r, "secretName")
+	if secretName == "" {
+		return "", fmt.Errorf("empty secret name")
+	}
+
+	return secretName, nil
+}
+
+// NOTE: The values of secrets are write-only, only their names are listed.
+func (a *API) listSecrets(w http.ResponseWriter, r *http.Request) {
+	a.writeYAMLSpecInJSON(w, a.service.ListSecretNames())
+}
+
+func (a *API) updateSecret(w http.ResponseWriter, r *http.Request) {
+	secretName, err := a.readSecretName(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	secret := &secretValue{}
+	err = a.readSpecBody(r, secret)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	a.service.Lock()
+	defer a.service.Unlock()
+
+	a.service.PutSecret(secretName, secret.Value)
+}
+
+func (a *API) deleteSecret(w http.ResponseWriter, r *http.Request) {
+	secretName, err := a.readSecretName(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	a.service.Lock()
+	defer a.service.Unlock()
+
+	if _, exists := a.service.GetSecret(secretName); !exists {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", secretName))
+		return
+	}
+
+	for _, serviceSpec := range a.service.ListServiceSpecs() {
+		for _, name := range serviceSpec.SecretReferences() {
+			if name == secretName {
+				api.HandleAPIError(w, r, http.StatusBadRequest,
+					fmt.Errorf("%s is referred by service %s", secretName, serviceSpec.Name))
+				return
+			}
+		}
+	}
+
+	a.service.DeleteSecret(secretName)
+}
@@ -24,6 +24,9 @@ import (
 	"path"
 	"reflect"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	v1alpha1 "github.com/megaease/easemesh-api/v1alpha1"
@@ -34,7 +37,18 @@ import (
 	"github.com/megaease/easegress/pkg/util/stringtool"
 )
 
-type servicesByOrder []*spec.Service
+type (
+	servicesByOrder []*spec.Service
+
+	// serviceWithTimestamps is the pb spec of the service with its
+	// timestamps, which are not in the pb spec.
+	serviceWithTimestamps struct {
+		*v1alpha1.Service
+		CreatedAt string `json:"createdAt,omitempty"`
+		UpdatedAt string `json:"updatedAt,omitempty"`
+		DeletedAt string `json:"deletedAt,omitempty"`
+	}
+)
 
 func (s servicesByOrder) Less(i, j int) bool { return s[i].Name < s[j].Name }
 func (s servicesByOrder) Len() int           { return len(s) }
@@ -49,20 +63,69 @@ func (a *API) readServiceName(r *http.Request) (string, error) {
 	return serviceName, nil
 }
 
+func (a *API) validateServiceSpec(serviceSpec *spec.Service) error {
+	if serviceSpec.MockShadowsCanary() {
+		logger.Warnf("service %s: enabled mock rules catch all requests, canary rules will never be hit",
+			serviceSpec.Name)
+	}
+
+	err := serviceSpec.ValidateCanaryRules(a.service.AdminSpec().CanaryRulesLimit())
+	if err != nil {
+		return err
+	}
+
+	if a.service.AdminSpec().ResolveSidecarAddress {
+		err = serviceSpec.ResolveSidecarAddress()
+		if err != nil {
+			return err
+		}
+	}
+
+	var globalCanaryHeaders []string
+	if headers := a.service.GetGlobalCanaryHeaders(); headers != nil {
+		for _, serviceHeaders := range headers.ServiceHeaders {
+			globalCanaryHeaders = append(globalCanaryHeaders, serviceHeaders...)
+		}
+	}
+	err = serviceSpec.ValidateHeaderManipulation(globalCanaryHeaders)
+	if err != nil {
+		return err
+	}
+
+	err = serviceSpec.ValidateSecretReferences()
+	if err != nil {
+		return err
+	}
+
+	return serviceSpec.ValidateDegradationProfiles()
+}
+
+// listServices lists the services, query deleted=true lists the
+// soft-deleted ones instead.
 func (a *API) listServices(w http.ResponseWriter, r *http.Request) {
 	specs := a.service.ListServiceSpecs()
 
 	sort.Sort(servicesByOrder(specs))
 
-	var apiSpecs []*v1alpha1.Service
+	deleted := r.URL.Query().Get("deleted") == "true"
+	var apiSpecs []*serviceWithTimestamps
 	for _, v := range specs {
+		if v.SoftDeleted() != deleted {
+			continue
+		}
+
 		service := &v1alpha1.Service{}
 		err := a.convertSpecToPB(v, service)
 		if err != nil {
 			logger.Errorf("convert spec %#v to pb spec failed: %v", v, err)
 			continue
 		}
-		apiSpecs = append(apiSpecs, service)
+		apiSpecs = append(apiSpecs, &serviceWithTimestamps{
+			Service:   service,
+			CreatedAt: v.CreatedAt,
+			UpdatedAt: v.UpdatedAt,
+			DeletedAt: v.DeletedAt,
+		})
 	}
 
 	buff, err := json.Marshal(apiSpecs)
@@ -83,15 +146,33 @@ func (a *API) createService(w http.ResponseWriter, r *http.Request) {
 		api.HandleAPIError(w, r, http.StatusBadRequest, err)
 		return
 	}
+	err = a.validateServiceSpec(serviceSpec)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
 
 	a.service.Lock()
 	defer a.service.Unlock()
 
+	// NOTE: The pb spec doesn't carry the version, it's in the current shape.
+	serviceSpec.SpecVersion = spec.ServiceSpecVersion
+
 	oldSpec := a.service.GetServiceSpec(serviceSpec.Name)
+	if oldSpec != nil && oldSpec.SoftDeleted() {
+		api.HandleAPIError(w, r, http.StatusConflict,
+			fmt.Errorf("%s is soft-deleted, restore or purge it first", serviceSpec.Name))
+		return
+	}
 	if oldSpec != nil {
 		api.HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("%s existed", serviceSpec.Name))
 		return
 	}
+	err = spec.CheckServiceAliases(serviceSpec, a.service.ListServiceSpecs())
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusConflict, err)
+		return
+	}
 
 	tenantSpec := a.service.GetTenantSpec(serviceSpec.RegisterTenant)
 	if tenantSpec == nil {
@@ -128,7 +209,12 @@ func (a *API) getService(w http.ResponseWriter, r *http.Request) {
 		panic(fmt.Errorf("convert spec %#v to pb failed: %v", serviceSpec, err))
 	}
 
-	buff, err := json.Marshal(pbServiceSpec)
+	buff, err := json.Marshal(&serviceWithTimestamps{
+		Service:   pbServiceSpec,
+		CreatedAt: serviceSpec.CreatedAt,
+		UpdatedAt: serviceSpec.UpdatedAt,
+		DeletedAt: serviceSpec.DeletedAt,
+	})
 	if err != nil {
 		panic(fmt.Errorf("marshal %#v to json failed: %v", serviceSpec, err))
 	}
@@ -161,11 +247,27 @@ func (a *API) updateService(w http.ResponseWriter, r *http.Request) {
 	defer a.service.Unlock()
 
 	oldSpec := a.service.GetServiceSpec(serviceName)
-	if oldSpec == nil {
+	if oldSpec == nil || oldSpec.SoftDeleted() {
 		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", serviceName))
 		return
 	}
 
+	// NOTE: The pb spec doesn't carry the fields updated by their own APIs,
+	// keep them before validating the whole spec.
+	// It doesn't carry the version either, it's in the current shape.
+	serviceSpec.SpecVersion = spec.ServiceSpecVersion
+	serviceSpec.KeepNonPBFields(oldSpec)
+	err = serviceSpec.Validate()
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	err = a.validateServiceSpec(serviceSpec)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
 	if serviceSpec.RegisterTenant != oldSpec.RegisterTenant {
 		newTenantSpec := a.service.GetTenantSpec(serviceSpec.RegisterTenant)
 		if newTenantSpec == nil {
@@ -202,29 +304,287 @@ func (a *API) updateService(w http.ResponseWriter, r *http.Request) {
 	a.service.PutServiceSpec(serviceSpec)
 }
 
+// dryRunService returns the changes of the generated sidecar specs
+// if the service is updated to the spec in the request, without applying it.
+func (a *API) dryRunService(w http.ResponseWriter, r *http.Request) {
+	pbServiceSpec := &v1alpha1.Service{}
+	serviceSpec := &spec.Service{}
+
+	serviceName, err := a.readServiceName(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	err = a.readAPISpec(r, pbServiceSpec, serviceSpec)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if serviceName != serviceSpec.Name {
+		api.HandleAPIError(w, r, http.StatusBadRequest,
+			fmt.Errorf("name conflict: %s %s", serviceName, serviceSpec.Name))
+		return
+	}
+
+	oldSpec := a.service.GetServiceSpec(serviceName)
+	if oldSpec == nil || oldSpec.SoftDeleted() {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", serviceName))
+		return
+	}
+
+	// NOTE: Keep the same as updateService.
+	serviceSpec.KeepNonPBFields(oldSpec)
+	err = serviceSpec.Validate()
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	err = a.validateServiceSpec(serviceSpec)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	// NOTE: The application port is the same in both generations,
+	// so any registered instance is good enough for the ingress pipeline.
+	instanceSpecs := a.service.ListServiceInstanceSpecs(serviceName)
+	applicationPort := defaultApplicationPort(instanceSpecs)
+
+	certs, err := previewMTLSCerts(serviceName)
+	if err != nil {
+		panic(err)
+	}
+
+	// NOTE: The tenant of the new spec could be a different one.
+	oldTenant := a.service.GetTenantSpec(oldSpec.RegisterTenant)
+	newTenant := a.service.GetTenantSpec(serviceSpec.RegisterTenant)
+
+	oldSpecs, err := oldSpec.WithTenantDefaults(oldTenant).GeneratedSpecs(instanceSpecs, applicationPort, certs)
+	if err != nil {
+		panic(fmt.Errorf("generate specs of current service %s failed: %v", serviceName, err))
+	}
+	newSpecs, err := serviceSpec.WithTenantDefaults(newTenant).GeneratedSpecs(instanceSpecs, applicationPort, certs)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	diffs := []*spec.SpecDiff{}
+	for i := range newSpecs {
+		diff, err := spec.DiffSpecs(oldSpecs[i], newSpecs[i])
+		if err != nil {
+			panic(err)
+		}
+		diffs = append(diffs, diff)
+	}
+
+	a.writeYAMLSpecInJSON(w, diffs)
+}
+
+// lintService checks the service spec in the body for risky configurations
+// against the registered instances, the spec isn't stored. The report is
+// returned even if it has errors, so CI could gate on them.
+func (a *API) lintService(w http.ResponseWriter, r *http.Request) {
+	pbServiceSpec := &v1alpha1.Service{}
+	serviceSpec := &spec.Service{}
+
+	serviceName, err := a.readServiceName(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	err = a.readAPISpec(r, pbServiceSpec, serviceSpec)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if serviceName != serviceSpec.Name {
+		api.HandleAPIError(w, r, http.StatusBadRequest,
+			fmt.Errorf("name conflict: %s %s", serviceName, serviceSpec.Name))
+		return
+	}
+
+	// NOTE: Keep the same as updateService if the service exists.
+	oldSpec := a.service.GetServiceSpec(serviceName)
+	if oldSpec != nil && !oldSpec.SoftDeleted() {
+		serviceSpec.KeepNonPBFields(oldSpec)
+	}
+	err = serviceSpec.Validate()
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	err = a.validateServiceSpec(serviceSpec)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	tenantSpec := a.service.GetTenantSpec(serviceSpec.RegisterTenant)
+	instanceSpecs := a.service.ListServiceInstanceSpecs(serviceName)
+
+	a.writeYAMLSpecInJSON(w, serviceSpec.WithTenantDefaults(tenantSpec).Lint(instanceSpecs))
+}
+
+// inspectServicePipelines returns the pipelines generated from the service,
+// query instanceIDs selects the instances, separated by comma, and
+// query applicationPort sets the application port of sidecar ingress.
+func (a *API) inspectServicePipelines(w http.ResponseWriter, r *http.Request) {
+	serviceName, err := a.readServiceName(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	serviceSpec := a.service.GetServiceSpec(serviceName)
+	if serviceSpec == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", serviceName))
+		return
+	}
+
+	instanceSpecs := a.service.ListServiceInstanceSpecs(serviceName)
+	if ids := r.URL.Query().Get("instanceIDs"); ids != "" {
+		instanceSpecs, err = selectServiceInstances(instanceSpecs, strings.Split(ids, ","))
+		if err != nil {
+			api.HandleAPIError(w, r, http.StatusNotFound, err)
+			return
+		}
+	}
+
+	applicationPort := defaultApplicationPort(instanceSpecs)
+	if port := r.URL.Query().Get("applicationPort"); port != "" {
+		p, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			api.HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid application port %s", port))
+			return
+		}
+		applicationPort = uint32(p)
+	}
+
+	// NOTE: The pipelines are generated with the effective resilience.
+	tenantSpec := a.service.GetTenantSpec(serviceSpec.RegisterTenant)
+	pipelines, err := serviceSpec.WithTenantDefaults(tenantSpec).InspectPipelines(instanceSpecs, applicationPort)
+	if err != nil {
+		panic(fmt.Errorf("generate pipelines of service %s failed: %v", serviceName, err))
+	}
+
+	a.writeYAMLSpecInJSON(w, pipelines)
+}
+
+// previewMTLSCerts returns throwaway certificates for the preview of specs,
+// which are the same in both generations, so the issued certificates
+// never show up in the diff.
+func previewMTLSCerts(serviceName string) (*spec.MTLSCerts, error) {
+	root, err := spec.NewRootCertificate(spec.DefaultCertTTL)
+	if err != nil {
+		return nil, fmt.Errorf("create preview root certificate failed: %v", err)
+	}
+	cert, err := root.SignServiceCertificate(serviceName, spec.DefaultCertTTL)
+	if err != nil {
+		return nil, fmt.Errorf("sign preview certificate of service %s failed: %v", serviceName, err)
+	}
+
+	return &spec.MTLSCerts{Root: root.PublicCertificate(), Service: cert}, nil
+}
+
+// defaultApplicationPort returns the port of the first instance,
+// or zero if there is no instance.
+func defaultApplicationPort(instanceSpecs []*spec.ServiceInstanceSpec) uint32 {
+	if len(instanceSpecs) == 0 {
+		return 0
+	}
+	return instanceSpecs[0].Port
+}
+
+func selectServiceInstances(instanceSpecs []*spec.ServiceInstanceSpec, instanceIDs []string) ([]*spec.ServiceInstanceSpec, error) {
+	selected := []*spec.ServiceInstanceSpec{}
+	for _, id := range instanceIDs {
+		found := false
+		for _, instanceSpec := range instanceSpecs {
+			if instanceSpec.InstanceID == id {
+				selected = append(selected, instanceSpec)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("instance %s not found", id)
+		}
+	}
+	return selected, nil
+}
+
+// deleteService soft-deletes the service, which is hard-deleted after the
+// retention, query purge=true hard-deletes it at once, soft-deleted or not.
 func (a *API) deleteService(w http.ResponseWriter, r *http.Request) {
 	serviceName, err := a.readServiceName(r)
 	if err != nil {
 		api.HandleAPIError(w, r, http.StatusBadRequest, err)
 		return
 	}
+	purge := r.URL.Query().Get("purge") == "true"
 
 	a.service.Lock()
 	defer a.service.Unlock()
 
 	oldSpec := a.service.GetServiceSpec(serviceName)
-	if oldSpec == nil {
+	if oldSpec == nil || (oldSpec.SoftDeleted() && !purge) {
 		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", serviceName))
 		return
 	}
 
-	tenantSpec := a.service.GetTenantSpec(oldSpec.RegisterTenant)
+	// NOTE: The soft-deleted service has been removed from its tenant,
+	// which could be deleted in the meantime.
+	if !oldSpec.SoftDeleted() {
+		tenantSpec := a.service.GetTenantSpec(oldSpec.RegisterTenant)
+		if tenantSpec == nil {
+			panic(fmt.Errorf("tenant %s not found", oldSpec.RegisterTenant))
+		}
+
+		tenantSpec.Services = stringtool.DeleteStrInSlice(tenantSpec.Services, serviceName)
+		a.service.PutTenantSpec(tenantSpec)
+	}
+
+	if purge {
+		a.service.DeleteServiceSpec(serviceName)
+		return
+	}
+
+	oldSpec.SoftDelete(time.Now())
+	a.service.PutServiceSpec(oldSpec)
+}
+
+// restoreService restores the soft-deleted service into its tenant.
+func (a *API) restoreService(w http.ResponseWriter, r *http.Request) {
+	serviceName, err := a.readServiceName(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	a.service.Lock()
+	defer a.service.Unlock()
+
+	serviceSpec := a.service.GetServiceSpec(serviceName)
+	if serviceSpec == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", serviceName))
+		return
+	}
+	if !serviceSpec.SoftDeleted() {
+		api.HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("%s is not deleted", serviceName))
+		return
+	}
+
+	tenantSpec := a.service.GetTenantSpec(serviceSpec.RegisterTenant)
 	if tenantSpec == nil {
-		panic(fmt.Errorf("tenant %s not found", oldSpec.RegisterTenant))
+		api.HandleAPIError(w, r, http.StatusBadRequest,
+			fmt.Errorf("tenant %s not found", serviceSpec.RegisterTenant))
+		return
 	}
 
-	tenantSpec.Services = stringtool.DeleteStrInSlice(tenantSpec.Services, serviceName)
+	tenantSpec.Services = append(tenantSpec.Services, serviceName)
+	serviceSpec.Restore()
 
 	a.service.PutTenantSpec(tenantSpec)
-	a.service.DeleteServiceSpec(serviceName)
+	a.service.PutServiceSpec(serviceSpec)
 }
@@ -20,13 +20,16 @@ package api
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"sort"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
 	"github.com/megaease/easegress/pkg/api"
 	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/registrycenter"
 	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
 	v1alpha1 "github.com/megaease/easemesh-api/v1alpha1"
 )
@@ -125,3 +128,83 @@ func (a *API) offlineServiceInstance(w http.ResponseWriter, r *http.Request) {
 	instanceSpec.Status = spec.ServiceStatusOutOfService
 	a.service.PutServiceInstanceSpec(instanceSpec)
 }
+
+type serviceInstanceStatusesByOrder []*spec.ServiceInstanceStatus
+
+func (s serviceInstanceStatusesByOrder) Less(i, j int) bool {
+	if s[i].ServiceName != s[j].ServiceName {
+		return s[i].ServiceName < s[j].ServiceName
+	}
+	return s[i].InstanceID < s[j].InstanceID
+}
+func (s serviceInstanceStatusesByOrder) Len() int      { return len(s) }
+func (s serviceInstanceStatusesByOrder) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+func (a *API) listServiceInstanceStatuses(w http.ResponseWriter, r *http.Request) {
+	statuses := a.service.ListAllServiceInstanceStatuses()
+
+	sort.Sort(serviceInstanceStatusesByOrder(statuses))
+
+	now, timeout := time.Now(), a.service.AdminSpec().HeartbeatTimeout()
+	for _, status := range statuses {
+		status.UpdateAge(now, timeout)
+	}
+
+	a.writeYAMLSpecInJSON(w, statuses)
+}
+
+func (a *API) getServiceInstanceStatus(w http.ResponseWriter, r *http.Request) {
+	serviceName, instanceID, err := a.readServiceInstanceInfo(w, r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	status := a.service.GetServiceInstanceStatus(serviceName, instanceID)
+	if status == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s/%s not found", serviceName, instanceID))
+		return
+	}
+
+	status.UpdateAge(time.Now(), a.service.AdminSpec().HeartbeatTimeout())
+
+	a.writeYAMLSpecInJSON(w, status)
+}
+
+func (a *API) bulkRegisterServiceInstances(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("read body failed: %v", err))
+		return
+	}
+
+	pbInstanceSpecs := []*v1alpha1.ServiceInstance{}
+	err = json.Unmarshal(body, &pbInstanceSpecs)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest,
+			fmt.Errorf("unmarshal %s to pb specs failed: %v", string(body), err))
+		return
+	}
+
+	instanceSpecs := make([]*spec.ServiceInstanceSpec, 0, len(pbInstanceSpecs))
+	for _, pbInstanceSpec := range pbInstanceSpecs {
+		instanceSpec := &spec.ServiceInstanceSpec{}
+		err = a.convertPBToSpec(pbInstanceSpec, instanceSpec)
+		if err != nil {
+			api.HandleAPIError(w, r, http.StatusBadRequest, err)
+			return
+		}
+		instanceSpecs = append(instanceSpecs, instanceSpec)
+	}
+
+	a.service.Lock()
+	defer a.service.Unlock()
+
+	err = registrycenter.BulkRegister(a.service, instanceSpecs)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/megaease/easegress/pkg/api"
+)
+
+// MeshStatusFunc returns the cached status of the mesh, false means it's
+// not ready yet.
+type MeshStatusFunc func() (interface{}, bool)
+
+// SetMeshStatusFunc sets the function serving the mesh status, it's set
+// by the master role only.
+func (a *API) SetMeshStatusFunc(fn MeshStatusFunc) {
+	a.meshStatusFunc = fn
+}
+
+// getMeshStatus reports the counts of the tenants, services, instances,
+// the ingresses and the registry of the mesh. It's served from the status
+// cached by the master, so it's safe to poll.
+func (a *API) getMeshStatus(w http.ResponseWriter, r *http.Request) {
+	if a.meshStatusFunc == nil {
+		api.HandleAPIError(w, r, http.StatusServiceUnavailable,
+			fmt.Errorf("mesh status is served by the master only"))
+		return
+	}
+
+	status, ok := a.meshStatusFunc()
+	if !ok {
+		api.HandleAPIError(w, r, http.StatusServiceUnavailable,
+			fmt.Errorf("mesh status is not ready yet"))
+		return
+	}
+
+	a.writeYAMLSpecInJSON(w, status)
+}
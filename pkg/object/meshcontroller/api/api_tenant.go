@@ -170,6 +170,10 @@ func (a *API) updateTenant(w http.ResponseWriter, r *http.Request) {
 
 	// NOTE: The fields below can't be updated.
 	tenantSpec.Services, tenantSpec.CreatedAt = oldSpec.Services, oldSpec.CreatedAt
+	// NOTE: The default resilience and the exported services are not in the
+	// pb spec, they're updated by their own APIs.
+	tenantSpec.DefaultResilience = oldSpec.DefaultResilience
+	tenantSpec.ExportedServices = oldSpec.ExportedServices
 
 	a.service.PutTenantSpec(tenantSpec)
 }
@@ -198,3 +202,13 @@ func (a *API) deleteTenant(w http.ResponseWriter, r *http.Request) {
 
 	a.service.DeleteTenantSpec(tenantName)
 }
+
+// checkTenantConsistency reports the services listed by tenants which are not
+// found or registered into other tenants, and the services whose tenants are
+// not found or don't list them, which break the discovery of sidecars.
+func (a *API) checkTenantConsistency(w http.ResponseWriter, r *http.Request) {
+	tenants := a.service.ListTenantSpecs()
+	services := a.service.ListServiceSpecs()
+
+	a.writeYAMLSpecInJSON(w, spec.CheckTenantConsistency(tenants, services))
+}
@@ -106,6 +106,9 @@ type (
 	// IngressSpecsFunc is the callback function type for service specs.
 	IngressSpecsFunc func(value map[string]*spec.Ingress) bool
 
+	// ServiceCertFunc is the callback function type for service certificate.
+	ServiceCertFunc func(event Event, cert *spec.Certificate) bool
+
 	// Informer is the interface for informing two type of storage changed for every Mesh spec structure.
 	//  1. Based on comparison between old and new part of entry.
 	//  2. Based on comparison on entries with the same prefix.
@@ -127,6 +130,8 @@ type (
 		OnPartOfIngressSpec(serviceName string, gjsonPath GJSONPath, fn IngressSpecFunc) error
 		OnAllIngressSpecs(fn IngressSpecsFunc) error
 
+		OnServiceCert(serviceName string, fn ServiceCertFunc) error
+
 		StopWatchServiceSpec(serviceName string, gjsonPath GJSONPath)
 		StopWatchServiceInstanceSpec(serviceName string)
 
@@ -279,6 +284,7 @@ func (inf *meshInformer) OnPartOfServiceSpec(serviceName string, gjsonPath GJSON
 				logger.Errorf("BUG: unmarshal %s to yaml failed: %v", value, err)
 				return true
 			}
+			spec.MigrateService(serviceSpec)
 		}
 		return fn(event, serviceSpec)
 	}
@@ -367,6 +373,25 @@ func (inf *meshInformer) OnPartOfIngressSpec(ingress string, gjsonPath GJSONPath
 	return inf.onSpecPart(storeKey, syncerKey, gjsonPath, specFunc)
 }
 
+// OnServiceCert watches the certificate of one service.
+func (inf *meshInformer) OnServiceCert(serviceName string, fn ServiceCertFunc) error {
+	storeKey := layout.ServiceCertKey(serviceName)
+	syncerKey := fmt.Sprintf("service-cert-%s", serviceName)
+
+	specFunc := func(event Event, value string) bool {
+		cert := &spec.Certificate{}
+		if event.EventType != EventDelete {
+			if err := yaml.Unmarshal([]byte(value), cert); err != nil {
+				logger.Errorf("BUG: unmarshal %s to yaml failed: %v", value, err)
+				return true
+			}
+		}
+		return fn(event, cert)
+	}
+
+	return inf.onSpecPart(storeKey, syncerKey, AllParts, specFunc)
+}
+
 // OnAllServiceSpecs watches all service specs
 func (inf *meshInformer) OnAllServiceSpecs(fn ServiceSpecsFunc) error {
 	storeKey := layout.ServiceSpecPrefix()
@@ -390,6 +415,7 @@ func (inf *meshInformer) OnAllServiceSpecs(fn ServiceSpecsFunc) error {
 				logger.Errorf("BUG: unmarshal %s to yaml failed: %v", v, err)
 				continue
 			}
+			spec.MigrateService(service)
 			if len(tenant) == 0 || gs[service.Name] || service.RegisterTenant == tenant {
 				services[k] = service
 			}
@@ -46,11 +46,30 @@ type (
 		tc        *trafficcontroller.TrafficController
 		namespace string
 
-		httpServer *supervisor.ObjectEntity
-		// key is the backend name instead of pipeline name.
+		// listInstances lists the instances the pipelines proxy to.
+		listInstances func(serviceName string) []*spec.ServiceInstanceSpec
+
+		httpServer  *supervisor.ObjectEntity
+		httpsServer *supervisor.ObjectEntity
+		// key is the backend name instead of pipeline name,
+		// the path pipelines are keyed by the pipeline name.
 		backendHTTPPipelines map[string]*supervisor.ObjectEntity
 		ingressBackends      map[string]struct{}
+		// key is the pipeline name.
+		ingressPathPipelines map[string]*pathPipeline
 		ingressRules         []*spec.IngressRule
+		// ingressTLSRules are the rules of the ingresses enabling TLS, they
+		// are served by the HTTPS server with ingressTLS.
+		ingressTLSRules []*spec.IngressRule
+		ingressTLS      *spec.IngressTLS
+	}
+
+	// pathPipeline is the pipeline dedicated to the paths with weighted
+	// backends or path filters.
+	pathPipeline struct {
+		backend  string
+		backends []*spec.IngressBackend
+		filters  *spec.IngressPathFilters
 	}
 
 	// Status is the traffic controller status
@@ -82,8 +101,10 @@ func New(superSpec *supervisor.Spec) *IngressController {
 
 		backendHTTPPipelines: make(map[string]*supervisor.ObjectEntity),
 		ingressBackends:      make(map[string]struct{}),
+		ingressPathPipelines: make(map[string]*pathPipeline),
 		ingressRules:         []*spec.IngressRule{},
 	}
+	ic.listInstances = ic.service.ListServiceInstanceSpecs
 
 	err := ic.informer.OnAllIngressSpecs(ic.handleIngresses)
 	if err != nil && err != informer.ErrAlreadyWatched {
@@ -159,9 +180,47 @@ func (ic *IngressController) reloadTraffic() {
 
 func (ic *IngressController) _reloadIngress() {
 	ingressBackends, ingressRules := make(map[string]struct{}), []*spec.IngressRule{}
+	ingressTLSRules := []*spec.IngressRule{}
+	ingressPathPipelines := make(map[string]*pathPipeline)
+
+	// NOTE: The ingresses enabling TLS share the HTTPS server on its own
+	// port with the certs of all of them, the others share the HTTP one.
+	var ingressTLS *spec.IngressTLS
+
 	for _, ingress := range ic.service.ListIngressSpecs() {
-		for _, rule := range ingress.Rules {
-			for _, path := range rule.Paths {
+		if ingress.TLS != nil {
+			if ingressTLS == nil {
+				ingressTLS = &spec.IngressTLS{
+					Certs: map[string]string{},
+					Keys:  map[string]string{},
+				}
+			}
+			for host, cert := range ingress.TLS.Certs {
+				ingressTLS.Certs[host] = cert
+				ingressTLS.Keys[host] = ingress.TLS.Keys[host]
+			}
+		}
+
+		for i, rule := range ingress.Rules {
+			for j, path := range rule.Paths {
+				if filters := ingress.PathFilters(path); filters != nil {
+					name := spec.IngressPathPipelineName(ingress.Name, i, j)
+					ingressPathPipelines[name] = &pathPipeline{
+						backend:  path.Backend,
+						backends: path.Backends,
+						filters:  filters,
+					}
+					path.Backend = name
+					continue
+				}
+
+				if len(path.Backends) != 0 {
+					name := spec.IngressWeightedPipelineName(path.Backends)
+					ingressPathPipelines[name] = &pathPipeline{backends: path.Backends}
+					path.Backend = name
+					continue
+				}
+
 				ingressBackends[path.Backend] = struct{}{}
 				serviceSpec := &spec.Service{
 					Name: path.Backend,
@@ -169,16 +228,23 @@ func (ic *IngressController) _reloadIngress() {
 				path.Backend = serviceSpec.IngressPipelineName()
 			}
 
-			ingressRules = append(ingressRules, rule)
+			if ingress.TLS != nil {
+				ingressTLSRules = append(ingressTLSRules, rule)
+			} else {
+				ingressRules = append(ingressRules, rule)
+			}
 		}
 	}
 
 	ic.ingressBackends, ic.ingressRules = ingressBackends, ingressRules
+	ic.ingressTLSRules, ic.ingressTLS = ingressTLSRules, ingressTLS
+	ic.ingressPathPipelines = ingressPathPipelines
 }
 
 func (ic *IngressController) _reloadHTTPPipelines() {
 	for backend, entity := range ic.backendHTTPPipelines {
-		if _, exists := ic.ingressBackends[backend]; !exists {
+		_, exists := ic.ingressBackends[backend]
+		if _, isPath := ic.ingressPathPipelines[backend]; !exists && !isPath {
 			err := ic.tc.DeleteHTTPPipeline(ic.namespace, entity.Spec().Name())
 			if err != nil {
 				logger.Errorf("delete http pipeline %s failed: %v",
@@ -192,23 +258,19 @@ func (ic *IngressController) _reloadHTTPPipelines() {
 		if _, exists := ic.ingressBackends[serviceSpec.BackendName()]; !exists {
 			continue
 		}
-
-		instanceSpecs := ic.service.ListServiceInstanceSpecs(serviceSpec.Name)
-		if len(instanceSpecs) == 0 {
-			continue
-		}
-		upInstance := 0
-		for _, instanceSpec := range instanceSpecs {
-			if instanceSpec.Status == spec.ServiceStatusUp {
-				upInstance++
+		if serviceSpec.SoftDeleted() {
+			if entity, exists := ic.backendHTTPPipelines[serviceSpec.BackendName()]; exists {
+				err := ic.tc.DeleteHTTPPipeline(ic.namespace, entity.Spec().Name())
+				if err != nil {
+					logger.Errorf("delete http pipeline %s failed: %v",
+						entity.Spec().Name(), err)
+				}
+				delete(ic.backendHTTPPipelines, serviceSpec.BackendName())
 			}
-		}
-		if upInstance == 0 {
 			continue
 		}
 
-		// FIXME: What if the instance address is always 127.0.0.1.
-		superSpec, err := serviceSpec.IngressPipelineSpec(instanceSpecs)
+		superSpec, err := ic.backendPipelineSpec(serviceSpec)
 		if err != nil {
 			logger.Errorf("get ingress pipeline for %s failed: %v",
 				serviceSpec.Name, err)
@@ -223,10 +285,65 @@ func (ic *IngressController) _reloadHTTPPipelines() {
 
 		ic.backendHTTPPipelines[serviceSpec.BackendName()] = entity
 	}
+
+	if len(ic.ingressPathPipelines) == 0 {
+		return
+	}
+
+	services := make(map[string]*spec.Service)
+	for _, serviceSpec := range ic.service.ListServiceSpecs() {
+		if !serviceSpec.SoftDeleted() {
+			services[serviceSpec.Name] = serviceSpec
+		}
+	}
+
+	for name, pp := range ic.ingressPathPipelines {
+		superSpec, err := ic.pathPipelineSpec(name, pp, services)
+		if err != nil {
+			logger.Errorf("get ingress pipeline %s failed: %v", name, err)
+			continue
+		}
+
+		entity, err := ic.tc.ApplyHTTPPipelineForSpec(ic.namespace, superSpec)
+		if err != nil {
+			logger.Errorf("apply http pipeline %s failed: %v", superSpec.Name(), err)
+			continue
+		}
+
+		ic.backendHTTPPipelines[name] = entity
+	}
+}
+
+// backendPipelineSpec generates the pipeline of the service backend, the
+// one of the service without UP instances responds 503 explicitly.
+func (ic *IngressController) backendPipelineSpec(serviceSpec *spec.Service) (*supervisor.Spec, error) {
+	instanceSpecs := ic.listInstances(serviceSpec.Name)
+
+	// FIXME: What if the instance address is always 127.0.0.1.
+	return serviceSpec.IngressPipelineSpec(instanceSpecs)
+}
+
+func (ic *IngressController) pathPipelineSpec(name string, pp *pathPipeline,
+	services map[string]*spec.Service) (*supervisor.Spec, error) {
+	if len(pp.backends) != 0 {
+		instanceSpecs := make(map[string][]*spec.ServiceInstanceSpec)
+		for _, b := range pp.backends {
+			instanceSpecs[b.Service] = ic.listInstances(b.Service)
+		}
+		return spec.IngressWeightedPipelineSpec(name, pp.filters, pp.backends, services, instanceSpecs)
+	}
+
+	serviceSpec := services[pp.backend]
+	if serviceSpec == nil {
+		return nil, fmt.Errorf("service %s not found", pp.backend)
+	}
+
+	instanceSpecs := ic.listInstances(pp.backend)
+	return serviceSpec.IngressPathPipelineSpec(name, pp.filters, instanceSpecs)
 }
 
 func (ic *IngressController) _reloadHTTPServer() {
-	superSpec, err := spec.IngressHTTPServerSpec(ic.spec.IngressPort, ic.ingressRules)
+	superSpec, err := spec.IngressHTTPServerSpec(ic.spec.IngressPort, ic.ingressRules, nil)
 	if err != nil {
 		logger.Errorf("get ingress http server spec failed: %v", err)
 		return
@@ -239,6 +356,37 @@ func (ic *IngressController) _reloadHTTPServer() {
 	}
 
 	ic.httpServer = entity
+
+	ic._reloadHTTPSServer()
+}
+
+// _reloadHTTPSServer reloads the HTTPS server of the ingresses enabling
+// TLS, it's deleted if there is none.
+func (ic *IngressController) _reloadHTTPSServer() {
+	if len(ic.ingressTLSRules) == 0 {
+		if ic.httpsServer != nil {
+			err := ic.tc.DeleteHTTPServer(ic.namespace, ic.httpsServer.Spec().Name())
+			if err != nil {
+				logger.Errorf("delete https server failed: %v", err)
+			}
+			ic.httpsServer = nil
+		}
+		return
+	}
+
+	superSpec, err := spec.IngressHTTPServerSpec(ic.spec.TLSIngressPort(), ic.ingressTLSRules, ic.ingressTLS)
+	if err != nil {
+		logger.Errorf("get ingress https server spec failed: %v", err)
+		return
+	}
+
+	entity, err := ic.tc.ApplyHTTPServerForSpec(ic.namespace, superSpec)
+	if err != nil {
+		logger.Errorf("apply https server failed: %v", err)
+		return
+	}
+
+	ic.httpsServer = entity
 }
 
 // Status returns the status of IngressController.
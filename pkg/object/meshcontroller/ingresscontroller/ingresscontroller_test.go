@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ingresscontroller
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func TestPipelineSpecWithoutUpInstances(t *testing.T) {
+	instanceSpecs := map[string][]*spec.ServiceInstanceSpec{
+		"order": {{ServiceName: "order", IP: "10.0.0.1", Port: 80, Status: spec.ServiceStatusOutOfService}},
+	}
+	ic := &IngressController{
+		listInstances: func(serviceName string) []*spec.ServiceInstanceSpec {
+			return instanceSpecs[serviceName]
+		},
+	}
+	order := &spec.Service{
+		Name: "order",
+		Sidecar: &spec.Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+	}
+	services := map[string]*spec.Service{"order": order}
+
+	checkUnavailable := func(superSpec *supervisor.Spec, err error) {
+		if err != nil {
+			t.Fatalf("generate pipeline without UP instances failed: %v", err)
+		}
+		flow := superSpec.ObjectSpec().(*httppipeline.Spec).Flow
+		if flow[len(flow)-1].Filter != spec.NoAvailableInstancesFilterName {
+			t.Errorf("want requests responded 503 without UP instances, got %+v", flow)
+		}
+		if yamlConfig := superSpec.YAMLConfig(); !strings.Contains(yamlConfig, "code: 503") {
+			t.Errorf("want code 503 in pipeline:\n%s", yamlConfig)
+		}
+	}
+
+	checkUnavailable(ic.backendPipelineSpec(order))
+	checkUnavailable(ic.pathPipelineSpec("path", &pathPipeline{backend: "order"}, services))
+	checkUnavailable(ic.pathPipelineSpec("weighted", &pathPipeline{
+		backends: []*spec.IngressBackend{{Service: "order", Weight: 100}},
+	}, services))
+
+	instanceSpecs["order"][0].Status = spec.ServiceStatusUp
+	superSpec, err := ic.backendPipelineSpec(order)
+	if err != nil {
+		t.Fatalf("generate pipeline failed: %v", err)
+	}
+	if yamlConfig := superSpec.YAMLConfig(); !strings.Contains(yamlConfig, "http://10.0.0.1:80") {
+		t.Errorf("want the UP instance in pipeline:\n%s", yamlConfig)
+	}
+}
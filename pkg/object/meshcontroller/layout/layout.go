@@ -45,6 +45,13 @@ const (
 	customResource           = "/mesh/custom-resources/%s/%s/" // +kind +name
 
 	globalCanaryHeaders = "/mesh/canary-headers"
+
+	rootCert          = "/mesh/mtls/root-cert"
+	serviceCertPrefix = "/mesh/mtls/service-certs/"
+	serviceCert       = "/mesh/mtls/service-certs/%s" // +serviceName
+
+	secretPrefix = "/mesh/secrets/"
+	secret       = "/mesh/secrets/%s" // +secretName
 )
 
 // ServiceSpecPrefix returns the prefix of service.
@@ -136,3 +143,28 @@ func CustomResourcePrefix(kind string) string {
 func CustomResourceKey(kind, name string) string {
 	return fmt.Sprintf(customResource, kind, name)
 }
+
+// RootCertKey returns the key of the mesh root certificate.
+func RootCertKey() string {
+	return rootCert
+}
+
+// ServiceCertPrefix returns the prefix of service certificates.
+func ServiceCertPrefix() string {
+	return serviceCertPrefix
+}
+
+// ServiceCertKey returns the key of service certificate.
+func ServiceCertKey(serviceName string) string {
+	return fmt.Sprintf(serviceCert, serviceName)
+}
+
+// SecretPrefix returns the prefix of secrets.
+func SecretPrefix() string {
+	return secretPrefix
+}
+
+// SecretKey returns the key of the secret.
+func SecretKey(name string) string {
+	return fmt.Sprintf(secret, name)
+}
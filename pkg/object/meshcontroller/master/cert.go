@@ -0,0 +1,198 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package master
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
+)
+
+const rootCAFileName = "root-ca.yaml"
+
+// checkCerts issues the certificates of the services whose sidecars enable
+// mTLS, and renews them after two thirds of their lifetime. The sidecars
+// watch their certificates and reload them without restarting.
+//
+// NOTE: The root certificate is created once and never renewed, because
+// the sidecars verifying peers by the old root reject the new certificates.
+// Its private key stays in the data directory of the master creating it,
+// only that master signs the service certificates, others have to get a
+// copy of the file to take over.
+func (m *Master) checkCerts() {
+	if !m.certsOutdated(time.Now()) {
+		return
+	}
+
+	// NOTE: All masters check the certificates, the lock makes sure
+	// the service certificates are signed by the same root certificate.
+	m.service.Lock()
+	defer m.service.Unlock()
+
+	now := time.Now()
+	mtlsServices := m.mtlsServices()
+
+	for _, cert := range m.service.ListServiceCerts() {
+		if !mtlsServices[cert.ServiceName] {
+			logger.Infof("delete certificate of service %s disabling mTLS", cert.ServiceName)
+			m.service.DeleteServiceCert(cert.ServiceName)
+		}
+	}
+
+	if len(mtlsServices) == 0 {
+		return
+	}
+
+	root, err := m.rootCA()
+	if err != nil {
+		logger.Errorf("%v", err)
+		return
+	}
+
+	for serviceName := range mtlsServices {
+		cert := m.service.GetServiceCert(serviceName)
+		if cert != nil && !cert.NeedRenew(now) {
+			continue
+		}
+
+		cert, err := root.SignServiceCertificate(serviceName, m.spec.CertTTL())
+		if err != nil {
+			logger.Errorf("sign certificate of service %s failed: %v", serviceName, err)
+			continue
+		}
+		m.service.PutServiceCert(cert)
+		logger.Infof("signed certificate of service %s", serviceName)
+	}
+}
+
+// rootCA returns the root certificate with its private key, it creates the
+// root certificate if there is none in the cluster. The private key of the
+// root certificate written by older versions is moved to the local file.
+func (m *Master) rootCA() (*spec.Certificate, error) {
+	stored := m.service.GetRootCert()
+	if stored != nil && stored.KeyBase64 != "" {
+		if err := m.saveRootCA(stored); err != nil {
+			return nil, err
+		}
+		m.service.PutRootCert(stored)
+		logger.Infof("moved private key of root certificate to %s", m.rootCAFile)
+		return stored, nil
+	}
+
+	root, err := m.loadRootCA()
+	if err != nil {
+		return nil, err
+	}
+
+	if stored != nil {
+		if root == nil || root.CertBase64 != stored.CertBase64 {
+			return nil, fmt.Errorf("private key of root certificate not found in %s, "+
+				"only the master that created it can sign certificates", m.rootCAFile)
+		}
+		return root, nil
+	}
+
+	root, err = spec.NewRootCertificate(spec.RootCertTTL)
+	if err != nil {
+		return nil, fmt.Errorf("create root certificate failed: %v", err)
+	}
+	if err := m.saveRootCA(root); err != nil {
+		return nil, err
+	}
+	m.service.PutRootCert(root)
+	logger.Infof("created root certificate of mesh CA")
+
+	return root, nil
+}
+
+func (m *Master) loadRootCA() (*spec.Certificate, error) {
+	buff, err := ioutil.ReadFile(m.rootCAFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s failed: %v", m.rootCAFile, err)
+	}
+
+	root := &spec.Certificate{}
+	err = yaml.Unmarshal(buff, root)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal %s to yaml failed: %v", m.rootCAFile, err)
+	}
+
+	return root, nil
+}
+
+func (m *Master) saveRootCA(root *spec.Certificate) error {
+	buff, err := yaml.Marshal(root)
+	if err != nil {
+		return fmt.Errorf("marshal root certificate to yaml failed: %v", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(m.rootCAFile), 0o700)
+	if err != nil {
+		return fmt.Errorf("create directory of %s failed: %v", m.rootCAFile, err)
+	}
+
+	err = ioutil.WriteFile(m.rootCAFile, buff, 0o600)
+	if err != nil {
+		return fmt.Errorf("write %s failed: %v", m.rootCAFile, err)
+	}
+
+	return nil
+}
+
+// certsOutdated reports whether any certificate needs to be created,
+// renewed or deleted.
+func (m *Master) certsOutdated(now time.Time) bool {
+	mtlsServices := m.mtlsServices()
+
+	certs := m.service.ListServiceCerts()
+	for _, cert := range certs {
+		if !mtlsServices[cert.ServiceName] || cert.NeedRenew(now) {
+			return true
+		}
+	}
+
+	if len(mtlsServices) == 0 {
+		return false
+	}
+
+	if m.service.GetRootCert() == nil || len(certs) != len(mtlsServices) {
+		return true
+	}
+
+	return false
+}
+
+func (m *Master) mtlsServices() map[string]bool {
+	services := make(map[string]bool)
+	for _, s := range m.service.ListServiceSpecs() {
+		if s.MTLSEnabled() {
+			services[s.Name] = true
+		}
+	}
+	return services
+}
@@ -18,7 +18,9 @@
 package master
 
 import (
+	"path/filepath"
 	"runtime/debug"
+	"sync"
 	"time"
 
 	"gopkg.in/yaml.v2"
@@ -49,11 +51,33 @@ type (
 		store          storage.Storage
 		service        *service.Service
 
+		// rootCAFile keeps the root certificate of the mesh CA with its
+		// private key, which is never written to the cluster.
+		rootCAFile string
+
+		// status is refreshed every heartbeat interval, so it's cheap to poll.
+		statusMutex sync.RWMutex
+		status      *Status
+
 		done chan struct{}
 	}
 
 	// Status is the status of mesh master.
-	Status struct{}
+	Status struct {
+		spec.MeshSummary `yaml:",inline"`
+
+		RegistryType string `yaml:"registryType"`
+		IngressPort  int    `yaml:"ingressPort"`
+
+		ExternalServiceRegistry string `yaml:"externalServiceRegistry,omitempty"`
+		// LastSyncTime is the last time the instances of the external
+		// registry synced, in RFC3339 format.
+		LastSyncTime           string `yaml:"lastSyncTime,omitempty"`
+		ExternalRegistryHealth string `yaml:"externalRegistryHealth,omitempty"`
+
+		// UpdatedAt is the time the status refreshed, in RFC3339 format.
+		UpdatedAt string `yaml:"updatedAt"`
+	}
 )
 
 // New creates a mesh master.
@@ -68,16 +92,13 @@ func New(superSpec *supervisor.Spec) *Master {
 		store:          store,
 		service:        service.New(superSpec),
 		registrySyncer: newRegistrySyncer(superSpec),
+		rootCAFile: filepath.Join(superSpec.Super().Options().AbsDataDir,
+			superSpec.Name(), rootCAFileName),
 
 		done: make(chan struct{}),
 	}
 
-	heartbeat, err := time.ParseDuration(m.spec.HeartbeatInterval)
-	if err != nil {
-		logger.Errorf("BUG: parse heartbeat interval %s to duration failed: %v",
-			m.spec.HeartbeatInterval, err)
-	}
-	m.maxHeartbeatTimeout = heartbeat * 2
+	m.maxHeartbeatTimeout = m.spec.HeartbeatTimeout()
 
 	go m.run()
 
@@ -92,11 +113,24 @@ func (m *Master) run() {
 		return
 	}
 
+	specsMigrated := false
 	for {
 		select {
 		case <-m.done:
 			return
 		case <-time.After(watchInterval):
+			if !specsMigrated {
+				func() {
+					defer func() {
+						if err := recover(); err != nil {
+							logger.Errorf("failed to migrate service specs %v, stack trace: \n%s\n",
+								err, debug.Stack())
+						}
+					}()
+					m.migrateServiceSpecs()
+					specsMigrated = true
+				}()
+			}
 			func() {
 				defer func() {
 					if err := recover(); err != nil {
@@ -106,6 +140,33 @@ func (m *Master) run() {
 				}()
 				m.checkInstancesHeartbeat()
 			}()
+			func() {
+				defer func() {
+					if err := recover(); err != nil {
+						logger.Errorf("failed to check certificates %v, stack trace: \n%s\n",
+							err, debug.Stack())
+					}
+				}()
+				m.checkCerts()
+			}()
+			func() {
+				defer func() {
+					if err := recover(); err != nil {
+						logger.Errorf("failed to purge deleted services %v, stack trace: \n%s\n",
+							err, debug.Stack())
+					}
+				}()
+				m.purgeDeletedServices()
+			}()
+			func() {
+				defer func() {
+					if err := recover(); err != nil {
+						logger.Errorf("failed to refresh status %v, stack trace: \n%s\n",
+							err, debug.Stack())
+					}
+				}()
+				m.refreshStatus()
+			}()
 		case <-time.After(defaultCleanInterval):
 			func() {
 				defer func() {
@@ -190,6 +251,74 @@ func (m *Master) cleanDeadInstances() {
 	}
 }
 
+// migrateServiceSpecs rewrites the stored service specs of older versions
+// once after the master starts.
+func (m *Master) migrateServiceSpecs() {
+	m.service.Lock()
+	defer m.service.Unlock()
+
+	m.service.MigrateServiceSpecs()
+}
+
+// purgeDeletedServices hard-deletes the soft-deleted services kept longer
+// than the retention.
+func (m *Master) purgeDeletedServices() {
+	now := time.Now()
+	retention := m.spec.ServiceRetentionDuration()
+
+	expired := false
+	for _, s := range m.service.ListServiceSpecs() {
+		if s.DeletionExpired(retention, now) {
+			expired = true
+			break
+		}
+	}
+	if !expired {
+		return
+	}
+
+	// NOTE: The service could be restored by the API in the meantime.
+	m.service.Lock()
+	defer m.service.Unlock()
+
+	for _, s := range m.service.ListServiceSpecs() {
+		if s.DeletionExpired(retention, now) {
+			logger.Infof("purge service %s soft-deleted at %s", s.Name, s.DeletedAt)
+			m.service.DeleteServiceSpec(s.Name)
+		}
+	}
+}
+
+// refreshStatus rebuilds the status from the stored specs.
+func (m *Master) refreshStatus() {
+	summary := spec.SummarizeMesh(m.service.ListTenantSpecs(), m.service.ListServiceSpecs(),
+		m.service.ListAllServiceInstanceSpecs(), m.service.ListIngressSpecs())
+
+	status := &Status{
+		MeshSummary:  *summary,
+		RegistryType: m.spec.RegistryType,
+		IngressPort:  m.spec.IngressPort,
+		UpdatedAt:    time.Now().Format(time.RFC3339),
+	}
+	if m.spec.ExternalServiceRegistry != "" {
+		status.ExternalServiceRegistry = m.spec.ExternalServiceRegistry
+		status.LastSyncTime, status.ExternalRegistryHealth = m.registrySyncer.status()
+	}
+
+	m.statusMutex.Lock()
+	m.status = status
+	m.statusMutex.Unlock()
+}
+
+// MeshStatus returns the status refreshed lastly, it's nil before the
+// first refresh.
+func (m *Master) MeshStatus() *Status {
+	m.statusMutex.RLock()
+	defer m.statusMutex.RUnlock()
+
+	return m.status
+}
+
 func (m *Master) isMeshRegistryName(registryName string) bool {
 	// NOTE: Empty registry name means it is an internal mesh service by default.
 	switch registryName {
@@ -233,7 +362,14 @@ func (m *Master) Close() {
 
 // Status returns the status of master.
 func (m *Master) Status() *supervisor.Status {
+	status := m.MeshStatus()
+	if status == nil {
+		return &supervisor.Status{
+			ObjectStatus: nil,
+		}
+	}
+
 	return &supervisor.Status{
-		ObjectStatus: nil,
+		ObjectStatus: status,
 	}
 }
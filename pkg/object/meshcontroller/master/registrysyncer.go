@@ -18,6 +18,8 @@
 package master
 
 import (
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/megaease/easegress/pkg/logger"
@@ -45,6 +47,10 @@ type (
 		serviceRegistry   *serviceregistry.ServiceRegistry
 		registryWatcher   serviceregistry.RegistryWatcher
 
+		statusMutex  sync.Mutex
+		lastSyncTime time.Time
+		lastSyncErr  error
+
 		done chan struct{}
 	}
 )
@@ -93,9 +99,18 @@ func (rs *registrySyncer) run() {
 
 func (rs *registrySyncer) handleEvent(event *serviceregistry.RegistryEvent) {
 	defer func() {
-		if r := recover(); r != nil {
+		r := recover()
+		if r != nil {
 			logger.Errorf("recover from %v", r)
 		}
+
+		rs.statusMutex.Lock()
+		rs.lastSyncTime = time.Now()
+		rs.lastSyncErr = nil
+		if r != nil {
+			rs.lastSyncErr = fmt.Errorf("%v", r)
+		}
+		rs.statusMutex.Unlock()
 	}()
 
 	if event.UseReplace {
@@ -171,6 +186,24 @@ func (rs *registrySyncer) serviceInstanceSpecsFunc(meshInstances map[string]*spe
 	return true
 }
 
+// status returns the last time the instances of the external registry
+// synced and its health, empty time means never synced.
+func (rs *registrySyncer) status() (lastSyncTime string, health string) {
+	rs.statusMutex.Lock()
+	defer rs.statusMutex.Unlock()
+
+	switch {
+	case rs.lastSyncTime.IsZero():
+		return "", "waiting"
+	case rs.lastSyncErr != nil:
+		health = rs.lastSyncErr.Error()
+	default:
+		health = "ready"
+	}
+
+	return rs.lastSyncTime.Format(time.RFC3339), health
+}
+
 func (rs *registrySyncer) needSync() bool {
 	// NOTE: Only need one member in the cluster to do sync.
 	return rs.superSpec.Super().Cluster().IsLeader()
@@ -219,6 +252,7 @@ func (rs *registrySyncer) meshToExternalInstances(instances map[string]*spec.Ser
 
 			Address: instance.IP,
 			Port:    uint16(instance.Port),
+			Scheme:  instance.Scheme,
 		}
 		result[externalInstance.Key()] = externalInstance
 	}
@@ -233,6 +267,9 @@ func (rs *registrySyncer) externalToMeshInstance(instance *serviceregistry.Servi
 		InstanceID:   instance.InstanceID,
 		IP:           instance.Address,
 		Port:         uint32(instance.Port),
+		Scheme:       instance.Scheme,
+		Labels:       instance.Labels,
+		Status:       instance.Status,
 	}
 }
 
@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package master
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
+	"github.com/megaease/easegress/pkg/object/serviceregistry"
+	"github.com/megaease/easegress/pkg/util/urlrule"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func TestExternalInstanceLabelsMatchCanary(t *testing.T) {
+	rs := &registrySyncer{}
+
+	external := &serviceregistry.ServiceInstanceSpec{
+		RegistryName: "eureka-registry",
+		ServiceName:  "order",
+		InstanceID:   "order-v2",
+		Address:      "192.168.0.120",
+		Port:         8080,
+		Labels:       map[string]string{"version": "2"},
+	}
+	instance := rs.externalToMeshInstance(external)
+	instance.Status = spec.ServiceStatusUp
+	if instance.Labels["version"] != "2" {
+		t.Fatalf("labels should be copied from the external instance, got %v", instance.Labels)
+	}
+
+	service := &spec.Service{
+		Name: "order",
+		Sidecar: &spec.Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+		Canary: &spec.Canary{
+			CanaryRules: []*spec.CanaryRule{
+				{
+					Headers: map[string]*urlrule.StringMatch{
+						"X-canary": {Exact: "v2"},
+					},
+					ServiceInstanceLabels: map[string]string{"version": "2"},
+				},
+			},
+		},
+	}
+
+	superSpec, err := service.SideCarEgressPipelineSpec([]*spec.ServiceInstanceSpec{instance})
+	if err != nil {
+		t.Fatalf("generate egress pipeline failed: %v", err)
+	}
+	config := superSpec.YAMLConfig()
+	if !strings.Contains(config, "candidatePools") || !strings.Contains(config, "http://192.168.0.120:8080") {
+		t.Errorf("the external instance should be in the candidate pool:\n%s", config)
+	}
+}
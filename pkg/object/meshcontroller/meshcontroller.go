@@ -117,6 +117,10 @@ func (mc *MeshController) reload() {
 		logger.Infof("%s running in master role", mc.superSpec.Name())
 		mc.role = label.ValueRoleMaster
 		mc.master = master.New(mc.superSpec)
+		mc.api.SetMeshStatusFunc(func() (interface{}, bool) {
+			status := mc.master.MeshStatus()
+			return status, status != nil
+		})
 
 	case label.ValueRoleWorker:
 		logger.Infof("%s running in worker role", mc.superSpec.Name())
@@ -0,0 +1,151 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package registrycenter
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/object/meshcontroller/layout"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/service"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
+)
+
+type (
+	// BulkRegisterError reports the instances failed in bulk registration,
+	// none of the instances is registered if it's returned.
+	BulkRegisterError struct {
+		Failures []*BulkRegisterFailure
+	}
+
+	// BulkRegisterFailure is the failure of one instance in bulk registration.
+	BulkRegisterFailure struct {
+		// Index is the index of the instance in the request.
+		Index      int
+		InstanceID string
+		Err        error
+	}
+)
+
+func (e *BulkRegisterError) Error() string {
+	msgs := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		msgs = append(msgs, fmt.Sprintf("instance %d (%s): %v", f.Index, f.InstanceID, f.Err))
+	}
+	return fmt.Sprintf("bulk register failed: %s", strings.Join(msgs, "; "))
+}
+
+func (e *BulkRegisterError) add(index int, ins *spec.ServiceInstanceSpec, err error) {
+	e.Failures = append(e.Failures, &BulkRegisterFailure{
+		Index:      index,
+		InstanceID: ins.InstanceID,
+		Err:        err,
+	})
+}
+
+func validateInstanceSpec(ins *spec.ServiceInstanceSpec) error {
+	switch {
+	case ins.ServiceName == "":
+		return fmt.Errorf("empty service name")
+	case ins.InstanceID == "":
+		return fmt.Errorf("empty instance id")
+	case net.ParseIP(ins.IP) == nil:
+		return fmt.Errorf("invalid ip: %q", ins.IP)
+	case ins.Port == 0 || ins.Port > 65535:
+		return fmt.Errorf("invalid port: %d", ins.Port)
+	}
+	return nil
+}
+
+// validateInstances validates the instances and checks the duplicated ones in
+// the request, it returns nil if all of them are valid.
+func validateInstances(instances []*spec.ServiceInstanceSpec) *BulkRegisterError {
+	bulkErr := &BulkRegisterError{}
+	keys := make(map[string]int, len(instances))
+	for i, ins := range instances {
+		if err := validateInstanceSpec(ins); err != nil {
+			bulkErr.add(i, ins, err)
+			continue
+		}
+
+		// NOTE: The registry name is not in the storage key, the instances
+		// differing only by it overwrite each other.
+		key := layout.ServiceInstanceSpecKey(ins.ServiceName, ins.InstanceID)
+		if j, exists := keys[key]; exists {
+			bulkErr.add(i, ins, fmt.Errorf("duplicated with instance %d", j))
+			continue
+		}
+		keys[key] = i
+	}
+
+	if len(bulkErr.Failures) != 0 {
+		return bulkErr
+	}
+	return nil
+}
+
+// BulkRegister registers the instances all-or-nothing with one storage write.
+// It returns *BulkRegisterError if any instance fails the validation or
+// conflicts with the registered one, the caller should hold the service lock.
+func BulkRegister(s *service.Service, instances []*spec.ServiceInstanceSpec) error {
+	if bulkErr := validateInstances(instances); bulkErr != nil {
+		return bulkErr
+	}
+
+	policy := s.AdminSpec().InstanceIDConflictPolicy
+	bulkErr := &BulkRegisterError{}
+	for i, ins := range instances {
+		originIns := s.GetServiceInstanceSpec(ins.ServiceName, ins.InstanceID)
+		if err := checkInstanceConflict(originIns, ins, policy); err != nil {
+			bulkErr.add(i, ins, err)
+		}
+	}
+	if len(bulkErr.Failures) != 0 {
+		return bulkErr
+	}
+
+	specs, statuses := bulkRegisterRecords(instances, time.Now())
+	s.PutServiceInstanceSpecs(specs, statuses)
+
+	return nil
+}
+
+// bulkRegisterRecords returns the UP instance specs and their statuses
+// heartbeated at now, the master marks the instances without statuses
+// out of service.
+func bulkRegisterRecords(instances []*spec.ServiceInstanceSpec,
+	now time.Time) ([]*spec.ServiceInstanceSpec, []*spec.ServiceInstanceStatus) {
+	nowStr := now.Format(time.RFC3339)
+	specs := make([]*spec.ServiceInstanceSpec, 0, len(instances))
+	statuses := make([]*spec.ServiceInstanceStatus, 0, len(instances))
+	for _, ins := range instances {
+		registered := *ins
+		registered.Status = spec.ServiceStatusUp
+		registered.RegistryTime = nowStr
+		specs = append(specs, &registered)
+		statuses = append(statuses, &spec.ServiceInstanceStatus{
+			ServiceName:       ins.ServiceName,
+			InstanceID:        ins.InstanceID,
+			LastHeartbeatTime: nowStr,
+		})
+	}
+
+	return specs, statuses
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package registrycenter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
+)
+
+func TestValidateInstances(t *testing.T) {
+	valid := func(id, ip string) *spec.ServiceInstanceSpec {
+		return &spec.ServiceInstanceSpec{
+			ServiceName: "order",
+			InstanceID:  id,
+			IP:          ip,
+			Port:        13001,
+		}
+	}
+
+	instances := []*spec.ServiceInstanceSpec{
+		valid("order-01", "10.0.0.1"),
+		valid("order-02", "10.0.0.2"),
+	}
+	if err := validateInstances(instances); err != nil {
+		t.Fatalf("valid instances failed: %v", err)
+	}
+
+	noPort := valid("order-03", "10.0.0.3")
+	noPort.Port = 0
+	instances = append(instances,
+		valid("order-02", "10.0.0.4"),
+		valid("order-04", "not-an-ip"),
+		noPort,
+		&spec.ServiceInstanceSpec{ServiceName: "order", IP: "10.0.0.5", Port: 13001},
+	)
+
+	bulkErr := validateInstances(instances)
+	if bulkErr == nil {
+		t.Fatalf("invalid instances should fail")
+	}
+
+	var err error = bulkErr
+	var target *BulkRegisterError
+	if !errors.As(err, &target) {
+		t.Errorf("want *BulkRegisterError, got %T", err)
+	}
+
+	wantIndexes := []int{2, 3, 4, 5}
+	if len(bulkErr.Failures) != len(wantIndexes) {
+		t.Fatalf("want %d failures, got %d: %v", len(wantIndexes), len(bulkErr.Failures), bulkErr)
+	}
+	for i, f := range bulkErr.Failures {
+		if f.Index != wantIndexes[i] {
+			t.Errorf("want failure of instance %d, got %d: %v", wantIndexes[i], f.Index, f.Err)
+		}
+	}
+	if bulkErr.Failures[0].InstanceID != "order-02" {
+		t.Errorf("want duplicated instance order-02, got %s", bulkErr.Failures[0].InstanceID)
+	}
+}
+
+func TestValidateInstancesDuplicatedByStorageKey(t *testing.T) {
+	instances := []*spec.ServiceInstanceSpec{
+		{RegistryName: "eureka-registry", ServiceName: "order", InstanceID: "order-01", IP: "10.0.0.1", Port: 13001},
+		{RegistryName: "consul-registry", ServiceName: "order", InstanceID: "order-01", IP: "10.0.0.1", Port: 13001},
+	}
+
+	bulkErr := validateInstances(instances)
+	if bulkErr == nil || len(bulkErr.Failures) != 1 || bulkErr.Failures[0].Index != 1 {
+		t.Errorf("want instance 1 duplicated with different registry name, got %v", bulkErr)
+	}
+}
+
+func TestBulkRegisterRecords(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	instances := []*spec.ServiceInstanceSpec{
+		{ServiceName: "order", InstanceID: "order-01", IP: "10.0.0.1", Port: 13001},
+		{ServiceName: "order", InstanceID: "order-02", IP: "10.0.0.2", Port: 13001},
+	}
+
+	specs, statuses := bulkRegisterRecords(instances, now)
+	if len(specs) != 2 || len(statuses) != 2 {
+		t.Fatalf("want 2 specs and 2 statuses, got %d and %d", len(specs), len(statuses))
+	}
+	for i := range specs {
+		if specs[i].Status != spec.ServiceStatusUp {
+			t.Errorf("want instance %d UP, got %s", i, specs[i].Status)
+		}
+		if statuses[i].InstanceID != specs[i].InstanceID || statuses[i].LastHeartbeatTime != "2021-01-01T00:00:00Z" {
+			t.Errorf("want status of instance %d heartbeated at now, got %+v", i, statuses[i])
+		}
+	}
+	if instances[0].Status != "" {
+		t.Errorf("the requested instances should not be modified")
+	}
+}
@@ -22,8 +22,6 @@ import (
 	"runtime/debug"
 	"strings"
 
-	"go.etcd.io/etcd/api/v3/mvccpb"
-
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
 )
@@ -34,12 +32,7 @@ type (
 	ServiceRegistryInfo struct {
 		Service *spec.Service
 		Ins     *spec.ServiceInstanceSpec // indicates local egress
-		Version int64                     // tenant Etcd key version,
-	}
-
-	tenantInfo struct {
-		tenant *spec.Tenant
-		info   *mvccpb.KeyValue
+		Version int64                     // tenant and grants Etcd revision,
 	}
 )
 
@@ -60,30 +53,43 @@ func GetServiceName(instanceID string) string {
 	return names[2]
 }
 
-// defaultInstance creates default egress instance point to the sidecar's egress port
-func (rcs *Server) defaultInstance(self, target *spec.Service) *spec.ServiceInstanceSpec {
+// defaultInstance creates default egress instance point to the sidecar's egress port,
+// the name is the canonical name or an alias of the target.
+func (rcs *Server) defaultInstance(self *spec.Service, name string) *spec.ServiceInstanceSpec {
 	return &spec.ServiceInstanceSpec{
-		ServiceName: target.Name,
-		InstanceID:  UniqInstanceID(target.Name),
+		ServiceName: name,
+		InstanceID:  UniqInstanceID(name),
 		IP:          self.Sidecar.Address,
 		Port:        uint32(self.Sidecar.EgressPort),
 	}
 }
 
-func (rcs *Server) getTenants(tenantNames []string) map[string]*tenantInfo {
-	tenantInfos := make(map[string]*tenantInfo)
+// visibleTenants returns the global tenant and the registry tenant of the
+// local service, and the newest revision of them and the grants as the
+// version, so that the change of any visible tenant or granted service
+// invalidates the caches of the discovery clients. The global tenant is nil
+// if it doesn't exist.
+func (rcs *Server) visibleTenants() (*spec.Tenant, *spec.Tenant, int64, error) {
+	// NOTE: The specs are synced right after registering, so they're not
+	// ready only if the registering is just done.
+	if !rcs.discoveryCache.waitSynced(rcs.done) {
+		return nil, nil, 0, spec.ErrNoRegisteredYet
+	}
 
-	for _, v := range tenantNames {
-		tenant, info := rcs.service.GetTenantSpecWithInfo(v)
-		if tenant != nil {
-			tenantInfos[v] = &tenantInfo{
-				tenant: tenant,
-				info:   info,
-			}
-		}
+	global, version := rcs.discoveryCache.tenant(spec.GlobalTenant)
+	tenant, revision := rcs.discoveryCache.tenant(rcs.tenant)
+	if tenant == nil {
+		logger.Errorf("BUG: can't find service: %s's registry tenant: %s", rcs.serviceName, rcs.tenant)
+		return nil, nil, 0, spec.ErrRegistryTenantNotFound
+	}
+	if revision > version {
+		version = revision
+	}
+	if _, revision = rcs.discoveryCache.grantedServices(); revision > version {
+		version = revision
 	}
 
-	return tenantInfos
+	return global, tenant, version, nil
 }
 
 // DiscoveryService gets one service specs with default instance
@@ -99,41 +105,41 @@ func (rcs *Server) DiscoveryService(serviceName string) (*ServiceRegistryInfo, e
 		return serviceInfo, spec.ErrNoRegisteredYet
 	}
 
-	tenants := rcs.getTenants([]string{spec.GlobalTenant, rcs.tenant})
-	target := rcs.service.GetServiceSpec(serviceName)
-	if target == nil {
+	globalTenant, _, version, err := rcs.visibleTenants()
+	if err != nil {
+		return serviceInfo, err
+	}
+
+	target := rcs.discoveryCache.resolveService(serviceName)
+	if target == nil || target.SoftDeleted() {
 		return nil, spec.ErrServiceNotFound
 	}
-	self := rcs.service.GetServiceSpec(rcs.serviceName)
+	self := rcs.discoveryCache.service(rcs.serviceName)
 	if self == nil {
 		logger.Errorf("service: %s get self spec not found", rcs.serviceName)
-		return nil, spec.ErrNoRegisteredYet
+		return nil, spec.ErrSelfServiceNotFound
 	}
 
 	var inGlobal = false
-	if globalTenant, ok := tenants[spec.GlobalTenant]; ok {
-		for _, v := range globalTenant.tenant.Services {
-			if v == serviceName {
+	if globalTenant != nil {
+		for _, v := range globalTenant.Services {
+			if v == serviceName || v == target.Name {
 				inGlobal = true
 				break
 			}
 		}
 	}
 
-	if _, ok := tenants[rcs.tenant]; !ok {
-		err := fmt.Errorf("BUG: can't find service: %s's registry tenant: %s", rcs.serviceName, rcs.tenant)
-		logger.Errorf("%v", err)
-		return serviceInfo, err
-	}
-
-	if !inGlobal && target.RegisterTenant != rcs.tenant {
+	// NOTE: The services in other tenants are denied unless they're global
+	// or granted explicitly.
+	if !inGlobal && target.RegisterTenant != rcs.tenant && !rcs.discoveryCache.isGranted(target.Name) {
 		return nil, spec.ErrServiceNotFound
 	}
 
 	return &ServiceRegistryInfo{
 		Service: target,
-		Ins:     rcs.defaultInstance(self, target),
-		Version: tenants[rcs.tenant].info.Version,
+		Ins:     rcs.defaultInstance(self, serviceName),
+		Version: version,
 	}, nil
 }
 
@@ -149,61 +155,73 @@ func (rcs *Server) Discovery() ([]*ServiceRegistryInfo, error) {
 	var (
 		serviceInfos    []*ServiceRegistryInfo
 		visibleServices map[string]bool
-		err             error
 	)
 	visibleServices = make(map[string]bool)
 	if !rcs.registered {
 		return serviceInfos, spec.ErrNoRegisteredYet
 	}
-	self := rcs.service.GetServiceSpec(rcs.serviceName)
+
+	globalTenant, tenant, version, err := rcs.visibleTenants()
+	if err != nil {
+		return serviceInfos, err
+	}
+
+	self := rcs.discoveryCache.service(rcs.serviceName)
 	if self == nil {
 		logger.Errorf("service: %s get self spec not found", rcs.serviceName)
-		return serviceInfos, spec.ErrNoRegisteredYet
+		return serviceInfos, spec.ErrSelfServiceNotFound
 	}
-	var version int64
-	tenantInfos := rcs.getTenants([]string{spec.GlobalTenant, rcs.tenant})
-	if globalTenant, ok := tenantInfos[spec.GlobalTenant]; ok {
-		version = globalTenant.info.Version
-		for _, v := range tenantInfos[spec.GlobalTenant].tenant.Services {
+	if globalTenant != nil {
+		for _, v := range globalTenant.Services {
 			if v != rcs.serviceName {
 				visibleServices[v] = true
 			}
 		}
 	}
-
-	tenant, ok := tenantInfos[rcs.tenant]
-	if !ok {
-		err = fmt.Errorf("BUG: can't find service: %s's registry tenant: %s", rcs.serviceName, rcs.tenant)
-		logger.Errorf("%v", err)
-		return serviceInfos, err
-	}
-	if tenant.info.Version > version {
-		version = tenant.info.Version
+	for _, v := range tenant.Services {
+		visibleServices[v] = true
 	}
 
-	for _, v := range tenantInfos[rcs.tenant].tenant.Services {
-		visibleServices[v] = true
+	// NOTE: The visible services are listed by their aliases too, and the
+	// ones listed by aliases in tenants are resolved to the canonical ones.
+	listed := make(map[string]bool)
+	appendInfos := func(spec *spec.Service, names ...string) {
+		for _, name := range names {
+			if listed[name] {
+				continue
+			}
+			listed[name] = true
+
+			serviceInfos = append(serviceInfos, &ServiceRegistryInfo{
+				Service: spec,
+				Ins:     rcs.defaultInstance(self, name),
+				Version: version,
+			})
+		}
 	}
 
 	for k := range visibleServices {
-		var spec *spec.Service
-		if k == rcs.serviceName {
-			spec = self
-		} else {
-			if service := rcs.service.GetServiceSpec(k); service == nil {
+		service := self
+		if k != rcs.serviceName {
+			service = rcs.discoveryCache.resolveService(k)
+			if service == nil {
 				logger.Errorf("service %s not found", k)
 				continue
-			} else {
-				spec = service
+			}
+			if service.SoftDeleted() {
+				continue
 			}
 		}
 
-		serviceInfos = append(serviceInfos, &ServiceRegistryInfo{
-			Service: spec,
-			Ins:     rcs.defaultInstance(self, spec),
-			Version: version,
-		})
+		appendInfos(service, append([]string{k}, service.Names()...)...)
+	}
+
+	// NOTE: The services granted by other tenants differ by caller, so
+	// they're indexed for the local service only.
+	granted, _ := rcs.discoveryCache.grantedServices()
+	for _, service := range granted {
+		appendInfos(service, service.Names()...)
 	}
 
-	return serviceInfos, err
+	return serviceInfos, nil
 }
@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package registrycenter
+
+import (
+	"testing"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
+)
+
+func TestVisibleTenants(t *testing.T) {
+	rcs := &Server{
+		serviceName:    "service-a",
+		tenant:         "tenant-a",
+		discoveryCache: newDiscoveryCache("service-a"),
+		done:           make(chan struct{}),
+	}
+	tenantKVs := map[string]*mvccpb.KeyValue{
+		spec.GlobalTenant: specKV(t, 5, &spec.Tenant{Name: spec.GlobalTenant}),
+		"tenant-a":        specKV(t, 3, &spec.Tenant{Name: "tenant-a"}),
+	}
+	rcs.discoveryCache.updateTenants(tenantKVs)
+	rcs.discoveryCache.updateServices(nil)
+
+	if _, _, version, _ := rcs.visibleTenants(); version != 5 {
+		t.Errorf("want the newer global version 5, got %d", version)
+	}
+
+	tenantKVs["tenant-a"] = specKV(t, 8, &spec.Tenant{Name: "tenant-a"})
+	rcs.discoveryCache.updateTenants(tenantKVs)
+	if _, _, version, _ := rcs.visibleTenants(); version != 8 {
+		t.Errorf("want the newer tenant version 8, got %d", version)
+	}
+
+	delete(tenantKVs, spec.GlobalTenant)
+	rcs.discoveryCache.updateTenants(tenantKVs)
+	global, _, version, _ := rcs.visibleTenants()
+	if global != nil || version != 8 {
+		t.Errorf("want version 8 without global tenant, got %d", version)
+	}
+
+	delete(tenantKVs, "tenant-a")
+	rcs.discoveryCache.updateTenants(tenantKVs)
+	if _, _, _, err := rcs.visibleTenants(); err != spec.ErrRegistryTenantNotFound {
+		t.Errorf("want ErrRegistryTenantNotFound, got %v", err)
+	}
+}
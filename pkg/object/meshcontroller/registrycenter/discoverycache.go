@@ -0,0 +1,316 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package registrycenter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
+)
+
+// discoverySyncTimeout is the longest time the discovery waits for the
+// first sync of the tenants and services.
+var discoverySyncTimeout = 5 * time.Second
+
+type (
+	// discoveryCache keeps the tenant and service specs synced by the
+	// watchers, so the discovery reads nothing from etcd. A spec is decoded
+	// only when its revision changes, and the services granted to the local
+	// service are indexed on every change.
+	discoveryCache struct {
+		serviceName string
+
+		mutex sync.RWMutex
+
+		// tenants and services are keyed by their etcd keys.
+		tenants  map[string]*discoveryCacheTenant
+		services map[string]*discoveryCacheService
+		// tenantNames and serviceNames index them by their names.
+		tenantNames  map[string]*discoveryCacheTenant
+		serviceNames map[string]*spec.Service
+		// revision is the newest revision of the synced specs.
+		revision int64
+
+		// granted are the services in other tenants granted to the local
+		// service, grantsRevision changes whenever they change.
+		granted        map[string]*spec.Service
+		grantsRevision int64
+
+		tenantsSynced, servicesSynced bool
+		// synced is closed after both tenants and services are synced.
+		synced chan struct{}
+	}
+
+	discoveryCacheTenant struct {
+		revision int64
+		tenant   *spec.Tenant
+	}
+
+	discoveryCacheService struct {
+		revision int64
+		service  *spec.Service
+	}
+)
+
+func newDiscoveryCache(serviceName string) *discoveryCache {
+	return &discoveryCache{
+		serviceName:  serviceName,
+		tenants:      make(map[string]*discoveryCacheTenant),
+		services:     make(map[string]*discoveryCacheService),
+		tenantNames:  make(map[string]*discoveryCacheTenant),
+		serviceNames: make(map[string]*spec.Service),
+		granted:      make(map[string]*spec.Service),
+		synced:       make(chan struct{}),
+	}
+}
+
+// runDiscoveryCache syncs the tenants and services to the discovery cache
+// until the server is closed.
+func (rcs *Server) runDiscoveryCache() {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-rcs.done
+		cancel()
+	}()
+
+	go keepWatching(ctx, "tenant specs", func(ctx context.Context) error {
+		return rcs.service.WatchTenantSpecs(ctx, rcs.discoveryCache.updateTenants)
+	})
+	keepWatching(ctx, "service specs", func(ctx context.Context) error {
+		return rcs.service.WatchServiceSpecs(ctx, rcs.discoveryCache.updateServices)
+	})
+}
+
+// updateTenants replaces the tenants with the synced ones, only the ones
+// with new revisions are decoded.
+func (dc *discoveryCache) updateTenants(kvs map[string]*mvccpb.KeyValue) {
+	dc.mutex.RLock()
+	prev := dc.tenants
+	dc.mutex.RUnlock()
+
+	tenants := make(map[string]*discoveryCacheTenant, len(kvs))
+	tenantNames := make(map[string]*discoveryCacheTenant, len(kvs))
+	for k, kv := range kvs {
+		entry := prev[k]
+		if entry == nil || entry.revision != kv.ModRevision {
+			tenant := &spec.Tenant{}
+			if err := yaml.Unmarshal(kv.Value, tenant); err != nil {
+				logger.Errorf("BUG: unmarshal %s to yaml failed: %v", kv.Value, err)
+				continue
+			}
+			entry = &discoveryCacheTenant{revision: kv.ModRevision, tenant: tenant}
+		}
+		tenants[k] = entry
+		tenantNames[entry.tenant.Name] = entry
+	}
+
+	dc.mutex.Lock()
+	defer dc.mutex.Unlock()
+
+	dc.tenants = tenants
+	dc.tenantNames = tenantNames
+	dc.tenantsSynced = true
+	dc.updateRevision(kvs)
+	dc.refreshGrants()
+	dc.checkSynced()
+}
+
+// updateServices replaces the services with the synced ones, only the
+// ones with new revisions are decoded.
+func (dc *discoveryCache) updateServices(kvs map[string]*mvccpb.KeyValue) {
+	dc.mutex.RLock()
+	prev := dc.services
+	dc.mutex.RUnlock()
+
+	services := make(map[string]*discoveryCacheService, len(kvs))
+	serviceNames := make(map[string]*spec.Service, len(kvs))
+	for k, kv := range kvs {
+		entry := prev[k]
+		if entry == nil || entry.revision != kv.ModRevision {
+			service := &spec.Service{}
+			if err := yaml.Unmarshal(kv.Value, service); err != nil {
+				logger.Errorf("BUG: unmarshal %s to yaml failed: %v", kv.Value, err)
+				continue
+			}
+			spec.MigrateService(service)
+			entry = &discoveryCacheService{revision: kv.ModRevision, service: service}
+		}
+		services[k] = entry
+		serviceNames[entry.service.Name] = entry.service
+	}
+
+	dc.mutex.Lock()
+	defer dc.mutex.Unlock()
+
+	dc.services = services
+	dc.serviceNames = serviceNames
+	dc.servicesSynced = true
+	dc.updateRevision(kvs)
+	dc.refreshGrants()
+	dc.checkSynced()
+}
+
+func (dc *discoveryCache) updateRevision(kvs map[string]*mvccpb.KeyValue) {
+	for _, kv := range kvs {
+		if kv.ModRevision > dc.revision {
+			dc.revision = kv.ModRevision
+		}
+	}
+}
+
+// refreshGrants indexes the services granted to the local service. The
+// grants revision moves forward if they change, even if it's caused by a
+// deletion without any new revision.
+func (dc *discoveryCache) refreshGrants() {
+	granted := make(map[string]*spec.Service)
+	if self := dc.serviceNames[dc.serviceName]; self != nil {
+		tenants := make([]*spec.Tenant, 0, len(dc.tenantNames))
+		for _, entry := range dc.tenantNames {
+			tenants = append(tenants, entry.tenant)
+		}
+		granted = spec.GrantedServices(self, tenants, dc.serviceList())
+	}
+
+	changed := len(granted) != len(dc.granted)
+	for name, service := range granted {
+		// NOTE: The specs are replaced only when they're updated.
+		if dc.granted[name] != service {
+			changed = true
+			break
+		}
+	}
+
+	dc.granted = granted
+	if changed {
+		dc.grantsRevision++
+		if dc.revision > dc.grantsRevision {
+			dc.grantsRevision = dc.revision
+		}
+	}
+}
+
+func (dc *discoveryCache) checkSynced() {
+	if !dc.tenantsSynced || !dc.servicesSynced {
+		return
+	}
+
+	select {
+	case <-dc.synced:
+	default:
+		close(dc.synced)
+	}
+}
+
+// waitSynced waits for the first sync, it returns false if it's timeout
+// or done is closed.
+func (dc *discoveryCache) waitSynced(done <-chan struct{}) bool {
+	select {
+	case <-dc.synced:
+		return true
+	case <-done:
+		return false
+	case <-time.After(discoverySyncTimeout):
+		return false
+	}
+}
+
+// tenant returns the tenant and the revision it was written in, nil means
+// not found.
+func (dc *discoveryCache) tenant(name string) (*spec.Tenant, int64) {
+	dc.mutex.RLock()
+	defer dc.mutex.RUnlock()
+
+	entry := dc.tenantNames[name]
+	if entry == nil {
+		return nil, 0
+	}
+
+	return entry.tenant, entry.revision
+}
+
+// service returns a copy of the service by its name, nil means not found.
+func (dc *discoveryCache) service(name string) *spec.Service {
+	dc.mutex.RLock()
+	defer dc.mutex.RUnlock()
+
+	return copyService(dc.serviceNames[name])
+}
+
+// resolveService returns a copy of the service by its name or alias, nil
+// means not found.
+func (dc *discoveryCache) resolveService(name string) *spec.Service {
+	dc.mutex.RLock()
+	defer dc.mutex.RUnlock()
+
+	if service := dc.serviceNames[name]; service != nil {
+		return copyService(service)
+	}
+
+	return copyService(spec.ResolveServiceAlias(dc.serviceList(), name))
+}
+
+// grantedServices returns copies of the services in other tenants granted
+// to the local service, and the revision of the grants.
+func (dc *discoveryCache) grantedServices() (map[string]*spec.Service, int64) {
+	dc.mutex.RLock()
+	defer dc.mutex.RUnlock()
+
+	granted := make(map[string]*spec.Service, len(dc.granted))
+	for name, service := range dc.granted {
+		granted[name] = copyService(service)
+	}
+
+	return granted, dc.grantsRevision
+}
+
+// isGranted reports whether the service in another tenant is granted to
+// the local service.
+func (dc *discoveryCache) isGranted(serviceName string) bool {
+	dc.mutex.RLock()
+	defer dc.mutex.RUnlock()
+
+	_, granted := dc.granted[serviceName]
+	return granted
+}
+
+// serviceList returns the cached services, the caller must hold the lock.
+func (dc *discoveryCache) serviceList() []*spec.Service {
+	services := make([]*spec.Service, 0, len(dc.serviceNames))
+	for _, service := range dc.serviceNames {
+		services = append(services, service)
+	}
+
+	return services
+}
+
+// copyService copies the service, so the callers never modify the cached
+// one. The fields under it are shared and must be read only.
+func copyService(service *spec.Service) *spec.Service {
+	if service == nil {
+		return nil
+	}
+
+	s := *service
+	return &s
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package registrycenter
+
+import (
+	"testing"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
+)
+
+func specKV(t *testing.T, revision int64, v interface{}) *mvccpb.KeyValue {
+	buff, err := yaml.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal %v failed: %v", v, err)
+	}
+
+	return &mvccpb.KeyValue{ModRevision: revision, Value: buff}
+}
+
+func TestDiscoveryCache(t *testing.T) {
+	dc := newDiscoveryCache("a")
+	if dc.waitSynced(closedChan()) {
+		t.Fatalf("want not synced before the first sync")
+	}
+
+	dc.updateTenants(map[string]*mvccpb.KeyValue{
+		"tenant-a": specKV(t, 1, &spec.Tenant{Name: "tenant-a", Services: []string{"a", "alias-b"}}),
+	})
+	if dc.waitSynced(closedChan()) {
+		t.Fatalf("want not synced before the services are synced")
+	}
+
+	serviceKVs := map[string]*mvccpb.KeyValue{
+		"a": specKV(t, 2, &spec.Service{Name: "a", RegisterTenant: "tenant-a"}),
+		"b": specKV(t, 3, &spec.Service{Name: "b", RegisterTenant: "tenant-a", Aliases: []string{"alias-b"}}),
+	}
+	dc.updateServices(serviceKVs)
+	if !dc.waitSynced(nil) {
+		t.Fatalf("want synced")
+	}
+
+	tenant, revision := dc.tenant("tenant-a")
+	if tenant == nil || revision != 1 {
+		t.Fatalf("want tenant-a in revision 1, got %v in revision %d", tenant, revision)
+	}
+	if b := dc.resolveService("alias-b"); b == nil || b.Name != "b" {
+		t.Fatalf("want alias-b resolved to b, got %v", b)
+	}
+
+	// NOTE: The specs in the same revisions are not decoded again.
+	cachedA := dc.services["a"].service
+	serviceKVs["b"] = specKV(t, 4, &spec.Service{Name: "b", RegisterTenant: "tenant-a"})
+	dc.updateServices(serviceKVs)
+	if dc.services["a"].service != cachedA {
+		t.Errorf("want a kept in cache")
+	}
+	if b := dc.resolveService("alias-b"); b != nil {
+		t.Errorf("want alias-b removed, got %v", b)
+	}
+
+	a := dc.service("a")
+	a.Name = "modified"
+	if dc.service("a").Name != "a" {
+		t.Errorf("want a copy of the cached service")
+	}
+
+	delete(serviceKVs, "a")
+	dc.updateServices(serviceKVs)
+	if a := dc.service("a"); a != nil {
+		t.Errorf("want a deleted, got %v", a)
+	}
+}
+
+func TestDiscoveryCacheGrants(t *testing.T) {
+	dc := newDiscoveryCache("a")
+	tenantB := &spec.Tenant{Name: "tenant-b", Services: []string{"b", "c"}}
+	tenantKVs := map[string]*mvccpb.KeyValue{
+		"tenant-a": specKV(t, 1, &spec.Tenant{Name: "tenant-a", Services: []string{"a"}}),
+		"tenant-b": specKV(t, 2, tenantB),
+	}
+	serviceKVs := map[string]*mvccpb.KeyValue{
+		"a": specKV(t, 3, &spec.Service{Name: "a", RegisterTenant: "tenant-a"}),
+		"b": specKV(t, 4, &spec.Service{Name: "b", RegisterTenant: "tenant-b", AllowedCallers: []string{"a"}}),
+		"c": specKV(t, 5, &spec.Service{Name: "c", RegisterTenant: "tenant-b"}),
+	}
+	dc.updateTenants(tenantKVs)
+	dc.updateServices(serviceKVs)
+
+	granted, revision := dc.grantedServices()
+	if len(granted) != 1 || granted["b"] == nil || !dc.isGranted("b") || dc.isGranted("c") {
+		t.Fatalf("want b granted, got %v", granted)
+	}
+	if revision != 5 {
+		t.Errorf("want grants revision 5, got %d", revision)
+	}
+
+	// NOTE: The unrelated changes keep the grants revision.
+	tenantKVs["tenant-a"] = specKV(t, 6, &spec.Tenant{Name: "tenant-a", Services: []string{"a", "d"}})
+	dc.updateTenants(tenantKVs)
+	if _, revision = dc.grantedServices(); revision != 5 {
+		t.Errorf("want grants revision 5 kept, got %d", revision)
+	}
+
+	tenantB.ExportedServices = []*spec.ServiceExport{{Service: "c", Tenants: []string{"tenant-a"}}}
+	tenantKVs["tenant-b"] = specKV(t, 7, tenantB)
+	dc.updateTenants(tenantKVs)
+	granted, revision = dc.grantedServices()
+	if len(granted) != 2 || !dc.isGranted("c") || revision != 7 {
+		t.Errorf("want b and c granted in revision 7, got %v in revision %d", granted, revision)
+	}
+
+	// NOTE: The deletion has no new revision, but the grants revision
+	// still moves forward.
+	delete(serviceKVs, "b")
+	dc.updateServices(serviceKVs)
+	granted, revision = dc.grantedServices()
+	if len(granted) != 1 || dc.isGranted("b") || revision != 8 {
+		t.Errorf("want c granted in revision 8, got %v in revision %d", granted, revision)
+	}
+
+	granted["c"].Name = "modified"
+	if granted, _ = dc.grantedServices(); granted["c"].Name != "c" {
+		t.Errorf("want copies of the granted services")
+	}
+}
+
+func closedChan() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
@@ -30,15 +30,15 @@ func (rcs *Server) ToEurekaInstanceInfo(serviceInfo *ServiceRegistryInfo) *eurek
 
 	ins.HostName = serviceInfo.Ins.IP
 	ins.IpAddr = serviceInfo.Ins.IP
-	ins.App = strings.ToUpper(serviceInfo.Service.Name)
+	ins.App = strings.ToUpper(serviceInfo.Ins.ServiceName)
 	ins.Status = eureka.UP
 	ins.InstanceID = serviceInfo.Ins.InstanceID
 	ins.DataCenterInfo = &eureka.DataCenterInfo{
 		Name:  "MyOwn",
 		Class: "com.netflix.appinfo.InstanceInfo$DefaultDataCenterInfo",
 	}
-	ins.VipAddress = serviceInfo.Service.Name
-	ins.SecureVipAddress = serviceInfo.Service.Name
+	ins.VipAddress = serviceInfo.Ins.ServiceName
+	ins.SecureVipAddress = serviceInfo.Ins.ServiceName
 	ins.ActionType = "ADDED"
 
 	ins.Port = &eureka.Port{
@@ -53,7 +53,7 @@ func (rcs *Server) ToEurekaInstanceInfo(serviceInfo *ServiceRegistryInfo) *eurek
 func (rcs *Server) ToEurekaApp(serviceInfo *ServiceRegistryInfo) *eureka.Application {
 	var app eureka.Application
 
-	app.Name = strings.ToUpper(serviceInfo.Service.Name)
+	app.Name = strings.ToUpper(serviceInfo.Ins.ServiceName)
 	app.Instances = append(app.Instances, *rcs.ToEurekaInstanceInfo(serviceInfo))
 
 	return &app
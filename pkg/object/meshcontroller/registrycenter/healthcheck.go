@@ -0,0 +1,209 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package registrycenter
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
+)
+
+const (
+	defaultHealthCheckInterval           = 10 * time.Second
+	defaultHealthCheckUnhealthyThreshold = 3
+
+	// healthCheckJitterPercent is the percent of the interval to randomize,
+	// so that the probes of many instances don't synchronize.
+	healthCheckJitterPercent = 20
+)
+
+type healthChecker struct {
+	failures int
+	// downgraded is true if the instance is marked OUT_OF_SERVICE by the
+	// health checker, it never brings up an instance downgraded by others.
+	downgraded bool
+}
+
+// healthCheckInterval returns the probe interval of the spec.
+func healthCheckInterval(hc *spec.HealthCheck) time.Duration {
+	if hc == nil || hc.Interval == "" {
+		return defaultHealthCheckInterval
+	}
+
+	// NOTE: The duration is validated by json schema.
+	interval, err := time.ParseDuration(hc.Interval)
+	if err != nil || interval <= 0 {
+		return defaultHealthCheckInterval
+	}
+	return interval
+}
+
+// jitter randomizes the interval in [interval-jitter/2, interval+jitter/2).
+func jitter(interval time.Duration) time.Duration {
+	j := int64(interval) * healthCheckJitterPercent / 100
+	if j <= 0 {
+		return interval
+	}
+	return interval - time.Duration(j/2) + time.Duration(rand.Int63n(j))
+}
+
+// record records the result of one probe, it returns the status the instance
+// should turn to, empty means keeping the current one.
+func (hc *healthChecker) record(success bool, threshold int) string {
+	if success {
+		hc.failures = 0
+		if hc.downgraded {
+			hc.downgraded = false
+			return spec.ServiceStatusUp
+		}
+		return ""
+	}
+
+	hc.failures++
+	if !hc.downgraded && hc.failures >= threshold {
+		hc.downgraded = true
+		return spec.ServiceStatusOutOfService
+	}
+	return ""
+}
+
+// healthCheck probes the application of the instance periodically if the
+// service enables health checks.
+func (rcs *Server) healthCheck() {
+	hc := &healthChecker{}
+
+	// NOTE: Start at a random point of the first interval to spread the
+	// probes of the instances started at the same time.
+	delay := time.Duration(rand.Int63n(int64(defaultHealthCheckInterval)))
+	for {
+		select {
+		case <-rcs.done:
+			return
+		case <-time.After(delay):
+			delay = jitter(rcs.healthCheckRoutine(hc))
+		}
+	}
+}
+
+// healthCheckRoutine does one probe and returns the interval to the next one.
+func (rcs *Server) healthCheckRoutine(hc *healthChecker) time.Duration {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Errorf("registry center recover from: %v, stack trace:\n%s\n",
+				err, debug.Stack())
+		}
+	}()
+
+	serviceSpec := rcs.service.GetServiceSpec(rcs.serviceName)
+	if serviceSpec == nil || serviceSpec.HealthCheck == nil || !rcs.Registered() {
+		return defaultHealthCheckInterval
+	}
+
+	healthCheck := serviceSpec.HealthCheck
+	interval := healthCheckInterval(healthCheck)
+	threshold := healthCheck.UnhealthyThreshold
+	if threshold == 0 {
+		threshold = defaultHealthCheckUnhealthyThreshold
+	}
+
+	var err error
+	if serviceSpec.GRPCHealthCheck() {
+		err = rcs.probeGRPC(healthCheck.GRPCService, interval)
+	} else {
+		err = rcs.probe(healthCheck.Path, interval)
+	}
+	if err != nil {
+		logger.Warnf("health check service: %s instanceID: %s failed: %v",
+			rcs.serviceName, rcs.instanceID, err)
+	}
+
+	status := hc.record(err == nil, threshold)
+	if status == "" {
+		return interval
+	}
+
+	ins := rcs.service.GetServiceInstanceSpec(rcs.serviceName, rcs.instanceID)
+	if ins == nil {
+		return interval
+	}
+	switch {
+	case status == spec.ServiceStatusOutOfService && ins.Status != spec.ServiceStatusUp:
+		// NOTE: It's not up, so don't bring it up on recovery either.
+		hc.downgraded = false
+		return interval
+	case status == spec.ServiceStatusUp && ins.Status != spec.ServiceStatusOutOfService:
+		return interval
+	}
+
+	logger.Infof("health check service: %s instanceID: %s change status from %s to %s",
+		rcs.serviceName, rcs.instanceID, ins.Status, status)
+	ins.Status = status
+	rcs.service.PutServiceInstanceSpec(ins)
+
+	return interval
+}
+
+// probe sends a GET request to the health path of the application.
+func (rcs *Server) probe(path string, timeout time.Duration) error {
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get("http://" + net.JoinHostPort(rcs.IP, strconv.Itoa(rcs.port)) + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("status code is %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// probeGRPC sends a gRPC health check request to the application, only the
+// SERVING status is taken as success.
+func (rcs *Server) probeGRPC(service string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(rcs.IP, strconv.Itoa(rcs.port))
+	conn, err := grpc.DialContext(ctx, addr, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		return err
+	}
+
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("status is %s", resp.Status)
+	}
+	return nil
+}
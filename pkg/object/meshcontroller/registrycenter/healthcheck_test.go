@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package registrycenter
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
+)
+
+func TestHealthCheckerRecord(t *testing.T) {
+	hc := &healthChecker{}
+
+	for i := 0; i < 2; i++ {
+		if status := hc.record(false, 3); status != "" {
+			t.Errorf("failure %d should not change status, got %s", i+1, status)
+		}
+	}
+	if status := hc.record(false, 3); status != spec.ServiceStatusOutOfService {
+		t.Errorf("want %s after 3 failures, got %s", spec.ServiceStatusOutOfService, status)
+	}
+	if status := hc.record(false, 3); status != "" {
+		t.Errorf("downgraded instance should not be downgraded again, got %s", status)
+	}
+	if status := hc.record(true, 3); status != spec.ServiceStatusUp {
+		t.Errorf("want %s after recovery, got %s", spec.ServiceStatusUp, status)
+	}
+	if status := hc.record(true, 3); status != "" {
+		t.Errorf("healthy instance should not change status, got %s", status)
+	}
+
+	hc.record(false, 3)
+	hc.record(true, 3)
+	hc.record(false, 3)
+	if status := hc.record(false, 3); status != "" {
+		t.Errorf("success should reset failures, got %s", status)
+	}
+}
+
+func TestHealthCheckInterval(t *testing.T) {
+	if interval := healthCheckInterval(nil); interval != defaultHealthCheckInterval {
+		t.Errorf("want default interval, got %s", interval)
+	}
+	if interval := healthCheckInterval(&spec.HealthCheck{Interval: "5s"}); interval != 5*time.Second {
+		t.Errorf("want 5s, got %s", interval)
+	}
+
+	for i := 0; i < 100; i++ {
+		d := jitter(10 * time.Second)
+		if d < 9*time.Second || d >= 11*time.Second {
+			t.Fatalf("jittered interval %s out of range", d)
+		}
+	}
+}
+
+func TestProbeGRPC(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("order", healthpb.HealthCheckResponse_NOT_SERVING)
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	rcs := &Server{
+		IP:   "127.0.0.1",
+		port: listener.Addr().(*net.TCPAddr).Port,
+	}
+
+	if err := rcs.probeGRPC("", time.Second); err != nil {
+		t.Errorf("overall server should be serving: %v", err)
+	}
+	if err := rcs.probeGRPC("order", time.Second); err == nil {
+		t.Errorf("NOT_SERVING service should fail the probe")
+	}
+	if err := rcs.probeGRPC("unknown", time.Second); err == nil {
+		t.Errorf("unknown service should fail the probe")
+	}
+}
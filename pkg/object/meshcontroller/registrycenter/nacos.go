@@ -19,13 +19,30 @@ package registrycenter
 
 import (
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
 	"github.com/nacos-group/nacos-sdk-go/model"
+
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
 )
 
-const defaultGroup = "DEFAULT_GROUP"
+// nacosScope returns the Nacos namespace and group of the mesh services.
+func (rcs *Server) nacosScope() spec.NacosScope {
+	return rcs.service.AdminSpec().NacosScope()
+}
+
+// CheckNacosScope checks the namespace and group of the Nacos request, it
+// returns ErrNacosScopeMismatch if they are not the ones of the mesh.
+func (rcs *Server) CheckNacosScope(r *http.Request) error {
+	namespace, group := r.FormValue("namespaceId"), r.FormValue("groupName")
+	if scope := rcs.nacosScope(); !scope.Match(namespace, group) {
+		return fmt.Errorf("%w: namespace: %s group: %s, want namespace: %s group: %s",
+			spec.ErrNacosScopeMismatch, namespace, group, scope.Namespace, scope.Group)
+	}
+	return nil
+}
 
 // ToNacosInstanceInfo transforms service registry info to nacos' instance
 func (rcs *Server) ToNacosInstanceInfo(serviceInfo *ServiceRegistryInfo) *model.Instance {
@@ -34,7 +51,7 @@ func (rcs *Server) ToNacosInstanceInfo(serviceInfo *ServiceRegistryInfo) *model.
 	ins.Ip = serviceInfo.Ins.IP
 	ins.Valid = true
 	ins.InstanceId = serviceInfo.Ins.InstanceID
-	ins.ServiceName = defaultGroup + "@@" + serviceInfo.Ins.ServiceName
+	ins.ServiceName = rcs.nacosScope().Group + "@@" + serviceInfo.Ins.ServiceName
 	ins.Port = uint64(serviceInfo.Ins.Port)
 	ins.Healthy = true
 	ins.Enable = true
@@ -51,7 +68,7 @@ func (rcs *Server) ToNacosService(serviceInfo *ServiceRegistryInfo) *model.Servi
 	svc.Hosts = append(svc.Hosts, *rcs.ToNacosInstanceInfo(serviceInfo))
 	svc.Dom = serviceInfo.Ins.ServiceName
 	svc.CacheMillis = 500
-	svc.Name = defaultGroup + "@@" + serviceInfo.Ins.ServiceName
+	svc.Name = rcs.nacosScope().Group + "@@" + serviceInfo.Ins.ServiceName
 	svc.LastRefTime = uint64(time.Now().Unix())
 	return &svc
 }
@@ -74,13 +91,21 @@ func (rcs *Server) ToNacosServiceDetail(serviceInfo *ServiceRegistryInfo) *model
 	return &svc
 }
 
-// SplitNacosServiceName gets nacos servicename in GROUP_NAME@@SERVICE_NAME format
+// SplitNacosServiceName gets nacos servicename in GROUP_NAME@@SERVICE_NAME format,
+// it returns ErrNacosScopeMismatch if the group isn't the one of the mesh.
 func (rcs *Server) SplitNacosServiceName(serviceName string) (string, error) {
+	return splitNacosServiceName(serviceName, rcs.nacosScope().Group)
+}
+
+func splitNacosServiceName(serviceName, group string) (string, error) {
 	if strings.Contains(serviceName, "@@") {
 		names := strings.Split(serviceName, "@@")
 		if len(names) != 2 {
 			return "", fmt.Errorf("invalid servicename: %s", serviceName)
 		}
+		if names[0] != group {
+			return "", fmt.Errorf("%w: group: %s want: %s", spec.ErrNacosScopeMismatch, names[0], group)
+		}
 
 		return names[1], nil
 	}
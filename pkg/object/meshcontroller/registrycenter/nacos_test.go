@@ -0,0 +1,47 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package registrycenter
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
+)
+
+func TestSplitNacosServiceName(t *testing.T) {
+	name, err := splitNacosServiceName("order", "prod-group")
+	if err != nil || name != "order" {
+		t.Errorf("want order, got %s, err: %v", name, err)
+	}
+
+	name, err = splitNacosServiceName("prod-group@@order", "prod-group")
+	if err != nil || name != "order" {
+		t.Errorf("want order, got %s, err: %v", name, err)
+	}
+
+	_, err = splitNacosServiceName("DEFAULT_GROUP@@order", "prod-group")
+	if !errors.Is(err, spec.ErrNacosScopeMismatch) {
+		t.Errorf("want ErrNacosScopeMismatch, got %v", err)
+	}
+
+	_, err = splitNacosServiceName("a@@b@@order", "prod-group")
+	if err == nil || errors.Is(err, spec.ErrNacosScopeMismatch) {
+		t.Errorf("want invalid service name error, got %v", err)
+	}
+}
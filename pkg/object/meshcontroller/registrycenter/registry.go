@@ -58,8 +58,15 @@ type (
 		tenant        string
 		serviceLabels map[string]string
 
-		done  chan struct{}
-		mutex sync.RWMutex
+		done            chan struct{}
+		mutex           sync.RWMutex
+		healthCheckOnce sync.Once
+
+		discoveryCache     *discoveryCache
+		discoveryCacheOnce sync.Once
+
+		instanceEvents     *instanceEventLog
+		instanceEventsOnce sync.Once
 
 		service *service.Service
 	}
@@ -83,6 +90,9 @@ func NewRegistryCenterServer(registryType string, registryName, serviceName stri
 		instanceID:    instanceID,
 		serviceLabels: serviceLabels,
 
+		discoveryCache: newDiscoveryCache(serviceName),
+		instanceEvents: newInstanceEventLog(),
+
 		done: make(chan struct{}),
 	}
 }
@@ -99,11 +109,15 @@ func (rcs *Server) Close() {
 	close(rcs.done)
 }
 
-// Register registers itself into mesh
-func (rcs *Server) Register(serviceSpec *spec.Service, ingressReady ReadyFunc, egressReady ReadyFunc) {
+// Register registers itself into mesh, it returns ErrInstanceIDConflict if
+// the instance ID has been registered with another address and the policy
+// is reject.
+func (rcs *Server) Register(serviceSpec *spec.Service, ingressReady ReadyFunc, egressReady ReadyFunc) error {
 	rcs.tenant = serviceSpec.RegisterTenant
+	rcs.healthCheckOnce.Do(func() { go rcs.healthCheck() })
+	rcs.discoveryCacheOnce.Do(func() { go rcs.runDiscoveryCache() })
 	if rcs.Registered() {
-		return
+		return nil
 	}
 
 	ins := &spec.ServiceInstanceSpec{
@@ -115,7 +129,31 @@ func (rcs *Server) Register(serviceSpec *spec.Service, ingressReady ReadyFunc, e
 		Labels:       rcs.serviceLabels,
 	}
 
+	originIns := rcs.service.GetServiceInstanceSpec(rcs.serviceName, rcs.instanceID)
+	policy := rcs.service.AdminSpec().InstanceIDConflictPolicy
+	if err := checkInstanceConflict(originIns, ins, policy); err != nil {
+		return err
+	}
+
 	go rcs.register(ins, ingressReady, egressReady)
+	return nil
+}
+
+// checkInstanceConflict checks whether the instance ID is registered with
+// another address, it only returns error when the policy is reject.
+func checkInstanceConflict(originIns, ins *spec.ServiceInstanceSpec, policy string) error {
+	if originIns == nil || (originIns.IP == ins.IP && originIns.Port == ins.Port) {
+		return nil
+	}
+
+	if policy == spec.InstanceIDConflictPolicyReject {
+		return fmt.Errorf("%w: %s registered at %s:%d, current %s:%d",
+			spec.ErrInstanceIDConflict, ins.Key(), originIns.IP, originIns.Port, ins.IP, ins.Port)
+	}
+
+	logger.Warnf("%s registered at %s:%d, replace it with %s:%d",
+		ins.Key(), originIns.IP, originIns.Port, ins.IP, ins.Port)
+	return nil
 }
 
 func needUpdateRecord(originIns, ins *spec.ServiceInstanceSpec) bool {
@@ -127,6 +165,11 @@ func needUpdateRecord(originIns, ins *spec.ServiceInstanceSpec) bool {
 		return true
 	}
 
+	// NOTE: The instance restarted after draining should be up again.
+	if originIns.Status == spec.ServiceStatusDraining {
+		return true
+	}
+
 	return false
 }
 
@@ -164,6 +207,12 @@ func (rcs *Server) register(ins *spec.ServiceInstanceSpec, ingressReady ReadyFun
 						rcs.registered = true
 						return
 					}
+					// NOTE: The conflicting instance could be registered after the check in Register.
+					policy := rcs.service.AdminSpec().InstanceIDConflictPolicy
+					if err := checkInstanceConflict(originIns, ins, policy); err != nil {
+						logger.Errorf("register failed: %v", err)
+						return
+					}
 				}
 
 				ins.Status = spec.ServiceStatusUp
@@ -180,6 +229,30 @@ func (rcs *Server) register(ins *spec.ServiceInstanceSpec, ingressReady ReadyFun
 	}
 }
 
+// Drain marks the registered instance DRAINING when it announces shutdown,
+// so that the new requests are not routed to it.
+func (rcs *Server) Drain() {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Errorf("registry center recover from: %v, stack trace:\n%s\n",
+				err, debug.Stack())
+		}
+	}()
+
+	if !rcs.Registered() {
+		return
+	}
+
+	ins := rcs.service.GetServiceInstanceSpec(rcs.serviceName, rcs.instanceID)
+	if ins == nil || ins.Status == spec.ServiceStatusDraining {
+		return
+	}
+
+	logger.Infof("drain service: %s instanceID: %s, status was %s", rcs.serviceName, rcs.instanceID, ins.Status)
+	ins.Status = spec.ServiceStatusDraining
+	rcs.service.PutServiceInstanceSpec(ins)
+}
+
 func (rcs *Server) decodeByConsulFormat(body []byte) error {
 	var (
 		err error
@@ -248,6 +321,10 @@ func (rcs *Server) CheckRegistryURL(w http.ResponseWriter, r *http.Request) erro
 			ip, port, serviceName)
 	}
 
+	if err = rcs.CheckNacosScope(r); err != nil {
+		return err
+	}
+
 	serviceName, err = rcs.SplitNacosServiceName(serviceName)
 
 	if serviceName != rcs.serviceName || err != nil {
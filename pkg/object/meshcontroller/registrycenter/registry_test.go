@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package registrycenter
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func TestCheckInstanceConflict(t *testing.T) {
+	ins := &spec.ServiceInstanceSpec{
+		ServiceName: "order",
+		InstanceID:  "order-01",
+		IP:          "10.0.0.2",
+		Port:        13001,
+	}
+
+	if err := checkInstanceConflict(nil, ins, spec.InstanceIDConflictPolicyReject); err != nil {
+		t.Errorf("new instance should not conflict: %v", err)
+	}
+
+	same := *ins
+	if err := checkInstanceConflict(&same, ins, spec.InstanceIDConflictPolicyReject); err != nil {
+		t.Errorf("instance with the same address should not conflict: %v", err)
+	}
+
+	stale := *ins
+	stale.IP = "10.0.0.1"
+	if err := checkInstanceConflict(&stale, ins, ""); err != nil {
+		t.Errorf("conflicting instance should be replaced by default: %v", err)
+	}
+	if err := checkInstanceConflict(&stale, ins, spec.InstanceIDConflictPolicyReplace); err != nil {
+		t.Errorf("conflicting instance should be replaced: %v", err)
+	}
+	err := checkInstanceConflict(&stale, ins, spec.InstanceIDConflictPolicyReject)
+	if !errors.Is(err, spec.ErrInstanceIDConflict) {
+		t.Errorf("want ErrInstanceIDConflict, got %v", err)
+	}
+	if errors.Is(err, spec.ErrAlreadyRegistered) {
+		t.Errorf("conflict should be distinct from ErrAlreadyRegistered")
+	}
+}
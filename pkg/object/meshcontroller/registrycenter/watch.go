@@ -0,0 +1,314 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package registrycenter
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
+)
+
+const (
+	// InstanceEventRegister is the event of an instance registering or
+	// re-registering with another address.
+	InstanceEventRegister = "register"
+	// InstanceEventHeartbeatTimeout is the event of an instance marked out
+	// of service for missing heartbeats.
+	InstanceEventHeartbeatTimeout = "heartbeatTimeout"
+	// InstanceEventDeregister is the event of an instance being removed.
+	InstanceEventDeregister = "deregister"
+	// InstanceEventStatusChange is the event of any other status change of
+	// an instance, such as draining or coming back up.
+	InstanceEventStatusChange = "statusChange"
+	// InstanceEventReset tells the watcher to drop what it has, the events
+	// following it are the full snapshot of the instances.
+	InstanceEventReset = "reset"
+
+	// maxInstanceEvents is the number of the latest events kept for the
+	// watchers to resume from.
+	maxInstanceEvents = 1024
+)
+
+type (
+	// InstanceEvent is a lifecycle event of a service instance.
+	InstanceEvent struct {
+		Type     string                    `json:"type"`
+		Instance *spec.ServiceInstanceSpec `json:"instance,omitempty"`
+		// Version is the discovery version when the event is delivered, the
+		// same as the one of ServiceRegistryInfo.
+		Version int64 `json:"version"`
+		// Revision is the position of the event in the stream, a watcher
+		// resumes by passing the revision of the last event it has seen.
+		Revision int64 `json:"revision"`
+	}
+
+	// instanceEventLog keeps the latest instances and the events between
+	// them, so that a snapshot and the position of the stream after it are
+	// always taken together.
+	instanceEventLog struct {
+		mutex     sync.Mutex
+		ready     bool
+		instances map[string]*spec.ServiceInstanceSpec
+		events    []*InstanceEvent
+		// base is the revision right before the oldest kept event.
+		base     int64
+		revision int64
+		// notify is closed and replaced when new events are appended.
+		notify chan struct{}
+	}
+)
+
+// newInstanceEventLog creates an instance event log. The revisions start
+// from the current time in nanoseconds, so the revisions of a restarted
+// sidecar are newer than the ones of the previous run, and the watchers
+// resuming from them get a reset instead of wrong events.
+func newInstanceEventLog() *instanceEventLog {
+	revision := time.Now().UnixNano()
+	return &instanceEventLog{
+		instances: map[string]*spec.ServiceInstanceSpec{},
+		base:      revision,
+		revision:  revision,
+		notify:    make(chan struct{}),
+	}
+}
+
+func instanceEventType(prev, curr *spec.ServiceInstanceSpec) string {
+	switch {
+	case prev == nil:
+		return InstanceEventRegister
+	case curr == nil:
+		return InstanceEventDeregister
+	case prev.IP != curr.IP || prev.Port != curr.Port || prev.RegistryTime != curr.RegistryTime:
+		return InstanceEventRegister
+	case prev.Status == curr.Status:
+		return ""
+	case curr.Status == spec.ServiceStatusOutOfService:
+		return InstanceEventHeartbeatTimeout
+	default:
+		return InstanceEventStatusChange
+	}
+}
+
+// update replaces the instances with the latest ones and appends the
+// events between them. The first update only makes the log ready.
+func (l *instanceEventLog) update(instances map[string]*spec.ServiceInstanceSpec) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	prev := l.instances
+	l.instances = instances
+	if !l.ready {
+		l.ready = true
+		l.wakeup()
+		return
+	}
+
+	keys := make([]string, 0, len(prev)+len(instances))
+	for k := range instances {
+		keys = append(keys, k)
+	}
+	for k := range prev {
+		if _, exists := instances[k]; !exists {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	appended := false
+	for _, k := range keys {
+		eventType := instanceEventType(prev[k], instances[k])
+		if eventType == "" {
+			continue
+		}
+
+		ins := instances[k]
+		if ins == nil {
+			ins = prev[k]
+		}
+		l.revision++
+		l.events = append(l.events, &InstanceEvent{
+			Type:     eventType,
+			Instance: ins,
+			Revision: l.revision,
+		})
+		appended = true
+	}
+
+	if n := len(l.events) - maxInstanceEvents; n > 0 {
+		l.base = l.events[n-1].Revision
+		l.events = append([]*InstanceEvent(nil), l.events[n:]...)
+	}
+
+	if appended {
+		l.wakeup()
+	}
+}
+
+func (l *instanceEventLog) wakeup() {
+	close(l.notify)
+	l.notify = make(chan struct{})
+}
+
+// since returns the events after the revision, the revision to wait from
+// next time, and the channel closed on new events. Revision 0 means the
+// watcher has nothing yet, it gets the snapshot as register events. If the
+// revision is unknown or too old, the watcher gets a reset event followed
+// by the snapshot.
+func (l *instanceEventLog) since(revision int64) ([]*InstanceEvent, int64, <-chan struct{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if !l.ready || revision == l.revision {
+		return nil, revision, l.notify
+	}
+
+	if revision != 0 && revision >= l.base && revision < l.revision {
+		i := sort.Search(len(l.events), func(i int) bool {
+			return l.events[i].Revision > revision
+		})
+		return l.events[i:], l.revision, l.notify
+	}
+
+	events := make([]*InstanceEvent, 0, len(l.instances)+1)
+	if revision != 0 {
+		events = append(events, &InstanceEvent{Type: InstanceEventReset, Revision: l.revision})
+	}
+
+	keys := make([]string, 0, len(l.instances))
+	for k := range l.instances {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		events = append(events, &InstanceEvent{
+			Type:     InstanceEventRegister,
+			Instance: l.instances[k],
+			Revision: l.revision,
+		})
+	}
+
+	return events, l.revision, l.notify
+}
+
+// visibleServices returns the services visible to the local service,
+// including the granted ones, and the version of them.
+func (rcs *Server) visibleServices() (map[string]bool, int64, error) {
+	globalTenant, tenant, version, err := rcs.visibleTenants()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	visibleServices := make(map[string]bool)
+	for _, t := range []*spec.Tenant{globalTenant, tenant} {
+		if t == nil {
+			continue
+		}
+		for _, v := range t.Services {
+			visibleServices[v] = true
+		}
+	}
+	granted, _ := rcs.discoveryCache.grantedServices()
+	for name := range granted {
+		visibleServices[name] = true
+	}
+
+	return visibleServices, version, nil
+}
+
+func (rcs *Server) runInstanceEventLog() {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-rcs.done
+		cancel()
+	}()
+
+	keepWatching(ctx, "service instance specs", func(ctx context.Context) error {
+		return rcs.service.WatchServiceInstanceSpecs(ctx, rcs.instanceEvents.update)
+	})
+}
+
+// keepWatching runs the watch until the context is done, it's retried
+// every second after failures.
+func keepWatching(ctx context.Context, name string, watch func(ctx context.Context) error) {
+	for {
+		err := watch(ctx)
+		if err == nil {
+			return
+		}
+
+		logger.Errorf("watch %s failed: %v", name, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// WatchInstances streams the lifecycle events of the instances visible to
+// the local service until the context is done or the server is closed.
+// The watcher starts with revision 0 to get the snapshot of the instances
+// as register events, and the changes after it without any gap. It resumes
+// from the revision of the last event it has seen after reconnecting, a
+// reset event is sent first if the revision is no longer kept.
+func (rcs *Server) WatchInstances(ctx context.Context, revision int64, onEvents func([]*InstanceEvent)) error {
+	if !rcs.Registered() {
+		return spec.ErrNoRegisteredYet
+	}
+
+	rcs.instanceEventsOnce.Do(func() {
+		go rcs.runInstanceEventLog()
+	})
+
+	for {
+		events, next, notify := rcs.instanceEvents.since(revision)
+		revision = next
+
+		if len(events) != 0 {
+			visibleServices, version, err := rcs.visibleServices()
+			if err != nil {
+				return err
+			}
+
+			filtered := make([]*InstanceEvent, 0, len(events))
+			for _, event := range events {
+				if event.Instance != nil && !visibleServices[event.Instance.ServiceName] {
+					continue
+				}
+				e := *event
+				e.Version = version
+				filtered = append(filtered, &e)
+			}
+			if len(filtered) != 0 {
+				onEvents(filtered)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-rcs.done:
+			return nil
+		case <-notify:
+		}
+	}
+}
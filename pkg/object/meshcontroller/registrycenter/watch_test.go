@@ -0,0 +1,156 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package registrycenter
+
+import (
+	"testing"
+
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
+)
+
+func instanceEventTypes(events []*InstanceEvent) []string {
+	types := make([]string, 0, len(events))
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+func checkInstanceEventTypes(t *testing.T, events []*InstanceEvent, want ...string) {
+	t.Helper()
+	got := instanceEventTypes(events)
+	if len(got) != len(want) {
+		t.Fatalf("want events %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("want events %v, got %v", want, got)
+		}
+	}
+}
+
+func TestInstanceEventType(t *testing.T) {
+	up := &spec.ServiceInstanceSpec{IP: "10.0.0.1", Port: 80, Status: spec.ServiceStatusUp}
+	moved := *up
+	moved.IP = "10.0.0.2"
+	out := *up
+	out.Status = spec.ServiceStatusOutOfService
+	draining := *up
+	draining.Status = spec.ServiceStatusDraining
+	labeled := *up
+	labeled.Labels = map[string]string{"version": "v2"}
+
+	cases := []struct {
+		prev, curr *spec.ServiceInstanceSpec
+		want       string
+	}{
+		{nil, up, InstanceEventRegister},
+		{up, nil, InstanceEventDeregister},
+		{up, &moved, InstanceEventRegister},
+		{up, &out, InstanceEventHeartbeatTimeout},
+		{&out, up, InstanceEventStatusChange},
+		{up, &draining, InstanceEventStatusChange},
+		{up, &labeled, ""},
+	}
+	for i, c := range cases {
+		if got := instanceEventType(c.prev, c.curr); got != c.want {
+			t.Errorf("case %d: want %q, got %q", i, c.want, got)
+		}
+	}
+}
+
+func TestInstanceEventLog(t *testing.T) {
+	l := newInstanceEventLog()
+
+	events, rev, notify := l.since(0)
+	if len(events) != 0 || rev != 0 {
+		t.Fatalf("log should not report anything before ready")
+	}
+
+	a := &spec.ServiceInstanceSpec{ServiceName: "a", InstanceID: "a-1", Status: spec.ServiceStatusUp}
+	b := &spec.ServiceInstanceSpec{ServiceName: "b", InstanceID: "b-1", Status: spec.ServiceStatusUp}
+	l.update(map[string]*spec.ServiceInstanceSpec{"a": a})
+	select {
+	case <-notify:
+	default:
+		t.Fatalf("watchers should be notified when the log is ready")
+	}
+
+	// The snapshot and the revision are taken together.
+	events, snapshotRev, notify := l.since(0)
+	checkInstanceEventTypes(t, events, InstanceEventRegister)
+	if events[0].Revision != snapshotRev {
+		t.Errorf("snapshot events should carry the snapshot revision")
+	}
+
+	aOut := *a
+	aOut.Status = spec.ServiceStatusOutOfService
+	l.update(map[string]*spec.ServiceInstanceSpec{"a": &aOut, "b": b})
+	select {
+	case <-notify:
+	default:
+		t.Fatalf("watchers should be notified on new events")
+	}
+
+	events, rev, _ = l.since(snapshotRev)
+	checkInstanceEventTypes(t, events, InstanceEventHeartbeatTimeout, InstanceEventRegister)
+	if rev != events[1].Revision || events[0].Revision != snapshotRev+1 {
+		t.Errorf("revisions of events should increase one by one")
+	}
+
+	l.update(map[string]*spec.ServiceInstanceSpec{"b": b})
+	events, _, _ = l.since(rev)
+	checkInstanceEventTypes(t, events, InstanceEventDeregister)
+	if events[0].Instance.InstanceID != "a-1" {
+		t.Errorf("deregister event should carry the removed instance")
+	}
+
+	// Resume from the middle of the log.
+	events, _, _ = l.since(snapshotRev + 1)
+	checkInstanceEventTypes(t, events, InstanceEventRegister, InstanceEventDeregister)
+
+	// Unknown revisions, such as the ones of a previous run, get a reset.
+	events, _, _ = l.since(snapshotRev - 1)
+	checkInstanceEventTypes(t, events, InstanceEventReset, InstanceEventRegister)
+	events, _, _ = l.since(l.revision + 1)
+	checkInstanceEventTypes(t, events, InstanceEventReset, InstanceEventRegister)
+}
+
+func TestInstanceEventLogTrim(t *testing.T) {
+	l := newInstanceEventLog()
+	l.update(map[string]*spec.ServiceInstanceSpec{})
+	_, start, _ := l.since(0)
+
+	ins := &spec.ServiceInstanceSpec{ServiceName: "a", InstanceID: "a-1"}
+	for i := 0; i < maxInstanceEvents; i++ {
+		l.update(map[string]*spec.ServiceInstanceSpec{"a": ins})
+		l.update(map[string]*spec.ServiceInstanceSpec{})
+	}
+
+	if len(l.events) != maxInstanceEvents {
+		t.Fatalf("want %d events kept, got %d", maxInstanceEvents, len(l.events))
+	}
+
+	events, _, _ := l.since(start)
+	checkInstanceEventTypes(t, events, InstanceEventReset)
+
+	events, _, _ = l.since(l.base)
+	if len(events) != maxInstanceEvents {
+		t.Errorf("want %d events replayed, got %d", maxInstanceEvents, len(events))
+	}
+}
@@ -20,6 +20,9 @@ package service
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"go.etcd.io/etcd/api/v3/mvccpb"
 	"gopkg.in/yaml.v2"
@@ -30,9 +33,26 @@ import (
 	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
 	"github.com/megaease/easegress/pkg/object/meshcontroller/storage"
 	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/v"
+)
+
+const (
+	// CustomResourceEventAdd means the custom resource is added,
+	// the initial resources are also reported as added.
+	CustomResourceEventAdd = "add"
+	// CustomResourceEventUpdate means the custom resource is updated.
+	CustomResourceEventUpdate = "update"
+	// CustomResourceEventDelete means the custom resource is deleted.
+	CustomResourceEventDelete = "delete"
 )
 
 type (
+	// CustomResourceEvent is the change event of a custom resource.
+	CustomResourceEvent struct {
+		Type     string               `json:"type"`
+		Resource *spec.CustomResource `json:"resource"`
+	}
+
 	// Service is the business layer between mesh and store.
 	// It is not concurrently safe, the users need to do it by themselves.
 	Service struct {
@@ -51,9 +71,16 @@ func New(superSpec *supervisor.Spec) *Service {
 		store:     storage.New(superSpec.Name(), superSpec.Super().Cluster()),
 	}
 
+	spec.SetSecretResolver(s.GetSecret)
+
 	return s
 }
 
+// AdminSpec returns the spec of the mesh controller.
+func (s *Service) AdminSpec() *spec.Admin {
+	return s.spec
+}
+
 // Lock locks all store, it will do cluster panic if failed.
 func (s *Service) Lock() {
 	err := s.store.Lock()
@@ -70,8 +97,13 @@ func (s *Service) Unlock() {
 	}
 }
 
-// PutServiceSpec writes the service spec
+// PutServiceSpec writes the service spec, it sets the timestamps of the
+// service, the creation time of the existing one is kept.
+// The spec is migrated to the current version before writing.
 func (s *Service) PutServiceSpec(serviceSpec *spec.Service) {
+	spec.MigrateService(serviceSpec)
+	serviceSpec.SetTimestamps(s.GetServiceSpec(serviceSpec.Name), time.Now())
+
 	buff, err := yaml.Marshal(serviceSpec)
 	if err != nil {
 		panic(fmt.Errorf("BUG: marshal %#v to yaml failed: %v", serviceSpec, err))
@@ -89,6 +121,16 @@ func (s *Service) GetServiceSpec(serviceName string) *spec.Service {
 	return serviceSpec
 }
 
+// ResolveServiceSpec gets the service spec by its name or alias, the
+// soft-deleted services are not resolved by their aliases.
+func (s *Service) ResolveServiceSpec(name string) *spec.Service {
+	if serviceSpec := s.GetServiceSpec(name); serviceSpec != nil {
+		return serviceSpec
+	}
+
+	return spec.ResolveServiceAlias(s.ListServiceSpecs(), name)
+}
+
 // GetServiceSpecWithInfo gets the service spec by its name
 func (s *Service) GetServiceSpecWithInfo(serviceName string) (*spec.Service, *mvccpb.KeyValue) {
 	kv, err := s.store.GetRaw(layout.ServiceSpecKey(serviceName))
@@ -105,6 +147,7 @@ func (s *Service) GetServiceSpecWithInfo(serviceName string) (*spec.Service, *mv
 	if err != nil {
 		panic(fmt.Errorf("BUG: unmarshal %s to yaml failed: %v", string(kv.Value), err))
 	}
+	spec.MigrateService(serviceSpec)
 
 	return serviceSpec, kv
 }
@@ -171,12 +214,50 @@ func (s *Service) ListServiceSpecs() []*spec.Service {
 			logger.Errorf("BUG: unmarshal %s to yaml failed: %v", v, err)
 			continue
 		}
+		spec.MigrateService(serviceSpec)
 		services = append(services, serviceSpec)
 	}
 
 	return services
 }
 
+// MigrateServiceSpecs rewrites the stored service specs of older versions
+// in the current version, so they are not migrated on every reading.
+// The specs invalid after migration are left as they are.
+func (s *Service) MigrateServiceSpecs() {
+	kvs, err := s.store.GetRawPrefix(layout.ServiceSpecPrefix())
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+
+	for _, kv := range kvs {
+		serviceSpec := &spec.Service{}
+		err := yaml.Unmarshal(kv.Value, serviceSpec)
+		if err != nil {
+			logger.Errorf("BUG: unmarshal %s to yaml failed: %v", kv.Value, err)
+			continue
+		}
+		if !spec.MigrateService(serviceSpec) {
+			continue
+		}
+
+		vr := v.Validate(serviceSpec)
+		if !vr.Valid() {
+			logger.Errorf("service %s is invalid after migration, keep it: %s", serviceSpec.Name, vr)
+			continue
+		}
+
+		buff, err := yaml.Marshal(serviceSpec)
+		if err != nil {
+			panic(fmt.Errorf("BUG: marshal %#v to yaml failed: %v", serviceSpec, err))
+		}
+		err = s.store.Put(layout.ServiceSpecKey(serviceSpec.Name), string(buff))
+		if err != nil {
+			api.ClusterPanic(err)
+		}
+	}
+}
+
 // GetTenantSpec gets tenant spec with its name
 func (s *Service) GetTenantSpec(tenantName string) *spec.Tenant {
 	tenant, _ := s.GetTenantSpecWithInfo(tenantName)
@@ -290,6 +371,26 @@ func (s *Service) listServiceInstanceSpecs(all bool, serviceName string) []*spec
 	return specs
 }
 
+// GetServiceInstanceStatus gets the service instance status.
+func (s *Service) GetServiceInstanceStatus(serviceName, instanceID string) *spec.ServiceInstanceStatus {
+	value, err := s.store.Get(layout.ServiceInstanceStatusKey(serviceName, instanceID))
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+
+	if value == nil {
+		return nil
+	}
+
+	status := &spec.ServiceInstanceStatus{}
+	err = yaml.Unmarshal([]byte(*value), status)
+	if err != nil {
+		panic(fmt.Errorf("BUG: unmarshal %s to yaml failed: %v", *value, err))
+	}
+
+	return status
+}
+
 // GetServiceInstanceSpec gets the service instance spec
 func (s *Service) GetServiceInstanceSpec(serviceName, instanceID string) *spec.ServiceInstanceSpec {
 	value, err := s.store.Get(layout.ServiceInstanceSpecKey(serviceName, instanceID))
@@ -323,6 +424,34 @@ func (s *Service) PutServiceInstanceSpec(_spec *spec.ServiceInstanceSpec) {
 	}
 }
 
+// PutServiceInstanceSpecs writes the service instance specs and statuses in one transaction.
+func (s *Service) PutServiceInstanceSpecs(specs []*spec.ServiceInstanceSpec, statuses []*spec.ServiceInstanceStatus) {
+	kvs := make(map[string]*string, len(specs)+len(statuses))
+	for _, _spec := range specs {
+		buff, err := yaml.Marshal(_spec)
+		if err != nil {
+			panic(fmt.Errorf("BUG: marshal %#v to yaml failed: %v", _spec, err))
+		}
+
+		value := string(buff)
+		kvs[layout.ServiceInstanceSpecKey(_spec.ServiceName, _spec.InstanceID)] = &value
+	}
+	for _, status := range statuses {
+		buff, err := yaml.Marshal(status)
+		if err != nil {
+			panic(fmt.Errorf("BUG: marshal %#v to yaml failed: %v", status, err))
+		}
+
+		value := string(buff)
+		kvs[layout.ServiceInstanceStatusKey(status.ServiceName, status.InstanceID)] = &value
+	}
+
+	err := s.store.PutAndDelete(kvs)
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+}
+
 // DeleteServiceInstanceSpec deletes the service instance spec.
 func (s *Service) DeleteServiceInstanceSpec(serviceName, instanceID string) {
 	err := s.store.Delete(layout.ServiceInstanceSpecKey(serviceName, instanceID))
@@ -331,6 +460,75 @@ func (s *Service) DeleteServiceInstanceSpec(serviceName, instanceID string) {
 	}
 }
 
+// WatchServiceInstanceSpecs watches the instance specs of all services, it
+// reports all instance specs keyed by their storage keys on every change.
+func (s *Service) WatchServiceInstanceSpecs(ctx context.Context, onChange func(map[string]*spec.ServiceInstanceSpec)) error {
+	syncer, err := s.store.Syncer()
+	if err != nil {
+		return err
+	}
+
+	ch, err := syncer.SyncRawPrefix(layout.AllServiceInstanceSpecPrefix())
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			syncer.Close()
+			return nil
+		case m := <-ch:
+			specs := make(map[string]*spec.ServiceInstanceSpec, len(m))
+			for k, v := range m {
+				_spec := &spec.ServiceInstanceSpec{}
+				if err := yaml.Unmarshal(v.Value, _spec); err != nil {
+					logger.Errorf("BUG: unmarshal %s to yaml failed: %v", v.Value, err)
+					continue
+				}
+				specs[k] = _spec
+			}
+			onChange(specs)
+		}
+	}
+}
+
+// WatchTenantSpecs watches the raw tenant specs until the context is done,
+// onChange is called with all of them keyed by their etcd keys on every
+// change.
+func (s *Service) WatchTenantSpecs(ctx context.Context, onChange func(map[string]*mvccpb.KeyValue)) error {
+	return s.watchRawPrefix(ctx, layout.TenantPrefix(), onChange)
+}
+
+// WatchServiceSpecs watches the raw service specs until the context is
+// done, onChange is called with all of them keyed by their etcd keys on
+// every change.
+func (s *Service) WatchServiceSpecs(ctx context.Context, onChange func(map[string]*mvccpb.KeyValue)) error {
+	return s.watchRawPrefix(ctx, layout.ServiceSpecPrefix(), onChange)
+}
+
+func (s *Service) watchRawPrefix(ctx context.Context, prefix string, onChange func(map[string]*mvccpb.KeyValue)) error {
+	syncer, err := s.store.Syncer()
+	if err != nil {
+		return err
+	}
+
+	ch, err := syncer.SyncRawPrefix(prefix)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			syncer.Close()
+			return nil
+		case m := <-ch:
+			onChange(m)
+		}
+	}
+}
+
 // ListTenantSpecs lists tenant specs
 func (s *Service) ListTenantSpecs() []*spec.Tenant {
 	tenants := []*spec.Tenant{}
@@ -428,6 +626,150 @@ func (s *Service) DeleteIngressSpec(ingressName string) {
 	}
 }
 
+// GetRootCert gets the root certificate of the mesh CA. The private key
+// is kept by the master, it is only present in the records written before
+// that, which the master moves out at its next check.
+func (s *Service) GetRootCert() *spec.Certificate {
+	return s.getCert(layout.RootCertKey())
+}
+
+// PutRootCert writes the root certificate of the mesh CA without its
+// private key.
+func (s *Service) PutRootCert(cert *spec.Certificate) {
+	s.putCert(layout.RootCertKey(), cert.PublicCertificate())
+}
+
+// GetServiceCert gets the certificate of the service.
+func (s *Service) GetServiceCert(serviceName string) *spec.Certificate {
+	return s.getCert(layout.ServiceCertKey(serviceName))
+}
+
+// PutServiceCert writes the certificate of the service.
+func (s *Service) PutServiceCert(cert *spec.Certificate) {
+	s.putCert(layout.ServiceCertKey(cert.ServiceName), cert)
+}
+
+// DeleteServiceCert deletes the certificate of the service.
+func (s *Service) DeleteServiceCert(serviceName string) {
+	err := s.store.Delete(layout.ServiceCertKey(serviceName))
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+}
+
+// ListServiceCerts lists the certificates of services.
+func (s *Service) ListServiceCerts() []*spec.Certificate {
+	certs := []*spec.Certificate{}
+	kvs, err := s.store.GetRawPrefix(layout.ServiceCertPrefix())
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+
+	for _, v := range kvs {
+		cert := &spec.Certificate{}
+		err := yaml.Unmarshal(v.Value, cert)
+		if err != nil {
+			logger.Errorf("BUG: unmarshal %s to yaml failed: %v", v, err)
+			continue
+		}
+		certs = append(certs, cert)
+	}
+
+	return certs
+}
+
+// GetMTLSCerts gets the certificates the sidecar of the service uses for
+// mTLS, nil means they are not issued yet.
+func (s *Service) GetMTLSCerts(serviceName string) *spec.MTLSCerts {
+	root := s.GetRootCert()
+	if root == nil {
+		return nil
+	}
+	cert := s.GetServiceCert(serviceName)
+	if cert == nil {
+		return nil
+	}
+
+	return &spec.MTLSCerts{Root: root.PublicCertificate(), Service: cert}
+}
+
+// GetSecret gets the value of the secret.
+func (s *Service) GetSecret(name string) (string, bool) {
+	value, err := s.store.Get(layout.SecretKey(name))
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+
+	if value == nil {
+		return "", false
+	}
+	return *value, true
+}
+
+// PutSecret writes the value of the secret.
+func (s *Service) PutSecret(name, value string) {
+	err := s.store.Put(layout.SecretKey(name), value)
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+}
+
+// DeleteSecret deletes the secret.
+func (s *Service) DeleteSecret(name string) {
+	err := s.store.Delete(layout.SecretKey(name))
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+}
+
+// ListSecretNames lists the names of secrets, the values never leave
+// the cluster.
+func (s *Service) ListSecretNames() []string {
+	kvs, err := s.store.GetRawPrefix(layout.SecretPrefix())
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+
+	names := make([]string, 0, len(kvs))
+	for k := range kvs {
+		names = append(names, strings.TrimPrefix(k, layout.SecretPrefix()))
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func (s *Service) getCert(key string) *spec.Certificate {
+	value, err := s.store.Get(key)
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+
+	if value == nil {
+		return nil
+	}
+
+	cert := &spec.Certificate{}
+	err = yaml.Unmarshal([]byte(*value), cert)
+	if err != nil {
+		panic(fmt.Errorf("BUG: unmarshal %s to yaml failed: %v", *value, err))
+	}
+
+	return cert
+}
+
+func (s *Service) putCert(key string, cert *spec.Certificate) {
+	buff, err := yaml.Marshal(cert)
+	if err != nil {
+		panic(fmt.Errorf("BUG: marshal %#v to yaml failed: %v", cert, err))
+	}
+
+	err = s.store.Put(key, string(buff))
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+}
+
 // ListCustomResourceKinds lists custom resource kinds
 func (s *Service) ListCustomResourceKinds() []*spec.CustomResourceKind {
 	kvs, err := s.store.GetRawPrefix(layout.CustomResourceKindPrefix())
@@ -513,9 +855,33 @@ func (s *Service) ListCustomResources(kind string) []*spec.CustomResource {
 		resources = append(resources, resource)
 	}
 
+	s.fillCustomResourceDefaults(resources)
+
 	return resources
 }
 
+// fillCustomResourceDefaults fills the default values of resources
+// whose kinds apply defaults.
+func (s *Service) fillCustomResourceDefaults(resources []*spec.CustomResource) {
+	kinds := map[string]*spec.CustomResourceKind{}
+	for _, resource := range resources {
+		name := resource.Kind()
+		kind, exists := kinds[name]
+		if !exists {
+			kind = s.GetCustomResourceKind(name)
+			kinds[name] = kind
+		}
+		if kind == nil {
+			continue
+		}
+
+		err := kind.FillDefaults(*resource)
+		if err != nil {
+			logger.Errorf("fill defaults of custom resource %s failed: %v", resource.Name(), err)
+		}
+	}
+}
+
 // DeleteCustomResource deletes a custom resource
 func (s *Service) DeleteCustomResource(kind, name string) {
 	err := s.store.Delete(layout.CustomResourceKey(kind, name))
@@ -541,6 +907,8 @@ func (s *Service) GetCustomResource(kind, name string) *spec.CustomResource {
 		panic(fmt.Errorf("BUG: unmarshal %s to yaml failed: %v", string(kvs.Value), err))
 	}
 
+	s.fillCustomResourceDefaults([]*spec.CustomResource{resource})
+
 	return resource
 }
 
@@ -584,7 +952,87 @@ func (s *Service) WatchCustomResource(ctx context.Context, kind string, onChange
 					resources = append(resources, resource)
 				}
 			}
+			s.fillCustomResourceDefaults(resources)
 			onChange(resources)
 		}
 	}
 }
+
+// WatchCustomResourceEvents watches custom resources of the specified kind,
+// it reports the initial resources as add events first, then the changes.
+// NOTE: The syncer always delivers the full resources with the latest
+// revisions, so no change is missed, but changes of the same resource
+// in a short time may be merged into one event.
+func (s *Service) WatchCustomResourceEvents(ctx context.Context, kind string, onEvents func([]*CustomResourceEvent)) error {
+	syncer, err := s.store.Syncer()
+	if err != nil {
+		return err
+	}
+
+	prefix := layout.CustomResourcePrefix(kind)
+	ch, err := syncer.SyncRawPrefix(prefix)
+	if err != nil {
+		return err
+	}
+
+	last := map[string]*mvccpb.KeyValue{}
+	for {
+		select {
+		case <-ctx.Done():
+			syncer.Close()
+			return nil
+		case m := <-ch:
+			events := diffCustomResources(last, m)
+			last = m
+			if len(events) != 0 {
+				resources := make([]*spec.CustomResource, 0, len(events))
+				for _, event := range events {
+					resources = append(resources, event.Resource)
+				}
+				s.fillCustomResourceDefaults(resources)
+				onEvents(events)
+			}
+		}
+	}
+}
+
+func diffCustomResources(prev, curr map[string]*mvccpb.KeyValue) []*CustomResourceEvent {
+	keys := make([]string, 0, len(prev)+len(curr))
+	for k := range curr {
+		keys = append(keys, k)
+	}
+	for k := range prev {
+		if _, exists := curr[k]; !exists {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	events := []*CustomResourceEvent{}
+	for _, k := range keys {
+		prevKV, currKV := prev[k], curr[k]
+
+		var eventType string
+		kv := currKV
+		switch {
+		case prevKV == nil:
+			eventType = CustomResourceEventAdd
+		case currKV == nil:
+			eventType, kv = CustomResourceEventDelete, prevKV
+		case prevKV.ModRevision != currKV.ModRevision:
+			eventType = CustomResourceEventUpdate
+		default:
+			continue
+		}
+
+		resource := &spec.CustomResource{}
+		err := yaml.Unmarshal(kv.Value, resource)
+		if err != nil {
+			logger.Errorf("BUG: unmarshal %s to yaml failed: %v", kv.Value, err)
+			continue
+		}
+		events = append(events, &CustomResourceEvent{Type: eventType, Resource: resource})
+	}
+
+	return events
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"fmt"
+)
+
+// CheckServiceAliases checks the name and the aliases of the service don't
+// collide with the names and the aliases of the other services, including
+// the soft-deleted ones which could be restored.
+func CheckServiceAliases(service *Service, services []*Service) error {
+	for _, other := range services {
+		if other.Name == service.Name {
+			continue
+		}
+
+		for _, alias := range other.Aliases {
+			if alias == service.Name {
+				return fmt.Errorf("name %s is an alias of service %s", service.Name, other.Name)
+			}
+		}
+
+		for _, alias := range service.Aliases {
+			if alias == other.Name {
+				return fmt.Errorf("alias %s is the name of service %s", alias, other.Name)
+			}
+			for _, otherAlias := range other.Aliases {
+				if alias == otherAlias {
+					return fmt.Errorf("alias %s is claimed by service %s too", alias, other.Name)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// ResolveServiceAlias returns the service claiming the alias, the
+// soft-deleted services are skipped. It returns nil if not found.
+func ResolveServiceAlias(services []*Service, alias string) *Service {
+	for _, s := range services {
+		if s.SoftDeleted() {
+			continue
+		}
+		for _, a := range s.Aliases {
+			if a == alias {
+				return s
+			}
+		}
+	}
+
+	return nil
+}
+
+// Names returns the canonical name and the aliases of the service.
+func (s *Service) Names() []string {
+	return append([]string{s.Name}, s.Aliases...)
+}
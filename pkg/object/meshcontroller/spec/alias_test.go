@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"testing"
+)
+
+func TestCheckServiceAliases(t *testing.T) {
+	services := []*Service{
+		{Name: "order", Aliases: []string{"order-legacy"}},
+		{Name: "payment", Aliases: []string{"pay"}, DeletedAt: "2021-01-01T00:00:00Z"},
+		{Name: "stock"},
+	}
+
+	cases := []struct {
+		service *Service
+		valid   bool
+	}{
+		{&Service{Name: "order", Aliases: []string{"order-legacy", "order-v1"}}, true},
+		{&Service{Name: "stock", Aliases: []string{"inventory"}}, true},
+		{&Service{Name: "delivery"}, true},
+		{&Service{Name: "order-legacy"}, false},
+		{&Service{Name: "stock", Aliases: []string{"order-legacy"}}, false},
+		{&Service{Name: "stock", Aliases: []string{"order"}}, false},
+		{&Service{Name: "stock", Aliases: []string{"pay"}}, false},
+	}
+	for i, c := range cases {
+		err := CheckServiceAliases(c.service, services)
+		if c.valid && err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("case %d: want error for %+v", i, c.service)
+		}
+	}
+
+	if s := ResolveServiceAlias(services, "order-legacy"); s == nil || s.Name != "order" {
+		t.Errorf("want order-legacy resolved to order, got %v", s)
+	}
+	if s := ResolveServiceAlias(services, "pay"); s != nil {
+		t.Errorf("want the alias of the soft-deleted service not resolved, got %v", s.Name)
+	}
+	if s := ResolveServiceAlias(services, "order"); s != nil {
+		t.Errorf("want the canonical name not resolved as an alias, got %v", s.Name)
+	}
+
+	if err := (Service{Name: "order", Aliases: []string{"order"}}).Validate(); err == nil {
+		t.Errorf("want error for the alias same as the name")
+	}
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"sort"
+)
+
+// instanceLabelIndex indexes the canary instances by the values of their
+// labels, so the candidate pools are built without scanning all instances
+// for every canary rule. A key is indexed on its first lookup, the values
+// are taken by ServiceInstanceSpec.Label, so the dotted metadata paths are
+// indexed as well.
+type instanceLabelIndex struct {
+	instances []*ServiceInstanceSpec
+	// keys maps the label key to the label values to the positions of the
+	// instances in ascending order.
+	keys map[string]map[string][]int
+}
+
+func newInstanceLabelIndex(instances []*ServiceInstanceSpec) *instanceLabelIndex {
+	return &instanceLabelIndex{
+		instances: instances,
+		keys:      make(map[string]map[string][]int),
+	}
+}
+
+func (idx *instanceLabelIndex) values(key string) map[string][]int {
+	values, exists := idx.keys[key]
+	if exists {
+		return values
+	}
+
+	values = make(map[string][]int)
+	for i, ins := range idx.instances {
+		if label, exists := ins.Label(key); exists {
+			values[label] = append(values[label], i)
+		}
+	}
+	idx.keys[key] = values
+
+	return values
+}
+
+// match returns the instances matching the rule in their original order,
+// it's the same as filtering the instances by CanaryRule.matchInstance.
+func (idx *instanceLabelIndex) match(r *CanaryRule) []*ServiceInstanceSpec {
+	var positions []int
+	if len(r.ServiceInstanceLabels) == 1 {
+		for key, label := range r.ServiceInstanceLabels {
+			positions = idx.values(key)[label]
+		}
+	} else {
+		seen := make(map[int]bool)
+		for key, label := range r.ServiceInstanceLabels {
+			for _, i := range idx.values(key)[label] {
+				if !seen[i] {
+					seen[i] = true
+					positions = append(positions, i)
+				}
+			}
+		}
+		sort.Ints(positions)
+	}
+
+	instances := make([]*ServiceInstanceSpec, 0, len(positions))
+	for _, i := range positions {
+		instances = append(instances, idx.instances[i])
+	}
+
+	return instances
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/util/urlrule"
+)
+
+// newCanaryBenchmarkSpecs returns the instances labeled with versions and
+// zones, and the rules matching them by one or two labels.
+func newCanaryBenchmarkSpecs(instanceCount, ruleCount int) ([]*ServiceInstanceSpec, *Canary) {
+	instances := make([]*ServiceInstanceSpec, 0, instanceCount)
+	for i := 0; i < instanceCount; i++ {
+		ins := &ServiceInstanceSpec{
+			IP:     fmt.Sprintf("192.168.%d.%d", i/250, i%250),
+			Port:   80,
+			Status: ServiceStatusUp,
+		}
+		if i%5 != 0 {
+			ins.Labels = map[string]string{
+				"version": fmt.Sprintf("v%d", i%ruleCount),
+				"zone":    fmt.Sprintf("zone-%d", i%7),
+			}
+			ins.Metadata = map[string]interface{}{
+				"build": map[string]interface{}{"tier": fmt.Sprintf("tier-%d", i%3)},
+			}
+		}
+		instances = append(instances, ins)
+	}
+
+	canary := &Canary{}
+	for i := 0; i < ruleCount; i++ {
+		labels := map[string]string{"version": fmt.Sprintf("v%d", i)}
+		switch i % 3 {
+		case 1:
+			labels["zone"] = fmt.Sprintf("zone-%d", i%7)
+		case 2:
+			labels["build.tier"] = fmt.Sprintf("tier-%d", i%3)
+		}
+		canary.CanaryRules = append(canary.CanaryRules, &CanaryRule{
+			Headers: map[string]*urlrule.StringMatch{
+				"X-canary": {Exact: fmt.Sprintf("lv%d", i)},
+			},
+			ServiceInstanceLabels: labels,
+		})
+	}
+
+	return instances, canary
+}
+
+func TestInstanceLabelIndexMatch(t *testing.T) {
+	instances, canary := newCanaryBenchmarkSpecs(100, 8)
+	canary.CanaryRules = append(canary.CanaryRules,
+		&CanaryRule{ServiceInstanceLabels: map[string]string{"version": "v-missing"}},
+		&CanaryRule{ServiceInstanceLabels: map[string]string{"build": "tier-1"}},
+	)
+
+	index := newInstanceLabelIndex(instances)
+	for i, rule := range canary.CanaryRules {
+		want := []*ServiceInstanceSpec{}
+		for _, ins := range instances {
+			if rule.matchInstance(ins) {
+				want = append(want, ins)
+			}
+		}
+
+		got := index.match(rule)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("rule %d: want %d instances, got %d", i, len(want), len(got))
+		}
+	}
+}
+
+func BenchmarkAppendProxyWithCanary(b *testing.B) {
+	instances, canary := newCanaryBenchmarkSpecs(500, 20)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		builder := newPipelineSpecBuilder("egress")
+		builder.appendProxyWithCanary(instances, InstanceSchemeHTTP, canary, "", nil, nil, nil)
+	}
+}
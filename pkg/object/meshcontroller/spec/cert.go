@@ -0,0 +1,184 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+const (
+	// DefaultCertTTL is the default lifetime of the service certificates.
+	DefaultCertTTL = 24 * time.Hour
+
+	// RootCertTTL is the lifetime of the mesh root certificate.
+	RootCertTTL = 10 * 365 * 24 * time.Hour
+
+	rootCertCommonName = "easegress-mesh-root-ca"
+)
+
+type (
+	// Certificate is a certificate issued by the mesh CA with its private
+	// key, they are PEM encoded data in base64 encoded format.
+	Certificate struct {
+		// ServiceName is empty for the root certificate.
+		ServiceName string `yaml:"serviceName"`
+		CertBase64  string `yaml:"certBase64"`
+		KeyBase64   string `yaml:"keyBase64"`
+		SignTime    string `yaml:"signTime"`
+		TTL         string `yaml:"ttl"`
+	}
+
+	// MTLSCerts are the certificates a sidecar uses for mTLS, the root
+	// certificate carries no private key, which never leaves the master.
+	MTLSCerts struct {
+		Root    *Certificate
+		Service *Certificate
+	}
+)
+
+// NewRootCertificate creates a self-signed root certificate of the mesh CA.
+func NewRootCertificate(ttl time.Duration) (*Certificate, error) {
+	now := time.Now()
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: rootCertCommonName},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(ttl),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	return newCertificate("", template, nil, nil, now, ttl)
+}
+
+// SignServiceCertificate signs a certificate for the service by the root
+// certificate, the name of the service is its DNS name, which is verified
+// by the clients.
+func (c *Certificate) SignServiceCertificate(serviceName string, ttl time.Duration) (*Certificate, error) {
+	rootCert, err := c.TLSCertificate()
+	if err != nil {
+		return nil, err
+	}
+	parent, err := x509.ParseCertificate(rootCert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("parse root certificate failed: %v", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: serviceName},
+		DNSNames:    []string{serviceName},
+		NotBefore:   now.Add(-time.Minute),
+		NotAfter:    now.Add(ttl),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	return newCertificate(serviceName, template, parent, rootCert.PrivateKey, now, ttl)
+}
+
+func newCertificate(serviceName string, template, parent *x509.Certificate,
+	parentKey interface{}, now time.Time, ttl time.Duration) (*Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate key failed: %v", err)
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("generate serial number failed: %v", err)
+	}
+	template.SerialNumber = serialNumber
+
+	// NOTE: The root certificate is self-signed.
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, fmt.Errorf("create certificate failed: %v", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("marshal private key failed: %v", err)
+	}
+
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+
+	return &Certificate{
+		ServiceName: serviceName,
+		CertBase64:  base64.StdEncoding.EncodeToString(certPem),
+		KeyBase64:   base64.StdEncoding.EncodeToString(keyPem),
+		SignTime:    now.Format(time.RFC3339),
+		TTL:         ttl.String(),
+	}, nil
+}
+
+// TLSCertificate parses the certificate and its private key.
+func (c *Certificate) TLSCertificate() (*tls.Certificate, error) {
+	certPem, err := base64.StdEncoding.DecodeString(c.CertBase64)
+	if err != nil {
+		return nil, fmt.Errorf("decode certBase64 failed: %v", err)
+	}
+	keyPem, err := base64.StdEncoding.DecodeString(c.KeyBase64)
+	if err != nil {
+		return nil, fmt.Errorf("decode keyBase64 failed: %v", err)
+	}
+
+	cert, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		return nil, fmt.Errorf("generate x509 key pair failed: %v", err)
+	}
+
+	return &cert, nil
+}
+
+// PublicCertificate returns a copy of the certificate without its private key.
+func (c *Certificate) PublicCertificate() *Certificate {
+	public := *c
+	public.KeyBase64 = ""
+	return &public
+}
+
+// NeedRenew reports whether the certificate needs to be signed again, which
+// is after two thirds of its lifetime, so the sidecars get the new one well
+// before the old one expires.
+func (c *Certificate) NeedRenew(now time.Time) bool {
+	signTime, err := time.Parse(time.RFC3339, c.SignTime)
+	if err != nil {
+		return true
+	}
+	ttl, err := time.ParseDuration(c.TTL)
+	if err != nil {
+		return true
+	}
+
+	return !now.Before(signTime.Add(ttl * 2 / 3))
+}
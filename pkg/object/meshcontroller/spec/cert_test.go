@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+)
+
+func TestSignServiceCertificate(t *testing.T) {
+	root, err := NewRootCertificate(RootCertTTL)
+	if err != nil {
+		t.Fatalf("create root certificate failed: %v", err)
+	}
+	cert, err := root.SignServiceCertificate("order", DefaultCertTTL)
+	if err != nil {
+		t.Fatalf("sign certificate failed: %v", err)
+	}
+	if cert.ServiceName != "order" {
+		t.Errorf("want service name order, got %s", cert.ServiceName)
+	}
+
+	rootCert, err := root.TLSCertificate()
+	if err != nil {
+		t.Fatalf("parse root certificate failed: %v", err)
+	}
+	serviceCert, err := cert.TLSCertificate()
+	if err != nil {
+		t.Fatalf("parse service certificate failed: %v", err)
+	}
+
+	roots := x509.NewCertPool()
+	parsedRoot, _ := x509.ParseCertificate(rootCert.Certificate[0])
+	roots.AddCert(parsedRoot)
+	leaf, _ := x509.ParseCertificate(serviceCert.Certificate[0])
+
+	for _, usage := range []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth} {
+		_, err = leaf.Verify(x509.VerifyOptions{
+			DNSName:   "order",
+			Roots:     roots,
+			KeyUsages: []x509.ExtKeyUsage{usage},
+		})
+		if err != nil {
+			t.Errorf("verify certificate for usage %v failed: %v", usage, err)
+		}
+	}
+
+	_, err = leaf.Verify(x509.VerifyOptions{DNSName: "payment", Roots: roots})
+	if err == nil {
+		t.Errorf("certificate of order should not be valid for payment")
+	}
+
+	other, _ := NewRootCertificate(RootCertTTL)
+	otherCert, _ := other.TLSCertificate()
+	otherRoots := x509.NewCertPool()
+	parsedOther, _ := x509.ParseCertificate(otherCert.Certificate[0])
+	otherRoots.AddCert(parsedOther)
+	if _, err = leaf.Verify(x509.VerifyOptions{DNSName: "order", Roots: otherRoots}); err == nil {
+		t.Errorf("certificate should not be valid for another root")
+	}
+}
+
+func TestCertificateNeedRenew(t *testing.T) {
+	signTime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	cert := &Certificate{SignTime: signTime.Format(time.RFC3339), TTL: "24h"}
+
+	if cert.NeedRenew(signTime.Add(15 * time.Hour)) {
+		t.Errorf("certificate should not be renewed before two thirds of its lifetime")
+	}
+	if !cert.NeedRenew(signTime.Add(16 * time.Hour)) {
+		t.Errorf("certificate should be renewed after two thirds of its lifetime")
+	}
+
+	cert.TTL = "invalid"
+	if !cert.NeedRenew(signTime) {
+		t.Errorf("certificate with invalid ttl should be renewed")
+	}
+}
+
+func TestPublicCertificate(t *testing.T) {
+	root, err := NewRootCertificate(RootCertTTL)
+	if err != nil {
+		t.Fatalf("create root certificate failed: %v", err)
+	}
+
+	public := root.PublicCertificate()
+	if public.KeyBase64 != "" {
+		t.Errorf("want no private key, got %s", public.KeyBase64)
+	}
+	if public.CertBase64 != root.CertBase64 {
+		t.Errorf("want certificate %s, got %s", root.CertBase64, public.CertBase64)
+	}
+	if root.KeyBase64 == "" {
+		t.Errorf("private key of the original certificate should be kept")
+	}
+	if _, err := public.SignServiceCertificate("order", DefaultCertTTL); err == nil {
+		t.Errorf("certificate without private key should not sign")
+	}
+}
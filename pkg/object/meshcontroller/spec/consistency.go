@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	// InconsistencyOrphanedService is the tenant listing a service not found.
+	InconsistencyOrphanedService = "orphanedService"
+	// InconsistencyMismatchedTenant is the tenant listing a service
+	// registered into another tenant.
+	InconsistencyMismatchedTenant = "mismatchedTenant"
+	// InconsistencyTenantNotFound is the service registered into a tenant
+	// not found, its sidecar fails to discover any service.
+	InconsistencyTenantNotFound = "tenantNotFound"
+	// InconsistencyUnlistedService is the service not listed by the tenant
+	// it registered into, it's invisible to the other services.
+	InconsistencyUnlistedService = "unlistedService"
+	// InconsistencyDuplicatedService is the tenant listing a service more than once.
+	InconsistencyDuplicatedService = "duplicatedService"
+	// InconsistencyDeletedService is the tenant listing a soft-deleted service.
+	InconsistencyDeletedService = "deletedService"
+)
+
+type (
+	// TenantInconsistency is an inconsistency between the services listed
+	// by a tenant and the tenant the services registered into.
+	TenantInconsistency struct {
+		Type    string `yaml:"type"`
+		Tenant  string `yaml:"tenant"`
+		Service string `yaml:"service"`
+		Message string `yaml:"message"`
+	}
+)
+
+// CheckTenantConsistency checks the services of all tenants against the
+// registered tenants of all services, the inconsistencies are sorted by
+// tenant, service and type.
+func CheckTenantConsistency(tenants []*Tenant, services []*Service) []*TenantInconsistency {
+	inconsistencies := []*TenantInconsistency{}
+	add := func(typ, tenant, service, format string, args ...interface{}) {
+		inconsistencies = append(inconsistencies, &TenantInconsistency{
+			Type:    typ,
+			Tenant:  tenant,
+			Service: service,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	serviceSpecs := make(map[string]*Service)
+	for _, s := range services {
+		serviceSpecs[s.Name] = s
+	}
+
+	tenantServices := make(map[string]map[string]bool)
+	for _, t := range tenants {
+		listed := make(map[string]bool)
+		tenantServices[t.Name] = listed
+
+		for _, serviceName := range t.Services {
+			if listed[serviceName] {
+				add(InconsistencyDuplicatedService, t.Name, serviceName,
+					"tenant %s lists service %s more than once", t.Name, serviceName)
+				continue
+			}
+			listed[serviceName] = true
+
+			// NOTE: The tenant could list a service by its alias.
+			s, exists := serviceSpecs[serviceName]
+			if !exists {
+				if s = ResolveServiceAlias(services, serviceName); s != nil {
+					exists = true
+					listed[s.Name] = true
+				}
+			}
+			switch {
+			case !exists:
+				add(InconsistencyOrphanedService, t.Name, serviceName,
+					"tenant %s lists service %s which is not found", t.Name, serviceName)
+			case s.SoftDeleted():
+				add(InconsistencyDeletedService, t.Name, serviceName,
+					"tenant %s lists service %s which is soft-deleted", t.Name, serviceName)
+			case s.RegisterTenant != t.Name:
+				add(InconsistencyMismatchedTenant, t.Name, serviceName,
+					"tenant %s lists service %s which registers into tenant %s",
+					t.Name, serviceName, s.RegisterTenant)
+			}
+		}
+	}
+
+	for _, s := range services {
+		// NOTE: The soft-deleted services are removed from their tenants.
+		if s.SoftDeleted() {
+			continue
+		}
+
+		listed, exists := tenantServices[s.RegisterTenant]
+		switch {
+		case !exists:
+			add(InconsistencyTenantNotFound, s.RegisterTenant, s.Name,
+				"service %s registers into tenant %s which is not found", s.Name, s.RegisterTenant)
+		case !listed[s.Name]:
+			add(InconsistencyUnlistedService, s.RegisterTenant, s.Name,
+				"service %s registers into tenant %s which doesn't list it", s.Name, s.RegisterTenant)
+		}
+	}
+
+	sort.Slice(inconsistencies, func(i, j int) bool {
+		x, y := inconsistencies[i], inconsistencies[j]
+		if x.Tenant != y.Tenant {
+			return x.Tenant < y.Tenant
+		}
+		if x.Service != y.Service {
+			return x.Service < y.Service
+		}
+		return x.Type < y.Type
+	})
+
+	return inconsistencies
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckTenantConsistency(t *testing.T) {
+	tenants := []*Tenant{
+		{Name: GlobalTenant, Services: []string{"config"}},
+		{Name: "tenant-001", Services: []string{"order", "payment", "delivery", "order", "coupon"}},
+		{Name: "tenant-002", Services: []string{"stock"}},
+	}
+	services := []*Service{
+		{Name: "config", RegisterTenant: GlobalTenant},
+		{Name: "order", RegisterTenant: "tenant-001"},
+		{Name: "payment", RegisterTenant: "tenant-002"},
+		{Name: "stock", RegisterTenant: "tenant-002"},
+		{Name: "user", RegisterTenant: "tenant-003"},
+		{Name: "cart", RegisterTenant: "tenant-002", DeletedAt: "2021-01-01T00:00:00Z"},
+		{Name: "coupon", RegisterTenant: "tenant-001", DeletedAt: "2021-01-01T00:00:00Z"},
+	}
+
+	type result struct {
+		Type, Tenant, Service string
+	}
+	got := []result{}
+	for _, inconsistency := range CheckTenantConsistency(tenants, services) {
+		if inconsistency.Message == "" {
+			t.Errorf("inconsistency %+v should have message", inconsistency)
+		}
+		got = append(got, result{inconsistency.Type, inconsistency.Tenant, inconsistency.Service})
+	}
+
+	want := []result{
+		{InconsistencyDeletedService, "tenant-001", "coupon"},
+		{InconsistencyOrphanedService, "tenant-001", "delivery"},
+		{InconsistencyDuplicatedService, "tenant-001", "order"},
+		{InconsistencyMismatchedTenant, "tenant-001", "payment"},
+		{InconsistencyUnlistedService, "tenant-002", "payment"},
+		{InconsistencyTenantNotFound, "tenant-003", "user"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	if got := CheckTenantConsistency(tenants[:1], services[:1]); len(got) != 0 {
+		t.Errorf("want no inconsistency, got %v", got)
+	}
+
+	tenants = []*Tenant{{Name: "tenant-001", Services: []string{"order-legacy"}}}
+	services = []*Service{{Name: "order", RegisterTenant: "tenant-001", Aliases: []string{"order-legacy"}}}
+	if got := CheckTenantConsistency(tenants, services); len(got) != 0 {
+		t.Errorf("want the service listed by its alias consistent, got %v", got)
+	}
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// SpecChangeAdded means the field only exists in the new spec.
+	SpecChangeAdded = "added"
+	// SpecChangeRemoved means the field only exists in the old spec.
+	SpecChangeRemoved = "removed"
+	// SpecChangeModified means the field exists in both specs with different values.
+	SpecChangeModified = "modified"
+)
+
+type (
+	// SpecDiff is the difference between two generations of one generated spec.
+	SpecDiff struct {
+		Kind    string        `yaml:"kind"`
+		Name    string        `yaml:"name"`
+		Changes []*SpecChange `yaml:"changes"`
+	}
+
+	// SpecChange is the change of one field, the path looks like filters[0].mainPool.
+	SpecChange struct {
+		Path string      `yaml:"path"`
+		Type string      `yaml:"type"`
+		Old  interface{} `yaml:"old"`
+		New  interface{} `yaml:"new"`
+	}
+)
+
+// GeneratedSpecs generates all specs of the sidecar from the service,
+// which are ingress pipeline, ingress server, egress pipeline and egress server.
+// The certs are required if the sidecar enables mTLS.
+func (s *Service) GeneratedSpecs(instanceSpecs []*ServiceInstanceSpec, applicationPort uint32,
+	certs *MTLSCerts) ([]*supervisor.Spec, error) {
+	ingressPipeline, err := s.SideCarIngressPipelineSpec(applicationPort)
+	if err != nil {
+		return nil, err
+	}
+	ingressServer, err := s.SideCarIngressHTTPServerSpec(certs)
+	if err != nil {
+		return nil, err
+	}
+	egressPipeline, err := s.SideCarEgressPipelineSpec(instanceSpecs)
+	if err != nil {
+		return nil, err
+	}
+	egressServer, err := s.SideCarEgressHTTPServerSpec()
+	if err != nil {
+		return nil, err
+	}
+
+	return []*supervisor.Spec{ingressPipeline, ingressServer, egressPipeline, egressServer}, nil
+}
+
+// DiffSpecs returns the field changes from the old spec to the new one.
+func DiffSpecs(oldSpec, newSpec *supervisor.Spec) (*SpecDiff, error) {
+	var oldTree, newTree interface{}
+	err := yaml.Unmarshal([]byte(oldSpec.YAMLConfig()), &oldTree)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal %s to yaml failed: %v", oldSpec.YAMLConfig(), err)
+	}
+	err = yaml.Unmarshal([]byte(newSpec.YAMLConfig()), &newTree)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal %s to yaml failed: %v", newSpec.YAMLConfig(), err)
+	}
+
+	return &SpecDiff{
+		Kind:    newSpec.Kind(),
+		Name:    newSpec.Name(),
+		Changes: diffTree("", oldTree, newTree, []*SpecChange{}),
+	}, nil
+}
+
+func diffTree(path string, oldValue, newValue interface{}, changes []*SpecChange) []*SpecChange {
+	oldMap, oldIsMap := oldValue.(map[interface{}]interface{})
+	newMap, newIsMap := newValue.(map[interface{}]interface{})
+	if oldIsMap && newIsMap {
+		keys := make(map[string]interface{})
+		for k := range oldMap {
+			keys[fmt.Sprint(k)] = k
+		}
+		for k := range newMap {
+			keys[fmt.Sprint(k)] = k
+		}
+		names := make([]string, 0, len(keys))
+		for name := range keys {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			childPath := name
+			if path != "" {
+				childPath = path + "." + name
+			}
+			oldChild, oldExists := oldMap[keys[name]]
+			newChild, newExists := newMap[keys[name]]
+			switch {
+			case !oldExists:
+				changes = append(changes, &SpecChange{Path: childPath, Type: SpecChangeAdded, New: newChild})
+			case !newExists:
+				changes = append(changes, &SpecChange{Path: childPath, Type: SpecChangeRemoved, Old: oldChild})
+			default:
+				changes = diffTree(childPath, oldChild, newChild, changes)
+			}
+		}
+		return changes
+	}
+
+	oldSlice, oldIsSlice := oldValue.([]interface{})
+	newSlice, newIsSlice := newValue.([]interface{})
+	if oldIsSlice && newIsSlice {
+		for i := 0; i < len(oldSlice) || i < len(newSlice); i++ {
+			childPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(oldSlice):
+				changes = append(changes, &SpecChange{Path: childPath, Type: SpecChangeAdded, New: newSlice[i]})
+			case i >= len(newSlice):
+				changes = append(changes, &SpecChange{Path: childPath, Type: SpecChangeRemoved, Old: oldSlice[i]})
+			default:
+				changes = diffTree(childPath, oldSlice[i], newSlice[i], changes)
+			}
+		}
+		return changes
+	}
+
+	if !reflect.DeepEqual(oldValue, newValue) {
+		changes = append(changes, &SpecChange{Path: path, Type: SpecChangeModified, Old: oldValue, New: newValue})
+	}
+
+	return changes
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/filter/ratelimiter"
+	"github.com/megaease/easegress/pkg/util/urlrule"
+)
+
+func TestDiffTree(t *testing.T) {
+	oldTree := map[interface{}]interface{}{
+		"name":    "pipeline",
+		"timeout": "1s",
+		"flow":    []interface{}{"a", "b"},
+		"filters": []interface{}{
+			map[interface{}]interface{}{"kind": "Proxy", "retry": 3},
+		},
+	}
+	newTree := map[interface{}]interface{}{
+		"name":  "pipeline",
+		"flow":  []interface{}{"a", "b", "c"},
+		"https": true,
+		"filters": []interface{}{
+			map[interface{}]interface{}{"kind": "Proxy", "retry": 5},
+		},
+	}
+
+	changes := diffTree("", oldTree, newTree, []*SpecChange{})
+	want := []SpecChange{
+		{Path: "filters[0].retry", Type: SpecChangeModified, Old: 3, New: 5},
+		{Path: "flow[2]", Type: SpecChangeAdded, New: "c"},
+		{Path: "https", Type: SpecChangeAdded, New: true},
+		{Path: "timeout", Type: SpecChangeRemoved, Old: "1s"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("want %d changes, got %d: %+v", len(want), len(changes), changes)
+	}
+	for i, change := range changes {
+		if *change != want[i] {
+			t.Errorf("change %d: want %+v, got %+v", i, want[i], *change)
+		}
+	}
+
+	if changes := diffTree("", oldTree, oldTree, []*SpecChange{}); len(changes) != 0 {
+		t.Errorf("want no changes for the same tree, got %+v", changes)
+	}
+}
+
+func TestGeneratedSpecsDiff(t *testing.T) {
+	oldService := &Service{
+		Name: "order-001",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+		Resilience: &Resilience{
+			RateLimiter: &ratelimiter.Spec{
+				Policies: []*ratelimiter.Policy{{
+					Name:               "default",
+					TimeoutDuration:    "100ms",
+					LimitForPeriod:     50,
+					LimitRefreshPeriod: "10ms",
+				}},
+				DefaultPolicyRef: "default",
+				URLs: []*ratelimiter.URLRule{{
+					URLRule: urlrule.URLRule{
+						Methods:   []string{"GET"},
+						URL:       urlrule.StringMatch{Prefix: "/"},
+						PolicyRef: "default",
+					},
+				}},
+			},
+		},
+	}
+	newService := *oldService
+	newService.Resilience = nil
+
+	instanceSpecs := []*ServiceInstanceSpec{{
+		ServiceName: "order-001",
+		InstanceID:  "order-001-1",
+		IP:          "192.168.0.110",
+		Port:        80,
+		Status:      ServiceStatusUp,
+	}}
+
+	oldSpecs, err := oldService.GeneratedSpecs(instanceSpecs, 8000, nil)
+	if err != nil {
+		t.Fatalf("generate old specs failed: %v", err)
+	}
+	newSpecs, err := newService.GeneratedSpecs(instanceSpecs, 8000, nil)
+	if err != nil {
+		t.Fatalf("generate new specs failed: %v", err)
+	}
+	if len(oldSpecs) != 4 || len(newSpecs) != 4 {
+		t.Fatalf("want 4 generated specs, got %d and %d", len(oldSpecs), len(newSpecs))
+	}
+
+	ingressPipelineDiff, err := DiffSpecs(oldSpecs[0], newSpecs[0])
+	if err != nil {
+		t.Fatalf("diff ingress pipeline failed: %v", err)
+	}
+	if ingressPipelineDiff.Name != oldService.IngressPipelineName() {
+		t.Errorf("want diff of %s, got %s", oldService.IngressPipelineName(), ingressPipelineDiff.Name)
+	}
+	removed := false
+	for _, change := range ingressPipelineDiff.Changes {
+		if change.Type == SpecChangeRemoved && strings.HasPrefix(change.Path, "filters[") {
+			removed = true
+		}
+	}
+	if !removed {
+		t.Errorf("removing the rate limiter should remove a filter, got %+v", ingressPipelineDiff.Changes)
+	}
+
+	for i := 1; i < len(newSpecs); i++ {
+		diff, err := DiffSpecs(oldSpecs[i], newSpecs[i])
+		if err != nil {
+			t.Fatalf("diff %s failed: %v", newSpecs[i].Name(), err)
+		}
+		if len(diff.Changes) != 0 {
+			t.Errorf("want no changes of %s, got %+v", diff.Name, diff.Changes)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"fmt"
+
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+// Validate validates Tenant.
+func (t Tenant) Validate() error {
+	exported := make(map[string]bool)
+	for _, export := range t.ExportedServices {
+		if exported[export.Service] {
+			return fmt.Errorf("service %s exported more than once", export.Service)
+		}
+		exported[export.Service] = true
+
+		if stringtool.StrInSlice(t.Name, export.Tenants) {
+			return fmt.Errorf("service %s exported to its own tenant %s", export.Service, t.Name)
+		}
+	}
+
+	return nil
+}
+
+// CheckExportedServices checks the exported services are listed by the tenant.
+func (t *Tenant) CheckExportedServices() error {
+	for _, export := range t.ExportedServices {
+		if !stringtool.StrInSlice(export.Service, t.Services) {
+			return fmt.Errorf("exported service %s is not in tenant %s", export.Service, t.Name)
+		}
+	}
+
+	return nil
+}
+
+// exportsTo reports whether the tenant exports the service to the tenant.
+func (t *Tenant) exportsTo(serviceName, tenantName string) bool {
+	for _, export := range t.ExportedServices {
+		if export.Service == serviceName {
+			return stringtool.StrInSlice(tenantName, export.Tenants)
+		}
+	}
+
+	return false
+}
+
+// CallGranted reports whether the caller is granted explicitly to discover
+// and call the target in another tenant, by the allowed callers of the
+// target or the exported services of the tenant of the target, which could
+// be nil if it's not found. Everything else is denied.
+func CallGranted(caller, target *Service, targetTenant *Tenant) bool {
+	if caller.RegisterTenant == target.RegisterTenant || target.SoftDeleted() {
+		return false
+	}
+
+	if stringtool.StrInSlice(caller.Name, target.AllowedCallers) {
+		return true
+	}
+
+	return targetTenant != nil && targetTenant.Name == target.RegisterTenant &&
+		targetTenant.exportsTo(target.Name, caller.RegisterTenant)
+}
+
+// GrantedServices returns the services in other tenants the caller is
+// granted to discover and call, by their names.
+func GrantedServices(caller *Service, tenants []*Tenant, services []*Service) map[string]*Service {
+	tenantSpecs := make(map[string]*Tenant, len(tenants))
+	for _, t := range tenants {
+		tenantSpecs[t.Name] = t
+	}
+
+	granted := make(map[string]*Service)
+	for _, s := range services {
+		if CallGranted(caller, s, tenantSpecs[s.RegisterTenant]) {
+			granted[s.Name] = s
+		}
+	}
+
+	return granted
+}
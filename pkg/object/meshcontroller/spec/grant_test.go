@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestGrantedServices(t *testing.T) {
+	tenants := []*Tenant{
+		{Name: "tenant-001", Services: []string{"order"}},
+		{
+			Name:     "tenant-002",
+			Services: []string{"payment", "refund", "ledger"},
+			ExportedServices: []*ServiceExport{
+				{Service: "payment", Tenants: []string{"tenant-001"}},
+				{Service: "ledger", Tenants: []string{"tenant-003"}},
+			},
+		},
+		{Name: "tenant-003", Services: []string{"stock", "audit"}},
+	}
+	services := []*Service{
+		{Name: "order", RegisterTenant: "tenant-001"},
+		{Name: "payment", RegisterTenant: "tenant-002"},
+		{Name: "refund", RegisterTenant: "tenant-002"},
+		{Name: "ledger", RegisterTenant: "tenant-002"},
+		{Name: "stock", RegisterTenant: "tenant-003", AllowedCallers: []string{"order"}},
+		{Name: "audit", RegisterTenant: "tenant-003", AllowedCallers: []string{"order"},
+			DeletedAt: "2021-01-01T00:00:00Z"},
+		{Name: "coupon", RegisterTenant: "tenant-001", AllowedCallers: []string{"order"}},
+	}
+	order := services[0]
+
+	granted := GrantedServices(order, tenants, services)
+	names := []string{}
+	for name := range granted {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if want := []string{"payment", "stock"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("want granted %v, got %v", want, names)
+	}
+
+	// NOTE: Nothing is granted without the grants.
+	if CallGranted(order, services[2], tenants[1]) {
+		t.Errorf("want refund denied without grant")
+	}
+	if CallGranted(order, services[3], tenants[1]) {
+		t.Errorf("want ledger denied, it's exported to other tenants")
+	}
+	if CallGranted(order, services[1], nil) {
+		t.Errorf("want payment denied without its tenant")
+	}
+	if CallGranted(services[4], order, tenants[0]) {
+		t.Errorf("want order denied, the grant isn't mutual")
+	}
+}
+
+func TestTenantValidate(t *testing.T) {
+	tenant := Tenant{
+		Name:     "tenant-002",
+		Services: []string{"payment"},
+		ExportedServices: []*ServiceExport{
+			{Service: "payment", Tenants: []string{"tenant-001"}},
+		},
+	}
+	if err := tenant.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := tenant.CheckExportedServices(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	tenant.ExportedServices = append(tenant.ExportedServices,
+		&ServiceExport{Service: "refund", Tenants: []string{"tenant-001"}})
+	if err := tenant.CheckExportedServices(); err == nil {
+		t.Errorf("want error for exporting the service not in the tenant")
+	}
+
+	tenant.ExportedServices = []*ServiceExport{
+		{Service: "payment", Tenants: []string{"tenant-002"}},
+	}
+	if err := tenant.Validate(); err == nil {
+		t.Errorf("want error for exporting to its own tenant")
+	}
+
+	tenant.ExportedServices = []*ServiceExport{
+		{Service: "payment", Tenants: []string{"tenant-001"}},
+		{Service: "payment", Tenants: []string{"tenant-003"}},
+	}
+	if err := tenant.Validate(); err == nil {
+		t.Errorf("want error for exporting the service twice")
+	}
+}
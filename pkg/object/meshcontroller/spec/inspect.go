@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// PipelineSideCarIngress is the pipeline of sidecar ingress.
+	PipelineSideCarIngress = "sidecarIngress"
+	// PipelineSideCarEgress is the pipeline of sidecar egress.
+	PipelineSideCarEgress = "sidecarEgress"
+	// PipelineIngress is the pipeline of mesh ingress.
+	PipelineIngress = "ingress"
+
+	redactedValue = "REDACTED"
+)
+
+type (
+	// GeneratedPipeline is a pipeline generated from the service for inspection.
+	GeneratedPipeline struct {
+		Type       string `yaml:"type"`
+		Name       string `yaml:"name"`
+		YAMLConfig string `yaml:"yamlConfig"`
+	}
+)
+
+var (
+	// secretFields are the fields whose values never leave the cluster.
+	secretFields = map[string]bool{
+		"certs":       true,
+		"keys":        true,
+		"keybase64":   true,
+		"password":    true,
+		"token":       true,
+		"secret":      true,
+		"accesskey":   true,
+		"secretkey":   true,
+		"apikey":      true,
+		"credentials": true,
+	}
+
+	// secretHeaders are the headers whose values never leave the cluster.
+	secretHeaders = map[string]bool{
+		"authorization":       true,
+		"proxy-authorization": true,
+		"cookie":              true,
+		"set-cookie":          true,
+		"x-api-key":           true,
+	}
+)
+
+// InspectPipelines generates all pipelines of the service with the instances,
+// the secret-bearing fields and the ${env:NAME} and ${secret:name} references
+// in them are redacted. There's no mesh ingress pipeline for the service
+// enabling mTLS.
+func (s *Service) InspectPipelines(instanceSpecs []*ServiceInstanceSpec, applicationPort uint32) ([]*GeneratedPipeline, error) {
+	s = s.withRedactedReferences()
+
+	sidecarIngress, err := s.SideCarIngressPipelineSpec(applicationPort)
+	if err != nil {
+		return nil, err
+	}
+	sidecarEgress, err := s.SideCarEgressPipelineSpec(instanceSpecs)
+	if err != nil {
+		return nil, err
+	}
+
+	pipelines := []*GeneratedPipeline{
+		{Type: PipelineSideCarIngress, Name: sidecarIngress.Name(), YAMLConfig: sidecarIngress.YAMLConfig()},
+		{Type: PipelineSideCarEgress, Name: sidecarEgress.Name(), YAMLConfig: sidecarEgress.YAMLConfig()},
+	}
+	if !s.MTLSEnabled() {
+		ingress, err := s.IngressPipelineSpec(instanceSpecs)
+		if err != nil {
+			return nil, err
+		}
+		pipelines = append(pipelines, &GeneratedPipeline{
+			Type: PipelineIngress, Name: ingress.Name(), YAMLConfig: ingress.YAMLConfig(),
+		})
+	}
+	for _, pipeline := range pipelines {
+		pipeline.YAMLConfig, err = RedactYAMLConfig(pipeline.YAMLConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return pipelines, nil
+}
+
+// RedactYAMLConfig replaces the values of secret-bearing fields and headers.
+func RedactYAMLConfig(yamlConfig string) (string, error) {
+	var tree interface{}
+	err := yaml.Unmarshal([]byte(yamlConfig), &tree)
+	if err != nil {
+		return "", fmt.Errorf("unmarshal %s to yaml failed: %v", yamlConfig, err)
+	}
+
+	buff, err := yaml.Marshal(redactTree(tree, false))
+	if err != nil {
+		return "", fmt.Errorf("marshal %#v to yaml failed: %v", tree, err)
+	}
+
+	return string(buff), nil
+}
+
+// redactTree redacts the tree in place, inHeaders reports whether
+// the keys of the tree are header names.
+func redactTree(tree interface{}, inHeaders bool) interface{} {
+	switch tree := tree.(type) {
+	case map[interface{}]interface{}:
+		for k, v := range tree {
+			name := strings.ToLower(fmt.Sprint(k))
+			if secretFields[name] || (inHeaders && secretHeaders[name]) {
+				tree[k] = redactedValue
+				continue
+			}
+			// NOTE: The header adaptors keep the headers in set and add.
+			headers := strings.HasSuffix(name, "headers") || name == "header" ||
+				(inHeaders && (name == "set" || name == "add"))
+			tree[k] = redactTree(v, headers)
+		}
+	case []interface{}:
+		for i, v := range tree {
+			tree[i] = redactTree(v, inHeaders)
+		}
+	}
+
+	return tree
+}
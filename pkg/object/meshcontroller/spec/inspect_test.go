@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/filter/mock"
+)
+
+func TestRedactYAMLConfig(t *testing.T) {
+	yamlConfig := `
+name: pipeline
+filters:
+- kind: Mock
+  rules:
+  - path: /login
+    code: 200
+    headers:
+      Set-Cookie: session=abc
+      Content-Type: application/json
+- kind: Proxy
+  mtls:
+    keyBase64: c2VjcmV0
+  token: abc
+`
+	redacted, err := RedactYAMLConfig(yamlConfig)
+	if err != nil {
+		t.Fatalf("redact failed: %v", err)
+	}
+
+	for _, secret := range []string{"session=abc", "c2VjcmV0", "abc\n"} {
+		if strings.Contains(redacted, secret) {
+			t.Errorf("secret %q should be redacted:\n%s", secret, redacted)
+		}
+	}
+	for _, kept := range []string{"application/json", "/login", "Set-Cookie: " + redactedValue} {
+		if !strings.Contains(redacted, kept) {
+			t.Errorf("%q should be kept:\n%s", kept, redacted)
+		}
+	}
+
+	if _, err := RedactYAMLConfig("name: [invalid"); err == nil {
+		t.Errorf("want error for invalid yaml")
+	}
+}
+
+func TestInspectPipelines(t *testing.T) {
+	s := &Service{
+		Name: "order-001",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+		Mock: &Mock{
+			Enabled: true,
+			Rules: []*mock.Rule{{
+				Path:    "/login",
+				Code:    200,
+				Headers: map[string]string{"Authorization": "Bearer secret-token"},
+			}},
+		},
+	}
+	instanceSpecs := []*ServiceInstanceSpec{{
+		ServiceName: "order-001",
+		InstanceID:  "order-001-1",
+		IP:          "192.168.0.110",
+		Port:        80,
+		Status:      ServiceStatusUp,
+	}}
+
+	pipelines, err := s.InspectPipelines(instanceSpecs, 8000)
+	if err != nil {
+		t.Fatalf("inspect pipelines failed: %v", err)
+	}
+
+	types := []string{PipelineSideCarIngress, PipelineSideCarEgress, PipelineIngress}
+	if len(pipelines) != len(types) {
+		t.Fatalf("want %d pipelines, got %d", len(types), len(pipelines))
+	}
+	for i, pipeline := range pipelines {
+		if pipeline.Type != types[i] {
+			t.Errorf("want pipeline type %s, got %s", types[i], pipeline.Type)
+		}
+		if strings.Contains(pipeline.YAMLConfig, "secret-token") {
+			t.Errorf("pipeline %s leaks the secret:\n%s", pipeline.Name, pipeline.YAMLConfig)
+		}
+	}
+	if !strings.Contains(pipelines[1].YAMLConfig, "http://192.168.0.110:80") {
+		t.Errorf("egress pipeline should contain the instance:\n%s", pipelines[1].YAMLConfig)
+	}
+}
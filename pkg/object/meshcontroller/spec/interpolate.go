@@ -0,0 +1,219 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// ReferenceEnv is the kind of references to environment variables.
+	ReferenceEnv = "env"
+	// ReferenceSecret is the kind of references to mesh secrets.
+	ReferenceSecret = "secret"
+)
+
+type (
+	// SecretResolver returns the value of the secret, false means the
+	// secret doesn't exist.
+	SecretResolver func(name string) (string, bool)
+)
+
+var (
+	// referenceRegexp matches ${env:NAME} and ${secret:name}.
+	referenceRegexp = regexp.MustCompile(`\$\{(env|secret):([^}]*)\}`)
+
+	secretResolver atomic.Value // SecretResolver
+)
+
+// SetSecretResolver sets the resolver of the secret references.
+func SetSecretResolver(resolver SecretResolver) {
+	secretResolver.Store(resolver)
+}
+
+func resolveReference(kind, name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("empty name in reference ${%s:}", kind)
+	}
+
+	switch kind {
+	case ReferenceEnv:
+		value, exists := os.LookupEnv(name)
+		if !exists {
+			return "", fmt.Errorf("environment variable %s referenced by ${env:%s} not found", name, name)
+		}
+		return value, nil
+	default:
+		resolver, _ := secretResolver.Load().(SecretResolver)
+		if resolver == nil {
+			return "", fmt.Errorf("no secret resolver for ${secret:%s}", name)
+		}
+		value, exists := resolver(name)
+		if !exists {
+			return "", fmt.Errorf("secret %s referenced by ${secret:%s} not found", name, name)
+		}
+		return value, nil
+	}
+}
+
+// interpolate replaces the references in the string with their values,
+// or the redacted value if redact is true.
+func interpolate(s string, redact bool) (string, error) {
+	var err error
+	result := referenceRegexp.ReplaceAllStringFunc(s, func(ref string) string {
+		if redact {
+			return redactedValue
+		}
+
+		m := referenceRegexp.FindStringSubmatch(ref)
+		value, e := resolveReference(m[1], m[2])
+		if e != nil && err == nil {
+			err = e
+		}
+		return value
+	})
+
+	return result, err
+}
+
+func interpolateTree(tree interface{}, redact bool) (interface{}, error) {
+	switch tree := tree.(type) {
+	case string:
+		return interpolate(tree, redact)
+	case map[interface{}]interface{}:
+		for k, v := range tree {
+			value, err := interpolateTree(v, redact)
+			if err != nil {
+				return nil, err
+			}
+			tree[k] = value
+		}
+	case []interface{}:
+		for i, v := range tree {
+			value, err := interpolateTree(v, redact)
+			if err != nil {
+				return nil, err
+			}
+			tree[i] = value
+		}
+	}
+
+	return tree, nil
+}
+
+// interpolateYAMLConfig replaces the references in the values of the
+// config. It works on the parsed config, so the values are never able
+// to break the YAML syntax.
+func interpolateYAMLConfig(yamlConfig string, redact bool) (string, error) {
+	if !referenceRegexp.MatchString(yamlConfig) {
+		return yamlConfig, nil
+	}
+
+	var tree interface{}
+	err := yaml.Unmarshal([]byte(yamlConfig), &tree)
+	if err != nil {
+		return "", fmt.Errorf("unmarshal %s to yaml failed: %v", yamlConfig, err)
+	}
+
+	tree, err = interpolateTree(tree, redact)
+	if err != nil {
+		return "", err
+	}
+
+	buff, err := yaml.Marshal(tree)
+	if err != nil {
+		return "", fmt.Errorf("marshal %#v to yaml failed: %v", tree, err)
+	}
+
+	return string(buff), nil
+}
+
+// newSuperSpec creates the spec after interpolating the references.
+func newSuperSpec(yamlConfig string, redact bool) (*supervisor.Spec, error) {
+	yamlConfig, err := interpolateYAMLConfig(yamlConfig, redact)
+	if err != nil {
+		return nil, err
+	}
+
+	return supervisor.NewSpec(yamlConfig)
+}
+
+// newSuperSpec creates the spec of the service after interpolating the
+// references, they are redacted if the service is for inspection.
+func (s *Service) newSuperSpec(yamlConfig string) (*supervisor.Spec, error) {
+	return newSuperSpec(yamlConfig, s.redactReferences)
+}
+
+// withRedactedReferences returns a copy of the service generating the
+// specs with the references redacted.
+func (s *Service) withRedactedReferences() *Service {
+	service := *s
+	service.redactReferences = true
+	return &service
+}
+
+// SecretReferences returns the names of the secrets the service refers to.
+func (s *Service) SecretReferences() []string {
+	buff, err := yaml.Marshal(s)
+	if err != nil {
+		panic(fmt.Errorf("BUG: marshal %#v to yaml failed: %v", s, err))
+	}
+
+	names := map[string]bool{}
+	for _, m := range referenceRegexp.FindAllStringSubmatch(string(buff), -1) {
+		if m[1] == ReferenceSecret {
+			names[m[2]] = true
+		}
+	}
+
+	result := make([]string, 0, len(names))
+	for name := range names {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+// ValidateSecretReferences checks the secrets the service refers to exist,
+// so the unresolved references fail at apply time. The environment
+// variables are resolved by the sidecars, they are not checked here.
+func (s *Service) ValidateSecretReferences() error {
+	var missing []string
+	for _, name := range s.SecretReferences() {
+		if _, err := resolveReference(ReferenceSecret, name); err != nil {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) != 0 {
+		return fmt.Errorf("secrets %s referenced by service %s not found",
+			strings.Join(missing, ", "), s.Name)
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/filter/mock"
+)
+
+func setTestSecrets(secrets map[string]string) {
+	SetSecretResolver(func(name string) (string, bool) {
+		value, exists := secrets[name]
+		return value, exists
+	})
+}
+
+func TestInterpolateYAMLConfig(t *testing.T) {
+	os.Setenv("EG_TEST_REGION", "eu-west")
+	defer os.Unsetenv("EG_TEST_REGION")
+	setTestSecrets(map[string]string{
+		"token": "abc: def\n# not a comment",
+	})
+
+	yamlConfig := `
+name: pipeline
+headers:
+  X-Region: region-${env:EG_TEST_REGION}
+  Authorization: Bearer ${secret:token}
+`
+	result, err := interpolateYAMLConfig(yamlConfig, false)
+	if err != nil {
+		t.Fatalf("interpolate failed: %v", err)
+	}
+
+	config := struct {
+		Name    string            `yaml:"name"`
+		Headers map[string]string `yaml:"headers"`
+	}{}
+	err = yaml.Unmarshal([]byte(result), &config)
+	if err != nil {
+		t.Fatalf("unmarshal %s failed: %v", result, err)
+	}
+	if config.Name != "pipeline" {
+		t.Errorf("want name pipeline, got %s", config.Name)
+	}
+	if got := config.Headers["X-Region"]; got != "region-eu-west" {
+		t.Errorf("env reference should be resolved, got %q", got)
+	}
+	if got := config.Headers["Authorization"]; got != "Bearer abc: def\n# not a comment" {
+		t.Errorf("secret reference should be resolved, got %q", got)
+	}
+
+	redacted, err := interpolateYAMLConfig(yamlConfig, true)
+	if err != nil {
+		t.Fatalf("interpolate failed: %v", err)
+	}
+	for _, value := range []string{"eu-west", "abc: def"} {
+		if strings.Contains(redacted, value) {
+			t.Errorf("%q should be redacted:\n%s", value, redacted)
+		}
+	}
+
+	if result, _ := interpolateYAMLConfig("name: $plain", false); result != "name: $plain" {
+		t.Errorf("config without references should be untouched, got %s", result)
+	}
+
+	for _, ref := range []string{"${env:EG_TEST_MISSING}", "${secret:missing}", "${env:}"} {
+		if _, err := interpolateYAMLConfig("name: "+ref, false); err == nil {
+			t.Errorf("want error for %s", ref)
+		}
+	}
+}
+
+func TestSecretReferences(t *testing.T) {
+	setTestSecrets(map[string]string{"token": "abc"})
+
+	s := &Service{
+		Name: "order-001",
+		Mock: &Mock{
+			Rules: []*mock.Rule{{
+				Path: "/login",
+				Headers: map[string]string{
+					"Authorization": "Bearer ${secret:token}",
+					"X-Api-Key":     "${secret:apikey}",
+					"X-Region":      "${env:REGION}",
+				},
+			}},
+		},
+	}
+
+	refs := s.SecretReferences()
+	if len(refs) != 2 || refs[0] != "apikey" || refs[1] != "token" {
+		t.Errorf("want secret references [apikey token], got %v", refs)
+	}
+
+	err := s.ValidateSecretReferences()
+	if err == nil || !strings.Contains(err.Error(), "apikey") {
+		t.Errorf("want error for missing secret apikey, got %v", err)
+	}
+
+	setTestSecrets(map[string]string{"token": "abc", "apikey": "def"})
+	if err := s.ValidateSecretReferences(); err != nil {
+		t.Errorf("want no error, got %v", err)
+	}
+
+	redacted := s.withRedactedReferences()
+	if !redacted.redactReferences || s.redactReferences {
+		t.Errorf("only the copy should redact references")
+	}
+}
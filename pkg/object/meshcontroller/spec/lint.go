@@ -0,0 +1,248 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+const (
+	// LintWarning is the severity of the issues worth a look, which
+	// don't stop the spec from working.
+	LintWarning LintSeverity = "warning"
+	// LintError is the severity of the issues making the spec not work
+	// as it reads.
+	LintError LintSeverity = "error"
+)
+
+type (
+	// LintSeverity is the severity of a lint issue.
+	LintSeverity string
+
+	// LintIssue is an issue found by a lint rule.
+	LintIssue struct {
+		Rule     string       `yaml:"rule"`
+		Severity LintSeverity `yaml:"severity"`
+		Message  string       `yaml:"message"`
+	}
+
+	// LintReport is the result of linting a service, CI is supposed to
+	// gate on the errors only.
+	LintReport struct {
+		Warnings []*LintIssue `yaml:"warnings"`
+		Errors   []*LintIssue `yaml:"errors"`
+	}
+
+	// LintRule checks the service for risky configurations. The instances
+	// are the registered ones of the service, which could be empty.
+	LintRule interface {
+		Name() string
+		Lint(s *Service, instanceSpecs []*ServiceInstanceSpec) []*LintIssue
+	}
+
+	// LintFunc is the function form of the check of a lint rule.
+	LintFunc func(s *Service, instanceSpecs []*ServiceInstanceSpec) []*LintIssue
+
+	lintRule struct {
+		name string
+		lint LintFunc
+	}
+)
+
+var (
+	lintRulesMutex sync.RWMutex
+	lintRules      = map[string]LintRule{}
+)
+
+func init() {
+	RegisterLintRule(NewLintRule("circuit-breaker-without-time-limiter", lintCircuitBreakerWithoutTimeLimiter))
+	RegisterLintRule(NewLintRule("retryer-without-budget", lintRetryerWithoutBudget))
+	RegisterLintRule(NewLintRule("canary-rule-without-labels", lintCanaryRuleWithoutLabels))
+	RegisterLintRule(NewLintRule("canary-rule-empty-pool", lintCanaryRuleEmptyPool))
+}
+
+// NewLintRule creates a lint rule from the function.
+func NewLintRule(name string, lint LintFunc) LintRule {
+	return &lintRule{name: name, lint: lint}
+}
+
+func (r *lintRule) Name() string { return r.name }
+
+func (r *lintRule) Lint(s *Service, instanceSpecs []*ServiceInstanceSpec) []*LintIssue {
+	return r.lint(s, instanceSpecs)
+}
+
+// RegisterLintRule registers the lint rule, it panics if the name is empty
+// or registered already.
+func RegisterLintRule(rule LintRule) {
+	if rule.Name() == "" {
+		panic(fmt.Errorf("%T: empty lint rule name", rule))
+	}
+
+	lintRulesMutex.Lock()
+	defer lintRulesMutex.Unlock()
+
+	if existed, exists := lintRules[rule.Name()]; exists {
+		panic(fmt.Errorf("%T and %T got same lint rule name: %s", rule, existed, rule.Name()))
+	}
+	lintRules[rule.Name()] = rule
+}
+
+// UnregisterLintRule unregisters the lint rule.
+func UnregisterLintRule(name string) {
+	lintRulesMutex.Lock()
+	defer lintRulesMutex.Unlock()
+
+	delete(lintRules, name)
+}
+
+// LintRuleNames returns the sorted names of the registered lint rules.
+func LintRuleNames() []string {
+	lintRulesMutex.RLock()
+	defer lintRulesMutex.RUnlock()
+
+	names := make([]string, 0, len(lintRules))
+	for name := range lintRules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Lint runs all registered lint rules against the service in the order of
+// their names. The issues without a severity are warnings.
+func (s *Service) Lint(instanceSpecs []*ServiceInstanceSpec) *LintReport {
+	lintRulesMutex.RLock()
+	defer lintRulesMutex.RUnlock()
+
+	names := make([]string, 0, len(lintRules))
+	for name := range lintRules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	report := &LintReport{
+		Warnings: []*LintIssue{},
+		Errors:   []*LintIssue{},
+	}
+	for _, name := range names {
+		for _, issue := range lintRules[name].Lint(s, instanceSpecs) {
+			issue.Rule = name
+			if issue.Severity == LintError {
+				report.Errors = append(report.Errors, issue)
+			} else {
+				issue.Severity = LintWarning
+				report.Warnings = append(report.Warnings, issue)
+			}
+		}
+	}
+
+	return report
+}
+
+// Failed reports whether the report has any errors.
+func (r *LintReport) Failed() bool {
+	return len(r.Errors) != 0
+}
+
+func lintCircuitBreakerWithoutTimeLimiter(s *Service, _ []*ServiceInstanceSpec) []*LintIssue {
+	if s.Resilience == nil || s.Resilience.CircuitBreaker == nil || s.Resilience.TimeLimiter != nil {
+		return nil
+	}
+
+	return []*LintIssue{{
+		Severity: LintWarning,
+		Message: "circuit breaker without time limiter: hanging calls are never counted " +
+			"as failures, so the circuit doesn't open while the upstream hangs",
+	}}
+}
+
+func lintRetryerWithoutBudget(s *Service, _ []*ServiceInstanceSpec) []*LintIssue {
+	if s.Resilience == nil || s.Resilience.Retryer == nil || s.Resilience.Retryer.Budget != nil {
+		return nil
+	}
+
+	return []*LintIssue{{
+		Severity: LintWarning,
+		Message:  "retryer without retry budget: retries could amplify the load during an incident",
+	}}
+}
+
+func lintCanaryRuleWithoutLabels(s *Service, _ []*ServiceInstanceSpec) []*LintIssue {
+	if s.Canary == nil {
+		return nil
+	}
+
+	issues := []*LintIssue{}
+	for i, rule := range s.Canary.CanaryRules {
+		if len(rule.ServiceInstanceLabels) == 0 {
+			issues = append(issues, &LintIssue{
+				Severity: LintError,
+				Message: fmt.Sprintf("canary rule %d has no service instance labels: "+
+					"its candidate pool is always empty and the rule is dropped", i),
+			})
+		}
+	}
+
+	return issues
+}
+
+// lintCanaryRuleEmptyPool reports the rules whose candidate pools are empty
+// with the current instances, including the ones whose instances are all
+// served by earlier rules, they're dropped from the generated pipelines
+// and their requests go to the main pool, the same as appendProxyWithCanary.
+func lintCanaryRuleEmptyPool(s *Service, instanceSpecs []*ServiceInstanceSpec) []*LintIssue {
+	if s.Canary == nil || len(instanceSpecs) == 0 {
+		return nil
+	}
+
+	// NOTE: Only the rules without source services claim their instances
+	// here, the others may not apply to the callers.
+	issues := []*LintIssue{}
+	claimed := make(map[*ServiceInstanceSpec]bool)
+	for i, rule := range s.Canary.CanaryRules {
+		if len(rule.ServiceInstanceLabels) == 0 {
+			continue
+		}
+
+		matched := false
+		for _, ins := range instanceSpecs {
+			if ins.Status != ServiceStatusUp || !rule.matchInstance(ins) {
+				continue
+			}
+			if !claimed[ins] {
+				matched = true
+			}
+			if len(rule.SourceServices) == 0 {
+				claimed[ins] = true
+			}
+		}
+		if !matched {
+			issues = append(issues, &LintIssue{
+				Severity: LintWarning,
+				Message: fmt.Sprintf("canary rule %d matches no UP instance left by earlier rules: its candidate pool "+
+					"is empty and its requests go to the main pool", i),
+			})
+		}
+	}
+
+	return issues
+}
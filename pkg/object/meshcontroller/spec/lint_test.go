@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/filter/circuitbreaker"
+	"github.com/megaease/easegress/pkg/filter/retryer"
+	"github.com/megaease/easegress/pkg/filter/timelimiter"
+)
+
+func lintRuleNames(issues []*LintIssue) []string {
+	names := []string{}
+	for _, issue := range issues {
+		names = append(names, issue.Rule)
+	}
+	return names
+}
+
+func TestLintResilience(t *testing.T) {
+	s := &Service{
+		Name: "order-001",
+		Resilience: &Resilience{
+			CircuitBreaker: &circuitbreaker.Spec{},
+			Retryer:        &retryer.Spec{},
+		},
+	}
+
+	report := s.Lint(nil)
+	if report.Failed() {
+		t.Errorf("want no errors, got %v", lintRuleNames(report.Errors))
+	}
+	names := lintRuleNames(report.Warnings)
+	if len(names) != 2 || names[0] != "circuit-breaker-without-time-limiter" || names[1] != "retryer-without-budget" {
+		t.Errorf("want warnings of time limiter and retry budget, got %v", names)
+	}
+	for _, issue := range report.Warnings {
+		if issue.Severity != LintWarning {
+			t.Errorf("want severity %s, got %s", LintWarning, issue.Severity)
+		}
+	}
+
+	s.Resilience.TimeLimiter = &timelimiter.Spec{}
+	s.Resilience.Retryer.Budget = &retryer.Budget{MaxRetryRatio: 0.1}
+	report = s.Lint(nil)
+	if len(report.Warnings) != 0 || len(report.Errors) != 0 {
+		t.Errorf("want no issues, got %v %v", lintRuleNames(report.Warnings), lintRuleNames(report.Errors))
+	}
+}
+
+func TestLintCanaryRules(t *testing.T) {
+	s := &Service{
+		Name: "order-001",
+		Canary: &Canary{
+			CanaryRules: []*CanaryRule{
+				{ServiceInstanceLabels: map[string]string{}},
+				{ServiceInstanceLabels: map[string]string{"version": "v2"}},
+				{ServiceInstanceLabels: map[string]string{"version": "v3"}},
+			},
+		},
+	}
+
+	instanceSpecs := []*ServiceInstanceSpec{
+		{ServiceName: "order-001", InstanceID: "a", Status: ServiceStatusUp},
+		{ServiceName: "order-001", InstanceID: "b", Status: ServiceStatusUp, Labels: map[string]string{"version": "v2"}},
+		{ServiceName: "order-001", InstanceID: "c", Status: ServiceStatusOutOfService, Labels: map[string]string{"version": "v3"}},
+	}
+
+	report := s.Lint(instanceSpecs)
+	if !report.Failed() || len(report.Errors) != 1 || report.Errors[0].Rule != "canary-rule-without-labels" {
+		t.Errorf("want error of canary rule without labels, got %v", lintRuleNames(report.Errors))
+	}
+	if len(report.Warnings) != 1 || report.Warnings[0].Rule != "canary-rule-empty-pool" {
+		t.Fatalf("want warning of canary rule empty pool, got %v", lintRuleNames(report.Warnings))
+	}
+
+	// the instances of a rule are all served by an earlier one
+	s.Canary.CanaryRules[2].ServiceInstanceLabels = map[string]string{"version": "v2"}
+	report = s.Lint(instanceSpecs)
+	if len(report.Warnings) != 1 || !strings.Contains(report.Warnings[0].Message, "canary rule 2") {
+		t.Errorf("want warning of the shadowed canary rule, got %v", report.Warnings)
+	}
+
+	// NOTE: Without instances, the candidate pools are unknown.
+	report = s.Lint(nil)
+	if len(report.Warnings) != 0 {
+		t.Errorf("want no warnings without instances, got %v", lintRuleNames(report.Warnings))
+	}
+}
+
+func TestRegisterLintRule(t *testing.T) {
+	rule := NewLintRule("test-service-name", func(s *Service, _ []*ServiceInstanceSpec) []*LintIssue {
+		if s.Name == "order-001" {
+			return []*LintIssue{{Severity: LintError, Message: "reserved name"}, {Message: "no severity"}}
+		}
+		return nil
+	})
+	RegisterLintRule(rule)
+	defer UnregisterLintRule(rule.Name())
+
+	found := false
+	for _, name := range LintRuleNames() {
+		if name == rule.Name() {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("lint rule %s not registered", rule.Name())
+	}
+
+	report := (&Service{Name: "order-001"}).Lint(nil)
+	if len(report.Errors) != 1 || report.Errors[0].Rule != rule.Name() {
+		t.Errorf("want error of %s, got %v", rule.Name(), lintRuleNames(report.Errors))
+	}
+	if len(report.Warnings) != 1 || report.Warnings[0].Severity != LintWarning {
+		t.Errorf("want the issue without severity as warning, got %v", report.Warnings)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("want panic for duplicated lint rule")
+			}
+		}()
+		RegisterLintRule(rule)
+	}()
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"github.com/megaease/easegress/pkg/filter/proxy"
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	// ServiceSpecVersion is the current version of the service spec.
+	// The specs stored without version are version 1.
+	ServiceSpecVersion = 2
+)
+
+type (
+	// serviceMigration upgrades the service spec from version to version+1,
+	// it must be idempotent.
+	serviceMigration struct {
+		version     int
+		description string
+		migrate     func(s *Service)
+	}
+)
+
+// NOTE: Append the migration when the shape of the service spec changes,
+// and bump ServiceSpecVersion.
+var serviceMigrations = []*serviceMigration{
+	{
+		version:     1,
+		description: "default observability and load balance",
+		migrate: func(s *Service) {
+			if s.Observability == nil {
+				s.Observability = &Observability{}
+			}
+			if s.LoadBalance == nil {
+				s.LoadBalance = &LoadBalance{Policy: proxy.PolicyRoundRobin}
+			}
+		},
+	},
+}
+
+// MigrateService upgrades the service spec to the current version in place,
+// it reports whether any migration runs. The spec of current version or
+// newer is left untouched.
+func MigrateService(s *Service) bool {
+	version := s.SpecVersion
+	if version == 0 {
+		version = 1
+	}
+	if version >= ServiceSpecVersion {
+		return false
+	}
+
+	for _, m := range serviceMigrations {
+		if m.version < version {
+			continue
+		}
+		m.migrate(s)
+		logger.Infof("migrate spec of service %s from version %d to %d: %s",
+			s.Name, m.version, m.version+1, m.description)
+	}
+	s.SpecVersion = ServiceSpecVersion
+
+	return true
+}
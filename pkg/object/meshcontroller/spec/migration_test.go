@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/filter/proxy"
+	"github.com/megaease/easegress/pkg/v"
+)
+
+func TestMigrateService(t *testing.T) {
+	const v1Spec = `
+name: order-001
+registerTenant: tenant-001
+sidecar:
+  discoveryType: eureka
+  address: 127.0.0.1
+  ingressPort: 13001
+  ingressProtocol: http
+  egressPort: 13002
+  egressProtocol: http
+`
+	s := &Service{}
+	if err := yaml.Unmarshal([]byte(v1Spec), s); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+
+	if !MigrateService(s) {
+		t.Fatalf("spec without version should be migrated")
+	}
+	if s.SpecVersion != ServiceSpecVersion {
+		t.Errorf("want spec version %d, got %d", ServiceSpecVersion, s.SpecVersion)
+	}
+	if s.Observability == nil {
+		t.Errorf("observability should be defaulted")
+	}
+	if s.LoadBalance == nil || s.LoadBalance.Policy != proxy.PolicyRoundRobin {
+		t.Errorf("load balance should be defaulted to %s", proxy.PolicyRoundRobin)
+	}
+	if vr := v.Validate(s); !vr.Valid() {
+		t.Errorf("migrated spec should be valid: %v", vr.Error())
+	}
+
+	migrated := *s
+	if MigrateService(s) {
+		t.Errorf("spec of current version should not be migrated")
+	}
+	if !reflect.DeepEqual(&migrated, s) {
+		t.Errorf("migration should be idempotent")
+	}
+
+	s = &Service{
+		Name:        "order-002",
+		LoadBalance: &LoadBalance{Policy: proxy.PolicyRandom},
+	}
+	MigrateService(s)
+	if s.LoadBalance.Policy != proxy.PolicyRandom {
+		t.Errorf("existing load balance should be kept, got %s", s.LoadBalance.Policy)
+	}
+
+	s = &Service{Name: "order-003", SpecVersion: ServiceSpecVersion + 1}
+	if MigrateService(s) {
+		t.Errorf("spec of newer version should not be migrated")
+	}
+	if s.Observability != nil || s.LoadBalance != nil || s.SpecVersion != ServiceSpecVersion+1 {
+		t.Errorf("spec of newer version should be untouched")
+	}
+}
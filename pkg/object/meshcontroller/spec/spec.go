@@ -18,21 +18,46 @@
 package spec
 
 import (
-	"bytes"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
-
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xeipuuv/gojsonschema"
 	"gopkg.in/yaml.v2"
 
+	"github.com/megaease/easegress/pkg/filter/accesslogger"
+	"github.com/megaease/easegress/pkg/filter/bodylimiter"
 	"github.com/megaease/easegress/pkg/filter/circuitbreaker"
+	"github.com/megaease/easegress/pkg/filter/corsadaptor"
+	"github.com/megaease/easegress/pkg/filter/faultinjector"
+	"github.com/megaease/easegress/pkg/filter/headerpropagator"
 	"github.com/megaease/easegress/pkg/filter/mock"
 	"github.com/megaease/easegress/pkg/filter/proxy"
 	"github.com/megaease/easegress/pkg/filter/ratelimiter"
+	"github.com/megaease/easegress/pkg/filter/requestadaptor"
+	"github.com/megaease/easegress/pkg/filter/responseadaptor"
 	"github.com/megaease/easegress/pkg/filter/retryer"
 	"github.com/megaease/easegress/pkg/filter/timelimiter"
+	"github.com/megaease/easegress/pkg/filter/tracepropagator"
+	"github.com/megaease/easegress/pkg/filter/validator"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/object/httpserver"
 	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/tracing/propagation"
+	"github.com/megaease/easegress/pkg/tracing/zipkin"
 	"github.com/megaease/easegress/pkg/util/httpfilter"
+	"github.com/megaease/easegress/pkg/util/httpheader"
 	"github.com/megaease/easegress/pkg/util/urlrule"
 )
 
@@ -54,14 +79,92 @@ const (
 	// ServiceStatusOutOfService indicates this service instance can't accept ingress traffic
 	ServiceStatusOutOfService = "OUT_OF_SERVICE"
 
+	// ServiceStatusDraining indicates this service instance is shutting down,
+	// it doesn't accept new traffic but finishes the in-flight requests.
+	ServiceStatusDraining = "DRAINING"
+
+	// SidecarProtocolGRPC is the sidecar ingress protocol of gRPC services.
+	SidecarProtocolGRPC = "grpc"
+
+	// InstanceIDConflictPolicyReplace replaces the existing instance with a warning.
+	InstanceIDConflictPolicyReplace = "replace"
+	// InstanceIDConflictPolicyReject rejects the registration.
+	InstanceIDConflictPolicyReject = "reject"
+
+	// NacosDefaultNamespace is the default namespace of Nacos.
+	NacosDefaultNamespace = "public"
+	// NacosDefaultGroup is the default group of Nacos.
+	NacosDefaultGroup = "DEFAULT_GROUP"
+
 	// WorkerAPIPort is the default port for worker's API server
 	WorkerAPIPort = 13009
 
 	// IngressPort is the default port for ingress controller
 	IngressPort = 13010
 
+	// IngressHTTPSPort is the default port for the ingresses enabling TLS
+	IngressHTTPSPort = 13011
+
 	// HeartbeatInterval is the default heartbeat interval for checking service heartbeat
 	HeartbeatInterval = "5s"
+
+	// MetricsOutputKafka sends metrics to kafka topics.
+	MetricsOutputKafka = "kafka"
+	// MetricsOutputStatsD sends metrics to a StatsD server over UDP.
+	MetricsOutputStatsD = "statsd"
+
+	// AccessLogOutputStdout writes access logs to the standard output of the sidecar.
+	AccessLogOutputStdout = "stdout"
+	// AccessLogOutputServer sends access logs to the kafka of the output server.
+	AccessLogOutputServer = "outputServer"
+	// DefaultAccessLogTopic is the default kafka topic of access logs.
+	DefaultAccessLogTopic = "log-access"
+
+	// EgressServiceHeader is the header carrying the target service name of
+	// the egress request.
+	EgressServiceHeader = "X-Mesh-Rpc-Service"
+
+	// DefaultMaxCanaryRules is the default maximum number of canary rules of one service,
+	// each canary rule generates at most one candidate pool in the proxy filter.
+	DefaultMaxCanaryRules = 32
+
+	// InstanceSchemeHTTP is the scheme of instances serving plain HTTP.
+	InstanceSchemeHTTP = "http"
+	// InstanceSchemeHTTPS is the scheme of instances terminating TLS themselves.
+	InstanceSchemeHTTPS = "https"
+
+	// CanaryPoolNamePrefix is the name prefix of the candidate pools
+	// generated from canary rules, followed by the rule index.
+	CanaryPoolNamePrefix = "canary-rule-"
+
+	// DefaultCanaryBypassHeader is the default header forcing the requests
+	// to the main instances even if they match canary rules.
+	DefaultCanaryBypassHeader = "X-Mesh-Canary-Bypass"
+
+	// DefaultDeadlineHeader is the default header carrying the remaining
+	// time budget of the requests.
+	DefaultDeadlineHeader = "X-Mesh-Deadline"
+
+	// IngressHTTPServerName is the name of the HTTP server of mesh ingress.
+	IngressHTTPServerName = "mesh-ingress-server"
+	// IngressHTTPSServerName is the name of the HTTPS server of mesh
+	// ingress, which serves the ingresses enabling TLS.
+	IngressHTTPSServerName = "mesh-ingress-https-server"
+
+	// DefaultServiceRetention is the default duration the soft-deleted
+	// services are kept before hard deletion.
+	DefaultServiceRetention = 72 * time.Hour
+
+	// NoAvailableInstancesFilterName is the name of the filter responding
+	// the requests to the services without UP instances.
+	NoAvailableInstancesFilterName = "noAvailableInstances"
+
+	// FallbackFilterName is the name of the proxy sending the requests to
+	// the fallback of the services without UP instances.
+	FallbackFilterName = "fallback"
+	// FallbackHeader carries the name of the service whose requests are
+	// sent to its fallback.
+	FallbackHeader = "X-Mesh-Fallback"
 )
 
 var (
@@ -73,8 +176,21 @@ var (
 	ErrNoRegisteredYet = fmt.Errorf("service not registered yet")
 	// ErrServiceNotFound indicates could find target service in its tenant or in global tenant
 	ErrServiceNotFound = fmt.Errorf("can't find service in its tenant or in global tenant")
-	// ErrServiceNotavailable indicates could find target service's available instances.
-	ErrServiceNotavailable = fmt.Errorf("can't find service available instances")
+	// ErrServiceNotavailable indicates the target service has no available instances.
+	ErrServiceNotavailable = fmt.Errorf("no available instances for service")
+	// ErrRegistryTenantNotFound indicates could find the tenant the service registered into.
+	ErrRegistryTenantNotFound = fmt.Errorf("can't find service's registry tenant")
+	// ErrSelfServiceNotFound indicates could find the spec of the service itself.
+	ErrSelfServiceNotFound = fmt.Errorf("can't find self service spec")
+	// ErrNacosScopeMismatch indicates the Nacos namespace or group isn't the one of the mesh.
+	ErrNacosScopeMismatch = fmt.Errorf("nacos namespace or group mismatch")
+	// ErrInstanceIDConflict indicates the instance ID has been registered with another address.
+	ErrInstanceIDConflict = fmt.Errorf("instance ID registered with different address")
+
+	// rewriteReferenceRegexp matches the references in the template of regexp.Expand.
+	rewriteReferenceRegexp = regexp.MustCompile(`\$\$|\$\{([a-zA-Z0-9_]+)\}|\$([a-zA-Z0-9_]+)`)
+
+	hostnameRegexp = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9\-]{0,61}[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9\-]{0,61}[A-Za-z0-9])?)*$`)
 )
 
 type (
@@ -90,8 +206,50 @@ type (
 
 		// IngressPort is the port for http server in mesh ingress
 		IngressPort int `yaml:"ingressPort" jsonschema:"required"`
+		// IngressHTTPSPort is the port for https server in mesh ingress, it
+		// serves the ingresses enabling TLS, zero means IngressHTTPSPort.
+		IngressHTTPSPort int `yaml:"ingressHTTPSPort" jsonschema:"omitempty,minimum=0,maximum=65535"`
 
 		ExternalServiceRegistry string `yaml:"externalServiceRegistry" jsonschema:"omitempty"`
+
+		// MaxCanaryRules is the maximum number of canary rules of one service,
+		// zero means using DefaultMaxCanaryRules.
+		MaxCanaryRules int `yaml:"maxCanaryRules" jsonschema:"omitempty,minimum=0"`
+
+		// InstanceIDConflictPolicy decides what to do when an instance registers
+		// with an existing instance ID but a different address, default is replace.
+		InstanceIDConflictPolicy string `yaml:"instanceIDConflictPolicy" jsonschema:"omitempty,enum=,enum=replace,enum=reject"`
+
+		// Nacos is the namespace and group the mesh services belong to when
+		// the registry type is nacos.
+		Nacos *NacosScope `yaml:"nacos" jsonschema:"omitempty"`
+
+		// ResolveSidecarAddress makes the admin API reject services whose
+		// sidecar address is a hostname failing DNS resolution.
+		ResolveSidecarAddress bool `yaml:"resolveSidecarAddress" jsonschema:"omitempty"`
+
+		// MTLS is the config of the mesh CA issuing the certificates of the
+		// sidecars enabling mTLS.
+		MTLS *MTLS `yaml:"mtls" jsonschema:"omitempty"`
+
+		// ServiceRetention is the duration the soft-deleted services are
+		// kept for restoring before hard deletion, default is 72h.
+		ServiceRetention string `yaml:"serviceRetention" jsonschema:"omitempty,format=duration"`
+	}
+
+	// MTLS is the config of the mesh CA.
+	MTLS struct {
+		// CertTTL is the lifetime of the service certificates, default is
+		// 24h, they are renewed after two thirds of it.
+		CertTTL string `yaml:"certTTL" jsonschema:"omitempty,format=duration"`
+	}
+
+	// NacosScope is the Nacos namespace and group of the mesh services.
+	NacosScope struct {
+		// Namespace is the namespace ID, default is public.
+		Namespace string `yaml:"namespace" jsonschema:"omitempty"`
+		// Group is the group name, default is DEFAULT_GROUP.
+		Group string `yaml:"group" jsonschema:"omitempty"`
 	}
 
 	// Service contains the information of service.
@@ -103,12 +261,108 @@ type (
 		Name           string `yaml:"name" jsonschema:"required"`
 		RegisterTenant string `yaml:"registerTenant" jsonschema:"required"`
 
+		// Aliases are the other names the service is discovered and called
+		// by, e.g. its old name during a rename. The instances, pipelines
+		// and servers keep the canonical name.
+		Aliases []string `yaml:"aliases,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+
+		// AllowedCallers are the services of other tenants granted to
+		// discover and call the service, without making it global.
+		AllowedCallers []string `yaml:"allowedCallers,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+
+		// SpecVersion is the version of the spec shape, the older specs are
+		// migrated to ServiceSpecVersion on reading, zero means version 1.
+		SpecVersion int `yaml:"specVersion,omitempty" jsonschema:"omitempty,minimum=0"`
+
+		// CreatedAt and UpdatedAt are set by the mesh controller on writing,
+		// the values from clients are ignored.
+		// Format: RFC3339
+		CreatedAt string `yaml:"createdAt,omitempty" jsonschema:"omitempty"`
+		UpdatedAt string `yaml:"updatedAt,omitempty" jsonschema:"omitempty"`
+		// DeletedAt is set when the service is soft-deleted, the service is
+		// hidden from discovery and pipeline generation until it's restored
+		// or hard-deleted after the retention.
+		// Format: RFC3339
+		DeletedAt string `yaml:"deletedAt,omitempty" jsonschema:"omitempty"`
+
 		Sidecar       *Sidecar       `yaml:"sidecar" jsonschema:"required"`
 		Mock          *Mock          `yaml:"mock" jsonschema:"omitempty"`
 		Resilience    *Resilience    `yaml:"resilience" jsonschema:"omitempty"`
 		Canary        *Canary        `yaml:"canary" jsonschema:"omitempty"`
 		LoadBalance   *LoadBalance   `yaml:"loadBalance" jsonschema:"omitempty"`
 		Observability *Observability `yaml:"observability" jsonschema:"omitempty"`
+		Limits        *Limits        `yaml:"limits" jsonschema:"omitempty"`
+		Mirror        *Mirror        `yaml:"mirror" jsonschema:"omitempty"`
+		HealthCheck   *HealthCheck   `yaml:"healthCheck" jsonschema:"omitempty"`
+
+		// Compression compresses the responses of the service in the sidecar
+		// ingress and mesh ingress pipelines by the Accept-Encoding header.
+		Compression *Compression `yaml:"compression" jsonschema:"omitempty"`
+
+		// ConnectionPool limits the connections from the proxies to the
+		// instances of the service, zero values keep the default settings.
+		ConnectionPool *ConnectionPool `yaml:"connectionPool" jsonschema:"omitempty"`
+
+		// FaultInjection injects aborts and delays into the requests in the
+		// sidecar ingress for chaos testing, the others reach the application.
+		FaultInjection *FaultInjection `yaml:"faultInjection" jsonschema:"omitempty"`
+
+		// Authentication authenticates the requests in the sidecar ingress,
+		// the failed ones get 401 before reaching the application.
+		Authentication *Authentication `yaml:"authentication" jsonschema:"omitempty"`
+
+		// CanaryPropagation propagates the canary headers from the requests
+		// the service receives to the requests it sends.
+		CanaryPropagation *CanaryPropagation `yaml:"canaryPropagation" jsonschema:"omitempty"`
+
+		// DeadlinePropagation propagates the time budget of the requests the
+		// service receives to the requests it sends, minus the time elapsed.
+		DeadlinePropagation *DeadlinePropagation `yaml:"deadlinePropagation" jsonschema:"omitempty"`
+
+		// HeaderManipulation adapts the headers in the sidecar pipelines.
+		HeaderManipulation *HeaderManipulation `yaml:"headerManipulation" jsonschema:"omitempty"`
+
+		// EgressRoutes route the egress requests without EgressServiceHeader
+		// to the target services by host or path prefix.
+		EgressRoutes []*EgressRoute `yaml:"egressRoutes" jsonschema:"omitempty"`
+
+		// Fallback serves the egress requests to the service when it has no
+		// UP instances, instead of responding 503.
+		Fallback *Fallback `yaml:"fallback,omitempty" jsonschema:"omitempty"`
+
+		// DegradationProfiles are the pre-planned degraded modes of the service.
+		DegradationProfiles []*DegradationProfile `yaml:"degradationProfiles" jsonschema:"omitempty"`
+		// ActiveDegradationProfile is the name of the activated degradation profile,
+		// empty means the service works normally.
+		ActiveDegradationProfile string `yaml:"activeDegradationProfile" jsonschema:"omitempty"`
+
+		// redactReferences redacts the ${env:NAME} and ${secret:name}
+		// references instead of resolving them in the generated specs.
+		redactReferences bool
+	}
+
+	// DegradationProfile is a named degraded mode of the service, which can be
+	// activated during incidents.
+	DegradationProfile struct {
+		Name string `yaml:"name" jsonschema:"required"`
+
+		// MockRules respond static contents, they take precedence over the service mock rules.
+		MockRules []*mock.Rule `yaml:"mockRules" jsonschema:"omitempty"`
+		// DisableCanary routes all traffic to the main instances.
+		DisableCanary bool `yaml:"disableCanary" jsonschema:"omitempty"`
+		// DisableRetryer stops retrying to reduce the load of the service.
+		DisableRetryer bool `yaml:"disableRetryer" jsonschema:"omitempty"`
+	}
+
+	// Fallback is the backend of the service without UP instances, it's
+	// either a static URL or another mesh service.
+	Fallback struct {
+		// URL is the scheme and host of the backend, e.g. a maintenance
+		// page server, the requests keep their paths.
+		URL string `yaml:"url,omitempty" jsonschema:"omitempty,format=uri"`
+		// Service is the mesh service serving as the backend, the requests
+		// go to its UP instances without canary.
+		Service string `yaml:"service,omitempty" jsonschema:"omitempty"`
 	}
 
 	// Mock is the spec of configured and static API responses for this service.
@@ -126,18 +380,114 @@ type (
 		CircuitBreaker *circuitbreaker.Spec `yaml:"circuitBreaker" jsonschema:"omitempty"`
 		Retryer        *retryer.Spec        `yaml:"retryer" jsonschema:"omitempty"`
 		TimeLimiter    *timelimiter.Spec    `yaml:"timeLimiter" jsonschema:"omitempty"`
+
+		OutlierDetection *OutlierDetection `yaml:"outlierDetection" jsonschema:"omitempty"`
+	}
+
+	// Mirror is the spec of egress traffic mirroring, a copy of the sampled
+	// requests is sent to the instances with all the labels, and their
+	// responses are discarded.
+	Mirror struct {
+		ServiceInstanceLabels map[string]string `yaml:"serviceInstanceLabels" jsonschema:"required"`
+		Percentage            uint32            `yaml:"percentage" jsonschema:"required,minimum=1,maximum=100"`
+	}
+
+	// HealthCheck is the spec of active health checks, the sidecar probes its
+	// application and marks the instance OUT_OF_SERVICE after UnhealthyThreshold
+	// consecutive failures, it's marked UP again after a successful probe.
+	// The gRPC Health Checking Protocol is used if the sidecar ingress
+	// protocol is grpc, otherwise the HTTP GET of Path is used.
+	HealthCheck struct {
+		// Path is the HTTP health path, required unless probing with gRPC.
+		Path string `yaml:"path" jsonschema:"omitempty,pattern=^/"`
+		// GRPCService is the service name in gRPC health check requests,
+		// default is empty which checks the overall health of the server.
+		GRPCService string `yaml:"grpcService" jsonschema:"omitempty"`
+		// Interval is the interval between two probes, default is 10s.
+		Interval string `yaml:"interval" jsonschema:"omitempty,format=duration"`
+		// UnhealthyThreshold is the number of consecutive failures, default is 3.
+		UnhealthyThreshold int `yaml:"unhealthyThreshold" jsonschema:"omitempty,minimum=1"`
+	}
+
+	// CanaryPropagation is the spec of canary header propagation across the
+	// application, which must propagate the correlation header.
+	CanaryPropagation struct {
+		// Headers overrides the propagated headers, default is the canary headers of the service.
+		Headers []string `yaml:"headers" jsonschema:"omitempty,uniqueItems=true"`
+		// CorrelationHeader correlates the ingress and egress requests, default is X-B3-TraceId.
+		CorrelationHeader string `yaml:"correlationHeader" jsonschema:"omitempty"`
+		// TTL is how long the headers of an ingress request are kept, default is 1m.
+		TTL string `yaml:"ttl" jsonschema:"omitempty,format=duration"`
+	}
+
+	// DeadlinePropagation is the spec of the time budget propagation across
+	// the application, like CanaryPropagation, the application must propagate
+	// the correlation header.
+	DeadlinePropagation struct {
+		// Header carries the remaining time budget, e.g. 800ms, default is X-Mesh-Deadline.
+		Header string `yaml:"header" jsonschema:"omitempty"`
+		// Floor is the minimum time budget of the egress requests, the ones
+		// with less time left get 504 without being sent.
+		Floor string `yaml:"floor" jsonschema:"omitempty,format=duration"`
+		// CorrelationHeader correlates the ingress and egress requests, default is X-B3-TraceId.
+		CorrelationHeader string `yaml:"correlationHeader" jsonschema:"omitempty"`
+		// TTL is how long the deadline of an ingress request is kept, default is 1m.
+		TTL string `yaml:"ttl" jsonschema:"omitempty,format=duration"`
+	}
+
+	// HeaderManipulation adapts the headers in the sidecar ingress pipeline of
+	// the service, and in the sidecar egress pipelines of the service to others.
+	HeaderManipulation struct {
+		Ingress *HeaderRules `yaml:"ingress" jsonschema:"omitempty"`
+		Egress  *HeaderRules `yaml:"egress" jsonschema:"omitempty"`
+	}
+
+	// HeaderRules adapts the headers of requests and responses, the removals
+	// run before the sets, then the adds. Set replaces the existing values of
+	// the header, while Add appends a value to them.
+	HeaderRules struct {
+		Request  *httpheader.AdaptSpec `yaml:"request" jsonschema:"omitempty"`
+		Response *httpheader.AdaptSpec `yaml:"response" jsonschema:"omitempty"`
+	}
+
+	// EgressRoute routes the egress requests matching both the host and the
+	// path prefix to the target service, at least one of them is required.
+	EgressRoute struct {
+		Service    string `yaml:"service" jsonschema:"required"`
+		Host       string `yaml:"host" jsonschema:"omitempty"`
+		PathPrefix string `yaml:"pathPrefix" jsonschema:"omitempty,pattern=^/"`
 	}
 
 	// Canary is the spec of service canary.
 	Canary struct {
 		CanaryRules []*CanaryRule `yaml:"canaryRules" jsonschema:"omitempty"`
+		Bypass      *CanaryBypass `yaml:"bypass,omitempty" jsonschema:"omitempty"`
+	}
+
+	// CanaryBypass is the spec of the header forcing the requests to the
+	// main instances, it beats all canary rules and never reaches the
+	// instances.
+	CanaryBypass struct {
+		// Header is the name of the bypass header, default is X-Mesh-Canary-Bypass.
+		Header string `yaml:"header" jsonschema:"omitempty"`
 	}
 
-	// CanaryRule is one matching rule for canary.
+	// CanaryRule is one matching rule for canary, a request matches it if
+	// it matches all of the specified criteria. The rules are prioritized
+	// by their order, an instance matching the labels of several rules is
+	// served only by the first of them, so it's in at most one pool.
 	CanaryRule struct {
 		ServiceInstanceLabels map[string]string               `yaml:"serviceInstanceLabels" jsonschema:"required"`
-		Headers               map[string]*urlrule.StringMatch `yaml:"headers" jsonschema:"required"`
-		URLs                  []*urlrule.URLRule              `yaml:"urls" jsonschema:"required"`
+		Headers               map[string]*urlrule.StringMatch `yaml:"headers" jsonschema:"omitempty"`
+		URLs                  []*urlrule.URLRule              `yaml:"urls" jsonschema:"omitempty"`
+		// SourceServices are the mesh services whose requests match the rule.
+		// The identity of the caller is the service of its sidecar, which is
+		// the identity of its certificate with mTLS, it's never taken from
+		// the request, so it can't be spoofed by the X-Mesh-Service header.
+		SourceServices []string `yaml:"sourceServices,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+		// SetHeaders are set to the requests matching the rule before they
+		// reach the canary instances, which propagate them as canary headers.
+		SetHeaders map[string]string `yaml:"setHeaders,omitempty" jsonschema:"omitempty"`
 	}
 
 	// GlobalCanaryHeaders is the spec of global service
@@ -148,6 +498,26 @@ type (
 	// LoadBalance is the spec of service load balance.
 	LoadBalance = proxy.LoadBalance
 
+	// OutlierDetection is the spec of service outlier detection in egress.
+	OutlierDetection = proxy.OutlierDetection
+
+	// ConnectionPool is the spec of the connections to service instances.
+	ConnectionPool = proxy.ConnectionPool
+
+	// Authentication is the spec of service authentication in ingress.
+	Authentication struct {
+		JWT *validator.JWTValidatorSpec `yaml:"jwt" jsonschema:"required"`
+	}
+
+	// Compression is the spec of service response compression in ingress.
+	Compression = proxy.CompressionSpec
+
+	// FaultInjection is the spec of service fault injection in ingress.
+	FaultInjection = faultinjector.Spec
+
+	// Limits is the spec of service body size limits in ingress.
+	Limits = bodylimiter.Spec
+
 	// Sidecar is the spec of service sidecar.
 	Sidecar struct {
 		DiscoveryType   string `yaml:"discoveryType" jsonschema:"required"`
@@ -156,6 +526,11 @@ type (
 		IngressProtocol string `yaml:"ingressProtocol" jsonschema:"required"`
 		EgressPort      int    `yaml:"egressPort" jsonschema:"required"`
 		EgressProtocol  string `yaml:"egressProtocol" jsonschema:"required"`
+
+		// MTLS makes the sidecar talk with the other sidecars in mutual TLS
+		// with the certificates issued by the mesh CA. The sidecars with
+		// and without it never talk to each other.
+		MTLS bool `yaml:"mtls" jsonschema:"omitempty"`
 	}
 
 	// Observability is the spec of service observability.
@@ -163,6 +538,28 @@ type (
 		OutputServer *ObservabilityOutputServer `yaml:"outputServer" jsonschema:"omitempty"`
 		Tracings     *ObservabilityTracings     `yaml:"tracings" jsonschema:"omitempty"`
 		Metrics      *ObservabilityMetrics      `yaml:"metrics" jsonschema:"omitempty"`
+		AccessLog    *ObservabilityAccessLog    `yaml:"accessLog,omitempty" jsonschema:"omitempty"`
+	}
+
+	// ObservabilityAccessLog is the access log of observability, the
+	// sidecar ingress logs the sampled requests after they're finished.
+	ObservabilityAccessLog struct {
+		Enabled bool `yaml:"enabled" jsonschema:"required"`
+		// Format is a Go template of the access log entry with the fields
+		// Time, Method, Path, Status, LatencyMs, Upstream, RealIP and
+		// Headers, empty means the entry in JSON.
+		Format     string  `yaml:"format,omitempty" jsonschema:"omitempty"`
+		SampleRate float64 `yaml:"sampleRate" jsonschema:"required,minimum=0,maximum=1"`
+		// HeaderAllowlist are the request headers logged with values, the
+		// values of the others are redacted.
+		HeaderAllowlist []string `yaml:"headerAllowlist,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+		// Output is where the access logs go, default is stdout. The output
+		// server must be enabled to send them to its kafka, the logs are
+		// buffered by the sidecar within the QueuedMaxSpans and QueuedMaxSize
+		// of the tracings output, the oldest ones are dropped beyond them.
+		Output string `yaml:"output,omitempty" jsonschema:"omitempty,enum=,enum=stdout,enum=outputServer"`
+		// Topic is the kafka topic of the output server, default is log-access.
+		Topic string `yaml:"topic,omitempty" jsonschema:"omitempty"`
 	}
 
 	// ObservabilityOutputServer is the output server of observability.
@@ -170,6 +567,25 @@ type (
 		Enabled         bool   `yaml:"enabled" jsonschema:"required"`
 		BootstrapServer string `yaml:"bootstrapServer" jsonschema:"required"`
 		Timeout         int    `yaml:"timeout" jsonschema:"required"`
+
+		ObservabilityOutputServerSecurity `yaml:",inline"`
+	}
+
+	// ObservabilityOutputServerSecurity is the authentication and encryption
+	// of the connections to the output server, they're plaintext without
+	// authentication by default.
+	ObservabilityOutputServerSecurity struct {
+		// SASLMechanism authenticates the connections to the kafka, empty
+		// means no authentication.
+		SASLMechanism string `yaml:"saslMechanism,omitempty" jsonschema:"omitempty,enum=,enum=PLAIN,enum=SCRAM-SHA-256,enum=SCRAM-SHA-512"`
+		SASLUsername  string `yaml:"saslUsername,omitempty" jsonschema:"omitempty"`
+		// SASLPassword must be a reference to a mesh secret, e.g.
+		// ${secret:kafka-password}, it's never stored in plain text.
+		SASLPassword string `yaml:"saslPassword,omitempty" jsonschema:"omitempty"`
+		// TLSEnabled encrypts the connections to the kafka, the brokers
+		// are verified by CACertBase64, or the system CAs if it's empty.
+		TLSEnabled   bool   `yaml:"tlsEnabled,omitempty" jsonschema:"omitempty"`
+		CACertBase64 string `yaml:"caCertBase64,omitempty" jsonschema:"omitempty,format=base64"`
 	}
 
 	// ObservabilityTracings is the tracings of observability.
@@ -178,6 +594,23 @@ type (
 		SampleByQPS int                               `yaml:"sampleByQPS" jsonschema:"required"`
 		Output      ObservabilityTracingsOutputConfig `yaml:"output" jsonschema:"required"`
 
+		// AlwaysSampleOnError makes the sidecar ingress sample the requests
+		// ended in 5xx regardless of SampleByQPS, the decision is made when
+		// they finish, and the spans go to the topic of the output server.
+		// It requires the output server and the tracings output enabled.
+		AlwaysSampleOnError bool `yaml:"alwaysSampleOnError" jsonschema:"omitempty"`
+		// AlwaysSampleAboveLatencyMs makes the sidecar ingress sample the
+		// requests whose latency exceeds it in the same way, zero means
+		// disabled.
+		AlwaysSampleAboveLatencyMs int `yaml:"alwaysSampleAboveLatencyMs" jsonschema:"omitempty,minimum=0"`
+
+		// Propagation selects the formats of the trace context translated by
+		// the sidecar, nil means the trace context is passed through as is.
+		Propagation *ObservabilityTracingsPropagation `yaml:"propagation,omitempty" jsonschema:"omitempty"`
+		// Baggage is the W3C baggage propagated from the ingress requests to
+		// the egress requests by the sidecar.
+		Baggage *ObservabilityTracingsBaggage `yaml:"baggage,omitempty" jsonschema:"omitempty"`
+
 		Request      ObservabilityTracingsDetail `yaml:"request" jsonschema:"required"`
 		RemoteInvoke ObservabilityTracingsDetail `yaml:"remoteInvoke" jsonschema:"required"`
 		Kafka        ObservabilityTracingsDetail `yaml:"kafka" jsonschema:"required"`
@@ -186,15 +619,48 @@ type (
 		Rabbit       ObservabilityTracingsDetail `yaml:"rabbit" jsonschema:"required"`
 	}
 
+	// ObservabilityTracingsPropagation is the trace context propagation of
+	// tracings, the sidecar accepts the trace context of the requests in
+	// any of the Accept formats, and emits it in the Format only.
+	ObservabilityTracingsPropagation struct {
+		Format string `yaml:"format" jsonschema:"required,enum=b3,enum=tracecontext,enum=jaeger"`
+		// Accept are the incoming formats in order of precedence, empty
+		// means the Format only.
+		Accept []string `yaml:"accept,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+	}
+
+	// ObservabilityTracingsBaggage is the baggage propagation of tracings,
+	// the entries of the keys are recorded at the sidecar ingress, tagged
+	// to the span, and merged into the egress requests of the same trace.
+	ObservabilityTracingsBaggage struct {
+		Keys []string `yaml:"keys" jsonschema:"required,minItems=1,uniqueItems=true"`
+		// MaxKeys and MaxBytes bound the baggage, the entries beyond them
+		// are dropped, default is 16 keys and 1024 bytes.
+		MaxKeys  int `yaml:"maxKeys,omitempty" jsonschema:"omitempty,minimum=0"`
+		MaxBytes int `yaml:"maxBytes,omitempty" jsonschema:"omitempty,minimum=0"`
+		// CorrelationHeader is X-B3-TraceId by default.
+		CorrelationHeader string `yaml:"correlationHeader,omitempty" jsonschema:"omitempty"`
+		// TTL is how long the baggage is kept by the sidecar, default is 1m.
+		TTL string `yaml:"ttl,omitempty" jsonschema:"omitempty,format=duration"`
+		// AllowFromEdge keeps the baggage of the requests from outside the
+		// mesh, it's stripped by the mesh ingress by default.
+		AllowFromEdge bool `yaml:"allowFromEdge,omitempty" jsonschema:"omitempty"`
+	}
+
 	// ObservabilityTracingsOutputConfig is the tracing output configuration
 	ObservabilityTracingsOutputConfig struct {
 		Enabled         bool   `yaml:"enabled" jsonschema:"required"`
 		ReportThread    int    `yaml:"reportThread" jsonschema:"required"`
 		Topic           string `yaml:"topic" jsonschema:"required"`
 		MessageMaxBytes int    `yaml:"messageMaxBytes" jsonschema:"required"`
-		QueuedMaxSpans  int    `yaml:"queuedMaxSpans" jsonschema:"required"`
-		QueuedMaxSize   int    `yaml:"queuedMaxSize" jsonschema:"required"`
-		MessageTimeout  int    `yaml:"messageTimeout" jsonschema:"required"`
+		// QueuedMaxSpans and QueuedMaxSize bound the span queue of the agent,
+		// which exports the spans and metrics by itself. The sidecar applies
+		// QueuedMaxSpans to the span queue of the always sampled requests,
+		// which are dropped beyond it, and both of them to the buffer of the
+		// access logs sent to the output server.
+		QueuedMaxSpans int `yaml:"queuedMaxSpans" jsonschema:"required"`
+		QueuedMaxSize  int `yaml:"queuedMaxSize" jsonschema:"required"`
+		MessageTimeout int `yaml:"messageTimeout" jsonschema:"required"`
 	}
 	// ObservabilityTracingsDetail is the tracing detail of observability.
 	ObservabilityTracingsDetail struct {
@@ -204,7 +670,15 @@ type (
 
 	// ObservabilityMetrics is the metrics of observability.
 	ObservabilityMetrics struct {
-		Enabled        bool                       `yaml:"enabled" jsonschema:"required"`
+		Enabled bool `yaml:"enabled" jsonschema:"required"`
+		// Output selects where the metrics of the sidecar go, empty means
+		// kafka. With statsd, the sidecar sends the traffic of its ingress
+		// and egress and the canary pool counters to StatsD, the details
+		// below are measured by the agent and go to their kafka topics
+		// regardless of it.
+		Output string                      `yaml:"output" jsonschema:"omitempty,enum=,enum=kafka,enum=statsd"`
+		StatsD *ObservabilityMetricsStatsD `yaml:"statsd" jsonschema:"omitempty"`
+
 		Access         ObservabilityMetricsDetail `yaml:"access" jsonschema:"required"`
 		Request        ObservabilityMetricsDetail `yaml:"request" jsonschema:"required"`
 		JdbcStatement  ObservabilityMetricsDetail `yaml:"jdbcStatement" jsonschema:"required"`
@@ -217,6 +691,15 @@ type (
 		Md5Dictionary  ObservabilityMetricsDetail `yaml:"md5Dictionary" jsonschema:"required"`
 	}
 
+	// ObservabilityMetricsStatsD is the StatsD output of metrics.
+	ObservabilityMetricsStatsD struct {
+		Host   string `yaml:"host" jsonschema:"required"`
+		Port   int    `yaml:"port" jsonschema:"required,minimum=1,maximum=65535"`
+		Prefix string `yaml:"prefix" jsonschema:"omitempty"`
+		// TagFormat is the format of tags, empty means tags are not sent.
+		TagFormat string `yaml:"tagFormat" jsonschema:"omitempty,enum=,enum=datadog,enum=influxdb,enum=graphite"`
+	}
+
 	// ObservabilityMetricsDetail is the metrics detail of observability.
 	ObservabilityMetricsDetail struct {
 		Enabled  bool   `yaml:"enabled" jsonschema:"required"`
@@ -232,6 +715,21 @@ type (
 		// Format: RFC3339
 		CreatedAt   string `yaml:"createdAt" jsonschema:"omitempty"`
 		Description string `yaml:"description"`
+
+		// DefaultResilience is inherited by the services of the tenant,
+		// a service overrides it field by field with its own resilience.
+		DefaultResilience *Resilience `yaml:"defaultResilience,omitempty" jsonschema:"omitempty"`
+
+		// ExportedServices grant the services of other tenants to discover
+		// and call the services of the tenant, without making them global.
+		ExportedServices []*ServiceExport `yaml:"exportedServices,omitempty" jsonschema:"omitempty"`
+	}
+
+	// ServiceExport grants the services of the tenants to discover and call
+	// the service.
+	ServiceExport struct {
+		Service string   `yaml:"service" jsonschema:"required"`
+		Tenants []string `yaml:"tenants" jsonschema:"required,minItems=1,uniqueItems=true"`
 	}
 
 	// ServiceInstanceSpec is the spec of service instance.
@@ -245,6 +743,17 @@ type (
 		Port         uint32            `yaml:"port" jsonschema:"required"`
 		RegistryTime string            `yaml:"registryTime" jsonschema:"omitempty"`
 		Labels       map[string]string `yaml:"labels" jsonschema:"omitempty"`
+		// Metadata is the structured metadata of the instance, the canary rules
+		// match it by dotted paths such as build.commit. A key in Labels takes
+		// precedence over the same path in Metadata. The instances with Labels
+		// are taken as canary instances, and so are the ones with Metadata only
+		// if it matches any canary rule.
+		Metadata map[string]interface{} `yaml:"metadata" jsonschema:"omitempty"`
+
+		// Scheme is the scheme the instance serves, the instances terminating
+		// TLS themselves advertise https. Default is the sidecar egress
+		// protocol of the service.
+		Scheme string `yaml:"scheme,omitempty" jsonschema:"omitempty"`
 
 		// Set by heartbeat timer event or API
 		Status string `yaml:"status" jsonschema:"omitempty"`
@@ -254,19 +763,110 @@ type (
 	IngressPath struct {
 		Path          string `yaml:"path" jsonschema:"required"`
 		RewriteTarget string `yaml:"rewriteTarget" jsonschema:"omitempty"`
-		Backend       string `yaml:"backend" jsonschema:"required"`
+		Backend       string `yaml:"backend" jsonschema:"omitempty"`
+
+		// Backends splits the traffic among the services by weight,
+		// exactly one of Backend and Backends must be specified.
+		Backends []*IngressBackend `yaml:"backends" jsonschema:"omitempty"`
+
+		// RateLimit limits the requests of the path, it applies together
+		// with the rate limit of the ingress.
+		RateLimit *IngressRateLimit `yaml:"rateLimit" jsonschema:"omitempty"`
+
+		// Priority orders the paths of a rule, the higher one is matched first,
+		// the paths with the same priority are matched in declaration order.
+		Priority int `yaml:"priority" jsonschema:"omitempty"`
+
+		// Methods to match, empty means to match all methods. The request
+		// matching the path but none of the methods gets 405.
+		Methods []string `yaml:"methods" jsonschema:"omitempty,uniqueItems=true,format=httpmethod-array"`
+		// Headers to match, the path matches if any of them matches.
+		Headers []*IngressHeader `yaml:"headers" jsonschema:"omitempty"`
+	}
+
+	// IngressBackend is a weighted backend service of a mesh ingress path.
+	IngressBackend struct {
+		Service string `yaml:"service" jsonschema:"required"`
+		Weight  int    `yaml:"weight" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// IngressHeader is the header to match for a mesh ingress path.
+	IngressHeader struct {
+		Key    string   `yaml:"key" jsonschema:"required"`
+		Values []string `yaml:"values" jsonschema:"omitempty,uniqueItems=true"`
+		Regexp string   `yaml:"regexp" jsonschema:"omitempty,format=regexp"`
 	}
 
 	// IngressRule is the rule for mesh ingress
 	IngressRule struct {
+		// Host is matched exactly, or it's a wildcard host with a leading
+		// "*." like *.api.example.com, which matches the hosts ending with
+		// .api.example.com with one or more labels ahead. Empty means any host.
 		Host  string         `yaml:"host" jsonschema:"omitempty"`
 		Paths []*IngressPath `yaml:"paths" jsonschema:"required"`
+
+		// Priority orders the rules, the higher one is matched first.
+		// For the same priority, the exact hosts go first, then the wildcard
+		// hosts from the longest suffix, then the rules for any host, the
+		// others are matched in declaration order.
+		Priority int `yaml:"priority" jsonschema:"omitempty"`
+
+		// StripPrefix is stripped from the paths of the requests matching
+		// the rule, the paths of the rule must start with it and a "/".
+		StripPrefix string `yaml:"stripPrefix,omitempty" jsonschema:"omitempty,pattern=^/"`
+		// AddPrefix is added to the paths of the requests matching the rule
+		// after StripPrefix. The paths of the rule are matched from the
+		// beginning of the request paths if any of them is specified, and
+		// the RewriteTarget of a path overrides both of them.
+		AddPrefix string `yaml:"addPrefix,omitempty" jsonschema:"omitempty,pattern=^/"`
 	}
 
 	// Ingress is the spec of mesh ingress
 	Ingress struct {
 		Name  string         `yaml:"name" jsonschema:"required"`
 		Rules []*IngressRule `yaml:"rules" jsonschema:"required"`
+
+		// TLS terminates TLS at the ingress, nil means plain HTTP.
+		TLS *IngressTLS `yaml:"tls" jsonschema:"omitempty"`
+
+		// RateLimit limits the requests of all paths of the ingress.
+		RateLimit *IngressRateLimit `yaml:"rateLimit" jsonschema:"omitempty"`
+
+		// CORS answers the preflight requests at the ingress and adds the
+		// CORS headers to the responses of all paths of the ingress.
+		CORS *corsadaptor.Spec `yaml:"cors" jsonschema:"omitempty"`
+
+		// Compression compresses the responses of all paths of the ingress,
+		// it takes precedence over the compression of the services.
+		Compression *Compression `yaml:"compression" jsonschema:"omitempty"`
+	}
+
+	// IngressRateLimit is the rate limit of mesh ingress, the rejected
+	// requests get 429 with a Retry-After header.
+	IngressRateLimit struct {
+		LimitForPeriod int `yaml:"limitForPeriod" jsonschema:"required,minimum=1"`
+		// LimitRefreshPeriod is the period to refresh the limit, default is 10ms.
+		LimitRefreshPeriod string `yaml:"limitRefreshPeriod" jsonschema:"omitempty,format=duration"`
+		// TimeoutDuration is the max time to wait for a permission, default is 100ms.
+		TimeoutDuration string `yaml:"timeoutDuration" jsonschema:"omitempty,format=duration"`
+	}
+
+	// IngressPathFilters are the filters applying to a mesh ingress path.
+	IngressPathFilters struct {
+		// IngressName keys the rate limiter shared by the paths of the ingress.
+		IngressName      string
+		IngressRateLimit *IngressRateLimit
+		PathRateLimit    *IngressRateLimit
+		CORS             *corsadaptor.Spec
+		Compression      *Compression
+	}
+
+	// IngressTLS is the TLS termination config of mesh ingress.
+	// The certs and keys are in PEM format and keyed by the host of rules,
+	// the certificate is chosen by SNI.
+	IngressTLS struct {
+		Certs map[string]string `yaml:"certs" jsonschema:"required"`
+		Keys  map[string]string `yaml:"keys" jsonschema:"required"`
 	}
 
 	// ServiceInstanceStatus is the status of service instance.
@@ -275,6 +875,14 @@ type (
 		InstanceID  string `yaml:"instanceID" jsonschema:"required"`
 		// RFC3339 format
 		LastHeartbeatTime string `yaml:"lastHeartbeatTime" jsonschema:"required,format=timerfc3339"`
+		// CircuitBreakers are the states of circuit breakers for the called services,
+		// keyed by the service name and the URL rule ID.
+		CircuitBreakers map[string]string `yaml:"circuitBreakers,omitempty" jsonschema:"omitempty"`
+
+		// AgeSeconds and Stale are derived from LastHeartbeatTime by the API,
+		// they are not stored.
+		AgeSeconds int  `yaml:"ageSeconds,omitempty" jsonschema:"omitempty"`
+		Stale      bool `yaml:"stale,omitempty" jsonschema:"omitempty"`
 	}
 
 	pipelineSpecBuilder struct {
@@ -290,6 +898,10 @@ type (
 	CustomResourceKind struct {
 		Name       string `yaml:"name" jsonschema:"required"`
 		JSONSchema string `yaml:"jsonSchema" jsonschema:"omitempty"`
+
+		// ApplyDefaults fills the missing fields of the custom resources
+		// with the default values in JSONSchema when they are read back.
+		ApplyDefaults bool `yaml:"applyDefaults" jsonschema:"omitempty"`
 	}
 
 	// CustomResource defines the spec of a custom resource
@@ -312,6 +924,111 @@ func (cr CustomResource) Kind() string {
 	return ""
 }
 
+// Validate validates the JSON schema of the custom resource kind,
+// empty schema allows any object.
+func (k CustomResourceKind) Validate() error {
+	if k.JSONSchema == "" {
+		return nil
+	}
+
+	_, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(k.JSONSchema))
+	if err != nil {
+		return fmt.Errorf("invalid JSONSchema of kind %s: %v", k.Name, err)
+	}
+
+	return nil
+}
+
+// FillDefaults fills the missing fields of the custom resource with the
+// default values in the JSON schema if the kind applies defaults.
+// The existing fields are never overwritten, even if they are zero values.
+func (k *CustomResourceKind) FillDefaults(cr CustomResource) error {
+	if !k.ApplyDefaults || k.JSONSchema == "" {
+		return nil
+	}
+
+	// NOTE: Unmarshal it every time, so the resources never share
+	// the same default values.
+	schema := map[string]interface{}{}
+	err := json.Unmarshal([]byte(k.JSONSchema), &schema)
+	if err != nil {
+		return fmt.Errorf("unmarshal JSONSchema of kind %s failed: %v", k.Name, err)
+	}
+
+	fillDefaults(schema, map[string]interface{}(cr))
+
+	return nil
+}
+
+// fillDefaults fills obj by the properties of schema recursively, obj could be
+// map[string]interface{} or map[interface{}]interface{} from yaml.
+func fillDefaults(schema map[string]interface{}, obj interface{}) {
+	properties, _ := schema["properties"].(map[string]interface{})
+	for name, p := range properties {
+		property, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		var value interface{}
+		var exists bool
+		switch o := obj.(type) {
+		case map[string]interface{}:
+			value, exists = o[name]
+		case map[interface{}]interface{}:
+			value, exists = o[name]
+		default:
+			return
+		}
+
+		if exists {
+			fillDefaults(property, value)
+			continue
+		}
+
+		defaultValue, ok := property["default"]
+		if !ok {
+			continue
+		}
+		switch o := obj.(type) {
+		case map[string]interface{}:
+			o[name] = defaultValue
+		case map[interface{}]interface{}:
+			o[name] = defaultValue
+		}
+	}
+}
+
+// ValidateResource validates the custom resource against the JSON schema
+// of the kind, empty schema allows any object.
+func (k *CustomResourceKind) ValidateResource(cr CustomResource) error {
+	if cr.Kind() != k.Name {
+		return fmt.Errorf("custom resource %s is kind %s, not %s", cr.Name(), cr.Kind(), k.Name)
+	}
+
+	if k.JSONSchema == "" {
+		return nil
+	}
+
+	schema := gojsonschema.NewStringLoader(k.JSONSchema)
+	doc := gojsonschema.NewGoLoader(cr)
+	res, err := gojsonschema.Validate(schema, doc)
+	if err != nil {
+		return fmt.Errorf("validate custom resource %s failed: %v", cr.Name(), err)
+	}
+
+	if !res.Valid() {
+		errs := []string{}
+		for _, e := range res.Errors() {
+			errs = append(errs, e.String())
+		}
+		return fmt.Errorf("invalid custom resource %s of kind %s: %s",
+			cr.Name(), k.Name, strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
 // Validate validates Spec.
 func (a Admin) Validate() error {
 	switch a.RegistryType {
@@ -320,189 +1037,1230 @@ func (a Admin) Validate() error {
 		return fmt.Errorf("unsupported registry center type: %s", a.RegistryType)
 	}
 
+	if a.MaxCanaryRules < 0 {
+		return fmt.Errorf("invalid maxCanaryRules: %d", a.MaxCanaryRules)
+	}
+
+	if a.TLSIngressPort() == a.IngressPort {
+		return fmt.Errorf("ingressHTTPSPort %d conflicts with ingressPort", a.TLSIngressPort())
+	}
+
 	return nil
 }
 
-// Key returns the key of ServiceInstanceSpec.
-func (s *ServiceInstanceSpec) Key() string {
-	return fmt.Sprintf("%s/%s/%s", s.RegistryName, s.ServiceName, s.InstanceID)
+// TLSIngressPort returns the effective port of the ingresses enabling TLS.
+func (a Admin) TLSIngressPort() int {
+	if a.IngressHTTPSPort == 0 {
+		return IngressHTTPSPort
+	}
+	return a.IngressHTTPSPort
 }
 
-func newPipelineSpecBuilder(name string) *pipelineSpecBuilder {
-	return &pipelineSpecBuilder{
-		Kind: httppipeline.Kind,
-		Name: name,
-		Spec: httppipeline.Spec{},
+// HeartbeatTimeout returns the duration after which an instance without
+// heartbeat is taken as failed.
+func (a Admin) HeartbeatTimeout() time.Duration {
+	interval, err := time.ParseDuration(a.HeartbeatInterval)
+	if err != nil || interval <= 0 {
+		interval, _ = time.ParseDuration(HeartbeatInterval)
 	}
+	return interval * 2
 }
 
-func (b *pipelineSpecBuilder) yamlConfig() string {
-	buff, err := yaml.Marshal(b)
+// UpdateAge derives AgeSeconds and Stale from LastHeartbeatTime, the negative
+// age caused by clock skew is clamped to zero.
+func (s *ServiceInstanceStatus) UpdateAge(now time.Time, heartbeatTimeout time.Duration) {
+	lastHeartbeatTime, err := time.Parse(time.RFC3339, s.LastHeartbeatTime)
 	if err != nil {
-		logger.Errorf("BUG: marshal %#v to yaml failed: %v", b, err)
+		s.AgeSeconds, s.Stale = 0, true
+		return
 	}
-	return string(buff)
-}
 
-func (b *pipelineSpecBuilder) appendRateLimiter(rl *ratelimiter.Spec) *pipelineSpecBuilder {
-	const name = "rateLimiter"
+	age := now.Sub(lastHeartbeatTime)
+	if age < 0 {
+		age = 0
+	}
+	s.AgeSeconds = int(age / time.Second)
+	s.Stale = age > heartbeatTimeout
+}
 
-	if rl == nil || len(rl.Policies) == 0 || len(rl.URLs) == 0 {
-		return b
+// Validate validates NacosScope.
+func (s NacosScope) Validate() error {
+	if strings.Contains(s.Group, "@@") {
+		return fmt.Errorf("group %s contains @@", s.Group)
 	}
+	return nil
+}
 
-	b.Flow = append(b.Flow, httppipeline.Flow{Filter: name})
-	b.Filters = append(b.Filters, map[string]interface{}{
-		"kind":             ratelimiter.Kind,
-		"name":             name,
-		"policies":         rl.Policies,
-		"defaultPolicyRef": rl.DefaultPolicyRef,
-		"urls":             rl.URLs,
-	})
-	return b
+// NacosScope returns the effective Nacos namespace and group of the mesh services.
+func (a Admin) NacosScope() NacosScope {
+	scope := NacosScope{
+		Namespace: NacosDefaultNamespace,
+		Group:     NacosDefaultGroup,
+	}
+	if a.Nacos != nil {
+		if a.Nacos.Namespace != "" {
+			scope.Namespace = a.Nacos.Namespace
+		}
+		if a.Nacos.Group != "" {
+			scope.Group = a.Nacos.Group
+		}
+	}
+	return scope
 }
 
-func (b *pipelineSpecBuilder) appendCircuitBreaker(cb *circuitbreaker.Spec) *pipelineSpecBuilder {
-	const name = "circuitBreaker"
+// Match reports whether the namespace and group in the Nacos request are in
+// the scope, the empty ones mean the Nacos defaults.
+func (s NacosScope) Match(namespace, group string) bool {
+	if namespace == "" {
+		namespace = NacosDefaultNamespace
+	}
+	if group == "" {
+		group = NacosDefaultGroup
+	}
+	return namespace == s.Namespace && group == s.Group
+}
 
-	if cb == nil || len(cb.Policies) == 0 || len(cb.URLs) == 0 {
-		return b
+// CertTTL returns the effective lifetime of the service certificates.
+func (a Admin) CertTTL() time.Duration {
+	if a.MTLS != nil {
+		ttl, err := time.ParseDuration(a.MTLS.CertTTL)
+		if err == nil && ttl > 0 {
+			return ttl
+		}
 	}
+	return DefaultCertTTL
+}
 
-	b.Flow = append(b.Flow, httppipeline.Flow{Filter: name})
-	b.Filters = append(b.Filters, map[string]interface{}{
-		"kind":             circuitbreaker.Kind,
-		"name":             name,
-		"policies":         cb.Policies,
-		"defaultPolicyRef": cb.DefaultPolicyRef,
-		"urls":             cb.URLs,
-	})
-	return b
+// ServiceRetentionDuration returns the effective retention of the
+// soft-deleted services.
+func (a Admin) ServiceRetentionDuration() time.Duration {
+	retention, err := time.ParseDuration(a.ServiceRetention)
+	if err == nil && retention > 0 {
+		return retention
+	}
+	return DefaultServiceRetention
 }
 
-func (b *pipelineSpecBuilder) appendRetryer(r *retryer.Spec) *pipelineSpecBuilder {
-	const name = "retryer"
+// CanaryRulesLimit returns the effective maximum number of canary rules of one service.
+func (a Admin) CanaryRulesLimit() int {
+	if a.MaxCanaryRules == 0 {
+		return DefaultMaxCanaryRules
+	}
+	return a.MaxCanaryRules
+}
 
-	if r == nil || len(r.Policies) == 0 || len(r.URLs) == 0 {
-		return b
+// Validate validates ObservabilityMetrics.
+func (m ObservabilityMetrics) Validate() error {
+	if m.Output == MetricsOutputStatsD && m.StatsD == nil {
+		return fmt.Errorf("statsd output without statsd config")
 	}
 
-	b.Flow = append(b.Flow, httppipeline.Flow{Filter: name})
-	b.Filters = append(b.Filters, map[string]interface{}{
-		"kind":             retryer.Kind,
-		"name":             name,
-		"policies":         r.Policies,
-		"defaultPolicyRef": r.DefaultPolicyRef,
-		"urls":             r.URLs,
-	})
-	return b
+	return nil
 }
 
-func (b *pipelineSpecBuilder) appendMock(m []*mock.Rule) *pipelineSpecBuilder {
-	const name = "mock"
-	if len(m) == 0 {
-		return b
+// Validate validates Observability.
+func (o Observability) Validate() error {
+	if o.AccessLog == nil || o.AccessLog.Output != AccessLogOutputServer {
+		return nil
 	}
 
-	b.Flow = append(b.Flow, httppipeline.Flow{Filter: name})
-	b.Filters = append(b.Filters, map[string]interface{}{
-		"kind":  mock.Kind,
-		"name":  name,
-		"rules": m,
-	})
+	if o.OutputServer == nil || !o.OutputServer.Enabled {
+		return fmt.Errorf("access log output to the output server which is not enabled")
+	}
 
-	return b
+	return nil
 }
 
-func (b *pipelineSpecBuilder) appendTimeLimiter(tl *timelimiter.Spec) *pipelineSpecBuilder {
-	const name = "timeLimiter"
+// Validate validates ObservabilityOutputServerSecurity.
+func (s ObservabilityOutputServerSecurity) Validate() error {
+	if s.SASLMechanism == "" {
+		if s.SASLUsername != "" || s.SASLPassword != "" {
+			return fmt.Errorf("sasl credentials without sasl mechanism")
+		}
+	} else if s.SASLUsername == "" || s.SASLPassword == "" {
+		return fmt.Errorf("sasl mechanism %s without username or password", s.SASLMechanism)
+	}
 
-	if tl == nil || len(tl.URLs) == 0 {
-		return b
+	if s.SASLPassword != "" {
+		m := referenceRegexp.FindStringSubmatch(s.SASLPassword)
+		if m == nil || m[0] != s.SASLPassword || m[1] != ReferenceSecret {
+			return fmt.Errorf("sasl password must be a secret reference like ${secret:name}")
+		}
 	}
 
-	b.Flow = append(b.Flow, httppipeline.Flow{Filter: name})
-	b.Filters = append(b.Filters, map[string]interface{}{
-		"kind":           timelimiter.Kind,
-		"name":           name,
-		"defaultTimeout": tl.DefaultTimeoutDuration,
-		"urls":           tl.URLs,
-	})
-	return b
-}
+	if s.CACertBase64 != "" && !s.TLSEnabled {
+		return fmt.Errorf("ca cert without tls enabled")
+	}
+	if s.TLSEnabled {
+		return accesslogger.KafkaTLSSpec{CACertBase64: s.CACertBase64}.Validate()
+	}
 
-func (b *pipelineSpecBuilder) appendProxyWithCanary(instanceSpecs []*ServiceInstanceSpec, canary *Canary, lb *proxy.LoadBalance) *pipelineSpecBuilder {
-	mainServers := []*proxy.Server{}
-	canaryInstances := []*ServiceInstanceSpec{}
+	return nil
+}
 
-	for k, instanceSpec := range instanceSpecs {
-		if instanceSpec.Status == ServiceStatusUp {
-			if len(instanceSpec.Labels) == 0 {
-				mainServers = append(mainServers, &proxy.Server{
-					URL: fmt.Sprintf("http://%s:%d", instanceSpec.IP, instanceSpec.Port),
-				})
-			} else {
-				canaryInstances = append(canaryInstances, instanceSpecs[k])
-			}
+// kafkaSpec returns the kafka spec of the access logger to the topic, the
+// password is left as the secret reference, it's resolved by the sidecar.
+func (s *ObservabilityOutputServer) kafkaSpec(topic string) *accesslogger.KafkaSpec {
+	spec := &accesslogger.KafkaSpec{
+		Brokers: strings.Split(s.BootstrapServer, ","),
+		Topic:   topic,
+		Timeout: s.Timeout,
+	}
+	if s.SASLMechanism != "" {
+		spec.SASL = &accesslogger.KafkaSASLSpec{
+			Mechanism: s.SASLMechanism,
+			Username:  s.SASLUsername,
+			Password:  s.SASLPassword,
 		}
 	}
-	backendName := "backend"
+	if s.TLSEnabled {
+		spec.TLS = &accesslogger.KafkaTLSSpec{CACertBase64: s.CACertBase64}
+	}
+	return spec
+}
 
-	if lb == nil {
-		lb = &proxy.LoadBalance{
-			Policy: proxy.PolicyRoundRobin,
+// Validate validates ObservabilityTracingsPropagation.
+func (p ObservabilityTracingsPropagation) Validate() error {
+	for _, format := range p.Accept {
+		if !propagation.Valid(format) {
+			return fmt.Errorf("unsupported accepted trace context format %s", format)
 		}
 	}
 
-	candidatePool := []*proxy.PoolSpec{}
-	if len(canaryInstances) != 0 && canary != nil && len(canary.CanaryRules) != 0 {
-		for _, v := range canary.CanaryRules {
-			servers := []*proxy.Server{}
-			for _, ins := range canaryInstances {
-				for key, label := range v.ServiceInstanceLabels {
-					match := false
-					for insKey, insLabel := range ins.Labels {
-						if key == insKey && label == insLabel {
-							servers = append(servers, &proxy.Server{
-								URL: fmt.Sprintf("http://%s:%d", ins.IP, ins.Port),
-							})
-							match = true
-							break
-						}
-					}
-					if match {
-						break
-					}
-				}
+	return nil
+}
+
+// Validate validates ObservabilityMetricsStatsD.
+func (s ObservabilityMetricsStatsD) Validate() error {
+	if net.ParseIP(s.Host) != nil {
+		return nil
+	}
+
+	if !hostnameRegexp.MatchString(s.Host) {
+		return fmt.Errorf("invalid statsd host: %s", s.Host)
+	}
+
+	return nil
+}
+
+// Address returns the UDP address of the StatsD server.
+func (s ObservabilityMetricsStatsD) Address() string {
+	return net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+}
+
+// TracingsEnabled reports whether the tracings are enabled, regardless of
+// the metrics.
+func (o *Observability) TracingsEnabled() bool {
+	return o != nil && o.Tracings != nil && o.Tracings.Enabled
+}
+
+// MetricsEnabled reports whether the metrics are enabled, regardless of
+// the tracings.
+func (o *Observability) MetricsEnabled() bool {
+	return o != nil && o.Metrics != nil && o.Metrics.Enabled
+}
+
+// AgentObservability returns the observability for the agent, the details
+// of the disabled tracings or metrics are disabled too, so the agent never
+// traces or measures a service in which they're disabled, even if it looks
+// at the details only.
+func (o *Observability) AgentObservability() *Observability {
+	if o == nil {
+		return nil
+	}
+
+	agent := *o
+	// NOTE: The agent connects to the output server by itself, so it gets
+	// the password resolved.
+	if o.OutputServer != nil && o.OutputServer.SASLPassword != "" {
+		outputServer := *o.OutputServer
+		password, err := interpolate(outputServer.SASLPassword, false)
+		if err != nil {
+			logger.Errorf("resolve sasl password of output server failed: %v", err)
+		}
+		outputServer.SASLPassword = password
+		agent.OutputServer = &outputServer
+	}
+	if o.Tracings != nil && !o.Tracings.Enabled {
+		tracings := *o.Tracings
+		tracings.Output.Enabled = false
+		for _, d := range []*ObservabilityTracingsDetail{&tracings.Request, &tracings.RemoteInvoke,
+			&tracings.Kafka, &tracings.Jdbc, &tracings.Redis, &tracings.Rabbit} {
+			d.Enabled = false
+		}
+		agent.Tracings = &tracings
+	}
+	if o.Metrics != nil && !o.Metrics.Enabled {
+		metrics := *o.Metrics
+		for _, d := range []*ObservabilityMetricsDetail{&metrics.Access, &metrics.Request,
+			&metrics.JdbcStatement, &metrics.JdbcConnection, &metrics.Rabbit, &metrics.Kafka,
+			&metrics.Redis, &metrics.JvmGC, &metrics.JvmMemory, &metrics.Md5Dictionary} {
+			d.Enabled = false
+		}
+		agent.Metrics = &metrics
+	}
+
+	return &agent
+}
+
+// TracingsBaggage returns the baggage propagation of the service, nil if
+// the tracings are disabled.
+func (s *Service) TracingsBaggage() *ObservabilityTracingsBaggage {
+	if !s.Observability.TracingsEnabled() {
+		return nil
+	}
+	return s.Observability.Tracings.Baggage
+}
+
+// stripsEdgeBaggage reports whether the mesh ingress strips the baggage of
+// the requests to the service.
+func (s *Service) stripsEdgeBaggage() bool {
+	b := s.TracingsBaggage()
+	return b != nil && !b.AllowFromEdge
+}
+
+// Key returns the key of ServiceInstanceSpec.
+func (s *ServiceInstanceSpec) Key() string {
+	return fmt.Sprintf("%s/%s/%s", s.RegistryName, s.ServiceName, s.InstanceID)
+}
+
+// Validate validates ServiceInstanceSpec.
+func (s ServiceInstanceSpec) Validate() error {
+	if s.Scheme != "" && !validInstanceScheme(s.Scheme) {
+		return fmt.Errorf("unsupported scheme %s (support %s, %s)", s.Scheme, InstanceSchemeHTTP, InstanceSchemeHTTPS)
+	}
+
+	return nil
+}
+
+func validInstanceScheme(scheme string) bool {
+	return scheme == InstanceSchemeHTTP || scheme == InstanceSchemeHTTPS
+}
+
+// URL returns the URL of the instance, defaultScheme is used if the instance
+// advertises no scheme.
+func (s *ServiceInstanceSpec) URL(defaultScheme string) string {
+	scheme := s.Scheme
+	if scheme == "" {
+		scheme = defaultScheme
+	}
+	return scheme + "://" + s.hostPort()
+}
+
+// hostPort returns the address of the instance, IPv6 addresses are bracketed.
+func (s *ServiceInstanceSpec) hostPort() string {
+	return net.JoinHostPort(s.IP, strconv.Itoa(int(s.Port)))
+}
+
+// isCanary reports whether the instance is a canary one. The instances with
+// no Labels fall back to Metadata, but only if it matches any canary rule, so
+// the main instances carrying Metadata stay in the main pool.
+func (s *ServiceInstanceSpec) isCanary(canary *Canary) bool {
+	if len(s.Labels) != 0 {
+		return true
+	}
+	if len(s.Metadata) == 0 || canary == nil {
+		return false
+	}
+
+	for _, rule := range canary.CanaryRules {
+		if rule.matchInstance(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Label returns the label of the key, it looks up Labels first, then the
+// dotted path in Metadata whose value must be a scalar.
+func (s *ServiceInstanceSpec) Label(key string) (string, bool) {
+	if label, exists := s.Labels[key]; exists {
+		return label, true
+	}
+
+	var value interface{} = s.Metadata
+	for _, field := range strings.Split(key, ".") {
+		switch m := value.(type) {
+		case map[string]interface{}:
+			value = m[field]
+		case map[interface{}]interface{}:
+			value = m[field]
+		default:
+			return "", false
+		}
+		if value == nil {
+			return "", false
+		}
+	}
+
+	switch value.(type) {
+	case map[string]interface{}, map[interface{}]interface{}, []interface{}:
+		return "", false
+	default:
+		return fmt.Sprint(value), true
+	}
+}
+
+func newPipelineSpecBuilder(name string) *pipelineSpecBuilder {
+	return &pipelineSpecBuilder{
+		Kind: httppipeline.Kind,
+		Name: name,
+		Spec: httppipeline.Spec{},
+	}
+}
+
+func (b *pipelineSpecBuilder) yamlConfig() string {
+	buff, err := yaml.Marshal(b)
+	if err != nil {
+		logger.Errorf("BUG: marshal %#v to yaml failed: %v", b, err)
+	}
+	return string(buff)
+}
+
+func (b *pipelineSpecBuilder) appendBodyLimiter(l *bodylimiter.Spec) *pipelineSpecBuilder {
+	const name = "bodyLimiter"
+
+	if l == nil || (l.MaxRequestBodyBytes == 0 && l.MaxResponseBodyBytes == 0) {
+		return b
+	}
+
+	b.Flow = append(b.Flow, httppipeline.Flow{Filter: name})
+	b.Filters = append(b.Filters, map[string]interface{}{
+		"kind":                 bodylimiter.Kind,
+		"name":                 name,
+		"maxRequestBodyBytes":  l.MaxRequestBodyBytes,
+		"maxResponseBodyBytes": l.MaxResponseBodyBytes,
+	})
+	return b
+}
+
+// appendAccessLogger appends the access logger of the observability, the
+// output server is used only if the access logs go to it.
+func (b *pipelineSpecBuilder) appendAccessLogger(o *Observability, upstream string) *pipelineSpecBuilder {
+	const name = "accessLogger"
+
+	if o == nil || o.AccessLog == nil || !o.AccessLog.Enabled {
+		return b
+	}
+
+	al := o.AccessLog
+	filter := map[string]interface{}{
+		"kind":       accesslogger.Kind,
+		"name":       name,
+		"sampleRate": al.SampleRate,
+		"upstream":   upstream,
+	}
+	if al.Format != "" {
+		filter["format"] = al.Format
+	}
+	if len(al.HeaderAllowlist) != 0 {
+		filter["headerAllowlist"] = al.HeaderAllowlist
+	}
+	if al.Output == AccessLogOutputServer && o.OutputServer != nil && o.OutputServer.Enabled {
+		topic := al.Topic
+		if topic == "" {
+			topic = DefaultAccessLogTopic
+		}
+		kafka := o.OutputServer.kafkaSpec(topic)
+		// NOTE: The buffer of the access logs reuses the queue bounds of the
+		// tracings output, the spans and metrics are buffered by the agent.
+		if o.Tracings != nil {
+			kafka.BufferMaxLines = o.Tracings.Output.QueuedMaxSpans
+			kafka.BufferMaxBytes = o.Tracings.Output.QueuedMaxSize
+		}
+		filter["output"] = accesslogger.OutputKafka
+		filter["kafka"] = kafka
+	}
+
+	b.Flow = append(b.Flow, httppipeline.Flow{Filter: name})
+	b.Filters = append(b.Filters, filter)
+	return b
+}
+
+// appendTracePropagator appends the trace propagator if the tracings are
+// enabled with the propagation formats.
+func (b *pipelineSpecBuilder) appendTracePropagator(o *Observability) *pipelineSpecBuilder {
+	const name = "tracePropagator"
+
+	if !o.TracingsEnabled() || o.Tracings.Propagation == nil {
+		return b
+	}
+
+	p := o.Tracings.Propagation
+	filter := map[string]interface{}{
+		"kind": tracepropagator.Kind,
+		"name": name,
+		"emit": p.Format,
+	}
+	if len(p.Accept) != 0 {
+		filter["accept"] = p.Accept
+	}
+
+	b.Flow = append(b.Flow, httppipeline.Flow{Filter: name})
+	b.Filters = append(b.Filters, filter)
+	return b
+}
+
+func (b *pipelineSpecBuilder) appendFaultInjector(fi *FaultInjection) *pipelineSpecBuilder {
+	const name = "faultInjector"
+
+	if fi == nil || (fi.Abort == nil && fi.Delay == nil) {
+		return b
+	}
+
+	filter := map[string]interface{}{
+		"kind": faultinjector.Kind,
+		"name": name,
+	}
+	if fi.Abort != nil {
+		filter["abort"] = fi.Abort
+	}
+	if fi.Delay != nil {
+		filter["delay"] = fi.Delay
+	}
+	if fi.HashHeader != "" {
+		filter["hashHeader"] = fi.HashHeader
+	}
+
+	b.Flow = append(b.Flow, httppipeline.Flow{Filter: name})
+	b.Filters = append(b.Filters, filter)
+	return b
+}
+
+func (b *pipelineSpecBuilder) appendAuthenticator(a *Authentication) *pipelineSpecBuilder {
+	const name = "authenticator"
+
+	if a == nil || a.JWT == nil {
+		return b
+	}
+
+	b.Flow = append(b.Flow, httppipeline.Flow{Filter: name})
+	b.Filters = append(b.Filters, map[string]interface{}{
+		"kind": validator.Kind,
+		"name": name,
+		"jwt":  a.JWT,
+	})
+	return b
+}
+
+func (b *pipelineSpecBuilder) appendRequestHeaderAdaptor(hr *HeaderRules) *pipelineSpecBuilder {
+	const name = "requestHeaderAdaptor"
+
+	if hr == nil || hr.Request == nil {
+		return b
+	}
+
+	b.Flow = append(b.Flow, httppipeline.Flow{Filter: name})
+	b.Filters = append(b.Filters, map[string]interface{}{
+		"kind":   requestadaptor.Kind,
+		"name":   name,
+		"header": hr.Request,
+	})
+	return b
+}
+
+func (b *pipelineSpecBuilder) appendResponseHeaderAdaptor(hr *HeaderRules) *pipelineSpecBuilder {
+	const name = "responseHeaderAdaptor"
+
+	if hr == nil || hr.Response == nil {
+		return b
+	}
+
+	b.Flow = append(b.Flow, httppipeline.Flow{Filter: name})
+	b.Filters = append(b.Filters, map[string]interface{}{
+		"kind":   responseadaptor.Kind,
+		"name":   name,
+		"header": hr.Response,
+	})
+	return b
+}
+
+// appendDeadlinePropagator appends the propagator recording the deadlines
+// of the ingress requests of the service, or applying them to its egress
+// requests.
+func (b *pipelineSpecBuilder) appendDeadlinePropagator(mode string, s *Service) *pipelineSpecBuilder {
+	dp := s.DeadlinePropagation
+	if dp == nil {
+		return b
+	}
+
+	name := "deadlineRecorder"
+	if mode == headerpropagator.ModeApply {
+		name = "deadlineApplier"
+	}
+
+	filter := map[string]interface{}{
+		"kind":           headerpropagator.Kind,
+		"name":           name,
+		"mode":           mode,
+		"store":          s.Name + "-deadline",
+		"deadlineHeader": s.DeadlineHeaderName(),
+	}
+	if dp.Floor != "" && mode == headerpropagator.ModeApply {
+		filter["deadlineFloor"] = dp.Floor
+	}
+	if dp.CorrelationHeader != "" {
+		filter["correlationHeader"] = dp.CorrelationHeader
+	}
+	if dp.TTL != "" {
+		filter["ttl"] = dp.TTL
+	}
+
+	b.Flow = append(b.Flow, httppipeline.Flow{Filter: name})
+	b.Filters = append(b.Filters, filter)
+	return b
+}
+
+func (b *pipelineSpecBuilder) appendHeaderPropagator(mode string, s *Service) *pipelineSpecBuilder {
+	name := "canaryHeaderRecorder"
+	if mode == headerpropagator.ModeApply {
+		name = "canaryHeaderApplier"
+	}
+
+	headers := s.CanaryPropagationHeaders()
+	if len(headers) == 0 {
+		return b
+	}
+
+	filter := map[string]interface{}{
+		"kind":    headerpropagator.Kind,
+		"name":    name,
+		"mode":    mode,
+		"store":   s.Name,
+		"headers": headers,
+	}
+	if cp := s.CanaryPropagation; cp != nil {
+		if cp.CorrelationHeader != "" {
+			filter["correlationHeader"] = cp.CorrelationHeader
+		}
+		if cp.TTL != "" {
+			filter["ttl"] = cp.TTL
+		}
+	}
+
+	b.Flow = append(b.Flow, httppipeline.Flow{Filter: name})
+	b.Filters = append(b.Filters, filter)
+	return b
+}
+
+// appendBaggagePropagator appends the propagator recording the baggage of
+// the ingress requests of the service, or applying it to its egress
+// requests.
+func (b *pipelineSpecBuilder) appendBaggagePropagator(mode string, s *Service) *pipelineSpecBuilder {
+	bg := s.TracingsBaggage()
+	if bg == nil {
+		return b
+	}
+
+	name := "baggageRecorder"
+	if mode == headerpropagator.ModeApply {
+		name = "baggageApplier"
+	}
+
+	filter := map[string]interface{}{
+		"kind":  headerpropagator.Kind,
+		"name":  name,
+		"mode":  mode,
+		"store": s.Name + "-baggage",
+		"baggage": &headerpropagator.BaggageSpec{
+			Keys:     bg.Keys,
+			MaxKeys:  bg.MaxKeys,
+			MaxBytes: bg.MaxBytes,
+		},
+	}
+	if bg.CorrelationHeader != "" {
+		filter["correlationHeader"] = bg.CorrelationHeader
+	}
+	if bg.TTL != "" {
+		filter["ttl"] = bg.TTL
+	}
+
+	b.Flow = append(b.Flow, httppipeline.Flow{Filter: name})
+	b.Filters = append(b.Filters, filter)
+	return b
+}
+
+// appendBaggageStripper appends the adaptor removing the baggage of the
+// requests from outside the mesh.
+func (b *pipelineSpecBuilder) appendBaggageStripper() *pipelineSpecBuilder {
+	const name = "baggageStripper"
+
+	b.Flow = append(b.Flow, httppipeline.Flow{Filter: name})
+	b.Filters = append(b.Filters, map[string]interface{}{
+		"kind": requestadaptor.Kind,
+		"name": name,
+		"header": &httpheader.AdaptSpec{
+			Del: []string{headerpropagator.BaggageHeader},
+		},
+	})
+	return b
+}
+
+func (b *pipelineSpecBuilder) appendRateLimiter(rl *ratelimiter.Spec) *pipelineSpecBuilder {
+	const name = "rateLimiter"
+
+	if rl == nil || len(rl.Policies) == 0 || len(rl.URLs) == 0 {
+		return b
+	}
+
+	filter := map[string]interface{}{
+		"kind":             ratelimiter.Kind,
+		"name":             name,
+		"policies":         rl.Policies,
+		"defaultPolicyRef": rl.DefaultPolicyRef,
+		"urls":             rl.URLs,
+	}
+	// NOTE: The adaptive rate limiting is strictly opt-in.
+	if rl.Adaptive != nil {
+		filter["adaptive"] = rl.Adaptive
+	}
+
+	b.Flow = append(b.Flow, httppipeline.Flow{Filter: name})
+	b.Filters = append(b.Filters, filter)
+	return b
+}
+
+func (b *pipelineSpecBuilder) appendIngressPathFilters(filters *IngressPathFilters) *pipelineSpecBuilder {
+	if filters == nil {
+		return b
+	}
+
+	// NOTE: The preflight requests are answered by the CORS adaptor, so
+	// they never reach the rate limiters or the backend.
+	if filters.CORS != nil {
+		const name = "corsAdaptor"
+		b.Flow = append(b.Flow, httppipeline.Flow{Filter: name})
+		b.Filters = append(b.Filters, map[string]interface{}{
+			"kind":             corsadaptor.Kind,
+			"name":             name,
+			"allowedOrigins":   filters.CORS.AllowedOrigins,
+			"allowedMethods":   filters.CORS.AllowedMethods,
+			"allowedHeaders":   filters.CORS.AllowedHeaders,
+			"allowCredentials": filters.CORS.AllowCredentials,
+			"exposedHeaders":   filters.CORS.ExposedHeaders,
+			"maxAge":           filters.CORS.MaxAge,
+		})
+	}
+
+	appendLimiter := func(name, sharedKey string, rl *IngressRateLimit) {
+		if rl == nil {
+			return
+		}
+
+		const policyName = "default"
+		filter := map[string]interface{}{
+			"kind": ratelimiter.Kind,
+			"name": name,
+			"policies": []*ratelimiter.Policy{{
+				Name:               policyName,
+				LimitForPeriod:     rl.LimitForPeriod,
+				LimitRefreshPeriod: rl.LimitRefreshPeriod,
+				TimeoutDuration:    rl.TimeoutDuration,
+			}},
+			"defaultPolicyRef": policyName,
+			"urls": []*ratelimiter.URLRule{{
+				URLRule: urlrule.URLRule{URL: urlrule.StringMatch{Prefix: "/"}},
+			}},
+		}
+		if sharedKey != "" {
+			filter["sharedKey"] = sharedKey
+		}
+
+		b.Flow = append(b.Flow, httppipeline.Flow{Filter: name})
+		b.Filters = append(b.Filters, filter)
+	}
+
+	// NOTE: The limiter of the ingress is shared by the pipelines of all
+	// its paths, so it caps the traffic of the whole ingress.
+	appendLimiter("ingressRateLimiter", "mesh-ingress-"+filters.IngressName, filters.IngressRateLimit)
+	appendLimiter("pathRateLimiter", "", filters.PathRateLimit)
+
+	return b
+}
+
+func (b *pipelineSpecBuilder) appendCircuitBreaker(cb *circuitbreaker.Spec) *pipelineSpecBuilder {
+	const name = "circuitBreaker"
+
+	if cb == nil || len(cb.Policies) == 0 || len(cb.URLs) == 0 {
+		return b
+	}
+
+	b.Flow = append(b.Flow, httppipeline.Flow{Filter: name})
+	b.Filters = append(b.Filters, map[string]interface{}{
+		"kind":             circuitbreaker.Kind,
+		"name":             name,
+		"policies":         cb.Policies,
+		"defaultPolicyRef": cb.DefaultPolicyRef,
+		"urls":             cb.URLs,
+	})
+	return b
+}
+
+func (b *pipelineSpecBuilder) appendRetryer(r *retryer.Spec) *pipelineSpecBuilder {
+	const name = "retryer"
+
+	if r == nil || len(r.Policies) == 0 || len(r.URLs) == 0 {
+		return b
+	}
+
+	filter := map[string]interface{}{
+		"kind":             retryer.Kind,
+		"name":             name,
+		"policies":         r.Policies,
+		"defaultPolicyRef": r.DefaultPolicyRef,
+		"urls":             r.URLs,
+	}
+	if r.Budget != nil {
+		filter["budget"] = r.Budget
+	}
+	if len(r.RetryOnStatusCodes) > 0 {
+		filter["retryOnStatusCodes"] = r.RetryOnStatusCodes
+	}
+	if r.RetryNonIdempotent {
+		filter["retryNonIdempotent"] = true
+	}
+	if r.IdempotencyKeyHeader != "" {
+		filter["idempotencyKeyHeader"] = r.IdempotencyKeyHeader
+	}
+
+	b.Flow = append(b.Flow, httppipeline.Flow{Filter: name})
+	b.Filters = append(b.Filters, filter)
+	return b
+}
+
+func (b *pipelineSpecBuilder) appendMock(m []*mock.Rule) *pipelineSpecBuilder {
+	const name = "mock"
+	if len(m) == 0 {
+		return b
+	}
+
+	// NOTE: The unmatched requests fall through to the following filters.
+	b.Flow = append(b.Flow, httppipeline.Flow{
+		Filter: name,
+		JumpIf: map[string]string{mock.ResultMocked: httppipeline.LabelEND},
+	})
+	b.Filters = append(b.Filters, map[string]interface{}{
+		"kind":  mock.Kind,
+		"name":  name,
+		"rules": m,
+	})
+
+	return b
+}
+
+// appendNoAvailableInstances appends the filter responding 503 to all
+// requests, it replaces the proxy of the service without UP instances. It's
+// a separate filter, so its requests are told apart from the ones failed by
+// the proxy in the statistics of the pipeline.
+func (b *pipelineSpecBuilder) appendNoAvailableInstances(serviceName string) *pipelineSpecBuilder {
+	b.Flow = append(b.Flow, httppipeline.Flow{
+		Filter: NoAvailableInstancesFilterName,
+		JumpIf: map[string]string{mock.ResultMocked: httppipeline.LabelEND},
+	})
+	b.Filters = append(b.Filters, map[string]interface{}{
+		"kind": mock.Kind,
+		"name": NoAvailableInstancesFilterName,
+		"rules": []*mock.Rule{
+			{
+				PathPrefix: "/",
+				Code:       http.StatusServiceUnavailable,
+				Headers:    map[string]string{"Content-Type": "text/plain"},
+				Body:       NoAvailableInstancesError(serviceName).Error(),
+			},
+		},
+	})
+
+	return b
+}
+
+// appendFallback appends the proxy sending the requests to the fallback of
+// the service, it replaces the proxy of the service without UP instances.
+// The requests are traced in their own span and counted by the filter, and
+// carry FallbackHeader, so they're told apart from the ones to the service.
+func (b *pipelineSpecBuilder) appendFallback(serviceName string, servers []*proxy.Server) *pipelineSpecBuilder {
+	b.Flow = append(b.Flow, httppipeline.Flow{Filter: FallbackFilterName})
+	b.Filters = append(b.Filters, map[string]interface{}{
+		"kind": proxy.Kind,
+		"name": FallbackFilterName,
+		"mainPool": &proxy.PoolSpec{
+			Name:        FallbackFilterName,
+			SpanName:    fmt.Sprintf("%s#%s", FallbackFilterName, serviceName),
+			Servers:     servers,
+			LoadBalance: &proxy.LoadBalance{Policy: proxy.PolicyRoundRobin},
+			RequestHeader: &httpheader.AdaptSpec{
+				Set: map[string]string{FallbackHeader: serviceName},
+			},
+		},
+	})
+
+	return b
+}
+
+// appendTimeLimiter appends the time limiter, the requests are also limited
+// by the time budget in the deadline header if it's not empty.
+func (b *pipelineSpecBuilder) appendTimeLimiter(tl *timelimiter.Spec, deadlineHeader string) *pipelineSpecBuilder {
+	const name = "timeLimiter"
+
+	if tl == nil {
+		tl = &timelimiter.Spec{URLs: []*timelimiter.URLRule{}}
+	}
+	if len(tl.URLs) == 0 && tl.DefaultTimeoutDuration == "" && deadlineHeader == "" {
+		return b
+	}
+
+	filter := map[string]interface{}{
+		"kind":                   timelimiter.Kind,
+		"name":                   name,
+		"defaultTimeoutDuration": tl.DefaultTimeoutDuration,
+		"urls":                   tl.URLs,
+	}
+	if deadlineHeader != "" {
+		filter["deadlineHeader"] = deadlineHeader
+	}
+
+	b.Flow = append(b.Flow, httppipeline.Flow{Filter: name})
+	b.Filters = append(b.Filters, filter)
+	return b
+}
+
+// appendProxyWithCanary appends the proxy, the instances advertising no
+// scheme are served in scheme. The canary rules with source services only
+// apply to the requests from caller, which is empty if the requests are not
+// from mesh services.
+func (b *pipelineSpecBuilder) appendProxyWithCanary(instanceSpecs []*ServiceInstanceSpec, scheme string,
+	canary *Canary, caller string, lb *proxy.LoadBalance, od *proxy.OutlierDetection, mirror *Mirror) *pipelineSpecBuilder {
+	mainServers := []*proxy.Server{}
+	canaryInstances := []*ServiceInstanceSpec{}
+
+	// NOTE: The draining and out of service instances are excluded from
+	// both main and canary pools, the proxy doesn't break the requests
+	// already sent to them.
+	for k, instanceSpec := range instanceSpecs {
+		if instanceSpec.Status == ServiceStatusUp {
+			if !instanceSpec.isCanary(canary) {
+				mainServers = append(mainServers, &proxy.Server{
+					URL: instanceSpec.URL(scheme),
+				})
+			} else {
+				canaryInstances = append(canaryInstances, instanceSpecs[k])
+			}
+		}
+	}
+	backendName := "backend"
+
+	if lb == nil {
+		lb = &proxy.LoadBalance{
+			Policy: proxy.PolicyRoundRobin,
+		}
+	}
+
+	candidatePool := []*proxy.PoolSpec{}
+	if len(canaryInstances) != 0 && canary != nil && len(canary.CanaryRules) != 0 {
+		index := newInstanceLabelIndex(canaryInstances)
+		// NOTE: An instance matching several rules is served only in the
+		// pool of the first of them applying to caller, the earlier rules
+		// take precedence.
+		placed := make(map[*ServiceInstanceSpec]bool)
+		for i, v := range canary.CanaryRules {
+			if !v.matchSource(caller) {
+				continue
+			}
+
+			servers := []*proxy.Server{}
+			for _, ins := range index.match(v) {
+				if placed[ins] {
+					continue
+				}
+				placed[ins] = true
+				servers = append(servers, &proxy.Server{
+					URL: ins.URL(scheme),
+				})
+			}
+			if len(servers) != 0 {
+				pool := &proxy.PoolSpec{
+					Name:             CanaryPoolName(i),
+					Filter:           v.filterSpec(),
+					ServersTags:      []string{},
+					Servers:          servers,
+					ServiceRegistry:  "",
+					ServiceName:      "",
+					LoadBalance:      lb,
+					OutlierDetection: od,
+				}
+				if len(v.SetHeaders) != 0 {
+					pool.RequestHeader = &httpheader.AdaptSpec{Set: v.SetHeaders}
+				}
+				candidatePool = append(candidatePool, pool)
+			}
+		}
+	}
+
+	filter := map[string]interface{}{
+		"kind": proxy.Kind,
+		"name": backendName,
+		"mainPool": &proxy.PoolSpec{
+			Servers:          mainServers,
+			LoadBalance:      lb,
+			OutlierDetection: od,
+		},
+		"candidatePools": candidatePool,
+	}
+	if len(candidatePool) != 0 {
+		filter["canaryBypassHeader"] = canary.BypassHeaderName()
+	}
+	if mirrorPool := mirrorPoolSpec(instanceSpecs, scheme, mirror, lb); mirrorPool != nil {
+		filter["mirrorPool"] = mirrorPool
+	}
+
+	b.Flow = append(b.Flow, httppipeline.Flow{Filter: backendName})
+	b.Filters = append(b.Filters, filter)
+
+	return b
+}
+
+// CanaryPoolName returns the name of the candidate pool generated from the
+// canary rule at ruleIndex.
+func CanaryPoolName(ruleIndex int) string {
+	return fmt.Sprintf("%s%d", CanaryPoolNamePrefix, ruleIndex)
+}
+
+// matchInstance reports whether the instance has any of the labels of the
+// rule, so it's in the candidate pool of the rule.
+func (r *CanaryRule) matchInstance(ins *ServiceInstanceSpec) bool {
+	for key, label := range r.ServiceInstanceLabels {
+		if insLabel, exists := ins.Label(key); exists && insLabel == label {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSource reports whether the requests from caller could match the rule.
+func (r *CanaryRule) matchSource(caller string) bool {
+	if len(r.SourceServices) == 0 {
+		return true
+	}
+	if caller == "" {
+		return false
+	}
+
+	for _, source := range r.SourceServices {
+		if source == caller {
+			return true
+		}
+	}
+
+	return false
+}
+
+// filterSpec returns the filter of the candidate pool, the source services
+// have been matched while building the pipeline.
+func (r *CanaryRule) filterSpec() *httpfilter.Spec {
+	if len(r.Headers) == 0 && len(r.URLs) == 0 {
+		return &httpfilter.Spec{
+			Probability: &httpfilter.Probability{
+				PerMill: 1000,
+				Policy:  "random",
+			},
+		}
+	}
+
+	return &httpfilter.Spec{
+		Headers: r.Headers,
+		URLs:    r.URLs,
+	}
+}
+
+// KeepNonPBFields keeps the fields of the old service which the pb spec
+// doesn't carry, they're updated by their own APIs. It must be called
+// before validating the service updated by the pb spec.
+func (s *Service) KeepNonPBFields(old *Service) {
+	s.Aliases = old.Aliases
+	s.AllowedCallers = old.AllowedCallers
+	s.Fallback = old.Fallback
+	s.DegradationProfiles = old.DegradationProfiles
+	s.ActiveDegradationProfile = old.ActiveDegradationProfile
+	s.EgressRoutes = old.EgressRoutes
+	s.HeaderManipulation = old.HeaderManipulation
+	s.CanaryPropagation = old.CanaryPropagation
+	s.DeadlinePropagation = old.DeadlinePropagation
+	s.ConnectionPool = old.ConnectionPool
+	s.FaultInjection = old.FaultInjection
+	s.Limits = old.Limits
+	s.Mirror = old.Mirror
+	s.HealthCheck = old.HealthCheck
+	s.Compression = old.Compression
+	s.Authentication = old.Authentication
+	if s.Sidecar != nil && old.Sidecar != nil {
+		s.Sidecar.MTLS = old.Sidecar.MTLS
+	}
+	if s.Canary != nil {
+		s.Canary.KeepNonPBFields(old.Canary)
+	}
+	if s.Resilience != nil {
+		s.Resilience.KeepNonPBFields(old.Resilience)
+	}
+	KeepLoadBalanceNonPBFields(s.LoadBalance, old.LoadBalance)
+	KeepObservabilityNonPBFields(s, old)
+}
+
+// KeepLoadBalanceNonPBFields keeps the consistent hash options of the old
+// load balance which the pb spec doesn't carry, if the policy is unchanged.
+func KeepLoadBalanceNonPBFields(lb, old *LoadBalance) {
+	if lb == nil || old == nil || lb.Policy != old.Policy {
+		return
+	}
+
+	lb.HashSource = old.HashSource
+	lb.HashKey = old.HashKey
+	lb.LoadFactor = old.LoadFactor
+}
+
+// KeepObservabilityNonPBFields keeps the access log, the output server
+// security, the trace context propagation and the baggage of the old
+// service which the pb spec doesn't carry.
+func KeepObservabilityNonPBFields(s, old *Service) {
+	if old.Observability == nil {
+		return
+	}
+
+	if old.Observability.AccessLog != nil {
+		if s.Observability == nil {
+			s.Observability = &Observability{}
+		}
+		s.Observability.AccessLog = old.Observability.AccessLog
+	}
+
+	// NOTE: The security goes with the output server, it's dropped along
+	// with it, so do the propagation, baggage and always sample with the
+	// tracings, and the output with the metrics.
+	if old.Observability.OutputServer != nil && s.Observability != nil && s.Observability.OutputServer != nil {
+		s.Observability.OutputServer.ObservabilityOutputServerSecurity = old.Observability.OutputServer.ObservabilityOutputServerSecurity
+	}
+	if old.Observability.Tracings != nil && s.Observability != nil && s.Observability.Tracings != nil {
+		s.Observability.Tracings.Propagation = old.Observability.Tracings.Propagation
+		s.Observability.Tracings.Baggage = old.Observability.Tracings.Baggage
+		s.Observability.Tracings.AlwaysSampleOnError = old.Observability.Tracings.AlwaysSampleOnError
+		s.Observability.Tracings.AlwaysSampleAboveLatencyMs = old.Observability.Tracings.AlwaysSampleAboveLatencyMs
+	}
+	if old.Observability.Metrics != nil && s.Observability != nil && s.Observability.Metrics != nil {
+		s.Observability.Metrics.Output = old.Observability.Metrics.Output
+		s.Observability.Metrics.StatsD = old.Observability.Metrics.StatsD
+	}
+}
+
+// KeepNonPBFields keeps the fields of old canary which the pb spec doesn't
+// carry, the source services and set headers are kept for the rules in the
+// same position with the same instance labels.
+func (c *Canary) KeepNonPBFields(old *Canary) {
+	if old == nil {
+		return
+	}
+
+	c.Bypass = old.Bypass
+	for i, rule := range c.CanaryRules {
+		if i >= len(old.CanaryRules) {
+			break
+		}
+		oldRule := old.CanaryRules[i]
+		if rule != nil && oldRule != nil &&
+			reflect.DeepEqual(rule.ServiceInstanceLabels, oldRule.ServiceInstanceLabels) {
+			rule.SourceServices = oldRule.SourceServices
+			rule.SetHeaders = oldRule.SetHeaders
+		}
+	}
+}
+
+// KeepNonPBFields keeps the fields of the old resilience which the pb spec
+// doesn't carry, the ones of policies are kept for the policies with the
+// same name, and the timeouts of URLs are kept for the URL rules in the
+// same position with the same URL and methods.
+func (r *Resilience) KeepNonPBFields(old *Resilience) {
+	if old == nil {
+		return
+	}
+
+	if r.RateLimiter != nil && old.RateLimiter != nil {
+		r.RateLimiter.Adaptive = old.RateLimiter.Adaptive
+		for _, p := range r.RateLimiter.Policies {
+			for _, oldP := range old.RateLimiter.Policies {
+				if p.Name == oldP.Name {
+					p.Algorithm = oldP.Algorithm
+				}
 			}
-			if len(servers) != 0 {
-				candidatePool = append(candidatePool, &proxy.PoolSpec{
-					Filter: &httpfilter.Spec{
-						Headers: v.Headers,
-						URLs:    v.URLs,
-					},
-					ServersTags:     []string{},
-					Servers:         servers,
-					ServiceRegistry: "",
-					ServiceName:     "",
-					LoadBalance:     lb,
-				})
+		}
+	}
+
+	if r.CircuitBreaker != nil && old.CircuitBreaker != nil {
+		for _, p := range r.CircuitBreaker.Policies {
+			for _, oldP := range old.CircuitBreaker.Policies {
+				if p.Name == oldP.Name {
+					p.MaxWaitDurationInOpen = oldP.MaxWaitDurationInOpen
+				}
 			}
 		}
 	}
 
-	b.Flow = append(b.Flow, httppipeline.Flow{Filter: backendName})
-	b.Filters = append(b.Filters, map[string]interface{}{
-		"kind": proxy.Kind,
-		"name": backendName,
-		"mainPool": &proxy.PoolSpec{
-			Servers:     mainServers,
-			LoadBalance: lb,
-		},
-		"candidatePools": candidatePool,
-	})
+	if r.Retryer != nil && old.Retryer != nil {
+		r.Retryer.Budget = old.Retryer.Budget
+		r.Retryer.RetryOnStatusCodes = old.Retryer.RetryOnStatusCodes
+		r.Retryer.RetryNonIdempotent = old.Retryer.RetryNonIdempotent
+		r.Retryer.IdempotencyKeyHeader = old.Retryer.IdempotencyKeyHeader
+	}
 
-	return b
+	if r.TimeLimiter != nil && old.TimeLimiter != nil {
+		for i, u := range r.TimeLimiter.URLs {
+			if i >= len(old.TimeLimiter.URLs) {
+				break
+			}
+			oldU := old.TimeLimiter.URLs[i]
+			if u.URL.Exact == oldU.URL.Exact && u.URL.Prefix == oldU.URL.Prefix &&
+				u.URL.RegEx == oldU.URL.RegEx && reflect.DeepEqual(u.Methods, oldU.Methods) {
+				u.TimeoutDuration = oldU.TimeoutDuration
+			}
+		}
+	}
+}
+
+func mirrorPoolSpec(instanceSpecs []*ServiceInstanceSpec, scheme string, mirror *Mirror, lb *proxy.LoadBalance) *proxy.PoolSpec {
+	if mirror == nil {
+		return nil
+	}
+
+	servers := []*proxy.Server{}
+	for _, ins := range instanceSpecs {
+		if ins.Status != ServiceStatusUp || (len(ins.Labels) == 0 && len(ins.Metadata) == 0) {
+			continue
+		}
+
+		match := true
+		for key, label := range mirror.ServiceInstanceLabels {
+			if insLabel, _ := ins.Label(key); insLabel != label {
+				match = false
+				break
+			}
+		}
+		if match {
+			servers = append(servers, &proxy.Server{
+				URL: ins.URL(scheme),
+			})
+		}
+	}
+
+	if len(servers) == 0 {
+		return nil
+	}
+
+	return &proxy.PoolSpec{
+		Filter: &httpfilter.Spec{
+			Probability: &httpfilter.Probability{
+				PerMill: mirror.Percentage * 10,
+				Policy:  "random",
+			},
+		},
+		Servers:     servers,
+		LoadBalance: lb,
+	}
 }
 
 func (b *pipelineSpecBuilder) appendProxy(mainServers []*proxy.Server, lb *proxy.LoadBalance) *pipelineSpecBuilder {
@@ -527,59 +2285,560 @@ func (b *pipelineSpecBuilder) appendProxy(mainServers []*proxy.Server, lb *proxy
 	return b
 }
 
+// setProxyCompression sets the compression of the proxies in the pipeline,
+// the proxy compresses the responses after receiving them from the backend.
+func (b *pipelineSpecBuilder) setProxyCompression(c *Compression) *pipelineSpecBuilder {
+	if c == nil {
+		return b
+	}
+
+	for _, filter := range b.Filters {
+		if filter["kind"] == proxy.Kind {
+			filter["compression"] = c
+		}
+	}
+
+	return b
+}
+
+// setProxyConnectionPool sets the connection pool of the proxies in the pipeline.
+func (b *pipelineSpecBuilder) setProxyConnectionPool(cp *ConnectionPool) *pipelineSpecBuilder {
+	if cp == nil {
+		return b
+	}
+
+	for _, filter := range b.Filters {
+		if filter["kind"] == proxy.Kind {
+			filter["connectionPool"] = cp
+		}
+	}
+
+	return b
+}
+
+// setProxyMTLS makes the proxies in the pipeline send requests over mTLS
+// with the certificates, the server certificates are verified by the name
+// of the target service.
+func (b *pipelineSpecBuilder) setProxyMTLS(certs *MTLSCerts, serviceName string) *pipelineSpecBuilder {
+	useHTTPS := func(pool *proxy.PoolSpec) {
+		if pool == nil {
+			return
+		}
+		for _, server := range pool.Servers {
+			server.URL = "https://" + strings.TrimPrefix(server.URL, "http://")
+		}
+	}
+
+	for _, filter := range b.Filters {
+		if filter["kind"] != proxy.Kind {
+			continue
+		}
+
+		filter["mtls"] = &proxy.MTLS{
+			CertBase64:     certs.Service.CertBase64,
+			KeyBase64:      certs.Service.KeyBase64,
+			RootCertBase64: certs.Root.CertBase64,
+			ServerName:     serviceName,
+		}
+
+		mainPool, _ := filter["mainPool"].(*proxy.PoolSpec)
+		useHTTPS(mainPool)
+		candidatePools, _ := filter["candidatePools"].([]*proxy.PoolSpec)
+		for _, pool := range candidatePools {
+			useHTTPS(pool)
+		}
+		mirrorPool, _ := filter["mirrorPool"].(*proxy.PoolSpec)
+		useHTTPS(mirrorPool)
+	}
+
+	return b
+}
+
 // IngressHTTPServerSpec generates HTTP server spec for ingress.
 // as ingress does not belong to a service, it is not a method of 'Service'
-func IngressHTTPServerSpec(port int, rules []*IngressRule) (*supervisor.Spec, error) {
-	const specFmt = `
-kind: HTTPServer
-name: mesh-ingress-server
-port: %d
-keepAlive: false
-https: false
-rules:`
+// It serves HTTPS with the certs if tlsSpec is not nil, the ingresses with
+// and without TLS are served by separate servers on separate ports, so the
+// name of the HTTPS one differs.
+func IngressHTTPServerSpec(port int, rules []*IngressRule, tlsSpec *IngressTLS) (*supervisor.Spec, error) {
+	// NOTE: The HTTP server matches rules and paths in order, so a broad path
+	// shadows the specific ones after it, the priority puts them ahead.
+	// For the same priority, the paths matching methods or headers go first.
+	err := ValidateIngressRules(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	sortedRules := append([]*IngressRule{}, rules...)
+	sort.SliceStable(sortedRules, func(i, j int) bool {
+		ri, rj := sortedRules[i], sortedRules[j]
+		if ri.Priority != rj.Priority {
+			return ri.Priority > rj.Priority
+		}
+		if ri.hostRank() != rj.hostRank() {
+			return ri.hostRank() < rj.hostRank()
+		}
+		if isWildcardHost(ri.Host) {
+			return len(ri.Host) > len(rj.Host)
+		}
+		return false
+	})
+
+	httpRules := []*httpserver.Rule{}
+	for _, r := range sortedRules {
+		paths := append([]*IngressPath{}, r.Paths...)
+		sort.SliceStable(paths, func(i, j int) bool {
+			if paths[i].Priority != paths[j].Priority {
+				return paths[i].Priority > paths[j].Priority
+			}
+			return paths[i].specificity() > paths[j].specificity()
+		})
+
+		rule := &httpserver.Rule{Host: r.Host}
+		if isWildcardHost(r.Host) {
+			rule = &httpserver.Rule{HostRegexp: wildcardHostRegexp(r.Host)}
+		}
+		for _, p := range paths {
+			pathRegexp, rewriteTarget := r.prefixRewrite(p)
+			path := &httpserver.Path{
+				PathRegexp:    pathRegexp,
+				RewriteTarget: rewriteTarget,
+				Methods:       p.Methods,
+				Backend:       p.Backend,
+			}
+			for _, h := range p.Headers {
+				path.Headers = append(path.Headers, &httpserver.Header{
+					Key:     h.Key,
+					Values:  h.Values,
+					Regexp:  h.Regexp,
+					Backend: p.Backend,
+				})
+			}
+			rule.Paths = append(rule.Paths, path)
+		}
+		httpRules = append(httpRules, rule)
+	}
+
+	config := map[string]interface{}{
+		"kind":      httpserver.Kind,
+		"name":      IngressHTTPServerName,
+		"port":      port,
+		"keepAlive": false,
+		"https":     false,
+		"rules":     httpRules,
+	}
+	if tlsSpec != nil && len(tlsSpec.Certs) != 0 {
+		config["name"] = IngressHTTPSServerName
+		config["https"] = true
+		config["certs"] = tlsSpec.Certs
+		config["keys"] = tlsSpec.Keys
+	}
+
+	buff, err := yaml.Marshal(config)
+	if err != nil {
+		logger.Errorf("BUG: marshal %#v to yaml failed: %v", config, err)
+		return nil, err
+	}
+
+	yamlConfig := string(buff)
+	spec, err := newSuperSpec(yamlConfig, false)
+	if err != nil {
+		logger.Errorf("BUG: new spec for %s failed: %v", yamlConfig, err)
+		return nil, err
+	}
+
+	return spec, nil
+}
+
+// PathFilters returns the filters applying to the path of the ingress,
+// nil means there is none.
+func (i *Ingress) PathFilters(p *IngressPath) *IngressPathFilters {
+	if i.RateLimit == nil && p.RateLimit == nil && i.CORS == nil && i.Compression == nil {
+		return nil
+	}
+
+	return &IngressPathFilters{
+		IngressName:      i.Name,
+		IngressRateLimit: i.RateLimit,
+		PathRateLimit:    p.RateLimit,
+		CORS:             i.CORS,
+		Compression:      i.Compression,
+	}
+}
+
+// Validate validates Ingress.
+func (i Ingress) Validate() error {
+	err := ValidateIngressRules(i.Rules)
+	if err != nil {
+		return fmt.Errorf("ingress %s: %v", i.Name, err)
+	}
+
+	if i.TLS == nil {
+		return nil
+	}
+
+	if len(i.TLS.Certs) == 0 {
+		return fmt.Errorf("ingress %s enables tls without certs", i.Name)
+	}
+
+	for host, cert := range i.TLS.Certs {
+		key, exists := i.TLS.Keys[host]
+		if !exists {
+			return fmt.Errorf("ingress %s: cert of host %s has no key", i.Name, host)
+		}
+		_, err := tls.X509KeyPair([]byte(cert), []byte(key))
+		if err != nil {
+			return fmt.Errorf("ingress %s: invalid cert/key of host %s: %v", i.Name, host, err)
+		}
+	}
+
+	for _, rule := range i.Rules {
+		if rule.Host == "" {
+			continue
+		}
+		if _, exists := i.TLS.Certs[rule.Host]; !exists {
+			return fmt.Errorf("ingress %s: host %s has no cert", i.Name, rule.Host)
+		}
+	}
+
+	return nil
+}
+
+// isWildcardHost reports whether the host is a wildcard one like *.example.com.
+func isWildcardHost(host string) bool {
+	return strings.HasPrefix(host, "*.")
+}
+
+// wildcardHostRegexp returns the regexp of the wildcard host, the "*"
+// matches one or more labels.
+func wildcardHostRegexp(host string) string {
+	return `^([^.]+\.)+` + regexp.QuoteMeta(host[2:]) + `$`
+}
 
-	const ruleFmt = `
-  - host: %s
-    paths:`
+// wildcardHostsOverlap reports whether some host matches both wildcard hosts.
+func wildcardHostsOverlap(a, b string) bool {
+	return strings.HasSuffix(a[1:], b[1:]) || strings.HasSuffix(b[1:], a[1:])
+}
+
+// prefixRewrite returns the path regexp and the rewrite target of the path
+// applying the prefix operations of the rule.
+func (r *IngressRule) prefixRewrite(p *IngressPath) (string, string) {
+	if p.RewriteTarget != "" || (r.StripPrefix == "" && r.AddPrefix == "") {
+		return p.Path, p.RewriteTarget
+	}
+
+	target := strings.ReplaceAll(r.AddPrefix, "$", "$$")
+	path := strings.TrimPrefix(p.Path, "^")
+	if r.StripPrefix == "" {
+		return "^(?:" + path + ")", target + "${0}"
+	}
+
+	prefix := regexp.QuoteMeta(r.StripPrefix)
+	return "^" + prefix + "(" + strings.TrimPrefix(path, prefix) + ")", target + "${1}"
+}
+
+// Validate validates IngressRule.
+func (r IngressRule) Validate() error {
+	if strings.HasSuffix(r.StripPrefix, "/") || strings.HasSuffix(r.AddPrefix, "/") {
+		return fmt.Errorf("stripPrefix %s and addPrefix %s must not end with /", r.StripPrefix, r.AddPrefix)
+	}
+
+	if r.StripPrefix == "" {
+		return nil
+	}
 
-	const pathFmt = `
-      - pathRegexp: %s
-        rewriteTarget: %s
-        backend: %s`
+	prefix := regexp.QuoteMeta(r.StripPrefix) + "/"
+	for _, p := range r.Paths {
+		if p.RewriteTarget != "" {
+			continue
+		}
+		if !strings.HasPrefix(strings.TrimPrefix(p.Path, "^"), prefix) {
+			return fmt.Errorf("path %s doesn't start with stripPrefix %s and /", p.Path, r.StripPrefix)
+		}
+	}
 
-	buf := bytes.Buffer{}
+	return nil
+}
 
-	str := fmt.Sprintf(specFmt, port)
-	buf.WriteString(str)
+// hostRank is the precedence of the host of the rule for the same priority,
+// the lower one is matched first.
+func (r *IngressRule) hostRank() int {
+	switch {
+	case r.Host == "":
+		return 2
+	case isWildcardHost(r.Host):
+		return 1
+	default:
+		return 0
+	}
+}
 
+// ValidateIngressRules validates the hosts of the rules, and rejects the
+// overlapping wildcard hosts with the same path and priority, since which
+// one serves the requests is ambiguous.
+func ValidateIngressRules(rules []*IngressRule) error {
 	for _, r := range rules {
-		str = fmt.Sprintf(ruleFmt, r.Host)
-		buf.WriteString(str)
-		for j := range r.Paths {
-			p := r.Paths[j]
-			str = fmt.Sprintf(pathFmt, p.Path, p.RewriteTarget, p.Backend)
-			buf.WriteString(str)
+		if !strings.Contains(r.Host, "*") {
+			continue
+		}
+		if !isWildcardHost(r.Host) || strings.Contains(r.Host[2:], "*") || r.Host == "*." {
+			return fmt.Errorf("invalid host %s: only a leading *. is allowed", r.Host)
+		}
+	}
+
+	for i, ri := range rules {
+		if !isWildcardHost(ri.Host) {
+			continue
+		}
+		for _, rj := range rules[i+1:] {
+			if !isWildcardHost(rj.Host) || ri.Priority != rj.Priority ||
+				!wildcardHostsOverlap(ri.Host, rj.Host) {
+				continue
+			}
+			for _, pi := range ri.Paths {
+				for _, pj := range rj.Paths {
+					if pi.Path == pj.Path {
+						return fmt.Errorf("ambiguous rules: wildcard hosts %s and %s overlap "+
+							"with the same path %s and priority %d", ri.Host, rj.Host, pi.Path, ri.Priority)
+					}
+				}
+			}
 		}
 	}
 
-	yamlConfig := buf.String()
-	spec, err := supervisor.NewSpec(yamlConfig)
+	return nil
+}
+
+// Validate validates IngressPath.
+// The references of RewriteTarget like $1 and ${name} must be groups of Path.
+func (p IngressPath) Validate() error {
+	re, err := regexp.Compile(p.Path)
 	if err != nil {
-		logger.Errorf("BUG: new spec for %s failed: %v", yamlConfig, err)
+		return fmt.Errorf("invalid path regexp %s: %v", p.Path, err)
+	}
+
+	if (p.Backend == "") == (len(p.Backends) == 0) {
+		return fmt.Errorf("path %s must specify exactly one of backend and backends", p.Path)
+	}
+
+	weights, services := 0, map[string]struct{}{}
+	for _, b := range p.Backends {
+		if _, exists := services[b.Service]; exists {
+			return fmt.Errorf("path %s has duplicated backend %s", p.Path, b.Service)
+		}
+		services[b.Service] = struct{}{}
+		weights += b.Weight
+	}
+	if len(p.Backends) != 0 && weights <= 0 {
+		return fmt.Errorf("weights of the backends of path %s sum to %d", p.Path, weights)
+	}
+
+	for _, match := range rewriteReferenceRegexp.FindAllStringSubmatch(p.RewriteTarget, -1) {
+		name := match[1] + match[2]
+		if name == "" {
+			// NOTE: It is the escaped $$.
+			continue
+		}
+
+		index, err := strconv.Atoi(name)
+		if err != nil {
+			if re.SubexpIndex(name) < 0 {
+				return fmt.Errorf("rewrite target %s references unknown group %s of path %s",
+					p.RewriteTarget, name, p.Path)
+			}
+			continue
+		}
+
+		if index > re.NumSubexp() {
+			return fmt.Errorf("rewrite target %s references group %d, but path %s has %d groups",
+				p.RewriteTarget, index, p.Path, re.NumSubexp())
+		}
+	}
+
+	return nil
+}
+
+// Validate validates IngressHeader.
+func (h IngressHeader) Validate() error {
+	if len(h.Values) == 0 && h.Regexp == "" {
+		return fmt.Errorf("both of values and regexp are empty for key: %s", h.Key)
+	}
+
+	return nil
+}
+
+// specificity returns how many kinds of conditions besides the path it has.
+func (p *IngressPath) specificity() int {
+	specificity := 0
+	if len(p.Methods) != 0 {
+		specificity++
+	}
+	if len(p.Headers) != 0 {
+		specificity++
+	}
+	return specificity
+}
+
+// IngressPipelineSpec generates a spec for ingress pipeline spec
+func (s *Service) IngressPipelineSpec(instanceSpecs []*ServiceInstanceSpec) (*supervisor.Spec, error) {
+	return s.IngressPathPipelineSpec(s.IngressPipelineName(), nil, instanceSpecs)
+}
+
+// IngressPathPipelineName returns the name of the mesh ingress pipeline
+// dedicated to a path with path filters.
+func IngressPathPipelineName(ingressName string, ruleIndex, pathIndex int) string {
+	return fmt.Sprintf("mesh-ingress-path-pipeline-%s-%d-%d", ingressName, ruleIndex, pathIndex)
+}
+
+// IngressPathPipelineSpec generates a spec for the mesh ingress pipeline of
+// the service with the path filters ahead of the proxy.
+func (s *Service) IngressPathPipelineSpec(name string, filters *IngressPathFilters,
+	instanceSpecs []*ServiceInstanceSpec) (*supervisor.Spec, error) {
+	// NOTE: The mesh ingress has no certificate, it never sends plain
+	// HTTP to the sidecars requiring mTLS.
+	if s.MTLSEnabled() {
+		return nil, fmt.Errorf("service %s requires mTLS, which mesh ingress does not support", s.Name)
+	}
+
+	pipelineSpecBuilder := newPipelineSpecBuilder(name)
+
+	// NOTE: The baggage from outside the mesh is untrusted, it's stripped
+	// before anything else unless the service allows it.
+	if s.stripsEdgeBaggage() {
+		pipelineSpecBuilder.appendBaggageStripper()
+	}
+	pipelineSpecBuilder.appendIngressPathFilters(filters)
+	if hasUpInstances(instanceSpecs) {
+		pipelineSpecBuilder.appendProxyWithCanary(instanceSpecs, s.defaultInstanceScheme(), s.Canary, "", s.LoadBalance, nil, nil)
+	} else {
+		pipelineSpecBuilder.appendNoAvailableInstances(s.Name)
+	}
+
+	compression := s.Compression
+	if filters != nil && filters.Compression != nil {
+		compression = filters.Compression
+	}
+	pipelineSpecBuilder.setProxyCompression(compression)
+	pipelineSpecBuilder.setProxyConnectionPool(s.ConnectionPool)
+
+	yamlConfig := pipelineSpecBuilder.yamlConfig()
+	superSpec, err := s.newSuperSpec(yamlConfig)
+	if err != nil {
+		logger.Errorf("new spec for %s failed: %v", yamlConfig, err)
 		return nil, err
 	}
 
-	return spec, nil
-}
+	return superSpec, nil
+}
+
+// IngressWeightedPipelineName returns the name of the mesh ingress pipeline
+// splitting the traffic among the weighted backends.
+func IngressWeightedPipelineName(backends []*IngressBackend) string {
+	parts := make([]string, 0, len(backends))
+	for _, b := range backends {
+		parts = append(parts, fmt.Sprintf("%s-%d", b.Service, b.Weight))
+	}
+	return "mesh-ingress-weighted-pipeline-" + strings.Join(parts, "-")
+}
+
+// IngressWeightedPipelineSpec generates a spec for the mesh ingress pipeline
+// splitting the traffic among the weighted backends, every backend gets a
+// pool of its UP instances. The backends without UP instances are skipped,
+// so their share goes to the others, the requests are responded 503 if
+// none of them has UP instances.
+func IngressWeightedPipelineSpec(name string, filters *IngressPathFilters, backends []*IngressBackend,
+	services map[string]*Service, instanceSpecs map[string][]*ServiceInstanceSpec) (*supervisor.Spec, error) {
+	type weightedPool struct {
+		weight int
+		pool   *proxy.PoolSpec
+	}
+
+	pools := []*weightedPool{}
+	for _, b := range backends {
+		service := services[b.Service]
+		if b.Weight <= 0 || service == nil {
+			continue
+		}
+		if service.MTLSEnabled() {
+			return nil, fmt.Errorf("service %s requires mTLS, which mesh ingress does not support", service.Name)
+		}
+
+		servers := []*proxy.Server{}
+		for _, ins := range instanceSpecs[b.Service] {
+			if ins.Status == ServiceStatusUp {
+				servers = append(servers, &proxy.Server{URL: ins.URL(service.defaultInstanceScheme())})
+			}
+		}
+		if len(servers) == 0 {
+			continue
+		}
+
+		lb := service.LoadBalance
+		if lb == nil {
+			lb = &proxy.LoadBalance{Policy: proxy.PolicyRoundRobin}
+		}
+		pools = append(pools, &weightedPool{
+			weight: b.Weight,
+			pool:   &proxy.PoolSpec{Servers: servers, LoadBalance: lb},
+		})
+	}
+
+	builder := newPipelineSpecBuilder(name)
+	// NOTE: The baggage is stripped if any backend doesn't allow it, as
+	// the requests could go to any of them.
+	for _, b := range backends {
+		if service := services[b.Service]; service != nil && service.stripsEdgeBaggage() {
+			builder.appendBaggageStripper()
+			break
+		}
+	}
+	builder.appendIngressPathFilters(filters)
 
-// IngressPipelineSpec generates a spec for ingress pipeline spec
-func (s *Service) IngressPipelineSpec(instanceSpecs []*ServiceInstanceSpec) (*supervisor.Spec, error) {
-	pipelineSpecBuilder := newPipelineSpecBuilder(s.IngressPipelineName())
+	if len(pools) == 0 {
+		serviceNames := make([]string, 0, len(backends))
+		for _, b := range backends {
+			serviceNames = append(serviceNames, b.Service)
+		}
+		builder.appendNoAvailableInstances(strings.Join(serviceNames, ","))
+	} else {
+		// NOTE: The proxy tries the candidate pools in order, so the probability
+		// of every candidate is its weight over the weights not taken yet, the
+		// last backend is the main pool taking the rest.
+		remaining := 0
+		for _, p := range pools {
+			remaining += p.weight
+		}
+		candidatePools := []*proxy.PoolSpec{}
+		for _, p := range pools[:len(pools)-1] {
+			perMill := uint32(p.weight * 1000 / remaining)
+			if perMill == 0 {
+				perMill = 1
+			}
+			p.pool.Filter = &httpfilter.Spec{
+				Probability: &httpfilter.Probability{
+					PerMill: perMill,
+					Policy:  "random",
+				},
+			}
+			candidatePools = append(candidatePools, p.pool)
+			remaining -= p.weight
+		}
 
-	pipelineSpecBuilder.appendProxyWithCanary(instanceSpecs, s.Canary, s.LoadBalance)
+		builder.Flow = append(builder.Flow, httppipeline.Flow{Filter: "backend"})
+		builder.Filters = append(builder.Filters, map[string]interface{}{
+			"kind":           proxy.Kind,
+			"name":           "backend",
+			"mainPool":       pools[len(pools)-1].pool,
+			"candidatePools": candidatePools,
+		})
+		// NOTE: The backends may compress differently, so only the compression
+		// of the ingress applies here.
+		if filters != nil {
+			builder.setProxyCompression(filters.Compression)
+		}
+	}
 
-	yamlConfig := pipelineSpecBuilder.yamlConfig()
-	superSpec, err := supervisor.NewSpec(yamlConfig)
+	yamlConfig := builder.yamlConfig()
+	superSpec, err := newSuperSpec(yamlConfig, false)
 	if err != nil {
 		logger.Errorf("new spec for %s failed: %v", yamlConfig, err)
 		return nil, err
@@ -588,8 +2847,10 @@ func (s *Service) IngressPipelineSpec(instanceSpecs []*ServiceInstanceSpec) (*su
 	return superSpec, nil
 }
 
-// SideCarIngressHTTPServerSpec generates a spec for sidecar ingress HTTP server
-func (s *Service) SideCarIngressHTTPServerSpec() (*supervisor.Spec, error) {
+// SideCarIngressHTTPServerSpec generates a spec for sidecar ingress HTTP server.
+// It serves HTTPS requiring the client certificates signed by the mesh CA
+// if the sidecar enables mTLS, the certs are required then.
+func (s *Service) SideCarIngressHTTPServerSpec(certs *MTLSCerts) (*supervisor.Spec, error) {
 	ingressHTTPServerFormat := `
 kind: HTTPServer
 name: %s
@@ -605,7 +2866,25 @@ rules:
 	pipelineName := fmt.Sprintf("mesh-ingress-pipeline-%s", s.Name)
 	yamlConfig := fmt.Sprintf(ingressHTTPServerFormat, name, s.Sidecar.IngressPort, pipelineName)
 
-	superSpec, err := supervisor.NewSpec(yamlConfig)
+	if s.MTLSEnabled() {
+		if certs == nil || certs.Root == nil || certs.Service == nil {
+			return nil, fmt.Errorf("certificates of service %s are not issued yet", s.Name)
+		}
+
+		yamlConfig = strings.Replace(yamlConfig, "https: false", "https: true", 1)
+		yamlConfig += fmt.Sprintf("\ncertBase64: %s\nkeyBase64: %s\ncaCertBase64: %s\n",
+			certs.Service.CertBase64, certs.Service.KeyBase64, certs.Root.CertBase64)
+	}
+
+	if t := s.sidecarTracingSpec(); t != nil {
+		buff, err := yaml.Marshal(map[string]interface{}{"tracing": t})
+		if err != nil {
+			return nil, fmt.Errorf("BUG: marshal tracing %#v to yaml failed: %v", t, err)
+		}
+		yamlConfig += "\n" + string(buff)
+	}
+
+	superSpec, err := s.newSuperSpec(yamlConfig)
 	if err != nil {
 		logger.Errorf("new spec for %s failed: %v", yamlConfig, err)
 		return nil, err
@@ -614,7 +2893,44 @@ rules:
 	return superSpec, nil
 }
 
-// UniqueCanaryHeaders returns the unique headers in canary filter rules.
+// sidecarTracingSpec returns the tracing of the sidecar ingress, it only
+// samples the failed or slow requests since the others are sampled by the
+// agent, nil means the sidecar records no span.
+func (s *Service) sidecarTracingSpec() *tracing.Spec {
+	o := s.Observability
+	if !o.TracingsEnabled() || !o.Tracings.Output.Enabled ||
+		o.OutputServer == nil || !o.OutputServer.Enabled {
+		return nil
+	}
+
+	t := o.Tracings
+	if !t.AlwaysSampleOnError && t.AlwaysSampleAboveLatencyMs == 0 {
+		return nil
+	}
+
+	kafka := o.OutputServer.kafkaSpec(t.Output.Topic)
+	return &tracing.Spec{
+		ServiceName: s.Name,
+		Zipkin: &zipkin.Spec{
+			SampleRate: 0,
+			Kafka: &zipkin.KafkaSpec{
+				Brokers: kafka.Brokers,
+				Topic:   kafka.Topic,
+				Timeout: kafka.Timeout,
+				SASL:    kafka.SASL,
+				TLS:     kafka.TLS,
+			},
+			QueuedMaxSpans: t.Output.QueuedMaxSpans,
+		},
+		AlwaysSample: &tracing.AlwaysSampleSpec{
+			OnError:        t.AlwaysSampleOnError,
+			AboveLatencyMs: t.AlwaysSampleAboveLatencyMs,
+		},
+	}
+}
+
+// UniqueCanaryHeaders returns the unique headers in canary filter rules,
+// including the headers set by them.
 func (s *Service) UniqueCanaryHeaders() []string {
 	var headers []string
 	if s.Canary == nil || len(s.Canary.CanaryRules) == 0 {
@@ -626,15 +2942,302 @@ func (s *Service) UniqueCanaryHeaders() []string {
 			for k := range canaryRule.Headers {
 				keys[k] = true
 			}
+			for k := range canaryRule.SetHeaders {
+				keys[k] = true
+			}
 		}
 	}
 
 	for k := range keys {
 		headers = append(headers, k)
 	}
+	sort.Strings(headers)
 	return headers
 }
 
+// BypassHeaderName returns the header forcing the requests to the main
+// instances.
+func (c *Canary) BypassHeaderName() string {
+	if c.Bypass != nil && c.Bypass.Header != "" {
+		return c.Bypass.Header
+	}
+	return DefaultCanaryBypassHeader
+}
+
+func (f *Fallback) validate(serviceName string) error {
+	if (f.URL == "") == (f.Service == "") {
+		return fmt.Errorf("fallback of service %s needs either url or service", serviceName)
+	}
+	if f.Service == serviceName {
+		return fmt.Errorf("service %s falls back to itself", serviceName)
+	}
+	if f.URL == "" {
+		return nil
+	}
+
+	u, err := url.Parse(f.URL)
+	if err != nil {
+		return fmt.Errorf("invalid fallback url %q of service %s: %v", f.URL, serviceName, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("invalid fallback url %q of service %s: want http(s)://host[:port]", f.URL, serviceName)
+	}
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return fmt.Errorf("invalid fallback url %q of service %s: only scheme and host are allowed", f.URL, serviceName)
+	}
+
+	return nil
+}
+
+// DeadlineHeaderName returns the header carrying the time budget, empty
+// means the service doesn't propagate deadlines.
+func (s *Service) DeadlineHeaderName() string {
+	if s.DeadlinePropagation == nil {
+		return ""
+	}
+	if s.DeadlinePropagation.Header != "" {
+		return s.DeadlinePropagation.Header
+	}
+	return DefaultDeadlineHeader
+}
+
+// CanaryPropagationHeaders returns the canary headers propagated from the
+// ingress requests to the egress requests, default is UniqueCanaryHeaders.
+func (s *Service) CanaryPropagationHeaders() []string {
+	if s.CanaryPropagation != nil && len(s.CanaryPropagation.Headers) != 0 {
+		return s.CanaryPropagation.Headers
+	}
+	return s.UniqueCanaryHeaders()
+}
+
+// Validate validates Service.
+func (s Service) Validate() error {
+	for _, alias := range s.Aliases {
+		if alias == "" || alias == s.Name {
+			return fmt.Errorf("invalid alias %q of service %s", alias, s.Name)
+		}
+	}
+
+	if s.HealthCheck != nil && s.HealthCheck.Path == "" && !s.GRPCHealthCheck() {
+		return fmt.Errorf("health check of service %s has no path", s.Name)
+	}
+
+	if s.Fallback != nil {
+		if err := s.Fallback.validate(s.Name); err != nil {
+			return err
+		}
+	}
+
+	if s.Sidecar == nil {
+		return nil
+	}
+
+	if net.ParseIP(s.Sidecar.Address) != nil {
+		return nil
+	}
+
+	if !hostnameRegexp.MatchString(s.Sidecar.Address) {
+		return fmt.Errorf("invalid sidecar address %q: neither an IP nor a hostname", s.Sidecar.Address)
+	}
+
+	return nil
+}
+
+// MTLSEnabled returns whether the sidecar of the service enables mTLS.
+func (s *Service) MTLSEnabled() bool {
+	return s.Sidecar != nil && s.Sidecar.MTLS
+}
+
+// defaultInstanceScheme returns the scheme of the instances advertising no
+// scheme, which is the sidecar egress protocol if it's a valid scheme.
+func (s *Service) defaultInstanceScheme() string {
+	if s.Sidecar != nil && validInstanceScheme(s.Sidecar.EgressProtocol) {
+		return s.Sidecar.EgressProtocol
+	}
+	return InstanceSchemeHTTP
+}
+
+// GRPCHealthCheck returns whether the application is probed with the gRPC
+// Health Checking Protocol.
+func (s *Service) GRPCHealthCheck() bool {
+	return s.Sidecar != nil && strings.EqualFold(s.Sidecar.IngressProtocol, SidecarProtocolGRPC)
+}
+
+// ResolveSidecarAddress checks the sidecar address is resolvable if it is
+// a hostname.
+func (s *Service) ResolveSidecarAddress() error {
+	if s.Sidecar == nil || net.ParseIP(s.Sidecar.Address) != nil {
+		return nil
+	}
+
+	_, err := net.LookupHost(s.Sidecar.Address)
+	if err != nil {
+		return fmt.Errorf("resolve sidecar address %s failed: %v", s.Sidecar.Address, err)
+	}
+
+	return nil
+}
+
+// ValidateCanaryRules checks the number of canary rules doesn't exceed
+// maxRules and every rule has match criteria. The criteria are not checked
+// in the validation of the rule, because the pb spec doesn't carry the
+// source services, which are kept from the stored spec afterwards.
+func (s *Service) ValidateCanaryRules(maxRules int) error {
+	if s.Canary == nil {
+		return nil
+	}
+
+	if len(s.Canary.CanaryRules) > maxRules {
+		return fmt.Errorf("service %s has %d canary rules, exceeds the limit %d",
+			s.Name, len(s.Canary.CanaryRules), maxRules)
+	}
+
+	for i, r := range s.Canary.CanaryRules {
+		if len(r.Headers) == 0 && len(r.URLs) == 0 && len(r.SourceServices) == 0 {
+			return fmt.Errorf("canary rule %d of service %s: none of headers, urls and sourceServices is specified",
+				i, s.Name)
+		}
+	}
+
+	return nil
+}
+
+// ValidateHeaderManipulation checks the request header removals don't strip
+// the headers used for routing, which are the canary headers and EgressServiceHeader.
+func (s *Service) ValidateHeaderManipulation(globalCanaryHeaders []string) error {
+	if s.HeaderManipulation == nil {
+		return nil
+	}
+
+	routingHeaders := append([]string{EgressServiceHeader}, globalCanaryHeaders...)
+	routingHeaders = append(routingHeaders, s.UniqueCanaryHeaders()...)
+
+	for _, rules := range []*HeaderRules{s.HeaderManipulation.Ingress, s.HeaderManipulation.Egress} {
+		if rules == nil || rules.Request == nil {
+			continue
+		}
+		for _, key := range rules.Request.Del {
+			for _, header := range routingHeaders {
+				if http.CanonicalHeaderKey(key) == http.CanonicalHeaderKey(header) {
+					return fmt.Errorf("service %s removes routing header %s", s.Name, key)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// ValidateDegradationProfiles checks the profile names are unique and the active one exists.
+func (s *Service) ValidateDegradationProfiles() error {
+	names := map[string]struct{}{}
+	for _, profile := range s.DegradationProfiles {
+		if _, exists := names[profile.Name]; exists {
+			return fmt.Errorf("service %s has duplicated degradation profile %s", s.Name, profile.Name)
+		}
+		names[profile.Name] = struct{}{}
+	}
+
+	if s.ActiveDegradationProfile != "" && s.DegradationProfile(s.ActiveDegradationProfile) == nil {
+		return fmt.Errorf("service %s has no degradation profile %s", s.Name, s.ActiveDegradationProfile)
+	}
+
+	return nil
+}
+
+// SetTimestamps sets UpdatedAt to now, and keeps CreatedAt of the old spec,
+// nil old spec means the service is created now.
+func (s *Service) SetTimestamps(oldSpec *Service, now time.Time) {
+	s.CreatedAt = now.Format(time.RFC3339)
+	if oldSpec != nil && oldSpec.CreatedAt != "" {
+		s.CreatedAt = oldSpec.CreatedAt
+	}
+	s.UpdatedAt = now.Format(time.RFC3339)
+}
+
+// SoftDelete marks the service deleted at now.
+func (s *Service) SoftDelete(now time.Time) {
+	s.DeletedAt = now.Format(time.RFC3339)
+}
+
+// Restore unmarks the soft-deleted service.
+func (s *Service) Restore() {
+	s.DeletedAt = ""
+}
+
+// SoftDeleted returns whether the service is soft-deleted.
+func (s *Service) SoftDeleted() bool {
+	return s.DeletedAt != ""
+}
+
+// DeletionExpired returns whether the soft-deleted service is kept longer
+// than the retention, which should be hard-deleted.
+func (s *Service) DeletionExpired(retention time.Duration, now time.Time) bool {
+	if !s.SoftDeleted() {
+		return false
+	}
+
+	deletedAt, err := time.Parse(time.RFC3339, s.DeletedAt)
+	if err != nil {
+		return true
+	}
+	return !now.Before(deletedAt.Add(retention))
+}
+
+// WithTenantDefaults returns a copy of the service inheriting the default
+// resilience of the tenant, the service itself is not changed.
+// The pipelines built from the copy use the effective resilience.
+func (s *Service) WithTenantDefaults(tenant *Tenant) *Service {
+	if tenant == nil || tenant.DefaultResilience == nil {
+		return s
+	}
+
+	service := *s
+	service.Resilience = s.Resilience.MergeDefaults(tenant.DefaultResilience)
+	return &service
+}
+
+// MergeDefaults returns the resilience whose unset fields are taken from the
+// defaults, so a service could override just the circuit breaker.
+func (r *Resilience) MergeDefaults(defaults *Resilience) *Resilience {
+	if defaults == nil {
+		return r
+	}
+
+	merged := *defaults
+	if r == nil {
+		return &merged
+	}
+
+	if r.RateLimiter != nil {
+		merged.RateLimiter = r.RateLimiter
+	}
+	if r.CircuitBreaker != nil {
+		merged.CircuitBreaker = r.CircuitBreaker
+	}
+	if r.Retryer != nil {
+		merged.Retryer = r.Retryer
+	}
+	if r.TimeLimiter != nil {
+		merged.TimeLimiter = r.TimeLimiter
+	}
+	if r.OutlierDetection != nil {
+		merged.OutlierDetection = r.OutlierDetection
+	}
+
+	return &merged
+}
+
+// DegradationProfile returns the degradation profile by name, nil means not found.
+func (s *Service) DegradationProfile(name string) *DegradationProfile {
+	for _, profile := range s.DegradationProfiles {
+		if profile.Name == name {
+			return profile
+		}
+	}
+	return nil
+}
+
 // EgressHTTPServerName returns egress HTTP server name
 func (s *Service) EgressHTTPServerName() string {
 	return fmt.Sprintf("mesh-egress-server-%s", s.Name)
@@ -684,7 +3287,7 @@ https: false
 		s.EgressHTTPServerName(),
 		s.Sidecar.EgressPort)
 
-	superSpec, err := supervisor.NewSpec(yamlConfig)
+	superSpec, err := s.newSuperSpec(yamlConfig)
 	if err != nil {
 		logger.Errorf("new spec for %s failed: %v", err)
 		return nil, err
@@ -693,10 +3296,168 @@ https: false
 	return superSpec, nil
 }
 
+// Validate validates EgressRoute.
+func (r EgressRoute) Validate() error {
+	if r.Host == "" && r.PathPrefix == "" {
+		return fmt.Errorf("egress route to %s has neither host nor pathPrefix", r.Service)
+	}
+	return nil
+}
+
+// EgressUnmatchedPipelineName returns the name of the pipeline serving the
+// egress requests matching no target service.
+func (s *Service) EgressUnmatchedPipelineName() string {
+	return fmt.Sprintf("mesh-egress-unmatched-pipeline-%s", s.Name)
+}
+
+// SideCarEgressUnmatchedPipelineSpec generates a spec for the pipeline
+// responding 503 to the egress requests matching no target service.
+func (s *Service) SideCarEgressUnmatchedPipelineSpec() (*supervisor.Spec, error) {
+	pipelineSpecBuilder := newPipelineSpecBuilder(s.EgressUnmatchedPipelineName())
+
+	body := fmt.Sprintf("no target service matches the egress request of %s, "+
+		"set header %s to the service name, use the service name as the host, "+
+		"or add an egress route for it\n", s.Name, EgressServiceHeader)
+	pipelineSpecBuilder.appendMock([]*mock.Rule{{
+		PathPrefix: "/",
+		Code:       http.StatusServiceUnavailable,
+		Headers:    map[string]string{"Content-Type": "text/plain"},
+		Body:       body,
+	}})
+
+	yamlConfig := pipelineSpecBuilder.yamlConfig()
+	superSpec, err := s.newSuperSpec(yamlConfig)
+	if err != nil {
+		logger.Errorf("new spec for %s failed: %v", yamlConfig, err)
+		return nil, err
+	}
+
+	return superSpec, nil
+}
+
+// SideCarEgressHTTPServerRules generates the rules of the sidecar egress HTTP
+// server, targets maps the target service names to their egress pipeline names.
+// A request with EgressServiceHeader goes to the target service it names.
+// A request without the header goes to the first matched egress route, then
+// to the target service whose name equals to the host. Other requests go to
+// the unmatched pipeline which responds 503.
+// NOTE: All paths carry header conditions, since the HTTP server caches the
+// routing of paths without headers by host, method and path.
+func (s *Service) SideCarEgressHTTPServerRules(targets map[string]string) []*httpserver.Rule {
+	names := make([]string, 0, len(targets))
+	for name := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// NOTE: The backend of the path is used, the one of the header is only to pass validation.
+	noServiceHeader := func(backend string) []*httpserver.Header {
+		return []*httpserver.Header{{Key: EgressServiceHeader, Regexp: "^$", Backend: backend}}
+	}
+
+	rules := []*httpserver.Rule{}
+	for _, name := range names {
+		rules = append(rules, &httpserver.Rule{
+			Paths: []*httpserver.Path{{
+				PathPrefix: "/",
+				Headers: []*httpserver.Header{{
+					Key:     EgressServiceHeader,
+					Values:  []string{name},
+					Backend: targets[name],
+				}},
+				Backend: targets[name],
+			}},
+		})
+	}
+
+	for _, route := range s.EgressRoutes {
+		backend, exists := targets[route.Service]
+		if !exists {
+			continue
+		}
+		pathPrefix := route.PathPrefix
+		if pathPrefix == "" {
+			pathPrefix = "/"
+		}
+		rules = append(rules, &httpserver.Rule{
+			Host: route.Host,
+			Paths: []*httpserver.Path{{
+				PathPrefix: pathPrefix,
+				Headers:    noServiceHeader(backend),
+				Backend:    backend,
+			}},
+		})
+	}
+
+	for _, name := range names {
+		rules = append(rules, &httpserver.Rule{
+			Host: name,
+			Paths: []*httpserver.Path{{
+				PathPrefix: "/",
+				Headers:    noServiceHeader(targets[name]),
+				Backend:    targets[name],
+			}},
+		})
+	}
+
+	rules = append(rules, &httpserver.Rule{
+		Paths: []*httpserver.Path{{
+			PathPrefix: "/",
+			Headers: []*httpserver.Header{{
+				Key:     EgressServiceHeader,
+				Regexp:  ".*",
+				Backend: s.EgressUnmatchedPipelineName(),
+			}},
+			Backend: s.EgressUnmatchedPipelineName(),
+		}},
+	})
+
+	return rules
+}
+
+// MockShadowsCanary reports whether the enabled mock rules catch all requests,
+// so that the canary rules can't be hit at all.
+func (s *Service) MockShadowsCanary() bool {
+	if s.Mock == nil || !s.Mock.Enabled || s.Canary == nil || len(s.Canary.CanaryRules) == 0 {
+		return false
+	}
+
+	for _, rule := range s.Mock.Rules {
+		if rule.Conditional() {
+			continue
+		}
+		if rule.Path == "" && (rule.PathPrefix == "" || rule.PathPrefix == "/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Conditional reports whether all mock rules are only activated by
+// matching request headers, so the real backend still serves the others.
+func (m *Mock) Conditional() bool {
+	if len(m.Rules) == 0 {
+		return false
+	}
+
+	for _, rule := range m.Rules {
+		if !rule.Conditional() {
+			return false
+		}
+	}
+	return true
+}
+
 // Runnable indicates this service is runnable inside mesh or not.
 //   e.g., If this is a mock service, there is not need to be deployed and run.
+//   But a service with only conditional mocks is still runnable.
+//   The soft-deleted service is not runnable.
 func (s *Service) Runnable() bool {
-	if s.Mock != nil && s.Mock.Enabled {
+	if s.SoftDeleted() {
+		return false
+	}
+	if s.Mock != nil && s.Mock.Enabled && !s.Mock.Conditional() {
 		return false
 	}
 	return true
@@ -710,16 +3471,47 @@ func (s *Service) SideCarIngressPipelineSpec(applicationPort uint32) (*superviso
 		},
 	}
 
+	var headerRules *HeaderRules
+	if s.HeaderManipulation != nil {
+		headerRules = s.HeaderManipulation.Ingress
+	}
+
 	pipelineSpecBuilder := newPipelineSpecBuilder(s.IngressPipelineName())
 
+	// NOTE: The access logger goes first, so it logs the requests rejected
+	// by any filter, with the paths and headers as they're received.
+	pipelineSpecBuilder.appendAccessLogger(s.Observability, mainServers[0].URL)
+	pipelineSpecBuilder.appendBodyLimiter(s.Limits)
+
+	// NOTE: The trace context is translated before anything else reads the
+	// headers, so the application only sees the emitted format.
+	pipelineSpecBuilder.appendTracePropagator(s.Observability)
+
+	// NOTE: The requests are authenticated before the headers are adapted,
+	// so the adaptor can remove the credentials from the requests.
+	pipelineSpecBuilder.appendAuthenticator(s.Authentication)
+
+	// NOTE: The request headers are adapted before any routing,
+	// and before the canary headers are recorded for propagation.
+	pipelineSpecBuilder.appendRequestHeaderAdaptor(headerRules)
+	pipelineSpecBuilder.appendHeaderPropagator(headerpropagator.ModeRecord, s)
+	pipelineSpecBuilder.appendDeadlinePropagator(headerpropagator.ModeRecord, s)
+	pipelineSpecBuilder.appendBaggagePropagator(headerpropagator.ModeRecord, s)
+
 	if s.Resilience != nil {
 		pipelineSpecBuilder.appendRateLimiter(s.Resilience.RateLimiter)
 	}
 
+	// NOTE: The faults are injected right before the application, as if it
+	// fails or slows down, the requests rejected earlier are not affected.
+	pipelineSpecBuilder.appendFaultInjector(s.FaultInjection)
 	pipelineSpecBuilder.appendProxy(mainServers, s.LoadBalance)
+	pipelineSpecBuilder.setProxyCompression(s.Compression)
+	pipelineSpecBuilder.setProxyConnectionPool(s.ConnectionPool)
+	pipelineSpecBuilder.appendResponseHeaderAdaptor(headerRules)
 
 	yamlConfig := pipelineSpecBuilder.yamlConfig()
-	superSpec, err := supervisor.NewSpec(yamlConfig)
+	superSpec, err := s.newSuperSpec(yamlConfig)
 	if err != nil {
 		logger.Errorf("new spec for %s failed: %v", yamlConfig, err)
 		return nil, err
@@ -730,22 +3522,122 @@ func (s *Service) SideCarIngressPipelineSpec(applicationPort uint32) (*superviso
 
 // SideCarEgressPipelineSpec returns a spec for sidecar egress pipeline
 func (s *Service) SideCarEgressPipelineSpec(instanceSpecs []*ServiceInstanceSpec) (*supervisor.Spec, error) {
+	return s.SideCarEgressPipelineSpecForCaller(nil, instanceSpecs, nil)
+}
+
+// SideCarEgressPipelineSpecForCaller returns a spec for the sidecar egress
+// pipeline in the sidecar of caller, which adapts the headers by the egress
+// header rules of caller. The caller could be nil.
+// The pipeline sends requests over mTLS with the certs of caller if both
+// sidecars enable mTLS, it fails if only one of them enables it, so the
+// traffic never falls back to plain HTTP.
+func (s *Service) SideCarEgressPipelineSpecForCaller(caller *Service, instanceSpecs []*ServiceInstanceSpec,
+	certs *MTLSCerts) (*supervisor.Spec, error) {
+	return s.SideCarEgressPipelineSpecWithFallback(caller, instanceSpecs, nil, nil, certs)
+}
+
+// SideCarEgressPipelineSpecWithFallback is SideCarEgressPipelineSpecForCaller
+// with the spec and instances of the fallback service, which are used if
+// the fallback of the service is a mesh service. Both could be nil.
+func (s *Service) SideCarEgressPipelineSpecWithFallback(caller *Service, instanceSpecs []*ServiceInstanceSpec,
+	fallback *Service, fallbackInstanceSpecs []*ServiceInstanceSpec, certs *MTLSCerts) (*supervisor.Spec, error) {
+	useMTLS := false
+	if caller != nil {
+		switch {
+		case s.MTLSEnabled() && !caller.MTLSEnabled():
+			return nil, fmt.Errorf("service %s requires mTLS, but caller %s disables it", s.Name, caller.Name)
+		case !s.MTLSEnabled() && caller.MTLSEnabled():
+			return nil, fmt.Errorf("caller %s requires mTLS, but service %s disables it", caller.Name, s.Name)
+		case s.MTLSEnabled():
+			if certs == nil || certs.Root == nil || certs.Service == nil {
+				return nil, fmt.Errorf("certificates of caller %s are not issued yet", caller.Name)
+			}
+			useMTLS = true
+		}
+	}
+
+	var headerRules *HeaderRules
+	if caller != nil && caller.HeaderManipulation != nil {
+		headerRules = caller.HeaderManipulation.Egress
+	}
+
 	pipelineSpecBuilder := newPipelineSpecBuilder(s.EgressPipelineName())
 
-	if !s.Runnable() {
-		pipelineSpecBuilder.appendMock(s.Mock.Rules)
-	} else {
+	// NOTE: The request headers are adapted before mock and canary matching,
+	// the canary headers of the ingress request are propagated if missing.
+	pipelineSpecBuilder.appendRequestHeaderAdaptor(headerRules)
+
+	// NOTE: The caller's trace context is emitted in the format of the
+	// callee, the application of the caller may use any accepted format.
+	pipelineSpecBuilder.appendTracePropagator(s.Observability)
+	deadlineHeader := ""
+	if caller != nil {
+		pipelineSpecBuilder.appendHeaderPropagator(headerpropagator.ModeApply, caller)
+		pipelineSpecBuilder.appendDeadlinePropagator(headerpropagator.ModeApply, caller)
+		pipelineSpecBuilder.appendBaggagePropagator(headerpropagator.ModeApply, caller)
+		deadlineHeader = caller.DeadlineHeaderName()
+	}
+
+	degradation := s.DegradationProfile(s.ActiveDegradationProfile)
+	if degradation == nil {
+		degradation = &DegradationProfile{}
+	}
+
+	// NOTE: The mock rules take precedence, the unmatched requests fall through
+	// to the canary and main routing if there are real instances.
+	mockRules := append([]*mock.Rule{}, degradation.MockRules...)
+	if s.Mock != nil && s.Mock.Enabled {
+		mockRules = append(mockRules, s.Mock.Rules...)
+	}
+	pipelineSpecBuilder.appendMock(mockRules)
+
+	// NOTE: The requests unmatched by the mocks go to the fallback or are
+	// responded explicitly instead of failed by a proxy without servers.
+	if s.Runnable() && !hasUpInstances(instanceSpecs) {
+		if servers := s.fallbackServers(fallback, fallbackInstanceSpecs); len(servers) != 0 {
+			pipelineSpecBuilder.appendFallback(s.Name, servers)
+		} else {
+			pipelineSpecBuilder.appendNoAvailableInstances(s.Name)
+		}
+	} else if s.Runnable() || hasUpInstances(instanceSpecs) {
+		var tl *timelimiter.Spec
+		if s.Resilience != nil {
+			tl = s.Resilience.TimeLimiter
+		}
+		// NOTE: The requests are limited by the time budget propagated by
+		// the caller even if the service has no time limiter.
+		pipelineSpecBuilder.appendTimeLimiter(tl, deadlineHeader)
 		if s.Resilience != nil {
-			pipelineSpecBuilder.appendTimeLimiter(s.Resilience.TimeLimiter)
-			pipelineSpecBuilder.appendRetryer(s.Resilience.Retryer)
+			if !degradation.DisableRetryer {
+				pipelineSpecBuilder.appendRetryer(s.Resilience.Retryer)
+			}
 			pipelineSpecBuilder.appendCircuitBreaker(s.Resilience.CircuitBreaker)
 		}
 
-		pipelineSpecBuilder.appendProxyWithCanary(instanceSpecs, s.Canary, s.LoadBalance)
+		canary := s.Canary
+		if degradation.DisableCanary {
+			canary = nil
+		}
+
+		var od *OutlierDetection
+		if s.Resilience != nil {
+			od = s.Resilience.OutlierDetection
+		}
+		callerName := ""
+		if caller != nil {
+			callerName = caller.Name
+		}
+		pipelineSpecBuilder.appendProxyWithCanary(instanceSpecs, s.defaultInstanceScheme(), canary, callerName,
+			s.LoadBalance, od, s.Mirror)
+		pipelineSpecBuilder.setProxyConnectionPool(s.ConnectionPool)
+		if useMTLS {
+			pipelineSpecBuilder.setProxyMTLS(certs, s.Name)
+		}
+		pipelineSpecBuilder.appendResponseHeaderAdaptor(headerRules)
 	}
 
 	yamlConfig := pipelineSpecBuilder.yamlConfig()
-	superSpec, err := supervisor.NewSpec(yamlConfig)
+	superSpec, err := s.newSuperSpec(yamlConfig)
 	if err != nil {
 		logger.Errorf("new spec for %s failed: %v", yamlConfig, err)
 		return nil, err
@@ -754,17 +3646,56 @@ func (s *Service) SideCarEgressPipelineSpec(instanceSpecs []*ServiceInstanceSpec
 	return superSpec, nil
 }
 
+// fallbackServers returns the servers of the fallback of the service, the
+// fallback service requiring mTLS is not supported and gets no servers.
+func (s *Service) fallbackServers(fallback *Service, fallbackInstanceSpecs []*ServiceInstanceSpec) []*proxy.Server {
+	if s.Fallback == nil {
+		return nil
+	}
+	if s.Fallback.URL != "" {
+		return []*proxy.Server{{URL: strings.TrimSuffix(s.Fallback.URL, "/")}}
+	}
+	if fallback == nil || fallback.Name != s.Fallback.Service || fallback.MTLSEnabled() {
+		return nil
+	}
+
+	servers := []*proxy.Server{}
+	for _, instanceSpec := range fallbackInstanceSpecs {
+		if instanceSpec.Status == ServiceStatusUp {
+			servers = append(servers, &proxy.Server{
+				URL: instanceSpec.URL(fallback.defaultInstanceScheme()),
+			})
+		}
+	}
+	return servers
+}
+
+// NoAvailableInstancesError returns the error of the service without UP
+// instances, it wraps ErrServiceNotavailable.
+func NoAvailableInstancesError(serviceName string) error {
+	return fmt.Errorf("%w %s", ErrServiceNotavailable, serviceName)
+}
+
+func hasUpInstances(instanceSpecs []*ServiceInstanceSpec) bool {
+	for _, instanceSpec := range instanceSpecs {
+		if instanceSpec.Status == ServiceStatusUp {
+			return true
+		}
+	}
+	return false
+}
+
 // ApplicationEndpoint returns application endpoint URL string
 func (s *Service) ApplicationEndpoint(port uint32) string {
-	return fmt.Sprintf("%s://%s:%d", s.Sidecar.IngressProtocol, s.Sidecar.Address, port)
+	return s.Sidecar.IngressProtocol + "://" + net.JoinHostPort(s.Sidecar.Address, strconv.Itoa(int(port)))
 }
 
 // IngressEndpoint returns Ingress endpoint URL string
 func (s *Service) IngressEndpoint() string {
-	return fmt.Sprintf("%s://%s:%d", s.Sidecar.IngressProtocol, s.Sidecar.Address, s.Sidecar.IngressPort)
+	return s.Sidecar.IngressProtocol + "://" + net.JoinHostPort(s.Sidecar.Address, strconv.Itoa(s.Sidecar.IngressPort))
 }
 
 // EgressEndpoint returns Egress endpoint URL string
 func (s *Service) EgressEndpoint() string {
-	return fmt.Sprintf("%s://%s:%d", s.Sidecar.EgressProtocol, s.Sidecar.Address, s.Sidecar.EgressPort)
+	return s.Sidecar.EgressProtocol + "://" + net.JoinHostPort(s.Sidecar.Address, strconv.Itoa(s.Sidecar.EgressPort))
 }
@@ -18,20 +18,45 @@
 package spec
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"math/big"
+	"net/http"
 	"os"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
 
 	"github.com/megaease/easegress/pkg/filter/circuitbreaker"
+	"github.com/megaease/easegress/pkg/filter/corsadaptor"
+	"github.com/megaease/easegress/pkg/filter/faultinjector"
+	"github.com/megaease/easegress/pkg/filter/headerpropagator"
 	"github.com/megaease/easegress/pkg/filter/mock"
 	"github.com/megaease/easegress/pkg/filter/proxy"
 	"github.com/megaease/easegress/pkg/filter/ratelimiter"
 	"github.com/megaease/easegress/pkg/filter/retryer"
 	"github.com/megaease/easegress/pkg/filter/timelimiter"
+	"github.com/megaease/easegress/pkg/filter/validator"
 	"github.com/megaease/easegress/pkg/logger"
-	_ "github.com/megaease/easegress/pkg/object/httpserver"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/object/httpserver"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/texttemplate"
 	"github.com/megaease/easegress/pkg/util/urlrule"
+	"github.com/megaease/easegress/pkg/v"
 	v1alpha1 "github.com/megaease/easemesh-api/v1alpha1"
 )
 
@@ -63,6 +88,427 @@ func TestSideCarIngressPipelineSpec(t *testing.T) {
 	fmt.Println(superSpec.YAMLConfig())
 }
 
+func TestSideCarIngressPipelineSpecWithLimits(t *testing.T) {
+	s := &Service{
+		Name: "order-008-limits",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+	}
+
+	flowNames := func() []string {
+		superSpec, err := s.SideCarIngressPipelineSpec(443)
+		if err != nil {
+			t.Fatalf("generate ingress pipeline failed: %v", err)
+		}
+		names := []string{}
+		for _, flow := range superSpec.ObjectSpec().(*httppipeline.Spec).Flow {
+			names = append(names, flow.Filter)
+		}
+		return names
+	}
+
+	if names := flowNames(); len(names) != 1 || names[0] != "backend" {
+		t.Errorf("service without limits should only proxy, got %v", names)
+	}
+
+	s.Limits = &Limits{MaxRequestBodyBytes: 1 << 20}
+	if names := flowNames(); len(names) != 2 || names[0] != "bodyLimiter" || names[1] != "backend" {
+		t.Errorf("service with limits should limit body first, got %v", names)
+	}
+}
+
+func TestSideCarIngressPipelineSpecWithAccessLog(t *testing.T) {
+	s := &Service{
+		Name: "order-009-accesslog",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+		Limits: &Limits{MaxRequestBodyBytes: 1 << 20},
+		Observability: &Observability{
+			OutputServer: &ObservabilityOutputServer{
+				Enabled:         true,
+				BootstrapServer: "kafka-0:9092,kafka-1:9092",
+				Timeout:         3000,
+			},
+			AccessLog: &ObservabilityAccessLog{
+				Enabled:         true,
+				SampleRate:      0.5,
+				HeaderAllowlist: []string{"X-Request-Id"},
+				Output:          AccessLogOutputServer,
+			},
+		},
+	}
+
+	superSpec, err := s.SideCarIngressPipelineSpec(443)
+	if err != nil {
+		t.Fatalf("generate ingress pipeline failed: %v", err)
+	}
+
+	pipelineSpec := superSpec.ObjectSpec().(*httppipeline.Spec)
+	if pipelineSpec.Flow[0].Filter != "accessLogger" || pipelineSpec.Flow[1].Filter != "bodyLimiter" {
+		t.Errorf("access logger should go first, got %v", pipelineSpec.Flow)
+	}
+
+	yamlConfig := superSpec.YAMLConfig()
+	for _, want := range []string{"kind: AccessLogger", "sampleRate: 0.5", "upstream: http://127.0.0.1:443",
+		"output: kafka", "- kafka-1:9092", "topic: " + DefaultAccessLogTopic, "- X-Request-Id"} {
+		if !strings.Contains(yamlConfig, want) {
+			t.Errorf("want %q in ingress pipeline:\n%s", want, yamlConfig)
+		}
+	}
+
+	s.Observability.OutputServer.Enabled = false
+	if err := s.Observability.Validate(); err == nil {
+		t.Errorf("want error for access log output to disabled output server")
+	}
+
+	s.Observability.AccessLog.Enabled = false
+	superSpec, err = s.SideCarIngressPipelineSpec(443)
+	if err != nil {
+		t.Fatalf("generate ingress pipeline failed: %v", err)
+	}
+	if strings.Contains(superSpec.YAMLConfig(), "AccessLogger") {
+		t.Errorf("disabled access log should not be in ingress pipeline")
+	}
+}
+
+func TestSideCarIngressHTTPServerSpecWithAlwaysSample(t *testing.T) {
+	s := &Service{
+		Name: "order-009-alwayssample",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+		Observability: &Observability{
+			OutputServer: &ObservabilityOutputServer{
+				Enabled:         true,
+				BootstrapServer: "kafka-0:9092,kafka-1:9092",
+				Timeout:         3000,
+			},
+			Tracings: &ObservabilityTracings{
+				Enabled:                    true,
+				AlwaysSampleOnError:        true,
+				AlwaysSampleAboveLatencyMs: 500,
+				Output: ObservabilityTracingsOutputConfig{
+					Enabled:        true,
+					Topic:          "log-tracing",
+					QueuedMaxSpans: 200,
+				},
+			},
+		},
+	}
+
+	superSpec, err := s.SideCarIngressHTTPServerSpec(nil)
+	if err != nil {
+		t.Fatalf("generate ingress http server failed: %v", err)
+	}
+
+	tracing := superSpec.ObjectSpec().(*httpserver.Spec).Tracing
+	if tracing == nil {
+		t.Fatalf("want tracing in ingress http server:\n%s", superSpec.YAMLConfig())
+	}
+	if tracing.ServiceName != s.Name || tracing.Zipkin.SampleRate != 0 || tracing.Zipkin.QueuedMaxSpans != 200 {
+		t.Errorf("unexpected tracing %+v", tracing)
+	}
+	if kafka := tracing.Zipkin.Kafka; kafka == nil || kafka.Topic != "log-tracing" || len(kafka.Brokers) != 2 {
+		t.Errorf("unexpected tracing kafka %+v", kafka)
+	}
+	if as := tracing.AlwaysSample; as == nil || !as.OnError || as.AboveLatencyMs != 500 {
+		t.Errorf("unexpected always sample %+v", as)
+	}
+
+	s.Observability.Tracings.AlwaysSampleOnError = false
+	s.Observability.Tracings.AlwaysSampleAboveLatencyMs = 0
+	superSpec, err = s.SideCarIngressHTTPServerSpec(nil)
+	if err != nil {
+		t.Fatalf("generate ingress http server failed: %v", err)
+	}
+	if superSpec.ObjectSpec().(*httpserver.Spec).Tracing != nil {
+		t.Errorf("ingress http server without always sample should not trace")
+	}
+}
+
+func TestSideCarPipelineSpecWithTracePropagation(t *testing.T) {
+	s := &Service{
+		Name: "order-010-tracepropagation",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+		Observability: &Observability{
+			Tracings: &ObservabilityTracings{
+				Enabled: true,
+				Propagation: &ObservabilityTracingsPropagation{
+					Format: "tracecontext",
+					Accept: []string{"tracecontext", "b3", "jaeger"},
+				},
+			},
+		},
+	}
+
+	superSpec, err := s.SideCarIngressPipelineSpec(443)
+	if err != nil {
+		t.Fatalf("generate ingress pipeline failed: %v", err)
+	}
+	pipelineSpec := superSpec.ObjectSpec().(*httppipeline.Spec)
+	if pipelineSpec.Flow[0].Filter != "tracePropagator" {
+		t.Errorf("trace propagator should go first, got %v", pipelineSpec.Flow)
+	}
+
+	yamlConfig := superSpec.YAMLConfig()
+	for _, want := range []string{"kind: TracePropagator", "emit: tracecontext", "- b3", "- jaeger"} {
+		if !strings.Contains(yamlConfig, want) {
+			t.Errorf("want %q in ingress pipeline:\n%s", want, yamlConfig)
+		}
+	}
+
+	superSpec, err = s.SideCarEgressPipelineSpec([]*ServiceInstanceSpec{})
+	if err != nil {
+		t.Fatalf("generate egress pipeline failed: %v", err)
+	}
+	if !strings.Contains(superSpec.YAMLConfig(), "kind: TracePropagator") {
+		t.Errorf("want trace propagator in egress pipeline:\n%s", superSpec.YAMLConfig())
+	}
+
+	s.Observability.Tracings.Propagation.Accept = []string{"zipkin"}
+	if err := s.Observability.Tracings.Propagation.Validate(); err == nil {
+		t.Errorf("want error for unsupported accepted format")
+	}
+
+	s.Observability.Tracings.Enabled = false
+	superSpec, err = s.SideCarIngressPipelineSpec(443)
+	if err != nil {
+		t.Fatalf("generate ingress pipeline failed: %v", err)
+	}
+	if strings.Contains(superSpec.YAMLConfig(), "TracePropagator") {
+		t.Errorf("disabled tracings should not propagate trace context")
+	}
+}
+
+func TestKeepObservabilityNonPBFields(t *testing.T) {
+	propagation := &ObservabilityTracingsPropagation{Format: "b3"}
+	old := &Service{
+		Observability: &Observability{
+			Tracings: &ObservabilityTracings{
+				Enabled:                    true,
+				Propagation:                propagation,
+				AlwaysSampleOnError:        true,
+				AlwaysSampleAboveLatencyMs: 500,
+			},
+			Metrics: &ObservabilityMetrics{
+				Enabled: true,
+				Output:  MetricsOutputStatsD,
+				StatsD:  &ObservabilityMetricsStatsD{Host: "127.0.0.1", Port: 8125},
+			},
+		},
+	}
+
+	s := &Service{
+		Observability: &Observability{
+			Tracings: &ObservabilityTracings{Enabled: true},
+			Metrics:  &ObservabilityMetrics{Enabled: true},
+		},
+	}
+	KeepObservabilityNonPBFields(s, old)
+	if s.Observability.Tracings.Propagation != propagation {
+		t.Errorf("want propagation kept")
+	}
+	if !s.Observability.Tracings.AlwaysSampleOnError || s.Observability.Tracings.AlwaysSampleAboveLatencyMs != 500 {
+		t.Errorf("want always sample kept")
+	}
+	if s.Observability.Metrics.Output != MetricsOutputStatsD || s.Observability.Metrics.StatsD != old.Observability.Metrics.StatsD {
+		t.Errorf("want metrics output kept")
+	}
+
+	s = &Service{}
+	KeepObservabilityNonPBFields(s, old)
+	if s.Observability != nil {
+		t.Errorf("want propagation dropped with the tracings")
+	}
+}
+
+func TestTracingsBaggage(t *testing.T) {
+	order := &Service{
+		Name: "order",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+		Observability: &Observability{
+			Tracings: &ObservabilityTracings{
+				Enabled: true,
+				Baggage: &ObservabilityTracingsBaggage{
+					Keys:    []string{"tenant", "tier"},
+					MaxKeys: 4,
+				},
+			},
+		},
+	}
+	payment := &Service{
+		Name:    "payment",
+		Sidecar: order.Sidecar,
+	}
+	instanceSpecs := []*ServiceInstanceSpec{{
+		ServiceName: "order",
+		InstanceID:  "order-1",
+		IP:          "192.168.0.110",
+		Port:        80,
+		Status:      ServiceStatusUp,
+	}}
+
+	superSpec, err := order.SideCarIngressPipelineSpec(8000)
+	if err != nil {
+		t.Fatalf("generate ingress pipeline failed: %v", err)
+	}
+	yamlConfig := superSpec.YAMLConfig()
+	for _, want := range []string{"name: baggageRecorder", "store: order-baggage", "- tenant", "maxKeys: 4"} {
+		if !strings.Contains(yamlConfig, want) {
+			t.Errorf("want %q in ingress pipeline:\n%s", want, yamlConfig)
+		}
+	}
+
+	superSpec, err = payment.SideCarEgressPipelineSpecForCaller(order, instanceSpecs, nil)
+	if err != nil {
+		t.Fatalf("generate egress pipeline failed: %v", err)
+	}
+	if !strings.Contains(superSpec.YAMLConfig(), "name: baggageApplier") {
+		t.Errorf("want baggage applied by the caller:\n%s", superSpec.YAMLConfig())
+	}
+
+	superSpec, err = order.IngressPipelineSpec(instanceSpecs)
+	if err != nil {
+		t.Fatalf("generate mesh ingress pipeline failed: %v", err)
+	}
+	pipelineSpec := superSpec.ObjectSpec().(*httppipeline.Spec)
+	if pipelineSpec.Flow[0].Filter != "baggageStripper" {
+		t.Errorf("want baggage stripped at the mesh edge, got %v", pipelineSpec.Flow)
+	}
+
+	order.Observability.Tracings.Baggage.AllowFromEdge = true
+	superSpec, err = order.IngressPipelineSpec(instanceSpecs)
+	if err != nil {
+		t.Fatalf("generate mesh ingress pipeline failed: %v", err)
+	}
+	if strings.Contains(superSpec.YAMLConfig(), "baggageStripper") {
+		t.Errorf("allowed baggage should not be stripped at the mesh edge")
+	}
+
+	order.Observability.Tracings.Enabled = false
+	if order.TracingsBaggage() != nil {
+		t.Errorf("want no baggage propagated with tracings disabled")
+	}
+}
+
+func TestObservabilityOutputServerSASL(t *testing.T) {
+	setTestSecrets(map[string]string{"kafka-password": "kafka-pass"})
+	defer setTestSecrets(nil)
+	caCert, _ := newTestCertKey(t, "kafka-ca")
+	caCertBase64 := base64.StdEncoding.EncodeToString([]byte(caCert))
+
+	outputServer := &ObservabilityOutputServer{
+		Enabled:         true,
+		BootstrapServer: "kafka-0:9093",
+		Timeout:         3000,
+		ObservabilityOutputServerSecurity: ObservabilityOutputServerSecurity{
+			SASLMechanism: "SCRAM-SHA-512",
+			SASLUsername:  "easegress",
+			SASLPassword:  "${secret:kafka-password}",
+			TLSEnabled:    true,
+			CACertBase64:  caCertBase64,
+		},
+	}
+	if err := outputServer.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, c := range []struct {
+		name   string
+		modify func(s *ObservabilityOutputServer)
+	}{
+		{"mechanism without credentials", func(s *ObservabilityOutputServer) { s.SASLUsername = "" }},
+		{"credentials without mechanism", func(s *ObservabilityOutputServer) { s.SASLMechanism = "" }},
+		{"plain text password", func(s *ObservabilityOutputServer) { s.SASLPassword = "kafka-pass" }},
+		{"env password", func(s *ObservabilityOutputServer) { s.SASLPassword = "${env:KAFKA_PASSWORD}" }},
+		{"ca cert without tls", func(s *ObservabilityOutputServer) { s.TLSEnabled = false }},
+		{"invalid ca cert", func(s *ObservabilityOutputServer) { s.CACertBase64 = "Y2EtY2VydA==" }},
+	} {
+		s := *outputServer
+		c.modify(&s)
+		if err := s.Validate(); err == nil {
+			t.Errorf("want error for %s", c.name)
+		}
+	}
+
+	s := &Service{
+		Name: "order-012-kafka",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+		Observability: &Observability{
+			OutputServer: outputServer,
+			Tracings: &ObservabilityTracings{
+				Output: ObservabilityTracingsOutputConfig{QueuedMaxSpans: 2000, QueuedMaxSize: 4000000},
+			},
+			AccessLog: &ObservabilityAccessLog{
+				Enabled:    true,
+				SampleRate: 1,
+				Output:     AccessLogOutputServer,
+			},
+		},
+	}
+	superSpec, err := s.SideCarIngressPipelineSpec(443)
+	if err != nil {
+		t.Fatalf("generate ingress pipeline failed: %v", err)
+	}
+	yamlConfig := superSpec.YAMLConfig()
+	for _, want := range []string{"mechanism: SCRAM-SHA-512", "username: easegress", "password: kafka-pass",
+		"caCertBase64: " + caCertBase64, "bufferMaxLines: 2000", "bufferMaxBytes: 4000000"} {
+		if !strings.Contains(yamlConfig, want) {
+			t.Errorf("want %q in ingress pipeline:\n%s", want, yamlConfig)
+		}
+	}
+
+	agent := s.Observability.AgentObservability()
+	if agent.OutputServer.SASLPassword != "kafka-pass" {
+		t.Errorf("want password resolved for the agent, got %q", agent.OutputServer.SASLPassword)
+	}
+	if outputServer.SASLPassword != "${secret:kafka-password}" {
+		t.Errorf("the output server itself should not be changed")
+	}
+
+	outputServer.SASLMechanism, outputServer.SASLUsername, outputServer.SASLPassword = "", "", ""
+	outputServer.TLSEnabled, outputServer.CACertBase64 = false, ""
+	superSpec, err = s.SideCarIngressPipelineSpec(443)
+	if err != nil {
+		t.Fatalf("generate ingress pipeline failed: %v", err)
+	}
+	if yamlConfig := superSpec.YAMLConfig(); strings.Contains(yamlConfig, "sasl") || strings.Contains(yamlConfig, "tls") {
+		t.Errorf("want plaintext kafka without sasl and tls:\n%s", yamlConfig)
+	}
+}
+
 func TestAdminInValidat(t *testing.T) {
 	a := Admin{
 		RegistryType:      "unknow",
@@ -622,68 +1068,491 @@ func TestIngressHTTPServerSpec(t *testing.T) {
 		},
 	}
 
-	_, err := IngressHTTPServerSpec(1233, rule)
+	_, err := IngressHTTPServerSpec(1233, rule, nil)
 
 	if err != nil {
 		t.Errorf("ingress http server spec failed: %v", err)
 	}
 
 }
-func TestSideCarIngressWithResiliencePipelineSpec(t *testing.T) {
-	s := &Service{
-		Name: "order-001",
-		LoadBalance: &LoadBalance{
-			Policy: proxy.PolicyRandom,
-		},
-		Sidecar: &Sidecar{
-			Address:         "127.0.0.1",
-			IngressPort:     8080,
-			IngressProtocol: "http",
-			EgressPort:      9090,
-			EgressProtocol:  "http",
+
+func TestIngressHTTPServerSpecPriority(t *testing.T) {
+	rules := []*IngressRule{
+		{
+			Paths: []*IngressPath{
+				{
+					Path:    "/.*",
+					Backend: "fallback",
+				},
+			},
 		},
-		Resilience: &Resilience{
-			RateLimiter: &ratelimiter.Spec{
-				Policies: []*ratelimiter.Policy{{
-					Name:               "default",
-					TimeoutDuration:    "100ms",
-					LimitForPeriod:     50,
-					LimitRefreshPeriod: "10ms",
-				}},
-				DefaultPolicyRef: "default",
-				URLs: []*ratelimiter.URLRule{{
-					URLRule: urlrule.URLRule{
-						Methods: []string{"GET"},
-						URL: urlrule.StringMatch{
-							Exact:  "/path1",
-							Prefix: "/path2/",
-							RegEx:  "^/path3/[0-9]+$",
-						},
-						PolicyRef: "default",
-					},
-				}},
+		{
+			Host: "megaease.com",
+			Paths: []*IngressPath{
+				{
+					Path:    "/api.*",
+					Backend: "api",
+				},
+				{
+					Path:     "/api/v2/foo.*",
+					Backend:  "foo",
+					Priority: 10,
+				},
+				{
+					Path:    "/api/v1.*",
+					Backend: "api-v1",
+				},
 			},
+			Priority: 1,
 		},
 	}
 
-	superSpec, _ := s.SideCarIngressPipelineSpec(443)
-	fmt.Println(superSpec.YAMLConfig())
+	superSpec, err := IngressHTTPServerSpec(1233, rules, nil)
+	if err != nil {
+		t.Fatalf("ingress http server spec failed: %v", err)
+	}
+
+	serverSpec := superSpec.ObjectSpec().(*httpserver.Spec)
+	if serverSpec.Rules[0].Host != "megaease.com" || serverSpec.Rules[1].Host != "" {
+		t.Errorf("rule with higher priority should be matched first")
+	}
+
+	backends := []string{}
+	for _, path := range serverSpec.Rules[0].Paths {
+		backends = append(backends, path.Backend)
+	}
+	if !reflect.DeepEqual(backends, []string{"foo", "api", "api-v1"}) {
+		t.Errorf("/api/v2/foo should win over /api, got %v", backends)
+	}
+
+	if rules[1].Paths[0].Backend != "api" {
+		t.Errorf("the input rules should not be reordered")
+	}
 }
 
-func TestSideCarEgressResiliencePipelineSpec(t *testing.T) {
-	s := &Service{
-		Name: "order-001",
-		LoadBalance: &LoadBalance{
-			Policy: proxy.PolicyIPHash,
+func TestIngressHTTPServerSpecWildcardHost(t *testing.T) {
+	rules := []*IngressRule{
+		{
+			Paths: []*IngressPath{{Path: "/.*", Backend: "fallback"}},
 		},
-		Sidecar: &Sidecar{
-			Address:         "127.0.0.1",
-			IngressPort:     8080,
-			IngressProtocol: "http",
-			EgressPort:      9090,
-			EgressProtocol:  "http",
+		{
+			Host:  "*.example.com",
+			Paths: []*IngressPath{{Path: "/.*", Backend: "example"}},
 		},
-
+		{
+			Host:  "*.api.example.com",
+			Paths: []*IngressPath{{Path: "/v1.*", Backend: "api-v1"}},
+		},
+		{
+			Host:  "foo.api.example.com",
+			Paths: []*IngressPath{{Path: "/.*", Backend: "foo"}},
+		},
+	}
+
+	superSpec, err := IngressHTTPServerSpec(1233, rules, nil)
+	if err != nil {
+		t.Fatalf("ingress http server spec failed: %v", err)
+	}
+
+	serverSpec := superSpec.ObjectSpec().(*httpserver.Spec)
+	backends := []string{}
+	for _, rule := range serverSpec.Rules {
+		backends = append(backends, rule.Paths[0].Backend)
+	}
+	if !reflect.DeepEqual(backends, []string{"foo", "api-v1", "example", "fallback"}) {
+		t.Errorf("want exact hosts, longer wildcards, then any host, got %v", backends)
+	}
+
+	re := regexp.MustCompile(serverSpec.Rules[1].HostRegexp)
+	if serverSpec.Rules[1].Host != "" {
+		t.Errorf("wildcard host should be matched by regexp, got host %s", serverSpec.Rules[1].Host)
+	}
+	for host, want := range map[string]bool{
+		"foo.api.example.com":     true,
+		"a.b.api.example.com":     true,
+		"api.example.com":         false,
+		"fooapi.example.com":      false,
+		"foo.api.example.com.cn":  false,
+		"foo.api-example.com":     false,
+		"foo.api.example.com:80":  false,
+		"foo.bar.api.example.com": true,
+	} {
+		if got := re.MatchString(host); got != want {
+			t.Errorf("host %s: want match %v, got %v", host, want, got)
+		}
+	}
+}
+
+func TestIngressHTTPServerSpecPrefix(t *testing.T) {
+	rules := []*IngressRule{
+		{
+			StripPrefix: "/api",
+			Paths: []*IngressPath{
+				{Path: "/api/users.*", Backend: "users"},
+				{Path: "^/api/orders/(.*)", RewriteTarget: "/v2/orders/$1", Backend: "orders"},
+			},
+		},
+		{
+			Host:        "foo.megaease.com",
+			StripPrefix: "/api",
+			AddPrefix:   "/v1",
+			Paths:       []*IngressPath{{Path: "/api/.*", Backend: "foo"}},
+		},
+		{
+			Host:      "bar.megaease.com",
+			AddPrefix: "/bar",
+			Paths:     []*IngressPath{{Path: "/.*", Backend: "bar"}},
+		},
+	}
+
+	superSpec, err := IngressHTTPServerSpec(1233, rules, nil)
+	if err != nil {
+		t.Fatalf("ingress http server spec failed: %v", err)
+	}
+
+	rewrite := func(p *httpserver.Path, path string) string {
+		re := regexp.MustCompile(p.PathRegexp)
+		if !re.MatchString(path) {
+			t.Fatalf("path %s should match %s", path, p.PathRegexp)
+		}
+		return re.ReplaceAllString(path, p.RewriteTarget)
+	}
+
+	serverSpec := superSpec.ObjectSpec().(*httpserver.Spec)
+	rewrites := map[string]string{}
+	for _, rule := range serverSpec.Rules {
+		for _, p := range rule.Paths {
+			switch p.Backend {
+			case "users":
+				rewrites["users"] = rewrite(p, "/api/users/1")
+			case "orders":
+				rewrites["orders"] = rewrite(p, "/api/orders/2")
+			case "foo":
+				rewrites["foo"] = rewrite(p, "/api/foo")
+			case "bar":
+				rewrites["bar"] = rewrite(p, "/bar")
+			}
+		}
+	}
+
+	want := map[string]string{
+		"users":  "/users/1",
+		"orders": "/v2/orders/2",
+		"foo":    "/v1/foo",
+		"bar":    "/bar/bar",
+	}
+	if !reflect.DeepEqual(rewrites, want) {
+		t.Errorf("want rewrites %v, got %v", want, rewrites)
+	}
+
+	if err := (IngressRule{StripPrefix: "/api", Paths: []*IngressPath{{Path: "/users", Backend: "users"}}}).Validate(); err == nil {
+		t.Errorf("want error for path not starting with stripPrefix")
+	}
+	if err := (IngressRule{AddPrefix: "/api/", Paths: []*IngressPath{{Path: "/users", Backend: "users"}}}).Validate(); err == nil {
+		t.Errorf("want error for prefix ending with /")
+	}
+	if err := rules[0].Validate(); err != nil {
+		t.Errorf("path with rewrite target should be exempted from stripPrefix: %v", err)
+	}
+}
+
+func TestValidateIngressRules(t *testing.T) {
+	for _, host := range []string{"*", "*.", "foo.*.com", "*.*.com", "*foo.com"} {
+		rules := []*IngressRule{{Host: host, Paths: []*IngressPath{{Path: "/", Backend: "foo"}}}}
+		if err := ValidateIngressRules(rules); err == nil {
+			t.Errorf("want error for host %s", host)
+		}
+	}
+
+	rules := []*IngressRule{
+		{Host: "*.example.com", Paths: []*IngressPath{{Path: "/api", Backend: "foo"}}},
+		{Host: "*.api.example.com", Paths: []*IngressPath{{Path: "/api", Backend: "bar"}}},
+	}
+	if err := ValidateIngressRules(rules); err == nil {
+		t.Errorf("want error for overlapping wildcard hosts with the same path")
+	}
+	if err := (Ingress{Name: "ingress", Rules: rules}).Validate(); err == nil {
+		t.Errorf("want error for ingress with overlapping wildcard hosts")
+	}
+	if _, err := IngressHTTPServerSpec(1233, rules, nil); err == nil {
+		t.Errorf("want error for server spec with overlapping wildcard hosts")
+	}
+
+	rules[1].Priority = 1
+	if err := ValidateIngressRules(rules); err != nil {
+		t.Errorf("different priorities should not be ambiguous: %v", err)
+	}
+
+	rules[1].Priority = 0
+	rules[1].Host = "*.example.org"
+	if err := ValidateIngressRules(rules); err != nil {
+		t.Errorf("disjoint wildcard hosts should not be ambiguous: %v", err)
+	}
+}
+
+func TestIngressHTTPServerSpecMethodsAndHeaders(t *testing.T) {
+	rules := []*IngressRule{
+		{
+			Paths: []*IngressPath{
+				{
+					Path:    "/orders",
+					Backend: "orders",
+					Methods: []string{"GET"},
+				},
+				{
+					Path:    "/orders",
+					Backend: "orders-canary",
+					Headers: []*IngressHeader{
+						{
+							Key:    "X-Canary",
+							Values: []string{"true"},
+						},
+					},
+				},
+				{
+					Path:    "/orders",
+					Backend: "orders-writer",
+					Methods: []string{"POST"},
+				},
+			},
+		},
+	}
+
+	superSpec, err := IngressHTTPServerSpec(1233, rules, nil)
+	if err != nil {
+		t.Fatalf("ingress http server spec failed: %v", err)
+	}
+
+	paths := superSpec.ObjectSpec().(*httpserver.Spec).Rules[0].Paths
+	if len(paths) != 3 {
+		t.Fatalf("want 3 paths, got %d", len(paths))
+	}
+
+	if paths[0].Backend != "orders" || !reflect.DeepEqual(paths[0].Methods, []string{"GET"}) {
+		t.Errorf("GET path should be kept in declaration order, got %+v", paths[0])
+	}
+	if paths[1].Backend != "orders-canary" || len(paths[1].Headers) != 1 ||
+		paths[1].Headers[0].Key != "X-Canary" || paths[1].Headers[0].Backend != "orders-canary" {
+		t.Errorf("header path should be generated with its backend, got %+v", paths[1])
+	}
+	if paths[2].Backend != "orders-writer" || !reflect.DeepEqual(paths[2].Methods, []string{"POST"}) {
+		t.Errorf("POST path should be generated, got %+v", paths[2])
+	}
+
+	rules[0].Paths = append([]*IngressPath{{Path: "/orders", Backend: "orders-any"}}, rules[0].Paths...)
+	superSpec, err = IngressHTTPServerSpec(1233, rules, nil)
+	if err != nil {
+		t.Fatalf("ingress http server spec failed: %v", err)
+	}
+	paths = superSpec.ObjectSpec().(*httpserver.Spec).Rules[0].Paths
+	if paths[len(paths)-1].Backend != "orders-any" {
+		t.Errorf("path without methods and headers should be matched last, got %s", paths[len(paths)-1].Backend)
+	}
+}
+
+func TestIngressPathRewriteTarget(t *testing.T) {
+	tests := []struct {
+		path    string
+		target  string
+		wantErr bool
+	}{
+		{path: "/old/(.*)", target: "/new/$1"},
+		{path: "/old/(.*)", target: "/new/${1}/index"},
+		{path: "/old/(.*)", target: "/new/$2", wantErr: true},
+		{path: "/(?P<ver>v[0-9])/(.*)", target: "/${ver}/$2"},
+		{path: "/(?P<ver>v[0-9])/(.*)", target: "/${version}", wantErr: true},
+		{path: "/old", target: "/price/$$5"},
+		{path: "/old/(.*", target: "/new", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		p := IngressPath{Path: tt.path, RewriteTarget: tt.target, Backend: "foo"}
+		err := p.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("path %s rewrite target %s: want error %v, got %v", tt.path, tt.target, tt.wantErr, err)
+		}
+	}
+
+	rules := []*IngressRule{
+		{
+			Paths: []*IngressPath{
+				{
+					Path:          "/old/(.*)",
+					RewriteTarget: "/new/$1",
+					Backend:       "foo",
+				},
+			},
+		},
+	}
+	superSpec, err := IngressHTTPServerSpec(1233, rules, nil)
+	if err != nil {
+		t.Fatalf("ingress http server spec failed: %v", err)
+	}
+	path := superSpec.ObjectSpec().(*httpserver.Spec).Rules[0].Paths[0]
+	if path.PathRegexp != "/old/(.*)" || path.RewriteTarget != "/new/$1" {
+		t.Errorf("capture groups should be preserved, got %s -> %s", path.PathRegexp, path.RewriteTarget)
+	}
+}
+
+func newTestCertKey(t *testing.T, host string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key failed: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate failed: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key failed: %v", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return string(certPEM), string(keyPEM)
+}
+
+func TestIngressTLS(t *testing.T) {
+	fooCert, fooKey := newTestCertKey(t, "foo.megaease.com")
+	barCert, barKey := newTestCertKey(t, "bar.megaease.com")
+
+	ingress := &Ingress{
+		Name: "ingress-tls",
+		Rules: []*IngressRule{
+			{
+				Host:  "foo.megaease.com",
+				Paths: []*IngressPath{{Path: "/", Backend: "foo"}},
+			},
+			{
+				Host:  "bar.megaease.com",
+				Paths: []*IngressPath{{Path: "/", Backend: "bar"}},
+			},
+		},
+		TLS: &IngressTLS{
+			Certs: map[string]string{"foo.megaease.com": fooCert},
+			Keys:  map[string]string{"foo.megaease.com": fooKey},
+		},
+	}
+
+	if err := ingress.Validate(); err == nil {
+		t.Errorf("host without cert should be invalid")
+	}
+
+	ingress.TLS.Certs["bar.megaease.com"] = barCert
+	if err := ingress.Validate(); err == nil {
+		t.Errorf("cert without key should be invalid")
+	}
+
+	ingress.TLS.Keys["bar.megaease.com"] = fooKey
+	if err := ingress.Validate(); err == nil {
+		t.Errorf("mismatched cert and key should be invalid")
+	}
+
+	ingress.TLS.Keys["bar.megaease.com"] = barKey
+	if err := ingress.Validate(); err != nil {
+		t.Errorf("ingress should be valid: %v", err)
+	}
+
+	superSpec, err := IngressHTTPServerSpec(1233, ingress.Rules, ingress.TLS)
+	if err != nil {
+		t.Fatalf("ingress http server spec failed: %v", err)
+	}
+	serverSpec := superSpec.ObjectSpec().(*httpserver.Spec)
+	if !serverSpec.HTTPS || len(serverSpec.Certs) != 2 || len(serverSpec.Keys) != 2 {
+		t.Errorf("ingress with tls should serve https with all certs")
+	}
+	if superSpec.Name() != IngressHTTPSServerName {
+		t.Errorf("ingress with tls should be served by %s, got %s", IngressHTTPSServerName, superSpec.Name())
+	}
+
+	superSpec, err = IngressHTTPServerSpec(1233, ingress.Rules, nil)
+	if err != nil {
+		t.Fatalf("ingress http server spec failed: %v", err)
+	}
+	if superSpec.ObjectSpec().(*httpserver.Spec).HTTPS {
+		t.Errorf("ingress without tls should serve http")
+	}
+}
+
+func TestAdminTLSIngressPort(t *testing.T) {
+	admin := Admin{RegistryType: RegistryTypeEureka, IngressPort: IngressPort}
+	if err := admin.Validate(); err != nil {
+		t.Errorf("admin should be valid: %v", err)
+	}
+	if port := admin.TLSIngressPort(); port != IngressHTTPSPort {
+		t.Errorf("want default https ingress port %d, got %d", IngressHTTPSPort, port)
+	}
+
+	admin.IngressHTTPSPort = IngressPort
+	if err := admin.Validate(); err == nil {
+		t.Errorf("https ingress port same as the http one should be invalid")
+	}
+}
+
+func TestSideCarIngressWithResiliencePipelineSpec(t *testing.T) {
+	s := &Service{
+		Name: "order-001",
+		LoadBalance: &LoadBalance{
+			Policy: proxy.PolicyRandom,
+		},
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+		Resilience: &Resilience{
+			RateLimiter: &ratelimiter.Spec{
+				Policies: []*ratelimiter.Policy{{
+					Name:               "default",
+					TimeoutDuration:    "100ms",
+					LimitForPeriod:     50,
+					LimitRefreshPeriod: "10ms",
+				}},
+				DefaultPolicyRef: "default",
+				URLs: []*ratelimiter.URLRule{{
+					URLRule: urlrule.URLRule{
+						Methods: []string{"GET"},
+						URL: urlrule.StringMatch{
+							Exact:  "/path1",
+							Prefix: "/path2/",
+							RegEx:  "^/path3/[0-9]+$",
+						},
+						PolicyRef: "default",
+					},
+				}},
+			},
+		},
+	}
+
+	superSpec, _ := s.SideCarIngressPipelineSpec(443)
+	fmt.Println(superSpec.YAMLConfig())
+}
+
+func TestSideCarEgressResiliencePipelineSpec(t *testing.T) {
+	s := &Service{
+		Name: "order-001",
+		LoadBalance: &LoadBalance{
+			Policy: proxy.PolicyIPHash,
+		},
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+
 		Resilience: &Resilience{
 			CircuitBreaker: &circuitbreaker.Spec{
 				Policies: []*circuitbreaker.Policy{{
@@ -785,7 +1654,7 @@ func TestPipelineBuilderFailed(t *testing.T) {
 
 	builder.appendRetryer(nil)
 
-	builder.appendTimeLimiter(nil)
+	builder.appendTimeLimiter(nil, "")
 
 	yamlStr := builder.yamlConfig()
 	if len(yamlStr) == 0 {
@@ -826,210 +1695,2857 @@ func TestPipelineBuilder(t *testing.T) {
 
 }
 
-func TestIngressPipelineSpec(t *testing.T) {
-	s := &Service{
-		Name: "order-001",
-		LoadBalance: &LoadBalance{
-			Policy: proxy.PolicyRandom,
-		},
-		Sidecar: &Sidecar{
-			Address:         "127.0.0.1",
-			IngressPort:     8080,
-			IngressProtocol: "http",
-			EgressPort:      9090,
-			EgressProtocol:  "http",
-		},
+func TestPipelineBuilderCircuitBreakerProbe(t *testing.T) {
+	circuitBreaker := &circuitbreaker.Spec{
+		Policies: []*circuitbreaker.Policy{{
+			Name:                             "default",
+			PermittedNumberOfCallsInHalfOpen: 1,
+			WaitDurationInOpen:               "10s",
+			MaxWaitDurationInOpen:            "5m",
+		}},
+		DefaultPolicyRef: "default",
+		URLs: []*circuitbreaker.URLRule{{
+			URLRule: urlrule.URLRule{
+				URL: urlrule.StringMatch{Prefix: "/"},
+			},
+		}},
 	}
-	instanceSpecs := []*ServiceInstanceSpec{
-		{
-			ServiceName: "fake-001",
-			InstanceID:  "xxx-89757",
-			IP:          "192.168.0.110",
-			Port:        80,
-			Status:      "UP",
-		},
-		{
-			ServiceName: "fake-002",
-			InstanceID:  "zzz-73597",
-			IP:          "192.168.0.120",
-			Port:        80,
-			Status:      "UP",
+
+	builder := newPipelineSpecBuilder("probe")
+	builder.appendCircuitBreaker(circuitBreaker)
+	yamlConfig := builder.yamlConfig()
+	for _, want := range []string{
+		"permittedNumberOfCallsInHalfOpenState: 1",
+		"maxWaitDurationInOpenState: 5m",
+	} {
+		if !strings.Contains(yamlConfig, want) {
+			t.Errorf("%s should be passed through, got %s", want, yamlConfig)
+		}
+	}
+}
+
+func TestPipelineBuilderRetryBudget(t *testing.T) {
+	r := &retryer.Spec{
+		Policies: []*retryer.Policy{{
+			Name: "default",
+		}},
+		DefaultPolicyRef: "default",
+		URLs: []*retryer.URLRule{{
+			URLRule: urlrule.URLRule{
+				URL: urlrule.StringMatch{Prefix: "/"},
+			},
+		}},
+		Budget: &retryer.Budget{
+			MaxRetryRatio: 0.1,
+			Window:        "30s",
 		},
 	}
-	superSpec, err := s.IngressPipelineSpec(instanceSpecs)
 
+	builder := newPipelineSpecBuilder("budget")
+	builder.appendRetryer(r)
+	superSpec, err := supervisor.NewSpec(builder.yamlConfig())
 	if err != nil {
-		t.Fatalf("%v", err)
+		t.Fatalf("new spec failed: %v", err)
+	}
+	if !strings.Contains(superSpec.YAMLConfig(), "maxRetryRatio: 0.1") {
+		t.Errorf("retry budget should be passed through, got %s", superSpec.YAMLConfig())
 	}
-	fmt.Println(superSpec.YAMLConfig())
 }
 
-func TestSidecarIngressPipelineSpec(t *testing.T) {
-	s := &Service{
-		Name: "order-001",
-		LoadBalance: &LoadBalance{
-			Policy: proxy.PolicyRandom,
-		},
-		Sidecar: &Sidecar{
+func TestPipelineBuilderTimeLimiter(t *testing.T) {
+	tl := &timelimiter.Spec{
+		DefaultTimeoutDuration: "2s",
+		URLs: []*timelimiter.URLRule{{
+			URLRule: urlrule.URLRule{
+				URL: urlrule.StringMatch{Exact: "/reports"},
+			},
+			TimeoutDuration: "30s",
+		}},
+	}
+
+	if vr := v.Validate(tl); !vr.Valid() {
+		t.Errorf("positive timeouts should be valid: %v", vr)
+	}
+
+	builder := newPipelineSpecBuilder("timeout")
+	builder.appendTimeLimiter(tl, "")
+	superSpec, err := supervisor.NewSpec(builder.yamlConfig())
+	if err != nil {
+		t.Fatalf("new spec failed: %v", err)
+	}
+	for _, want := range []string{"defaultTimeoutDuration: 2s", "timeoutDuration: 30s"} {
+		if !strings.Contains(superSpec.YAMLConfig(), want) {
+			t.Errorf("%s should be passed through, got %s", want, superSpec.YAMLConfig())
+		}
+	}
+
+	builder = newPipelineSpecBuilder("default-only")
+	builder.appendTimeLimiter(&timelimiter.Spec{DefaultTimeoutDuration: "2s"}, "")
+	if len(builder.Flow) != 1 {
+		t.Errorf("time limiter with only default timeout should be appended")
+	}
+
+	tl.URLs[0].TimeoutDuration = "0s"
+	if vr := v.Validate(tl); vr.Valid() {
+		t.Errorf("zero timeout should be invalid")
+	}
+}
+
+func TestSideCarEgressPipelineSpecWithMirror(t *testing.T) {
+	s := &Service{
+		Name:           "order-007-mirror",
+		RegisterTenant: "tenant-001",
+		Mirror: &Mirror{
+			ServiceInstanceLabels: map[string]string{"version": "v2"},
+			Percentage:            10,
+		},
+	}
+
+	instanceSpecs := []*ServiceInstanceSpec{
+		{
+			ServiceName: "order-007-mirror",
+			InstanceID:  "main",
+			IP:          "192.168.0.110",
+			Port:        80,
+			Status:      ServiceStatusUp,
+		},
+		{
+			ServiceName: "order-007-mirror",
+			InstanceID:  "shadow",
+			IP:          "192.168.0.120",
+			Port:        80,
+			Status:      ServiceStatusUp,
+			Labels:      map[string]string{"version": "v2"},
+		},
+	}
+
+	builder := newPipelineSpecBuilder("mirror")
+	builder.appendProxyWithCanary(instanceSpecs, InstanceSchemeHTTP, nil, "", nil, nil, s.Mirror)
+
+	mirrorPool, ok := builder.Filters[0]["mirrorPool"].(*proxy.PoolSpec)
+	if !ok || len(mirrorPool.Servers) != 1 || mirrorPool.Servers[0].URL != "http://192.168.0.120:80" {
+		t.Fatalf("mirror pool should contain the labeled instance, got %+v", builder.Filters[0]["mirrorPool"])
+	}
+	if p := mirrorPool.Filter.Probability; p == nil || p.PerMill != 100 {
+		t.Errorf("mirror pool should sample 10%% requests, got %+v", p)
+	}
+	if mainPool := builder.Filters[0]["mainPool"].(*proxy.PoolSpec); len(mainPool.Servers) != 1 {
+		t.Errorf("main pool should only contain the main instance")
+	}
+
+	superSpec, err := s.SideCarEgressPipelineSpec(instanceSpecs)
+	if err != nil {
+		t.Fatalf("generate egress pipeline failed: %v", err)
+	}
+	if !strings.Contains(superSpec.YAMLConfig(), "mirrorPool") {
+		t.Errorf("mirror pool should be in the egress pipeline")
+	}
+
+	s.Mirror.ServiceInstanceLabels["version"] = "v3"
+	superSpec, err = s.SideCarEgressPipelineSpec(instanceSpecs)
+	if err != nil {
+		t.Fatalf("generate egress pipeline failed: %v", err)
+	}
+	if strings.Contains(superSpec.YAMLConfig(), "mirrorPool") {
+		t.Errorf("mirror pool without instances should be omitted")
+	}
+}
+
+func TestServiceInstanceSpecLabel(t *testing.T) {
+	ins := &ServiceInstanceSpec{
+		Labels: map[string]string{
+			"version":     "v1",
+			"build.pr":    "label",
+			"region.tier": "gold",
+		},
+	}
+	err := yaml.Unmarshal([]byte(`
+build:
+  commit: abc123
+  pr: 42
+region:
+  tier: silver
+  zones: [a, b]
+`), &ins.Metadata)
+	if err != nil {
+		t.Fatalf("unmarshal metadata failed: %v", err)
+	}
+
+	tests := []struct {
+		key    string
+		label  string
+		exists bool
+	}{
+		{"version", "v1", true},
+		{"build.commit", "abc123", true},
+		{"build.pr", "label", true},
+		{"region.tier", "gold", true},
+		{"region.zones", "", false},
+		{"region", "", false},
+		{"build.commit.sha", "", false},
+		{"missing.path", "", false},
+	}
+	for _, tt := range tests {
+		label, exists := ins.Label(tt.key)
+		if label != tt.label || exists != tt.exists {
+			t.Errorf("label %s: want %q %v, got %q %v", tt.key, tt.label, tt.exists, label, exists)
+		}
+	}
+}
+
+func TestSideCarEgressPipelineSpecWithCanaryMetadata(t *testing.T) {
+	canary := &Canary{
+		CanaryRules: []*CanaryRule{
+			{
+				Headers: map[string]*urlrule.StringMatch{
+					"X-canary": {Exact: "lv1"},
+				},
+				ServiceInstanceLabels: map[string]string{
+					"build.tier": "beta",
+				},
+			},
+		},
+	}
+	instanceSpecs := []*ServiceInstanceSpec{
+		{IP: "192.168.0.110", Port: 80, Status: ServiceStatusUp},
+		{
+			IP: "192.168.0.120", Port: 80, Status: ServiceStatusUp,
+			Labels:   map[string]string{"version": "v2"},
+			Metadata: map[string]interface{}{"build": map[string]interface{}{"tier": "beta"}},
+		},
+		{
+			IP: "192.168.0.121", Port: 80, Status: ServiceStatusUp,
+			Labels:   map[string]string{"version": "v3"},
+			Metadata: map[string]interface{}{"build": map[string]interface{}{"tier": "stable"}},
+		},
+	}
+
+	builder := newPipelineSpecBuilder("egress")
+	builder.appendProxyWithCanary(instanceSpecs, InstanceSchemeHTTP, canary, "", nil, nil, nil)
+
+	pools, ok := builder.Filters[0]["candidatePools"].([]*proxy.PoolSpec)
+	if !ok || len(pools) != 1 {
+		t.Fatalf("want 1 candidate pool, got %+v", builder.Filters[0]["candidatePools"])
+	}
+	if len(pools[0].Servers) != 1 || pools[0].Servers[0].URL != "http://192.168.0.120:80" {
+		t.Errorf("candidate pool should contain the instance matching metadata, got %+v", pools[0].Servers)
+	}
+	if pools[0].Name != CanaryPoolName(0) {
+		t.Errorf("want candidate pool named %s, got %s", CanaryPoolName(0), pools[0].Name)
+	}
+}
+
+func TestSideCarEgressPipelineSpecWithCanaryMetadataOnly(t *testing.T) {
+	canary := &Canary{
+		CanaryRules: []*CanaryRule{
+			{
+				Headers: map[string]*urlrule.StringMatch{
+					"X-canary": {Exact: "lv1"},
+				},
+				ServiceInstanceLabels: map[string]string{
+					"build.tier": "beta",
+				},
+			},
+		},
+	}
+	instanceSpecs := []*ServiceInstanceSpec{
+		{IP: "192.168.0.110", Port: 80, Status: ServiceStatusUp},
+		{
+			IP: "192.168.0.120", Port: 80, Status: ServiceStatusUp,
+			Metadata: map[string]interface{}{"build": map[string]interface{}{"tier": "beta"}},
+		},
+		{
+			IP: "192.168.0.121", Port: 80, Status: ServiceStatusUp,
+			Metadata: map[string]interface{}{"build": map[string]interface{}{"tier": "stable"}},
+		},
+	}
+
+	builder := newPipelineSpecBuilder("egress")
+	builder.appendProxyWithCanary(instanceSpecs, InstanceSchemeHTTP, canary, "", nil, nil, nil)
+
+	pools, ok := builder.Filters[0]["candidatePools"].([]*proxy.PoolSpec)
+	if !ok || len(pools) != 1 {
+		t.Fatalf("want 1 candidate pool, got %+v", builder.Filters[0]["candidatePools"])
+	}
+	if len(pools[0].Servers) != 1 || pools[0].Servers[0].URL != "http://192.168.0.120:80" {
+		t.Errorf("candidate pool should contain the metadata-only instance matching the rule, got %+v", pools[0].Servers)
+	}
+
+	mainPool := builder.Filters[0]["mainPool"].(*proxy.PoolSpec)
+	if len(mainPool.Servers) != 2 {
+		t.Fatalf("want 2 main servers, got %+v", mainPool.Servers)
+	}
+	if mainPool.Servers[0].URL != "http://192.168.0.110:80" || mainPool.Servers[1].URL != "http://192.168.0.121:80" {
+		t.Errorf("main pool should keep the metadata-only instance matching no rule, got %+v", mainPool.Servers)
+	}
+}
+
+func TestSideCarEgressPipelineSpecWithDrainingInstances(t *testing.T) {
+	canary := &Canary{
+		CanaryRules: []*CanaryRule{
+			{
+				Headers: map[string]*urlrule.StringMatch{
+					"X-canary": {Exact: "lv1"},
+				},
+				ServiceInstanceLabels: map[string]string{"version": "v2"},
+			},
+		},
+	}
+	instanceSpecs := []*ServiceInstanceSpec{
+		{IP: "192.168.0.110", Port: 80, Status: ServiceStatusUp},
+		{IP: "192.168.0.111", Port: 80, Status: ServiceStatusDraining},
+		{IP: "192.168.0.120", Port: 80, Status: ServiceStatusUp, Labels: map[string]string{"version": "v2"}},
+		{IP: "192.168.0.121", Port: 80, Status: ServiceStatusDraining, Labels: map[string]string{"version": "v2"}},
+	}
+
+	builder := newPipelineSpecBuilder("egress")
+	builder.appendProxyWithCanary(instanceSpecs, InstanceSchemeHTTP, canary, "", nil, nil, nil)
+
+	mainPool := builder.Filters[0]["mainPool"].(*proxy.PoolSpec)
+	if len(mainPool.Servers) != 1 || mainPool.Servers[0].URL != "http://192.168.0.110:80" {
+		t.Errorf("main pool should exclude the draining instance, got %+v", mainPool.Servers)
+	}
+	pools := builder.Filters[0]["candidatePools"].([]*proxy.PoolSpec)
+	if len(pools) != 1 || len(pools[0].Servers) != 1 || pools[0].Servers[0].URL != "http://192.168.0.120:80" {
+		t.Errorf("candidate pool should exclude the draining instance, got %+v", pools)
+	}
+}
+
+func TestPipelineSpecWithoutAvailableInstances(t *testing.T) {
+	s := &Service{
+		Name: "order-011-unavailable",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+		Resilience: &Resilience{
+			Retryer: &retryer.Spec{
+				Policies:         []*retryer.Policy{{Name: "default", MaxAttempts: 3}},
+				DefaultPolicyRef: "default",
+				URLs: []*retryer.URLRule{{
+					URLRule: urlrule.URLRule{URL: urlrule.StringMatch{Prefix: "/"}},
+				}},
+			},
+		},
+	}
+	instanceSpecs := []*ServiceInstanceSpec{
+		{IP: "192.168.0.110", Port: 80, Status: ServiceStatusOutOfService},
+		{IP: "192.168.0.111", Port: 80, Status: ServiceStatusDraining},
+	}
+
+	checkUnavailable := func(superSpec *supervisor.Spec) {
+		yamlConfig := superSpec.YAMLConfig()
+		for _, unwanted := range []string{"kind: Proxy", "kind: Retryer"} {
+			if strings.Contains(yamlConfig, unwanted) {
+				t.Errorf("want no %q without UP instances:\n%s", unwanted, yamlConfig)
+			}
+		}
+		for _, want := range []string{"name: " + NoAvailableInstancesFilterName, "code: 503",
+			"body: " + ErrServiceNotavailable.Error() + " order-011-unavailable"} {
+			if !strings.Contains(yamlConfig, want) {
+				t.Errorf("want %q in pipeline:\n%s", want, yamlConfig)
+			}
+		}
+	}
+
+	superSpec, err := s.SideCarEgressPipelineSpec(instanceSpecs)
+	if err != nil {
+		t.Fatalf("generate egress pipeline failed: %v", err)
+	}
+	checkUnavailable(superSpec)
+
+	superSpec, err = s.IngressPipelineSpec(instanceSpecs)
+	if err != nil {
+		t.Fatalf("generate mesh ingress pipeline failed: %v", err)
+	}
+	checkUnavailable(superSpec)
+
+	if err := NoAvailableInstancesError(s.Name); !errors.Is(err, ErrServiceNotavailable) {
+		t.Errorf("want error wrapping ErrServiceNotavailable, got %v", err)
+	}
+}
+
+func TestSideCarEgressPipelineSpecWithFallback(t *testing.T) {
+	newFallbackService := func(name string) *Service {
+		return &Service{
+			Name: name,
+			Sidecar: &Sidecar{
+				Address:         "127.0.0.1",
+				IngressPort:     8080,
+				IngressProtocol: "http",
+				EgressPort:      9090,
+				EgressProtocol:  "http",
+			},
+		}
+	}
+	s := newFallbackService("order-012-fallback")
+	maintenance := newFallbackService("maintenance")
+	downInstances := []*ServiceInstanceSpec{{IP: "192.168.0.110", Port: 80, Status: ServiceStatusOutOfService}}
+	maintenanceInstances := []*ServiceInstanceSpec{{IP: "192.168.0.200", Port: 8080, Status: ServiceStatusUp}}
+
+	checkFallback := func(superSpec *supervisor.Spec, url string) {
+		yamlConfig := superSpec.YAMLConfig()
+		for _, want := range []string{"name: " + FallbackFilterName, "url: " + url,
+			"fallback#order-012-fallback", FallbackHeader + ": order-012-fallback"} {
+			if !strings.Contains(yamlConfig, want) {
+				t.Errorf("want %q in egress pipeline:\n%s", want, yamlConfig)
+			}
+		}
+		if strings.Contains(yamlConfig, NoAvailableInstancesFilterName) {
+			t.Errorf("want no 503 with fallback:\n%s", yamlConfig)
+		}
+	}
+
+	s.Fallback = &Fallback{URL: "http://maintenance.example.com:8080/"}
+	superSpec, err := s.SideCarEgressPipelineSpec(downInstances)
+	if err != nil {
+		t.Fatalf("generate egress pipeline failed: %v", err)
+	}
+	checkFallback(superSpec, "http://maintenance.example.com:8080\n")
+
+	s.Fallback = &Fallback{Service: "maintenance"}
+	superSpec, err = s.SideCarEgressPipelineSpecWithFallback(nil, downInstances, maintenance, maintenanceInstances, nil)
+	if err != nil {
+		t.Fatalf("generate egress pipeline failed: %v", err)
+	}
+	checkFallback(superSpec, "http://192.168.0.200:8080")
+
+	superSpec, err = s.SideCarEgressPipelineSpecWithFallback(nil, downInstances, maintenance, nil, nil)
+	if err != nil {
+		t.Fatalf("generate egress pipeline failed: %v", err)
+	}
+	if !strings.Contains(superSpec.YAMLConfig(), NoAvailableInstancesFilterName) {
+		t.Errorf("want 503 without UP instances of the fallback service:\n%s", superSpec.YAMLConfig())
+	}
+
+	upInstances := []*ServiceInstanceSpec{{IP: "192.168.0.110", Port: 80, Status: ServiceStatusUp}}
+	superSpec, err = s.SideCarEgressPipelineSpecWithFallback(nil, upInstances, maintenance, maintenanceInstances, nil)
+	if err != nil {
+		t.Fatalf("generate egress pipeline failed: %v", err)
+	}
+	if strings.Contains(superSpec.YAMLConfig(), "192.168.0.200") {
+		t.Errorf("fallback should not be used with UP instances:\n%s", superSpec.YAMLConfig())
+	}
+}
+
+func TestValidateFallback(t *testing.T) {
+	cases := []struct {
+		fallback *Fallback
+		valid    bool
+	}{
+		{&Fallback{URL: "http://maintenance:8080"}, true},
+		{&Fallback{URL: "https://maintenance.example.com/"}, true},
+		{&Fallback{Service: "maintenance"}, true},
+		{&Fallback{}, false},
+		{&Fallback{URL: "http://maintenance:8080", Service: "maintenance"}, false},
+		{&Fallback{Service: "order"}, false},
+		{&Fallback{URL: "maintenance:8080"}, false},
+		{&Fallback{URL: "ftp://maintenance"}, false},
+		{&Fallback{URL: "http://"}, false},
+		{&Fallback{URL: "http://maintenance/sorry.html"}, false},
+		{&Fallback{URL: "http://maintenance?page=1"}, false},
+	}
+
+	for i, c := range cases {
+		s := &Service{Name: "order", Fallback: c.fallback}
+		err := s.Validate()
+		if c.valid && err != nil {
+			t.Errorf("case %d: want valid, got %v", i, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("case %d: want invalid fallback %+v", i, c.fallback)
+		}
+	}
+}
+
+func TestSideCarEgressPipelineSpecWithOverlappingCanaryRules(t *testing.T) {
+	canary := &Canary{
+		CanaryRules: []*CanaryRule{
+			{
+				Headers: map[string]*urlrule.StringMatch{
+					"X-canary": {Exact: "lv1"},
+				},
+				ServiceInstanceLabels: map[string]string{"version": "v2"},
+			},
+			{
+				Headers: map[string]*urlrule.StringMatch{
+					"X-canary": {Exact: "lv2"},
+				},
+				ServiceInstanceLabels: map[string]string{"zone": "a"},
+			},
+		},
+	}
+	instanceSpecs := []*ServiceInstanceSpec{
+		{IP: "192.168.0.110", Port: 80, Status: ServiceStatusUp},
+		{IP: "192.168.0.120", Port: 80, Status: ServiceStatusUp, Labels: map[string]string{"version": "v2", "zone": "a"}},
+		{IP: "192.168.0.121", Port: 80, Status: ServiceStatusUp, Labels: map[string]string{"zone": "a"}},
+	}
+
+	builder := newPipelineSpecBuilder("egress")
+	builder.appendProxyWithCanary(instanceSpecs, InstanceSchemeHTTP, canary, "", nil, nil, nil)
+
+	pools := builder.Filters[0]["candidatePools"].([]*proxy.PoolSpec)
+	if len(pools) != 2 {
+		t.Fatalf("want 2 candidate pools, got %d", len(pools))
+	}
+	if len(pools[0].Servers) != 1 || pools[0].Servers[0].URL != "http://192.168.0.120:80" {
+		t.Errorf("first rule should get the instance matching both rules, got %+v", pools[0].Servers)
+	}
+	if len(pools[1].Servers) != 1 || pools[1].Servers[0].URL != "http://192.168.0.121:80" {
+		t.Errorf("second rule should get only the instance left, got %+v", pools[1].Servers)
+	}
+
+	// the first rule doesn't apply to the caller, so it claims nothing
+	canary.CanaryRules[0].SourceServices = []string{"order"}
+	builder = newPipelineSpecBuilder("egress")
+	builder.appendProxyWithCanary(instanceSpecs, InstanceSchemeHTTP, canary, "payment", nil, nil, nil)
+
+	pools = builder.Filters[0]["candidatePools"].([]*proxy.PoolSpec)
+	if len(pools) != 1 || len(pools[0].Servers) != 2 {
+		t.Errorf("want both zone a instances in the only pool, got %+v", pools)
+	}
+}
+
+func TestSideCarEgressPipelineSpecWithCanaryBypass(t *testing.T) {
+	canary := &Canary{
+		CanaryRules: []*CanaryRule{
+			{
+				Headers: map[string]*urlrule.StringMatch{
+					"X-canary": {Exact: "lv1"},
+				},
+				ServiceInstanceLabels: map[string]string{"version": "v2"},
+			},
+		},
+	}
+	instanceSpecs := []*ServiceInstanceSpec{
+		{IP: "192.168.0.110", Port: 80, Status: ServiceStatusUp},
+		{IP: "192.168.0.120", Port: 80, Status: ServiceStatusUp, Labels: map[string]string{"version": "v2"}},
+	}
+
+	builder := newPipelineSpecBuilder("egress")
+	builder.appendProxyWithCanary(instanceSpecs, InstanceSchemeHTTP, canary, "", nil, nil, nil)
+	if header := builder.Filters[0]["canaryBypassHeader"]; header != DefaultCanaryBypassHeader {
+		t.Errorf("want default bypass header %s, got %v", DefaultCanaryBypassHeader, header)
+	}
+
+	canary.Bypass = &CanaryBypass{Header: "X-Debug-Main"}
+	builder = newPipelineSpecBuilder("egress")
+	builder.appendProxyWithCanary(instanceSpecs, InstanceSchemeHTTP, canary, "", nil, nil, nil)
+	if header := builder.Filters[0]["canaryBypassHeader"]; header != "X-Debug-Main" {
+		t.Errorf("want bypass header X-Debug-Main, got %v", header)
+	}
+
+	builder = newPipelineSpecBuilder("egress")
+	builder.appendProxyWithCanary(instanceSpecs[:1], InstanceSchemeHTTP, canary, "", nil, nil, nil)
+	if _, exists := builder.Filters[0]["canaryBypassHeader"]; exists {
+		t.Errorf("bypass header should be absent without candidate pools")
+	}
+}
+
+func TestSideCarEgressPipelineSpecWithCanarySourceServices(t *testing.T) {
+	payment := &Service{
+		Name: "payment",
+		Canary: &Canary{
+			CanaryRules: []*CanaryRule{
+				{
+					Headers: map[string]*urlrule.StringMatch{
+						"X-canary": {Exact: "lv1"},
+					},
+					SourceServices:        []string{"order"},
+					ServiceInstanceLabels: map[string]string{"version": "v2"},
+				},
+				{
+					SourceServices:        []string{"delivery"},
+					ServiceInstanceLabels: map[string]string{"version": "v3"},
+				},
+			},
+		},
+	}
+	instanceSpecs := []*ServiceInstanceSpec{
+		{ServiceName: "payment", InstanceID: "payment-1", IP: "192.168.0.110", Port: 80, Status: ServiceStatusUp},
+		{
+			ServiceName: "payment", InstanceID: "payment-2", IP: "192.168.0.120", Port: 80, Status: ServiceStatusUp,
+			Labels: map[string]string{"version": "v2"},
+		},
+		{
+			ServiceName: "payment", InstanceID: "payment-3", IP: "192.168.0.130", Port: 80, Status: ServiceStatusUp,
+			Labels: map[string]string{"version": "v3"},
+		},
+	}
+
+	candidatePools := func(caller *Service) []*proxy.PoolSpec {
+		superSpec, err := payment.SideCarEgressPipelineSpecForCaller(caller, instanceSpecs, nil)
+		if err != nil {
+			t.Fatalf("generate egress pipeline failed: %v", err)
+		}
+		for _, filter := range superSpec.ObjectSpec().(*httppipeline.Spec).Filters {
+			if filter["kind"] == proxy.Kind {
+				buff, _ := yaml.Marshal(filter)
+				spec := &proxy.Spec{}
+				yaml.Unmarshal(buff, spec)
+				return spec.CandidatePools
+			}
+		}
+		t.Fatalf("proxy not found")
+		return nil
+	}
+
+	pools := candidatePools(&Service{Name: "order"})
+	if len(pools) != 1 || pools[0].Servers[0].URL != "http://192.168.0.120:80" {
+		t.Fatalf("caller order should only match the first rule, got %+v", pools)
+	}
+	if pools[0].Filter.Headers["X-canary"] == nil {
+		t.Errorf("headers of the rule should be matched, got %+v", pools[0].Filter)
+	}
+
+	pools = candidatePools(&Service{Name: "delivery"})
+	if len(pools) != 1 || pools[0].Servers[0].URL != "http://192.168.0.130:80" {
+		t.Fatalf("caller delivery should only match the second rule, got %+v", pools)
+	}
+	if pools[0].Name != CanaryPoolName(1) {
+		t.Errorf("candidate pool should be named by its rule, got %s", pools[0].Name)
+	}
+	if p := pools[0].Filter.Probability; p == nil || p.PerMill != 1000 {
+		t.Errorf("rule with only source services should match all requests, got %+v", pools[0].Filter)
+	}
+
+	if pools = candidatePools(&Service{Name: "stock"}); len(pools) != 0 {
+		t.Errorf("other callers should not match any rule, got %+v", pools)
+	}
+	if pools = candidatePools(nil); len(pools) != 0 {
+		t.Errorf("requests without caller should not match any rule, got %+v", pools)
+	}
+}
+
+func TestSideCarEgressPipelineSpecWithCanarySetHeaders(t *testing.T) {
+	payment := &Service{
+		Name: "payment",
+		Canary: &Canary{
+			CanaryRules: []*CanaryRule{
+				{
+					Headers: map[string]*urlrule.StringMatch{
+						"X-canary": {Exact: "lv1"},
+					},
+					SetHeaders:            map[string]string{"X-Env": "canary"},
+					ServiceInstanceLabels: map[string]string{"version": "v2"},
+				},
+			},
+		},
+	}
+	instanceSpecs := []*ServiceInstanceSpec{
+		{ServiceName: "payment", InstanceID: "payment-1", IP: "192.168.0.110", Port: 80, Status: ServiceStatusUp},
+		{
+			ServiceName: "payment", InstanceID: "payment-2", IP: "192.168.0.120", Port: 80, Status: ServiceStatusUp,
+			Labels: map[string]string{"version": "v2"},
+		},
+	}
+
+	superSpec, err := payment.SideCarEgressPipelineSpec(instanceSpecs)
+	if err != nil {
+		t.Fatalf("generate egress pipeline failed: %v", err)
+	}
+
+	proxySpec := &proxy.Spec{}
+	for _, filter := range superSpec.ObjectSpec().(*httppipeline.Spec).Filters {
+		if filter["kind"] == proxy.Kind {
+			buff, _ := yaml.Marshal(filter)
+			yaml.Unmarshal(buff, proxySpec)
+		}
+	}
+	if len(proxySpec.CandidatePools) != 1 {
+		t.Fatalf("want 1 candidate pool, got %+v", proxySpec.CandidatePools)
+	}
+	rh := proxySpec.CandidatePools[0].RequestHeader
+	if rh == nil || rh.Set["X-Env"] != "canary" {
+		t.Errorf("candidate pool should set X-Env: canary, got %+v", rh)
+	}
+	if proxySpec.MainPool.RequestHeader != nil {
+		t.Errorf("main pool should not adapt headers, got %+v", proxySpec.MainPool.RequestHeader)
+	}
+
+	want := []string{"X-Env", "X-canary"}
+	if headers := payment.UniqueCanaryHeaders(); !reflect.DeepEqual(headers, want) {
+		t.Errorf("set headers should be propagated as canary headers, want %v, got %v", want, headers)
+	}
+}
+
+func TestSideCarEgressPipelineSpecWithInstanceScheme(t *testing.T) {
+	payment := &Service{
+		Name: "payment",
+		Sidecar: &Sidecar{
+			EgressProtocol: "http",
+		},
+	}
+	instanceSpecs := []*ServiceInstanceSpec{
+		{ServiceName: "payment", InstanceID: "payment-1", IP: "192.168.0.110", Port: 80, Status: ServiceStatusUp},
+		{ServiceName: "payment", InstanceID: "payment-2", IP: "192.168.0.111", Port: 443, Status: ServiceStatusUp,
+			Scheme: InstanceSchemeHTTPS},
+	}
+
+	superSpec, err := payment.SideCarEgressPipelineSpec(instanceSpecs)
+	if err != nil {
+		t.Fatalf("generate egress pipeline failed: %v", err)
+	}
+	yamlConfig := superSpec.YAMLConfig()
+	if !strings.Contains(yamlConfig, "url: http://192.168.0.110:80") {
+		t.Errorf("instance without scheme should use the sidecar egress protocol:\n%s", yamlConfig)
+	}
+	if !strings.Contains(yamlConfig, "url: https://192.168.0.111:443") {
+		t.Errorf("instance should use its advertised scheme:\n%s", yamlConfig)
+	}
+
+	for _, scheme := range []string{"", InstanceSchemeHTTP, InstanceSchemeHTTPS} {
+		if err := (ServiceInstanceSpec{Scheme: scheme}).Validate(); err != nil {
+			t.Errorf("scheme %q should be valid, err: %v", scheme, err)
+		}
+	}
+	if (ServiceInstanceSpec{Scheme: "grpc"}).Validate() == nil {
+		t.Errorf("scheme grpc should be invalid")
+	}
+}
+
+func TestPipelineSpecWithConnectionPool(t *testing.T) {
+	s := &Service{
+		Name: "payment",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+		ConnectionPool: &ConnectionPool{
+			MaxConnsPerHost: 64,
+			IdleConnTimeout: "30s",
+		},
+	}
+	instanceSpecs := []*ServiceInstanceSpec{
+		{ServiceName: "payment", InstanceID: "payment-1", IP: "192.168.0.110", Port: 80, Status: ServiceStatusUp},
+	}
+
+	ingressSpec, err := s.SideCarIngressPipelineSpec(443)
+	if err != nil {
+		t.Fatalf("generate ingress pipeline failed: %v", err)
+	}
+	egressSpec, err := s.SideCarEgressPipelineSpec(instanceSpecs)
+	if err != nil {
+		t.Fatalf("generate egress pipeline failed: %v", err)
+	}
+	for _, yamlConfig := range []string{ingressSpec.YAMLConfig(), egressSpec.YAMLConfig()} {
+		if !strings.Contains(yamlConfig, "maxConnsPerHost: 64") ||
+			!strings.Contains(yamlConfig, "idleConnTimeout: 30s") {
+			t.Errorf("proxy should have the connection pool:\n%s", yamlConfig)
+		}
+	}
+
+	s.ConnectionPool = nil
+	egressSpec, err = s.SideCarEgressPipelineSpec(instanceSpecs)
+	if err != nil {
+		t.Fatalf("generate egress pipeline failed: %v", err)
+	}
+	if strings.Contains(egressSpec.YAMLConfig(), "connectionPool") {
+		t.Errorf("proxy should keep the default connection pool:\n%s", egressSpec.YAMLConfig())
+	}
+}
+
+func TestValidateCanaryRuleCriteria(t *testing.T) {
+	rule := &CanaryRule{ServiceInstanceLabels: map[string]string{"version": "v2"}}
+	s := &Service{Name: "order", Canary: &Canary{CanaryRules: []*CanaryRule{rule}}}
+	if s.ValidateCanaryRules(2) == nil {
+		t.Errorf("rule without match criteria should be invalid")
+	}
+
+	// NOTE: The source services are kept from the stored spec after the
+	// rule is read from the pb spec, so the rule itself passes validation.
+	if vr := v.Validate(rule); !vr.Valid() {
+		t.Errorf("rule read from the pb spec should be valid: %s", vr)
+	}
+
+	rule.SourceServices = []string{"order"}
+	if err := s.ValidateCanaryRules(2); err != nil {
+		t.Errorf("rule with source services should be valid, err: %v", err)
+	}
+}
+
+func TestCanaryKeepNonPBFields(t *testing.T) {
+	old := &Canary{
+		CanaryRules: []*CanaryRule{
+			{ServiceInstanceLabels: map[string]string{"version": "v2"}, SourceServices: []string{"order"}},
+			{ServiceInstanceLabels: map[string]string{"version": "v3"}, SourceServices: []string{"delivery"}},
+		},
+		Bypass: &CanaryBypass{Header: "X-Debug-Main"},
+	}
+	c := &Canary{
+		CanaryRules: []*CanaryRule{
+			{ServiceInstanceLabels: map[string]string{"version": "v2"}},
+			{ServiceInstanceLabels: map[string]string{"version": "v4"}},
+		},
+	}
+
+	c.KeepNonPBFields(old)
+	if c.Bypass != old.Bypass {
+		t.Errorf("bypass should be kept")
+	}
+	if !reflect.DeepEqual(c.CanaryRules[0].SourceServices, []string{"order"}) {
+		t.Errorf("source services of the same rule should be kept, got %v", c.CanaryRules[0].SourceServices)
+	}
+	if c.CanaryRules[1].SourceServices != nil {
+		t.Errorf("source services of the changed rule should not be kept, got %v", c.CanaryRules[1].SourceServices)
+	}
+}
+
+func TestSideCarEgressPipelineSpecWithConsistentHash(t *testing.T) {
+	s := &Service{
+		Name: "order",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+		LoadBalance: &LoadBalance{
+			Policy:     proxy.PolicyConsistentHash,
+			HashSource: proxy.HashSourceHeader,
+			HashKey:    "X-User-Id",
+			LoadFactor: 1.5,
+		},
+		Canary: &Canary{
+			CanaryRules: []*CanaryRule{
+				{
+					ServiceInstanceLabels: map[string]string{"version": "v2"},
+					Headers:               map[string]*urlrule.StringMatch{"X-Location": {Exact: "beijing"}},
+				},
+			},
+		},
+	}
+	instanceSpecs := []*ServiceInstanceSpec{
+		{ServiceName: "order", InstanceID: "order-1", IP: "192.168.0.110", Port: 80, Status: ServiceStatusUp},
+		{ServiceName: "order", InstanceID: "order-2", IP: "192.168.0.111", Port: 80, Status: ServiceStatusUp},
+		{
+			ServiceName: "order", InstanceID: "order-3", IP: "192.168.0.112", Port: 80, Status: ServiceStatusUp,
+			Labels: map[string]string{"version": "v2"},
+		},
+	}
+
+	egressSpec, err := s.SideCarEgressPipelineSpec(instanceSpecs)
+	if err != nil {
+		t.Fatalf("generate egress pipeline failed: %v", err)
+	}
+	yamlConfig := egressSpec.YAMLConfig()
+	if n := strings.Count(yamlConfig, "policy: consistentHash"); n != 2 {
+		t.Errorf("main and canary pools should use consistent hash, got %d:\n%s", n, yamlConfig)
+	}
+	if !strings.Contains(yamlConfig, "hashSource: header") ||
+		!strings.Contains(yamlConfig, "hashKey: X-User-Id") ||
+		!strings.Contains(yamlConfig, "loadFactor: 1.5") {
+		t.Errorf("pools should have the consistent hash options:\n%s", yamlConfig)
+	}
+}
+
+func TestPipelineSpecWithLeastRequest(t *testing.T) {
+	s := &Service{
+		Name: "order",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+		LoadBalance: &LoadBalance{Policy: proxy.PolicyLeastRequest},
+	}
+	instanceSpecs := []*ServiceInstanceSpec{
+		{ServiceName: "order", InstanceID: "order-1", IP: "192.168.0.110", Port: 80, Status: ServiceStatusUp},
+		{ServiceName: "order", InstanceID: "order-2", IP: "192.168.0.111", Port: 80, Status: ServiceStatusUp},
+	}
+
+	ingressSpec, err := s.SideCarIngressPipelineSpec(443)
+	if err != nil {
+		t.Fatalf("generate ingress pipeline failed: %v", err)
+	}
+	egressSpec, err := s.SideCarEgressPipelineSpec(instanceSpecs)
+	if err != nil {
+		t.Fatalf("generate egress pipeline failed: %v", err)
+	}
+	for _, yamlConfig := range []string{ingressSpec.YAMLConfig(), egressSpec.YAMLConfig()} {
+		if !strings.Contains(yamlConfig, "policy: leastRequest") {
+			t.Errorf("proxy should use least request:\n%s", yamlConfig)
+		}
+	}
+}
+
+func TestKeepLoadBalanceNonPBFields(t *testing.T) {
+	old := &LoadBalance{
+		Policy:     proxy.PolicyConsistentHash,
+		HashSource: proxy.HashSourceCookie,
+		HashKey:    "session",
+		LoadFactor: 2,
+	}
+
+	lb := &LoadBalance{Policy: proxy.PolicyConsistentHash}
+	KeepLoadBalanceNonPBFields(lb, old)
+	if lb.HashSource != old.HashSource || lb.HashKey != old.HashKey || lb.LoadFactor != old.LoadFactor {
+		t.Errorf("consistent hash options should be kept, got %+v", lb)
+	}
+
+	lb = &LoadBalance{Policy: proxy.PolicyRoundRobin}
+	KeepLoadBalanceNonPBFields(lb, old)
+	if lb.HashKey != "" || lb.LoadFactor != 0 {
+		t.Errorf("consistent hash options should be dropped with another policy, got %+v", lb)
+	}
+}
+
+func TestServiceKeepNonPBFields(t *testing.T) {
+	old := &Service{
+		Name:               "order",
+		Aliases:            []string{"order-v1"},
+		HeaderManipulation: &HeaderManipulation{},
+		EgressRoutes:       []*EgressRoute{{Service: "delivery"}},
+		Canary:             &Canary{Bypass: &CanaryBypass{Header: "X-Bypass"}},
+	}
+
+	s := &Service{Name: "order", Canary: &Canary{}}
+	s.KeepNonPBFields(old)
+	if !reflect.DeepEqual(s.Aliases, old.Aliases) || s.HeaderManipulation != old.HeaderManipulation ||
+		!reflect.DeepEqual(s.EgressRoutes, old.EgressRoutes) {
+		t.Errorf("non-pb fields should be kept, got %+v", s)
+	}
+	if s.Canary.Bypass != old.Canary.Bypass {
+		t.Errorf("canary bypass should be kept, got %+v", s.Canary)
+	}
+	if err := s.Validate(); err != nil {
+		t.Errorf("service with kept fields should be valid: %v", err)
+	}
+}
+
+func TestResilienceKeepNonPBFields(t *testing.T) {
+	urlRule := urlrule.URLRule{URL: urlrule.StringMatch{Prefix: "/"}}
+	old := &Resilience{
+		RateLimiter: &ratelimiter.Spec{
+			Policies: []*ratelimiter.Policy{{Name: "default", Algorithm: "slidingLog"}},
+			Adaptive: &ratelimiter.Adaptive{TargetLatency: "100ms"},
+		},
+		CircuitBreaker: &circuitbreaker.Spec{
+			Policies: []*circuitbreaker.Policy{{Name: "default", MaxWaitDurationInOpen: "5m"}},
+		},
+		Retryer: &retryer.Spec{
+			Budget:             &retryer.Budget{},
+			RetryOnStatusCodes: []int{503},
+		},
+		TimeLimiter: &timelimiter.Spec{
+			URLs: []*timelimiter.URLRule{{URLRule: urlRule, TimeoutDuration: "1s"}},
+		},
+	}
+
+	r := &Resilience{
+		RateLimiter: &ratelimiter.Spec{
+			Policies: []*ratelimiter.Policy{{Name: "default"}, {Name: "other"}},
+		},
+		CircuitBreaker: &circuitbreaker.Spec{
+			Policies: []*circuitbreaker.Policy{{Name: "default"}},
+		},
+		Retryer: &retryer.Spec{},
+		TimeLimiter: &timelimiter.Spec{
+			URLs: []*timelimiter.URLRule{{URLRule: urlRule}},
+		},
+	}
+	r.KeepNonPBFields(old)
+
+	if r.RateLimiter.Adaptive != old.RateLimiter.Adaptive ||
+		r.RateLimiter.Policies[0].Algorithm != "slidingLog" || r.RateLimiter.Policies[1].Algorithm != "" {
+		t.Errorf("rate limiter options should be kept, got %+v", r.RateLimiter)
+	}
+	if r.CircuitBreaker.Policies[0].MaxWaitDurationInOpen != "5m" {
+		t.Errorf("circuit breaker backoff should be kept, got %+v", r.CircuitBreaker.Policies[0])
+	}
+	if r.Retryer.Budget != old.Retryer.Budget || !reflect.DeepEqual(r.Retryer.RetryOnStatusCodes, []int{503}) {
+		t.Errorf("retry budget and conditions should be kept, got %+v", r.Retryer)
+	}
+	if r.TimeLimiter.URLs[0].TimeoutDuration != "1s" {
+		t.Errorf("per-URL timeout should be kept, got %+v", r.TimeLimiter.URLs[0])
+	}
+}
+
+func TestPipelineBuilderRetryOn(t *testing.T) {
+	r := &retryer.Spec{
+		Policies: []*retryer.Policy{{
+			Name: "default",
+		}},
+		DefaultPolicyRef: "default",
+		URLs: []*retryer.URLRule{{
+			URLRule: urlrule.URLRule{
+				URL: urlrule.StringMatch{Prefix: "/"},
+			},
+		}},
+		RetryOnStatusCodes:   []int{502, 503, 504},
+		IdempotencyKeyHeader: "X-Request-Key",
+	}
+
+	builder := newPipelineSpecBuilder("retryon")
+	builder.appendRetryer(r)
+	if _, err := supervisor.NewSpec(builder.yamlConfig()); err != nil {
+		t.Fatalf("new spec failed: %v", err)
+	}
+	filter := builder.Filters[0]
+	if !reflect.DeepEqual(filter["retryOnStatusCodes"], []int{502, 503, 504}) ||
+		filter["idempotencyKeyHeader"] != "X-Request-Key" {
+		t.Errorf("retry options should be passed through, got %v", filter)
+	}
+	if _, ok := filter["retryNonIdempotent"]; ok {
+		t.Errorf("non-idempotent requests should not be retried by default, got %v", filter)
+	}
+}
+
+func TestRateLimiterAlgorithm(t *testing.T) {
+	rateLimiter := &ratelimiter.Spec{
+		Policies: []*ratelimiter.Policy{{
+			Name:      "default",
+			Algorithm: "slidingLog",
+		}},
+		DefaultPolicyRef: "default",
+		URLs: []*ratelimiter.URLRule{{
+			URLRule: urlrule.URLRule{
+				URL: urlrule.StringMatch{Prefix: "/"},
+			},
+		}},
+	}
+
+	if vr := v.Validate(rateLimiter); !vr.Valid() {
+		t.Errorf("slidingLog algorithm should be valid: %v", vr)
+	}
+
+	builder := newPipelineSpecBuilder("algorithm")
+	builder.appendRateLimiter(rateLimiter)
+	if !strings.Contains(builder.yamlConfig(), "algorithm: slidingLog") {
+		t.Errorf("algorithm should be passed through, got %s", builder.yamlConfig())
+	}
+
+	rateLimiter.Policies[0].Algorithm = "leakyBucket"
+	if vr := v.Validate(rateLimiter); vr.Valid() {
+		t.Errorf("unknown algorithm should be invalid")
+	}
+}
+
+func TestPipelineBuilderAdaptiveRateLimiter(t *testing.T) {
+	rateLimiter := &ratelimiter.Spec{
+		Policies: []*ratelimiter.Policy{{
+			Name:           "default",
+			LimitForPeriod: 50,
+		}},
+		DefaultPolicyRef: "default",
+		URLs: []*ratelimiter.URLRule{{
+			URLRule: urlrule.URLRule{
+				URL: urlrule.StringMatch{Prefix: "/"},
+			},
+		}},
+	}
+
+	builder := newPipelineSpecBuilder("static")
+	builder.appendRateLimiter(rateLimiter)
+	if _, exists := builder.Filters[0]["adaptive"]; exists {
+		t.Errorf("static rate limiter should not be adaptive")
+	}
+
+	rateLimiter.Adaptive = &ratelimiter.Adaptive{
+		TargetLatency: "200ms",
+		Step:          10,
+	}
+	builder = newPipelineSpecBuilder("adaptive")
+	builder.appendRateLimiter(rateLimiter)
+	superSpec, err := supervisor.NewSpec(builder.yamlConfig())
+	if err != nil {
+		t.Fatalf("new spec failed: %v", err)
+	}
+	pipelineSpec := superSpec.ObjectSpec().(*httppipeline.Spec)
+	if !strings.Contains(superSpec.YAMLConfig(), "targetLatency: 200ms") ||
+		len(pipelineSpec.Filters) != 1 {
+		t.Errorf("adaptive rate limiter should be passed through, got %s", superSpec.YAMLConfig())
+	}
+}
+
+func TestIngressPipelineSpec(t *testing.T) {
+	s := &Service{
+		Name: "order-001",
+		LoadBalance: &LoadBalance{
+			Policy: proxy.PolicyRandom,
+		},
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+	}
+	instanceSpecs := []*ServiceInstanceSpec{
+		{
+			ServiceName: "fake-001",
+			InstanceID:  "xxx-89757",
+			IP:          "192.168.0.110",
+			Port:        80,
+			Status:      "UP",
+		},
+		{
+			ServiceName: "fake-002",
+			InstanceID:  "zzz-73597",
+			IP:          "192.168.0.120",
+			Port:        80,
+			Status:      "UP",
+		},
+	}
+	superSpec, err := s.IngressPipelineSpec(instanceSpecs)
+
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	fmt.Println(superSpec.YAMLConfig())
+}
+
+func TestSidecarIngressPipelineSpec(t *testing.T) {
+	s := &Service{
+		Name: "order-001",
+		LoadBalance: &LoadBalance{
+			Policy: proxy.PolicyRandom,
+		},
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+	}
+
+	superSpec, err := s.SideCarIngressHTTPServerSpec(nil)
+
+	if err != nil {
+		t.Fatalf("ingress http server spec failed: %v", err)
+	}
+	fmt.Println(superSpec.YAMLConfig())
+
+	superSpec, err = s.SideCarEgressHTTPServerSpec()
+
+	if err != nil {
+		t.Fatalf("egress http server spec failed: %v", err)
+	}
+
+	fmt.Println(superSpec.YAMLConfig())
+}
+
+func TestUniqueCanaryHeadersEmpty(t *testing.T) {
+	s := &Service{
+		Name: "order-001",
+		LoadBalance: &LoadBalance{
+			Policy: proxy.PolicyRandom,
+		},
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+	}
+
+	val := s.UniqueCanaryHeaders()
+	if len(val) > 0 {
+		t.Errorf("canary header should be none")
+	}
+
+}
+
+func TestUniqueCanaryHeaders(t *testing.T) {
+	s := &Service{
+		Name: "order-002-canary",
+		LoadBalance: &LoadBalance{
+			Policy: proxy.PolicyIPHash,
+		},
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+
+		Canary: &Canary{
+			CanaryRules: []*CanaryRule{
+				{
+					Headers: map[string]*urlrule.StringMatch{
+						"X-canary": {
+							Exact: "lv1",
+						},
+					},
+					URLs: []*urlrule.URLRule{
+						{
+							Methods: []string{
+								"GET",
+								"POST",
+							},
+							URL: urlrule.StringMatch{
+								Prefix: "/",
+							},
+						},
+					},
+					ServiceInstanceLabels: map[string]string{
+						"version": "v1",
+					},
+				},
+			},
+		},
+	}
+
+	val := s.UniqueCanaryHeaders()
+	if len(val) == 0 {
+		t.Errorf("canary header should not be none")
+	}
+}
+
+func TestEgressName(t *testing.T) {
+	s := &Service{
+		Name: "order-001",
+		LoadBalance: &LoadBalance{
+			Policy: proxy.PolicyRandom,
+		},
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+	}
+	if len(s.EgressHTTPServerName()) == 0 {
+		t.Error("egress httpserver name should not be none")
+	}
+
+	if len(s.EgressHandlerName()) == 0 {
+		t.Error("egress httpserver handler should not be none")
+	}
+
+	if len(s.IngressHTTPServerName()) == 0 {
+		t.Error("ingress httpserver handler should not be none")
+	}
+
+	if len(s.IngressHandlerName()) == 0 {
+		t.Error("ingress httpserver handler should not be none")
+	}
+
+	if len(s.BackendName()) == 0 {
+		t.Error("backend name should not be none")
+	}
+
+	if len(s.IngressEndpoint()) == 0 {
+		t.Error("ingress endpoint name should not be none")
+	}
+
+	if len(s.EgressEndpoint()) == 0 {
+		t.Error("egress endpoint name should not be none")
+	}
+}
+
+func TestCustomResource(t *testing.T) {
+	r := CustomResource{}
+	if r.Name() != "" {
+		t.Error("name should be empty")
+	}
+	r["name"] = 1
+	if r.Name() != "" {
+		t.Error("name should be empty")
+	}
+	r["name"] = "obj1"
+	if r.Name() != "obj1" {
+		t.Error("name should be obj1")
+	}
+
+	if r.Kind() != "" {
+		t.Error("kind should be empty")
+	}
+	r["kind"] = 1
+	if r.Kind() != "" {
+		t.Error("kind should be empty")
+	}
+	r["kind"] = "kind1"
+	if r.Kind() != "kind1" {
+		t.Error("kind should be kind1")
+	}
+}
+
+func TestCustomResourceKindValidate(t *testing.T) {
+	k := &CustomResourceKind{Name: "kind1"}
+	if err := k.Validate(); err != nil {
+		t.Errorf("empty schema should be valid: %v", err)
+	}
+
+	k.JSONSchema = `{"type": "object", "properties": {"replicas": {"type": "integer"}}`
+	if err := k.Validate(); err == nil {
+		t.Errorf("broken schema should be invalid")
+	}
+
+	k.JSONSchema = `{
+		"type": "object",
+		"properties": {"replicas": {"type": "integer", "minimum": 1}},
+		"required": ["replicas"]
+	}`
+	if err := k.Validate(); err != nil {
+		t.Errorf("schema should be valid: %v", err)
+	}
+
+	r := CustomResource{"kind": "kind1", "name": "obj1", "replicas": 2}
+	if err := k.ValidateResource(r); err != nil {
+		t.Errorf("resource should be valid: %v", err)
+	}
+
+	r["replicas"] = 0
+	if err := k.ValidateResource(r); err == nil {
+		t.Errorf("resource violating minimum should be invalid")
+	}
+
+	delete(r, "replicas")
+	if err := k.ValidateResource(r); err == nil {
+		t.Errorf("resource missing required field should be invalid")
+	}
+
+	r["kind"] = "kind2"
+	if err := k.ValidateResource(r); err == nil {
+		t.Errorf("resource of another kind should be invalid")
+	}
+
+	k.JSONSchema = ""
+	r = CustomResource{"kind": "kind1", "name": "obj1", "anything": []int{1, 2}}
+	if err := k.ValidateResource(r); err != nil {
+		t.Errorf("empty schema should allow any object: %v", err)
+	}
+}
+
+func TestCustomResourceKindFillDefaults(t *testing.T) {
+	k := &CustomResourceKind{
+		Name: "kind1",
+		JSONSchema: `{
+			"type": "object",
+			"properties": {
+				"replicas": {"type": "integer", "default": 1},
+				"paused": {"type": "boolean", "default": true},
+				"strategy": {
+					"type": "object",
+					"properties": {
+						"type": {"type": "string", "default": "rolling"},
+						"maxSurge": {"type": "integer", "default": 2}
+					}
+				}
+			}
+		}`,
+	}
+
+	r := CustomResource{"kind": "kind1", "name": "obj1"}
+	if err := k.FillDefaults(r); err != nil {
+		t.Fatalf("fill defaults failed: %v", err)
+	}
+	if len(r) != 2 {
+		t.Errorf("defaults should not be applied without opt-in: %v", r)
+	}
+
+	k.ApplyDefaults = true
+	r = CustomResource{
+		"kind":   "kind1",
+		"name":   "obj1",
+		"paused": false,
+		"strategy": map[interface{}]interface{}{
+			"maxSurge": 0,
+		},
+	}
+	if err := k.FillDefaults(r); err != nil {
+		t.Fatalf("fill defaults failed: %v", err)
+	}
+
+	if r["replicas"] != float64(1) {
+		t.Errorf("replicas should be filled with default, got %v", r["replicas"])
+	}
+	if r["paused"] != false {
+		t.Errorf("explicit zero value should not be overwritten, got %v", r["paused"])
+	}
+	strategy := r["strategy"].(map[interface{}]interface{})
+	if strategy["type"] != "rolling" {
+		t.Errorf("nested field should be filled with default, got %v", strategy["type"])
+	}
+	if strategy["maxSurge"] != 0 {
+		t.Errorf("nested explicit zero value should not be overwritten, got %v", strategy["maxSurge"])
+	}
+}
+
+func TestCanaryRulesLimit(t *testing.T) {
+	a := Admin{
+		RegistryType:      "eureka",
+		HeartbeatInterval: "10s",
+	}
+	if a.CanaryRulesLimit() != DefaultMaxCanaryRules {
+		t.Errorf("canary rules limit should be %d", DefaultMaxCanaryRules)
+	}
+
+	a.MaxCanaryRules = 2
+	if a.CanaryRulesLimit() != 2 {
+		t.Errorf("canary rules limit should be 2")
+	}
+
+	a.MaxCanaryRules = -1
+	if a.Validate() == nil {
+		t.Errorf("negative maxCanaryRules is invalid, should failed")
+	}
+}
+
+func TestValidateCanaryRules(t *testing.T) {
+	s := &Service{
+		Name: "order-003-canary",
+	}
+	if err := s.ValidateCanaryRules(2); err != nil {
+		t.Errorf("service without canary should pass, err: %v", err)
+	}
+
+	rule := &CanaryRule{
+		Headers: map[string]*urlrule.StringMatch{
+			"X-canary": {
+				Exact: "lv1",
+			},
+		},
+		ServiceInstanceLabels: map[string]string{
+			"version": "v1",
+		},
+	}
+
+	s.Canary = &Canary{
+		CanaryRules: []*CanaryRule{rule, rule},
+	}
+	if err := s.ValidateCanaryRules(2); err != nil {
+		t.Errorf("canary rules at the limit should pass, err: %v", err)
+	}
+
+	s.Canary.CanaryRules = append(s.Canary.CanaryRules, rule)
+	if err := s.ValidateCanaryRules(2); err == nil {
+		t.Errorf("canary rules over the limit should failed")
+	}
+}
+
+func TestObservabilityEnabledIndependently(t *testing.T) {
+	o := &Observability{
+		Tracings: &ObservabilityTracings{
+			Enabled:     false,
+			Output:      ObservabilityTracingsOutputConfig{Enabled: true},
+			Request:     ObservabilityTracingsDetail{Enabled: true},
+			Jdbc:        ObservabilityTracingsDetail{Enabled: true},
+			Propagation: &ObservabilityTracingsPropagation{Format: "b3"},
+		},
+		Metrics: &ObservabilityMetrics{
+			Enabled: true,
+			Access:  ObservabilityMetricsDetail{Enabled: true},
+			Request: ObservabilityMetricsDetail{Enabled: true},
+		},
+	}
+	if o.TracingsEnabled() || !o.MetricsEnabled() {
+		t.Fatalf("want tracings disabled and metrics enabled")
+	}
+
+	agent := o.AgentObservability()
+	if agent.Tracings.Output.Enabled || agent.Tracings.Request.Enabled || agent.Tracings.Jdbc.Enabled {
+		t.Errorf("want details of disabled tracings disabled, got %+v", agent.Tracings)
+	}
+	if !agent.Metrics.Access.Enabled || !agent.Metrics.Request.Enabled {
+		t.Errorf("want details of enabled metrics kept, got %+v", agent.Metrics)
+	}
+	if !o.Tracings.Request.Enabled {
+		t.Errorf("the observability itself should not be changed")
+	}
+
+	o.Tracings.Enabled, o.Metrics.Enabled = true, false
+	agent = o.AgentObservability()
+	if !agent.Tracings.Request.Enabled || agent.Metrics.Access.Enabled || agent.Metrics.Request.Enabled {
+		t.Errorf("want tracings kept and metrics disabled, got %+v %+v", agent.Tracings, agent.Metrics)
+	}
+
+	o.Tracings.Enabled = false
+	s := &Service{
+		Name: "order-011-hot",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+		Observability: o,
+	}
+	superSpec, err := s.SideCarIngressPipelineSpec(443)
+	if err != nil {
+		t.Fatalf("generate ingress pipeline failed: %v", err)
+	}
+	if strings.Contains(superSpec.YAMLConfig(), "TracePropagator") {
+		t.Errorf("disabled tracings should not build tracing filters")
+	}
+
+	var nilObservability *Observability
+	if nilObservability.TracingsEnabled() || nilObservability.MetricsEnabled() ||
+		nilObservability.AgentObservability() != nil {
+		t.Errorf("want nothing enabled for nil observability")
+	}
+}
+
+func TestObservabilityMetricsStatsD(t *testing.T) {
+	m := ObservabilityMetrics{
+		Enabled: true,
+		Output:  MetricsOutputStatsD,
+	}
+	if m.Validate() == nil {
+		t.Error("statsd output without statsd config should failed")
+	}
+
+	m.StatsD = &ObservabilityMetricsStatsD{
+		Host: "statsd.mesh.svc",
+		Port: 8125,
+	}
+	if err := m.Validate(); err != nil {
+		t.Errorf("metrics should be valid, err: %v", err)
+	}
+	if err := m.StatsD.Validate(); err != nil {
+		t.Errorf("statsd host should be valid, err: %v", err)
+	}
+	if m.StatsD.Address() != "statsd.mesh.svc:8125" {
+		t.Errorf("unexpected statsd address: %s", m.StatsD.Address())
+	}
+
+	m.StatsD.Host = "::1"
+	if err := m.StatsD.Validate(); err != nil {
+		t.Errorf("statsd ip should be valid, err: %v", err)
+	}
+	if m.StatsD.Address() != "[::1]:8125" {
+		t.Errorf("unexpected statsd address: %s", m.StatsD.Address())
+	}
+
+	m.StatsD.Host = "bad host"
+	if m.StatsD.Validate() == nil {
+		t.Error("statsd host with space should failed")
+	}
+}
+
+func TestSideCarEgressPipelineSpecWithMockAndCanary(t *testing.T) {
+	s := &Service{
+		Name: "order-005-mock-canary",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+		Mock: &Mock{
+			Enabled: true,
+			Rules: []*mock.Rule{
+				{
+					Path: "/mocked",
+					Code: 200,
+					Body: "mock ok!",
+				},
+			},
+		},
+		Canary: &Canary{
+			CanaryRules: []*CanaryRule{
+				{
+					Headers: map[string]*urlrule.StringMatch{
+						"X-canary": {
+							Exact: "lv1",
+						},
+					},
+					ServiceInstanceLabels: map[string]string{
+						"version": "v1",
+					},
+				},
+			},
+		},
+	}
+
+	if s.MockShadowsCanary() {
+		t.Errorf("mock rules with exact path should not shadow canary")
+	}
+
+	flowNames := func(instanceSpecs []*ServiceInstanceSpec) []string {
+		superSpec, err := s.SideCarEgressPipelineSpec(instanceSpecs)
+		if err != nil {
+			t.Fatalf("generate egress pipeline failed: %v", err)
+		}
+		pipelineSpec := superSpec.ObjectSpec().(*httppipeline.Spec)
+
+		names := []string{}
+		for _, flow := range pipelineSpec.Flow {
+			names = append(names, flow.Filter)
+		}
+		if pipelineSpec.Flow[0].JumpIf[mock.ResultMocked] != httppipeline.LabelEND {
+			t.Errorf("mocked requests should jump to END")
+		}
+		return names
+	}
+
+	names := flowNames(nil)
+	if len(names) != 1 || names[0] != "mock" {
+		t.Errorf("mock service without instances should only mock, got %v", names)
+	}
+
+	instanceSpecs := []*ServiceInstanceSpec{
+		{
+			ServiceName: "order-005-mock-canary",
+			InstanceID:  "xxx-89757",
+			IP:          "192.168.0.110",
+			Port:        80,
+			Status:      ServiceStatusUp,
+		},
+		{
+			ServiceName: "order-005-mock-canary",
+			InstanceID:  "zzz-73597",
+			IP:          "192.168.0.120",
+			Port:        80,
+			Status:      ServiceStatusUp,
+			Labels: map[string]string{
+				"version": "v1",
+			},
+		},
+	}
+
+	names = flowNames(instanceSpecs)
+	if len(names) != 2 || names[0] != "mock" || names[1] != "backend" {
+		t.Errorf("unmatched mock requests should fall through to backend, got %v", names)
+	}
+
+	s.Mock.Rules = append(s.Mock.Rules, &mock.Rule{PathPrefix: "/", Code: 404})
+	if !s.MockShadowsCanary() {
+		t.Errorf("catch-all mock rule should shadow canary")
+	}
+}
+
+func TestSideCarEgressPipelineSpecWithConditionalMock(t *testing.T) {
+	s := &Service{
+		Name:           "order-005-conditional-mock",
+		RegisterTenant: "tenant-001",
+		Mock: &Mock{
+			Enabled: true,
+			Rules: []*mock.Rule{
+				{
+					PathPrefix: "/",
+					Code:       200,
+					Body:       "mock ok!",
+					MatchHeaders: map[string]*urlrule.StringMatch{
+						"X-Mock": {Exact: "true"},
+					},
+				},
+			},
+		},
+	}
+
+	if !s.Runnable() {
+		t.Errorf("service with conditional mocks should be runnable")
+	}
+
+	instanceSpecs := []*ServiceInstanceSpec{{IP: "192.168.0.110", Port: 80, Status: ServiceStatusUp}}
+	superSpec, err := s.SideCarEgressPipelineSpec(instanceSpecs)
+	if err != nil {
+		t.Fatalf("generate egress pipeline failed: %v", err)
+	}
+	pipelineSpec := superSpec.ObjectSpec().(*httppipeline.Spec)
+	if len(pipelineSpec.Flow) != 2 || pipelineSpec.Flow[0].Filter != "mock" ||
+		pipelineSpec.Flow[1].Filter != "backend" {
+		t.Errorf("conditional mock should be ahead of the proxy, got %+v", pipelineSpec.Flow)
+	}
+
+	superSpec, err = s.SideCarEgressPipelineSpec(nil)
+	if err != nil {
+		t.Fatalf("generate egress pipeline failed: %v", err)
+	}
+	pipelineSpec = superSpec.ObjectSpec().(*httppipeline.Spec)
+	if len(pipelineSpec.Flow) != 2 || pipelineSpec.Flow[0].Filter != "mock" ||
+		pipelineSpec.Flow[1].Filter != NoAvailableInstancesFilterName {
+		t.Errorf("unmatched mock requests should be responded without instances, got %+v", pipelineSpec.Flow)
+	}
+
+	s.Mock.Rules = append(s.Mock.Rules, &mock.Rule{Path: "/abc", Code: 200})
+	if s.Runnable() {
+		t.Errorf("service with unconditional mocks should not be runnable")
+	}
+}
+
+func TestValidateDegradationProfiles(t *testing.T) {
+	s := &Service{
+		Name: "order-006-degradation",
+		DegradationProfiles: []*DegradationProfile{
+			{Name: "readonly"},
+			{Name: "static"},
+		},
+	}
+
+	if err := s.ValidateDegradationProfiles(); err != nil {
+		t.Errorf("no active profile should be valid: %v", err)
+	}
+
+	s.ActiveDegradationProfile = "static"
+	if err := s.ValidateDegradationProfiles(); err != nil {
+		t.Errorf("existed active profile should be valid: %v", err)
+	}
+
+	s.ActiveDegradationProfile = "unknown"
+	if err := s.ValidateDegradationProfiles(); err == nil {
+		t.Errorf("unknown active profile should be invalid")
+	}
+
+	s.ActiveDegradationProfile = ""
+	s.DegradationProfiles = append(s.DegradationProfiles, &DegradationProfile{Name: "readonly"})
+	if err := s.ValidateDegradationProfiles(); err == nil {
+		t.Errorf("duplicated profiles should be invalid")
+	}
+}
+
+func TestSideCarEgressPipelineSpecWithDegradation(t *testing.T) {
+	s := &Service{
+		Name: "order-007-degradation",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+		Resilience: &Resilience{
+			Retryer: &retryer.Spec{
+				Policies: []*retryer.Policy{{
+					Name:               "default",
+					MaxAttempts:        3,
+					WaitDuration:       "500ms",
+					BackOffPolicy:      "random",
+					FailureStatusCodes: []int{500, 501},
+				}},
+				DefaultPolicyRef: "default",
+				URLs: []*retryer.URLRule{{
+					URLRule: urlrule.URLRule{
+						URL:       urlrule.StringMatch{Prefix: "/"},
+						PolicyRef: "default",
+					},
+				}},
+			},
+		},
+		Canary: &Canary{
+			CanaryRules: []*CanaryRule{
+				{
+					Headers: map[string]*urlrule.StringMatch{
+						"X-canary": {
+							Exact: "lv1",
+						},
+					},
+					ServiceInstanceLabels: map[string]string{
+						"version": "v1",
+					},
+				},
+			},
+		},
+		DegradationProfiles: []*DegradationProfile{
+			{
+				Name: "static",
+				MockRules: []*mock.Rule{
+					{
+						Path: "/recommendations",
+						Code: 200,
+						Body: "[]",
+					},
+				},
+				DisableCanary:  true,
+				DisableRetryer: true,
+			},
+		},
+	}
+
+	instanceSpecs := []*ServiceInstanceSpec{
+		{
+			ServiceName: "order-007-degradation",
+			InstanceID:  "xxx-89757",
+			IP:          "192.168.0.110",
+			Port:        80,
+			Status:      ServiceStatusUp,
+		},
+		{
+			ServiceName: "order-007-degradation",
+			InstanceID:  "zzz-73597",
+			IP:          "192.168.0.120",
+			Port:        80,
+			Status:      ServiceStatusUp,
+			Labels: map[string]string{
+				"version": "v1",
+			},
+		},
+	}
+
+	pipeline := func() ([]string, string) {
+		superSpec, err := s.SideCarEgressPipelineSpec(instanceSpecs)
+		if err != nil {
+			t.Fatalf("generate egress pipeline failed: %v", err)
+		}
+
+		names := []string{}
+		for _, flow := range superSpec.ObjectSpec().(*httppipeline.Spec).Flow {
+			names = append(names, flow.Filter)
+		}
+		return names, superSpec.YAMLConfig()
+	}
+
+	names, config := pipeline()
+	if len(names) != 2 || names[0] != "retryer" || names[1] != "backend" {
+		t.Errorf("normal pipeline should retry and proxy, got %v", names)
+	}
+	if !strings.Contains(config, "candidatePools") {
+		t.Errorf("normal pipeline should have canary pools:\n%s", config)
+	}
+
+	s.ActiveDegradationProfile = "static"
+	names, config = pipeline()
+	if len(names) != 2 || names[0] != "mock" || names[1] != "backend" {
+		t.Errorf("degraded pipeline should mock and proxy, got %v", names)
+	}
+	if strings.Contains(config, "candidatePools") {
+		t.Errorf("degraded pipeline should not have canary pools:\n%s", config)
+	}
+	if !strings.Contains(config, "/recommendations") {
+		t.Errorf("degraded pipeline should have profile mock rules:\n%s", config)
+	}
+}
+
+func TestServiceInstanceStatusUpdateAge(t *testing.T) {
+	now := time.Now()
+	timeout := Admin{HeartbeatInterval: "5s"}.HeartbeatTimeout()
+	if timeout != 10*time.Second {
+		t.Fatalf("want heartbeat timeout 10s, got %s", timeout)
+	}
+	if d := (Admin{HeartbeatInterval: "invalid"}).HeartbeatTimeout(); d != 10*time.Second {
+		t.Errorf("want default heartbeat timeout 10s, got %s", d)
+	}
+
+	status := &ServiceInstanceStatus{LastHeartbeatTime: now.Add(-3 * time.Second).Format(time.RFC3339)}
+	status.UpdateAge(now, timeout)
+	if status.AgeSeconds < 2 || status.AgeSeconds > 3 || status.Stale {
+		t.Errorf("want fresh status of about 3s, got %d stale: %v", status.AgeSeconds, status.Stale)
+	}
+
+	status.LastHeartbeatTime = now.Add(-time.Minute).Format(time.RFC3339)
+	status.UpdateAge(now, timeout)
+	if !status.Stale {
+		t.Errorf("status without heartbeat for 1m should be stale")
+	}
+
+	// NOTE: The clock of the instance is ahead.
+	status.LastHeartbeatTime = now.Add(time.Minute).Format(time.RFC3339)
+	status.UpdateAge(now, timeout)
+	if status.AgeSeconds != 0 || status.Stale {
+		t.Errorf("future heartbeat should be clamped to zero age, got %d stale: %v", status.AgeSeconds, status.Stale)
+	}
+
+	status.LastHeartbeatTime = "invalid"
+	status.UpdateAge(now, timeout)
+	if !status.Stale {
+		t.Errorf("status with invalid heartbeat time should be stale")
+	}
+}
+
+func TestNacosScope(t *testing.T) {
+	scope := Admin{}.NacosScope()
+	if scope.Namespace != NacosDefaultNamespace || scope.Group != NacosDefaultGroup {
+		t.Errorf("want default scope, got %+v", scope)
+	}
+	if !scope.Match("", "") || !scope.Match("public", "DEFAULT_GROUP") {
+		t.Errorf("empty namespace and group should match the default scope")
+	}
+
+	scope = Admin{Nacos: &NacosScope{Namespace: "prod", Group: "order"}}.NacosScope()
+	if !scope.Match("prod", "order") {
+		t.Errorf("scope %+v should match prod/order", scope)
+	}
+	if scope.Match("", "order") || scope.Match("prod", "") || scope.Match("dev", "order") {
+		t.Errorf("scope %+v should only match prod/order", scope)
+	}
+
+	if (NacosScope{Group: "a@@b"}).Validate() == nil {
+		t.Errorf("group with @@ should be invalid")
+	}
+}
+
+func TestSideCarEgressHTTPServerRules(t *testing.T) {
+	s := &Service{
+		Name: "order",
+		EgressRoutes: []*EgressRoute{
+			{Service: "payment", PathPrefix: "/pay/"},
+			{Service: "unknown", Host: "unknown.example.com"},
+		},
+	}
+	targets := map[string]string{
+		"payment":  "mesh-egress-pipeline-payment",
+		"delivery": "mesh-egress-pipeline-delivery",
+	}
+
+	rules := s.SideCarEgressHTTPServerRules(targets)
+
+	// 2 header rules, 1 egress route, 2 host rules and the unmatched rule.
+	if len(rules) != 6 {
+		t.Fatalf("want 6 rules, got %d", len(rules))
+	}
+	for i, name := range []string{"delivery", "payment"} {
+		path := rules[i].Paths[0]
+		if rules[i].Host != "" || path.Backend != targets[name] ||
+			path.Headers[0].Key != EgressServiceHeader || path.Headers[0].Values[0] != name {
+			t.Errorf("rule %d should route header %s to %s", i, name, targets[name])
+		}
+	}
+	if path := rules[2].Paths[0]; path.PathPrefix != "/pay/" || path.Backend != targets["payment"] ||
+		path.Headers[0].Regexp != "^$" {
+		t.Errorf("rule 2 should route path prefix /pay/ to payment")
+	}
+	for i, name := range []string{"delivery", "payment"} {
+		if rule := rules[3+i]; rule.Host != name || rule.Paths[0].Backend != targets[name] {
+			t.Errorf("rule %d should route host %s to %s", 3+i, name, targets[name])
+		}
+	}
+	if path := rules[5].Paths[0]; path.Backend != s.EgressUnmatchedPipelineName() || path.Headers[0].Regexp != ".*" {
+		t.Errorf("the last rule should route all other requests to the unmatched pipeline")
+	}
+
+	superSpec, err := s.SideCarEgressUnmatchedPipelineSpec()
+	if err != nil {
+		t.Fatalf("generate unmatched pipeline spec failed: %v", err)
+	}
+	if superSpec.Name() != s.EgressUnmatchedPipelineName() || !strings.Contains(superSpec.YAMLConfig(), "code: 503") {
+		t.Errorf("unmatched pipeline should respond 503:\n%s", superSpec.YAMLConfig())
+	}
+}
+
+func TestEgressRouteValidate(t *testing.T) {
+	if err := (EgressRoute{Service: "payment"}).Validate(); err == nil {
+		t.Errorf("want error for egress route without host and path prefix")
+	}
+	if err := (EgressRoute{Service: "payment", Host: "payment.local"}).Validate(); err != nil {
+		t.Errorf("want no error, got %v", err)
+	}
+}
+
+func TestHeaderRulesAddAndSet(t *testing.T) {
+	rules := &HeaderRules{
+		Request: &httpheader.AdaptSpec{
+			Del: []string{"X-Internal-Token"},
+			Set: map[string]string{"X-Mesh-Service": "order"},
+			Add: map[string]string{"X-Forwarded-Service": "order"},
+		},
+	}
+
+	header := http.Header{}
+	header.Set("X-Internal-Token", "secret")
+	header.Add("X-Mesh-Service", "spoofed")
+	header.Add("X-Forwarded-Service", "gateway")
+
+	httpheader.New(header).Adapt(rules.Request, texttemplate.NewDummyTemplate())
+
+	if v := header.Values("X-Internal-Token"); len(v) != 0 {
+		t.Errorf("removed header should be gone, got %v", v)
+	}
+	if v := header.Values("X-Mesh-Service"); !reflect.DeepEqual(v, []string{"order"}) {
+		t.Errorf("set should replace existing values, got %v", v)
+	}
+	if v := header.Values("X-Forwarded-Service"); !reflect.DeepEqual(v, []string{"gateway", "order"}) {
+		t.Errorf("add should append to existing values, got %v", v)
+	}
+}
+
+func TestSideCarPipelineSpecWithHeaderManipulation(t *testing.T) {
+	headerRules := func(service string) *HeaderRules {
+		return &HeaderRules{
+			Request: &httpheader.AdaptSpec{
+				Set: map[string]string{"X-Mesh-Service": service},
+			},
+			Response: &httpheader.AdaptSpec{
+				Del: []string{"X-Internal-Trace"},
+			},
+		}
+	}
+	order := &Service{
+		Name: "order",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+		HeaderManipulation: &HeaderManipulation{
+			Ingress: headerRules("ingress"),
+			Egress:  headerRules("order"),
+		},
+	}
+	payment := &Service{
+		Name:    "payment",
+		Sidecar: order.Sidecar,
+	}
+
+	filterNames := func(superSpec *supervisor.Spec) []string {
+		names := []string{}
+		for _, flow := range superSpec.ObjectSpec().(*httppipeline.Spec).Flow {
+			names = append(names, flow.Filter)
+		}
+		return names
+	}
+
+	superSpec, err := order.SideCarIngressPipelineSpec(8000)
+	if err != nil {
+		t.Fatalf("generate ingress pipeline failed: %v", err)
+	}
+	want := []string{"requestHeaderAdaptor", "backend", "responseHeaderAdaptor"}
+	if names := filterNames(superSpec); !reflect.DeepEqual(names, want) {
+		t.Errorf("want ingress flow %v, got %v", want, names)
+	}
+
+	instanceSpecs := []*ServiceInstanceSpec{{
+		ServiceName: "payment",
+		InstanceID:  "payment-1",
+		IP:          "192.168.0.110",
+		Port:        80,
+		Status:      ServiceStatusUp,
+	}}
+	superSpec, err = payment.SideCarEgressPipelineSpecForCaller(order, instanceSpecs, nil)
+	if err != nil {
+		t.Fatalf("generate egress pipeline failed: %v", err)
+	}
+	if names := filterNames(superSpec); !reflect.DeepEqual(names, want) {
+		t.Errorf("want egress flow %v, got %v", want, names)
+	}
+	if !strings.Contains(superSpec.YAMLConfig(), "X-Mesh-Service: order") {
+		t.Errorf("egress pipeline should use the header rules of the caller:\n%s", superSpec.YAMLConfig())
+	}
+
+	superSpec, err = payment.SideCarEgressPipelineSpec(instanceSpecs)
+	if err != nil {
+		t.Fatalf("generate egress pipeline failed: %v", err)
+	}
+	if names := filterNames(superSpec); !reflect.DeepEqual(names, []string{"backend"}) {
+		t.Errorf("want egress flow without header adaptors, got %v", names)
+	}
+}
+
+func TestValidateHeaderManipulation(t *testing.T) {
+	s := &Service{
+		Name: "order",
+		Canary: &Canary{
+			CanaryRules: []*CanaryRule{{
+				Headers:               map[string]*urlrule.StringMatch{"X-Canary": {Exact: "v2"}},
+				ServiceInstanceLabels: map[string]string{"version": "v2"},
+			}},
+		},
+		HeaderManipulation: &HeaderManipulation{
+			Ingress: &HeaderRules{
+				Request: &httpheader.AdaptSpec{Del: []string{"X-Internal-Token"}},
+			},
+		},
+	}
+	if err := s.ValidateHeaderManipulation(nil); err != nil {
+		t.Errorf("want no error, got %v", err)
+	}
+
+	for _, header := range []string{"x-canary", "X-Mesh-Rpc-Service", "X-Location"} {
+		s.HeaderManipulation.Ingress.Request.Del = []string{header}
+		if err := s.ValidateHeaderManipulation([]string{"X-Location"}); err == nil {
+			t.Errorf("want error for removing routing header %s", header)
+		}
+	}
+}
+
+func TestSideCarPipelineSpecWithCanaryPropagation(t *testing.T) {
+	order := &Service{
+		Name: "order",
+		Sidecar: &Sidecar{
 			Address:         "127.0.0.1",
 			IngressPort:     8080,
 			IngressProtocol: "http",
 			EgressPort:      9090,
 			EgressProtocol:  "http",
 		},
+		Canary: &Canary{
+			CanaryRules: []*CanaryRule{{
+				Headers: map[string]*urlrule.StringMatch{
+					"X-Location": {Exact: "beijing"},
+					"X-Canary":   {Exact: "v2"},
+				},
+				ServiceInstanceLabels: map[string]string{"version": "v2"},
+			}},
+		},
+	}
+	payment := &Service{
+		Name:    "payment",
+		Sidecar: order.Sidecar,
+	}
+
+	if headers := order.CanaryPropagationHeaders(); !reflect.DeepEqual(headers, []string{"X-Canary", "X-Location"}) {
+		t.Errorf("want the canary headers propagated by default, got %v", headers)
+	}
+
+	superSpec, err := order.SideCarIngressPipelineSpec(8000)
+	if err != nil {
+		t.Fatalf("generate ingress pipeline failed: %v", err)
+	}
+	pipelineSpec := superSpec.ObjectSpec().(*httppipeline.Spec)
+	if pipelineSpec.Flow[0].Filter != "canaryHeaderRecorder" {
+		t.Errorf("ingress pipeline should record canary headers first, got %v", pipelineSpec.Flow)
+	}
+
+	instanceSpecs := []*ServiceInstanceSpec{{
+		ServiceName: "payment",
+		InstanceID:  "payment-1",
+		IP:          "192.168.0.110",
+		Port:        80,
+		Status:      ServiceStatusUp,
+	}}
+	superSpec, err = payment.SideCarEgressPipelineSpecForCaller(order, instanceSpecs, nil)
+	if err != nil {
+		t.Fatalf("generate egress pipeline failed: %v", err)
+	}
+	pipelineSpec = superSpec.ObjectSpec().(*httppipeline.Spec)
+	if pipelineSpec.Flow[0].Filter != "canaryHeaderApplier" {
+		t.Errorf("egress pipeline should apply canary headers first, got %v", pipelineSpec.Flow)
+	}
+	if !strings.Contains(superSpec.YAMLConfig(), "store: order") {
+		t.Errorf("egress pipeline should share the store of the caller:\n%s", superSpec.YAMLConfig())
+	}
+
+	order.CanaryPropagation = &CanaryPropagation{
+		Headers:           []string{"X-Tenant"},
+		CorrelationHeader: "traceparent",
+	}
+	if headers := order.CanaryPropagationHeaders(); !reflect.DeepEqual(headers, []string{"X-Tenant"}) {
+		t.Errorf("want the overridden headers, got %v", headers)
+	}
+	superSpec, err = order.SideCarIngressPipelineSpec(8000)
+	if err != nil {
+		t.Fatalf("generate ingress pipeline failed: %v", err)
+	}
+	if !strings.Contains(superSpec.YAMLConfig(), "correlationHeader: traceparent") {
+		t.Errorf("ingress pipeline should use the correlation header:\n%s", superSpec.YAMLConfig())
+	}
+
+	superSpec, err = payment.SideCarIngressPipelineSpec(8000)
+	if err != nil {
+		t.Fatalf("generate ingress pipeline failed: %v", err)
+	}
+	if strings.Contains(superSpec.YAMLConfig(), headerpropagator.Kind) {
+		t.Errorf("service without canary headers should not propagate:\n%s", superSpec.YAMLConfig())
+	}
+}
+
+func TestIPv6Endpoints(t *testing.T) {
+	s := &Service{
+		Name: "order-001",
+		LoadBalance: &LoadBalance{
+			Policy: proxy.PolicyRoundRobin,
+		},
+		Sidecar: &Sidecar{
+			Address:         "fd00::10",
+			IngressPort:     13001,
+			IngressProtocol: "http",
+			EgressPort:      13002,
+			EgressProtocol:  "http",
+		},
+	}
+
+	if got, want := s.ApplicationEndpoint(8080), "http://[fd00::10]:8080"; got != want {
+		t.Errorf("application endpoint: want %s, got %s", want, got)
+	}
+	if got, want := s.IngressEndpoint(), "http://[fd00::10]:13001"; got != want {
+		t.Errorf("ingress endpoint: want %s, got %s", want, got)
+	}
+	if got, want := s.EgressEndpoint(), "http://[fd00::10]:13002"; got != want {
+		t.Errorf("egress endpoint: want %s, got %s", want, got)
+	}
+
+	instanceSpecs := []*ServiceInstanceSpec{
+		{
+			ServiceName: "order-001",
+			InstanceID:  "v6-001",
+			IP:          "fd00::11",
+			Port:        13001,
+			Status:      "UP",
+		},
+	}
+
+	superSpec, err := s.SideCarEgressPipelineSpec(instanceSpecs)
+	if err != nil {
+		t.Fatalf("build egress pipeline failed: %v", err)
+	}
+	if !strings.Contains(superSpec.YAMLConfig(), "http://[fd00::11]:13001") {
+		t.Errorf("egress pipeline should contain bracketed IPv6 server url:\n%s", superSpec.YAMLConfig())
+	}
+}
+
+func TestServiceValidateSidecarAddress(t *testing.T) {
+	cases := []struct {
+		address string
+		valid   bool
+	}{
+		{"192.168.0.10", true},
+		{"fd00::10", true},
+		{"order-001.mesh.svc", true},
+		{"localhost", true},
+		{"", false},
+		{"192.168.0.10:8080", false},
+		{"http://order-001", false},
+		{"order 001", false},
+	}
+
+	for _, c := range cases {
+		s := Service{Name: "order-001", Sidecar: &Sidecar{Address: c.address}}
+		err := s.Validate()
+		if c.valid && err != nil {
+			t.Errorf("address %q should be valid: %v", c.address, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("address %q should be invalid", c.address)
+		}
+	}
+
+	s := &Service{Name: "order-001", Sidecar: &Sidecar{Address: "fd00::10"}}
+	if err := s.ResolveSidecarAddress(); err != nil {
+		t.Errorf("IP address should not be resolved: %v", err)
+	}
+	s.Sidecar.Address = "localhos.invalid"
+	if err := s.ResolveSidecarAddress(); err == nil {
+		t.Errorf("unresolvable hostname should be rejected")
+	}
+}
+
+func TestServiceValidateHealthCheck(t *testing.T) {
+	s := Service{
+		Name:        "order-001",
+		HealthCheck: &HealthCheck{},
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressProtocol: "http",
+		},
+	}
+	if err := s.Validate(); err == nil {
+		t.Errorf("HTTP health check without path should be invalid")
+	}
+
+	s.Sidecar.IngressProtocol = "grpc"
+	if !s.GRPCHealthCheck() {
+		t.Errorf("grpc sidecar should use gRPC health check")
+	}
+	if err := s.Validate(); err != nil {
+		t.Errorf("gRPC health check without path should be valid: %v", err)
+	}
+}
+
+func TestIngressPathValidateBackends(t *testing.T) {
+	p := IngressPath{Path: "/order"}
+	if err := p.Validate(); err == nil {
+		t.Errorf("path without backend should be invalid")
+	}
+
+	p.Backend = "order"
+	p.Backends = []*IngressBackend{{Service: "order", Weight: 1}}
+	if err := p.Validate(); err == nil {
+		t.Errorf("path with both backend and backends should be invalid")
+	}
+
+	p.Backend = ""
+	p.Backends = []*IngressBackend{{Service: "order"}, {Service: "order-v2"}}
+	if err := p.Validate(); err == nil {
+		t.Errorf("backends with zero weights should be invalid")
+	}
+
+	p.Backends = []*IngressBackend{{Service: "order", Weight: 1}, {Service: "order", Weight: 1}}
+	if err := p.Validate(); err == nil {
+		t.Errorf("duplicated backends should be invalid")
+	}
+
+	p.Backends = []*IngressBackend{{Service: "order", Weight: 80}, {Service: "order-v2", Weight: 20}}
+	if err := p.Validate(); err != nil {
+		t.Errorf("weighted backends should be valid: %v", err)
 	}
+}
 
-	superSpec, err := s.SideCarIngressHTTPServerSpec()
+func TestIngressWeightedPipelineSpec(t *testing.T) {
+	backends := []*IngressBackend{
+		{Service: "order", Weight: 60},
+		{Service: "order-v2", Weight: 30},
+		{Service: "order-v3", Weight: 10},
+		{Service: "order-v4", Weight: 50},
+	}
+	services := map[string]*Service{
+		"order":    {Name: "order"},
+		"order-v2": {Name: "order-v2"},
+		"order-v3": {Name: "order-v3"},
+		"order-v4": {Name: "order-v4"},
+	}
+	instanceSpecs := map[string][]*ServiceInstanceSpec{
+		"order":    {{ServiceName: "order", IP: "10.0.0.1", Port: 80, Status: ServiceStatusUp}},
+		"order-v2": {{ServiceName: "order-v2", IP: "10.0.0.2", Port: 80, Status: ServiceStatusUp}},
+		"order-v3": {{ServiceName: "order-v3", IP: "10.0.0.3", Port: 80, Status: ServiceStatusUp}},
+		"order-v4": {{ServiceName: "order-v4", IP: "10.0.0.4", Port: 80, Status: ServiceStatusOutOfService}},
+	}
 
+	superSpec, err := IngressWeightedPipelineSpec(IngressWeightedPipelineName(backends), nil,
+		backends, services, instanceSpecs)
 	if err != nil {
-		t.Fatalf("ingress http server spec failed: %v", err)
+		t.Fatalf("build weighted pipeline failed: %v", err)
+	}
+	if superSpec.Name() != IngressWeightedPipelineName(backends) {
+		t.Errorf("unexpected pipeline name %s", superSpec.Name())
 	}
-	fmt.Println(superSpec.YAMLConfig())
 
-	superSpec, err = s.SideCarEgressHTTPServerSpec()
+	pipeline := &httppipeline.Spec{}
+	if err := yaml.Unmarshal([]byte(superSpec.YAMLConfig()), pipeline); err != nil {
+		t.Fatalf("unmarshal pipeline failed: %v", err)
+	}
+	buff, _ := yaml.Marshal(pipeline.Filters[0])
+	proxySpec := &proxy.Spec{}
+	if err := yaml.Unmarshal(buff, proxySpec); err != nil {
+		t.Fatalf("unmarshal proxy failed: %v", err)
+	}
+
+	// NOTE: order-v4 has no UP instances, so the weights are 60:30:10.
+	if len(proxySpec.CandidatePools) != 2 {
+		t.Fatalf("want 2 candidate pools, got %d", len(proxySpec.CandidatePools))
+	}
+	for i, perMill := range []uint32{600, 750} {
+		if got := proxySpec.CandidatePools[i].Filter.Probability.PerMill; got != perMill {
+			t.Errorf("candidate pool %d: want perMill %d, got %d", i, perMill, got)
+		}
+	}
+	if url := proxySpec.MainPool.Servers[0].URL; url != "http://10.0.0.3:80" {
+		t.Errorf("main pool should be order-v3, got %s", url)
+	}
 
+	instanceSpecs["order"][0].Status = ServiceStatusOutOfService
+	instanceSpecs["order-v2"][0].Status = ServiceStatusOutOfService
+	instanceSpecs["order-v3"][0].Status = ServiceStatusOutOfService
+	superSpec, err = IngressWeightedPipelineSpec("weighted", nil, backends, services, instanceSpecs)
 	if err != nil {
-		t.Fatalf("egress http server spec failed: %v", err)
+		t.Fatalf("generate weighted pipeline without UP instances failed: %v", err)
 	}
+	if flow := superSpec.ObjectSpec().(*httppipeline.Spec).Flow; flow[len(flow)-1].Filter != NoAvailableInstancesFilterName {
+		t.Errorf("backends without UP instances should be responded 503, got %+v", flow)
+	}
+}
 
-	fmt.Println(superSpec.YAMLConfig())
+func TestIngressPathPipelineSpecWithRateLimits(t *testing.T) {
+	ingress := &Ingress{
+		Name:      "ingress-001",
+		RateLimit: &IngressRateLimit{LimitForPeriod: 1000, LimitRefreshPeriod: "1s"},
+	}
+	limited := &IngressPath{Path: "/order", Backend: "order", RateLimit: &IngressRateLimit{LimitForPeriod: 10}}
+	unlimited := &IngressPath{Path: "/user", Backend: "user"}
+
+	if limits := (&Ingress{Name: "ingress-002"}).PathFilters(unlimited); limits != nil {
+		t.Errorf("path without rate limits should get nil, got %+v", limits)
+	}
+
+	s := &Service{Name: "order"}
+	instanceSpecs := []*ServiceInstanceSpec{{ServiceName: "order", IP: "10.0.0.1", Port: 80, Status: ServiceStatusUp}}
+
+	cases := []struct {
+		path  *IngressPath
+		flow  []string
+		scope string
+	}{
+		{limited, []string{"ingressRateLimiter", "pathRateLimiter", "backend"}, "path"},
+		{unlimited, []string{"ingressRateLimiter", "backend"}, "global"},
+	}
+	for _, c := range cases {
+		name := IngressPathPipelineName(ingress.Name, 0, 0)
+		superSpec, err := s.IngressPathPipelineSpec(name, ingress.PathFilters(c.path), instanceSpecs)
+		if err != nil {
+			t.Fatalf("%s scope: build pipeline failed: %v", c.scope, err)
+		}
+
+		pipeline := &httppipeline.Spec{}
+		if err := yaml.Unmarshal([]byte(superSpec.YAMLConfig()), pipeline); err != nil {
+			t.Fatalf("%s scope: unmarshal pipeline failed: %v", c.scope, err)
+		}
+		flow := []string{}
+		for _, f := range pipeline.Flow {
+			flow = append(flow, f.Filter)
+		}
+		if !reflect.DeepEqual(flow, c.flow) {
+			t.Errorf("%s scope: want flow %v, got %v", c.scope, c.flow, flow)
+		}
+		if key := pipeline.Filters[0]["sharedKey"]; key != "mesh-ingress-ingress-001" {
+			t.Errorf("%s scope: ingress rate limiter should be shared, got key %v", c.scope, key)
+		}
+	}
 }
 
-func TestUniqueCanaryHeadersEmpty(t *testing.T) {
-	s := &Service{
-		Name: "order-001",
-		LoadBalance: &LoadBalance{
-			Policy: proxy.PolicyRandom,
+func TestIngressPathPipelineSpecWithCORS(t *testing.T) {
+	ingress := &Ingress{
+		Name: "ingress-001",
+		CORS: &corsadaptor.Spec{
+			AllowedOrigins: []string{"https://shop.example.com"},
+			AllowedMethods: []string{http.MethodGet, http.MethodPost},
+			MaxAge:         600,
 		},
+		RateLimit: &IngressRateLimit{LimitForPeriod: 100},
+	}
+	path := &IngressPath{Path: "/order", Backend: "order"}
+
+	s := &Service{Name: "order"}
+	instanceSpecs := []*ServiceInstanceSpec{{ServiceName: "order", IP: "10.0.0.1", Port: 80, Status: ServiceStatusUp}}
+	superSpec, err := s.IngressPathPipelineSpec("cors", ingress.PathFilters(path), instanceSpecs)
+	if err != nil {
+		t.Fatalf("build pipeline failed: %v", err)
+	}
+
+	pipeline := &httppipeline.Spec{}
+	if err := yaml.Unmarshal([]byte(superSpec.YAMLConfig()), pipeline); err != nil {
+		t.Fatalf("unmarshal pipeline failed: %v", err)
+	}
+	if pipeline.Flow[0].Filter != "corsAdaptor" || len(pipeline.Flow[0].JumpIf) != 0 {
+		t.Errorf("CORS adaptor should go first and end preflight requests, got %+v", pipeline.Flow[0])
+	}
+	if pipeline.Filters[0]["maxAge"] != 600 {
+		t.Errorf("want maxAge 600, got %v", pipeline.Filters[0]["maxAge"])
+	}
+
+	ingress.CORS.AllowCredentials = true
+	if vr := v.Validate(ingress.CORS); !vr.Valid() {
+		t.Errorf("credentials with explicit origins should be valid: %s", vr)
+	}
+	ingress.CORS.AllowedOrigins = []string{"*"}
+	if vr := v.Validate(ingress.CORS); vr.Valid() {
+		t.Errorf("credentials with wildcard origin should be invalid")
+	}
+}
+
+func TestPipelineSpecWithCompression(t *testing.T) {
+	backendCompression := func(superSpec *supervisor.Spec) map[string]interface{} {
+		pipeline := &httppipeline.Spec{}
+		if err := yaml.Unmarshal([]byte(superSpec.YAMLConfig()), pipeline); err != nil {
+			t.Fatalf("unmarshal pipeline failed: %v", err)
+		}
+		for _, f := range pipeline.Filters {
+			if f["name"] == "backend" {
+				c, _ := f["compression"].(map[string]interface{})
+				return c
+			}
+		}
+		t.Fatalf("backend not found in %s", superSpec.YAMLConfig())
+		return nil
+	}
+
+	s := &Service{
+		Name: "order",
 		Sidecar: &Sidecar{
 			Address:         "127.0.0.1",
-			IngressPort:     8080,
+			IngressPort:     13001,
 			IngressProtocol: "http",
-			EgressPort:      9090,
-			EgressProtocol:  "http",
 		},
+		Compression: &Compression{MinLength: 1024, ContentTypes: []string{"application/json"}},
+	}
+	superSpec, err := s.SideCarIngressPipelineSpec(8080)
+	if err != nil {
+		t.Fatalf("build pipeline failed: %v", err)
+	}
+	if c := backendCompression(superSpec); c == nil || c["minLength"] != 1024 {
+		t.Errorf("sidecar ingress should compress with minLength 1024, got %v", c)
 	}
 
-	val := s.UniqueCanaryHeaders()
-	if len(val) > 0 {
-		t.Errorf("canary header should be none")
+	instanceSpecs := []*ServiceInstanceSpec{{ServiceName: "order", IP: "10.0.0.1", Port: 80, Status: ServiceStatusUp}}
+	superSpec, err = s.IngressPipelineSpec(instanceSpecs)
+	if err != nil {
+		t.Fatalf("build pipeline failed: %v", err)
+	}
+	if c := backendCompression(superSpec); c == nil || c["minLength"] != 1024 {
+		t.Errorf("mesh ingress should compress with minLength 1024, got %v", c)
+	}
+
+	ingress := &Ingress{Name: "ingress-001", Compression: &Compression{MinLength: 256}}
+	path := &IngressPath{Path: "/order", Backend: "order"}
+	superSpec, err = s.IngressPathPipelineSpec("compression", ingress.PathFilters(path), instanceSpecs)
+	if err != nil {
+		t.Fatalf("build pipeline failed: %v", err)
+	}
+	if c := backendCompression(superSpec); c == nil || c["minLength"] != 256 {
+		t.Errorf("compression of ingress should take precedence, got %v", c)
 	}
 
+	if vr := v.Validate(&Compression{ContentTypes: []string{"json"}}); vr.Valid() {
+		t.Errorf("content type without subtype should be invalid")
+	}
 }
 
-func TestUniqueCanaryHeaders(t *testing.T) {
+func TestSideCarIngressPipelineSpecWithAuthentication(t *testing.T) {
 	s := &Service{
-		Name: "order-002-canary",
-		LoadBalance: &LoadBalance{
-			Policy: proxy.PolicyIPHash,
-		},
+		Name: "order",
 		Sidecar: &Sidecar{
 			Address:         "127.0.0.1",
-			IngressPort:     8080,
+			IngressPort:     13001,
 			IngressProtocol: "http",
-			EgressPort:      9090,
-			EgressProtocol:  "http",
 		},
-
-		Canary: &Canary{
-			CanaryRules: []*CanaryRule{
-				{
-					Headers: map[string]*urlrule.StringMatch{
-						"X-canary": {
-							Exact: "lv1",
-						},
-					},
-					URLs: []*urlrule.URLRule{
-						{
-							Methods: []string{
-								"GET",
-								"POST",
-							},
-							URL: urlrule.StringMatch{
-								Prefix: "/",
-							},
-						},
-					},
-					ServiceInstanceLabels: map[string]string{
-						"version": "v1",
-					},
-				},
+		Authentication: &Authentication{
+			JWT: &validator.JWTValidatorSpec{
+				Algorithm: "RS256",
+				JWKSURL:   "https://auth.megaease.com/.well-known/jwks.json",
+				Audience:  []string{"order"},
+				Leeway:    "30s",
 			},
 		},
 	}
 
-	val := s.UniqueCanaryHeaders()
-	if len(val) == 0 {
-		t.Errorf("canary header should not be none")
+	superSpec, err := s.SideCarIngressPipelineSpec(8080)
+	if err != nil {
+		t.Fatalf("build pipeline failed: %v", err)
+	}
+
+	pipeline := &httppipeline.Spec{}
+	if err := yaml.Unmarshal([]byte(superSpec.YAMLConfig()), pipeline); err != nil {
+		t.Fatalf("unmarshal pipeline failed: %v", err)
+	}
+	if pipeline.Flow[0].Filter != "authenticator" || len(pipeline.Flow[0].JumpIf) != 0 {
+		t.Errorf("authenticator should go first and end invalid requests, got %+v", pipeline.Flow[0])
+	}
+	jwt, _ := pipeline.Filters[0]["jwt"].(map[string]interface{})
+	if jwt == nil || jwt["jwksURL"] != s.Authentication.JWT.JWKSURL || jwt["leeway"] != "30s" {
+		t.Errorf("unexpected jwt spec %v", pipeline.Filters[0]["jwt"])
 	}
 }
 
-func TestEgressName(t *testing.T) {
-	s := &Service{
-		Name: "order-001",
-		LoadBalance: &LoadBalance{
-			Policy: proxy.PolicyRandom,
+func TestSidecarMTLS(t *testing.T) {
+	newService := func(name string, mtls bool) *Service {
+		return &Service{
+			Name:           name,
+			RegisterTenant: "tenant-001",
+			LoadBalance:    &LoadBalance{Policy: proxy.PolicyRoundRobin},
+			Sidecar: &Sidecar{
+				Address:         "127.0.0.1",
+				IngressPort:     13001,
+				IngressProtocol: "http",
+				EgressPort:      13002,
+				EgressProtocol:  "http",
+				MTLS:            mtls,
+			},
+		}
+	}
+
+	root, err := NewRootCertificate(RootCertTTL)
+	if err != nil {
+		t.Fatalf("create root certificate failed: %v", err)
+	}
+	orderCert, err := root.SignServiceCertificate("order", DefaultCertTTL)
+	if err != nil {
+		t.Fatalf("sign certificate failed: %v", err)
+	}
+	certs := &MTLSCerts{Root: root, Service: orderCert}
+
+	order := newService("order", true)
+	if _, err := order.SideCarIngressHTTPServerSpec(nil); err == nil {
+		t.Errorf("ingress server should not be created before the certificates are issued")
+	}
+	superSpec, err := order.SideCarIngressHTTPServerSpec(certs)
+	if err != nil {
+		t.Fatalf("generate ingress server failed: %v", err)
+	}
+	server := &httpserver.Spec{}
+	if err := yaml.Unmarshal([]byte(superSpec.YAMLConfig()), server); err != nil {
+		t.Fatalf("unmarshal server failed: %v", err)
+	}
+	if !server.HTTPS || server.CACertBase64 != root.CertBase64 || server.KeyBase64 != orderCert.KeyBase64 {
+		t.Errorf("ingress server should serve mTLS with the certificates:\n%s", superSpec.YAMLConfig())
+	}
+
+	instanceSpecs := []*ServiceInstanceSpec{{
+		ServiceName: "payment",
+		InstanceID:  "payment-1",
+		IP:          "192.168.0.110",
+		Port:        13001,
+		Status:      ServiceStatusUp,
+	}}
+
+	payment := newService("payment", true)
+	superSpec, err = payment.SideCarEgressPipelineSpecForCaller(order, instanceSpecs, certs)
+	if err != nil {
+		t.Fatalf("generate egress pipeline failed: %v", err)
+	}
+	yamlConfig := superSpec.YAMLConfig()
+	if !strings.Contains(yamlConfig, "https://192.168.0.110:13001") || !strings.Contains(yamlConfig, "serverName: payment") {
+		t.Errorf("egress pipeline should send requests over mTLS:\n%s", yamlConfig)
+	}
+
+	if _, err := payment.SideCarEgressPipelineSpecForCaller(order, instanceSpecs, nil); err == nil {
+		t.Errorf("egress pipeline should not be created before the certificates are issued")
+	}
+	if _, err := newService("payment", false).SideCarEgressPipelineSpecForCaller(order, instanceSpecs, certs); err == nil {
+		t.Errorf("egress pipeline should fail if the service disables mTLS")
+	}
+	if _, err := payment.SideCarEgressPipelineSpecForCaller(newService("order", false), instanceSpecs, nil); err == nil {
+		t.Errorf("egress pipeline should fail if the caller disables mTLS")
+	}
+
+	if _, err := payment.IngressPipelineSpec(instanceSpecs); err == nil {
+		t.Errorf("mesh ingress should reject the service enabling mTLS")
+	}
+}
+
+func TestServiceWithTenantDefaults(t *testing.T) {
+	newRetryer := func(maxAttempts int) *retryer.Spec {
+		return &retryer.Spec{
+			Policies: []*retryer.Policy{{
+				Name:         "default",
+				MaxAttempts:  maxAttempts,
+				WaitDuration: "500ms",
+			}},
+			DefaultPolicyRef: "default",
+			URLs: []*retryer.URLRule{{
+				URLRule: urlrule.URLRule{URL: urlrule.StringMatch{Prefix: "/"}},
+			}},
+		}
+	}
+
+	tenant := &Tenant{
+		Name: "tenant-001",
+		DefaultResilience: &Resilience{
+			CircuitBreaker: &circuitbreaker.Spec{
+				Policies: []*circuitbreaker.Policy{{
+					Name:                             "default",
+					PermittedNumberOfCallsInHalfOpen: 1,
+					WaitDurationInOpen:               "10s",
+				}},
+				DefaultPolicyRef: "default",
+				URLs: []*circuitbreaker.URLRule{{
+					URLRule: urlrule.URLRule{URL: urlrule.StringMatch{Prefix: "/"}},
+				}},
+			},
+			Retryer: newRetryer(3),
 		},
+	}
+
+	s := &Service{
+		Name:           "order",
+		RegisterTenant: "tenant-001",
+		LoadBalance:    &LoadBalance{Policy: proxy.PolicyRoundRobin},
 		Sidecar: &Sidecar{
 			Address:         "127.0.0.1",
-			IngressPort:     8080,
+			IngressPort:     13001,
 			IngressProtocol: "http",
-			EgressPort:      9090,
+			EgressPort:      13002,
 			EgressProtocol:  "http",
 		},
+		Resilience: &Resilience{Retryer: newRetryer(5)},
 	}
-	if len(s.EgressHTTPServerName()) == 0 {
-		t.Error("egress httpserver name should not be none")
+
+	if s.WithTenantDefaults(nil) != s || s.WithTenantDefaults(&Tenant{}) != s {
+		t.Errorf("service should be used as is without default resilience")
 	}
 
-	if len(s.EgressHandlerName()) == 0 {
-		t.Error("egress httpserver handler should not be none")
+	effective := s.WithTenantDefaults(tenant)
+	if effective.Resilience.CircuitBreaker != tenant.DefaultResilience.CircuitBreaker {
+		t.Errorf("circuit breaker should be inherited from the tenant")
+	}
+	if effective.Resilience.Retryer != s.Resilience.Retryer {
+		t.Errorf("retryer of the service should override the tenant one")
+	}
+	if s.Resilience.CircuitBreaker != nil {
+		t.Errorf("the service itself should not be changed")
 	}
 
-	if len(s.IngressHTTPServerName()) == 0 {
-		t.Error("ingress httpserver handler should not be none")
+	instanceSpecs := []*ServiceInstanceSpec{{
+		ServiceName: "order",
+		InstanceID:  "order-1",
+		IP:          "192.168.0.110",
+		Port:        13001,
+		Status:      ServiceStatusUp,
+	}}
+	superSpec, err := effective.SideCarEgressPipelineSpec(instanceSpecs)
+	if err != nil {
+		t.Fatalf("generate egress pipeline failed: %v", err)
+	}
+	names := filterNames(superSpec)
+	if !reflect.DeepEqual(names, []string{"retryer", "circuitBreaker", "backend"}) {
+		t.Errorf("unexpected egress flow %v", names)
+	}
+	if !strings.Contains(superSpec.YAMLConfig(), "maxAttempts: 5") {
+		t.Errorf("egress pipeline should use the retryer of the service:\n%s", superSpec.YAMLConfig())
 	}
 
-	if len(s.IngressHandlerName()) == 0 {
-		t.Error("ingress httpserver handler should not be none")
+	effective = (&Service{Name: "payment"}).WithTenantDefaults(tenant)
+	if effective.Resilience == tenant.DefaultResilience || effective.Resilience.Retryer != tenant.DefaultResilience.Retryer {
+		t.Errorf("service without resilience should get a copy of the tenant defaults")
 	}
+}
 
-	if len(s.BackendName()) == 0 {
-		t.Error("backend name should not be none")
+func TestServiceSetTimestamps(t *testing.T) {
+	created := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := &Service{Name: "order", CreatedAt: "2000-01-01T00:00:00Z", UpdatedAt: "2000-01-01T00:00:00Z"}
+	s.SetTimestamps(nil, created)
+	if s.CreatedAt != "2021-01-01T00:00:00Z" || s.UpdatedAt != s.CreatedAt {
+		t.Errorf("client supplied timestamps should be ignored, got %s %s", s.CreatedAt, s.UpdatedAt)
 	}
 
-	if len(s.IngressEndpoint()) == 0 {
-		t.Error("ingress endpoint name should not be none")
+	updated := created.Add(time.Hour)
+	newSpec := &Service{Name: "order", CreatedAt: "2030-01-01T00:00:00Z", Mock: &Mock{Enabled: true}}
+	newSpec.SetTimestamps(s, updated)
+	if newSpec.CreatedAt != s.CreatedAt {
+		t.Errorf("created time should be immutable, want %s, got %s", s.CreatedAt, newSpec.CreatedAt)
+	}
+	if newSpec.UpdatedAt != "2021-01-01T01:00:00Z" {
+		t.Errorf("updated time should be bumped, got %s", newSpec.UpdatedAt)
 	}
 
-	if len(s.EgressEndpoint()) == 0 {
-		t.Error("egress endpoint name should not be none")
+	// NOTE: The services created before the timestamps get one on updating.
+	newSpec.SetTimestamps(&Service{Name: "order"}, updated)
+	if newSpec.CreatedAt != "2021-01-01T01:00:00Z" {
+		t.Errorf("want created time of the legacy service, got %s", newSpec.CreatedAt)
 	}
 }
 
-func TestCustomResource(t *testing.T) {
-	r := CustomResource{}
-	if r.Name() != "" {
-		t.Error("name should be empty")
+func TestServiceSoftDelete(t *testing.T) {
+	s := &Service{Name: "order"}
+	if s.SoftDeleted() || !s.Runnable() {
+		t.Errorf("service should be runnable before deletion")
 	}
-	r["name"] = 1
-	if r.Name() != "" {
-		t.Error("name should be empty")
+
+	deletedAt := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	retention := 72 * time.Hour
+
+	// delete -> restore
+	s.SoftDelete(deletedAt)
+	if !s.SoftDeleted() || s.Runnable() {
+		t.Errorf("soft-deleted service should not be runnable")
 	}
-	r["name"] = "obj1"
-	if r.Name() != "obj1" {
-		t.Error("name should be obj1")
+	if s.DeletionExpired(retention, deletedAt.Add(time.Hour)) {
+		t.Errorf("service should be kept in the retention")
+	}
+	s.Restore()
+	if s.SoftDeleted() || !s.Runnable() {
+		t.Errorf("restored service should be runnable")
+	}
+	if s.DeletionExpired(retention, deletedAt.Add(100*time.Hour)) {
+		t.Errorf("restored service should never be expired")
 	}
 
-	if r.Kind() != "" {
-		t.Error("kind should be empty")
+	// delete -> expire -> hard-delete
+	s.SoftDelete(deletedAt)
+	if s.DeletionExpired(retention, deletedAt.Add(retention-time.Second)) {
+		t.Errorf("service should not be expired before the retention")
 	}
-	r["kind"] = 1
-	if r.Kind() != "" {
-		t.Error("kind should be empty")
+	if !s.DeletionExpired(retention, deletedAt.Add(retention)) {
+		t.Errorf("service should be expired after the retention")
 	}
-	r["kind"] = "kind1"
-	if r.Kind() != "kind1" {
-		t.Error("kind should be kind1")
+
+	a := Admin{}
+	if a.ServiceRetentionDuration() != DefaultServiceRetention {
+		t.Errorf("want default retention %v, got %v", DefaultServiceRetention, a.ServiceRetentionDuration())
+	}
+	a.ServiceRetention = "24h"
+	if a.ServiceRetentionDuration() != 24*time.Hour {
+		t.Errorf("want retention 24h, got %v", a.ServiceRetentionDuration())
+	}
+}
+
+func TestSideCarPipelineSpecWithDeadlinePropagation(t *testing.T) {
+	order := &Service{
+		Name: "order",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+		DeadlinePropagation: &DeadlinePropagation{
+			Floor: "20ms",
+		},
+	}
+	payment := &Service{
+		Name:    "payment",
+		Sidecar: order.Sidecar,
+	}
+
+	superSpec, err := order.SideCarIngressPipelineSpec(8000)
+	if err != nil {
+		t.Fatalf("generate ingress pipeline failed: %v", err)
+	}
+	pipelineSpec := superSpec.ObjectSpec().(*httppipeline.Spec)
+	if pipelineSpec.Flow[0].Filter != "deadlineRecorder" {
+		t.Errorf("ingress pipeline should record the deadline first, got %v", pipelineSpec.Flow)
+	}
+	if !strings.Contains(superSpec.YAMLConfig(), "deadlineHeader: "+DefaultDeadlineHeader) {
+		t.Errorf("ingress pipeline should use the default deadline header:\n%s", superSpec.YAMLConfig())
+	}
+
+	instanceSpecs := []*ServiceInstanceSpec{{
+		ServiceName: "payment",
+		InstanceID:  "payment-1",
+		IP:          "192.168.0.110",
+		Port:        80,
+		Status:      ServiceStatusUp,
+	}}
+	superSpec, err = payment.SideCarEgressPipelineSpecForCaller(order, instanceSpecs, nil)
+	if err != nil {
+		t.Fatalf("generate egress pipeline failed: %v", err)
+	}
+	pipelineSpec = superSpec.ObjectSpec().(*httppipeline.Spec)
+	flowNames := []string{}
+	for _, flow := range pipelineSpec.Flow {
+		flowNames = append(flowNames, flow.Filter)
+	}
+	if !reflect.DeepEqual(flowNames[:2], []string{"deadlineApplier", "timeLimiter"}) {
+		t.Errorf("egress pipeline should apply and limit by the deadline, got %v", flowNames)
+	}
+	yamlConfig := superSpec.YAMLConfig()
+	if !strings.Contains(yamlConfig, "store: order-deadline") || !strings.Contains(yamlConfig, "deadlineFloor: 20ms") {
+		t.Errorf("egress pipeline should apply the deadline of the caller:\n%s", yamlConfig)
+	}
+
+	superSpec, err = payment.SideCarEgressPipelineSpec(instanceSpecs)
+	if err != nil {
+		t.Fatalf("generate egress pipeline failed: %v", err)
+	}
+	if strings.Contains(superSpec.YAMLConfig(), "deadline") {
+		t.Errorf("egress pipeline without caller should not propagate deadlines:\n%s", superSpec.YAMLConfig())
+	}
+}
+
+func TestSideCarIngressPipelineSpecWithFaultInjection(t *testing.T) {
+	s := &Service{
+		Name: "order",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+		FaultInjection: &FaultInjection{
+			Abort: &faultinjector.Abort{Percentage: 10, StatusCode: 503},
+			Delay: &faultinjector.Delay{Percentage: 20, Duration: "100ms", Jitter: "10ms",
+				Distribution: faultinjector.DistributionNormal},
+		},
+	}
+
+	superSpec, err := s.SideCarIngressPipelineSpec(8000)
+	if err != nil {
+		t.Fatalf("generate ingress pipeline failed: %v", err)
+	}
+	flowNames := []string{}
+	for _, flow := range superSpec.ObjectSpec().(*httppipeline.Spec).Flow {
+		flowNames = append(flowNames, flow.Filter)
+	}
+	if !reflect.DeepEqual(flowNames, []string{"faultInjector", "backend"}) {
+		t.Errorf("faults should be injected right before the proxy, got %v", flowNames)
+	}
+	if !strings.Contains(superSpec.YAMLConfig(), "statusCode: 503") {
+		t.Errorf("ingress pipeline should inject the abort:\n%s", superSpec.YAMLConfig())
+	}
+	if !strings.Contains(superSpec.YAMLConfig(), "jitter: 10ms") {
+		t.Errorf("ingress pipeline should inject the jittered delay:\n%s", superSpec.YAMLConfig())
+	}
+
+	s.FaultInjection.Abort.Percentage = 101
+	if _, err := s.SideCarIngressPipelineSpec(8000); err == nil {
+		t.Errorf("abort percentage over 100 should be invalid")
 	}
 }
@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"sort"
+)
+
+type (
+	// MeshSummary is the aggregated view of the tenants, services, instances
+	// and ingresses of the mesh.
+	MeshSummary struct {
+		Tenants   []*TenantSummary  `yaml:"tenants"`
+		Ingresses []*IngressSummary `yaml:"ingresses"`
+
+		Services int `yaml:"services"`
+		// MockServices are the services not runnable, they're mocked by
+		// the sidecars of the callers without instances.
+		MockServices    int `yaml:"mockServices"`
+		DeletedServices int `yaml:"deletedServices"`
+		Instances       int `yaml:"instances"`
+		UpInstances     int `yaml:"upInstances"`
+		// UnknownInstances are the instances of the services not found.
+		UnknownInstances int `yaml:"unknownInstances"`
+	}
+
+	// TenantSummary is the summary of a tenant, the services are the ones
+	// registered into it.
+	TenantSummary struct {
+		Name            string `yaml:"name"`
+		Services        int    `yaml:"services"`
+		MockServices    int    `yaml:"mockServices"`
+		DeletedServices int    `yaml:"deletedServices"`
+		Instances       int    `yaml:"instances"`
+		UpInstances     int    `yaml:"upInstances"`
+	}
+
+	// IngressSummary is the summary of an ingress.
+	IngressSummary struct {
+		Name  string `yaml:"name"`
+		Rules int    `yaml:"rules"`
+		Paths int    `yaml:"paths"`
+		TLS   bool   `yaml:"tls"`
+	}
+)
+
+// SummarizeMesh aggregates the counts of the mesh by tenant, the tenants not
+// found but registered by services are included too. The soft-deleted
+// services are counted as deleted only, and the mock ones as both services
+// and mocks. The tenants and ingresses are sorted by name.
+func SummarizeMesh(tenants []*Tenant, services []*Service,
+	instances []*ServiceInstanceSpec, ingresses []*Ingress) *MeshSummary {
+	summary := &MeshSummary{
+		Tenants:   []*TenantSummary{},
+		Ingresses: []*IngressSummary{},
+	}
+
+	tenantSummaries := make(map[string]*TenantSummary)
+	getTenant := func(name string) *TenantSummary {
+		ts := tenantSummaries[name]
+		if ts == nil {
+			ts = &TenantSummary{Name: name}
+			tenantSummaries[name] = ts
+			summary.Tenants = append(summary.Tenants, ts)
+		}
+		return ts
+	}
+	for _, t := range tenants {
+		getTenant(t.Name)
+	}
+
+	serviceTenants := make(map[string]*TenantSummary)
+	for _, s := range services {
+		ts := getTenant(s.RegisterTenant)
+		serviceTenants[s.Name] = ts
+
+		switch {
+		case s.SoftDeleted():
+			ts.DeletedServices++
+			summary.DeletedServices++
+		case !s.Runnable():
+			ts.Services++
+			ts.MockServices++
+			summary.Services++
+			summary.MockServices++
+		default:
+			ts.Services++
+			summary.Services++
+		}
+	}
+
+	for _, instance := range instances {
+		summary.Instances++
+		up := instance.Status == ServiceStatusUp
+		if up {
+			summary.UpInstances++
+		}
+
+		ts := serviceTenants[instance.ServiceName]
+		if ts == nil {
+			summary.UnknownInstances++
+			continue
+		}
+		ts.Instances++
+		if up {
+			ts.UpInstances++
+		}
+	}
+
+	for _, ingress := range ingresses {
+		is := &IngressSummary{
+			Name:  ingress.Name,
+			Rules: len(ingress.Rules),
+			TLS:   ingress.TLS != nil,
+		}
+		for _, rule := range ingress.Rules {
+			is.Paths += len(rule.Paths)
+		}
+		summary.Ingresses = append(summary.Ingresses, is)
+	}
+
+	sort.Slice(summary.Tenants, func(i, j int) bool {
+		return summary.Tenants[i].Name < summary.Tenants[j].Name
+	})
+	sort.Slice(summary.Ingresses, func(i, j int) bool {
+		return summary.Ingresses[i].Name < summary.Ingresses[j].Name
+	})
+
+	return summary
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSummarizeMesh(t *testing.T) {
+	tenants := []*Tenant{
+		{Name: "tenant-002", Services: []string{"stock"}},
+		{Name: "tenant-001", Services: []string{"order", "payment", "coupon"}},
+		{Name: "tenant-empty"},
+	}
+	services := []*Service{
+		{Name: "order", RegisterTenant: "tenant-001"},
+		{Name: "payment", RegisterTenant: "tenant-001", Mock: &Mock{Enabled: true}},
+		{Name: "coupon", RegisterTenant: "tenant-001", DeletedAt: "2021-01-01T00:00:00Z"},
+		{Name: "stock", RegisterTenant: "tenant-002"},
+		{Name: "user", RegisterTenant: "tenant-003"},
+	}
+	instances := []*ServiceInstanceSpec{
+		{ServiceName: "order", InstanceID: "order-1", Status: ServiceStatusUp},
+		{ServiceName: "order", InstanceID: "order-2", Status: ServiceStatusOutOfService},
+		{ServiceName: "stock", InstanceID: "stock-1", Status: ServiceStatusUp},
+		{ServiceName: "cart", InstanceID: "cart-1", Status: ServiceStatusUp},
+	}
+	ingresses := []*Ingress{
+		{Name: "ingress-002", TLS: &IngressTLS{}},
+		{Name: "ingress-001", Rules: []*IngressRule{
+			{Paths: []*IngressPath{{Path: "/order"}, {Path: "/stock"}}},
+			{Host: "*.example.com", Paths: []*IngressPath{{Path: "/"}}},
+		}},
+	}
+
+	want := &MeshSummary{
+		Tenants: []*TenantSummary{
+			{Name: "tenant-001", Services: 2, MockServices: 1, DeletedServices: 1, Instances: 2, UpInstances: 1},
+			{Name: "tenant-002", Services: 1, Instances: 1, UpInstances: 1},
+			{Name: "tenant-003", Services: 1},
+			{Name: "tenant-empty"},
+		},
+		Ingresses: []*IngressSummary{
+			{Name: "ingress-001", Rules: 2, Paths: 3},
+			{Name: "ingress-002", TLS: true},
+		},
+		Services:         4,
+		MockServices:     1,
+		DeletedServices:  1,
+		Instances:        4,
+		UpInstances:      3,
+		UnknownInstances: 1,
+	}
+
+	got := SummarizeMesh(tenants, services, instances, ingresses)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+
+	got = SummarizeMesh(nil, nil, nil, nil)
+	if len(got.Tenants) != 0 || len(got.Ingresses) != 0 || got.Services != 0 {
+		t.Errorf("want empty summary, got %+v", got)
+	}
+}
@@ -18,8 +18,14 @@
 package worker
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 
+	"github.com/megaease/easegress/pkg/api"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/registrycenter"
 	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
 )
 
@@ -29,6 +35,9 @@ const (
 
 	// meshNacosPrefix is the mesh nacos registry API url prefix.
 	meshNacosPrefix = "/nacos/v1"
+
+	// meshWatchInstancesPath is the API url to watch the instance events.
+	meshWatchInstancesPath = "/mesh/watch/instances"
 )
 
 func (worker *Worker) runAPIServer() {
@@ -43,6 +52,11 @@ func (worker *Worker) runAPIServer() {
 	default:
 		apis = worker.eurekaAPIs()
 	}
+	apis = append(apis, &apiEntry{
+		Path:    meshWatchInstancesPath,
+		Method:  "GET",
+		Handler: worker.watchInstances,
+	})
 	worker.apiServer.registerAPIs(apis)
 }
 
@@ -50,3 +64,47 @@ func (worker *Worker) emptyHandler(w http.ResponseWriter, r *http.Request) {
 	// EaseMesh does not need to implement some APIS like
 	// delete, heartbeat of Eureka/Consul/Nacos.
 }
+
+// deregisterHandler drains the instance, the application deregisters itself
+// from Eureka/Consul/Nacos when it's shutting down.
+func (worker *Worker) deregisterHandler(w http.ResponseWriter, r *http.Request) {
+	worker.registryServer.Drain()
+}
+
+// watchInstances streams the instance events, the query parameter revision
+// is the revision of the last event the client has seen, it's used to
+// resume the stream after reconnecting.
+func (worker *Worker) watchInstances(w http.ResponseWriter, r *http.Request) {
+	var revision int64
+	if s := r.URL.Query().Get("revision"); s != "" {
+		var err error
+		revision, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			api.HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid revision %s: %v", s, err))
+			return
+		}
+	}
+
+	started := false
+	err := worker.registryServer.WatchInstances(r.Context(), revision, func(events []*registrycenter.InstanceEvent) {
+		if !started {
+			w.Header().Set("Content-type", "application/octet-stream")
+			started = true
+		}
+		err := json.NewEncoder(w).Encode(events)
+		if err != nil {
+			logger.Errorf("marshal instance events failed: %v", err)
+		}
+		w.Write([]byte("\r\n"))
+		w.(http.Flusher).Flush()
+	})
+	if err == nil {
+		return
+	}
+
+	if started {
+		logger.Errorf("watch instance events failed: %v", err)
+		return
+	}
+	api.HandleAPIError(w, r, http.StatusInternalServerError, err)
+}
@@ -45,7 +45,7 @@ func (worker *Worker) consulAPIs() []*apiEntry {
 		{
 			Path:    "/v1/agent/service/deregister",
 			Method:  "DELETE",
-			Handler: worker.emptyHandler,
+			Handler: worker.deregisterHandler,
 		},
 		{
 			Path:    "/v1/health/service/{serviceName}",
@@ -93,7 +93,10 @@ func (worker *Worker) consulRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	worker.registryServer.Register(serviceSpec, worker.ingressServer.Ready, worker.egressServer.Ready)
+	err = worker.registryServer.Register(serviceSpec, worker.ingressServer.Ready, worker.egressServer.Ready)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusConflict, err)
+	}
 }
 
 func (worker *Worker) healthService(w http.ResponseWriter, r *http.Request) {
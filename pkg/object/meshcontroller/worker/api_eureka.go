@@ -66,7 +66,7 @@ func (worker *Worker) eurekaAPIs() []*apiEntry {
 		{
 			Path:    meshEurekaPrefix + "/apps/{serviceName}/{instanceID}",
 			Method:  "DELETE",
-			Handler: worker.emptyHandler,
+			Handler: worker.deregisterHandler,
 		},
 		{
 			Path:    meshEurekaPrefix + "/apps/{serviceName}/{instanceID}",
@@ -158,7 +158,11 @@ func (worker *Worker) eurekaRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	worker.registryServer.Register(serviceSpec, worker.ingressServer.Ready, worker.egressServer.Ready)
+	err = worker.registryServer.Register(serviceSpec, worker.ingressServer.Ready, worker.egressServer.Ready)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusConflict, err)
+		return
+	}
 
 	// NOTE: According to eureka APIs list:
 	// https://github.com/Netflix/eureka/wiki/Eureka-REST-operations
@@ -262,7 +266,7 @@ func (worker *Worker) getAppInstance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if serviceInfo.Service.Name == serviceName && instanceID == serviceInfo.Ins.InstanceID {
+	if serviceInfo.Ins.ServiceName == serviceName && instanceID == serviceInfo.Ins.InstanceID {
 		ins := worker.registryServer.ToEurekaInstanceInfo(serviceInfo)
 		accept := worker.detectedAccept(w.Header().Get("Accept"))
 
@@ -19,6 +19,7 @@ package worker
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -27,6 +28,7 @@ import (
 	"github.com/megaease/easegress/pkg/api"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/meshcontroller/registrycenter"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
 )
 
 func (worker *Worker) nacosAPIs() []*apiEntry {
@@ -44,7 +46,7 @@ func (worker *Worker) nacosAPIs() []*apiEntry {
 		{
 			Path:    meshNacosPrefix + "/ns/instance",
 			Method:  "DELETE",
-			Handler: worker.emptyHandler,
+			Handler: worker.deregisterHandler,
 		},
 		{
 			Path:    meshNacosPrefix + "/ns/instance/beat",
@@ -91,7 +93,10 @@ func (worker *Worker) nacosRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	worker.registryServer.Register(serviceSpec, worker.ingressServer.Ready, worker.egressServer.Ready)
+	err = worker.registryServer.Register(serviceSpec, worker.ingressServer.Ready, worker.egressServer.Ready)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusConflict, err)
+	}
 }
 
 func (worker *Worker) nacosInstanceList(w http.ResponseWriter, r *http.Request) {
@@ -101,10 +106,14 @@ func (worker *Worker) nacosInstanceList(w http.ResponseWriter, r *http.Request)
 			fmt.Errorf("empty serviceName in url parameters"))
 		return
 	}
-	serviceName, err := worker.registryServer.SplitNacosServiceName(serviceName)
+	serviceName, err := worker.nacosServiceName(r, serviceName)
 	if err != nil {
-		logger.Errorf("nacos invalid servicename: %s", serviceName)
-		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		logger.Errorf("nacos invalid servicename: %s: %v", serviceName, err)
+		if errors.Is(err, spec.ErrNacosScopeMismatch) {
+			api.HandleAPIError(w, r, http.StatusNotFound, err)
+		} else {
+			api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		}
 		return
 	}
 	var serviceInfo *registrycenter.ServiceRegistryInfo
@@ -135,10 +144,14 @@ func (worker *Worker) nacosInstance(w http.ResponseWriter, r *http.Request) {
 			fmt.Errorf("empty serviceName in url parameters"))
 		return
 	}
-	serviceName, err := worker.registryServer.SplitNacosServiceName(serviceName)
+	serviceName, err := worker.nacosServiceName(r, serviceName)
 	if err != nil {
-		logger.Errorf("nacos invalid servicename: %s", serviceName)
-		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		logger.Errorf("nacos invalid servicename: %s: %v", serviceName, err)
+		if errors.Is(err, spec.ErrNacosScopeMismatch) {
+			api.HandleAPIError(w, r, http.StatusNotFound, err)
+		} else {
+			api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		}
 		return
 	}
 	var serviceInfo *registrycenter.ServiceRegistryInfo
@@ -162,15 +175,28 @@ func (worker *Worker) nacosInstance(w http.ResponseWriter, r *http.Request) {
 	w.Write(buff)
 }
 
+// nacosServiceName checks the Nacos namespace and group of the request,
+// and returns the mesh service name.
+func (worker *Worker) nacosServiceName(r *http.Request, serviceName string) (string, error) {
+	if err := worker.registryServer.CheckNacosScope(r); err != nil {
+		return "", err
+	}
+	return worker.registryServer.SplitNacosServiceName(serviceName)
+}
+
 func (worker *Worker) nacosServiceList(w http.ResponseWriter, r *http.Request) {
 	var (
 		err          error
 		serviceInfos []*registrycenter.ServiceRegistryInfo
 	)
-	if serviceInfos, err = worker.registryServer.Discovery(); err != nil {
-		logger.Errorf("discovery services err: %v ", err)
-		api.HandleAPIError(w, r, http.StatusInternalServerError, err)
-		return
+
+	// NOTE: There is no mesh service in other namespaces or groups.
+	if err = worker.registryServer.CheckNacosScope(r); err == nil {
+		if serviceInfos, err = worker.registryServer.Discovery(); err != nil {
+			logger.Errorf("discovery services err: %v ", err)
+			api.HandleAPIError(w, r, http.StatusInternalServerError, err)
+			return
+		}
 	}
 	serviceList := worker.registryServer.ToNacosServiceList(serviceInfos)
 
@@ -192,10 +218,14 @@ func (worker *Worker) nacosService(w http.ResponseWriter, r *http.Request) {
 			fmt.Errorf("empty serviceName in url parameters"))
 		return
 	}
-	serviceName, err := worker.registryServer.SplitNacosServiceName(serviceName)
+	serviceName, err := worker.nacosServiceName(r, serviceName)
 	if err != nil {
-		logger.Errorf("nacos invalid servicename: %s", serviceName)
-		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		logger.Errorf("nacos invalid servicename: %s: %v", serviceName, err)
+		if errors.Is(err, spec.ErrNacosScopeMismatch) {
+			api.HandleAPIError(w, r, http.StatusNotFound, err)
+		} else {
+			api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		}
 		return
 	}
 
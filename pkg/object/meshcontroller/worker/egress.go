@@ -21,18 +21,20 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/megaease/easegress/pkg/filter/circuitbreaker"
+	"github.com/megaease/easegress/pkg/filter/proxy"
 	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
 	"github.com/megaease/easegress/pkg/object/httpserver"
 	"github.com/megaease/easegress/pkg/object/meshcontroller/informer"
 	"github.com/megaease/easegress/pkg/object/meshcontroller/service"
 	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
 	"github.com/megaease/easegress/pkg/object/trafficcontroller"
 	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/httpstat"
 	"gopkg.in/yaml.v2"
 )
 
-const egressRPCKey = "X-Mesh-Rpc-Service"
-
 type (
 	// EgressServer manages one/many ingress pipelines and one HTTPServer
 	EgressServer struct {
@@ -41,6 +43,10 @@ type (
 
 		pipelines  map[string]*supervisor.ObjectEntity
 		httpServer *supervisor.ObjectEntity
+		// specs are the service specs the pipelines are generated from.
+		specs map[string]*spec.Service
+		// unmatchedPipeline responds the requests matching no target service.
+		unmatchedPipeline *supervisor.ObjectEntity
 
 		tc        *trafficcontroller.TrafficController
 		namespace string
@@ -117,6 +123,16 @@ func (egs *EgressServer) InitEgress(service *spec.Service) error {
 		return err
 	}
 
+	unmatchedSpec, err := service.SideCarEgressUnmatchedPipelineSpec()
+	if err != nil {
+		return err
+	}
+	unmatchedPipeline, err := egs.tc.CreateHTTPPipelineForSpec(egs.namespace, unmatchedSpec)
+	if err != nil {
+		return fmt.Errorf("create http pipeline %s failed: %v", unmatchedSpec.Name(), err)
+	}
+	egs.unmatchedPipeline = unmatchedPipeline
+
 	entity, err := egs.tc.CreateHTTPServerForSpec(egs.namespace, superSpec)
 	if err != nil {
 		return fmt.Errorf("create http server %s failed: %v", superSpec.Name(), err)
@@ -131,6 +147,22 @@ func (egs *EgressServer) InitEgress(service *spec.Service) error {
 		}
 	}
 
+	if err := egs.inf.OnAllTenantSpecs(egs.reloadByTenants); err != nil {
+		// only return err when its type is not `AlreadyWatched`
+		if err != informer.ErrAlreadyWatched {
+			logger.Errorf("add egress tenant watching service: %s failed: %v", service.Name, err)
+			return err
+		}
+	}
+
+	if err := egs.inf.OnServiceCert(service.Name, egs.reloadByCert); err != nil {
+		// only return err when its type is not `AlreadyWatched`
+		if err != informer.ErrAlreadyWatched {
+			logger.Errorf("add egress cert watching service: %s failed: %v", service.Name, err)
+			return err
+		}
+	}
+
 	if err := egs.inf.OnAllServiceInstanceSpecs(egs.reloadByInstances); err != nil {
 		// only return err when its type is not `AlreadyWatched`
 		if err != informer.ErrAlreadyWatched {
@@ -141,6 +173,72 @@ func (egs *EgressServer) InitEgress(service *spec.Service) error {
 	return nil
 }
 
+// CircuitBreakerStates returns the states of circuit breakers in egress
+// pipelines, keyed by the service name and the URL rule ID.
+func (egs *EgressServer) CircuitBreakerStates() map[string]string {
+	egs.mutex.RLock()
+	defer egs.mutex.RUnlock()
+
+	states := make(map[string]string)
+	for serviceName, entity := range egs.pipelines {
+		pipelineStatus, ok := entity.Instance().Status().ObjectStatus.(*httppipeline.Status)
+		if !ok {
+			continue
+		}
+		for _, filterStatus := range pipelineStatus.Filters {
+			cbStatus, ok := filterStatus.(*circuitbreaker.Status)
+			if !ok {
+				continue
+			}
+			for id, state := range cbStatus.States {
+				states[serviceName+" "+id] = state
+			}
+		}
+	}
+
+	return states
+}
+
+// CanaryPoolCounters returns the selection counters of the proxies with
+// candidate pools in egress pipelines.
+func (egs *EgressServer) CanaryPoolCounters() []*canaryPoolCounter {
+	egs.mutex.RLock()
+	defer egs.mutex.RUnlock()
+
+	counters := []*canaryPoolCounter{}
+	for serviceName, entity := range egs.pipelines {
+		pipelineStatus, ok := entity.Instance().Status().ObjectStatus.(*httppipeline.Status)
+		if !ok {
+			continue
+		}
+		for _, filterStatus := range pipelineStatus.Filters {
+			proxyStatus, ok := filterStatus.(*proxy.Status)
+			if !ok || len(proxyStatus.CandidatePools) == 0 {
+				continue
+			}
+			counters = append(counters, newCanaryPoolCounters(serviceName, proxyStatus)...)
+		}
+	}
+
+	return counters
+}
+
+// TrafficStatus returns the traffic statistics of the HTTPServer, nil
+// means it's not created yet.
+func (egs *EgressServer) TrafficStatus() *httpstat.Status {
+	egs.mutex.RLock()
+	defer egs.mutex.RUnlock()
+
+	if egs.httpServer == nil {
+		return nil
+	}
+	status, ok := egs.httpServer.Instance().Status().ObjectStatus.(*httpserver.Status)
+	if !ok {
+		return nil
+	}
+	return status.Status
+}
+
 // Ready checks Egress HTTPServer has been created or not.
 // Not need to check pipelines, cause they will be dynamically added.
 func (egs *EgressServer) Ready() bool {
@@ -161,6 +259,28 @@ func (egs *EgressServer) reloadByInstances(value map[string]*spec.ServiceInstanc
 	return egs.reloadHTTPServer(specs)
 }
 
+// reloadByCert regenerates the pipelines with the rotated certificate.
+func (egs *EgressServer) reloadByCert(event informer.Event, cert *spec.Certificate) bool {
+	return egs.reloadCurrentSpecs()
+}
+
+// reloadByTenants regenerates the pipelines with the default resilience
+// of the tenants.
+func (egs *EgressServer) reloadByTenants(value map[string]*spec.Tenant) bool {
+	return egs.reloadCurrentSpecs()
+}
+
+func (egs *EgressServer) reloadCurrentSpecs() bool {
+	egs.mutex.RLock()
+	specs := egs.specs
+	egs.mutex.RUnlock()
+
+	if specs == nil {
+		return true
+	}
+	return egs.reloadHTTPServer(specs)
+}
+
 func (egs *EgressServer) reloadBySpecs(value map[string]*spec.Service) bool {
 	return egs.reloadHTTPServer(value)
 }
@@ -169,14 +289,42 @@ func (egs *EgressServer) reloadHTTPServer(specs map[string]*spec.Service) bool {
 	egs.mutex.Lock()
 	defer egs.mutex.Unlock()
 
+	selfSpec := egs.service.GetServiceSpec(egs.serviceName)
+	if selfSpec == nil {
+		selfSpec = &spec.Service{Name: egs.serviceName}
+	}
+
+	certs := egs.service.GetMTLSCerts(egs.serviceName)
+	tenants := make(map[string]*spec.Tenant)
 	pipelines := make(map[string]*supervisor.ObjectEntity)
 	serverName2PipelineName := make(map[string]string)
 
 	for _, v := range specs {
+		if v.SoftDeleted() {
+			continue
+		}
+
+		tenant, exists := tenants[v.RegisterTenant]
+		if !exists {
+			tenant = egs.service.GetTenantSpec(v.RegisterTenant)
+			tenants[v.RegisterTenant] = tenant
+		}
+
 		instances := egs.service.ListServiceInstanceSpecs(v.Name)
-		pipelineSpec, err := v.SideCarEgressPipelineSpec(instances)
+		var fallback *spec.Service
+		var fallbackInstances []*spec.ServiceInstanceSpec
+		if v.Fallback != nil && v.Fallback.Service != "" {
+			fallback = specs[v.Fallback.Service]
+			if fallback != nil && !fallback.SoftDeleted() {
+				fallbackInstances = egs.service.ListServiceInstanceSpecs(fallback.Name)
+			}
+		}
+		pipelineSpec, err := v.WithTenantDefaults(tenant).SideCarEgressPipelineSpecWithFallback(selfSpec, instances,
+			fallback, fallbackInstances, certs)
 		if err != nil {
-			logger.Errorf("BUG: gen sidecar egress httpserver spec failed: %v", err)
+			// NOTE: Requests to the service fail closed, because there's
+			// no pipeline for them, e.g. the mTLS settings mismatch.
+			logger.Errorf("generate egress pipeline spec of service %s failed: %v", v.Name, err)
 			continue
 		}
 		entity, err := egs.tc.CreateHTTPPipelineForSpec(egs.namespace, pipelineSpec)
@@ -188,31 +336,23 @@ func (egs *EgressServer) reloadHTTPServer(specs map[string]*spec.Service) bool {
 		serverName2PipelineName[v.Name] = pipelineSpec.Name()
 	}
 
-	httpServerSpec := egs.httpServer.Spec().ObjectSpec().(*httpserver.Spec)
-	httpServerSpec.Rules = nil
-
-	for k := range pipelines {
-		rule := &httpserver.Rule{
-			Paths: []*httpserver.Path{
-				{
-					PathPrefix: "/",
-					Headers: []*httpserver.Header{
-						{
-							Key: egressRPCKey,
-							// Value should be the service name
-							Values:  []string{k},
-							Backend: serverName2PipelineName[k],
-						},
-					},
-					// this name should be the pipeline full name
-					Backend: serverName2PipelineName[k],
-				},
-			},
-		}
-
-		httpServerSpec.Rules = append(httpServerSpec.Rules, rule)
+	// NOTE: The aliases route to the pipelines of the canonical services,
+	// they never shadow the canonical names.
+	for _, v := range specs {
+		pipelineName, exists := serverName2PipelineName[v.Name]
+		if !exists {
+			continue
+		}
+		for _, alias := range v.Aliases {
+			if _, exists := serverName2PipelineName[alias]; !exists {
+				serverName2PipelineName[alias] = pipelineName
+			}
+		}
 	}
 
+	httpServerSpec := egs.httpServer.Spec().ObjectSpec().(*httpserver.Spec)
+	httpServerSpec.Rules = selfSpec.SideCarEgressHTTPServerRules(serverName2PipelineName)
+
 	builder := newHTTPServerSpecBuilder(egs.egressServerName, httpServerSpec)
 	superSpec, err := supervisor.NewSpec(builder.yamlConfig())
 	if err != nil {
@@ -226,6 +366,7 @@ func (egs *EgressServer) reloadHTTPServer(specs map[string]*spec.Service) bool {
 	}
 
 	// update local storage
+	egs.specs = specs
 	egs.pipelines = pipelines
 	egs.httpServer = entity
 
@@ -242,5 +383,6 @@ func (egs *EgressServer) Close() {
 		for _, entity := range egs.pipelines {
 			egs.tc.DeleteHTTPPipeline(egs.namespace, entity.Spec().Name())
 		}
+		egs.tc.DeleteHTTPPipeline(egs.namespace, egs.unmatchedPipeline.Spec().Name())
 	}
 }
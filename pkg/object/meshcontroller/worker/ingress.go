@@ -22,10 +22,13 @@ import (
 	"sync"
 
 	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httpserver"
 	"github.com/megaease/easegress/pkg/object/meshcontroller/informer"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/service"
 	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
 	"github.com/megaease/easegress/pkg/object/trafficcontroller"
 	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/httpstat"
 )
 
 // ErrIngressClosed is the error when operating in a closed Ingress server
@@ -43,6 +46,7 @@ type (
 		applicationPort uint32
 		namespace       string
 		inf             informer.Informer
+		service         *service.Service
 
 		pipelines  map[string]*supervisor.ObjectEntity
 		httpServer *supervisor.ObjectEntity
@@ -50,7 +54,9 @@ type (
 )
 
 // NewIngressServer creates an initialized ingress server
-func NewIngressServer(superSpec *supervisor.Spec, super *supervisor.Supervisor, serviceName string, inf informer.Informer) *IngressServer {
+func NewIngressServer(superSpec *supervisor.Spec, super *supervisor.Supervisor,
+	serviceName string, service *service.Service, inf informer.Informer) *IngressServer {
+
 	entity, exists := super.GetSystemController(trafficcontroller.Kind)
 	if !exists {
 		panic(fmt.Errorf("BUG: traffic controller not found"))
@@ -70,11 +76,28 @@ func NewIngressServer(superSpec *supervisor.Spec, super *supervisor.Supervisor,
 		pipelines:   make(map[string]*supervisor.ObjectEntity),
 		httpServer:  nil,
 		serviceName: serviceName,
+		service:     service,
 		inf:         inf,
 		mutex:       sync.RWMutex{},
 	}
 }
 
+// TrafficStatus returns the traffic statistics of the HTTPServer, nil
+// means it's not created yet.
+func (ings *IngressServer) TrafficStatus() *httpstat.Status {
+	ings.mutex.RLock()
+	defer ings.mutex.RUnlock()
+
+	if ings.httpServer == nil {
+		return nil
+	}
+	status, ok := ings.httpServer.Instance().Status().ObjectStatus.(*httpserver.Status)
+	if !ok {
+		return nil
+	}
+	return status.Status
+}
+
 // Ready checks ingress's pipeline and HTTPServer are created or not
 func (ings *IngressServer) Ready() bool {
 	ings.mutex.RLock()
@@ -97,7 +120,8 @@ func (ings *IngressServer) InitIngress(service *spec.Service, port uint32) error
 	ings.applicationPort = port
 
 	if _, ok := ings.pipelines[service.IngressPipelineName()]; !ok {
-		superSpec, err := service.SideCarIngressPipelineSpec(port)
+		tenant := ings.service.GetTenantSpec(service.RegisterTenant)
+		superSpec, err := service.WithTenantDefaults(tenant).SideCarIngressPipelineSpec(port)
 		if err != nil {
 			return err
 		}
@@ -109,7 +133,9 @@ func (ings *IngressServer) InitIngress(service *spec.Service, port uint32) error
 	}
 
 	if ings.httpServer == nil {
-		superSpec, err := service.SideCarIngressHTTPServerSpec()
+		// NOTE: The server is not created until the certificates are
+		// issued if mTLS is enabled, it will be retried in heartbeat.
+		superSpec, err := service.SideCarIngressHTTPServerSpec(ings.service.GetMTLSCerts(service.Name))
 		if err != nil {
 			return err
 		}
@@ -129,9 +155,71 @@ func (ings *IngressServer) InitIngress(service *spec.Service, port uint32) error
 		}
 	}
 
+	if err := ings.inf.OnPartOfTenantSpec(service.RegisterTenant, informer.AllParts, ings.reloadTenant); err != nil {
+		if err != informer.ErrAlreadyWatched {
+			logger.Errorf("add ingress tenant watching service: %s failed: %v", service.Name, err)
+			return err
+		}
+	}
+
+	if err := ings.inf.OnServiceCert(service.Name, ings.reloadCert); err != nil {
+		if err != informer.ErrAlreadyWatched {
+			logger.Errorf("add ingress cert watching service: %s failed: %v", service.Name, err)
+			return err
+		}
+	}
+
 	return nil
 }
 
+// reloadTenant reloads the pipeline with the default resilience of the tenant.
+func (ings *IngressServer) reloadTenant(event informer.Event, tenant *spec.Tenant) bool {
+	serviceSpec := ings.service.GetServiceSpec(ings.serviceName)
+	if serviceSpec == nil {
+		return true
+	}
+
+	return ings.reloadTraffic(event, serviceSpec)
+}
+
+// reloadCert reloads the HTTP server after the certificate of the service
+// is rotated, the HTTP server picks up the new certificate without restart.
+func (ings *IngressServer) reloadCert(event informer.Event, cert *spec.Certificate) bool {
+	serviceSpec := ings.service.GetServiceSpec(ings.serviceName)
+	if serviceSpec == nil {
+		return true
+	}
+
+	ings.mutex.Lock()
+	defer ings.mutex.Unlock()
+
+	ings.reloadHTTPServer(serviceSpec)
+	return true
+}
+
+// reloadHTTPServer updates the HTTP server for the changes of mTLS,
+// the caller must hold the lock.
+func (ings *IngressServer) reloadHTTPServer(serviceSpec *spec.Service) {
+	if ings.httpServer == nil {
+		return
+	}
+
+	superSpec, err := serviceSpec.SideCarIngressHTTPServerSpec(ings.service.GetMTLSCerts(serviceSpec.Name))
+	if err != nil {
+		logger.Errorf("generate ingress http server spec of service %s failed, keep the current one: %v",
+			serviceSpec.Name, err)
+		return
+	}
+
+	entity, err := ings.tc.UpdateHTTPServerForSpec(ings.namespace, superSpec)
+	if err != nil {
+		logger.Errorf("update http server %s failed: %v", superSpec.Name(), err)
+		return
+	}
+
+	ings.httpServer = entity
+}
+
 func (ings *IngressServer) reloadTraffic(event informer.Event, serviceSpec *spec.Service) bool {
 	ings.mutex.Lock()
 	defer ings.mutex.Unlock()
@@ -141,10 +229,11 @@ func (ings *IngressServer) reloadTraffic(event informer.Event, serviceSpec *spec
 		return false
 	}
 
-	superSpec, err := serviceSpec.SideCarIngressPipelineSpec(ings.applicationPort)
+	tenant := ings.service.GetTenantSpec(serviceSpec.RegisterTenant)
+	superSpec, err := serviceSpec.WithTenantDefaults(tenant).SideCarIngressPipelineSpec(ings.applicationPort)
 	if err != nil {
-		logger.Errorf("BUG: update ingress pipeline spec: %s new super spec failed: %v",
-			superSpec.YAMLConfig(), err)
+		logger.Errorf("generate ingress pipeline spec of service %s failed, keep the current one: %v",
+			serviceSpec.Name, err)
 		return true
 	}
 
@@ -154,6 +243,7 @@ func (ings *IngressServer) reloadTraffic(event informer.Event, serviceSpec *spec
 	}
 
 	ings.pipelines[ings.serviceName] = entity
+	ings.reloadHTTPServer(serviceSpec)
 	return true
 }
 
@@ -47,9 +47,12 @@ func NewObservabilityServer(serviceName string) *ObservabilityManager {
 	}
 }
 
-// UpdateService updates service.
+// UpdateService updates service, the tracings and metrics are switched on
+// or off independently for the agent.
 func (server *ObservabilityManager) UpdateService(newService *spec.Service, version int64) error {
-	err := server.agentClient.UpdateService(newService, version)
+	agentService := *newService
+	agentService.Observability = newService.Observability.AgentObservability()
+	err := server.agentClient.UpdateService(&agentService, version)
 	if err != nil {
 		return fmt.Errorf("Update Service Spec failed: %v ", err)
 	}
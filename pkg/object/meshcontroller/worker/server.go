@@ -20,8 +20,10 @@ package worker
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"runtime/debug"
+	"strconv"
 	"sync"
 	"time"
 
@@ -62,7 +64,7 @@ type (
 // newAPIServer creates an initialed API server.
 func newAPIServer(port int) *apiServer {
 	r := chi.NewRouter()
-	addr := fmt.Sprintf("%s:%d", defaultServerIP, port)
+	addr := net.JoinHostPort(defaultServerIP, strconv.Itoa(port))
 
 	s := &apiServer{
 		srv:    http.Server{Addr: addr, Handler: r},
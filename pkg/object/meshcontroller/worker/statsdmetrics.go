@@ -0,0 +1,227 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"strings"
+
+	"github.com/megaease/easegress/pkg/filter/proxy"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
+	"github.com/megaease/easegress/pkg/util/httpstat"
+	"github.com/megaease/easegress/pkg/util/statsd"
+)
+
+const (
+	canaryPoolSelectionsMetric = "mesh.canary.pool.selections"
+	canaryPoolUnmatchedMetric  = "mesh.canary.pool.unmatched"
+
+	sidecarRequestsMetric    = "mesh.sidecar.requests"
+	sidecarErrorsMetric      = "mesh.sidecar.errors"
+	sidecarLatencyMeanMetric = "mesh.sidecar.latency.mean"
+	sidecarLatencyP99Metric  = "mesh.sidecar.latency.p99"
+
+	ingressServerName = "ingress"
+	egressServerName  = "egress"
+
+	mainPoolName = "main"
+)
+
+type (
+	// canaryPoolCounter is the selection counter of one pool in the proxy
+	// to the target service, the unmatched one counts the requests routed
+	// to the main pool for matching no candidate pool.
+	canaryPoolCounter struct {
+		target    string
+		pool      string
+		rule      string
+		unmatched bool
+		count     uint64
+	}
+
+	// trafficStat is the traffic statistics of the ingress or egress
+	// HTTPServer of the sidecar.
+	trafficStat struct {
+		server string
+		status *httpstat.Status
+	}
+
+	// statsdMetrics reports the traffic of the sidecar and the canary pool
+	// counters to the StatsD output of the service metrics.
+	statsdMetrics struct {
+		serviceName string
+
+		client  *statsd.Client
+		address string
+		prefix  string
+		format  string
+
+		// last are the counts reported last time, keyed by the counter key.
+		last map[string]uint64
+	}
+)
+
+func newCanaryPoolCounters(target string, status *proxy.Status) []*canaryPoolCounter {
+	counters := []*canaryPoolCounter{}
+	if status.MainPool != nil {
+		counters = append(counters, &canaryPoolCounter{
+			target: target,
+			pool:   mainPoolName,
+			count:  status.MainPool.Selections,
+		})
+	}
+	for _, pool := range status.CandidatePools {
+		counters = append(counters, &canaryPoolCounter{
+			target: target,
+			pool:   pool.Name,
+			rule:   strings.TrimPrefix(pool.Name, spec.CanaryPoolNamePrefix),
+			count:  pool.Selections,
+		})
+	}
+	counters = append(counters, &canaryPoolCounter{
+		target:    target,
+		pool:      mainPoolName,
+		unmatched: true,
+		count:     status.Unmatched,
+	})
+
+	return counters
+}
+
+func (c *canaryPoolCounter) key() string {
+	if c.unmatched {
+		return c.target + " " + canaryPoolUnmatchedMetric
+	}
+	return c.target + " " + c.pool
+}
+
+func newStatsDMetrics(serviceName string) *statsdMetrics {
+	return &statsdMetrics{
+		serviceName: serviceName,
+		last:        make(map[string]uint64),
+	}
+}
+
+// report sends the traffic of the sidecar and the increments of counters
+// since the last report, it does nothing unless the metrics of the service
+// go to StatsD.
+func (cm *statsdMetrics) report(serviceSpec *spec.Service, traffic []*trafficStat, counters []*canaryPoolCounter) {
+	// NOTE: The metrics are reported even if the tracings are disabled.
+	if serviceSpec == nil || !serviceSpec.Observability.MetricsEnabled() {
+		cm.close()
+		return
+	}
+	metrics := serviceSpec.Observability.Metrics
+	if metrics.Output != spec.MetricsOutputStatsD || metrics.StatsD == nil {
+		cm.close()
+		return
+	}
+
+	address, prefix, format := metrics.StatsD.Address(), metrics.StatsD.Prefix, metrics.StatsD.TagFormat
+	if cm.client == nil || cm.address != address || cm.prefix != prefix || cm.format != format {
+		cm.close()
+		client, err := statsd.New(address, prefix, format)
+		if err != nil {
+			logger.Errorf("create statsd client for service metrics failed: %v", err)
+			return
+		}
+		cm.client, cm.address, cm.prefix, cm.format = client, address, prefix, format
+	}
+
+	last := make(map[string]uint64, len(counters)+2*len(traffic))
+	for _, t := range traffic {
+		cm.reportTraffic(t, last)
+	}
+	for _, c := range counters {
+		key := c.key()
+		last[key] = c.count
+		increment := cm.increment(key, c.count)
+		if increment == 0 {
+			continue
+		}
+
+		tags := map[string]string{
+			"service": cm.serviceName,
+			"target":  c.target,
+		}
+		name := canaryPoolUnmatchedMetric
+		if !c.unmatched {
+			name = canaryPoolSelectionsMetric
+			tags["pool"] = c.pool
+			if c.rule != "" {
+				tags["rule"] = c.rule
+			}
+		}
+		if err := cm.client.Count(name, int64(increment), tags); err != nil {
+			logger.Errorf("send canary metric %s failed: %v", name, err)
+		}
+	}
+	cm.last = last
+}
+
+func (cm *statsdMetrics) reportTraffic(t *trafficStat, last map[string]uint64) {
+	tags := map[string]string{
+		"service": cm.serviceName,
+		"server":  t.server,
+	}
+
+	for name, count := range map[string]uint64{
+		sidecarRequestsMetric: t.status.Count,
+		sidecarErrorsMetric:   t.status.ErrCount,
+	} {
+		key := t.server + " " + name
+		last[key] = count
+		increment := cm.increment(key, count)
+		if increment == 0 {
+			continue
+		}
+		if err := cm.client.Count(name, int64(increment), tags); err != nil {
+			logger.Errorf("send sidecar metric %s failed: %v", name, err)
+		}
+	}
+
+	// NOTE: The latencies are in milliseconds already.
+	for name, value := range map[string]float64{
+		sidecarLatencyMeanMetric: float64(t.status.Mean),
+		sidecarLatencyP99Metric:  t.status.P99,
+	} {
+		if err := cm.client.Gauge(name, value, tags); err != nil {
+			logger.Errorf("send sidecar metric %s failed: %v", name, err)
+		}
+	}
+}
+
+// increment returns the increment of the count since the last report.
+func (cm *statsdMetrics) increment(key string, count uint64) uint64 {
+	// NOTE: The counts restart from zero after the servers or pipelines
+	// are reloaded.
+	if prev, exists := cm.last[key]; exists && prev <= count {
+		return count - prev
+	}
+	return count
+}
+
+func (cm *statsdMetrics) close() {
+	if cm.client == nil {
+		return
+	}
+
+	cm.client.Close()
+	cm.client = nil
+	cm.last = make(map[string]uint64)
+}
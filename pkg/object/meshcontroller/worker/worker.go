@@ -65,6 +65,7 @@ type (
 		egressServer         *EgressServer
 		observabilityManager *ObservabilityManager
 		apiServer            *apiServer
+		statsdMetrics        *statsdMetrics
 
 		done chan struct{}
 	}
@@ -120,7 +121,7 @@ func New(superSpec *supervisor.Spec) *Worker {
 		superSpec.Name(), serviceName, applicationIP, applicationPort, instanceID, serviceLabels, _service)
 
 	inf := informer.NewInformer(store, serviceName)
-	ingressServer := NewIngressServer(superSpec, super, serviceName, inf)
+	ingressServer := NewIngressServer(superSpec, super, serviceName, _service, inf)
 	egressServer := NewEgressServer(superSpec, super, serviceName, _service, inf)
 
 	observabilityManager := NewObservabilityServer(serviceName)
@@ -147,6 +148,7 @@ func New(superSpec *supervisor.Spec) *Worker {
 		egressServer:         egressServer,
 		observabilityManager: observabilityManager,
 		apiServer:            apiServer,
+		statsdMetrics:        newStatsDMetrics(serviceName),
 
 		done: make(chan struct{}),
 	}
@@ -222,7 +224,10 @@ func (worker *Worker) run() {
 			logger.Errorf("init traffic gate failed: %v", err)
 		}
 
-		worker.registryServer.Register(serviceSpec, worker.ingressServer.Ready, worker.egressServer.Ready)
+		err = worker.registryServer.Register(serviceSpec, worker.ingressServer.Ready, worker.egressServer.Ready)
+		if err != nil {
+			logger.Errorf("register service %s failed: %v", serviceSpec.Name, err)
+		}
 
 		err = worker.observabilityManager.UpdateService(serviceSpec, info.Version)
 		if err != nil {
@@ -275,11 +280,15 @@ func (worker *Worker) heartbeat() {
 				logger.Errorf("update heartbeat failed: %v", err)
 			}
 		}
+
+		worker.statsdMetrics.report(worker.service.GetServiceSpec(worker.serviceName),
+			worker.trafficStats(), worker.egressServer.CanaryPoolCounters())
 	}
 
 	for {
 		select {
 		case <-worker.done:
+			worker.statsdMetrics.close()
 			return
 		case <-time.After(worker.heartbeatInterval):
 			routine()
@@ -287,6 +296,17 @@ func (worker *Worker) heartbeat() {
 	}
 }
 
+func (worker *Worker) trafficStats() []*trafficStat {
+	stats := []*trafficStat{}
+	if status := worker.ingressServer.TrafficStatus(); status != nil {
+		stats = append(stats, &trafficStat{server: ingressServerName, status: status})
+	}
+	if status := worker.egressServer.TrafficStatus(); status != nil {
+		stats = append(stats, &trafficStat{server: egressServerName, status: status})
+	}
+	return stats
+}
+
 func (worker *Worker) pushSpecToJavaAgent() {
 	routine := func() {
 		defer func() {
@@ -372,6 +392,7 @@ func (worker *Worker) updateHeartbeat() error {
 	}
 
 	status.LastHeartbeatTime = time.Now().Format(time.RFC3339)
+	status.CircuitBreakers = worker.egressServer.CircuitBreakerStates()
 	buff, err := yaml.Marshal(status)
 	if err != nil {
 		logger.Errorf("BUG: marshal %#v to yaml failed: %v", status, err)
@@ -412,6 +433,7 @@ func (worker *Worker) Status() *supervisor.Status {
 
 // Close closes the worker
 func (worker *Worker) Close() {
+	worker.registryServer.Drain()
 	close(worker.done)
 
 	// close informer firstly.
@@ -19,7 +19,9 @@ package serviceregistry
 
 import (
 	"fmt"
+	"net"
 	"reflect"
+	"strconv"
 )
 
 type (
@@ -43,9 +45,22 @@ type (
 		Tags []string `yaml:"tags"`
 		// Weight is optional.
 		Weight int `yaml:"weight"`
+		// Labels is optional.
+		Labels map[string]string `yaml:"labels"`
+		// Status is optional, empty means the registry doesn't report health.
+		Status string `yaml:"status"`
 	}
 )
 
+const (
+	// StatusUp means the instance is healthy and serves traffic.
+	StatusUp = "UP"
+	// StatusDraining means the instance still works but should not take new traffic.
+	StatusDraining = "DRAINING"
+	// StatusOutOfService means the instance is unhealthy.
+	StatusOutOfService = "OUT_OF_SERVICE"
+)
+
 // DeepCopy deep copies ServiceInstanceSpec.
 func (s *ServiceInstanceSpec) DeepCopy() *ServiceInstanceSpec {
 	copy := *s
@@ -56,6 +71,13 @@ func (s *ServiceInstanceSpec) DeepCopy() *ServiceInstanceSpec {
 		}
 	}
 
+	if s.Labels != nil {
+		copy.Labels = make(map[string]string, len(s.Labels))
+		for k, v := range s.Labels {
+			copy.Labels[k] = v
+		}
+	}
+
 	return &copy
 }
 
@@ -102,7 +124,7 @@ func (s *ServiceInstanceSpec) URL() string {
 		scheme = "http"
 	}
 
-	return fmt.Sprintf("%s://%s:%d", scheme, s.Address, s.Port)
+	return scheme + "://" + net.JoinHostPort(s.Address, strconv.Itoa(int(s.Port)))
 }
 
 // NewRegistryEventFromDiff creates a registry event from diff old and new specs.
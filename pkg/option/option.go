@@ -62,6 +62,8 @@ type Options struct {
 	ClusterAdvertiseClientURLs      []string          `yaml:"cluster-advertise-client-urls"`
 	ClusterInitialAdvertisePeerURLs []string          `yaml:"cluster-initial-advertise-peer-urls"`
 	ClusterJoinURLs                 []string          `yaml:"cluster-join-urls"`
+	ClusterReadyQuorum              int               `yaml:"cluster-ready-quorum"`
+	ClusterMaxKnownMembers          int               `yaml:"cluster-max-known-members"`
 	APIAddr                         string            `yaml:"api-addr"`
 	Debug                           bool              `yaml:"debug"`
 	InitialObjectConfigFiles        []string          `yaml:"initial-object-config-files"`
@@ -108,6 +110,8 @@ func New() *Options {
 	opt.flags.StringSliceVar(&opt.ClusterAdvertiseClientURLs, "cluster-advertise-client-urls", []string{"http://localhost:2379"}, "List of this member’s client URLs to advertise to the rest of the cluster.")
 	opt.flags.StringSliceVar(&opt.ClusterInitialAdvertisePeerURLs, "cluster-initial-advertise-peer-urls", []string{"http://localhost:2380"}, "List of this member’s peer URLs to advertise to the rest of the cluster.")
 	opt.flags.StringSliceVar(&opt.ClusterJoinURLs, "cluster-join-urls", nil, "List of URLs to join, when the first url is the same with any one of cluster-initial-advertise-peer-urls, it means to join itself, and this config will be treated empty.")
+	opt.flags.IntVar(&opt.ClusterReadyQuorum, "cluster-ready-quorum", 0, "Minimum number of live writers for this member to report ready, 0 means the majority of the etcd cluster members.")
+	opt.flags.IntVar(&opt.ClusterMaxKnownMembers, "cluster-max-known-members", 256, "Max number of the known members kept, the members out of the cluster member list seen longest ago are evicted first.")
 	opt.flags.StringVar(&opt.APIAddr, "api-addr", "localhost:2381", "Address([host]:port) to listen on for administration traffic.")
 	opt.flags.BoolVar(&opt.Debug, "debug", false, "Flag to set lowest log level from INFO downgrade DEBUG.")
 	opt.flags.StringSliceVar(&opt.InitialObjectConfigFiles, "initial-object-config-files", nil, "List of configuration files for initial objects, these objects will be created at startup if not already exist.")
@@ -299,6 +303,14 @@ func (opt *Options) validate() error {
 		return fmt.Errorf("invalid cluster-role(support writer, reader)")
 	}
 
+	if opt.ClusterReadyQuorum < 0 {
+		return fmt.Errorf("invalid cluster-ready-quorum: %d", opt.ClusterReadyQuorum)
+	}
+
+	if opt.ClusterMaxKnownMembers <= 0 {
+		return fmt.Errorf("invalid cluster-max-known-members: %d", opt.ClusterMaxKnownMembers)
+	}
+
 	_, err := time.ParseDuration(opt.ClusterRequestTimeout)
 	if err != nil {
 		return fmt.Errorf("invalid cluster-request-timeout: %v", err)
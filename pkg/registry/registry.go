@@ -20,11 +20,15 @@ package registry
 import (
 
 	// Filters
+	_ "github.com/megaease/easegress/pkg/filter/accesslogger"
 	_ "github.com/megaease/easegress/pkg/filter/apiaggregator"
+	_ "github.com/megaease/easegress/pkg/filter/bodylimiter"
 	_ "github.com/megaease/easegress/pkg/filter/bridge"
 	_ "github.com/megaease/easegress/pkg/filter/circuitbreaker"
 	_ "github.com/megaease/easegress/pkg/filter/corsadaptor"
 	_ "github.com/megaease/easegress/pkg/filter/fallback"
+	_ "github.com/megaease/easegress/pkg/filter/faultinjector"
+	_ "github.com/megaease/easegress/pkg/filter/headerpropagator"
 	_ "github.com/megaease/easegress/pkg/filter/mock"
 	_ "github.com/megaease/easegress/pkg/filter/proxy"
 	_ "github.com/megaease/easegress/pkg/filter/ratelimiter"
@@ -33,6 +37,7 @@ import (
 	_ "github.com/megaease/easegress/pkg/filter/responseadaptor"
 	_ "github.com/megaease/easegress/pkg/filter/retryer"
 	_ "github.com/megaease/easegress/pkg/filter/timelimiter"
+	_ "github.com/megaease/easegress/pkg/filter/tracepropagator"
 	_ "github.com/megaease/easegress/pkg/filter/validator"
 	_ "github.com/megaease/easegress/pkg/filter/wasmhost"
 
@@ -0,0 +1,351 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package propagation extracts and injects trace contexts in the headers
+// of the supported formats, so the tracing systems using different formats
+// could join the same trace.
+package propagation
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// FormatB3 is the B3 format of Zipkin, both the multiple headers and
+	// the single b3 header are extracted, the multiple headers are injected.
+	FormatB3 = "b3"
+	// FormatTraceContext is the W3C Trace Context format.
+	FormatTraceContext = "tracecontext"
+	// FormatJaeger is the uber-trace-id format of Jaeger.
+	FormatJaeger = "jaeger"
+)
+
+const (
+	// SamplingUnknown means the sampling decision is deferred.
+	SamplingUnknown SamplingState = iota
+	// SamplingAccept means the trace is sampled.
+	SamplingAccept
+	// SamplingDeny means the trace is not sampled.
+	SamplingDeny
+	// SamplingDebug means the trace is sampled and in debug mode.
+	SamplingDebug
+)
+
+const (
+	headerB3TraceID      = "X-B3-Traceid"
+	headerB3SpanID       = "X-B3-Spanid"
+	headerB3ParentSpanID = "X-B3-Parentspanid"
+	headerB3Sampled      = "X-B3-Sampled"
+	headerB3Flags        = "X-B3-Flags"
+	headerB3Single       = "B3"
+
+	headerTraceParent = "Traceparent"
+	headerTraceState  = "Tracestate"
+
+	headerJaeger = "Uber-Trace-Id"
+)
+
+// Formats are all supported formats.
+var Formats = []string{FormatB3, FormatTraceContext, FormatJaeger}
+
+type (
+	// SamplingState is the sampling decision of the trace.
+	SamplingState int
+
+	// SpanContext is the trace context propagated across the services.
+	// The IDs are lowercase hex, the trace ID is 16 or 32 characters,
+	// the span IDs are 16 characters.
+	SpanContext struct {
+		TraceID      string
+		SpanID       string
+		ParentSpanID string
+		Sampling     SamplingState
+	}
+)
+
+// Valid reports whether the format is supported.
+func Valid(format string) bool {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// Extract extracts the span context in the format from the headers.
+func Extract(format string, h http.Header) (*SpanContext, error) {
+	switch format {
+	case FormatB3:
+		if v := h.Get(headerB3Single); v != "" {
+			return extractB3Single(v)
+		}
+		return extractB3(h)
+	case FormatTraceContext:
+		return extractTraceContext(h.Get(headerTraceParent))
+	case FormatJaeger:
+		return extractJaeger(h.Get(headerJaeger))
+	default:
+		return nil, fmt.Errorf("unsupported format %s", format)
+	}
+}
+
+// ExtractAny extracts the span context in the first format of formats
+// existing in the headers, it returns the format too. It returns nil if
+// no valid span context exists.
+func ExtractAny(formats []string, h http.Header) (*SpanContext, string) {
+	for _, format := range formats {
+		if sc, err := Extract(format, h); err == nil {
+			return sc, format
+		}
+	}
+	return nil, ""
+}
+
+// Inject injects the span context in the format into the headers.
+func Inject(format string, sc *SpanContext, h http.Header) error {
+	switch format {
+	case FormatB3:
+		injectB3(sc, h)
+	case FormatTraceContext:
+		injectTraceContext(sc, h)
+	case FormatJaeger:
+		injectJaeger(sc, h)
+	default:
+		return fmt.Errorf("unsupported format %s", format)
+	}
+	return nil
+}
+
+// Clear removes the headers of the format. The tracestate of the trace
+// context is kept, since it's vendor specific and harmless.
+func Clear(format string, h http.Header) {
+	switch format {
+	case FormatB3:
+		for _, key := range []string{headerB3TraceID, headerB3SpanID, headerB3ParentSpanID,
+			headerB3Sampled, headerB3Flags, headerB3Single} {
+			h.Del(key)
+		}
+	case FormatTraceContext:
+		h.Del(headerTraceParent)
+	case FormatJaeger:
+		h.Del(headerJaeger)
+	}
+}
+
+// isHex reports whether s is lowercase hex and not all zeros.
+func isHex(s string, lengths ...int) bool {
+	valid := false
+	for _, l := range lengths {
+		if len(s) == l {
+			valid = true
+		}
+	}
+	if !valid {
+		return false
+	}
+
+	zeros := true
+	for _, c := range s {
+		switch {
+		case c == '0':
+		case c >= '1' && c <= '9', c >= 'a' && c <= 'f':
+			zeros = false
+		default:
+			return false
+		}
+	}
+	return !zeros
+}
+
+// padID pads the ID with leading zeros to the length.
+func padID(id string, length int) string {
+	if len(id) >= length {
+		return id
+	}
+	return strings.Repeat("0", length-len(id)) + id
+}
+
+func extractB3(h http.Header) (*SpanContext, error) {
+	sc := &SpanContext{
+		TraceID:      strings.ToLower(h.Get(headerB3TraceID)),
+		SpanID:       strings.ToLower(h.Get(headerB3SpanID)),
+		ParentSpanID: strings.ToLower(h.Get(headerB3ParentSpanID)),
+	}
+	if !isHex(sc.TraceID, 16, 32) || !isHex(sc.SpanID, 16) {
+		return nil, fmt.Errorf("invalid b3 trace id %q or span id %q", sc.TraceID, sc.SpanID)
+	}
+	if sc.ParentSpanID != "" && !isHex(sc.ParentSpanID, 16) {
+		return nil, fmt.Errorf("invalid b3 parent span id %q", sc.ParentSpanID)
+	}
+
+	switch h.Get(headerB3Sampled) {
+	case "1", "true":
+		sc.Sampling = SamplingAccept
+	case "0", "false":
+		sc.Sampling = SamplingDeny
+	}
+	if h.Get(headerB3Flags) == "1" {
+		sc.Sampling = SamplingDebug
+	}
+
+	return sc, nil
+}
+
+// extractB3Single extracts {TraceId}-{SpanId}-{SamplingState}-{ParentSpanId},
+// the last two fields are optional. The single sampling state without IDs
+// has no span context to propagate.
+func extractB3Single(value string) (*SpanContext, error) {
+	fields := strings.Split(strings.ToLower(value), "-")
+	if len(fields) < 2 || len(fields) > 4 {
+		return nil, fmt.Errorf("invalid b3 %q", value)
+	}
+
+	sc := &SpanContext{TraceID: fields[0], SpanID: fields[1]}
+	if !isHex(sc.TraceID, 16, 32) || !isHex(sc.SpanID, 16) {
+		return nil, fmt.Errorf("invalid b3 %q", value)
+	}
+	if len(fields) >= 3 {
+		switch fields[2] {
+		case "1":
+			sc.Sampling = SamplingAccept
+		case "0":
+			sc.Sampling = SamplingDeny
+		case "d":
+			sc.Sampling = SamplingDebug
+		default:
+			return nil, fmt.Errorf("invalid b3 %q", value)
+		}
+	}
+	if len(fields) == 4 {
+		sc.ParentSpanID = fields[3]
+		if !isHex(sc.ParentSpanID, 16) {
+			return nil, fmt.Errorf("invalid b3 %q", value)
+		}
+	}
+
+	return sc, nil
+}
+
+// extractTraceContext extracts version-traceid-parentid-flags, the
+// versions other than 00 are parsed as 00 as the spec requires.
+func extractTraceContext(value string) (*SpanContext, error) {
+	fields := strings.Split(value, "-")
+	if len(fields) < 4 || len(fields[0]) != 2 || fields[0] == "ff" || (fields[0] == "00" && len(fields) != 4) {
+		return nil, fmt.Errorf("invalid traceparent %q", value)
+	}
+
+	sc := &SpanContext{TraceID: fields[1], SpanID: fields[2]}
+	if !isHex(sc.TraceID, 32) || !isHex(sc.SpanID, 16) || len(fields[3]) != 2 {
+		return nil, fmt.Errorf("invalid traceparent %q", value)
+	}
+
+	var flags byte
+	if _, err := fmt.Sscanf(fields[3], "%02x", &flags); err != nil {
+		return nil, fmt.Errorf("invalid traceparent %q", value)
+	}
+	sc.Sampling = SamplingDeny
+	if flags&0x01 != 0 {
+		sc.Sampling = SamplingAccept
+	}
+
+	return sc, nil
+}
+
+// extractJaeger extracts {trace-id}:{span-id}:{parent-span-id}:{flags},
+// the leading zeros of the IDs could be omitted.
+func extractJaeger(value string) (*SpanContext, error) {
+	fields := strings.Split(strings.ToLower(value), ":")
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("invalid uber-trace-id %q", value)
+	}
+
+	traceID := fields[0]
+	if len(traceID) <= 16 {
+		traceID = padID(traceID, 16)
+	} else {
+		traceID = padID(traceID, 32)
+	}
+	sc := &SpanContext{TraceID: traceID, SpanID: padID(fields[1], 16)}
+	if !isHex(sc.TraceID, 16, 32) || !isHex(sc.SpanID, 16) {
+		return nil, fmt.Errorf("invalid uber-trace-id %q", value)
+	}
+	if parent := fields[2]; parent != "" && parent != "0" {
+		sc.ParentSpanID = padID(parent, 16)
+		if !isHex(sc.ParentSpanID, 16) {
+			return nil, fmt.Errorf("invalid uber-trace-id %q", value)
+		}
+	}
+
+	var flags byte
+	if _, err := fmt.Sscanf(fields[3], "%x", &flags); err != nil {
+		return nil, fmt.Errorf("invalid uber-trace-id %q", value)
+	}
+	switch {
+	case flags&0x02 != 0:
+		sc.Sampling = SamplingDebug
+	case flags&0x01 != 0:
+		sc.Sampling = SamplingAccept
+	default:
+		sc.Sampling = SamplingDeny
+	}
+
+	return sc, nil
+}
+
+func injectB3(sc *SpanContext, h http.Header) {
+	h.Set(headerB3TraceID, sc.TraceID)
+	h.Set(headerB3SpanID, sc.SpanID)
+	if sc.ParentSpanID != "" {
+		h.Set(headerB3ParentSpanID, sc.ParentSpanID)
+	}
+	switch sc.Sampling {
+	case SamplingAccept:
+		h.Set(headerB3Sampled, "1")
+	case SamplingDeny:
+		h.Set(headerB3Sampled, "0")
+	case SamplingDebug:
+		h.Set(headerB3Flags, "1")
+	}
+}
+
+// injectTraceContext injects the traceparent, the 64-bit trace ID is
+// padded to 128-bit. The deferred sampling decision is not sampled.
+func injectTraceContext(sc *SpanContext, h http.Header) {
+	flags := "00"
+	if sc.Sampling == SamplingAccept || sc.Sampling == SamplingDebug {
+		flags = "01"
+	}
+	h.Set(headerTraceParent, fmt.Sprintf("00-%s-%s-%s", padID(sc.TraceID, 32), sc.SpanID, flags))
+}
+
+func injectJaeger(sc *SpanContext, h http.Header) {
+	flags := 0
+	switch sc.Sampling {
+	case SamplingAccept:
+		flags = 1
+	case SamplingDebug:
+		flags = 3
+	}
+	parent := sc.ParentSpanID
+	if parent == "" {
+		parent = "0"
+	}
+	h.Set(headerJaeger, fmt.Sprintf("%s:%s:%s:%x", sc.TraceID, sc.SpanID, parent, flags))
+}
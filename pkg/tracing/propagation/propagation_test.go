@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package propagation
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+const (
+	testTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testSpanID  = "00f067aa0ba902b7"
+	testParent  = "e457b5a2e4d86bd1"
+)
+
+func TestExtract(t *testing.T) {
+	cases := []struct {
+		name   string
+		format string
+		header http.Header
+		want   *SpanContext
+	}{
+		{
+			name:   "b3 multiple headers",
+			format: FormatB3,
+			header: http.Header{
+				"X-B3-Traceid":      []string{testTraceID},
+				"X-B3-Spanid":       []string{testSpanID},
+				"X-B3-Parentspanid": []string{testParent},
+				"X-B3-Sampled":      []string{"1"},
+			},
+			want: &SpanContext{TraceID: testTraceID, SpanID: testSpanID, ParentSpanID: testParent, Sampling: SamplingAccept},
+		},
+		{
+			name:   "b3 deferred sampling with 64-bit trace id",
+			format: FormatB3,
+			header: http.Header{
+				"X-B3-Traceid": []string{"A3CE929D0E0E4736"},
+				"X-B3-Spanid":  []string{testSpanID},
+			},
+			want: &SpanContext{TraceID: "a3ce929d0e0e4736", SpanID: testSpanID},
+		},
+		{
+			name:   "b3 single header",
+			format: FormatB3,
+			header: http.Header{"B3": []string{testTraceID + "-" + testSpanID + "-d-" + testParent}},
+			want:   &SpanContext{TraceID: testTraceID, SpanID: testSpanID, ParentSpanID: testParent, Sampling: SamplingDebug},
+		},
+		{
+			name:   "w3c trace context",
+			format: FormatTraceContext,
+			header: http.Header{"Traceparent": []string{"00-" + testTraceID + "-" + testSpanID + "-01"}},
+			want:   &SpanContext{TraceID: testTraceID, SpanID: testSpanID, Sampling: SamplingAccept},
+		},
+		{
+			name:   "w3c trace context not sampled",
+			format: FormatTraceContext,
+			header: http.Header{"Traceparent": []string{"00-" + testTraceID + "-" + testSpanID + "-00"}},
+			want:   &SpanContext{TraceID: testTraceID, SpanID: testSpanID, Sampling: SamplingDeny},
+		},
+		{
+			name:   "jaeger with omitted leading zeros",
+			format: FormatJaeger,
+			header: http.Header{"Uber-Trace-Id": []string{testTraceID + ":f067aa0ba902b7:0:1"}},
+			want:   &SpanContext{TraceID: testTraceID, SpanID: testSpanID, Sampling: SamplingAccept},
+		},
+		{
+			name:   "jaeger debug with parent",
+			format: FormatJaeger,
+			header: http.Header{"Uber-Trace-Id": []string{"a3ce929d0e0e4736:" + testSpanID + ":" + testParent + ":3"}},
+			want:   &SpanContext{TraceID: "a3ce929d0e0e4736", SpanID: testSpanID, ParentSpanID: testParent, Sampling: SamplingDebug},
+		},
+	}
+
+	for _, c := range cases {
+		got, err := Extract(c.format, c.header)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: want %+v, got %+v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestExtractInvalid(t *testing.T) {
+	cases := map[string]http.Header{
+		FormatB3: {
+			"X-B3-Traceid": []string{"00000000000000000000000000000000"},
+			"X-B3-Spanid":  []string{testSpanID},
+		},
+		FormatTraceContext: {"Traceparent": []string{"00-" + testTraceID + "-" + testSpanID}},
+		FormatJaeger:       {"Uber-Trace-Id": []string{"xyz:" + testSpanID + ":0:1"}},
+	}
+	for format, h := range cases {
+		if _, err := Extract(format, h); err == nil {
+			t.Errorf("%s: want error for %v", format, h)
+		}
+	}
+
+	if _, err := Extract(FormatB3, http.Header{"B3": []string{"1"}}); err == nil {
+		t.Errorf("want error for b3 with sampling state only")
+	}
+	if _, err := Extract("unknown", http.Header{}); err == nil {
+		t.Errorf("want error for unknown format")
+	}
+}
+
+func TestExtractAnyAndInject(t *testing.T) {
+	h := http.Header{
+		"X-B3-Traceid": []string{"a3ce929d0e0e4736"},
+		"X-B3-Spanid":  []string{testSpanID},
+		"X-B3-Sampled": []string{"1"},
+	}
+
+	sc, format := ExtractAny([]string{FormatTraceContext, FormatB3}, h)
+	if sc == nil || format != FormatB3 {
+		t.Fatalf("want span context in b3, got %+v in %s", sc, format)
+	}
+
+	Clear(FormatB3, h)
+	if err := Inject(FormatTraceContext, sc, h); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := h.Get("traceparent"); got != "00-0000000000000000a3ce929d0e0e4736-"+testSpanID+"-01" {
+		t.Errorf("unexpected traceparent: %s", got)
+	}
+	if h.Get("X-B3-TraceId") != "" {
+		t.Errorf("b3 headers should be cleared")
+	}
+
+	for _, format := range Formats {
+		h := http.Header{}
+		want := &SpanContext{TraceID: testTraceID, SpanID: testSpanID, ParentSpanID: testParent, Sampling: SamplingDebug}
+		if format == FormatTraceContext {
+			want = &SpanContext{TraceID: testTraceID, SpanID: testSpanID, Sampling: SamplingAccept}
+		}
+		if err := Inject(format, want, h); err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		got, err := Extract(format, h)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: want %+v, got %+v, %v", format, want, got, err)
+		}
+	}
+
+	if sc, _ := ExtractAny(Formats, http.Header{}); sc != nil {
+		t.Errorf("want nil span context without trace headers")
+	}
+}
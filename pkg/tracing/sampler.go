@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+
+	"github.com/megaease/easegress/pkg/tracing/base"
+)
+
+type (
+	// AlwaysSampleSpec describes the requests sampled regardless of the
+	// sample rate of the tracer.
+	AlwaysSampleSpec struct {
+		// OnError samples the requests ended in 5xx.
+		OnError bool `yaml:"onError" jsonschema:"omitempty"`
+		// AboveLatencyMs samples the requests whose latency exceeds it,
+		// zero means disabled.
+		AboveLatencyMs int `yaml:"aboveLatencyMs" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// tailSampler decides whether a trace is sampled when its root span
+	// finishes, so the tracer records all spans and the ones not sampled
+	// are cancelled.
+	tailSampler struct {
+		// NOTE: It's the first field to be 64-bit aligned for atomic.
+		dropped uint64
+
+		spec  *AlwaysSampleSpec
+		rate  float64
+		queue spanQueue
+	}
+
+	// spanQueue is the queue of the spans to be reported, the traces
+	// sampled by AlwaysSample never overflow it.
+	spanQueue interface {
+		Full() bool
+	}
+
+	// traceSampling is shared by the spans of a trace, the spans finished
+	// before the decision wait in pending.
+	traceSampling struct {
+		sampledByRate bool
+
+		mutex   sync.Mutex
+		decided bool
+		sampled bool
+		pending []pendingSpan
+	}
+
+	pendingSpan struct {
+		span     opentracing.Span
+		finishAt time.Time
+	}
+)
+
+func newTailSampler(spec *AlwaysSampleSpec, rate float64, queue spanQueue) *tailSampler {
+	return &tailSampler{
+		spec:  spec,
+		rate:  rate,
+		queue: queue,
+	}
+}
+
+func (s *tailSampler) newTraceSampling() *traceSampling {
+	return &traceSampling{sampledByRate: rand.Float64() < s.rate}
+}
+
+// always reports whether the finished request must be sampled regardless
+// of the sample rate.
+func (s *tailSampler) always(statusCode int, latency time.Duration) bool {
+	if s.spec.OnError && statusCode >= 500 {
+		return true
+	}
+
+	if s.spec.AboveLatencyMs > 0 &&
+		latency > time.Duration(s.spec.AboveLatencyMs)*time.Millisecond {
+		return true
+	}
+
+	return false
+}
+
+// sample decides whether the trace is sampled, the ones sampled only by
+// the results are dropped if the span queue is full.
+func (s *tailSampler) sample(sampledByRate bool, statusCode int, latency time.Duration) bool {
+	if sampledByRate {
+		return true
+	}
+
+	if !s.always(statusCode, latency) {
+		return false
+	}
+
+	if s.queue.Full() {
+		atomic.AddUint64(&s.dropped, 1)
+		return false
+	}
+
+	return true
+}
+
+func (s *tailSampler) droppedCount() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// finish finishes the span if the trace is decided, or keeps it pending.
+func (ts *traceSampling) finish(span opentracing.Span, finishAt time.Time) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	if !ts.decided {
+		ts.pending = append(ts.pending, pendingSpan{span: span, finishAt: finishAt})
+		return
+	}
+
+	finishSampledSpan(span, finishAt, ts.sampled)
+}
+
+// decide records the decision and finishes the pending spans.
+func (ts *traceSampling) decide(sampled bool) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	ts.decided, ts.sampled = true, sampled
+	for _, p := range ts.pending {
+		finishSampledSpan(p.span, p.finishAt, sampled)
+	}
+	ts.pending = nil
+}
+
+func finishSampledSpan(span opentracing.Span, finishAt time.Time, sampled bool) {
+	if !sampled {
+		span.SetTag(base.CancelTagKey, "yes")
+	}
+	span.FinishWithOptions(opentracing.FinishOptions{FinishTime: finishAt})
+}
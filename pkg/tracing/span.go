@@ -37,6 +37,10 @@ type (
 
 		// Finish finishes the span.
 		Finish()
+		// FinishWithStatus finishes the span of a request with its status
+		// code, which decides whether the trace is sampled if the tracing
+		// always samples the failed or slow requests.
+		FinishWithStatus(statusCode int)
 		// Cancel cancels the span, it should be called before Finish called.
 		// It will cancel all descendent spans.
 		Cancel()
@@ -49,6 +53,10 @@ type (
 		// SetName changes the span name.
 		SetName(name string)
 
+		// SetTag sets the tag key:value for the span, the value may be
+		// a string, numeric type or bool.
+		SetTag(key string, value interface{})
+
 		// LogKV logs key:value for the span.
 		//
 		// The keys must all be strings. The values may be strings, numeric types,
@@ -68,9 +76,23 @@ type (
 		tracer   *Tracing
 		span     opentracing.Span
 		children []*span
+
+		// sampling is nil unless the tracing decides the sampling when the
+		// root span finishes.
+		sampling *traceSampling
+		root     bool
+		startAt  time.Time
 	}
+
+	noopSpan struct{}
 )
 
+// NoopSpan is the span doing nothing, it's shared by all requests when
+// the tracing is disabled, so no span is allocated for them.
+var NoopSpan Span = noopSpan{}
+
+var noopSpanContext = opentracing.NoopTracer{}.StartSpan("").Context()
+
 // NewSpan creates a span.
 func NewSpan(tracer *Tracing, name string) Span {
 	return newSpanWithStart(tracer, name, time.Now())
@@ -82,10 +104,21 @@ func NewSpanWithStart(tracer *Tracing, name string, startAt time.Time) Span {
 }
 
 func newSpanWithStart(tracer *Tracing, name string, startAt time.Time) Span {
-	return &span{
-		tracer: tracer,
-		span:   tracer.StartSpan(name, opentracing.StartTime(startAt)),
+	if tracer.IsNoop() {
+		return NoopSpan
 	}
+
+	s := &span{
+		tracer:  tracer,
+		span:    tracer.StartSpan(name, opentracing.StartTime(startAt)),
+		root:    true,
+		startAt: startAt,
+	}
+	if tracer.sampler != nil {
+		s.sampling = tracer.sampler.newTraceSampling()
+	}
+
+	return s
 }
 
 func (s *span) Tracer() opentracing.Tracer {
@@ -97,9 +130,33 @@ func (s *span) Context() opentracing.SpanContext {
 }
 
 func (s *span) Finish() {
+	if s.root {
+		// NOTE: The status code is unknown, so only the sample rate counts.
+		s.FinishWithStatus(0)
+		return
+	}
+
+	if s.sampling != nil {
+		s.sampling.finish(s.span, time.Now())
+		return
+	}
+
 	s.span.Finish()
 }
 
+func (s *span) FinishWithStatus(statusCode int) {
+	if s.sampling == nil || !s.root {
+		s.span.Finish()
+		return
+	}
+
+	now := time.Now()
+	sampled := s.tracer.sampler.sample(s.sampling.sampledByRate,
+		statusCode, now.Sub(s.startAt))
+	s.sampling.decide(sampled)
+	finishSampledSpan(s.span, now, sampled)
+}
+
 func (s *span) Cancel() {
 	s.span.SetTag(base.CancelTagKey, "yes")
 	for _, child := range s.children {
@@ -120,8 +177,10 @@ func (s *span) newChildWithStart(name string, startAt time.Time) Span {
 		opentracing.ChildOf(s.span.Context()),
 		opentracing.StartTime(startAt))
 	child := &span{
-		tracer: s.tracer,
-		span:   childSpan,
+		tracer:   s.tracer,
+		span:     childSpan,
+		sampling: s.sampling,
+		startAt:  startAt,
 	}
 
 	s.mutex.Lock()
@@ -135,6 +194,38 @@ func (s *span) SetName(name string) {
 	s.span.SetOperationName(name)
 }
 
+func (s *span) SetTag(key string, value interface{}) {
+	s.span.SetTag(key, value)
+}
+
 func (s *span) LogKV(kv ...interface{}) {
 	s.span.LogKV(kv...)
 }
+
+func (s noopSpan) Tracer() opentracing.Tracer {
+	return NoopTracing
+}
+
+func (s noopSpan) Context() opentracing.SpanContext {
+	return noopSpanContext
+}
+
+func (s noopSpan) Finish() {}
+
+func (s noopSpan) FinishWithStatus(statusCode int) {}
+
+func (s noopSpan) Cancel() {}
+
+func (s noopSpan) NewChild(name string) Span {
+	return s
+}
+
+func (s noopSpan) NewChildWithStart(name string, startAt time.Time) Span {
+	return s
+}
+
+func (s noopSpan) SetName(name string) {}
+
+func (s noopSpan) SetTag(key string, value interface{}) {}
+
+func (s noopSpan) LogKV(kv ...interface{}) {}
@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+
+	"github.com/megaease/easegress/pkg/tracing/base"
+)
+
+func TestNoopSpan(t *testing.T) {
+	if !NoopTracing.IsNoop() {
+		t.Errorf("NoopTracing should be noop")
+	}
+
+	span := NewSpan(NoopTracing, "request")
+	if span != NoopSpan {
+		t.Errorf("want NoopSpan for disabled tracing, got %T", span)
+	}
+	if child := span.NewChildWithStart("backend", time.Now()); child != NoopSpan {
+		t.Errorf("want NoopSpan as the child, got %T", child)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		span := NewSpan(NoopTracing, "request")
+		span.NewChild("backend").Finish()
+		span.Finish()
+	})
+	if allocs != 0 {
+		t.Errorf("want no allocation for disabled tracing, got %v", allocs)
+	}
+
+	tracer := &Tracing{Tracer: mocktracer.New()}
+	if tracer.IsNoop() {
+		t.Errorf("mock tracing should not be noop")
+	}
+	if span := NewSpan(tracer, "request"); span == NoopSpan {
+		t.Errorf("want a real span for enabled tracing")
+	}
+}
+
+func BenchmarkSpanDisabled(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		span := NewSpan(NoopTracing, "request")
+		span.NewChild("backend").Finish()
+		span.Finish()
+	}
+}
+
+func BenchmarkSpanEnabled(b *testing.B) {
+	mockTracer := mocktracer.New()
+	tracer := &Tracing{Tracer: mockTracer}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		// NOTE: The mock tracer keeps the finished spans.
+		if i%1024 == 0 {
+			mockTracer.Reset()
+		}
+		span := NewSpan(tracer, "request")
+		span.NewChild("backend").Finish()
+		span.Finish()
+	}
+}
+
+type mockedSpanQueue struct {
+	full bool
+}
+
+func (q *mockedSpanQueue) Full() bool {
+	return q.full
+}
+
+func TestTailSampler(t *testing.T) {
+	queue := &mockedSpanQueue{}
+	sampler := newTailSampler(&AlwaysSampleSpec{
+		OnError:        true,
+		AboveLatencyMs: 100,
+	}, 0, queue)
+
+	if !sampler.sample(true, 200, time.Millisecond) {
+		t.Errorf("trace sampled by rate should be sampled")
+	}
+	if sampler.sample(false, 404, time.Millisecond) {
+		t.Errorf("4xx request should not be sampled")
+	}
+	if sampler.sample(false, 200, 100*time.Millisecond) {
+		t.Errorf("request at the latency threshold should not be sampled")
+	}
+	if !sampler.sample(false, 503, time.Millisecond) {
+		t.Errorf("5xx request should be sampled")
+	}
+	if !sampler.sample(false, 200, 200*time.Millisecond) {
+		t.Errorf("slow request should be sampled")
+	}
+
+	queue.full = true
+	if sampler.sample(false, 503, time.Millisecond) {
+		t.Errorf("5xx request should be dropped when the span queue is full")
+	}
+	if sampler.droppedCount() != 1 {
+		t.Errorf("want 1 dropped trace, got %d", sampler.droppedCount())
+	}
+	if !sampler.sample(true, 503, time.Millisecond) {
+		t.Errorf("trace sampled by rate should not be dropped by the sampler")
+	}
+}
+
+func TestSpanSampledByStatus(t *testing.T) {
+	mockTracer := mocktracer.New()
+	tracer := &Tracing{
+		Tracer:  mockTracer,
+		sampler: newTailSampler(&AlwaysSampleSpec{OnError: true}, 0, &mockedSpanQueue{}),
+	}
+
+	cancelled := func() map[string]bool {
+		result := map[string]bool{}
+		for _, s := range mockTracer.FinishedSpans() {
+			result[s.OperationName] = s.Tag(base.CancelTagKey) != nil
+		}
+		return result
+	}
+
+	span := NewSpan(tracer, "request")
+	span.NewChild("backend").Finish()
+	if n := len(mockTracer.FinishedSpans()); n != 0 {
+		t.Errorf("want the child pending before the decision, got %d finished", n)
+	}
+	span.FinishWithStatus(200)
+	result := cancelled()
+	if len(result) != 2 || !result["request"] || !result["backend"] {
+		t.Errorf("want the successful trace cancelled, got %v", result)
+	}
+
+	mockTracer.Reset()
+	span = NewSpan(tracer, "request")
+	child := span.NewChild("backend")
+	span.FinishWithStatus(503)
+	child.Finish()
+	result = cancelled()
+	if len(result) != 2 || result["request"] || result["backend"] {
+		t.Errorf("want the failed trace sampled, got %v", result)
+	}
+	if tracer.DroppedSamples() != 0 {
+		t.Errorf("want no dropped trace, got %d", tracer.DroppedSamples())
+	}
+}
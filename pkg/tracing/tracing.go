@@ -31,13 +31,18 @@ type (
 		ServiceName string `yaml:"serviceName" jsonschema:"required"`
 
 		Zipkin *zipkin.Spec `yaml:"zipkin" jsonschema:"omitempty"`
+
+		// AlwaysSample samples the failed or slow requests beyond the
+		// sample rate, the decision is made when the requests finish.
+		AlwaysSample *AlwaysSampleSpec `yaml:"alwaysSample,omitempty" jsonschema:"omitempty"`
 	}
 
 	// Tracing is the tracing.
 	Tracing struct {
 		opentracing.Tracer
 
-		closer io.Closer
+		closer  io.Closer
+		sampler *tailSampler
 	}
 
 	noopCloser struct{}
@@ -55,15 +60,42 @@ func New(spec *Spec) (*Tracing, error) {
 		return NoopTracing, nil
 	}
 
-	tracer, closer, err := zipkin.New(spec.ServiceName, spec.Zipkin)
+	// NOTE: The tracer records all spans if the sampling is decided by
+	// the results, the ones not sampled are cancelled when they finish.
+	sampleAll := spec.AlwaysSample != nil
+	tracer, reporter, err := zipkin.New(spec.ServiceName, spec.Zipkin, sampleAll)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Tracing{
+	t := &Tracing{
 		Tracer: tracer,
-		closer: closer,
-	}, nil
+		closer: reporter,
+	}
+	if sampleAll {
+		t.sampler = newTailSampler(spec.AlwaysSample, spec.Zipkin.SampleRate, reporter)
+	}
+
+	return t, nil
+}
+
+// DroppedSamples returns the number of traces sampled by AlwaysSample but
+// dropped since the span queue of the reporter is full.
+func (t *Tracing) DroppedSamples() uint64 {
+	if t == nil || t.sampler == nil {
+		return 0
+	}
+	return t.sampler.droppedCount()
+}
+
+// IsNoop reports whether the tracing does nothing, the spans of it are
+// never allocated.
+func (t *Tracing) IsNoop() bool {
+	if t == nil || t == NoopTracing {
+		return true
+	}
+	_, noop := t.Tracer.(opentracing.NoopTracer)
+	return noop
 }
 
 // Close closes Tracing.
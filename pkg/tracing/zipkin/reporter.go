@@ -0,0 +1,203 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package zipkin
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	zipkingomodel "github.com/openzipkin/zipkin-go/model"
+	zipkingoreporter "github.com/openzipkin/zipkin-go/reporter"
+	zipkingohttp "github.com/openzipkin/zipkin-go/reporter/http"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/kafkaconfig"
+)
+
+const defaultQueuedMaxSpans = 1000
+
+type (
+	// KafkaSpec is the kafka the spans are sent to, each message is a
+	// list of spans in the json form of the zipkin v2 API.
+	KafkaSpec struct {
+		Brokers []string `yaml:"brokers" jsonschema:"required,uniqueItems=true"`
+		Topic   string   `yaml:"topic" jsonschema:"required"`
+		// Timeout is the dial timeout in milliseconds, zero means the default.
+		Timeout int `yaml:"timeout,omitempty" jsonschema:"omitempty,minimum=0"`
+		// SASL authenticates the producer, nil means no authentication.
+		SASL *kafkaconfig.SASLSpec `yaml:"sasl,omitempty" jsonschema:"omitempty"`
+		// TLS encrypts the connections to the brokers, nil means plaintext.
+		TLS *kafkaconfig.TLSSpec `yaml:"tls,omitempty" jsonschema:"omitempty"`
+	}
+
+	// Reporter queues the spans and reports them in background, so a slow
+	// or unreachable backend never blocks the requests, the spans beyond
+	// the queue are dropped.
+	Reporter struct {
+		backend zipkingoreporter.Reporter
+		queue   chan zipkingomodel.SpanModel
+
+		done      chan struct{}
+		closeOnce sync.Once
+		wg        sync.WaitGroup
+	}
+
+	// kafkaReporter sends the spans to the kafka topic, the producer is
+	// rebuilt until it succeeds.
+	kafkaReporter struct {
+		name     string
+		spec     *KafkaSpec
+		producer sarama.AsyncProducer
+		done     <-chan struct{}
+	}
+)
+
+// producerRetryInterval is the interval of rebuilding the failed producer.
+var producerRetryInterval = 5 * time.Second
+
+func newReporter(name string, spec *Spec) *Reporter {
+	queuedMaxSpans := spec.QueuedMaxSpans
+	if queuedMaxSpans == 0 {
+		queuedMaxSpans = defaultQueuedMaxSpans
+	}
+
+	r := &Reporter{
+		queue: make(chan zipkingomodel.SpanModel, queuedMaxSpans),
+		done:  make(chan struct{}),
+	}
+	if spec.Kafka != nil {
+		r.backend = newKafkaReporter(name, spec.Kafka, r.done)
+	} else {
+		r.backend = zipkingohttp.NewReporter(spec.ServerURL)
+	}
+
+	r.wg.Add(1)
+	go r.run()
+
+	return r
+}
+
+func (r *Reporter) run() {
+	defer r.wg.Done()
+
+	for {
+		select {
+		case sm := <-r.queue:
+			r.backend.Send(sm)
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// Send queues the span, it's dropped if the queue is full.
+func (r *Reporter) Send(sm zipkingomodel.SpanModel) {
+	select {
+	case r.queue <- sm:
+	default:
+	}
+}
+
+// Full reports whether the queue is full.
+func (r *Reporter) Full() bool {
+	return len(r.queue) == cap(r.queue)
+}
+
+// Close closes the reporter, the queued spans are dropped.
+func (r *Reporter) Close() error {
+	r.closeOnce.Do(func() { close(r.done) })
+	r.wg.Wait()
+	return r.backend.Close()
+}
+
+// newKafkaReporter creates the kafka reporter, which stops sending when
+// done is closed.
+func newKafkaReporter(name string, spec *KafkaSpec, done <-chan struct{}) *kafkaReporter {
+	return &kafkaReporter{
+		name: name,
+		spec: spec,
+		done: done,
+	}
+}
+
+// Send sends the span, it blocks until the producer is built or the
+// reporter is closed, it's only called by the queue of Reporter.
+func (r *kafkaReporter) Send(sm zipkingomodel.SpanModel) {
+	for r.producer == nil {
+		r.producer = r.newProducer()
+		if r.producer != nil {
+			break
+		}
+
+		select {
+		case <-time.After(producerRetryInterval):
+		case <-r.done:
+			return
+		}
+	}
+
+	// NOTE: The zipkin kafka collector expects a list of spans.
+	buff, err := json.Marshal([]zipkingomodel.SpanModel{sm})
+	if err != nil {
+		logger.Errorf("BUG: marshal span %+v failed: %v", sm, err)
+		return
+	}
+
+	select {
+	case r.producer.Input() <- &sarama.ProducerMessage{
+		Topic: r.spec.Topic,
+		Value: sarama.ByteEncoder(buff),
+	}:
+	case <-r.done:
+	}
+}
+
+func (r *kafkaReporter) newProducer() sarama.AsyncProducer {
+	config, err := kafkaconfig.ProducerConfig(r.name,
+		time.Duration(r.spec.Timeout)*time.Millisecond, r.spec.SASL, r.spec.TLS)
+	if err != nil {
+		logger.Errorf("%s: build kafka producer config failed: %v", r.name, err)
+		return nil
+	}
+
+	producer, err := sarama.NewAsyncProducer(r.spec.Brokers, config)
+	if err != nil {
+		logger.Errorf("%s: start kafka producer failed(brokers: %v): %v",
+			r.name, r.spec.Brokers, err)
+		return nil
+	}
+
+	go func() {
+		for err := range producer.Errors() {
+			logger.Errorf("%s: produce span failed: %v", r.name, err)
+		}
+	}()
+
+	return producer
+}
+
+// Close closes the producer, it's called after the queue of Reporter
+// stops sending.
+func (r *kafkaReporter) Close() error {
+	if r.producer == nil {
+		return nil
+	}
+	return r.producer.Close()
+}
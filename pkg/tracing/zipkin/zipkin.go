@@ -18,7 +18,7 @@
 package zipkin
 
 import (
-	"io"
+	"fmt"
 	"time"
 
 	opentracing "github.com/opentracing/opentracing-go"
@@ -26,7 +26,6 @@ import (
 	zipkingo "github.com/openzipkin/zipkin-go"
 	zipkingomodel "github.com/openzipkin/zipkin-go/model"
 	zipkingoreporter "github.com/openzipkin/zipkin-go/reporter"
-	zipkingohttp "github.com/openzipkin/zipkin-go/reporter/http"
 
 	"github.com/megaease/easegress/pkg/tracing/base"
 )
@@ -35,10 +34,16 @@ type (
 	// Spec describes Zipkin.
 	Spec struct {
 		Hostport   string  `yaml:"hostport" jsonschema:"omitempty"`
-		ServerURL  string  `yaml:"serverURL" jsonschema:"required,format=url"`
+		ServerURL  string  `yaml:"serverURL,omitempty" jsonschema:"omitempty,format=url"`
 		SampleRate float64 `yaml:"sampleRate" jsonschema:"required,minimum=0,maximum=1"`
 		SameSpan   bool    `yaml:"sameSpan" jsonschema:"omitempty"`
 		ID128Bit   bool    `yaml:"id128Bit" jsonschema:"omitempty"`
+
+		// Kafka sends the spans to the kafka topic instead of ServerURL.
+		Kafka *KafkaSpec `yaml:"kafka,omitempty" jsonschema:"omitempty"`
+		// QueuedMaxSpans bounds the spans waiting to be reported, the ones
+		// beyond it are dropped, default is 1000.
+		QueuedMaxSpans int `yaml:"queuedMaxSpans,omitempty" jsonschema:"omitempty,minimum=0"`
 	}
 
 	cancellableReporter struct {
@@ -58,6 +63,10 @@ func (cp *cancellableReporter) Close() error { return cp.reporter.Close() }
 
 // Validate validates Spec.
 func (spec Spec) Validate() error {
+	if spec.ServerURL == "" && spec.Kafka == nil {
+		return fmt.Errorf("neither serverURL nor kafka is specified")
+	}
+
 	if spec.Hostport != "" {
 		_, err := zipkingo.NewEndpoint("", spec.Hostport)
 		if err != nil {
@@ -68,8 +77,10 @@ func (spec Spec) Validate() error {
 	return nil
 }
 
-// New creates zipkin tracer.
-func New(serviceName string, spec *Spec) (opentracing.Tracer, io.Closer, error) {
+// New creates zipkin tracer, it samples all spans if sampleAll is true,
+// leaving the decision to the caller, who may check whether the reporter
+// is full before sampling more.
+func New(serviceName string, spec *Spec, sampleAll bool) (opentracing.Tracer, *Reporter, error) {
 	endpoint, err := zipkingo.NewEndpoint(serviceName, spec.Hostport)
 	if err != nil {
 		return nil, nil, err
@@ -79,8 +90,11 @@ func New(serviceName string, spec *Spec) (opentracing.Tracer, io.Closer, error)
 	if err != nil {
 		return nil, nil, err
 	}
+	if sampleAll {
+		sampler = zipkingo.AlwaysSample
+	}
 
-	reporter := zipkingohttp.NewReporter(spec.ServerURL)
+	reporter := newReporter(serviceName, spec)
 
 	nativeTracer, err := zipkingo.NewTracer(
 		&cancellableReporter{reporter: reporter},
@@ -90,6 +104,7 @@ func New(serviceName string, spec *Spec) (opentracing.Tracer, io.Closer, error)
 		zipkingo.WithSampler(sampler),
 	)
 	if err != nil {
+		reporter.Close()
 		return nil, nil, err
 	}
 
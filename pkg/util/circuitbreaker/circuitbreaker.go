@@ -258,6 +258,10 @@ type (
 		SlowCallDurationThreshold        time.Duration
 		MaxWaitDurationInHalfOpen        time.Duration
 		WaitDurationInOpen               time.Duration
+		// MaxWaitDurationInOpen enables the exponential backoff of the wait
+		// duration in open state when the probes in half open state fail,
+		// the wait duration is doubled each time but never exceeds it.
+		MaxWaitDurationInOpen time.Duration
 	}
 
 	// Event stores the state change event
@@ -286,6 +290,9 @@ type (
 		// result is discarded as it does not belong to current state.
 		stateID  uint32
 		listener EventListenerFunc
+		// waitDurationInOpen is the current wait duration in open state,
+		// it may be backed off from the one of the policy.
+		waitDurationInOpen time.Duration
 	}
 )
 
@@ -330,7 +337,10 @@ func NewDefaultPolicy() *Policy {
 
 // New creates a circuit breaker based on `policy`,
 func New(policy *Policy) *CircuitBreaker {
-	cb := &CircuitBreaker{policy: policy}
+	cb := &CircuitBreaker{
+		policy:             policy,
+		waitDurationInOpen: policy.WaitDurationInOpen,
+	}
 	cb.transitTo(StateClosed, "initialization")
 	return cb
 }
@@ -361,6 +371,8 @@ func (cb *CircuitBreaker) transitTo(state State, reason string) {
 	cb.stateID++
 
 	if state == StateClosed {
+		cb.waitDurationInOpen = cb.policy.WaitDurationInOpen
+
 		// recreate the window to remove all existing results to avoid jitter
 		if cb.policy.SlidingWindowType == CountBased {
 			cb.window = NewCountBasedWindow(cb.policy.SlidingWindowSize)
@@ -386,11 +398,37 @@ func (cb *CircuitBreaker) transitTo(state State, reason string) {
 	}
 }
 
+// open transits the CircuitBreaker to open state, the wait duration in open
+// state is backed off if the probes in half open state failed.
+func (cb *CircuitBreaker) open(reason string) {
+	if cb.state == StateHalfOpen && cb.policy.MaxWaitDurationInOpen > 0 {
+		cb.waitDurationInOpen *= 2
+		if cb.waitDurationInOpen > cb.policy.MaxWaitDurationInOpen {
+			cb.waitDurationInOpen = cb.policy.MaxWaitDurationInOpen
+		}
+	}
+	cb.transitTo(StateOpen, reason)
+}
+
 // State returns the state of the circuit breaker
 func (cb *CircuitBreaker) State() State {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
 	return cb.state
 }
 
+// WaitDurationInOpen returns the current wait duration in open state.
+func (cb *CircuitBreaker) WaitDurationInOpen() time.Duration {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+	return cb.waitDurationInOpen
+}
+
+// String returns the string representation of the state.
+func (s State) String() string {
+	return stateStrings[s]
+}
+
 // AcquirePermission acquires a permission from the circuit breaker
 // returns true & stateID if the request is permitted
 // returns false & stateID if the request is rejected
@@ -420,7 +458,7 @@ func (cb *CircuitBreaker) AcquirePermission() (bool, uint32) {
 	// when state is open, return false if open duration is less than
 	// WaitDurationInOpenState. transit to half open otherwise
 	if cb.state == StateOpen {
-		if nowFunc().Sub(cb.transitTime) < cb.policy.WaitDurationInOpen {
+		if nowFunc().Sub(cb.transitTime) < cb.waitDurationInOpen {
 			return false, cb.stateID
 		}
 		cb.transitTo(StateHalfOpen, "wait duration in open state elapsed")
@@ -482,9 +520,9 @@ func (cb *CircuitBreaker) RecordResult(stateID uint32, hasErr bool, d time.Durat
 	// is success as existing success results may be evicted by time.
 	// note half open state always use a count based window.
 	if r := cb.window.FailureRate(); r >= cb.policy.FailureRateThreshold {
-		cb.transitTo(StateOpen, fmt.Sprintf("high failure rate: %d", r))
+		cb.open(fmt.Sprintf("high failure rate: %d", r))
 	} else if r = cb.window.SlowRate(); r >= cb.policy.SlowCallRateThreshold {
-		cb.transitTo(StateOpen, fmt.Sprintf("high slow call rate: %d", r))
+		cb.open(fmt.Sprintf("high slow call rate: %d", r))
 	} else if cb.state == StateHalfOpen {
 		cb.transitTo(StateClosed, "recovery")
 	}
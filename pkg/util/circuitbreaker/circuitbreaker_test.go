@@ -222,3 +222,51 @@ func TestTimeBased(t *testing.T) {
 		t.Errorf("circuit breaker state should be Open")
 	}
 }
+
+func TestOpenStateBackOff(t *testing.T) {
+	policy := NewPolicy(50, 100, CountBased, 10, 1, 10, time.Minute, 0, time.Second)
+	policy.MaxWaitDurationInOpen = 3 * time.Second
+	cb := New(policy)
+
+	for i := 0; i < 10; i++ {
+		_, stateID := cb.AcquirePermission()
+		cb.RecordResult(stateID, true, time.Millisecond)
+	}
+	if cb.State() != StateOpen {
+		t.Fatalf("state should be open")
+	}
+
+	probe := func(hasErr bool) {
+		if permitted, stateID := cb.AcquirePermission(); permitted {
+			cb.RecordResult(stateID, hasErr, time.Millisecond)
+		} else {
+			t.Errorf("the probe should be permitted")
+		}
+	}
+
+	for _, want := range []time.Duration{2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		now = now.Add(cb.WaitDurationInOpen())
+		probe(true)
+		if cb.State() != StateOpen {
+			t.Fatalf("state should be open after the probe failed")
+		}
+		if d := cb.WaitDurationInOpen(); d != want {
+			t.Errorf("want wait duration %v, got %v", want, d)
+		}
+		if permitted, _ := cb.AcquirePermission(); permitted {
+			t.Errorf("only one probe should be permitted")
+		}
+	}
+
+	now = now.Add(cb.WaitDurationInOpen())
+	probe(false)
+	if cb.State() != StateClosed {
+		t.Fatalf("state should be closed after the probe succeeded")
+	}
+	if d := cb.WaitDurationInOpen(); d != time.Second {
+		t.Errorf("wait duration should be reset to 1s, got %v", d)
+	}
+	if cb.State().String() != "Closed" {
+		t.Errorf("state string should be Closed, got %s", cb.State())
+	}
+}
@@ -70,8 +70,8 @@ func (p Probability) Validate() error {
 
 // Validate validates Spec
 func (s Spec) Validate() error {
-	if len(s.Headers) == 0 && s.Probability == nil {
-		return fmt.Errorf("none of headers and probability is specified")
+	if len(s.Headers) == 0 && len(s.URLs) == 0 && s.Probability == nil {
+		return fmt.Errorf("none of headers, urls and probability is specified")
 	}
 
 	if len(s.Headers) > 0 && s.Probability != nil {
@@ -108,6 +108,10 @@ func (hf *HTTPFilter) Filter(ctx context.HTTPContext) bool {
 		return matchHeader
 	}
 
+	if hf.spec.Probability == nil {
+		return hf.filterURL(ctx)
+	}
+
 	return hf.filterProbability(ctx)
 }
 
@@ -20,6 +20,7 @@ package jmxtool
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"strconv"
 
@@ -50,7 +51,7 @@ type AgentClient struct {
 // NewAgentClient creates the agent client
 func NewAgentClient(host, port string) *AgentClient {
 	return &AgentClient{
-		"http://" + host + ":" + port,
+		"http://" + net.JoinHostPort(host, port),
 		&http.Client{},
 	}
 }
@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package kafkaconfig builds the configs of the kafka clients with their
+// authentication and encryption.
+package kafkaconfig
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+type (
+	// SASLSpec is the SASL authentication of the kafka producer.
+	SASLSpec struct {
+		Mechanism string `yaml:"mechanism" jsonschema:"required,enum=PLAIN,enum=SCRAM-SHA-256,enum=SCRAM-SHA-512"`
+		Username  string `yaml:"username" jsonschema:"required"`
+		Password  string `yaml:"password" jsonschema:"required"`
+	}
+
+	// TLSSpec is the TLS of the kafka producer.
+	TLSSpec struct {
+		// CACertBase64 is the PEM encoded CA certificate in base64 encoded
+		// format to verify the brokers, empty means the system ones.
+		CACertBase64 string `yaml:"caCertBase64,omitempty" jsonschema:"omitempty,format=base64"`
+	}
+)
+
+// Validate validates TLSSpec.
+func (spec TLSSpec) Validate() error {
+	_, err := spec.tlsConfig()
+	return err
+}
+
+// ProducerConfig returns the config of the producer, the connections are
+// plaintext without authentication unless SASL or TLS is specified, zero
+// timeout means the default dial timeout.
+func ProducerConfig(clientID string, timeout time.Duration, sasl *SASLSpec, tlsSpec *TLSSpec) (*sarama.Config, error) {
+	config := sarama.NewConfig()
+	config.ClientID = clientID
+	config.Version = sarama.V0_10_2_0
+	if timeout > 0 {
+		config.Net.DialTimeout = timeout
+	}
+
+	if tlsSpec != nil {
+		tlsConfig, err := tlsSpec.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+
+	if sasl != nil {
+		config.Net.SASL.Enable = true
+		config.Net.SASL.Mechanism = sarama.SASLMechanism(sasl.Mechanism)
+		config.Net.SASL.User = sasl.Username
+		config.Net.SASL.Password = sasl.Password
+
+		switch sasl.Mechanism {
+		case sarama.SASLTypeSCRAMSHA256:
+			config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return newSCRAMClient(sha256.New)
+			}
+		case sarama.SASLTypeSCRAMSHA512:
+			config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return newSCRAMClient(sha512.New)
+			}
+		}
+	}
+
+	err := config.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid kafka producer config: %v", err)
+	}
+
+	return config, nil
+}
+
+func (spec *TLSSpec) tlsConfig() (*tls.Config, error) {
+	if spec.CACertBase64 == "" {
+		return &tls.Config{}, nil
+	}
+
+	caCertPem, _ := base64.StdEncoding.DecodeString(spec.CACertBase64)
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCertPem) {
+		return nil, fmt.Errorf("none valid certs in caCertBase64")
+	}
+
+	return &tls.Config{RootCAs: pool}, nil
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafkaconfig
+
+import (
+	"hash"
+
+	"github.com/xdg/scram"
+)
+
+// scramClient is the SCRAM client of sarama in RFC 5802.
+type scramClient struct {
+	hashGenerator scram.HashGeneratorFcn
+	// nonceGenerator replaces the random nonce in tests.
+	nonceGenerator scram.NonceGeneratorFcn
+
+	conversation *scram.ClientConversation
+}
+
+func newSCRAMClient(h func() hash.Hash) *scramClient {
+	return &scramClient{hashGenerator: h}
+}
+
+// Begin starts the authentication, the username and password are prepared
+// by SASLprep.
+func (c *scramClient) Begin(username, password, authzID string) error {
+	client, err := c.hashGenerator.NewClient(username, password, authzID)
+	if err != nil {
+		return err
+	}
+	if c.nonceGenerator != nil {
+		client = client.WithNonceGenerator(c.nonceGenerator)
+	}
+
+	c.conversation = client.NewConversation()
+	return nil
+}
+
+// Step returns the response of the server challenge.
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.conversation.Step(challenge)
+}
+
+// Done reports whether the authentication is done.
+func (c *scramClient) Done() bool {
+	return c.conversation.Done()
+}
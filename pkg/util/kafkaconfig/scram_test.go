@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafkaconfig
+
+import (
+	"crypto/sha256"
+	"testing"
+)
+
+func TestSCRAMClient(t *testing.T) {
+	// NOTE: The conversation is the example of SCRAM-SHA-256 in RFC 7677.
+	c := newSCRAMClient(sha256.New)
+	c.nonceGenerator = func() string { return "rOprNGfwEbeRWgbNEkqO" }
+	if err := c.Begin("user", "pencil", ""); err != nil {
+		t.Fatalf("begin failed: %v", err)
+	}
+
+	msg, err := c.Step("")
+	if err != nil || msg != "n,,n=user,r=rOprNGfwEbeRWgbNEkqO" {
+		t.Fatalf("want client first message, got %q, %v", msg, err)
+	}
+
+	msg, err = c.Step("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	want := "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="
+	if err != nil || msg != want {
+		t.Fatalf("want client final message %q, got %q, %v", want, msg, err)
+	}
+	if c.Done() {
+		t.Errorf("authentication should not be done before server final message")
+	}
+
+	if _, err = c.Step("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="); err != nil || !c.Done() {
+		t.Errorf("want authentication done, got %v", err)
+	}
+
+	c.Begin("user", "pencil", "")
+	c.Step("")
+	if _, err = c.Step("r=forged,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"); err == nil {
+		t.Errorf("want error for server nonce not starting with the client nonce")
+	}
+
+	c.Begin("user", "pencil", "")
+	c.Step("")
+	c.Step("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	if _, err = c.Step("v=AAAA"); err == nil {
+		t.Errorf("want error for invalid server signature")
+	}
+}
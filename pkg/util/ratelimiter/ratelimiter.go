@@ -34,6 +34,18 @@ type (
 		TimeoutDuration    time.Duration
 		LimitRefreshPeriod time.Duration
 		LimitForPeriod     int
+		// Algorithm is one of the Algorithm* constants, default is token bucket.
+		Algorithm string
+	}
+
+	// AdaptivePolicy defines the policy to adapt the limit for period by the
+	// observed latency, the limit is lowered by Step when the P99 latency
+	// exceeds TargetLatency, and raised by Step up to the original limit
+	// when the latency is healthy.
+	AdaptivePolicy struct {
+		TargetLatency time.Duration
+		Step          int
+		AdjustPeriod  time.Duration
 	}
 
 	// Event defines the event of rate limiter
@@ -54,9 +66,35 @@ type (
 		cycle     int
 		tokens    int
 		listener  EventListenerFunc
+
+		// log is the permitted time of requests in the sliding log algorithm.
+		log []time.Time
+
+		adaptive   *AdaptivePolicy
+		maxLimit   int
+		lastAdjust time.Time
+		// observed and slow are the numbers of the latencies observed in
+		// the adjust period and the ones exceeding the target latency,
+		// they're all we need to tell whether the P99 latency exceeds it.
+		observed int
+		slow     int
 	}
 )
 
+// rate limiter algorithms
+const (
+	// AlgorithmTokenBucket permits LimitForPeriod requests in each refresh
+	// period, and reserves permissions from the following periods for the
+	// requests exceeding the limit within TimeoutDuration.
+	AlgorithmTokenBucket = "tokenBucket"
+	// AlgorithmFixedWindow permits LimitForPeriod requests in each refresh
+	// period and rejects the others immediately.
+	AlgorithmFixedWindow = "fixedWindow"
+	// AlgorithmSlidingLog permits LimitForPeriod requests in any duration of
+	// refresh period and rejects the others immediately.
+	AlgorithmSlidingLog = "slidingLog"
+)
+
 // circuit breaker states
 const (
 	StateNormal = iota
@@ -103,6 +141,7 @@ func (rl *RateLimiter) SetState(state State) {
 	if rl.state == StateDisabled {
 		rl.cycle = 0
 		rl.tokens = 0
+		rl.log = nil
 		rl.startTime = nowFunc()
 	}
 	rl.state = state
@@ -125,6 +164,70 @@ func (rl *RateLimiter) notifyListener(tm time.Time, state State) {
 	}
 }
 
+// SetAdaptivePolicy enables adapting the limit for period by the latencies
+// reported by Observe, the limit of the original policy is the upper bound.
+func (rl *RateLimiter) SetAdaptivePolicy(adaptive *AdaptivePolicy) {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	// NOTE: Copy the policy to avoid changing the one of the caller.
+	policy := *rl.policy
+	rl.policy = &policy
+
+	rl.adaptive = adaptive
+	rl.maxLimit = policy.LimitForPeriod
+	rl.lastAdjust = nowFunc()
+	rl.observed, rl.slow = 0, 0
+}
+
+// LimitForPeriod returns the current limit for period.
+func (rl *RateLimiter) LimitForPeriod() int {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+	return rl.policy.LimitForPeriod
+}
+
+// Observe records the latency of a permitted request, it adjusts the limit
+// for period at the end of each adjust period if adaptive policy is set.
+func (rl *RateLimiter) Observe(latency time.Duration) {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	if rl.adaptive == nil {
+		return
+	}
+
+	rl.observed++
+	if latency > rl.adaptive.TargetLatency {
+		rl.slow++
+	}
+
+	now := nowFunc()
+	if now.Sub(rl.lastAdjust) < rl.adaptive.AdjustPeriod {
+		return
+	}
+
+	// NOTE: The P99 latency is the one at index observed*99/100 of the
+	// sorted latencies, it exceeds the target latency if and only if the
+	// slow ones take the positions from that index to the end.
+	limit := rl.policy.LimitForPeriod
+	if rl.slow >= rl.observed-rl.observed*99/100 {
+		limit -= rl.adaptive.Step
+		if limit < 1 {
+			limit = 1
+		}
+	} else {
+		limit += rl.adaptive.Step
+		if limit > rl.maxLimit {
+			limit = rl.maxLimit
+		}
+	}
+
+	rl.policy.LimitForPeriod = limit
+	rl.lastAdjust = now
+	rl.observed, rl.slow = 0, 0
+}
+
 // AcquirePermission acquires a permission from the rate limiter.
 // returns true if the request is permitted and false otherwise.
 // when permitted, the caller should wait returned duration before action.
@@ -138,6 +241,13 @@ func (rl *RateLimiter) AcquirePermission() (bool, time.Duration) {
 
 	now := nowFunc()
 
+	switch rl.policy.Algorithm {
+	case AlgorithmFixedWindow:
+		return rl.acquireFixedWindow(now), 0
+	case AlgorithmSlidingLog:
+		return rl.acquireSlidingLog(now), 0
+	}
+
 	// max tokens could be permitted(including reserved) from the beginning of current cycle
 	maxTokens := rl.policy.LimitForPeriod
 	maxTokens *= int(rl.policy.TimeoutDuration/rl.policy.LimitRefreshPeriod) + 1
@@ -153,8 +263,9 @@ func (rl *RateLimiter) AcquirePermission() (bool, time.Duration) {
 		tokens = 0
 	}
 
-	// reject if already reached the permission limitation
-	if tokens == maxTokens {
+	// reject if already reached the permission limitation, note tokens could
+	// be greater than maxTokens after the adaptive policy lowered the limit
+	if tokens >= maxTokens {
 		return false, rl.policy.TimeoutDuration
 	}
 
@@ -186,6 +297,48 @@ func (rl *RateLimiter) AcquirePermission() (bool, time.Duration) {
 	return true, timeToWait
 }
 
+func (rl *RateLimiter) setState(now time.Time, state State) {
+	if rl.state != state {
+		rl.state = state
+		rl.notifyListener(now, rl.state)
+	}
+}
+
+func (rl *RateLimiter) acquireFixedWindow(now time.Time) bool {
+	cycle := int(now.Sub(rl.startTime) / rl.policy.LimitRefreshPeriod)
+	if cycle != rl.cycle {
+		rl.cycle = cycle
+		rl.tokens = 0
+	}
+
+	if rl.tokens >= rl.policy.LimitForPeriod {
+		rl.setState(now, StateLimiting)
+		return false
+	}
+
+	rl.tokens++
+	rl.setState(now, StateNormal)
+	return true
+}
+
+func (rl *RateLimiter) acquireSlidingLog(now time.Time) bool {
+	windowStart := now.Add(-rl.policy.LimitRefreshPeriod)
+	expired := 0
+	for expired < len(rl.log) && !rl.log[expired].After(windowStart) {
+		expired++
+	}
+	rl.log = rl.log[expired:]
+
+	if len(rl.log) >= rl.policy.LimitForPeriod {
+		rl.setState(now, StateLimiting)
+		return false
+	}
+
+	rl.log = append(rl.log, now)
+	rl.setState(now, StateNormal)
+	return true
+}
+
 // WaitPermission waits a permission from the rate limiter
 // returns true if the request is permitted and false if timed out
 func (rl *RateLimiter) WaitPermission() bool {
@@ -181,3 +181,118 @@ func TestRateLimiter(t *testing.T) {
 	}
 	limiter.SetState(StateDisabled)
 }
+
+func TestAdaptivePolicy(t *testing.T) {
+	limiter := New(NewPolicy(100, 10, 10))
+	limiter.SetAdaptivePolicy(&AdaptivePolicy{
+		TargetLatency: 100 * time.Millisecond,
+		Step:          4,
+		AdjustPeriod:  time.Second,
+	})
+
+	// no adjustment in the middle of adjust period
+	limiter.Observe(time.Second)
+	if limit := limiter.LimitForPeriod(); limit != 10 {
+		t.Errorf("want limit 10, got %d", limit)
+	}
+
+	for _, want := range []int{6, 2, 1} {
+		now = now.Add(time.Second)
+		limiter.Observe(time.Second)
+		if limit := limiter.LimitForPeriod(); limit != want {
+			t.Errorf("want limit %d for high latency, got %d", want, limit)
+		}
+	}
+
+	for _, want := range []int{5, 9, 10} {
+		now = now.Add(time.Second)
+		limiter.Observe(time.Millisecond)
+		if limit := limiter.LimitForPeriod(); limit != want {
+			t.Errorf("want limit %d for healthy latency, got %d", want, limit)
+		}
+	}
+
+	// the limit of the original policy is not changed
+	plain := New(NewPolicy(100, 10, 10))
+	plain.Observe(time.Second)
+	if limit := plain.LimitForPeriod(); limit != 10 {
+		t.Errorf("want limit 10 without adaptive policy, got %d", limit)
+	}
+}
+
+func TestAdaptivePolicyP99(t *testing.T) {
+	limiter := New(NewPolicy(100, 10, 10))
+	limiter.SetAdaptivePolicy(&AdaptivePolicy{
+		TargetLatency: 100 * time.Millisecond,
+		Step:          4,
+		AdjustPeriod:  time.Second,
+	})
+
+	// 1 slow one in 200 latencies, the P99 latency is healthy
+	for i := 0; i < 198; i++ {
+		limiter.Observe(time.Millisecond)
+	}
+	limiter.Observe(time.Second)
+	now = now.Add(time.Second)
+	limiter.Observe(time.Millisecond)
+	if limit := limiter.LimitForPeriod(); limit != 10 {
+		t.Errorf("want limit 10, got %d", limit)
+	}
+
+	// 2 slow ones in 200 latencies, the P99 latency is high
+	for i := 0; i < 198; i++ {
+		limiter.Observe(time.Millisecond)
+	}
+	limiter.Observe(time.Second)
+	now = now.Add(time.Second)
+	limiter.Observe(time.Second)
+	if limit := limiter.LimitForPeriod(); limit != 6 {
+		t.Errorf("want limit 6, got %d", limit)
+	}
+}
+
+func TestFixedWindow(t *testing.T) {
+	policy := NewPolicy(100, 10, 3)
+	policy.Algorithm = AlgorithmFixedWindow
+	limiter := New(policy)
+
+	for i := 0; i < 3; i++ {
+		if permitted, d := limiter.AcquirePermission(); !permitted || d != 0 {
+			t.Errorf("request %d should be permitted without waiting", i)
+		}
+	}
+	if permitted, _ := limiter.AcquirePermission(); permitted {
+		t.Errorf("request exceeding the window limit should be rejected")
+	}
+
+	now = now.Add(10 * time.Millisecond)
+	if permitted, _ := limiter.AcquirePermission(); !permitted {
+		t.Errorf("request in the next window should be permitted")
+	}
+}
+
+func TestSlidingLog(t *testing.T) {
+	policy := NewPolicy(100, 10, 2)
+	policy.Algorithm = AlgorithmSlidingLog
+	limiter := New(policy)
+
+	if permitted, _ := limiter.AcquirePermission(); !permitted {
+		t.Errorf("first request should be permitted")
+	}
+	now = now.Add(6 * time.Millisecond)
+	if permitted, _ := limiter.AcquirePermission(); !permitted {
+		t.Errorf("second request should be permitted")
+	}
+	if permitted, _ := limiter.AcquirePermission(); permitted {
+		t.Errorf("third request should be rejected")
+	}
+
+	// the first request slides out of the log, but the second is still in it
+	now = now.Add(5 * time.Millisecond)
+	if permitted, _ := limiter.AcquirePermission(); !permitted {
+		t.Errorf("request after the first one expired should be permitted")
+	}
+	if permitted, _ := limiter.AcquirePermission(); permitted {
+		t.Errorf("request exceeding the log limit should be rejected")
+	}
+}
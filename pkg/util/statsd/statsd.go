@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package statsd
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// TagFormatNone drops the tags.
+	TagFormatNone = ""
+	// TagFormatDatadog appends tags like `|#key:value`.
+	TagFormatDatadog = "datadog"
+	// TagFormatInfluxDB appends tags to the name like `name,key=value`.
+	TagFormatInfluxDB = "influxdb"
+	// TagFormatGraphite appends tags to the name like `name;key=value`.
+	TagFormatGraphite = "graphite"
+)
+
+type (
+	// Client sends metrics to a StatsD server.
+	Client struct {
+		conn      net.Conn
+		prefix    string
+		tagFormat string
+	}
+)
+
+// New creates a Client sending metrics to the address over UDP.
+func New(address, prefix, tagFormat string) (*Client, error) {
+	switch tagFormat {
+	case TagFormatNone, TagFormatDatadog, TagFormatInfluxDB, TagFormatGraphite:
+	default:
+		return nil, fmt.Errorf("unsupported tag format: %s", tagFormat)
+	}
+
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s failed: %v", address, err)
+	}
+
+	return &Client{
+		conn:      conn,
+		prefix:    prefix,
+		tagFormat: tagFormat,
+	}, nil
+}
+
+// Count sends a counter.
+func (c *Client) Count(name string, value int64, tags map[string]string) error {
+	return c.send(Line(c.prefix, name, fmt.Sprintf("%d", value), "c", c.tagFormat, tags))
+}
+
+// Timing sends a timer in milliseconds.
+func (c *Client) Timing(name string, d time.Duration, tags map[string]string) error {
+	return c.send(Line(c.prefix, name, fmt.Sprintf("%d", d.Milliseconds()), "ms", c.tagFormat, tags))
+}
+
+// Gauge sends a gauge.
+func (c *Client) Gauge(name string, value float64, tags map[string]string) error {
+	return c.send(Line(c.prefix, name, fmt.Sprintf("%g", value), "g", c.tagFormat, tags))
+}
+
+// Close closes the client.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) send(line string) error {
+	_, err := c.conn.Write([]byte(line))
+	return err
+}
+
+// Line formats one StatsD line, the tags are sorted by key.
+func Line(prefix, name, value, metricType, tagFormat string, tags map[string]string) string {
+	if prefix != "" {
+		name = strings.TrimSuffix(prefix, ".") + "." + name
+	}
+
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := func(sep string) string {
+		ss := make([]string, 0, len(keys))
+		for _, k := range keys {
+			ss = append(ss, k+sep+tags[k])
+		}
+		return strings.Join(ss, ",")
+	}
+
+	if len(keys) == 0 {
+		tagFormat = TagFormatNone
+	}
+
+	switch tagFormat {
+	case TagFormatDatadog:
+		return fmt.Sprintf("%s:%s|%s|#%s", name, value, metricType, pairs(":"))
+	case TagFormatInfluxDB:
+		return fmt.Sprintf("%s,%s:%s|%s", name, pairs("="), value, metricType)
+	case TagFormatGraphite:
+		return fmt.Sprintf("%s;%s:%s|%s", name, strings.ReplaceAll(pairs("="), ",", ";"), value, metricType)
+	default:
+		return fmt.Sprintf("%s:%s|%s", name, value, metricType)
+	}
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package statsd
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLine(t *testing.T) {
+	tags := map[string]string{
+		"service": "order",
+		"code":    "200",
+	}
+
+	cases := []struct {
+		prefix     string
+		metricType string
+		tagFormat  string
+		tags       map[string]string
+		want       string
+	}{
+		{"", "c", TagFormatNone, tags, "requests:10|c"},
+		{"mesh.", "c", TagFormatNone, nil, "mesh.requests:10|c"},
+		{"mesh", "ms", TagFormatDatadog, tags, "mesh.requests:10|ms|#code:200,service:order"},
+		{"mesh", "c", TagFormatInfluxDB, tags, "mesh.requests,code=200,service=order:10|c"},
+		{"mesh", "c", TagFormatGraphite, tags, "mesh.requests;code=200;service=order:10|c"},
+		{"mesh", "c", TagFormatDatadog, nil, "mesh.requests:10|c"},
+	}
+
+	for i, c := range cases {
+		got := Line(c.prefix, "requests", "10", c.metricType, c.tagFormat, c.tags)
+		if got != c.want {
+			t.Errorf("case %d: want %s, got %s", i, c.want, got)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := New(conn.LocalAddr().String(), "mesh", "unknown"); err == nil {
+		t.Errorf("unknown tag format should failed")
+	}
+
+	c, err := New(conn.LocalAddr().String(), "mesh", TagFormatDatadog)
+	if err != nil {
+		t.Fatalf("new client failed: %v", err)
+	}
+	defer c.Close()
+
+	buff := make([]byte, 1024)
+	expect := func(want string) {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buff)
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		if got := string(buff[:n]); got != want {
+			t.Errorf("want %s, got %s", want, got)
+		}
+	}
+
+	c.Count("requests", 3, map[string]string{"service": "order"})
+	expect("mesh.requests:3|c|#service:order")
+
+	c.Timing("latency", 150*time.Millisecond, nil)
+	expect("mesh.latency:150|ms")
+
+	c.Gauge("connections", 2.5, nil)
+	expect("mesh.connections:2.5|g")
+}